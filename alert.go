@@ -0,0 +1,73 @@
+package shuttletracker
+
+import (
+	"fmt"
+	"time"
+)
+
+// Alert types describe the kind of operational problem an Alert reports.
+const (
+	AlertFeedDown          = "feed_down"
+	AlertFeedRecovered     = "feed_recovered"
+	AlertVehicleSilent     = "vehicle_silent"
+	AlertVehicleReporting  = "vehicle_reporting"
+	AlertGeofenceViolation = "geofence_violation"
+	AlertGeofenceReentered = "geofence_reentered"
+	AlertVehicleStuck      = "vehicle_stuck"
+	AlertVehicleUnstuck    = "vehicle_unstuck"
+	AlertServiceGap        = "service_gap"
+	AlertServiceRestored   = "service_restored"
+)
+
+// Alert is an operational event that dispatchers should know about, such as
+// the data feed going down or a vehicle leaving the service area.
+type Alert struct {
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Created time.Time `json:"created"`
+
+	// VehicleID is a pointer to an int64 because not every Alert is about a Vehicle.
+	VehicleID *int64 `json:"vehicle_id"`
+
+	// RouteID is set for Alerts about a Route rather than a Vehicle.
+	RouteID *int64 `json:"route_id"`
+
+	// MessageFormat and MessageArgs are what Message was made from, so that
+	// it can be translated.
+	MessageFormat string   `json:"message_format,omitempty"`
+	MessageArgs   []string `json:"message_args,omitempty"`
+}
+
+// SetMessage sets the Alert's Message to format with each %s replaced by the
+// next of args, and remembers them so that the Message can be translated.
+func (a *Alert) SetMessage(format string, args ...string) {
+	a.MessageFormat = format
+	a.MessageArgs = args
+	a.Message = formatMessage(format, args)
+}
+
+// formatMessage replaces each %s in format with the next of args.
+func formatMessage(format string, args []string) string {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return fmt.Sprintf(format, values...)
+}
+
+// TranslatedMessage returns the Alert's Message made from a translation of
+// its MessageFormat, which must have as many %s as the original. Alerts
+// without a MessageFormat can't be translated, so their Message is returned.
+func (a *Alert) TranslatedMessage(format string) string {
+	if a.MessageFormat == "" {
+		return a.Message
+	}
+	return formatMessage(format, a.MessageArgs)
+}
+
+// AlertService is an interface for sending operational Alerts and being
+// notified of them.
+type AlertService interface {
+	SendAlert(alert *Alert)
+	Subscribe(func(*Alert))
+}
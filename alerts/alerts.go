@@ -0,0 +1,552 @@
+// Package alerts watches for operational problems and posts them to Slack or
+// Discord so that dispatchers notice them without watching the dashboard.
+package alerts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/analytics"
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/notify"
+)
+
+// Config holds alert settings.
+type Config struct {
+	SlackWebhookURL        string
+	DiscordWebhookURL      string
+	CheckInterval          string
+	FeedDownThreshold      string
+	VehicleSilentThreshold string
+	Geofence               Geofence
+
+	// VehicleStuckThreshold is how long a vehicle on a route can report
+	// locations within VehicleStuckDistance meters of the same place before
+	// it's considered stuck. Zero disables stuck vehicle alerts.
+	VehicleStuckThreshold string
+	VehicleStuckDistance  float64
+
+	// ServiceGapThreshold is how long a stop on a scheduled route can go
+	// without a vehicle on that route arriving. Zero disables service gap
+	// alerts.
+	ServiceGapThreshold string
+
+	// DedupeWindow and DailyCap keep a flapping condition from flooding a webhook.
+	DedupeWindow string
+	DailyCap     int
+}
+
+// Geofence is a bounding box that vehicles are expected to stay inside of.
+// A zero Geofence disables geofence violation alerts.
+type Geofence struct {
+	MinLatitude  float64
+	MaxLatitude  float64
+	MinLongitude float64
+	MaxLongitude float64
+}
+
+func (g Geofence) enabled() bool {
+	return g != Geofence{}
+}
+
+func (g Geofence) contains(latitude, longitude float64) bool {
+	return latitude >= g.MinLatitude && latitude <= g.MaxLatitude &&
+		longitude >= g.MinLongitude && longitude <= g.MaxLongitude
+}
+
+// Manager periodically checks the data feed and vehicles for problems and sends
+// an Alert to every configured webhook when the state of something changes.
+type Manager struct {
+	cfg                    Config
+	checkInterval          time.Duration
+	feedDownThreshold      time.Duration
+	vehicleSilentThreshold time.Duration
+	vehicleStuckThreshold  time.Duration
+	vehicleStuckDistance   float64
+	serviceGapThreshold    time.Duration
+	ms                     shuttletracker.ModelService
+	updater                shuttletracker.UpdaterService
+	leader                 shuttletracker.LeaderService
+	notifiers              []notifier
+	throttle               *notify.Throttle
+	alerts                 chan *shuttletracker.Alert
+	sm                     sync.Mutex
+	subscribers            []func(*shuttletracker.Alert)
+	stop                   chan struct{}
+
+	// lock guards the thresholds above, which Reload can change, and
+	// intervalChanged tells Run when checkInterval has.
+	lock            sync.Mutex
+	intervalChanged chan struct{}
+
+	// Everything after this is internal state owned by Run.
+	started        time.Time
+	feedDown       bool
+	silentVehicles map[int64]bool
+	outsideFence   map[int64]bool
+	stuck          *stuckDetector
+	gapRoutes      map[int64]bool
+}
+
+// New creates a Manager. Every instance tracks the state of the feed and
+// vehicles, but only the leader sends Alerts.
+func New(cfg Config, ms shuttletracker.ModelService, updater shuttletracker.UpdaterService, leader shuttletracker.LeaderService) (*Manager, error) {
+	m := &Manager{
+		cfg:            cfg,
+		ms:             ms,
+		updater:        updater,
+		leader:         leader,
+		alerts:         make(chan *shuttletracker.Alert, 50),
+		silentVehicles: map[int64]bool{},
+		outsideFence:   map[int64]bool{},
+		stuck:          newStuckDetector(),
+		gapRoutes:      map[int64]bool{},
+		stop:           make(chan struct{}),
+
+		intervalChanged: make(chan struct{}, 1),
+	}
+
+	var err error
+	m.checkInterval, err = time.ParseDuration(cfg.CheckInterval)
+	if err != nil {
+		return nil, err
+	}
+	m.feedDownThreshold, err = time.ParseDuration(cfg.FeedDownThreshold)
+	if err != nil {
+		return nil, err
+	}
+	m.vehicleSilentThreshold, err = time.ParseDuration(cfg.VehicleSilentThreshold)
+	if err != nil {
+		return nil, err
+	}
+	m.vehicleStuckThreshold, err = time.ParseDuration(cfg.VehicleStuckThreshold)
+	if err != nil {
+		return nil, err
+	}
+	m.vehicleStuckDistance = cfg.VehicleStuckDistance
+	m.serviceGapThreshold, err = time.ParseDuration(cfg.ServiceGapThreshold)
+	if err != nil {
+		return nil, err
+	}
+	dedupeWindow, err := time.ParseDuration(cfg.DedupeWindow)
+	if err != nil {
+		return nil, err
+	}
+	m.throttle = notify.NewThrottle(dedupeWindow, cfg.DailyCap)
+
+	if cfg.SlackWebhookURL != "" {
+		m.notifiers = append(m.notifiers, newSlackNotifier(cfg.SlackWebhookURL))
+	}
+	if cfg.DiscordWebhookURL != "" {
+		m.notifiers = append(m.notifiers, newDiscordNotifier(cfg.DiscordWebhookURL))
+	}
+
+	return m, nil
+}
+
+// NewConfig creates a new Config.
+func NewConfig(v *viper.Viper) *Config {
+	cfg := &Config{
+		CheckInterval:          "1m",
+		FeedDownThreshold:      "5m",
+		VehicleSilentThreshold: "5m",
+		VehicleStuckThreshold:  "10m",
+		VehicleStuckDistance:   50,
+		ServiceGapThreshold:    "20m",
+		DedupeWindow:           "15m",
+		DailyCap:               200,
+	}
+	v.SetDefault("alerts.slackwebhookurl", cfg.SlackWebhookURL)
+	v.SetDefault("alerts.discordwebhookurl", cfg.DiscordWebhookURL)
+	v.SetDefault("alerts.checkinterval", cfg.CheckInterval)
+	v.SetDefault("alerts.feeddownthreshold", cfg.FeedDownThreshold)
+	v.SetDefault("alerts.vehiclesilentthreshold", cfg.VehicleSilentThreshold)
+	v.SetDefault("alerts.vehiclestuckthreshold", cfg.VehicleStuckThreshold)
+	v.SetDefault("alerts.vehiclestuckdistance", cfg.VehicleStuckDistance)
+	v.SetDefault("alerts.servicegapthreshold", cfg.ServiceGapThreshold)
+	v.SetDefault("alerts.dedupewindow", cfg.DedupeWindow)
+	v.SetDefault("alerts.dailycap", cfg.DailyCap)
+	return cfg
+}
+
+// Run checks for problems forever. It does nothing if no webhooks are
+// configured and nothing has subscribed.
+func (m *Manager) Run() {
+	m.sm.Lock()
+	subscribed := len(m.subscribers) > 0
+	m.sm.Unlock()
+	if len(m.notifiers) == 0 && !subscribed {
+		log.Debug("No alert webhooks configured.")
+		return
+	}
+	log.Debug("Alert manager started.")
+	m.started = time.Now()
+
+	// Get the initial state of vehicles without alerting about them, since a
+	// vehicle that was already silent when we started is not news.
+	m.checkVehicles(false)
+	m.checkRoutes(false)
+
+	go m.send()
+
+	var locChan chan *shuttletracker.Location
+	if m.cfg.Geofence.enabled() {
+		locChan = m.ms.SubscribeLocations()
+	}
+
+	ticker := time.NewTicker(m.thresholds().checkInterval)
+	defer func() {
+		ticker.Stop()
+	}()
+	for {
+		select {
+		case <-ticker.C:
+			m.checkFeed()
+			m.checkVehicles(true)
+			m.checkRoutes(true)
+		case <-m.intervalChanged:
+			ticker.Stop()
+			ticker = time.NewTicker(m.thresholds().checkInterval)
+		case loc := <-locChan:
+			m.checkGeofence(loc)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// send delivers queued Alerts until Stop is called. Webhooks can take seconds
+// to respond, so they're kept apart from Run, which receives locations.
+func (m *Manager) send() {
+	for {
+		select {
+		case alert := <-m.alerts:
+			m.notify(alert)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Stop makes Run return, and stops sending alerts after the current one.
+func (m *Manager) Stop() {
+	close(m.stop)
+}
+
+// thresholds are the settings that Reload can change.
+type thresholds struct {
+	checkInterval          time.Duration
+	feedDownThreshold      time.Duration
+	vehicleSilentThreshold time.Duration
+	vehicleStuckThreshold  time.Duration
+	vehicleStuckDistance   float64
+	serviceGapThreshold    time.Duration
+}
+
+func (m *Manager) thresholds() thresholds {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return thresholds{m.checkInterval, m.feedDownThreshold, m.vehicleSilentThreshold, m.vehicleStuckThreshold, m.vehicleStuckDistance, m.serviceGapThreshold}
+}
+
+// Reload applies the settings that can change while the manager is running:
+// the check interval, thresholds, and throttling. Webhooks and the geofence
+// can't be changed without restarting.
+func (m *Manager) Reload(cfg Config) error {
+	t := thresholds{}
+	var err error
+	if t.checkInterval, err = time.ParseDuration(cfg.CheckInterval); err != nil {
+		return err
+	}
+	if t.feedDownThreshold, err = time.ParseDuration(cfg.FeedDownThreshold); err != nil {
+		return err
+	}
+	if t.vehicleSilentThreshold, err = time.ParseDuration(cfg.VehicleSilentThreshold); err != nil {
+		return err
+	}
+	if t.vehicleStuckThreshold, err = time.ParseDuration(cfg.VehicleStuckThreshold); err != nil {
+		return err
+	}
+	t.vehicleStuckDistance = cfg.VehicleStuckDistance
+	if t.serviceGapThreshold, err = time.ParseDuration(cfg.ServiceGapThreshold); err != nil {
+		return err
+	}
+	dedupeWindow, err := time.ParseDuration(cfg.DedupeWindow)
+	if err != nil {
+		return err
+	}
+	m.throttle.SetLimits(dedupeWindow, cfg.DailyCap)
+
+	m.lock.Lock()
+	changed := t.checkInterval != m.checkInterval
+	m.checkInterval = t.checkInterval
+	m.feedDownThreshold = t.feedDownThreshold
+	m.vehicleSilentThreshold = t.vehicleSilentThreshold
+	m.vehicleStuckThreshold = t.vehicleStuckThreshold
+	m.vehicleStuckDistance = t.vehicleStuckDistance
+	m.serviceGapThreshold = t.serviceGapThreshold
+	m.lock.Unlock()
+	if changed {
+		select {
+		case m.intervalChanged <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// SendAlert queues an Alert to be sent to all configured webhooks. It can be
+// used by other subsystems to report problems that they detect.
+func (m *Manager) SendAlert(alert *shuttletracker.Alert) {
+	if alert.Created.IsZero() {
+		alert.Created = time.Now()
+	}
+	select {
+	case m.alerts <- alert:
+	default:
+		log.Warnf("alert queue full; dropping %s alert", alert.Type)
+	}
+}
+
+// Subscribe allows callers to provide a callback to receive every Alert,
+// regardless of webhook throttling. Callbacks must not block.
+func (m *Manager) Subscribe(sub func(*shuttletracker.Alert)) {
+	m.sm.Lock()
+	m.subscribers = append(m.subscribers, sub)
+	m.sm.Unlock()
+}
+
+func (m *Manager) notify(alert *shuttletracker.Alert) {
+	if !m.leader.Leader() {
+		return
+	}
+
+	m.sm.Lock()
+	for _, sub := range m.subscribers {
+		sub(alert)
+	}
+	m.sm.Unlock()
+
+	entity := ""
+	if alert.VehicleID != nil {
+		entity = strconv.FormatInt(*alert.VehicleID, 10)
+	} else if alert.RouteID != nil {
+		entity = "route " + strconv.FormatInt(*alert.RouteID, 10)
+	}
+
+	var notifyErr error
+	for _, n := range m.notifiers {
+		key := notify.Key{
+			Subscriber: n.subscriber(),
+			EventType:  alert.Type,
+			Entity:     entity,
+		}
+		if !m.throttle.Allow(key) {
+			log.Debugf("suppressing repeated %s alert", alert.Type)
+			continue
+		}
+		if err := n.notify(alert); err != nil {
+			notifyErr = err
+			log.WithError(err).Errorf("unable to send %s alert", alert.Type)
+		}
+	}
+	if len(m.notifiers) > 0 {
+		health.ReportDegraded(health.Notifiers, notifyErr)
+	}
+}
+
+func (m *Manager) checkFeed() {
+	last := m.started
+	if resp := m.updater.GetLastResponse(); resp != nil {
+		last = resp.Received
+	}
+	down := time.Since(last) > m.thresholds().feedDownThreshold
+
+	if down && !m.feedDown {
+		alert := &shuttletracker.Alert{
+			Type:    shuttletracker.AlertFeedDown,
+			Created: time.Now(),
+		}
+		alert.SetMessage("The data feed has not responded successfully since %s.", last.Format(time.Kitchen))
+		m.SendAlert(alert)
+	} else if !down && m.feedDown {
+		alert := &shuttletracker.Alert{
+			Type:    shuttletracker.AlertFeedRecovered,
+			Created: time.Now(),
+		}
+		alert.SetMessage("The data feed is responding again.")
+		m.SendAlert(alert)
+	}
+	m.feedDown = down
+}
+
+// checkVehicles finds vehicles that were on a route but have stopped reporting
+// or stopped moving. Vehicles that go silent while off route (e.g. parked for
+// the night) are ignored.
+func (m *Manager) checkVehicles(shouldNotify bool) {
+	vehicles, err := m.ms.EnabledVehicles()
+	if err != nil {
+		log.WithError(err).Error("unable to get enabled vehicles")
+		return
+	}
+
+	t := m.thresholds()
+	for _, vehicle := range vehicles {
+		loc, err := m.ms.LatestLocation(vehicle.ID)
+		if err == shuttletracker.ErrLocationNotFound {
+			continue
+		} else if err != nil {
+			log.WithError(err).Error("unable to get latest location")
+			continue
+		}
+
+		silent := time.Since(loc.Time) > t.vehicleSilentThreshold && loc.RouteID != nil
+		wasSilent := m.silentVehicles[vehicle.ID]
+		m.silentVehicles[vehicle.ID] = silent
+		vehicleID := vehicle.ID
+		if shouldNotify && silent != wasSilent {
+			alert := &shuttletracker.Alert{
+				VehicleID: &vehicleID,
+				Created:   time.Now(),
+			}
+			if silent {
+				alert.Type = shuttletracker.AlertVehicleSilent
+				alert.SetMessage("%s has not reported a location since %s.", vehicle.Name, loc.Time.Format(time.Kitchen))
+			} else {
+				alert.Type = shuttletracker.AlertVehicleReporting
+				alert.SetMessage("%s is reporting locations again.", vehicle.Name)
+			}
+			m.SendAlert(alert)
+		}
+
+		// A silent vehicle's latest location doesn't say whether it's moving.
+		if silent {
+			continue
+		}
+		stuck, changed := m.stuck.update(vehicle.ID, loc, t.vehicleStuckThreshold, t.vehicleStuckDistance)
+		if !shouldNotify || !changed {
+			continue
+		}
+		alert := &shuttletracker.Alert{
+			VehicleID: &vehicleID,
+			Created:   time.Now(),
+		}
+		if stuck {
+			alert.Type = shuttletracker.AlertVehicleStuck
+			alert.SetMessage("%s has been on its route without moving more than %s meters for %s.", vehicle.Name,
+				strconv.FormatFloat(t.vehicleStuckDistance, 'g', -1, 64), t.vehicleStuckThreshold.String())
+		} else {
+			alert.Type = shuttletracker.AlertVehicleUnstuck
+			alert.SetMessage("%s is moving or off its route again.", vehicle.Name)
+		}
+		m.SendAlert(alert)
+	}
+}
+
+// checkRoutes finds scheduled routes with stops that no vehicle on the route
+// has arrived at for serviceGapThreshold. Routes without a schedule are
+// ignored, since there's no telling whether they're supposed to be running.
+func (m *Manager) checkRoutes(shouldNotify bool) {
+	threshold := m.thresholds().serviceGapThreshold
+	if threshold == 0 {
+		return
+	}
+	routes, err := m.ms.Routes()
+	if err != nil {
+		log.WithError(err).Error("unable to get routes")
+		return
+	}
+	stops, err := m.ms.Stops()
+	if err != nil {
+		log.WithError(err).Error("unable to get stops")
+		return
+	}
+	stopNames := map[int64]string{}
+	for _, stop := range stops {
+		stopNames[stop.ID] = fmt.Sprintf("stop %d", stop.ID)
+		if stop.Name != nil && *stop.Name != "" {
+			stopNames[stop.ID] = *stop.Name
+		}
+	}
+
+	now := time.Now()
+	filter := shuttletracker.HistoryFilter{Since: now.Add(-threshold), Until: now}
+	coverage, err := analytics.ServiceGaps(m.ms, filter, threshold)
+	if err != nil {
+		log.WithError(err).Error("unable to find service gaps")
+		return
+	}
+	// A gap as long as the whole window means the route was scheduled to
+	// run for all of it without a vehicle arriving.
+	unserved := map[int64][]string{}
+	for _, c := range coverage {
+		if len(c.Gaps) > 0 {
+			unserved[c.RouteID] = append(unserved[c.RouteID], stopNames[c.StopID])
+		}
+	}
+
+	for _, route := range routes {
+		if len(route.Schedule) == 0 {
+			continue
+		}
+		gap := len(unserved[route.ID]) > 0
+		hadGap := m.gapRoutes[route.ID]
+		m.gapRoutes[route.ID] = gap
+		if !shouldNotify || gap == hadGap {
+			continue
+		}
+		routeID := route.ID
+		alert := &shuttletracker.Alert{
+			RouteID: &routeID,
+			Created: now,
+		}
+		if gap {
+			alert.Type = shuttletracker.AlertServiceGap
+			alert.SetMessage("No %s shuttle has arrived at %s in %s.", route.Name, strings.Join(unserved[route.ID], ", "), threshold.String())
+		} else {
+			alert.Type = shuttletracker.AlertServiceRestored
+			alert.SetMessage("%s shuttles are arriving at every stop again.", route.Name)
+		}
+		m.SendAlert(alert)
+	}
+}
+
+func (m *Manager) checkGeofence(loc *shuttletracker.Location) {
+	if loc == nil || loc.VehicleID == nil {
+		return
+	}
+	vehicleID := *loc.VehicleID
+
+	outside := !m.cfg.Geofence.contains(loc.Latitude, loc.Longitude)
+	wasOutside := m.outsideFence[vehicleID]
+	m.outsideFence[vehicleID] = outside
+	if outside == wasOutside {
+		return
+	}
+
+	name := fmt.Sprintf("Vehicle %d", vehicleID)
+	if vehicle, err := m.ms.Vehicle(vehicleID); err == nil {
+		name = vehicle.Name
+	}
+
+	alert := &shuttletracker.Alert{
+		VehicleID: &vehicleID,
+		Created:   time.Now(),
+	}
+	if outside {
+		alert.Type = shuttletracker.AlertGeofenceViolation
+		alert.SetMessage("%s left the service area at (%s, %s).", name,
+			strconv.FormatFloat(loc.Latitude, 'f', 6, 64), strconv.FormatFloat(loc.Longitude, 'f', 6, 64))
+	} else {
+		alert.Type = shuttletracker.AlertGeofenceReentered
+		alert.SetMessage("%s is back inside the service area.", name)
+	}
+	m.SendAlert(alert)
+}
@@ -0,0 +1,58 @@
+package alerts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestGeofenceAlertsDontWaitForWebhooks(t *testing.T) {
+	unblock := make(chan struct{})
+	received := make(chan struct{}, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		received <- struct{}{}
+	}))
+	defer ts.Close()
+	defer close(unblock)
+
+	cfg := NewConfig(viper.New())
+	cfg.SlackWebhookURL = ts.URL
+	cfg.Geofence = Geofence{MinLatitude: 42.7, MaxLatitude: 42.8, MinLongitude: -73.7, MaxLongitude: -73.6}
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicle", int64(1)).Return(&shuttletracker.Vehicle{ID: 1, Name: "Bus 1"}, nil)
+	leader := &mock.LeaderService{}
+	leader.On("Leader").Return(true)
+	m, err := New(*cfg, ms, nil, leader)
+	if err != nil {
+		t.Fatalf("unable to create manager: %s", err)
+	}
+	go m.send()
+	defer m.Stop()
+
+	vehicleID := int64(1)
+	done := make(chan struct{})
+	go func() {
+		m.checkGeofence(&shuttletracker.Location{VehicleID: &vehicleID, Latitude: 43, Longitude: -73.65})
+		m.checkGeofence(&shuttletracker.Location{VehicleID: &vehicleID, Latitude: 42.75, Longitude: -73.65})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("checking the geofence waited for the webhook")
+	}
+
+	unblock <- struct{}{}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Error("the alert wasn't sent to the webhook")
+	}
+}
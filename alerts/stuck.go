@@ -0,0 +1,39 @@
+package alerts
+
+import (
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// stuckDetector finds vehicles on a route that keep reporting locations
+// without going anywhere, e.g. because they broke down or the driver left the
+// tracker behind. It is not safe for concurrent use.
+type stuckDetector struct {
+	// anchors holds where each vehicle was when it was last seen moving.
+	anchors map[int64]*shuttletracker.Location
+	stuck   map[int64]bool
+}
+
+func newStuckDetector() *stuckDetector {
+	return &stuckDetector{
+		anchors: map[int64]*shuttletracker.Location{},
+		stuck:   map[int64]bool{},
+	}
+}
+
+// update records a vehicle's latest Location and returns whether it has been
+// within distance meters of the same place for at least threshold while on a
+// route, and whether that changed since the last update. A zero threshold
+// disables detection.
+func (sd *stuckDetector) update(vehicleID int64, loc *shuttletracker.Location, threshold time.Duration, distance float64) (stuck, changed bool) {
+	anchor := sd.anchors[vehicleID]
+	if anchor == nil || loc.RouteID == nil || shuttletracker.DistanceBetween(anchor.Latitude, anchor.Longitude, loc.Latitude, loc.Longitude) > distance {
+		anchor = loc
+		sd.anchors[vehicleID] = loc
+	}
+	stuck = threshold > 0 && loc.Time.Sub(anchor.Time) >= threshold
+	changed = stuck != sd.stuck[vehicleID]
+	sd.stuck[vehicleID] = stuck
+	return stuck, changed
+}
@@ -0,0 +1,55 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestStuckDetector(t *testing.T) {
+	start := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.UTC)
+	routeID := int64(1)
+	loc := func(minutes int, latitude float64, onRoute bool) *shuttletracker.Location {
+		l := &shuttletracker.Location{
+			Latitude: latitude,
+			Time:     start.Add(time.Duration(minutes) * time.Minute),
+		}
+		if onRoute {
+			l.RouteID = &routeID
+		}
+		return l
+	}
+
+	type step struct {
+		loc            *shuttletracker.Location
+		stuck, changed bool
+	}
+	// 0.0001 degrees of latitude is about 11 meters.
+	steps := []step{
+		{loc(0, 42.7300, true), false, false},
+		{loc(5, 42.7301, true), false, false},
+		{loc(10, 42.7302, true), true, true},
+		{loc(11, 42.7302, true), true, false},
+		// moved more than 50 meters
+		{loc(12, 42.7310, true), false, true},
+		{loc(20, 42.7310, true), false, false},
+		// parked off route doesn't count
+		{loc(30, 42.7310, false), false, false},
+		{loc(45, 42.7310, false), false, false},
+	}
+	sd := newStuckDetector()
+	for i, s := range steps {
+		stuck, changed := sd.update(2, s.loc, 10*time.Minute, 50)
+		if stuck != s.stuck || changed != s.changed {
+			t.Errorf("step %d: got stuck %t and changed %t, expected %t and %t", i, stuck, changed, s.stuck, s.changed)
+		}
+	}
+
+	// a zero threshold disables detection
+	sd = newStuckDetector()
+	sd.update(2, loc(0, 42.73, true), 0, 50)
+	if stuck, _ := sd.update(2, loc(60, 42.73, true), 0, 50); stuck {
+		t.Error("expected vehicle not to be stuck with a zero threshold")
+	}
+}
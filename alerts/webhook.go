@@ -0,0 +1,69 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// A notifier delivers an Alert somewhere that people will see it.
+type notifier interface {
+	notify(alert *shuttletracker.Alert) error
+
+	// subscriber uniquely identifies the destination for throttling purposes.
+	subscriber() string
+}
+
+// webhookNotifier posts a JSON payload to an incoming webhook URL. Slack and
+// Discord webhooks differ only in the shape of that payload.
+type webhookNotifier struct {
+	url     string
+	client  *http.Client
+	payload func(alert *shuttletracker.Alert) interface{}
+}
+
+func newSlackNotifier(url string) *webhookNotifier {
+	return &webhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: time.Second * 5},
+		payload: func(alert *shuttletracker.Alert) interface{} {
+			return map[string]string{"text": alert.Message}
+		},
+	}
+}
+
+func newDiscordNotifier(url string) *webhookNotifier {
+	return &webhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: time.Second * 5},
+		payload: func(alert *shuttletracker.Alert) interface{} {
+			return map[string]string{"content": alert.Message}
+		},
+	}
+}
+
+func (wn *webhookNotifier) subscriber() string {
+	return wn.url
+}
+
+func (wn *webhookNotifier) notify(alert *shuttletracker.Alert) error {
+	b, err := json.Marshal(wn.payload(alert))
+	if err != nil {
+		return err
+	}
+
+	resp, err := wn.client.Post(wn.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
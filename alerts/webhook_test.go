@@ -0,0 +1,86 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestWebhookPayloads(t *testing.T) {
+	type testCase struct {
+		newNotifier func(url string) *webhookNotifier
+		key         string
+	}
+	cases := []testCase{
+		{
+			newNotifier: newSlackNotifier,
+			key:         "text",
+		},
+		{
+			newNotifier: newDiscordNotifier,
+			key:         "content",
+		},
+	}
+
+	for _, c := range cases {
+		var received map[string]string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := json.NewDecoder(r.Body).Decode(&received)
+			if err != nil {
+				t.Errorf("unable to decode payload: %s", err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		alert := &shuttletracker.Alert{
+			Type:    shuttletracker.AlertFeedDown,
+			Message: "the feed is down",
+		}
+		err := c.newNotifier(ts.URL).notify(alert)
+		ts.Close()
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+			continue
+		}
+
+		if received[c.key] != alert.Message {
+			t.Errorf("got payload %+v, expected %s to be \"%s\"", received, c.key, alert.Message)
+		}
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	err := newSlackNotifier(ts.URL).notify(&shuttletracker.Alert{})
+	if err == nil {
+		t.Error("expected error for 404 response")
+	}
+}
+
+func TestGeofenceContains(t *testing.T) {
+	g := Geofence{
+		MinLatitude:  42.72,
+		MaxLatitude:  42.74,
+		MinLongitude: -73.70,
+		MaxLongitude: -73.66,
+	}
+	if !g.enabled() {
+		t.Error("expected geofence to be enabled")
+	}
+	if !g.contains(42.73, -73.68) {
+		t.Error("expected point to be inside geofence")
+	}
+	if g.contains(42.80, -73.68) {
+		t.Error("expected point to be outside geofence")
+	}
+	if (Geofence{}).enabled() {
+		t.Error("expected zero geofence to be disabled")
+	}
+}
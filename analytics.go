@@ -0,0 +1,109 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// DensityCell summarizes the Locations reported by vehicles on a route inside
+// one cell of a latitude and longitude grid. Row and Column locate the cell:
+// its south-west corner is at Row*Size degrees of latitude and Column*Size
+// degrees of longitude.
+type DensityCell struct {
+	Size      float64 `json:"size"`
+	Row       int64   `json:"row"`
+	Column    int64   `json:"column"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+
+	// Count is how many Locations were in the cell, and AverageSpeed is
+	// their average speed in miles per hour.
+	Count        int64   `json:"count"`
+	AverageSpeed float64 `json:"average_speed"`
+}
+
+// Demand counts signals that riders want to board at a Stop during an hour.
+// Signals that can't be tied to a Stop, like ETA subscriptions from clients
+// that show every stop at once, are counted with a StopID of zero.
+type Demand struct {
+	Hour   time.Time `json:"hour"`
+	StopID int64     `json:"stop_id"`
+
+	// BusButtonPresses counts bus button presses made near the Stop.
+	BusButtonPresses int64 `json:"bus_button_presses"`
+
+	// ETASubscriptions counts Fusion clients subscribing to ETAs.
+	ETASubscriptions int64 `json:"eta_subscriptions"`
+
+	// Alarms counts riders setting an alarm for a shuttle arriving at the Stop.
+	Alarms int64 `json:"alarms"`
+
+	// TimetableQueries counts requests for the Stop's timetable or next departures.
+	TimetableQueries int64 `json:"timetable_queries"`
+}
+
+// Mileage is how far a vehicle traveled on one day, in meters.
+type Mileage struct {
+	VehicleID int64     `json:"vehicle_id"`
+	Day       time.Time `json:"day"`
+	Distance  float64   `json:"distance"`
+}
+
+// LoopTime summarizes how long vehicles on a Route took to go all the way
+// around it, starting from its first Stop, when they started during one hour
+// of the day. Durations are in seconds.
+type LoopTime struct {
+	RouteID int64 `json:"route_id"`
+
+	// Hour is the hour of the day in the server's time zone, from 0 to 23.
+	Hour  int   `json:"hour"`
+	Loops int64 `json:"loops"`
+
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// AnalyticsService stores summaries of history that take too long to compute
+// from Locations on request.
+type AnalyticsService interface {
+	// SetDensity replaces the density grid for the hour starting at hour.
+	SetDensity(hour time.Time, cells []*DensityCell) error
+
+	// LastDensityHour returns the most recent hour that has a density
+	// grid, or the zero time if none do.
+	LastDensityHour() (time.Time, error)
+
+	// Density adds up the density grids for each hour from since
+	// (inclusive) until until (exclusive).
+	Density(since, until time.Time) ([]*DensityCell, error)
+
+	// RecordDemand adds to the totals for each Demand's hour and Stop.
+	RecordDemand(demand []*Demand) error
+
+	// Demand returns the totals for each hour from since (inclusive)
+	// until until (exclusive) and Stop, ordered by hour and then Stop.
+	Demand(since, until time.Time) ([]*Demand, error)
+
+	// SetMileage replaces every vehicle's Mileage for the day starting at day.
+	SetMileage(day time.Time, mileage []*Mileage) error
+
+	// LastMileageDay returns the most recent day that has Mileage, or the
+	// zero time if none do.
+	LastMileageDay() (time.Time, error)
+
+	// Mileage returns the Mileage for each day from since (inclusive)
+	// until until (exclusive), ordered by day and then vehicle.
+	Mileage(since, until time.Time) ([]*Mileage, error)
+
+	// TotalMileage returns the sum of each vehicle's Mileage over every
+	// day, by vehicle ID.
+	TotalMileage() (map[int64]float64, error)
+
+	// SetLoopTimes replaces every Route's LoopTimes.
+	SetLoopTimes(loopTimes []*LoopTime) error
+
+	// LoopTimes returns every Route's LoopTimes, ordered by Route and then
+	// hour.
+	LoopTimes() ([]*LoopTime, error)
+}
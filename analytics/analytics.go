@@ -0,0 +1,78 @@
+// Package analytics computes statistics from stored history for planners and
+// fleet management, like how much each vehicle was in service.
+package analytics
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Config configures the jobs that summarize history.
+type Config struct {
+	// DensityCellSize is the width and height of each cell in the density
+	// grid, in degrees. The default of 0.001 is about 110 meters north to
+	// south.
+	DensityCellSize float64
+
+	// SpeedLimit is the default speed limit in miles per hour used to find
+	// speeding. SpeedLimits overrides it for a route, keyed by the route's
+	// ID, or for the segment of a route that starts at a stop, keyed like
+	// "ROUTE-STOP".
+	SpeedLimit  float64
+	SpeedLimits map[string]float64
+
+	// HarshAcceleration is how quickly, in miles per hour per second, a
+	// vehicle can speed up or slow down before it's harsh driving.
+	HarshAcceleration float64
+}
+
+// NewConfig creates a new Config.
+func NewConfig(v *viper.Viper) *Config {
+	cfg := &Config{
+		DensityCellSize:   0.001,
+		SpeedLimit:        25,
+		SpeedLimits:       map[string]float64{},
+		HarshAcceleration: 7,
+	}
+	v.SetDefault("analytics.densitycellsize", cfg.DensityCellSize)
+	v.SetDefault("analytics.speedlimit", cfg.SpeedLimit)
+	v.SetDefault("analytics.speedlimits", cfg.SpeedLimits)
+	v.SetDefault("analytics.harshacceleration", cfg.HarshAcceleration)
+	return cfg
+}
+
+// maxReportGap is the longest time between a vehicle's Locations that is
+// still counted as continuous. Longer gaps usually mean that its tracker was
+// off, so nothing is known about what the vehicle did in between.
+const maxReportGap = 5 * time.Minute
+
+// day returns midnight at the start of t's day in the server's time zone.
+func day(t time.Time) time.Time {
+	t = t.In(time.Local)
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// eachInterval calls fn with each pair of consecutive Locations from the same
+// vehicle that are no more than maxReportGap apart, oldest first. Locations
+// from trackers that aren't assigned to a vehicle are ignored.
+func eachInterval(ls shuttletracker.LocationService, filter shuttletracker.HistoryFilter, fn func(prev, cur *shuttletracker.Location)) error {
+	last := map[int64]*shuttletracker.Location{}
+	return ls.ExportLocations(filter, func(cur *shuttletracker.Location) error {
+		if cur.VehicleID == nil {
+			return nil
+		}
+		prev := last[*cur.VehicleID]
+		last[*cur.VehicleID] = cur
+		if prev == nil {
+			return nil
+		}
+		if dt := cur.Time.Sub(prev.Time); dt > 0 && dt <= maxReportGap {
+			fn(prev, cur)
+		}
+		return nil
+	})
+}
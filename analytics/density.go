@@ -0,0 +1,148 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// densityCheckInterval is how often DensityAggregator looks for hours that
+// have ended and haven't been aggregated yet.
+const densityCheckInterval = 10 * time.Minute
+
+// maxDensityBackfill is how far back DensityAggregator goes the first time it
+// runs, or after it hasn't run for a while.
+const maxDensityBackfill = 7 * 24 * time.Hour
+
+// DensityGrid counts the Locations in filter's time range that were reported
+// while their vehicle was on a route, and averages their speeds, in each
+// cell of a grid with cells size degrees wide. Cells without any Locations
+// are omitted.
+func DensityGrid(ls shuttletracker.LocationService, filter shuttletracker.HistoryFilter, size float64) ([]*shuttletracker.DensityCell, error) {
+	type key struct {
+		row, column int64
+	}
+	speeds := map[key]float64{}
+	counts := map[key]int64{}
+	err := ls.ExportLocations(filter, func(l *shuttletracker.Location) error {
+		if l.RouteID == nil {
+			return nil
+		}
+		k := key{
+			row:    int64(math.Floor(l.Latitude / size)),
+			column: int64(math.Floor(l.Longitude / size)),
+		}
+		speeds[k] += l.Speed
+		counts[k]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make([]*shuttletracker.DensityCell, 0, len(counts))
+	for k, count := range counts {
+		cells = append(cells, &shuttletracker.DensityCell{
+			Size:         size,
+			Row:          k.row,
+			Column:       k.column,
+			Latitude:     float64(k.row) * size,
+			Longitude:    float64(k.column) * size,
+			Count:        count,
+			AverageSpeed: speeds[k] / float64(count),
+		})
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Row != cells[j].Row {
+			return cells[i].Row < cells[j].Row
+		}
+		return cells[i].Column < cells[j].Column
+	})
+	return cells, nil
+}
+
+// DensityAggregator saves a density grid for each hour once it has ended, so
+// that planners can find where vehicles are chronically slow without
+// scanning every Location.
+type DensityAggregator struct {
+	size   float64
+	ls     shuttletracker.LocationService
+	as     shuttletracker.AnalyticsService
+	leader shuttletracker.LeaderService
+
+	stop chan struct{}
+}
+
+// NewDensityAggregator creates a DensityAggregator. Only the leader
+// aggregates so that multiple instances don't do the same work.
+func NewDensityAggregator(cfg Config, ls shuttletracker.LocationService, as shuttletracker.AnalyticsService, leader shuttletracker.LeaderService) (*DensityAggregator, error) {
+	if cfg.DensityCellSize <= 0 {
+		return nil, errors.New("density cell size must be positive")
+	}
+	return &DensityAggregator{
+		size:   cfg.DensityCellSize,
+		ls:     ls,
+		as:     as,
+		leader: leader,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// Run aggregates hours that have ended until Stop is called.
+func (da *DensityAggregator) Run() {
+	ticker := time.NewTicker(densityCheckInterval)
+	defer ticker.Stop()
+	for {
+		da.aggregate(time.Now())
+		select {
+		case <-ticker.C:
+		case <-da.stop:
+			return
+		}
+	}
+}
+
+// Stop makes Run return after the hour it's currently aggregating.
+func (da *DensityAggregator) Stop() {
+	close(da.stop)
+}
+
+// aggregate saves a grid for each hour that ended before now, starting after
+// the last one saved.
+func (da *DensityAggregator) aggregate(now time.Time) {
+	if !da.leader.Leader() {
+		return
+	}
+	last, err := da.as.LastDensityHour()
+	if err != nil {
+		log.WithError(err).Error("unable to get last density hour")
+		return
+	}
+	hour := last.Add(time.Hour)
+	if earliest := now.Truncate(time.Hour).Add(-maxDensityBackfill); hour.Before(earliest) {
+		hour = earliest
+	}
+
+	for ; !hour.Add(time.Hour).After(now); hour = hour.Add(time.Hour) {
+		select {
+		case <-da.stop:
+			return
+		default:
+		}
+		filter := shuttletracker.HistoryFilter{Since: hour, Until: hour.Add(time.Hour)}
+		cells, err := DensityGrid(da.ls, filter, da.size)
+		if err != nil {
+			log.WithError(err).Error("unable to compute density grid")
+			return
+		}
+		if err := da.as.SetDensity(hour, cells); err != nil {
+			log.WithError(err).Error("unable to save density grid")
+			return
+		}
+		log.Debugf("Aggregated %d density cells for %s.", len(cells), hour)
+	}
+}
@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestDensityGrid(t *testing.T) {
+	routeID := int64(1)
+	start := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.Local)
+	locations := []*shuttletracker.Location{
+		{RouteID: &routeID, Latitude: 42.7305, Longitude: -73.6775, Speed: 10, Time: start},
+		{RouteID: &routeID, Latitude: 42.7309, Longitude: -73.6771, Speed: 20, Time: start},
+		{RouteID: &routeID, Latitude: 42.7315, Longitude: -73.6775, Speed: 30, Time: start},
+		// not in service, so not counted
+		{Latitude: 42.7305, Longitude: -73.6775, Speed: 0, Time: start},
+	}
+	filter := shuttletracker.HistoryFilter{Since: start, Until: start.Add(time.Hour)}
+	ms := &stmock.ModelService{}
+	ms.LocationService.On("ExportLocations", filter).Return(locations, nil)
+
+	cells, err := DensityGrid(ms, filter, 0.001)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(cells) != 2 {
+		t.Fatalf("got %d cells, expected 2", len(cells))
+	}
+	if cells[0].Row != 42730 || cells[0].Column != -73678 || cells[0].Count != 2 || cells[0].AverageSpeed != 15 {
+		t.Errorf("got first cell %+v", cells[0])
+	}
+	if cells[1].Row != 42731 || cells[1].Count != 1 || cells[1].AverageSpeed != 30 {
+		t.Errorf("got second cell %+v", cells[1])
+	}
+}
+
+func TestDensityAggregatorCatchesUp(t *testing.T) {
+	now := time.Date(2019, time.March, 1, 10, 30, 0, 0, time.UTC)
+	ms := &stmock.ModelService{}
+	ms.LocationService.On("ExportLocations", mock.Anything).Return([]*shuttletracker.Location{}, nil)
+	as := &stmock.AnalyticsService{}
+	as.On("LastDensityHour").Return(now.Add(-3*time.Hour).Truncate(time.Hour), nil)
+	as.On("SetDensity", mock.Anything, mock.Anything).Return(nil)
+	leader := &stmock.LeaderService{}
+	leader.On("Leader").Return(true)
+
+	da, err := NewDensityAggregator(Config{DensityCellSize: 0.001}, ms, as, leader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	da.aggregate(now)
+
+	// 7:00 was the last hour aggregated, and 10:00 hasn't ended yet.
+	as.AssertNumberOfCalls(t, "SetDensity", 2)
+	as.AssertCalled(t, "SetDensity", now.Add(-2*time.Hour).Truncate(time.Hour), []*shuttletracker.DensityCell{})
+	as.AssertCalled(t, "SetDensity", now.Add(-time.Hour).Truncate(time.Hour), []*shuttletracker.DensityCell{})
+}
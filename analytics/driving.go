@@ -0,0 +1,274 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Types of DrivingEvents.
+const (
+	DrivingSpeeding          = "speeding"
+	DrivingHarshAcceleration = "harsh_acceleration"
+	DrivingHarshBraking      = "harsh_braking"
+)
+
+// mphPerMeterPerSecond converts meters per second to miles per hour.
+const mphPerMeterPerSecond = 2.236936
+
+// DrivingEvent is a vehicle speeding or speeding up or slowing down harshly,
+// derived from its consecutive Locations rather than the speed its tracker
+// reports.
+type DrivingEvent struct {
+	Type      string `json:"type"`
+	VehicleID int64  `json:"vehicle_id"`
+	RouteID   *int64 `json:"route_id"`
+
+	// SegmentStopID is the stop at the start of the segment of the route
+	// where the event started, if the vehicle was on a route with stops.
+	SegmentStopID *int64 `json:"segment_stop_id"`
+
+	// Start and End are when the event started and ended. Harsh driving
+	// events last for one Location.
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+
+	// Value is the highest speed while speeding in miles per hour, or the
+	// acceleration in miles per hour per second, which is negative while
+	// braking. Limit is the threshold it exceeded.
+	Value float64 `json:"value"`
+	Limit float64 `json:"limit"`
+}
+
+var (
+	drivingLock   sync.RWMutex
+	drivingLimits = Config{SpeedLimit: 25, HarshAcceleration: 7}
+)
+
+// LoadDrivingLimits sets the speed limits and harsh acceleration threshold
+// used by DrivingEvents.
+func LoadDrivingLimits(cfg Config) {
+	drivingLock.Lock()
+	defer drivingLock.Unlock()
+	drivingLimits = cfg
+}
+
+// ParseSegmentKey parses a key of Config.SpeedLimits into a route ID and, if
+// it's for a segment, the ID of the stop that the segment starts at.
+func ParseSegmentKey(key string) (routeID int64, stopID *int64, err error) {
+	parts := strings.SplitN(key, "-", 2)
+	routeID, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%q is not a route ID or ROUTE-STOP", key)
+	}
+	if len(parts) == 1 {
+		return routeID, nil, nil
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%q is not a route ID or ROUTE-STOP", key)
+	}
+	return routeID, &id, nil
+}
+
+// drivingState is what's remembered about a vehicle's previous interval.
+type drivingState struct {
+	end      time.Time
+	midpoint time.Time
+	speed    float64
+	speeding *DrivingEvent
+}
+
+// DrivingEvents finds speeding and harsh driving in filter's time range,
+// ordered by when each event started.
+func DrivingEvents(ms shuttletracker.ModelService, filter shuttletracker.HistoryFilter) ([]*DrivingEvent, error) {
+	drivingLock.RLock()
+	cfg := drivingLimits
+	drivingLock.RUnlock()
+
+	segments, err := newRouteSegments(ms)
+	if err != nil {
+		return nil, err
+	}
+	limit := func(loc *shuttletracker.Location) (float64, *int64) {
+		if loc.RouteID == nil {
+			return cfg.SpeedLimit, nil
+		}
+		stopID := segments.segment(*loc.RouteID, loc)
+		if stopID != nil {
+			if l, ok := cfg.SpeedLimits[fmt.Sprintf("%d-%d", *loc.RouteID, *stopID)]; ok {
+				return l, stopID
+			}
+		}
+		if l, ok := cfg.SpeedLimits[strconv.FormatInt(*loc.RouteID, 10)]; ok {
+			return l, stopID
+		}
+		return cfg.SpeedLimit, stopID
+	}
+
+	events := []*DrivingEvent{}
+	states := map[int64]*drivingState{}
+	err = eachInterval(ms, filter, func(prev, cur *shuttletracker.Location) {
+		vehicleID := *prev.VehicleID
+		dt := cur.Time.Sub(prev.Time)
+		speed := shuttletracker.DistanceBetween(prev.Latitude, prev.Longitude, cur.Latitude, cur.Longitude) / dt.Seconds() * mphPerMeterPerSecond
+		midpoint := prev.Time.Add(dt / 2)
+
+		state := states[vehicleID]
+		continuous := state != nil && state.end.Equal(prev.Time)
+		if !continuous {
+			state = &drivingState{}
+			states[vehicleID] = state
+		}
+
+		speedLimit, stopID := limit(prev)
+		if speed > speedLimit {
+			if state.speeding != nil {
+				state.speeding.End = cur.Time
+				state.speeding.Value = math.Max(state.speeding.Value, speed)
+			} else {
+				state.speeding = newDrivingEvent(DrivingSpeeding, prev, stopID, speed, speedLimit)
+				state.speeding.End = cur.Time
+				events = append(events, state.speeding)
+			}
+		} else {
+			state.speeding = nil
+		}
+
+		if continuous && cfg.HarshAcceleration > 0 {
+			acceleration := (speed - state.speed) / midpoint.Sub(state.midpoint).Seconds()
+			if math.Abs(acceleration) >= cfg.HarshAcceleration {
+				t := DrivingHarshAcceleration
+				if acceleration < 0 {
+					t = DrivingHarshBraking
+				}
+				events = append(events, newDrivingEvent(t, prev, stopID, acceleration, cfg.HarshAcceleration))
+			}
+		}
+
+		state.end = cur.Time
+		state.midpoint = midpoint
+		state.speed = speed
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	return events, nil
+}
+
+func newDrivingEvent(t string, loc *shuttletracker.Location, stopID *int64, value, limit float64) *DrivingEvent {
+	return &DrivingEvent{
+		Type:          t,
+		VehicleID:     *loc.VehicleID,
+		RouteID:       loc.RouteID,
+		SegmentStopID: stopID,
+		Start:         loc.Time,
+		End:           loc.Time,
+		Latitude:      loc.Latitude,
+		Longitude:     loc.Longitude,
+		Value:         value,
+		Limit:         limit,
+	}
+}
+
+// routeSegments finds which segment of a route, between consecutive stops, a
+// Location is on.
+type routeSegments struct {
+	routes map[int64]*shuttletracker.Route
+
+	// stopPoints holds the index of the route point nearest to each of
+	// the route's stops, in the same order as its StopIDs.
+	stopPoints map[int64][]int
+}
+
+func newRouteSegments(ms shuttletracker.ModelService) (*routeSegments, error) {
+	routes, err := ms.Routes()
+	if err != nil {
+		return nil, err
+	}
+	stops, err := ms.Stops()
+	if err != nil {
+		return nil, err
+	}
+	stopsByID := map[int64]*shuttletracker.Stop{}
+	for _, stop := range stops {
+		stopsByID[stop.ID] = stop
+	}
+
+	rs := &routeSegments{
+		routes:     map[int64]*shuttletracker.Route{},
+		stopPoints: map[int64][]int{},
+	}
+	for _, route := range routes {
+		rs.routes[route.ID] = route
+		indices := make([]int, len(route.StopIDs))
+		for i, stopID := range route.StopIDs {
+			indices[i] = -1
+			if stop, ok := stopsByID[stopID]; ok {
+				indices[i] = nearestPoint(route.Points, stop.Latitude, stop.Longitude)
+			}
+		}
+		rs.stopPoints[route.ID] = indices
+	}
+	return rs, nil
+}
+
+// segment returns the ID of the stop at the start of the segment that loc is
+// on, or nil if the route is unknown or has no stops. A Location before the
+// first stop is on the segment that starts at the last stop, since routes
+// are loops.
+func (rs *routeSegments) segment(routeID int64, loc *shuttletracker.Location) *int64 {
+	route := rs.routes[routeID]
+	if route == nil || len(route.StopIDs) == 0 {
+		return nil
+	}
+	point := nearestPoint(route.Points, loc.Latitude, loc.Longitude)
+	best, bestPoint := -1, -1
+	last, lastPoint := -1, -1
+	for i, p := range rs.stopPoints[routeID] {
+		if p < 0 {
+			continue
+		}
+		if p <= point && p > bestPoint {
+			best, bestPoint = i, p
+		}
+		if p > lastPoint {
+			last, lastPoint = i, p
+		}
+	}
+	if best < 0 {
+		best = last
+	}
+	if best < 0 {
+		return nil
+	}
+	id := route.StopIDs[best]
+	return &id
+}
+
+// nearestPoint returns the index of the point closest to a position, or -1 if
+// there are no points. Points are close enough together that a flat
+// approximation is accurate.
+func nearestPoint(points []shuttletracker.Point, latitude, longitude float64) int {
+	nearest, min := -1, math.Inf(1)
+	scale := math.Cos(latitude * math.Pi / 180)
+	for i, p := range points {
+		dLat := p.Latitude - latitude
+		dLon := (p.Longitude - longitude) * scale
+		if d := dLat*dLat + dLon*dLon; d < min {
+			nearest, min = i, d
+		}
+	}
+	return nearest
+}
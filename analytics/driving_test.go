@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestDrivingEvents(t *testing.T) {
+	LoadDrivingLimits(Config{
+		SpeedLimit:        25,
+		SpeedLimits:       map[string]float64{"3-20": 10},
+		HarshAcceleration: 7,
+	})
+	defer LoadDrivingLimits(Config{SpeedLimit: 25, HarshAcceleration: 7})
+
+	start := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.Local)
+	busID := int64(1)
+	vanID := int64(2)
+	routeID := int64(3)
+	loc := func(vehicleID, routeID *int64, seconds int, latitude float64) *shuttletracker.Location {
+		return &shuttletracker.Location{
+			VehicleID: vehicleID,
+			RouteID:   routeID,
+			Time:      start.Add(time.Duration(seconds) * time.Second),
+			Latitude:  latitude,
+		}
+	}
+	// 0.001 degrees of latitude in 20 seconds is about 12.4 mph.
+	locations := []*shuttletracker.Location{
+		loc(&vanID, nil, 0, 42.7),
+		loc(&busID, &routeID, 0, 42.733),
+		loc(&vanID, nil, 2, 42.7002),
+		loc(&vanID, nil, 4, 42.7002),
+		loc(&busID, &routeID, 20, 42.734),
+		loc(&busID, &routeID, 40, 42.735),
+		loc(&busID, &routeID, 60, 42.736),
+		loc(&busID, &routeID, 80, 42.737),
+		loc(&busID, &routeID, 100, 42.737),
+	}
+	points := []shuttletracker.Point{}
+	for i := 0; i <= 10; i++ {
+		points = append(points, shuttletracker.Point{Latitude: 42.730 + float64(i)*0.001})
+	}
+	filter := shuttletracker.HistoryFilter{Since: start, Until: start.Add(time.Hour)}
+	ms := &mock.ModelService{}
+	ms.LocationService.On("ExportLocations", filter).Return(locations, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: routeID, StopIDs: []int64{10, 20}, Points: points}}, nil)
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{
+		{ID: 10, Latitude: 42.730},
+		{ID: 20, Latitude: 42.735},
+	}, nil)
+
+	events, err := DrivingEvents(ms, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, expected 2: %+v", len(events), events)
+	}
+
+	braking := events[0]
+	if braking.Type != DrivingHarshBraking || braking.VehicleID != vanID || !braking.Start.Equal(start.Add(2*time.Second)) {
+		t.Errorf("got %+v, expected the van braking harshly", braking)
+	}
+	if math.Abs(braking.Value+12.4) > 0.1 {
+		t.Errorf("got acceleration %g, expected about -12.4", braking.Value)
+	}
+
+	speeding := events[1]
+	if speeding.Type != DrivingSpeeding || speeding.VehicleID != busID || speeding.SegmentStopID == nil || *speeding.SegmentStopID != 20 {
+		t.Errorf("got %+v, expected the bus speeding after stop 20", speeding)
+	}
+	if !speeding.Start.Equal(start.Add(40*time.Second)) || !speeding.End.Equal(start.Add(80*time.Second)) {
+		t.Errorf("got speeding from %s to %s", speeding.Start, speeding.End)
+	}
+	if math.Abs(speeding.Value-12.4) > 0.1 || speeding.Limit != 10 {
+		t.Errorf("got speed %g and limit %g, expected about 12.4 and 10", speeding.Value, speeding.Limit)
+	}
+}
+
+func TestParseSegmentKey(t *testing.T) {
+	routeID, stopID, err := ParseSegmentKey("3-20")
+	if err != nil || routeID != 3 || stopID == nil || *stopID != 20 {
+		t.Errorf("got %d, %v, %v", routeID, stopID, err)
+	}
+	routeID, stopID, err = ParseSegmentKey("3")
+	if err != nil || routeID != 3 || stopID != nil {
+		t.Errorf("got %d, %v, %v", routeID, stopID, err)
+	}
+	if _, _, err = ParseSegmentKey("west"); err == nil {
+		t.Error("expected error for a route name")
+	}
+}
@@ -0,0 +1,169 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// maxPredictionHorizon is the longest time between a prediction and the
+// Arrival that it's compared to. If a vehicle doesn't arrive by then, it
+// probably left its route, and the prediction isn't counted.
+const maxPredictionHorizon = 2 * time.Hour
+
+// ETAGrouping chooses which ETA predictions are summarized together by
+// ETAAccuracy. If nothing is chosen, every prediction is in one group.
+type ETAGrouping struct {
+	Route     bool
+	Stop      bool
+	Hour      bool
+	Algorithm bool
+}
+
+// ETAErrors summarizes how far off a group of ETA predictions were. Errors are
+// in seconds, and they're positive when vehicles arrived later than predicted.
+// Only the fields chosen by the ETAGrouping identify the group.
+type ETAErrors struct {
+	RouteID   *int64  `json:"route_id,omitempty"`
+	StopID    *int64  `json:"stop_id,omitempty"`
+	Hour      *int    `json:"hour,omitempty"`
+	Algorithm *string `json:"algorithm,omitempty"`
+
+	Count             int     `json:"count"`
+	MeanError         float64 `json:"mean_error"`
+	MeanAbsoluteError float64 `json:"mean_absolute_error"`
+	P10               float64 `json:"p10"`
+	P50               float64 `json:"p50"`
+	P90               float64 `json:"p90"`
+
+	// WithinOneMinute is the fraction of predictions that were off by at
+	// most a minute.
+	WithinOneMinute float64 `json:"within_one_minute"`
+}
+
+// ETAAccuracy compares each ETA prediction made in filter's time range to the
+// vehicle's next Arrival at the stop and summarizes the errors by grouping.
+// The hour of day is when the prediction was made, in the server's time zone.
+func ETAAccuracy(ms shuttletracker.ModelService, filter shuttletracker.HistoryFilter, grouping ETAGrouping) ([]*ETAErrors, error) {
+	type vehicleStop struct {
+		vehicleID, stopID int64
+	}
+	arrivals := map[vehicleStop][]time.Time{}
+	arrivalFilter := filter
+	arrivalFilter.Until = filter.Until.Add(maxPredictionHorizon)
+	err := ms.ExportArrivals(arrivalFilter, func(a *shuttletracker.Arrival) error {
+		k := vehicleStop{a.VehicleID, a.StopID}
+		arrivals[k] = append(arrivals[k], a.Time)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, times := range arrivals {
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	}
+
+	type key struct {
+		routeID, stopID int64
+		hour            int
+		algorithm       string
+	}
+	errors := map[key][]float64{}
+	err = ms.ExportETARecords(filter, func(r *shuttletracker.ETARecord) error {
+		times := arrivals[vehicleStop{r.VehicleID, r.StopID}]
+		i := sort.Search(len(times), func(i int) bool { return !times[i].Before(r.Created) })
+		if i == len(times) || times[i].Sub(r.Created) > maxPredictionHorizon {
+			return nil
+		}
+		var k key
+		if grouping.Route {
+			k.routeID = r.RouteID
+		}
+		if grouping.Stop {
+			k.stopID = r.StopID
+		}
+		if grouping.Hour {
+			k.hour = r.Created.In(time.Local).Hour()
+		}
+		if grouping.Algorithm {
+			k.algorithm = r.Algorithm
+		}
+		errors[k] = append(errors[k], times[i].Sub(r.ETA).Seconds())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]key, 0, len(errors))
+	for k := range errors {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch {
+		case a.algorithm != b.algorithm:
+			return a.algorithm < b.algorithm
+		case a.routeID != b.routeID:
+			return a.routeID < b.routeID
+		case a.stopID != b.stopID:
+			return a.stopID < b.stopID
+		default:
+			return a.hour < b.hour
+		}
+	})
+	summaries := make([]*ETAErrors, 0, len(keys))
+	for _, k := range keys {
+		k := k
+		s := summarizeErrors(errors[k])
+		if grouping.Route {
+			s.RouteID = &k.routeID
+		}
+		if grouping.Stop {
+			s.StopID = &k.stopID
+		}
+		if grouping.Hour {
+			s.Hour = &k.hour
+		}
+		if grouping.Algorithm {
+			s.Algorithm = &k.algorithm
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+// summarizeErrors summarizes a non-empty list of errors in seconds.
+func summarizeErrors(errors []float64) *ETAErrors {
+	sort.Float64s(errors)
+	s := &ETAErrors{
+		Count: len(errors),
+		P10:   percentile(errors, 10),
+		P50:   percentile(errors, 50),
+		P90:   percentile(errors, 90),
+	}
+	within := 0
+	for _, e := range errors {
+		s.MeanError += e
+		s.MeanAbsoluteError += math.Abs(e)
+		if math.Abs(e) <= 60 {
+			within++
+		}
+	}
+	n := float64(len(errors))
+	s.MeanError /= n
+	s.MeanAbsoluteError /= n
+	s.WithinOneMinute = float64(within) / n
+	return s
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,52 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestETAAccuracy(t *testing.T) {
+	start := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.Local)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	filter := shuttletracker.HistoryFilter{Since: start, Until: start.Add(time.Hour)}
+	arrivalFilter := filter
+	arrivalFilter.Until = filter.Until.Add(maxPredictionHorizon)
+
+	ms := &mock.ModelService{}
+	ms.ArrivalService.On("ExportArrivals", arrivalFilter).Return([]*shuttletracker.Arrival{
+		{VehicleID: 1, RouteID: 2, StopID: 3, Time: at(10)},
+		{VehicleID: 1, RouteID: 2, StopID: 3, Time: at(40)},
+	}, nil)
+	ms.ETARecordService.On("ExportETARecords", filter).Return([]*shuttletracker.ETARecord{
+		// compared to the arrival at 10 minutes
+		{VehicleID: 1, RouteID: 2, StopID: 3, ETA: at(9), Algorithm: "old", Created: at(0)},
+		{VehicleID: 1, RouteID: 2, StopID: 3, ETA: at(10), Algorithm: "new", Created: at(5)},
+		// compared to the arrival at 40 minutes
+		{VehicleID: 1, RouteID: 2, StopID: 3, ETA: at(43), Algorithm: "old", Created: at(20)},
+		// never arrived
+		{VehicleID: 1, RouteID: 2, StopID: 4, ETA: at(30), Algorithm: "new", Created: at(20)},
+	}, nil)
+
+	summaries, err := ETAAccuracy(ms, filter, ETAGrouping{Algorithm: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("got %d groups, expected 2", len(summaries))
+	}
+	n, o := summaries[0], summaries[1]
+	if *n.Algorithm != "new" || n.Count != 1 || n.MeanAbsoluteError != 0 || n.WithinOneMinute != 1 {
+		t.Errorf("got new algorithm %+v", n)
+	}
+	if *o.Algorithm != "old" || o.Count != 2 || o.MeanError != -60 || o.MeanAbsoluteError != 120 || o.P10 != -180 || o.P90 != 60 {
+		t.Errorf("got old algorithm %+v", o)
+	}
+	if n.RouteID != nil || n.StopID != nil || n.Hour != nil {
+		t.Errorf("got fields that weren't grouped by: %+v", n)
+	}
+}
@@ -0,0 +1,206 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ServiceGap is a time that no vehicle on a route arrived at one of its stops.
+type ServiceGap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Duration is in seconds.
+	Duration float64 `json:"duration"`
+}
+
+// StopCoverage describes how often vehicles on a route arrived at one of its
+// stops while the route was scheduled to run. Durations are in seconds.
+type StopCoverage struct {
+	RouteID  int64 `json:"route_id"`
+	StopID   int64 `json:"stop_id"`
+	Arrivals int   `json:"arrivals"`
+
+	// MeanHeadway is the average time between consecutive arrivals, or zero
+	// if there were fewer than two. MaxGap is the longest time without an
+	// arrival, including before the first and after the last.
+	MeanHeadway float64 `json:"mean_headway"`
+	MaxGap      float64 `json:"max_gap"`
+
+	// Gaps are the times without an arrival that were at least as long as
+	// the minimum passed to ServiceGaps.
+	Gaps []*ServiceGap `json:"gaps"`
+}
+
+// ServiceGaps finds how long each stop on each enabled route went without a
+// vehicle on that route arriving in filter's time range. Only time when the
+// route was scheduled to run is counted, so the night between the last
+// arrival of one day and the first of the next isn't a gap. Routes without a
+// schedule always run, except on days that the service calendar says they
+// don't. Arrivals from any vehicle count, so filter's vehicle is ignored.
+func ServiceGaps(ms shuttletracker.ModelService, filter shuttletracker.HistoryFilter, minGap time.Duration) ([]*StopCoverage, error) {
+	routes, err := ms.Routes()
+	if err != nil {
+		return nil, err
+	}
+	periods, err := ms.ServicePeriods()
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := ms.Schedules()
+	if err != nil {
+		return nil, err
+	}
+	calendar := shuttletracker.Calendar(periods)
+
+	type routeStop struct {
+		routeID, stopID int64
+	}
+	arrivals := map[routeStop][]time.Time{}
+	filter.VehicleID = nil
+	err = ms.ExportArrivals(filter, func(a *shuttletracker.Arrival) error {
+		k := routeStop{a.RouteID, a.StopID}
+		arrivals[k] = append(arrivals[k], a.Time)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	coverage := []*StopCoverage{}
+	for _, route := range routes {
+		if !route.Enabled || (filter.RouteID != nil && *filter.RouteID != route.ID) {
+			continue
+		}
+		intervals := [][2]time.Time{}
+		for _, interval := range scheduledIntervals(route.Schedule, filter.Since, filter.Until) {
+			// service that runs past midnight belongs to the day it started
+			if calendar.RouteRuns(route.ID, schedules, interval[0].In(time.Local)) {
+				intervals = append(intervals, interval)
+			}
+		}
+		intervals = mergeIntervals(intervals)
+		seen := map[int64]bool{}
+		for _, stopID := range route.StopIDs {
+			// loops can visit a stop more than once
+			if seen[stopID] {
+				continue
+			}
+			seen[stopID] = true
+			c := stopCoverage(intervals, arrivals[routeStop{route.ID, stopID}], minGap)
+			c.RouteID = route.ID
+			c.StopID = stopID
+			coverage = append(coverage, c)
+		}
+	}
+	return coverage, nil
+}
+
+// stopCoverage summarizes arrivals, which are oldest first, during intervals.
+func stopCoverage(intervals [][2]time.Time, arrivals []time.Time, minGap time.Duration) *StopCoverage {
+	c := &StopCoverage{Gaps: []*ServiceGap{}}
+	var headways time.Duration
+	headwayCount := 0
+	gap := func(start, end time.Time) {
+		d := end.Sub(start)
+		if d.Seconds() > c.MaxGap {
+			c.MaxGap = d.Seconds()
+		}
+		if d > 0 && d >= minGap {
+			c.Gaps = append(c.Gaps, &ServiceGap{Start: start, End: end, Duration: d.Seconds()})
+		}
+	}
+	for _, interval := range intervals {
+		last := interval[0]
+		first := true
+		for _, t := range arrivals {
+			if t.Before(interval[0]) || t.After(interval[1]) {
+				continue
+			}
+			gap(last, t)
+			if !first {
+				headways += t.Sub(last)
+				headwayCount++
+			}
+			first = false
+			last = t
+			c.Arrivals++
+		}
+		gap(last, interval[1])
+	}
+	if headwayCount > 0 {
+		c.MeanHeadway = headways.Seconds() / float64(headwayCount)
+	}
+	return c
+}
+
+// scheduledIntervals returns the times between since and until that a route
+// with schedule is scheduled to run, in order. A route without a schedule
+// always runs, but its time is split into days so that each day can be
+// checked against the service calendar. Like route_is_active in Postgres, each interval's days and
+// times are in the week containing each day, and intervals don't wrap
+// around the end of the week.
+func scheduledIntervals(schedule shuttletracker.RouteSchedule, since, until time.Time) [][2]time.Time {
+	if !since.Before(until) {
+		return nil
+	}
+	if len(schedule) == 0 {
+		intervals := [][2]time.Time{}
+		for d := day(since); d.Before(until); d = d.AddDate(0, 0, 1) {
+			s, e := d, d.AddDate(0, 0, 1)
+			if s.Before(since) {
+				s = since
+			}
+			if e.After(until) {
+				e = until
+			}
+			intervals = append(intervals, [2]time.Time{s, e})
+		}
+		return intervals
+	}
+
+	at := func(week time.Time, weekday time.Weekday, clock time.Time) time.Time {
+		h, m, s := clock.Clock()
+		d := week.AddDate(0, 0, int(weekday))
+		return time.Date(d.Year(), d.Month(), d.Day(), h, m, s, 0, time.Local)
+	}
+	intervals := [][2]time.Time{}
+	start := day(since)
+	for week := start.AddDate(0, 0, -int(start.Weekday())); week.Before(until); week = week.AddDate(0, 0, 7) {
+		for _, interval := range schedule {
+			s := at(week, interval.StartDay, interval.StartTime)
+			e := at(week, interval.EndDay, interval.EndTime)
+			if s.Before(since) {
+				s = since
+			}
+			if e.After(until) {
+				e = until
+			}
+			if s.Before(e) {
+				intervals = append(intervals, [2]time.Time{s, e})
+			}
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i][0].Before(intervals[j][0])
+	})
+	return mergeIntervals(intervals)
+}
+
+// mergeIntervals combines sorted intervals that overlap or touch, so that a
+// gap isn't counted twice or split in two.
+func mergeIntervals(intervals [][2]time.Time) [][2]time.Time {
+	merged := intervals[:0]
+	for _, interval := range intervals {
+		if n := len(merged); n > 0 && !interval[0].After(merged[n-1][1]) {
+			if interval[1].After(merged[n-1][1]) {
+				merged[n-1][1] = interval[1]
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
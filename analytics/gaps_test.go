@@ -0,0 +1,100 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestServiceGaps(t *testing.T) {
+	// March 1, 2019 was a Friday.
+	at := func(hour, minute int) time.Time {
+		return time.Date(2019, time.March, 1, hour, minute, 0, 0, time.Local)
+	}
+	schedule := shuttletracker.RouteSchedule{{
+		StartDay:  time.Friday,
+		StartTime: time.Date(0, 1, 1, 8, 0, 0, 0, time.Local),
+		EndDay:    time.Friday,
+		EndTime:   time.Date(0, 1, 1, 10, 0, 0, 0, time.Local),
+	}}
+	vehicleID := int64(5)
+	filter := shuttletracker.HistoryFilter{Since: at(7, 0), Until: at(11, 0), VehicleID: &vehicleID}
+	arrivalFilter := filter
+	arrivalFilter.VehicleID = nil
+
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+		{ID: 1, Enabled: true, StopIDs: []int64{10, 20, 10}, Schedule: schedule},
+		{ID: 2, StopIDs: []int64{10}},
+	}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{
+		{Type: shuttletracker.ServicePeriodHoliday, Start: "2019-03-02", End: "2019-03-02"},
+	}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{}, nil)
+	ms.ArrivalService.On("ExportArrivals", arrivalFilter).Return([]*shuttletracker.Arrival{
+		{RouteID: 1, StopID: 10, Time: at(8, 5)},
+		{RouteID: 1, StopID: 10, Time: at(8, 15)},
+		{RouteID: 1, StopID: 10, Time: at(9, 30)},
+		// after service ended
+		{RouteID: 1, StopID: 10, Time: at(10, 30)},
+	}, nil)
+
+	coverage, err := ServiceGaps(ms, filter, 30*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(coverage) != 2 {
+		t.Fatalf("got %d stops, expected 2", len(coverage))
+	}
+
+	c := coverage[0]
+	if c.StopID != 10 || c.Arrivals != 3 || c.MeanHeadway != 42.5*60 || c.MaxGap != 75*60 {
+		t.Errorf("got %+v for stop 10", c)
+	}
+	if len(c.Gaps) != 2 || !c.Gaps[0].Start.Equal(at(8, 15)) || !c.Gaps[1].End.Equal(at(10, 0)) {
+		t.Errorf("got gaps %+v for stop 10", c.Gaps)
+	}
+
+	c = coverage[1]
+	if c.StopID != 20 || c.Arrivals != 0 || c.MeanHeadway != 0 || c.MaxGap != 2*60*60 || len(c.Gaps) != 1 {
+		t.Errorf("got %+v for stop 20", c)
+	}
+}
+
+func TestScheduledIntervalsWithoutSchedule(t *testing.T) {
+	since := time.Date(2019, time.March, 1, 0, 0, 0, 0, time.Local)
+	until := since.Add(time.Hour)
+	intervals := scheduledIntervals(nil, since, until)
+	if len(intervals) != 1 || !intervals[0][0].Equal(since) || !intervals[0][1].Equal(until) {
+		t.Errorf("got %v, expected the whole time range", intervals)
+	}
+}
+
+func TestServiceGapsCalendar(t *testing.T) {
+	since := time.Date(2019, time.March, 1, 7, 0, 0, 0, time.Local)
+	filter := shuttletracker.HistoryFilter{Since: since, Until: since.Add(24 * time.Hour)}
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+		{ID: 1, Enabled: true, StopIDs: []int64{10}},
+		{ID: 2, Enabled: true, StopIDs: []int64{10}},
+	}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{
+		{Type: shuttletracker.ServicePeriodHoliday, Start: "2019-03-02", End: "2019-03-02"},
+		{Type: shuttletracker.ServicePeriodReduced, Start: "2019-03-01", End: "2019-03-01", ScheduleIDs: []int64{3}},
+	}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{
+		{ID: 3, RouteID: 2, Days: []time.Weekday{time.Friday}},
+	}, nil)
+	ms.ArrivalService.On("ExportArrivals", filter).Return([]*shuttletracker.Arrival{}, nil)
+
+	coverage, err := ServiceGaps(ms, filter, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Route 1 doesn't run during reduced service, and neither runs on the holiday.
+	if len(coverage) != 2 || coverage[0].MaxGap != 0 || coverage[1].MaxGap != 17*60*60 {
+		t.Errorf("got %+v and %+v", coverage[0], coverage[1])
+	}
+}
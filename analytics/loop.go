@@ -0,0 +1,187 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// loopTimeInterval is how often LoopTimeCalculator recalculates loop times.
+const loopTimeInterval = 6 * time.Hour
+
+// loopTimeWindow is how much history LoopTimeCalculator uses. Four weeks
+// covers every day of the week several times without going back so far that
+// construction or schedule changes have ended.
+const loopTimeWindow = 28 * 24 * time.Hour
+
+// maxLoopTime is the longest that a vehicle can take to go around a route.
+// Anything longer means that it left the route, e.g. for a break or to
+// refuel, before coming back to the first stop.
+const maxLoopTime = 3 * time.Hour
+
+// loop is a vehicle's trip around a route that's in progress.
+type loop struct {
+	routeID int64
+	start   time.Time
+	visited map[int64]bool
+}
+
+// LoopTimes finds how long vehicles took to go all the way around each route
+// in filter's time range, grouped by route and the hour of the day that each
+// loop started. A loop starts when a vehicle on a route arrives at the route's
+// first stop and ends when it next arrives there while still on the route. It
+// only counts if the vehicle arrived at at least half of the route's other
+// stops in between and took no more than three hours, so that vehicles
+// turning around early or leaving the route aren't counted.
+func LoopTimes(ms shuttletracker.ModelService, filter shuttletracker.HistoryFilter) ([]*shuttletracker.LoopTime, error) {
+	routes, err := ms.Routes()
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int64]*shuttletracker.Route{}
+	for _, route := range routes {
+		if len(route.StopIDs) > 0 && (filter.RouteID == nil || *filter.RouteID == route.ID) {
+			byID[route.ID] = route
+		}
+	}
+
+	type routeHour struct {
+		routeID int64
+		hour    int
+	}
+	durations := map[routeHour][]float64{}
+	loops := map[int64]*loop{}
+	err = ms.ExportArrivals(filter, func(a *shuttletracker.Arrival) error {
+		route, ok := byID[a.RouteID]
+		l := loops[a.VehicleID]
+		if l != nil && (l.routeID != a.RouteID || a.Time.Sub(l.start) > maxLoopTime) {
+			l = nil
+			delete(loops, a.VehicleID)
+		}
+		if !ok {
+			return nil
+		}
+		if a.StopID != route.StopIDs[0] {
+			if l != nil {
+				l.visited[a.StopID] = true
+			}
+			return nil
+		}
+		if l != nil && len(l.visited) >= requiredStops(route) {
+			k := routeHour{route.ID, l.start.In(time.Local).Hour()}
+			durations[k] = append(durations[k], a.Time.Sub(l.start).Seconds())
+		}
+		loops[a.VehicleID] = &loop{routeID: route.ID, start: a.Time, visited: map[int64]bool{}}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loopTimes := make([]*shuttletracker.LoopTime, 0, len(durations))
+	for k, ds := range durations {
+		sort.Float64s(ds)
+		lt := &shuttletracker.LoopTime{
+			RouteID: k.routeID,
+			Hour:    k.hour,
+			Loops:   int64(len(ds)),
+			Median:  median(ds),
+			Min:     ds[0],
+			Max:     ds[len(ds)-1],
+		}
+		for _, d := range ds {
+			lt.Mean += d
+		}
+		lt.Mean /= float64(len(ds))
+		loopTimes = append(loopTimes, lt)
+	}
+	sort.Slice(loopTimes, func(i, j int) bool {
+		if loopTimes[i].RouteID != loopTimes[j].RouteID {
+			return loopTimes[i].RouteID < loopTimes[j].RouteID
+		}
+		return loopTimes[i].Hour < loopTimes[j].Hour
+	})
+	return loopTimes, nil
+}
+
+// requiredStops returns how many of a route's stops other than its first a
+// vehicle must arrive at for its loop to count.
+func requiredStops(route *shuttletracker.Route) int {
+	others := map[int64]bool{}
+	for _, stopID := range route.StopIDs {
+		if stopID != route.StopIDs[0] {
+			others[stopID] = true
+		}
+	}
+	return (len(others) + 1) / 2
+}
+
+// median returns the middle of sorted values, which must not be empty.
+func median(sorted []float64) float64 {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// LoopTimeCalculator periodically saves how long vehicles have recently taken
+// to go around each route, which is too slow to find from every Arrival on
+// request.
+type LoopTimeCalculator struct {
+	ms     shuttletracker.ModelService
+	as     shuttletracker.AnalyticsService
+	leader shuttletracker.LeaderService
+
+	stop chan struct{}
+}
+
+// NewLoopTimeCalculator creates a LoopTimeCalculator. Only the leader
+// calculates so that multiple instances don't do the same work.
+func NewLoopTimeCalculator(ms shuttletracker.ModelService, as shuttletracker.AnalyticsService, leader shuttletracker.LeaderService) *LoopTimeCalculator {
+	return &LoopTimeCalculator{
+		ms:     ms,
+		as:     as,
+		leader: leader,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Run calculates loop times until Stop is called.
+func (lc *LoopTimeCalculator) Run() {
+	ticker := time.NewTicker(loopTimeInterval)
+	defer ticker.Stop()
+	for {
+		lc.calculate(time.Now())
+		select {
+		case <-ticker.C:
+		case <-lc.stop:
+			return
+		}
+	}
+}
+
+// Stop makes Run return after it finishes calculating.
+func (lc *LoopTimeCalculator) Stop() {
+	close(lc.stop)
+}
+
+// calculate saves loop times from the loopTimeWindow before now.
+func (lc *LoopTimeCalculator) calculate(now time.Time) {
+	if !lc.leader.Leader() {
+		return
+	}
+	filter := shuttletracker.HistoryFilter{Since: now.Add(-loopTimeWindow), Until: now}
+	loopTimes, err := LoopTimes(lc.ms, filter)
+	if err != nil {
+		log.WithError(err).Error("unable to calculate loop times")
+		return
+	}
+	if err := lc.as.SetLoopTimes(loopTimes); err != nil {
+		log.WithError(err).Error("unable to save loop times")
+		return
+	}
+	log.Debugf("Saved %d loop times.", len(loopTimes))
+}
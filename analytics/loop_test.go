@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestLoopTimes(t *testing.T) {
+	start := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.Local)
+	arrival := func(vehicleID, routeID, stopID int64, minutes int) *shuttletracker.Arrival {
+		return &shuttletracker.Arrival{
+			VehicleID: vehicleID,
+			RouteID:   routeID,
+			StopID:    stopID,
+			Time:      start.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+	arrivals := []*shuttletracker.Arrival{
+		// a 20 minute loop
+		arrival(1, 1, 10, 0),
+		arrival(1, 1, 11, 5),
+		arrival(2, 1, 10, 5),
+		arrival(1, 1, 12, 10),
+		arrival(1, 1, 10, 20),
+		// a 30 minute loop, starting right where the last one ended
+		arrival(2, 1, 11, 20),
+		arrival(1, 1, 11, 25),
+		// the other vehicle turned around after one stop, so it isn't a loop
+		arrival(2, 1, 10, 30),
+		arrival(1, 1, 13, 40),
+		arrival(1, 1, 10, 50),
+		// switched routes partway around
+		arrival(1, 2, 12, 55),
+		arrival(1, 1, 10, 60),
+		// a 25 minute loop in the next hour
+		arrival(1, 1, 11, 70),
+		arrival(1, 1, 12, 80),
+		arrival(1, 1, 10, 85),
+		// on a route without stops
+		arrival(3, 3, 10, 0),
+		arrival(3, 3, 10, 30),
+	}
+	filter := shuttletracker.HistoryFilter{Since: start, Until: start.Add(2 * time.Hour)}
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+		{ID: 1, StopIDs: []int64{10, 11, 12, 13, 10}},
+		{ID: 2, StopIDs: []int64{12}},
+		{ID: 3},
+	}, nil)
+	ms.ArrivalService.On("ExportArrivals", filter).Return(arrivals, nil)
+
+	loopTimes, err := LoopTimes(ms, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(loopTimes) != 2 {
+		t.Fatalf("got %d loop times, expected 2: %+v", len(loopTimes), loopTimes)
+	}
+	expected := []shuttletracker.LoopTime{
+		{RouteID: 1, Hour: 8, Loops: 2, Mean: 25 * 60, Median: 25 * 60, Min: 20 * 60, Max: 30 * 60},
+		{RouteID: 1, Hour: 9, Loops: 1, Mean: 25 * 60, Median: 25 * 60, Min: 25 * 60, Max: 25 * 60},
+	}
+	for i, lt := range loopTimes {
+		if *lt != expected[i] {
+			t.Errorf("got %+v, expected %+v", *lt, expected[i])
+		}
+	}
+}
+
+func TestRequiredStops(t *testing.T) {
+	for _, c := range []struct {
+		stopIDs  []int64
+		required int
+	}{
+		{[]int64{1}, 0},
+		{[]int64{1, 2}, 1},
+		{[]int64{1, 2, 3, 1}, 1},
+		{[]int64{1, 2, 3, 4, 2}, 2},
+	} {
+		if required := requiredStops(&shuttletracker.Route{StopIDs: c.stopIDs}); required != c.required {
+			t.Errorf("%v: got %d, expected %d", c.stopIDs, required, c.required)
+		}
+	}
+}
+
+func TestLoopTimeCalculatorOnlyLeader(t *testing.T) {
+	now := time.Date(2019, time.March, 4, 10, 30, 0, 0, time.Local)
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{}, nil)
+	ms.ArrivalService.On("ExportArrivals", mock.Anything).Return([]*shuttletracker.Arrival{}, nil)
+	as := &stmock.AnalyticsService{}
+	as.On("SetLoopTimes", []*shuttletracker.LoopTime{}).Return(nil)
+	leader := &stmock.LeaderService{}
+	leader.On("Leader").Return(false).Once()
+	leader.On("Leader").Return(true)
+
+	lc := NewLoopTimeCalculator(ms, as, leader)
+	lc.calculate(now)
+	as.AssertNotCalled(t, "SetLoopTimes", mock.Anything)
+
+	lc.calculate(now)
+	as.AssertNumberOfCalls(t, "SetLoopTimes", 1)
+	ms.ArrivalService.AssertCalled(t, "ExportArrivals", shuttletracker.HistoryFilter{Since: now.Add(-loopTimeWindow), Until: now})
+}
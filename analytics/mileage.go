@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// mileageCheckInterval is how often MileageCalculator looks for days that
+// have ended and haven't been added up yet.
+const mileageCheckInterval = time.Hour
+
+// maxMileageBackfill is how far back MileageCalculator goes the first time it
+// runs. Older Locations have already been deleted.
+const maxMileageBackfill = 31 * 24 * time.Hour
+
+// maxPlausibleSpeed is the fastest a vehicle can go between two Locations,
+// in meters per second (about 90 mph). Anything faster is a GPS error, and
+// the distance isn't counted.
+const maxPlausibleSpeed = 40.0
+
+// VehicleMileage adds up how far each vehicle traveled on each day that it
+// reported in filter's time range, sorted by day and then vehicle. Like
+// VehicleUtilization, it skips gaps while a tracker was off. It also skips
+// moves too small to be anything but GPS noise while a vehicle is idle, and
+// moves too fast to be real.
+func VehicleMileage(ls shuttletracker.LocationService, filter shuttletracker.HistoryFilter) ([]*shuttletracker.Mileage, error) {
+	type key struct {
+		vehicleID int64
+		day       time.Time
+	}
+	days := map[key]*shuttletracker.Mileage{}
+
+	err := eachInterval(ls, filter, func(prev, cur *shuttletracker.Location) {
+		d := shuttletracker.DistanceBetween(prev.Latitude, prev.Longitude, cur.Latitude, cur.Longitude)
+		if d < movingDistance || d/cur.Time.Sub(prev.Time).Seconds() > maxPlausibleSpeed {
+			return
+		}
+		k := key{*prev.VehicleID, day(prev.Time)}
+		m, ok := days[k]
+		if !ok {
+			m = &shuttletracker.Mileage{VehicleID: k.vehicleID, Day: k.day}
+			days[k] = m
+		}
+		m.Distance += d
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mileage := make([]*shuttletracker.Mileage, 0, len(days))
+	for _, m := range days {
+		mileage = append(mileage, m)
+	}
+	sort.Slice(mileage, func(i, j int) bool {
+		if !mileage[i].Day.Equal(mileage[j].Day) {
+			return mileage[i].Day.Before(mileage[j].Day)
+		}
+		return mileage[i].VehicleID < mileage[j].VehicleID
+	})
+	return mileage, nil
+}
+
+// MileageToday adds up how far each vehicle has traveled so far today, which
+// MileageCalculator hasn't saved yet.
+func MileageToday(ls shuttletracker.LocationService, now time.Time) ([]*shuttletracker.Mileage, error) {
+	return VehicleMileage(ls, shuttletracker.HistoryFilter{Since: day(now), Until: now})
+}
+
+// MileageCalculator saves how far each vehicle traveled each day once the day
+// has ended. Locations are only kept for a month, so the saved days are how
+// lifetime mileage is kept for maintenance scheduling.
+type MileageCalculator struct {
+	ls     shuttletracker.LocationService
+	as     shuttletracker.AnalyticsService
+	leader shuttletracker.LeaderService
+
+	stop chan struct{}
+}
+
+// NewMileageCalculator creates a MileageCalculator. Only the leader
+// calculates so that multiple instances don't do the same work.
+func NewMileageCalculator(ls shuttletracker.LocationService, as shuttletracker.AnalyticsService, leader shuttletracker.LeaderService) *MileageCalculator {
+	return &MileageCalculator{
+		ls:     ls,
+		as:     as,
+		leader: leader,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Run calculates days that have ended until Stop is called.
+func (mc *MileageCalculator) Run() {
+	ticker := time.NewTicker(mileageCheckInterval)
+	defer ticker.Stop()
+	for {
+		mc.calculate(time.Now())
+		select {
+		case <-ticker.C:
+		case <-mc.stop:
+			return
+		}
+	}
+}
+
+// Stop makes Run return after the day it's currently calculating.
+func (mc *MileageCalculator) Stop() {
+	close(mc.stop)
+}
+
+// calculate saves the mileage for each day that ended before now, starting
+// after the last one saved.
+func (mc *MileageCalculator) calculate(now time.Time) {
+	if !mc.leader.Leader() {
+		return
+	}
+	last, err := mc.as.LastMileageDay()
+	if err != nil {
+		log.WithError(err).Error("unable to get last mileage day")
+		return
+	}
+	start := day(now.Add(-maxMileageBackfill))
+	if !last.IsZero() {
+		start = nextDay(last)
+	}
+
+	for d := start; !nextDay(d).After(now); d = nextDay(d) {
+		select {
+		case <-mc.stop:
+			return
+		default:
+		}
+		filter := shuttletracker.HistoryFilter{Since: d, Until: nextDay(d)}
+		mileage, err := VehicleMileage(mc.ls, filter)
+		if err != nil {
+			log.WithError(err).Error("unable to calculate mileage")
+			return
+		}
+		if err := mc.as.SetMileage(d, mileage); err != nil {
+			log.WithError(err).Error("unable to save mileage")
+			return
+		}
+		log.Debugf("Saved mileage for %d vehicles on %s.", len(mileage), d.Format("2006-01-02"))
+	}
+}
+
+// nextDay returns midnight at the start of the day after d, which may not be
+// 24 hours later when daylight saving time starts or ends.
+func nextDay(d time.Time) time.Time {
+	return day(d.AddDate(0, 0, 1))
+}
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestVehicleMileage(t *testing.T) {
+	start := time.Date(2019, time.March, 1, 23, 58, 0, 0, time.Local)
+	vehicleID := int64(1)
+	otherID := int64(2)
+	loc := func(vehicleID int64, minutes int, latitude float64) *shuttletracker.Location {
+		return &shuttletracker.Location{
+			VehicleID: &vehicleID,
+			Time:      start.Add(time.Duration(minutes) * time.Minute),
+			Latitude:  latitude,
+		}
+	}
+	// 0.001 degrees of latitude is about 111 meters.
+	locations := []*shuttletracker.Location{
+		loc(vehicleID, 0, 42.730),
+		loc(otherID, 0, 42.730),
+		loc(vehicleID, 1, 42.731),
+		// GPS noise while idle
+		loc(otherID, 1, 42.73001),
+		// a GPS error 11 km away, and back
+		loc(vehicleID, 2, 42.831),
+		loc(vehicleID, 3, 42.731),
+		// after midnight
+		loc(vehicleID, 4, 42.732),
+		// the tracker was off, so this isn't counted
+		loc(vehicleID, 30, 42.740),
+	}
+	filter := shuttletracker.HistoryFilter{Since: start, Until: start.Add(time.Hour)}
+	ms := &stmock.ModelService{}
+	ms.LocationService.On("ExportLocations", filter).Return(locations, nil)
+
+	mileage, err := VehicleMileage(ms, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(mileage) != 2 {
+		t.Fatalf("got %d days, expected 2: %+v", len(mileage), mileage)
+	}
+	if mileage[0].VehicleID != vehicleID || !mileage[0].Day.Equal(day(start)) || math.Abs(mileage[0].Distance-111) > 1 {
+		t.Errorf("got %+v, expected about 111 meters on the first day", mileage[0])
+	}
+	if !mileage[1].Day.Equal(day(start.Add(time.Hour))) || math.Abs(mileage[1].Distance-111) > 1 {
+		t.Errorf("got %+v, expected about 111 meters on the second day", mileage[1])
+	}
+}
+
+func TestMileageCalculatorCatchesUp(t *testing.T) {
+	now := time.Date(2019, time.March, 4, 10, 30, 0, 0, time.Local)
+	ms := &stmock.ModelService{}
+	ms.LocationService.On("ExportLocations", mock.Anything).Return([]*shuttletracker.Location{}, nil)
+	as := &stmock.AnalyticsService{}
+	as.On("LastMileageDay").Return(time.Date(2019, time.March, 1, 0, 0, 0, 0, time.Local), nil)
+	as.On("SetMileage", mock.Anything, mock.Anything).Return(nil)
+	leader := &stmock.LeaderService{}
+	leader.On("Leader").Return(true)
+
+	mc := NewMileageCalculator(ms, as, leader)
+	mc.calculate(now)
+
+	// March 1 was the last day calculated, and March 4 hasn't ended yet.
+	as.AssertNumberOfCalls(t, "SetMileage", 2)
+	as.AssertCalled(t, "SetMileage", time.Date(2019, time.March, 2, 0, 0, 0, 0, time.Local), []*shuttletracker.Mileage{})
+	as.AssertCalled(t, "SetMileage", time.Date(2019, time.March, 3, 0, 0, 0, 0, time.Local), []*shuttletracker.Mileage{})
+}
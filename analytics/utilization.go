@@ -0,0 +1,86 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// movingDistance is how far a vehicle must go between two Locations to be
+// moving. Anything less is GPS noise while it's idle.
+const movingDistance = 10.0 // meters
+
+// Utilization is how much a vehicle was used on one day.
+type Utilization struct {
+	VehicleID int64     `json:"vehicle_id"`
+	Day       time.Time `json:"day"`
+
+	// ServiceHours is how long the vehicle was on a route.
+	ServiceHours float64 `json:"service_hours"`
+
+	// IdleHours is how long the vehicle was reporting but not moving,
+	// whether or not it was on a route.
+	IdleHours float64 `json:"idle_hours"`
+
+	// Distance is how far the vehicle traveled in meters.
+	Distance float64 `json:"distance"`
+
+	// FirstMovement and LastMovement are when the vehicle started and
+	// stopped moving for the day. They are nil if it never moved.
+	FirstMovement *time.Time `json:"first_movement"`
+	LastMovement  *time.Time `json:"last_movement"`
+}
+
+// VehicleUtilization computes each vehicle's Utilization on each day that it
+// reported in filter's time range, sorted by day and then vehicle. Time
+// between Locations more than a few minutes apart isn't counted, since the
+// vehicle's tracker was probably off.
+func VehicleUtilization(ls shuttletracker.LocationService, filter shuttletracker.HistoryFilter) ([]*Utilization, error) {
+	type key struct {
+		vehicleID int64
+		day       time.Time
+	}
+	days := map[key]*Utilization{}
+
+	err := eachInterval(ls, filter, func(prev, cur *shuttletracker.Location) {
+		k := key{*prev.VehicleID, day(prev.Time)}
+		u, ok := days[k]
+		if !ok {
+			u = &Utilization{VehicleID: k.vehicleID, Day: k.day}
+			days[k] = u
+		}
+
+		dt := cur.Time.Sub(prev.Time).Hours()
+		if prev.RouteID != nil {
+			u.ServiceHours += dt
+		}
+		d := shuttletracker.DistanceBetween(prev.Latitude, prev.Longitude, cur.Latitude, cur.Longitude)
+		u.Distance += d
+		if d < movingDistance {
+			u.IdleHours += dt
+			return
+		}
+		if u.FirstMovement == nil {
+			t := prev.Time
+			u.FirstMovement = &t
+		}
+		t := cur.Time
+		u.LastMovement = &t
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	utilization := make([]*Utilization, 0, len(days))
+	for _, u := range days {
+		utilization = append(utilization, u)
+	}
+	sort.Slice(utilization, func(i, j int) bool {
+		if !utilization[i].Day.Equal(utilization[j].Day) {
+			return utilization[i].Day.Before(utilization[j].Day)
+		}
+		return utilization[i].VehicleID < utilization[j].VehicleID
+	})
+	return utilization, nil
+}
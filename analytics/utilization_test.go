@@ -0,0 +1,63 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestVehicleUtilization(t *testing.T) {
+	start := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.Local)
+	vehicleID := int64(1)
+	otherID := int64(2)
+	routeID := int64(3)
+	loc := func(vehicleID *int64, routeID *int64, minutes int, latitude float64) *shuttletracker.Location {
+		return &shuttletracker.Location{
+			VehicleID: vehicleID,
+			RouteID:   routeID,
+			Time:      start.Add(time.Duration(minutes) * time.Minute),
+			Latitude:  latitude,
+		}
+	}
+	// 0.001 degrees of latitude is about 111 meters.
+	locations := []*shuttletracker.Location{
+		loc(&vehicleID, &routeID, 0, 42.730),
+		loc(&otherID, nil, 0, 42.730),
+		loc(&vehicleID, &routeID, 1, 42.731),
+		loc(nil, nil, 1, 42.8),
+		loc(&vehicleID, nil, 2, 42.731),
+		loc(&vehicleID, nil, 3, 42.731),
+		// the tracker was off, so this isn't counted
+		loc(&vehicleID, nil, 30, 42.740),
+	}
+	filter := shuttletracker.HistoryFilter{Since: start, Until: start.Add(time.Hour)}
+	ms := &mock.ModelService{}
+	ms.LocationService.On("ExportLocations", filter).Return(locations, nil)
+
+	utilization, err := VehicleUtilization(ms, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(utilization) != 1 {
+		t.Fatalf("got %d vehicle days, expected 1", len(utilization))
+	}
+	u := utilization[0]
+	if u.VehicleID != vehicleID || !u.Day.Equal(day(start)) {
+		t.Errorf("got vehicle %d on %s", u.VehicleID, u.Day)
+	}
+	minutes := func(hours float64) float64 {
+		return math.Round(hours * 60)
+	}
+	if minutes(u.ServiceHours) != 2 || minutes(u.IdleHours) != 2 {
+		t.Errorf("got %g service minutes and %g idle minutes, expected 2 and 2", minutes(u.ServiceHours), minutes(u.IdleHours))
+	}
+	if math.Abs(u.Distance-111) > 1 {
+		t.Errorf("got distance %g, expected about 111 meters", u.Distance)
+	}
+	if u.FirstMovement == nil || !u.FirstMovement.Equal(start) || u.LastMovement == nil || !u.LastMovement.Equal(start.Add(time.Minute)) {
+		t.Errorf("got first movement %v and last movement %v", u.FirstMovement, u.LastMovement)
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// runningVehicle is a Vehicle that's reporting its location and whether it's
+// wheelchair accessible.
+type runningVehicle struct {
+	ID                   int64  `json:"id"`
+	Name                 string `json:"name"`
+	RouteID              *int64 `json:"route_id"`
+	WheelchairAccessible bool   `json:"wheelchair_accessible"`
+}
+
+// accessibleAlternative is the next accessible Vehicle on a Route to a Stop
+// when the next Vehicle there isn't accessible.
+type accessibleAlternative struct {
+	StopID  int64 `json:"stop_id"`
+	RouteID int64 `json:"route_id"`
+
+	// NextVehicleID is the inaccessible Vehicle that's next, expected at
+	// NextETA.
+	NextVehicleID int64     `json:"next_vehicle_id"`
+	NextETA       time.Time `json:"next_eta"`
+
+	// VehicleID is the first accessible Vehicle expected at the Stop on the
+	// Route after it, at ETA, or nil if none is expected.
+	VehicleID *int64     `json:"vehicle_id"`
+	ETA       *time.Time `json:"eta"`
+}
+
+// accessibility is the accessibility of running Vehicles and of Stops.
+type accessibility struct {
+	Vehicles []runningVehicle       `json:"vehicles"`
+	Stops    []*shuttletracker.Stop `json:"stops"`
+
+	// Realtime is false when predictions aren't available, e.g. because
+	// the data feed is down, so there are no Alternatives.
+	Realtime     bool                    `json:"realtime"`
+	Alternatives []accessibleAlternative `json:"alternatives"`
+}
+
+// AccessibilityHandler returns which running Vehicles and which Stops are
+// wheelchair accessible, and the accessible alternatives wherever the next
+// Vehicle on a Route to a Stop isn't.
+func (api *API) AccessibilityHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	vehicles, err := api.runningVehicles(now)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get running vehicles")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stops, err := api.ms.Stops()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stops")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := accessibility{
+		Vehicles:     vehicles,
+		Stops:        stops,
+		Realtime:     !etasStale(),
+		Alternatives: []accessibleAlternative{},
+	}
+	if result.Realtime {
+		accessible := map[int64]bool{}
+		for _, v := range vehicles {
+			accessible[v.ID] = v.WheelchairAccessible
+		}
+		result.Alternatives = accessibleAlternatives(api.etaManager.CurrentETAs(), accessible, now)
+	}
+	WriteJSON(w, result)
+}
+
+// runningVehicles returns the enabled Vehicles that aren't offline or on a
+// hidden Route, in order of ID.
+func (api *API) runningVehicles(now time.Time) ([]runningVehicle, error) {
+	vehicles, err := api.ms.Vehicles()
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int64]*shuttletracker.Vehicle{}
+	for _, vehicle := range vehicles {
+		byID[vehicle.ID] = vehicle
+	}
+	locations, err := api.ms.LatestLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	running := []runningVehicle{}
+	for _, location := range locations {
+		if location.VehicleID == nil || isOffline(location, now, api.offlineAfter) || api.visibility.hidden(location.RouteID, now) {
+			continue
+		}
+		vehicle, ok := byID[*location.VehicleID]
+		if !ok || !vehicle.Enabled {
+			continue
+		}
+		running = append(running, runningVehicle{
+			ID:                   vehicle.ID,
+			Name:                 vehicle.Name,
+			RouteID:              location.RouteID,
+			WheelchairAccessible: vehicle.WheelchairAccessible,
+		})
+	}
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].ID < running[j].ID
+	})
+	return running, nil
+}
+
+// accessibleAlternatives finds each Stop and Route where the next Vehicle
+// expected isn't accessible, and the first accessible one after it. Only
+// Vehicles in accessible, which are the running ones, are considered.
+func accessibleAlternatives(etas map[int64]shuttletracker.VehicleETA, accessible map[int64]bool, now time.Time) []accessibleAlternative {
+	type arrival struct {
+		vehicleID int64
+		eta       time.Time
+	}
+	type stopRoute struct {
+		stopID, routeID int64
+	}
+	arrivals := map[stopRoute][]arrival{}
+	for _, vehicleETA := range etas {
+		if _, ok := accessible[vehicleETA.VehicleID]; !ok {
+			continue
+		}
+		for _, stopETA := range vehicleETA.StopETAs {
+			if stopETA.ETA.Before(now) && !stopETA.Arriving {
+				continue
+			}
+			key := stopRoute{stopETA.StopID, vehicleETA.RouteID}
+			arrivals[key] = append(arrivals[key], arrival{vehicleETA.VehicleID, stopETA.ETA})
+		}
+	}
+
+	alternatives := []accessibleAlternative{}
+	for key, as := range arrivals {
+		sort.Slice(as, func(i, j int) bool {
+			return as[i].eta.Before(as[j].eta)
+		})
+		if accessible[as[0].vehicleID] {
+			continue
+		}
+		alternative := accessibleAlternative{
+			StopID:        key.stopID,
+			RouteID:       key.routeID,
+			NextVehicleID: as[0].vehicleID,
+			NextETA:       as[0].eta,
+		}
+		for _, a := range as[1:] {
+			if accessible[a.vehicleID] {
+				a := a
+				alternative.VehicleID = &a.vehicleID
+				alternative.ETA = &a.eta
+				break
+			}
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	sort.Slice(alternatives, func(i, j int) bool {
+		if alternatives[i].StopID != alternatives[j].StopID {
+			return alternatives[i].StopID < alternatives[j].StopID
+		}
+		return alternatives[i].RouteID < alternatives[j].RouteID
+	})
+	return alternatives
+}
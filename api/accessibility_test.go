@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestAccessibilityHandler(t *testing.T) {
+	now := time.Now()
+	id := func(n int64) *int64 {
+		return &n
+	}
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicles").Return([]*shuttletracker.Vehicle{
+		{ID: 1, Name: "Bus 1", Enabled: true, WheelchairAccessible: true},
+		{ID: 2, Name: "Bus 2", Enabled: true},
+		{ID: 3, Name: "Bus 3", Enabled: true, WheelchairAccessible: true},
+		// offline
+		{ID: 4, Name: "Bus 4", Enabled: true, WheelchairAccessible: true},
+	}, nil)
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{
+		{VehicleID: id(1), RouteID: id(1), Time: now},
+		{VehicleID: id(2), RouteID: id(1), Time: now},
+		{VehicleID: id(3), RouteID: id(1), Time: now},
+		{VehicleID: id(4), RouteID: id(1), Time: now.Add(-time.Hour)},
+	}, nil)
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{
+		{ID: 1, WheelchairAccessible: true},
+		{ID: 2},
+	}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		1: {VehicleID: 1, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(10 * time.Minute)},
+			{StopID: 2, ETA: now.Add(2 * time.Minute)},
+		}},
+		2: {VehicleID: 2, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(3 * time.Minute)},
+			{StopID: 2, ETA: now.Add(8 * time.Minute)},
+		}},
+		3: {VehicleID: 3, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(20 * time.Minute)},
+		}},
+		// offline vehicles aren't alternatives
+		4: {VehicleID: 4, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(5 * time.Minute)},
+		}},
+	})
+	api := API{ms: ms, etaManager: em, offlineAfter: 5 * time.Minute}
+
+	w := httptest.NewRecorder()
+	api.AccessibilityHandler(w, httptest.NewRequest("GET", "/accessibility", nil))
+	if w.Code != 200 {
+		t.Fatalf("got status code %d: %s", w.Code, w.Body)
+	}
+	result := accessibility{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unable to decode accessibility: %s", err)
+	}
+	if len(result.Vehicles) != 3 || !result.Vehicles[0].WheelchairAccessible || result.Vehicles[1].WheelchairAccessible {
+		t.Errorf("got vehicles %+v", result.Vehicles)
+	}
+	if len(result.Stops) != 2 {
+		t.Errorf("got stops %+v", result.Stops)
+	}
+	// vehicle 1 is next at stop 2, so only stop 1 needs an alternative
+	if len(result.Alternatives) != 1 {
+		t.Fatalf("got alternatives %+v", result.Alternatives)
+	}
+	alternative := result.Alternatives[0]
+	if alternative.StopID != 1 || alternative.NextVehicleID != 2 || alternative.VehicleID == nil || *alternative.VehicleID != 1 {
+		t.Errorf("got %+v", alternative)
+	}
+	if alternative.ETA == nil || !alternative.ETA.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("got ETA %v", alternative.ETA)
+	}
+}
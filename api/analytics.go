@@ -0,0 +1,214 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/analytics"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// UtilizationHandler reports each vehicle's service hours, idle hours,
+// distance, and first and last movement on each day in the requested range.
+// It accepts the same filters as exports.
+func (api *API) UtilizationHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	utilization, err := analytics.VehicleUtilization(api.ms, filter)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to compute utilization")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, utilization)
+}
+
+// UtilizationCSVHandler reports the same statistics as UtilizationHandler as CSV.
+func (api *API) UtilizationCSVHandler(w http.ResponseWriter, r *http.Request) {
+	header := []string{"vehicle_id", "day", "service_hours", "idle_hours", "distance", "first_movement", "last_movement"}
+	exportCSV(w, r, "utilization", header, func(filter shuttletracker.HistoryFilter, write func([]string) error) error {
+		utilization, err := analytics.VehicleUtilization(api.ms, filter)
+		if err != nil {
+			return err
+		}
+		for _, u := range utilization {
+			err := write([]string{
+				strconv.FormatInt(u.VehicleID, 10),
+				u.Day.Format("2006-01-02"),
+				formatFloat(u.ServiceHours),
+				formatFloat(u.IdleHours),
+				formatFloat(u.Distance),
+				formatOptionalTime(u.FirstMovement),
+				formatOptionalTime(u.LastMovement),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DensityHandler reports how many Locations were reported by vehicles on a
+// route in each cell of a grid, and their average speed, slowest cells
+// first. It uses the hourly grids saved by analytics.DensityAggregator, so
+// the time range is rounded to hours and the current hour isn't included.
+// Cells with fewer than min_count Locations are omitted, since a few
+// Locations of a vehicle waiting at a light aren't a chronically slow road.
+func (api *API) DensityHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var minCount int64
+	if s := r.URL.Query().Get("min_count"); s != "" {
+		minCount, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	cells, err := api.ans.Density(filter.Since.Truncate(time.Hour), filter.Until.Truncate(time.Hour))
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get density")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	filtered := []*shuttletracker.DensityCell{}
+	for _, c := range cells {
+		if c.Count >= minCount {
+			filtered = append(filtered, c)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].AverageSpeed < filtered[j].AverageSpeed
+	})
+	WriteJSON(w, filtered)
+}
+
+// ETAAccuracyHandler summarizes how far off ETA predictions made in the
+// requested range were. group_by is a comma-separated list of route, stop,
+// hour, and algorithm; without it, every prediction is summarized together.
+// It accepts the same filters as exports.
+func (api *API) ETAAccuracyHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var grouping analytics.ETAGrouping
+	if s := r.URL.Query().Get("group_by"); s != "" {
+		for _, group := range strings.Split(s, ",") {
+			switch strings.TrimSpace(group) {
+			case "route":
+				grouping.Route = true
+			case "stop":
+				grouping.Stop = true
+			case "hour":
+				grouping.Hour = true
+			case "algorithm":
+				grouping.Algorithm = true
+			default:
+				http.Error(w, "group_by must be route, stop, hour, or algorithm", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	summaries, err := analytics.ETAAccuracy(api.ms, filter, grouping)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to compute ETA accuracy")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, summaries)
+}
+
+// DrivingEventsHandler lists speeding and harsh acceleration and braking in
+// the requested range, using the limits in the analytics configuration. It
+// accepts the same filters as exports.
+func (api *API) DrivingEventsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := analytics.DrivingEvents(api.ms, filter)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to find driving events")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, events)
+}
+
+// DrivingEventsCSVHandler lists the same events as DrivingEventsHandler as CSV.
+func (api *API) DrivingEventsCSVHandler(w http.ResponseWriter, r *http.Request) {
+	header := []string{"type", "vehicle_id", "route_id", "segment_stop_id", "start", "end", "latitude", "longitude", "value", "limit"}
+	exportCSV(w, r, "driving-events", header, func(filter shuttletracker.HistoryFilter, write func([]string) error) error {
+		events, err := analytics.DrivingEvents(api.ms, filter)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			err := write([]string{
+				e.Type,
+				strconv.FormatInt(e.VehicleID, 10),
+				formatOptionalID(e.RouteID),
+				formatOptionalID(e.SegmentStopID),
+				e.Start.Format(time.RFC3339),
+				e.End.Format(time.RFC3339),
+				formatFloat(e.Latitude),
+				formatFloat(e.Longitude),
+				formatFloat(e.Value),
+				formatFloat(e.Limit),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ServiceGapsHandler reports how often vehicles arrived at each stop of each
+// route while it was scheduled to run, and the times that a stop went at
+// least min_gap (default 15 minutes) without one. It accepts the same filters
+// as exports, except vehicle_id.
+func (api *API) ServiceGapsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minGap := 15 * time.Minute
+	if s := r.URL.Query().Get("min_gap"); s != "" {
+		minGap, err = time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	coverage, err := analytics.ServiceGaps(api.ms, filter, minGap)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to find service gaps")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, coverage)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
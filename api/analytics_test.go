@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestUtilizationCSVHandler(t *testing.T) {
+	since := time.Date(2019, time.March, 1, 5, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	vehicleID := int64(4)
+	ms := &mock.ModelService{}
+	ms.LocationService.On("ExportLocations", shuttletracker.HistoryFilter{Since: since, Until: until}).Return([]*shuttletracker.Location{
+		{VehicleID: &vehicleID, Time: since.Add(time.Hour)},
+		{VehicleID: &vehicleID, Time: since.Add(time.Hour + time.Minute)},
+	}, nil)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	api.UtilizationCSVHandler(w, httptest.NewRequest("GET", "/analytics/utilization.csv?since=2019-03-01T05:00:00Z&until=2019-03-02T05:00:00Z", nil))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, expected header and one row:\n%s", len(lines), w.Body)
+	}
+	if !strings.HasPrefix(lines[1], "4,") || !strings.HasSuffix(lines[1], ",0,0.016666666666666666,0,,") {
+		t.Errorf("got row %q", lines[1])
+	}
+}
+
+func TestDensityHandler(t *testing.T) {
+	since := time.Date(2019, time.March, 1, 5, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	ans := &mock.AnalyticsService{}
+	ans.On("Density", since, until).Return([]*shuttletracker.DensityCell{
+		{Row: 1, Count: 100, AverageSpeed: 20},
+		{Row: 2, Count: 3, AverageSpeed: 1},
+		{Row: 3, Count: 50, AverageSpeed: 5},
+	}, nil)
+	api := API{ans: ans}
+
+	w := httptest.NewRecorder()
+	api.DensityHandler(w, httptest.NewRequest("GET", "/analytics/density?since=2019-03-01T05:30:00Z&until=2019-03-02T05:10:00Z&min_count=10", nil))
+	cells := []*shuttletracker.DensityCell{}
+	if err := json.NewDecoder(w.Body).Decode(&cells); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if len(cells) != 2 || cells[0].Row != 3 || cells[1].Row != 1 {
+		t.Errorf("got %+v, expected the cells in rows 3 and 1", cells)
+	}
+}
+
+func TestETAAccuracyHandlerGroupBy(t *testing.T) {
+	api := API{ms: &mock.ModelService{}}
+	w := httptest.NewRecorder()
+	api.ETAAccuracyHandler(w, httptest.NewRequest("GET", "/analytics/eta-accuracy?group_by=route,vehicle", nil))
+	if w.Code != 400 {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+}
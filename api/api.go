@@ -1,10 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -12,8 +15,15 @@ import (
 
 	"github.com/wtg/shuttletracker"
 	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/metrics"
+	"github.com/wtg/shuttletracker/pb"
 )
 
+const protobufContentType = "application/x-protobuf"
+
+// shutdownTimeout is how long Stop waits for requests in progress.
+const shutdownTimeout = 30 * time.Second
+
 // Config holds API settings.
 type Config struct {
 	GoogleMapAPIKey      string
@@ -22,6 +32,96 @@ type Config struct {
 	Authenticate         bool
 	ListenURL            string
 	MapboxAPIKey         string
+	GTFSInterval         string
+	GTFSRouteIDs         map[string]string
+	GTFSStopIDs          map[string]string
+	SIRIOperatorRef      string
+	SIRILineRefs         map[string]string
+	OBAAgencyID          string
+	OBAAgencyName        string
+	OBAAgencyURL         string
+
+	// CacheTTL is how long responses from /vehicles, /routes, and /stops are
+	// cached. They are also invalidated when edited. If CacheRedisURL is set,
+	// responses are cached in Redis instead of memory.
+	CacheTTL      string
+	CacheRedisURL string
+
+	// DebugEndpoints enables pprof and expvar under /debug for administrators.
+	DebugEndpoints bool
+
+	// Metrics enables Prometheus metrics at /metrics.
+	Metrics bool
+
+	// AccessLog logs every request.
+	AccessLog bool
+
+	// Usage counts anonymous, aggregate usage for administrators at /usage,
+	// and demand at each stop at /analytics/demand and /analytics/stop-popularity.
+	Usage bool
+
+	// StatusStaleAfter is how recently a vehicle must have reported to be
+	// counted by /status.
+	StatusStaleAfter string
+
+	// VehicleOfflineAfter is how long a vehicle can go without reporting its
+	// location before it's left out of realtime feeds and Fusion clients are
+	// told that it's offline.
+	VehicleOfflineAfter string
+
+	// FusionSnapshotInterval is how often a summary of every vehicle is sent
+	// to Fusion clients subscribed to the snapshot topic.
+	FusionSnapshotInterval string
+
+	// FusionHistorySize is how many of the most recent messages on each
+	// Fusion topic are kept for clients that missed them to replay.
+	FusionHistorySize int
+
+	// WalkingSpeed is how fast riders walk to stops, in meters per second,
+	// when estimating walking times along straight lines. If WalkingRouterURL
+	// is set, walking times come from that routing engine instead.
+	WalkingSpeed     float64
+	WalkingRouterURL string
+
+	// TLSCertFile and TLSKeyFile serve HTTPS on ListenURL using a certificate
+	// from disk. Alternatively, AutocertDomains obtains certificates for those
+	// domains from Let's Encrypt and keeps them in AutocertCacheDir.
+	// RedirectListenURL, if set, redirects plain HTTP there to HTTPS.
+	TLSCertFile       string
+	TLSKeyFile        string
+	AutocertDomains   []string
+	AutocertEmail     string
+	AutocertCacheDir  string
+	RedirectListenURL string
+
+	// InternalListenURL, if set, serves /admin, /metrics, /debug, and the
+	// fusion debug and export endpoints there instead of on ListenURL, so
+	// that they can be firewalled off from riders.
+	InternalListenURL string
+
+	// TranslationsFile is a JSON file of translations of the messages that
+	// the server writes, like errors and alerts, by language. Responses are
+	// in the language that requests prefer in their Accept-Language header,
+	// or English if there aren't translations for it.
+	TranslationsFile string
+
+	// PublicURL is where riders reach Shuttle Tracker, like
+	// "https://shuttles.rpi.edu", for links in QR codes and checking
+	// Twilio's signatures. Stop QR codes aren't available without it.
+	PublicURL string
+
+	// TrustedProxies are the IP addresses or CIDR ranges of load balancers
+	// and proxies in front of Shuttle Tracker. Clients' addresses are only
+	// taken from X-Forwarded-For on requests that come through them.
+	TrustedProxies []string
+
+	// TwilioAuthToken, if set, is used to check that texts to /sms really
+	// come from Twilio.
+	TwilioAuthToken string
+
+	// StaticDir is where the built frontend is. If it's empty, the frontend
+	// embedded in the binary is used if there is one, or otherwise "static".
+	StaticDir string
 }
 
 // API is responsible for configuring handlers for HTTP endpoints.
@@ -34,23 +134,104 @@ type API struct {
 	fm         *fusionManager
 	etaManager shuttletracker.ETAService
 	fdb        shuttletracker.FeedbackService
+	bs         shuttletracker.BroadcastService
+	gtfs       *gtfsFeed
+	cache      *responseCache
+	status     *statusTracker
+	uss        shuttletracker.UsageService
+	usage      *usageCounter
+	demand     *demandCounter
+	visibility *routeVisibility
+	occupancy  *occupancyTracker
+	walking    *walkingEstimator
+	i18n       translations
+	ans        shuttletracker.AnalyticsService
+	fs         shuttletracker.FavoriteService
+	widgets    *widgetEmbeds
+	proxies    trustedProxies
+	static     http.FileSystem
+
+	statusStaleAfter time.Duration
+	offlineAfter     time.Duration
+
+	// server serves handler on every listener, redirect serves HTTPS
+	// redirects if RedirectListenURL is set, and internal serves every
+	// endpoint if InternalListenURL is set. They're created by New so that
+	// Stop can be called before Run.
+	server   *http.Server
+	redirect *http.Server
+	internal *http.Server
 }
 
 // New initializes the application given a config and connects to backends.
 // It also seeds any needed information to the database.
-func New(cfg Config, ms shuttletracker.ModelService, msg shuttletracker.MessageService, us shuttletracker.UserService, updater shuttletracker.UpdaterService, etaManager shuttletracker.ETAService, fdb shuttletracker.FeedbackService) (*API, error) {
+func New(cfg Config, ms shuttletracker.ModelService, msg shuttletracker.MessageService, us shuttletracker.UserService, updater shuttletracker.UpdaterService, etaManager shuttletracker.ETAService, fdb shuttletracker.FeedbackService, bs shuttletracker.BroadcastService, as shuttletracker.AlertService, uss shuttletracker.UsageService, ans shuttletracker.AnalyticsService, fs shuttletracker.FavoriteService, wks shuttletracker.WidgetKeyService) (*API, error) {
 	// Set up CAS authentication
 	url, err := url.Parse(cfg.CasURL)
 	if err != nil {
 		return nil, err
 	}
 
+	offlineAfter, err := time.ParseDuration(cfg.VehicleOfflineAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotInterval, err := time.ParseDuration(cfg.FusionSnapshotInterval)
+	if err != nil {
+		return nil, err
+	}
+
 	// Set up fusion manager
-	fm, err := newFusionManager(etaManager, ms)
+	fm, err := newFusionManager(etaManager, ms, bs, offlineAfter, snapshotInterval, cfg.FusionHistorySize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up GTFS-realtime feed generation
+	gtfs, err := newGTFSFeed(cfg, ms, etaManager, offlineAfter, fm.visibility)
+	if err != nil {
+		return nil, err
+	}
+	go gtfs.run()
+
+	// Set up response caching
+	cacheTTL, err := time.ParseDuration(cfg.CacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := newResponseCache(cacheTTL, cfg.CacheRedisURL, bs)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	statusStaleAfter, err := time.ParseDuration(cfg.StatusStaleAfter)
 	if err != nil {
 		return nil, err
 	}
 
+	translations, err := loadTranslations(cfg.TranslationsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up usage analytics
+	var usage *usageCounter
+	var demand *demandCounter
+	if cfg.Usage {
+		usage = newUsageCounter(uss)
+		fm.usage = usage
+		go usage.run()
+		demand = newDemandCounter(ms, ans)
+		fm.demand = demand
+		go demand.run()
+	}
+
 	// Create API instance to store database session and collections
 	api := API{
 		cfg:        cfg,
@@ -60,24 +241,133 @@ func New(cfg Config, ms shuttletracker.ModelService, msg shuttletracker.MessageS
 		fm:         fm,
 		etaManager: etaManager,
 		fdb:        fdb,
+		bs:         bs,
+		gtfs:       gtfs,
+		cache:      cache,
+		status:     newStatusTracker(as, bs),
+		uss:        uss,
+		usage:      usage,
+		demand:     demand,
+		ans:        ans,
+		fs:         fs,
+		widgets:    newWidgetEmbeds(wks),
+		proxies:    proxies,
+		visibility: fm.visibility,
+		occupancy:  fm.occupancy,
+		walking:    newWalkingEstimator(cfg.WalkingSpeed, cfg.WalkingRouterURL),
+		i18n:       translations,
+		static:     staticFiles(cfg.StaticDir),
+
+		statusStaleAfter: statusStaleAfter,
+		offlineAfter:     offlineAfter,
+	}
+
+	go listenFlags(bs.SubscribeBroadcasts(flagsChannel))
+	go api.publishDrafts()
+
+	// Routes for administrators and operators are only served on the internal
+	// listener if there is one.
+	cli := CreateCASClient(url, us, cfg.Authenticate)
+	api.handler = api.router(cli, cfg.InternalListenURL == "")
+	api.server = &http.Server{Handler: api.handler}
+	if cfg.InternalListenURL != "" {
+		api.internal = &http.Server{Handler: api.router(cli, true)}
+	}
+	if cfg.RedirectListenURL != "" {
+		api.redirect = &http.Server{
+			Addr:         cfg.RedirectListenURL,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
 	}
 
+	return &api, nil
+}
+
+// router creates a router for every endpoint. Endpoints for administrators and
+// operators, like /admin and /metrics, are only included if internal is true.
+// Everything else is included either way so that the admin interface works.
+func (api *API) router(cli *CASClient, internal bool) http.Handler {
+	cfg := api.cfg
 	r := chi.NewRouter()
 
+	r.Use(requestID)
+	r.Use(api.clientIP)
+	if cfg.AccessLog {
+		r.Use(accessLog)
+	}
+	if cfg.Metrics {
+		r.Use(instrument)
+	}
+	r.Use(traceRequests)
 	r.Use(middleware.DefaultCompress)
 	r.Use(etag)
-
-	cli := CreateCASClient(url, us, cfg.Authenticate)
+	r.Use(errorRequestID)
+	r.Use(api.localize)
+	if cfg.Usage {
+		r.Use(api.usage.middleware)
+	}
 
 	// Vehicles
 	r.Route("/vehicles", func(r chi.Router) {
-		r.Get("/", api.VehiclesHandler)
+		r.With(api.cache.middleware).Get("/", api.VehiclesHandler)
 		r.Group(func(r chi.Router) {
 			r.Use(cli.casauth)
+			r.Use(api.cache.invalidator)
 			r.Post("/create", api.VehiclesCreateHandler)
 			r.Post("/edit", api.VehiclesEditHandler)
 			r.Delete("/", api.VehiclesDeleteHandler)
 		})
+		r.With(cli.casauth).Get("/plate/{plate}", api.VehicleByPlateHandler)
+		r.With(cli.casauth).Get("/mileage", api.VehicleMileageHandler)
+		r.With(cli.casauth).Get("/data-ages", api.VehicleDataAgesHandler)
+		r.With(cli.casauth).Get("/stuck", api.StuckVehiclesHandler)
+		r.With(cli.casauth).Get("/{id}/history", api.VehicleHistoryHandler)
+	})
+
+	// Groups of vehicles belonging to the same operation
+	r.Route("/groups", func(r chi.Router) {
+		r.With(api.cache.middleware).Get("/", api.VehicleGroupsHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(cli.casauth)
+			// group membership is shown with vehicles
+			r.Use(api.cache.invalidator)
+			r.Post("/create", api.VehicleGroupsCreateHandler)
+			r.Post("/edit", api.VehicleGroupsEditHandler)
+			r.Delete("/", api.VehicleGroupsDeleteHandler)
+		})
+	})
+
+	// Vehicle maintenance, which is only for staff
+	r.Route("/maintenance", func(r chi.Router) {
+		r.Use(cli.casauth)
+		r.Get("/", api.MaintenanceHandler)
+		r.Group(func(r chi.Router) {
+			// out-of-service windows are shown with vehicles
+			r.Use(api.cache.invalidator)
+			r.Post("/create", api.MaintenanceCreateHandler)
+			r.Post("/edit", api.MaintenanceEditHandler)
+			r.Delete("/", api.MaintenanceDeleteHandler)
+		})
+	})
+
+	// Which vehicle each tracker is installed in, which is only for staff
+	r.Route("/trackers", func(r chi.Router) {
+		r.Use(cli.casauth)
+		r.Get("/", api.TrackerDevicesHandler)
+		r.Post("/create", api.TrackerDevicesCreateHandler)
+		r.Post("/edit", api.TrackerDevicesEditHandler)
+		r.Delete("/", api.TrackerDevicesDeleteHandler)
+	})
+
+	// Operator shifts, which are only for staff
+	r.Route("/shifts", func(r chi.Router) {
+		r.Use(cli.casauth)
+		r.Get("/", api.ShiftsHandler)
+		r.Get("/{id}/locations", api.ShiftLocationsHandler)
+		r.Post("/create", api.ShiftsCreateHandler)
+		r.Post("/edit", api.ShiftsEditHandler)
+		r.Delete("/", api.ShiftsDeleteHandler)
 	})
 
 	// Updates
@@ -112,47 +402,169 @@ func New(cfg Config, ms shuttletracker.ModelService, msg shuttletracker.MessageS
 
 	// Routes
 	r.Route("/routes", func(r chi.Router) {
-		r.Get("/", api.RoutesHandler)
+		r.With(api.cache.middleware).Get("/", api.RoutesHandler)
+		r.With(cli.casauth).Get("/all", api.RoutesAllHandler)
+		r.With(api.cache.middleware).Get("/loop-times", api.RouteLoopTimesHandler)
 		r.Group(func(r chi.Router) {
 			r.Use(cli.casauth)
+			r.Use(api.cache.invalidator)
 			r.Post("/create", api.RoutesCreateHandler)
 			r.Post("/edit", api.RoutesEditHandler)
+			r.Post("/reorder-stops", api.RoutesReorderStopsHandler)
+			r.Post("/import-gtfs", api.RoutesImportGTFSHandler)
 			r.Delete("/", api.RoutesDeleteHandler)
 		})
+
+		// Planned trips and stop times
+		r.Route("/schedules", func(r chi.Router) {
+			r.With(api.cache.middleware).Get("/", api.SchedulesHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(cli.casauth)
+				r.Use(api.cache.invalidator)
+				r.Post("/create", api.SchedulesCreateHandler)
+				r.Post("/edit", api.SchedulesEditHandler)
+				r.Post("/import", api.SchedulesImportHandler)
+				r.Delete("/", api.SchedulesDeleteHandler)
+			})
+		})
+	})
+
+	// Temporary replacements for parts of routes
+	r.Route("/detours", func(r chi.Router) {
+		r.With(api.cache.middleware).Get("/", api.DetoursHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(cli.casauth)
+			// detours are shown in routes
+			r.Use(api.cache.invalidator)
+			r.Post("/create", api.DetoursCreateHandler)
+			r.Post("/edit", api.DetoursEditHandler)
+			r.Delete("/", api.DetoursDeleteHandler)
+		})
+	})
+
+	// Staged route and schedule changes
+	r.Route("/drafts", func(r chi.Router) {
+		r.Use(cli.casauth)
+		r.Get("/", api.DraftsHandler)
+		r.Get("/diff", api.DraftDiffHandler)
+		r.Post("/create", api.DraftsCreateHandler)
+		r.Post("/edit", api.DraftsEditHandler)
+		r.Delete("/", api.DraftsDeleteHandler)
+		r.With(api.cache.invalidator).Post("/publish", api.DraftsPublishHandler)
+	})
+
+	// Service calendar
+	r.Route("/calendar", func(r chi.Router) {
+		r.With(api.cache.middleware).Get("/", api.CalendarHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(cli.casauth)
+			r.Use(api.cache.invalidator)
+			r.Post("/create", api.CalendarCreateHandler)
+			r.Post("/edit", api.CalendarEditHandler)
+			r.Delete("/", api.CalendarDeleteHandler)
+		})
+	})
+
+	// Wheelchair accessibility of vehicles and stops
+	r.Get("/accessibility", api.AccessibilityHandler)
+
+	// Itineraries between two stops
+	r.Get("/plan", api.TripPlanHandler)
+
+	// Riders' favorite stops and routes, by device
+	r.Route("/favorites", func(r chi.Router) {
+		r.Get("/", api.FavoritesHandler)
+		r.Post("/create", api.FavoritesCreateHandler)
+		r.Delete("/", api.FavoritesDeleteHandler)
 	})
 
 	r.Route("/eta", func(r chi.Router) {
 		r.Get("/", api.ETAHandler)
+		r.Get("/delays", api.DelaysHandler)
 	})
 
 	// Stops
 	r.Route("/stops", func(r chi.Router) {
-		r.Get("/", api.StopsHandler)
+		r.With(api.cache.middleware).Get("/", api.StopsHandler)
+		r.Get("/nearby", api.NearbyStopsHandler)
+		r.With(cli.casauth).Get("/duplicates", api.StopDuplicatesHandler)
+		r.With(api.countTimetableQueries, api.cache.middleware).Get("/{id}/timetable", api.StopTimetableHandler)
+		r.With(api.countTimetableQueries).Get("/{id}/next-departures", api.NextDeparturesHandler)
+		r.Get("/{id}/qr.png", api.StopQRHandler)
+		r.Get("/{id}/catch", api.CatchHandler)
 		r.Group(func(r chi.Router) {
 			r.Use(cli.casauth)
+			r.Use(api.cache.invalidator)
 			r.Post("/create", api.StopsCreateHandler)
+			r.Post("/edit", api.StopsEditHandler)
+			r.Post("/merge", api.StopsMergeHandler)
 			r.Delete("/", api.StopsDeleteHandler)
 		})
 	})
 
+	// Exports
+	r.Route("/export", func(r chi.Router) {
+		r.Use(cli.casauth)
+		r.Get("/locations.csv", api.LocationsExportHandler)
+		r.Get("/arrivals.csv", api.ArrivalsExportHandler)
+		r.Get("/etas.csv", api.ETARecordsExportHandler)
+		r.Get("/deviations.csv", api.DeviationsExportHandler)
+		r.Get("/locations.ndjson", api.LocationsNDJSONExportHandler)
+		r.Get("/arrivals.ndjson", api.ArrivalsNDJSONExportHandler)
+		r.Get("/etas.ndjson", api.ETARecordsNDJSONExportHandler)
+		r.Get("/deviations.ndjson", api.DeviationsNDJSONExportHandler)
+	})
+
+	// GTFS-realtime
+	r.Route("/gtfs", func(r chi.Router) {
+		r.Get("/vehicle-positions.pb", api.GTFSVehiclePositionsHandler)
+		r.Get("/trip-updates.pb", api.GTFSTripUpdatesHandler)
+	})
+
+	// SIRI
+	r.Get("/siri/vehicle-monitoring", api.SIRIVehicleMonitoringHandler)
+
+	// OneBusAway
+	r.Route("/api/where", func(r chi.Router) {
+		r.Get("/stop/{id}", api.OBAStopHandler)
+		r.Get("/route/{id}", api.OBARouteHandler)
+		r.Get("/arrivals-and-departures-for-stop/{id}", api.OBAArrivalsAndDeparturesForStopHandler)
+		r.Get("/vehicles-for-route/{id}", api.OBAVehiclesForRouteHandler)
+	})
+
 	// Fusion
-	r.Mount("/fusion", api.fm.router(cli.casauth))
+	r.Mount("/fusion", api.fm.router(cli.casauth, internal))
+
+	if internal {
+		// Profiling and metrics (/debug/pprof and /debug/vars)
+		if cfg.DebugEndpoints {
+			r.Group(func(r chi.Router) {
+				r.Use(cli.casauth)
+				r.Mount("/debug", middleware.Profiler())
+			})
+		}
+
+		if cfg.Metrics {
+			r.Method("GET", "/metrics", metrics.Handler())
+		}
+
+		// Admin
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(cli.casauth)
+			r.Get("/*", api.AdminHandler)
+			r.Get("/login", api.AdminHandler)
+			r.Get("/logout", cli.logout)
+		})
+	}
 
 	r.Get("/logout/", cli.logout)
-	// Admin
-	r.Route("/admin", func(r chi.Router) {
-		r.Use(cli.casauth)
-		r.Get("/*", api.AdminHandler)
-		r.Get("/login", api.AdminHandler)
-		r.Get("/logout", cli.logout)
-	})
 
 	r.Group(func(r chi.Router) {
 		r.Use(cli.casauth)
 		r.Get("/getKey/", api.KeyHandler)
 	})
 
-	r.Method("GET", "/static/*", http.StripPrefix("/static/", http.FileServer(staticFileSystem{http.Dir("static/")})))
+	r.Method("GET", "/static/*", http.StripPrefix("/static/", http.FileServer(staticFileSystem{api.static})))
 
 	r.Get("/", api.IndexHandler)
 	r.Get("/about", api.IndexHandler)
@@ -163,34 +575,151 @@ func New(cfg Config, ms shuttletracker.ModelService, msg shuttletracker.MessageS
 	r.Get("/etas", api.IndexHandler)
 	r.Get("/feedback", api.IndexHandler)
 
+	// Short links to stops' arrivals, from QR codes on stop signs
+	r.Get("/s/{id}", api.StopLinkHandler)
+
+	// Next departures by text message, through a Twilio webhook
+	r.Post("/sms", api.SMSHandler)
+
+	// Data for widgets embedded on other sites
+	r.Route("/widget", func(r chi.Router) {
+		r.With(api.widgetAuth, api.widgets.cache.middleware).Get("/", api.WidgetHandler)
+		r.Route("/keys", func(r chi.Router) {
+			r.Use(cli.casauth)
+			r.Get("/", api.WidgetKeysHandler)
+			r.Post("/create", api.WidgetKeysCreateHandler)
+			r.Delete("/", api.WidgetKeysDeleteHandler)
+		})
+	})
+
 	// iTRAK data feed endpoint
 	r.Get("/datafeed", api.DataFeedHandler)
 
-	api.handler = r
+	// Usage analytics
+	r.With(cli.casauth).Get("/usage", api.UsageHandler)
 
-	return &api, nil
+	// Historical playback for investigating complaints
+	r.With(cli.casauth).Get("/playback", api.PlaybackHandler)
+
+	// Analytics for planners and fleet management
+	r.Route("/analytics", func(r chi.Router) {
+		r.Use(cli.casauth)
+		r.Get("/utilization", api.UtilizationHandler)
+		r.Get("/utilization.csv", api.UtilizationCSVHandler)
+		r.Get("/density", api.DensityHandler)
+		r.Get("/eta-accuracy", api.ETAAccuracyHandler)
+		r.Get("/demand", api.DemandHandler)
+		r.Get("/stop-popularity", api.StopPopularityHandler)
+		r.Get("/driving-events", api.DrivingEventsHandler)
+		r.Get("/driving-events.csv", api.DrivingEventsCSVHandler)
+		r.Get("/service-gaps", api.ServiceGapsHandler)
+	})
+
+	// Feature flags
+	r.Route("/flags", func(r chi.Router) {
+		r.Use(cli.casauth)
+		r.Get("/", api.FlagsHandler)
+		r.Put("/{name}", api.SetFlagHandler)
+	})
+
+	// Public status page endpoint
+	r.Get("/status", api.StatusHandler)
+
+	// Component health for load balancers and monitoring
+	r.Get("/health", api.HealthHandler)
+
+	return r
 }
 
 func NewConfig(v *viper.Viper) *Config {
 	cfg := &Config{
-		ListenURL:    "0.0.0.0:8080",
-		Authenticate: true,
+		ListenURL:     "0.0.0.0:8080",
+		Authenticate:  true,
+		GTFSInterval:  "10s",
+		OBAAgencyID:   "shuttletracker",
+		OBAAgencyName: "Shuttle Tracker",
+		CacheTTL:      "1m",
+		Metrics:       true,
+		AccessLog:     true,
+		Usage:         true,
+
+		StatusStaleAfter:       "5m",
+		VehicleOfflineAfter:    "5m",
+		FusionSnapshotInterval: "10s",
+		FusionHistorySize:      500,
+		WalkingSpeed:           1.2,
+		AutocertDomains:        []string{},
+		TrustedProxies:         []string{},
+		AutocertCacheDir:       "autocert",
 	}
 	v.SetDefault("api.listenurl", cfg.ListenURL)
 	v.SetDefault("api.casurl", cfg.CasURL)
 	v.SetDefault("api.authenticate", cfg.Authenticate)
+	v.SetDefault("api.gtfsinterval", cfg.GTFSInterval)
+	v.SetDefault("api.sirioperatorref", cfg.SIRIOperatorRef)
+	v.SetDefault("api.obaagencyid", cfg.OBAAgencyID)
+	v.SetDefault("api.obaagencyname", cfg.OBAAgencyName)
+	v.SetDefault("api.obaagencyurl", cfg.OBAAgencyURL)
+	v.SetDefault("api.cachettl", cfg.CacheTTL)
+	v.SetDefault("api.cacheredisurl", cfg.CacheRedisURL)
+	v.SetDefault("api.debugendpoints", cfg.DebugEndpoints)
+	v.SetDefault("api.metrics", cfg.Metrics)
+	v.SetDefault("api.accesslog", cfg.AccessLog)
+	v.SetDefault("api.usage", cfg.Usage)
+	v.SetDefault("api.statusstaleafter", cfg.StatusStaleAfter)
+	v.SetDefault("api.vehicleofflineafter", cfg.VehicleOfflineAfter)
+	v.SetDefault("api.fusionsnapshotinterval", cfg.FusionSnapshotInterval)
+	v.SetDefault("api.fusionhistorysize", cfg.FusionHistorySize)
+	v.SetDefault("api.walkingspeed", cfg.WalkingSpeed)
+	v.SetDefault("api.walkingrouterurl", cfg.WalkingRouterURL)
+	v.SetDefault("api.tlscertfile", cfg.TLSCertFile)
+	v.SetDefault("api.tlskeyfile", cfg.TLSKeyFile)
+	v.SetDefault("api.autocertdomains", cfg.AutocertDomains)
+	v.SetDefault("api.autocertemail", cfg.AutocertEmail)
+	v.SetDefault("api.autocertcachedir", cfg.AutocertCacheDir)
+	v.SetDefault("api.redirectlistenurl", cfg.RedirectListenURL)
+	v.SetDefault("api.internallistenurl", cfg.InternalListenURL)
+	v.SetDefault("api.translationsfile", cfg.TranslationsFile)
+	v.SetDefault("api.publicurl", cfg.PublicURL)
+	v.SetDefault("api.trustedproxies", cfg.TrustedProxies)
+	v.SetDefault("api.twilioauthtoken", cfg.TwilioAuthToken)
+	v.SetDefault("api.staticdir", cfg.StaticDir)
 	return cfg
 }
 
+// Run serves the API, over HTTPS if it's configured.
 func (api *API) Run() {
-	if err := http.ListenAndServe(api.cfg.ListenURL, api.handler); err != nil {
+	if err := api.listenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.WithError(err).Error("Unable to serve.")
 	}
 }
 
+// Stop stops accepting connections and waits up to shutdownTimeout for
+// requests in progress to finish. Then it saves usage and demand that
+// haven't been recorded yet. Websocket connections are left for the process to close.
+func (api *API) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if api.redirect != nil {
+		if err := api.redirect.Shutdown(ctx); err != nil {
+			log.WithError(err).Error("unable to shut down HTTPS redirects")
+		}
+	}
+	if api.internal != nil {
+		if err := api.internal.Shutdown(ctx); err != nil {
+			log.WithError(err).Error("unable to shut down internal server")
+		}
+	}
+	if err := api.server.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("unable to shut down server")
+	}
+	api.usage.flush()
+	api.demand.flush()
+}
+
 // IndexHandler serves the index page.
 func (api *API) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "static/index.html")
+	api.serveStaticFile(w, r, "index.html")
 }
 
 // AdminHandler serves the admin page.
@@ -201,7 +730,7 @@ func (api *API) AdminHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/admin", 301)
 	}
 	w.Header().Set("Cache-Control", "no-cache")
-	http.ServeFile(w, r, "static/admin.html")
+	api.serveStaticFile(w, r, "admin.html")
 }
 
 //KeyHandler sends Mapbox api key to authenticated user
@@ -223,3 +752,20 @@ func WriteJSON(w http.ResponseWriter, data interface{}) error {
 	w.Write(b)
 	return nil
 }
+
+// WriteNegotiated writes the data as Protocol Buffers if the client accepts
+// them, and as JSON otherwise. See pb/shuttletracker.proto for the schema.
+func WriteNegotiated(w http.ResponseWriter, r *http.Request, data interface{}) error {
+	w.Header().Set("Vary", "Accept")
+	if !strings.Contains(r.Header.Get("Accept"), protobufContentType) {
+		return WriteJSON(w, data)
+	}
+	b, err := pb.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("Content-Type", protobufContentType)
+	w.Write(b)
+	return nil
+}
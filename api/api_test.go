@@ -36,16 +36,24 @@ func TestStatic(t *testing.T) {
 	// Go tests are run from the package dir, but our static files are one level higher
 	os.Chdir("..")
 
-	cfg := Config{}
+	cfg := Config{GTFSInterval: "10s", CacheTTL: "1m", StatusStaleAfter: "5m", VehicleOfflineAfter: "5m", FusionSnapshotInterval: "10s", FusionHistorySize: 500}
 	ms := &mock.ModelService{}
 	msg := &mock.MessageService{}
 	us := &mock.UserService{}
 	ups := &mock.UpdaterService{}
 	em := &mock.ETAService{}
 	em.On("Subscribe", tmock.AnythingOfType("func(shuttletracker.VehicleETA)")).Return()
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{})
 	ms.LocationService.On("SubscribeLocations").Return(make(chan *shuttletracker.Location))
+	ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{}, nil)
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{}, nil)
+	fdb := &mock.FeedbackService{}
+	bs := &mock.BroadcastService{}
+	bs.On("SubscribeBroadcasts", tmock.AnythingOfType("string")).Return(make(chan string))
+	as := &mock.AlertService{}
+	as.On("Subscribe", tmock.AnythingOfType("func(*shuttletracker.Alert)")).Return()
 
-	api, err := New(cfg, ms, msg, us, ups, em)
+	api, err := New(cfg, ms, msg, us, ups, em, fdb, bs, as, &mock.UsageService{}, &mock.AnalyticsService{}, &mock.FavoriteService{}, &mock.WidgetKeyService{})
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 		return
@@ -135,3 +143,104 @@ func TestWriteJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteNegotiated(t *testing.T) {
+	vehicles := []*shuttletracker.Vehicle{{ID: 1}}
+
+	cases := map[string]string{
+		"":                                  "application/json",
+		"application/json":                  "application/json",
+		"application/x-protobuf":            "application/x-protobuf",
+		"application/x-protobuf, */*;q=0.1": "application/x-protobuf",
+	}
+	for accept, expectedType := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/vehicles", nil)
+		r.Header.Set("Accept", accept)
+		err := WriteNegotiated(w, r, vehicles)
+		if err != nil {
+			t.Errorf("got error '%s', expected nil", err)
+			continue
+		}
+
+		res := w.Result()
+		if res.Header.Get("Content-Type") != expectedType {
+			t.Errorf("Accept '%s': got Content-Type '%s', expected '%s'", accept, res.Header.Get("Content-Type"), expectedType)
+		}
+		if res.Header.Get("Vary") != "Accept" {
+			t.Errorf("Accept '%s': got Vary '%s', expected 'Accept'", accept, res.Header.Get("Vary"))
+		}
+	}
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		cfg := Config{GTFSInterval: "10s", CacheTTL: "1m", StatusStaleAfter: "5m", VehicleOfflineAfter: "5m", FusionSnapshotInterval: "10s", DebugEndpoints: enabled}
+		ms := &mock.ModelService{}
+		em := &mock.ETAService{}
+		em.On("Subscribe", tmock.AnythingOfType("func(shuttletracker.VehicleETA)")).Return()
+		em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{})
+		ms.LocationService.On("SubscribeLocations").Return(make(chan *shuttletracker.Location))
+		ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{}, nil)
+		ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{}, nil)
+		bs := &mock.BroadcastService{}
+		bs.On("SubscribeBroadcasts", tmock.AnythingOfType("string")).Return(make(chan string))
+		as := &mock.AlertService{}
+		as.On("Subscribe", tmock.AnythingOfType("func(*shuttletracker.Alert)")).Return()
+
+		api, err := New(cfg, ms, &mock.MessageService{}, &mock.UserService{}, &mock.UpdaterService{}, em, &mock.FeedbackService{}, bs, as, &mock.UsageService{}, &mock.AnalyticsService{}, &mock.FavoriteService{}, &mock.WidgetKeyService{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		w := httptest.NewRecorder()
+		api.handler.ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+		if enabled && w.Code != http.StatusOK {
+			t.Errorf("got status code %d with debug endpoints enabled, expected 200", w.Code)
+		} else if !enabled && w.Code != http.StatusNotFound {
+			t.Errorf("got status code %d with debug endpoints disabled, expected 404", w.Code)
+		}
+	}
+}
+
+func TestInternalEndpoints(t *testing.T) {
+	for _, internalListenURL := range []string{"", "127.0.0.1:8081"} {
+		cfg := Config{GTFSInterval: "10s", CacheTTL: "1m", StatusStaleAfter: "5m", VehicleOfflineAfter: "5m", FusionSnapshotInterval: "10s", Metrics: true, InternalListenURL: internalListenURL}
+		ms := &mock.ModelService{}
+		em := &mock.ETAService{}
+		em.On("Subscribe", tmock.AnythingOfType("func(shuttletracker.VehicleETA)")).Return()
+		em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{})
+		ms.LocationService.On("SubscribeLocations").Return(make(chan *shuttletracker.Location))
+		ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{}, nil)
+		ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{}, nil)
+		bs := &mock.BroadcastService{}
+		bs.On("SubscribeBroadcasts", tmock.AnythingOfType("string")).Return(make(chan string))
+		as := &mock.AlertService{}
+		as.On("Subscribe", tmock.AnythingOfType("func(*shuttletracker.Alert)")).Return()
+
+		api, err := New(cfg, ms, &mock.MessageService{}, &mock.UserService{}, &mock.UpdaterService{}, em, &mock.FeedbackService{}, bs, as, &mock.UsageService{}, &mock.AnalyticsService{}, &mock.FavoriteService{}, &mock.WidgetKeyService{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		w := httptest.NewRecorder()
+		api.handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		if internalListenURL == "" {
+			if w.Code != http.StatusOK {
+				t.Errorf("got status code %d without internal listener, expected 200", w.Code)
+			}
+			if api.internal != nil {
+				t.Error("expected no internal server")
+			}
+			continue
+		}
+		if w.Code != http.StatusNotFound {
+			t.Errorf("got status code %d on public listener, expected 404", w.Code)
+		}
+		w = httptest.NewRecorder()
+		api.internal.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("got status code %d on internal listener, expected 200", w.Code)
+		}
+	}
+}
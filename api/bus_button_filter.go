@@ -0,0 +1,172 @@
+package api
+
+import (
+	"math"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/metrics"
+)
+
+const (
+	// busButtonDedupWindow is how soon after a client's previous press that
+	// another press is ignored as a duplicate.
+	busButtonDedupWindow = 2 * time.Second
+
+	// busButtonHalfLife is how long it takes for a client's previous presses
+	// to count half as much against its next one.
+	busButtonHalfLife = time.Minute
+
+	// busButtonMaxStopDistance is how far from the nearest Stop that a press
+	// can be, in meters. Presses farther away aren't from riders.
+	busButtonMaxStopDistance = 2000.0
+
+	// busButtonStopsTTL is how long Stops are kept to check presses against.
+	busButtonStopsTTL = time.Minute
+
+	// busButtonHistoryTTL is how long a session's presses are remembered
+	// after its last one. By then, they barely count against its next one.
+	busButtonHistoryTTL = 10 * time.Minute
+)
+
+// Reasons that bus button presses are dropped.
+const (
+	busButtonDuplicate   = "duplicate"
+	busButtonImplausible = "implausible"
+	busButtonWeighted    = "weighted"
+)
+
+// busButtonHistory is what's remembered about a session's bus button presses.
+type busButtonHistory struct {
+	last      time.Time
+	latitude  float64
+	longitude float64
+
+	// presses is how many presses the client has made recently, decayed by
+	// busButtonHalfLife, and credit is how much of a press it has built up
+	// from presses that counted for less than a whole one.
+	presses float64
+	credit  float64
+}
+
+// busButtonFilter decides which bus button presses are counted and broadcast,
+// so that one person mashing the button doesn't look like a crowd. Presses are
+// remembered by session so that reconnecting doesn't forget them. Only
+// fusionManager's run uses it. A nil busButtonFilter allows every press.
+type busButtonFilter struct {
+	ss shuttletracker.StopService
+
+	stops   []*shuttletracker.Stop
+	fetched time.Time
+
+	histories map[string]*busButtonHistory
+	pruned    time.Time
+}
+
+func newBusButtonFilter(ss shuttletracker.StopService) *busButtonFilter {
+	return &busButtonFilter{ss: ss, histories: map[string]*busButtonHistory{}}
+}
+
+// allow returns whether a session's press should be counted and broadcast, and
+// if not, why. Presses soon after the session's previous one are duplicates,
+// and presses that are far from every Stop or that the rider couldn't have
+// traveled to since their previous press are implausible. Otherwise, each
+// press counts for half as much for every recent press the session made
+// before it, and the session's presses are only allowed once they add up to a
+// whole press.
+func (bf *busButtonFilter) allow(session string, fbb fusionBusButton, now time.Time) (bool, string) {
+	if bf == nil {
+		return true, ""
+	}
+	bf.prune(now)
+	h, ok := bf.histories[session]
+	if !ok {
+		h = &busButtonHistory{}
+		bf.histories[session] = h
+	}
+
+	previous := h.last
+	h.last = now
+	if !previous.IsZero() {
+		elapsed := now.Sub(previous)
+		if elapsed < busButtonDedupWindow {
+			return false, busButtonDuplicate
+		}
+		// 0, 0 means that none of the client's presses have been plausible
+		located := h.latitude != 0 || h.longitude != 0
+		if located && shuttletracker.DistanceBetween(h.latitude, h.longitude, fbb.Latitude, fbb.Longitude)/elapsed.Seconds() > maxPositionSpeed {
+			return false, busButtonImplausible
+		}
+		h.presses *= math.Pow(0.5, float64(elapsed)/float64(busButtonHalfLife))
+	}
+	if !bf.nearStop(fbb.Latitude, fbb.Longitude, now) {
+		return false, busButtonImplausible
+	}
+	// implausible positions aren't remembered so that they can't be used to
+	// make the next press look plausible
+	h.latitude, h.longitude = fbb.Latitude, fbb.Longitude
+
+	h.credit += math.Pow(0.5, math.Round(h.presses))
+	h.presses++
+	if h.credit < 1 {
+		return false, busButtonWeighted
+	}
+	h.credit--
+	return true, ""
+}
+
+// prune forgets the presses of sessions that haven't pressed the button in
+// busButtonHistoryTTL, at most once every busButtonHistoryTTL.
+func (bf *busButtonFilter) prune(now time.Time) {
+	if now.Sub(bf.pruned) < busButtonHistoryTTL {
+		return
+	}
+	for session, h := range bf.histories {
+		if now.Sub(h.last) >= busButtonHistoryTTL {
+			delete(bf.histories, session)
+		}
+	}
+	bf.pruned = now
+}
+
+// nearStop returns whether a position is within busButtonMaxStopDistance of a
+// Stop. If there are no Stops or they can't be read, every position is.
+func (bf *busButtonFilter) nearStop(latitude, longitude float64, now time.Time) bool {
+	if now.Sub(bf.fetched) > busButtonStopsTTL || now.Before(bf.fetched) {
+		stops, err := bf.ss.Stops()
+		if err != nil {
+			log.WithError(err).Error("unable to get stops for bus buttons")
+			return true
+		}
+		bf.stops = stops
+		bf.fetched = now
+	}
+	if len(bf.stops) == 0 {
+		return true
+	}
+	for _, stop := range bf.stops {
+		if shuttletracker.DistanceBetween(latitude, longitude, stop.Latitude, stop.Longitude) <= busButtonMaxStopDistance {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBusButton returns whether a client's press should be counted and
+// broadcast, counting the ones that aren't by why.
+func (fm *fusionManager) filterBusButton(clientID string, fbb fusionBusButton) bool {
+	client, ok := fm.clients[clientID]
+	if !ok {
+		return false
+	}
+	session := client.token
+	if session == "" {
+		session = client.id
+	}
+	allowed, reason := fm.busButtonFilter.allow(session, fbb, time.Now())
+	if !allowed {
+		metrics.BusButtonsDropped.WithLabelValues(reason).Inc()
+	}
+	return allowed
+}
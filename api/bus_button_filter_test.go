@@ -0,0 +1,72 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestBusButtonFilter(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{{ID: 1, Latitude: 42.73, Longitude: -73.68}}, nil)
+	bf := newBusButtonFilter(ms)
+	atStop := fusionBusButton{Latitude: 42.73, Longitude: -73.68}
+	start := time.Now()
+
+	for _, c := range []struct {
+		after   time.Duration
+		press   fusionBusButton
+		allowed bool
+		reason  string
+	}{
+		{0, atStop, true, ""},
+		{time.Second, atStop, false, busButtonDuplicate},
+		// mashing the button counts for less and less
+		{5 * time.Second, atStop, false, busButtonWeighted},
+		{10 * time.Second, atStop, false, busButtonWeighted},
+		{15 * time.Second, atStop, false, busButtonWeighted},
+		// about 90 km away five seconds later
+		{20 * time.Second, fusionBusButton{Latitude: 43.5, Longitude: -73.68}, false, busButtonImplausible},
+		// and it adds up after a while
+		{10 * time.Minute, atStop, true, ""},
+	} {
+		allowed, reason := bf.allow("a", c.press, start.Add(c.after))
+		if allowed != c.allowed || reason != c.reason {
+			t.Errorf("after %s: got %t and %q, expected %t and %q", c.after, allowed, reason, c.allowed, c.reason)
+		}
+	}
+
+	// far from every stop
+	if allowed, reason := bf.allow("b", fusionBusButton{Latitude: 40.71, Longitude: -74.0}, start); allowed || reason != busButtonImplausible {
+		t.Errorf("got %t and %q, expected a press far from every stop to be implausible", allowed, reason)
+	}
+	if allowed, reason := bf.allow("b", atStop, start.Add(time.Minute)); !allowed {
+		t.Errorf("got %t and %q, expected a plausible press after an implausible one to be allowed", allowed, reason)
+	}
+
+	// other sessions aren't affected
+	if allowed, _ := bf.allow("c", atStop, start.Add(time.Second)); !allowed {
+		t.Error("expected another client's press to be allowed")
+	}
+
+	var nilFilter *busButtonFilter
+	if allowed, _ := nilFilter.allow("a", atStop, start); !allowed {
+		t.Error("expected a nil filter to allow every press")
+	}
+}
+
+func TestBusButtonFilterPrune(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{}, nil)
+	bf := newBusButtonFilter(ms)
+	start := time.Now()
+
+	bf.allow("a", fusionBusButton{}, start)
+	bf.allow("b", fusionBusButton{}, start.Add(busButtonHistoryTTL/2))
+	bf.allow("c", fusionBusButton{}, start.Add(busButtonHistoryTTL))
+	if _, ok := bf.histories["a"]; ok || len(bf.histories) != 2 {
+		t.Errorf("got %v, expected a's presses to be forgotten", bf.histories)
+	}
+}
@@ -0,0 +1,346 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// redisKeyPrefix is prepended to the keys of all responses stored in Redis.
+const redisKeyPrefix = "shuttletracker:response:"
+
+// cacheInvalidateChannel is used to tell every instance to invalidate its cache.
+const cacheInvalidateChannel = "api.cache_invalidate"
+
+// cacheStaleFor is how long responses are kept after they expire so that they
+// can be served if the database is down.
+const cacheStaleFor = time.Hour
+
+// memoryStoreMaxEntries is how many responses a memoryStore keeps. Query
+// strings come from clients, so there's no limit to how many different
+// requests can be cached otherwise.
+const memoryStoreMaxEntries = 10000
+
+// cacheStore stores serialized responses.
+type cacheStore interface {
+	get(key string) ([]byte, bool, error)
+	set(key string, value []byte, ttl time.Duration) error
+	purge() error
+}
+
+// cachedResponse is a response that was written by a handler.
+type cachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Expires time.Time
+}
+
+func (cr *cachedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range cr.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(cr.Status)
+	_, err := w.Write(cr.Body)
+	if err != nil {
+		log.WithError(err).Error("unable to write HTTP response")
+	}
+}
+
+// writeStaleTo writes an expired response, warning the client that it's stale.
+func (cr *cachedResponse) writeStaleTo(w http.ResponseWriter) {
+	w.Header().Set("Warning", `110 - "Response is Stale"`)
+	cr.writeTo(w)
+}
+
+// responseCache caches responses from endpoints that change rarely so that a
+// burst of clients (e.g. everyone reloading after a frontend deploy) doesn't
+// turn into a burst of database queries. Responses are kept until they expire
+// or invalidate is called. Expired responses are served instead of errors
+// while the database is unhealthy.
+type responseCache struct {
+	store cacheStore
+	ttl   time.Duration
+	bs    shuttletracker.BroadcastService
+
+	// key returns what a request's response is cached under, if the
+	// request URI isn't right, e.g. because it has parameters that don't
+	// change the response. It may be nil.
+	key func(r *http.Request) string
+
+	// fills coalesces concurrent requests for the same uncached response.
+	fills singleflight.Group
+
+	// generation is incremented on invalidation so that responses generated
+	// before an invalidation aren't stored after it.
+	genLock    sync.Mutex
+	generation uint64
+}
+
+// newResponseCache creates a responseCache backed by Redis if redisURL is set,
+// or memory otherwise. Invalidations are broadcast to all instances.
+func newResponseCache(ttl time.Duration, redisURL string, bs shuttletracker.BroadcastService) (*responseCache, error) {
+	var store cacheStore = newMemoryStore()
+	if redisURL != "" {
+		opts, err := redis.ParseURL(redisURL)
+		if err != nil {
+			return nil, err
+		}
+		store = &redisStore{client: redis.NewClient(opts)}
+	}
+	rc := &responseCache{store: store, ttl: ttl, bs: bs}
+	go rc.listen(bs.SubscribeBroadcasts(cacheInvalidateChannel))
+	return rc, nil
+}
+
+func (rc *responseCache) currentGeneration() uint64 {
+	rc.genLock.Lock()
+	defer rc.genLock.Unlock()
+	return rc.generation
+}
+
+// invalidate removes all cached responses from every instance.
+func (rc *responseCache) invalidate() {
+	rc.purge()
+	err := rc.bs.Broadcast(cacheInvalidateChannel, "")
+	if err != nil {
+		log.WithError(err).Error("unable to broadcast response cache invalidation")
+	}
+}
+
+// listen purges the cache when another instance invalidates it.
+func (rc *responseCache) listen(invalidations chan string) {
+	for range invalidations {
+		rc.purge()
+	}
+}
+
+func (rc *responseCache) purge() {
+	rc.genLock.Lock()
+	rc.generation++
+	rc.genLock.Unlock()
+
+	err := rc.store.purge()
+	if err != nil {
+		log.WithError(err).Error("unable to purge response cache")
+	}
+}
+
+// middleware serves successful GET responses from the cache.
+func (rc *responseCache) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// responses are negotiated on Accept
+		key := r.URL.RequestURI()
+		if rc.key != nil {
+			key = rc.key(r)
+		}
+		if strings.Contains(r.Header.Get("Accept"), protobufContentType) {
+			key += "|pb"
+		}
+
+		var stale *cachedResponse
+		b, ok, err := rc.store.get(key)
+		if err != nil {
+			log.WithError(err).Warn("unable to get cached response")
+		} else if ok {
+			cr := &cachedResponse{}
+			err = json.Unmarshal(b, cr)
+			if err != nil {
+				log.WithError(err).Warn("unable to unmarshal cached response")
+			} else if time.Now().Before(cr.Expires) {
+				cr.writeTo(w)
+				return
+			} else {
+				stale = cr
+			}
+		}
+
+		// don't wait on a database that we know is down
+		if stale != nil && !health.Healthy(health.Database) {
+			stale.writeStaleTo(w)
+			return
+		}
+
+		v, _, _ := rc.fills.Do(key, func() (interface{}, error) {
+			gen := rc.currentGeneration()
+			rec := &cacheRecorder{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			cr := &cachedResponse{
+				Status:  rec.status,
+				Header:  rec.header,
+				Body:    rec.body.Bytes(),
+				Expires: time.Now().Add(rc.ttl),
+			}
+			if cr.Status != http.StatusOK || gen != rc.currentGeneration() {
+				return cr, nil
+			}
+
+			b, err := json.Marshal(cr)
+			if err != nil {
+				log.WithError(err).Error("unable to marshal response")
+				return cr, nil
+			}
+			err = rc.store.set(key, b, rc.ttl+cacheStaleFor)
+			if err != nil {
+				log.WithError(err).Warn("unable to cache response")
+			}
+			return cr, nil
+		})
+		cr := v.(*cachedResponse)
+		if cr.Status >= http.StatusInternalServerError && stale != nil {
+			stale.writeStaleTo(w)
+			return
+		}
+		cr.writeTo(w)
+	})
+}
+
+// invalidator invalidates the cache after each successful request. It should
+// wrap handlers that modify cached data.
+func (rc *responseCache) invalidator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.status < 400 {
+			rc.invalidate()
+		}
+	})
+}
+
+// cacheRecorder captures a response so that it can be cached and sent to
+// every request waiting on it.
+type cacheRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (cr *cacheRecorder) Header() http.Header {
+	return cr.header
+}
+
+func (cr *cacheRecorder) Write(p []byte) (int, error) {
+	return cr.body.Write(p)
+}
+
+func (cr *cacheRecorder) WriteHeader(status int) {
+	cr.status = status
+}
+
+// statusRecorder remembers the status code written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// memoryStore keeps responses in this process, up to max of them. When it's
+// full, expired responses are dropped, and then those that expire soonest.
+type memoryStore struct {
+	lock    sync.RWMutex
+	entries map[string]memoryEntry
+	max     int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: map[string]memoryEntry{}, max: memoryStoreMaxEntries}
+}
+
+func (ms *memoryStore) get(key string) ([]byte, bool, error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	entry, ok := ms.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (ms *memoryStore) set(key string, value []byte, ttl time.Duration) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	now := time.Now()
+	if _, ok := ms.entries[key]; !ok && len(ms.entries) >= ms.max {
+		ms.evict(now)
+	}
+	ms.entries[key] = memoryEntry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+// evict makes room for an entry by dropping expired ones, or the one that
+// expires soonest if none have.
+func (ms *memoryStore) evict(now time.Time) {
+	soonest := ""
+	for key, entry := range ms.entries {
+		if now.After(entry.expires) {
+			delete(ms.entries, key)
+		} else if soonest == "" || entry.expires.Before(ms.entries[soonest].expires) {
+			soonest = key
+		}
+	}
+	if len(ms.entries) >= ms.max {
+		delete(ms.entries, soonest)
+	}
+}
+
+func (ms *memoryStore) purge() error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.entries = map[string]memoryEntry{}
+	return nil
+}
+
+// redisStore keeps responses in Redis so that they can be shared by, and
+// invalidated across, multiple instances.
+type redisStore struct {
+	client *redis.Client
+}
+
+func (rs *redisStore) get(key string) ([]byte, bool, error) {
+	b, err := rs.client.Get(redisKeyPrefix + key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (rs *redisStore) set(key string, value []byte, ttl time.Duration) error {
+	return rs.client.Set(redisKeyPrefix+key, value, ttl).Err()
+}
+
+func (rs *redisStore) purge() error {
+	iter := rs.client.Scan(0, redisKeyPrefix+"*", 100).Iterator()
+	for iter.Next() {
+		err := rs.client.Del(iter.Val()).Err()
+		if err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func newTestBroadcastService() *mock.BroadcastService {
+	bs := &mock.BroadcastService{}
+	bs.On("SubscribeBroadcasts", cacheInvalidateChannel).Return(make(chan string))
+	bs.On("Broadcast", cacheInvalidateChannel, tmock.AnythingOfType("string")).Return(nil)
+	return bs
+}
+
+func TestResponseCache(t *testing.T) {
+	rc, err := newResponseCache(time.Minute, "", newTestBroadcastService())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	calls := 0
+	handler := rc.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"body"`))
+	}))
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/vehicles", nil))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := get()
+		if w.Body.String() != `"body"` {
+			t.Errorf("unexpected body %q", w.Body.String())
+		}
+		if w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected Content-Type %q", w.Header().Get("Content-Type"))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected handler to be called once, got %d", calls)
+	}
+
+	// protobuf responses are cached separately
+	req := httptest.NewRequest("GET", "/vehicles", nil)
+	req.Header.Set("Accept", protobufContentType)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if calls != 2 {
+		t.Errorf("expected handler to be called twice, got %d", calls)
+	}
+
+	edit := rc.invalidator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	edit.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/vehicles/edit", nil))
+	get()
+	if calls != 3 {
+		t.Errorf("expected handler to be called after invalidation, got %d calls", calls)
+	}
+	rc.bs.(*mock.BroadcastService).AssertCalled(t, "Broadcast", cacheInvalidateChannel, "")
+
+	// failed edits don't invalidate
+	fail := rc.invalidator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadRequest)
+	}))
+	fail.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/vehicles/edit", nil))
+	get()
+	if calls != 3 {
+		t.Errorf("expected cached response after failed edit, got %d calls", calls)
+	}
+}
+
+func TestResponseCacheErrorsNotCached(t *testing.T) {
+	rc, err := newResponseCache(time.Minute, "", newTestBroadcastService())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	calls := 0
+	handler := rc.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/stops", nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", w.Code)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected handler to be called twice, got %d", calls)
+	}
+}
+
+func TestResponseCacheServesStale(t *testing.T) {
+	defer health.Report(health.Database, nil)
+
+	rc, err := newResponseCache(time.Nanosecond, "", newTestBroadcastService())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	calls := 0
+	broken := false
+	handler := rc.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if broken {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`"body"`))
+	}))
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/routes", nil))
+		return w
+	}
+
+	get()
+	time.Sleep(time.Millisecond)
+
+	// the expired response is served when the handler fails
+	broken = true
+	w := get()
+	if w.Code != http.StatusOK || w.Body.String() != `"body"` || w.Header().Get("Warning") == "" {
+		t.Errorf("got %d %q with Warning %q, expected stale response", w.Code, w.Body.String(), w.Header().Get("Warning"))
+	}
+	if calls != 2 {
+		t.Errorf("expected handler to be called twice, got %d", calls)
+	}
+
+	// and without calling the handler while the database is down
+	health.Report(health.Database, errors.New("connection refused"))
+	w = get()
+	if w.Code != http.StatusOK || w.Body.String() != `"body"` {
+		t.Errorf("got %d %q, expected stale response", w.Code, w.Body.String())
+	}
+	if calls != 2 {
+		t.Errorf("expected handler not to be called, got %d calls", calls)
+	}
+}
+
+func TestResponseCacheRemoteInvalidation(t *testing.T) {
+	invalidations := make(chan string)
+	bs := &mock.BroadcastService{}
+	bs.On("SubscribeBroadcasts", cacheInvalidateChannel).Return(invalidations)
+	rc, err := newResponseCache(time.Minute, "", bs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = rc.store.set("/routes", []byte("{}"), time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// another instance invalidated its cache
+	invalidations <- ""
+	invalidations <- ""
+	if _, ok, _ := rc.store.get("/routes"); ok {
+		t.Error("expected response to be purged")
+	}
+}
+
+func TestMemoryStoreEvicts(t *testing.T) {
+	ms := newMemoryStore()
+	ms.max = 3
+	for _, e := range []struct {
+		key string
+		ttl time.Duration
+	}{
+		{"expired", -time.Second},
+		{"soon", time.Minute},
+		{"later", time.Hour},
+	} {
+		if err := ms.set(e.key, []byte(e.key), e.ttl); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// the expired entry makes room
+	ms.set("new", []byte("new"), time.Hour)
+	if _, ok := ms.entries["expired"]; ok || len(ms.entries) != 3 {
+		t.Errorf("got entries %v", ms.entries)
+	}
+	// then the one expiring soonest
+	ms.set("newer", []byte("newer"), time.Hour)
+	if _, ok := ms.entries["soon"]; ok || len(ms.entries) != 3 {
+		t.Errorf("got entries %v", ms.entries)
+	}
+	// replacing an entry doesn't evict another
+	ms.set("newer", []byte("newest"), time.Hour)
+	if len(ms.entries) != 3 {
+		t.Errorf("got entries %v", ms.entries)
+	}
+}
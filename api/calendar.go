@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// CalendarHandler lists every ServicePeriod, earliest first.
+func (api *API) CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	periods, err := api.ms.ServicePeriods()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get service periods")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, periods)
+}
+
+// CalendarCreateHandler creates a ServicePeriod from the JSON in the request body.
+func (api *API) CalendarCreateHandler(w http.ResponseWriter, r *http.Request) {
+	period := &shuttletracker.ServicePeriod{}
+	if err := json.NewDecoder(r.Body).Decode(period); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateServicePeriod(api.ms, period); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ms.CreateServicePeriod(period); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create service period")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, period)
+}
+
+// CalendarEditHandler replaces a ServicePeriod with the JSON in the request body.
+func (api *API) CalendarEditHandler(w http.ResponseWriter, r *http.Request) {
+	period := &shuttletracker.ServicePeriod{}
+	if err := json.NewDecoder(r.Body).Decode(period); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateServicePeriod(api.ms, period); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifyServicePeriod(period)
+	if err == shuttletracker.ErrServicePeriodNotFound {
+		http.Error(w, "Service period not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify service period")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, period)
+}
+
+// CalendarDeleteHandler deletes the ServicePeriod with the id in the query string.
+func (api *API) CalendarDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.DeleteServicePeriod(id)
+	if err == shuttletracker.ErrServicePeriodNotFound {
+		http.Error(w, "Service period not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete service period")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validateServicePeriod checks a ServicePeriod's type and dates, and that
+// only reduced-service periods list Schedules, which must exist.
+func validateServicePeriod(ms shuttletracker.ModelService, period *shuttletracker.ServicePeriod) error {
+	switch period.Type {
+	case shuttletracker.ServicePeriodSemester, shuttletracker.ServicePeriodHoliday, shuttletracker.ServicePeriodReduced:
+	default:
+		return fmt.Errorf("type must be %s, %s, or %s", shuttletracker.ServicePeriodSemester, shuttletracker.ServicePeriodHoliday, shuttletracker.ServicePeriodReduced)
+	}
+	start, err := time.Parse(shuttletracker.DateFormat, period.Start)
+	if err != nil {
+		return fmt.Errorf("start %q is not a date like \"2019-01-07\"", period.Start)
+	}
+	end, err := time.Parse(shuttletracker.DateFormat, period.End)
+	if err != nil {
+		return fmt.Errorf("end %q is not a date like \"2019-01-07\"", period.End)
+	}
+	if end.Before(start) {
+		return fmt.Errorf("end %s is before start %s", period.End, period.Start)
+	}
+
+	if period.ScheduleIDs == nil {
+		period.ScheduleIDs = []int64{}
+	}
+	if len(period.ScheduleIDs) == 0 {
+		return nil
+	}
+	if period.Type != shuttletracker.ServicePeriodReduced {
+		return fmt.Errorf("only %s periods can list schedules", shuttletracker.ServicePeriodReduced)
+	}
+	schedules, err := ms.Schedules()
+	if err != nil {
+		return err
+	}
+	exists := map[int64]bool{}
+	for _, s := range schedules {
+		exists[s.ID] = true
+	}
+	for _, id := range period.ScheduleIDs {
+		if !exists[id] {
+			return fmt.Errorf("schedule %d does not exist", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestValidateServicePeriod(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{{ID: 1}}, nil)
+
+	for _, c := range []struct {
+		period  shuttletracker.ServicePeriod
+		problem string
+	}{
+		{shuttletracker.ServicePeriod{Type: "semester", Start: "2019-01-07", End: "2019-05-01"}, ""},
+		{shuttletracker.ServicePeriod{Type: "reduced", Start: "2019-03-09", End: "2019-03-17", ScheduleIDs: []int64{1}}, ""},
+		{shuttletracker.ServicePeriod{Type: "break", Start: "2019-03-09", End: "2019-03-17"}, "type must be"},
+		{shuttletracker.ServicePeriod{Type: "holiday", Start: "3/9/2019", End: "2019-03-17"}, "start"},
+		{shuttletracker.ServicePeriod{Type: "holiday", Start: "2019-03-17", End: "2019-03-09"}, "before start"},
+		{shuttletracker.ServicePeriod{Type: "holiday", Start: "2019-03-09", End: "2019-03-09", ScheduleIDs: []int64{1}}, "only reduced"},
+		{shuttletracker.ServicePeriod{Type: "reduced", Start: "2019-03-09", End: "2019-03-17", ScheduleIDs: []int64{2}}, "schedule 2 does not exist"},
+	} {
+		err := validateServicePeriod(ms, &c.period)
+		if c.problem == "" && err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if c.problem != "" && (err == nil || !strings.Contains(err.Error(), c.problem)) {
+			t.Errorf("got %v, expected %q", err, c.problem)
+		}
+	}
+}
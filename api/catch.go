@@ -0,0 +1,144 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// catchComfortMargin is how much time riders should have to spare when they
+// get to a Stop before a shuttle does, since ETAs and walking times are only
+// estimates. Less than this is cutting it close.
+const catchComfortMargin = 2 * time.Minute
+
+const (
+	verdictGreen  = "green"
+	verdictYellow = "yellow"
+	verdictRed    = "red"
+	verdictNone   = "none"
+)
+
+// catchVerdict is whether a rider can walk to a Stop before the next shuttle
+// gets there.
+type catchVerdict struct {
+	StopID  int64  `json:"stop_id"`
+	RouteID *int64 `json:"route_id"`
+
+	// WalkingTime is how long it takes the rider to walk to the Stop, in
+	// seconds.
+	WalkingTime *float64 `json:"walking_time"`
+
+	// Realtime is false when predictions aren't available, e.g. because
+	// the data feed is down, so the verdict is based on schedules.
+	Realtime bool `json:"realtime"`
+
+	// Verdict is green if the rider can catch the next departure with time
+	// to spare, yellow if they have to hurry, red if they'll miss it, or
+	// none if there are no departures in the next 24 hours.
+	Verdict string `json:"verdict"`
+
+	// Margin is how many seconds the rider has to spare at the Stop, or
+	// how late they are if it's negative.
+	Margin    *float64           `json:"margin"`
+	Departure *upcomingDeparture `json:"departure"`
+
+	// NextCatchable is the first departure that the rider can get to in
+	// time, if they'll miss the next one.
+	NextCatchable *upcomingDeparture `json:"next_catchable,omitempty"`
+}
+
+// CatchHandler answers whether the rider, at the position in the "lat" and
+// "lng" query parameters, can walk to the Stop in time for the next departure
+// on the Route in "route_id", or on any Route if it isn't set.
+func (api *API) CatchHandler(w http.ResponseWriter, r *http.Request) {
+	latitude, longitude, located, err := parseRiderPosition(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !located {
+		http.Error(w, "lat and lng are required", http.StatusBadRequest)
+		return
+	}
+	var routeID *int64
+	if s := r.URL.Query().Get("route_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "route_id must be a route's ID", http.StatusBadRequest)
+			return
+		}
+		_, err = api.ms.Route(id)
+		if err == shuttletracker.ErrRouteNotFound {
+			http.Error(w, "Route not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("unable to get route")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		routeID = &id
+	}
+	stop, ok := api.urlStopDetails(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	departures, err := api.nextDepartures(stop.ID, now, math.MaxInt32)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get departures")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	walkingTime := api.walking.walkingTimes(r.Context(), latitude, longitude, []*shuttletracker.Stop{stop})[stop.ID]
+	result := catchVerdict{
+		StopID:      stop.ID,
+		RouteID:     routeID,
+		WalkingTime: walkingSeconds(walkingTime),
+		Realtime:    departures.Realtime,
+	}
+	candidates := []upcomingDeparture{}
+	for _, d := range departures.Departures {
+		if routeID == nil || d.RouteID == *routeID {
+			candidates = append(candidates, d)
+		}
+	}
+	judgeCatch(&result, candidates, now, walkingTime)
+	WriteJSON(w, result)
+}
+
+// judgeCatch sets the verdict on catching the first of departures, which are
+// in order, for a rider who starts walking at now and takes walkingTime to get
+// to the Stop.
+func judgeCatch(result *catchVerdict, departures []upcomingDeparture, now time.Time, walkingTime time.Duration) {
+	if len(departures) == 0 {
+		result.Verdict = verdictNone
+		return
+	}
+	arrival := now.Add(walkingTime)
+	next := departures[0]
+	margin := next.Time.Sub(arrival)
+	seconds := math.Round(margin.Seconds())
+	result.Departure = &next
+	result.Margin = &seconds
+
+	switch {
+	case margin >= catchComfortMargin:
+		result.Verdict = verdictGreen
+	case margin >= 0:
+		result.Verdict = verdictYellow
+	default:
+		result.Verdict = verdictRed
+		for _, d := range departures[1:] {
+			if !d.Time.Before(arrival) {
+				d := d
+				result.NextCatchable = &d
+				break
+			}
+		}
+	}
+}
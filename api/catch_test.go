@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestJudgeCatch(t *testing.T) {
+	now := time.Now()
+	departures := []upcomingDeparture{
+		{Type: departureRealtime, Time: now.Add(5 * time.Minute), RouteID: 1},
+		{Type: departureRealtime, Time: now.Add(15 * time.Minute), RouteID: 1},
+		{Type: departureScheduled, Time: now.Add(30 * time.Minute), RouteID: 1},
+	}
+	for _, tc := range []struct {
+		walkingTime   time.Duration
+		verdict       string
+		margin        float64
+		nextCatchable time.Duration
+	}{
+		{time.Minute, verdictGreen, 240, 0},
+		{3 * time.Minute, verdictGreen, 120, 0},
+		{4 * time.Minute, verdictYellow, 60, 0},
+		{5 * time.Minute, verdictYellow, 0, 0},
+		{10 * time.Minute, verdictRed, -300, 15 * time.Minute},
+		{20 * time.Minute, verdictRed, -900, 30 * time.Minute},
+		{time.Hour, verdictRed, -3300, 0},
+	} {
+		result := catchVerdict{}
+		judgeCatch(&result, departures, now, tc.walkingTime)
+		if result.Verdict != tc.verdict || result.Margin == nil || *result.Margin != tc.margin {
+			t.Errorf("walking %s: got %s with margin %v, expected %s with %g", tc.walkingTime, result.Verdict, result.Margin, tc.verdict, tc.margin)
+		}
+		if tc.nextCatchable == 0 && result.NextCatchable != nil {
+			t.Errorf("walking %s: got next catchable at %s", tc.walkingTime, result.NextCatchable.Time)
+		}
+		if tc.nextCatchable != 0 && (result.NextCatchable == nil || !result.NextCatchable.Time.Equal(now.Add(tc.nextCatchable))) {
+			t.Errorf("walking %s: got next catchable %v", tc.walkingTime, result.NextCatchable)
+		}
+	}
+
+	result := catchVerdict{}
+	judgeCatch(&result, nil, now, time.Minute)
+	if result.Verdict != verdictNone || result.Departure != nil {
+		t.Errorf("got %+v without departures", result)
+	}
+}
+
+func TestCatchHandler(t *testing.T) {
+	now := time.Now()
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1, Latitude: 42.73, Longitude: -73.68}, nil)
+	ms.RouteService.On("Route", int64(2)).Return(&shuttletracker.Route{ID: 2, Enabled: true}, nil)
+	ms.RouteService.On("Route", int64(3)).Return((*shuttletracker.Route)(nil), shuttletracker.ErrRouteNotFound)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: 1, Enabled: true}, {ID: 2, Enabled: true}}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		1: {VehicleID: 1, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(time.Minute)},
+		}},
+		2: {VehicleID: 2, RouteID: 2, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(20 * time.Minute)},
+		}},
+	})
+	api := API{ms: ms, etaManager: em, walking: newWalkingEstimator(1.2, "")}
+
+	get := func(query string) (int, catchVerdict) {
+		req := httptest.NewRequest("GET", "/stops/1/catch?"+query, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		w := httptest.NewRecorder()
+		api.CatchHandler(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		result := catchVerdict{}
+		if w.Code == 200 {
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("unable to decode verdict: %s", err)
+			}
+		}
+		return w.Code, result
+	}
+
+	// about 500 meters away, so a 9 minute walk
+	code, result := get("lat=42.7345&lng=-73.68")
+	if code != 200 {
+		t.Fatalf("got status code %d", code)
+	}
+	if result.Verdict != verdictRed || result.NextCatchable == nil || result.NextCatchable.RouteID != 2 {
+		t.Errorf("got %+v for any route", result)
+	}
+	if result.WalkingTime == nil || *result.WalkingTime < 8*60 || *result.WalkingTime > 10*60 {
+		t.Errorf("got walking time %v", result.WalkingTime)
+	}
+
+	if _, result := get("lat=42.7345&lng=-73.68&route_id=2"); result.Verdict != verdictGreen || result.Departure == nil || result.Departure.RouteID != 2 {
+		t.Errorf("got %+v for route 2", result)
+	}
+	if code, _ := get("lat=42.7345&lng=-73.68&route_id=3"); code != 404 {
+		t.Errorf("got status code %d for missing route", code)
+	}
+	if code, _ := get(""); code != 400 {
+		t.Errorf("got status code %d without position", code)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the load balancers and proxies whose X-Forwarded-For
+// headers are believed.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses IP addresses and CIDR ranges like "10.0.0.0/8".
+func parseTrustedProxies(proxies []string) (trustedProxies, error) {
+	tp := trustedProxies{}
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR range", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			tp = append(tp, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", p)
+		}
+		tp = append(tp, ipNet)
+	}
+	return tp, nil
+}
+
+func (tp trustedProxies) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range tp {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// address returns the IP address of the client that made a request. Requests
+// from trusted proxies are from the last address in X-Forwarded-For that
+// isn't a trusted proxy, since clients can put whatever they want before the
+// addresses that the proxies added.
+func (tp trustedProxies) address(r *http.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	if !tp.trusted(addr) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		addr = hop
+		if !tp.trusted(hop) {
+			break
+		}
+	}
+	return addr
+}
+
+type clientAddressKey struct{}
+
+// clientIP is middleware that works out the IP address of the client that
+// made each request, for clientAddress.
+func (api *API) clientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientAddressKey{}, api.proxies.address(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientAddress returns the IP address of the client that made a request.
+func clientAddress(r *http.Request) string {
+	if addr, ok := r.Context().Value(clientAddressKey{}).(string); ok {
+		return addr
+	}
+	return trustedProxies(nil).address(r)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAddress(t *testing.T) {
+	tp, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.9"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, tc := range []struct {
+		remoteAddr string
+		xff        []string
+		expected   string
+	}{
+		{"198.51.100.1:1234", nil, "198.51.100.1"},
+		// not through a trusted proxy, so X-Forwarded-For is made up
+		{"198.51.100.1:1234", []string{"1.2.3.4"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		// made up by the client before the proxy added its address
+		{"10.1.2.3:1234", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"1.2.3.4", "198.51.100.1, 192.0.2.9"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"nonsense, 198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:1234", []string{"198.51.100.1, nonsense"}, "10.1.2.3"},
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+		{"[2001:db8::1]:1234", nil, "2001:db8::1"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		for _, xff := range tc.xff {
+			req.Header.Add("X-Forwarded-For", xff)
+		}
+		if addr := tp.address(req); addr != tc.expected {
+			t.Errorf("%s with %q: got %s, expected %s", tc.remoteAddr, tc.xff, addr, tc.expected)
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "shuttles.rpi.edu", ""} {
+		if _, err := parseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -17,6 +17,6 @@ func (api *API) DataFeedHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 	_, err := w.Write(dfresp.Body)
 	if err != nil {
-		log.WithError(err).Error("unable to write")
+		log.WithContext(r.Context()).WithError(err).Error("unable to write")
 	}
 }
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// demandStopRadius is how close a bus button press must be to a Stop to count
+// as demand there, in meters.
+const demandStopRadius = 200.0
+
+// busButtonPress is where and when a bus button was pressed.
+type busButtonPress struct {
+	hour      time.Time
+	latitude  float64
+	longitude float64
+}
+
+// demandKey identifies the totals for a Stop during an hour.
+type demandKey struct {
+	hour   time.Time
+	stopID int64
+}
+
+// demandCounter counts signals that riders want to board: bus button presses,
+// ETA subscriptions, alarms, and timetable queries. Presses are only counted
+// by the instance the client is connected to, even though they're broadcast
+// to every instance. Positions are kept in memory only until they're matched
+// to the nearest Stop when they're recorded. Stop IDs sent by clients are
+// only counted if the Stop exists. A nil demandCounter counts nothing.
+type demandCounter struct {
+	ms    shuttletracker.ModelService
+	ans   shuttletracker.AnalyticsService
+	stops *knownIDs
+
+	lock    sync.Mutex
+	presses []busButtonPress
+	counts  map[demandKey]*shuttletracker.Demand
+}
+
+func newDemandCounter(ms shuttletracker.ModelService, ans shuttletracker.AnalyticsService) *demandCounter {
+	return &demandCounter{
+		ms:     ms,
+		ans:    ans,
+		stops:  newKnownStops(ms),
+		counts: map[demandKey]*shuttletracker.Demand{},
+	}
+}
+
+func (dc *demandCounter) countBusButton(fbb fusionBusButton) {
+	if dc == nil {
+		return
+	}
+	dc.lock.Lock()
+	dc.presses = append(dc.presses, busButtonPress{time.Now().Truncate(time.Hour), fbb.Latitude, fbb.Longitude})
+	dc.lock.Unlock()
+}
+
+// countETASubscription counts an ETA subscription at a Stop.
+func (dc *demandCounter) countETASubscription(stopID int64) {
+	dc.count(stopID, func(d *shuttletracker.Demand) { d.ETASubscriptions++ })
+}
+
+// countAlarm counts a rider setting an alarm for a shuttle arriving at a Stop.
+func (dc *demandCounter) countAlarm(stopID int64) {
+	dc.count(stopID, func(d *shuttletracker.Demand) { d.Alarms++ })
+}
+
+// countTimetableQuery counts a request for a Stop's timetable or next departures.
+func (dc *demandCounter) countTimetableQuery(stopID int64) {
+	dc.count(stopID, func(d *shuttletracker.Demand) { d.TimetableQueries++ })
+}
+
+// count increments the current hour's totals for a Stop.
+func (dc *demandCounter) count(stopID int64, increment func(d *shuttletracker.Demand)) {
+	if dc == nil {
+		return
+	}
+	now := time.Now()
+	if stopID != 0 && !dc.stops.exists(stopID, now) {
+		return
+	}
+	k := demandKey{now.Truncate(time.Hour), stopID}
+	dc.lock.Lock()
+	d, ok := dc.counts[k]
+	if !ok {
+		d = &shuttletracker.Demand{Hour: k.hour, StopID: k.stopID}
+		dc.counts[k] = d
+	}
+	increment(d)
+	dc.lock.Unlock()
+}
+
+// run records demand periodically.
+func (dc *demandCounter) run() {
+	ticker := time.NewTicker(usageRecordInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		dc.flush()
+	}
+}
+
+// flush records demand that has been counted so far. If it can't be
+// recorded, it's kept to try again next time.
+func (dc *demandCounter) flush() {
+	if dc == nil {
+		return
+	}
+	dc.lock.Lock()
+	presses, counts := dc.presses, dc.counts
+	dc.presses, dc.counts = nil, map[demandKey]*shuttletracker.Demand{}
+	dc.lock.Unlock()
+	if len(presses) == 0 && len(counts) == 0 {
+		return
+	}
+
+	stops, err := dc.ms.Stops()
+	if err != nil {
+		log.WithError(err).Error("unable to get stops for demand")
+		dc.lock.Lock()
+		dc.presses = append(presses, dc.presses...)
+		dc.lock.Unlock()
+		dc.restore(counts)
+		return
+	}
+	demand := demandByStop(stops, presses, counts)
+	if err := dc.ans.RecordDemand(demand); err != nil {
+		log.WithError(err).Error("unable to record demand")
+		restored := make(map[demandKey]*shuttletracker.Demand, len(demand))
+		for _, d := range demand {
+			restored[demandKey{d.Hour, d.StopID}] = d
+		}
+		dc.restore(restored)
+	}
+}
+
+// restore adds counts that couldn't be recorded back to the ones counted
+// since.
+func (dc *demandCounter) restore(counts map[demandKey]*shuttletracker.Demand) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+	for k, d := range counts {
+		c, ok := dc.counts[k]
+		if !ok {
+			dc.counts[k] = d
+			continue
+		}
+		c.BusButtonPresses += d.BusButtonPresses
+		c.ETASubscriptions += d.ETASubscriptions
+		c.Alarms += d.Alarms
+		c.TimetableQueries += d.TimetableQueries
+	}
+}
+
+// demandByStop totals bus button presses by hour and nearest Stop, and adds
+// them to the other signals already counted by hour and Stop. Counts at Stops
+// that no longer exist are dropped.
+func demandByStop(stops []*shuttletracker.Stop, presses []busButtonPress, counts map[demandKey]*shuttletracker.Demand) []*shuttletracker.Demand {
+	exists := make(map[int64]bool, len(stops))
+	for _, stop := range stops {
+		exists[stop.ID] = true
+	}
+	totals := map[demandKey]*shuttletracker.Demand{}
+	for k, d := range counts {
+		if k.stopID != 0 && !exists[k.stopID] {
+			continue
+		}
+		c := *d
+		totals[k] = &c
+	}
+	for _, p := range presses {
+		k := demandKey{p.hour, nearestStop(stops, p.latitude, p.longitude)}
+		d, ok := totals[k]
+		if !ok {
+			d = &shuttletracker.Demand{Hour: k.hour, StopID: k.stopID}
+			totals[k] = d
+		}
+		d.BusButtonPresses++
+	}
+
+	demand := make([]*shuttletracker.Demand, 0, len(totals))
+	for _, d := range totals {
+		demand = append(demand, d)
+	}
+	sort.Slice(demand, func(i, j int) bool {
+		if !demand[i].Hour.Equal(demand[j].Hour) {
+			return demand[i].Hour.Before(demand[j].Hour)
+		}
+		return demand[i].StopID < demand[j].StopID
+	})
+	return demand
+}
+
+// nearestStop returns the ID of the Stop nearest to a position, or zero if
+// none are within demandStopRadius.
+func nearestStop(stops []*shuttletracker.Stop, latitude, longitude float64) int64 {
+	var id int64
+	min := demandStopRadius
+	for _, stop := range stops {
+		if d := shuttletracker.DistanceBetween(latitude, longitude, stop.Latitude, stop.Longitude); d <= min {
+			id, min = stop.ID, d
+		}
+	}
+	return id
+}
+
+// DemandHandler returns demand for each hour and Stop in the requested range,
+// by default the last 24 hours, for service planning. Demand that hasn't been
+// recorded by every instance yet, up to five minutes' worth, isn't included.
+func (api *API) DemandHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	demand, err := api.ans.Demand(filter.Since.Truncate(time.Hour), filter.Until)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get demand")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, demand)
+}
+
+// countTimetableQueries is middleware that counts successful requests for the
+// timetable of the Stop in the URL, so that requests for Stops that don't
+// exist aren't. It belongs in front of the cache so that cached responses are
+// counted too.
+func (api *API) countTimetableQueries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.status >= 400 {
+			return
+		}
+		if id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64); err == nil {
+			api.demand.countTimetableQuery(id)
+		}
+	})
+}
+
+// stopPopularity totals the demand at a Stop over a range of hours.
+type stopPopularity struct {
+	StopID           int64   `json:"stop_id"`
+	Name             *string `json:"name"`
+	BusButtonPresses int64   `json:"bus_button_presses"`
+	ETASubscriptions int64   `json:"eta_subscriptions"`
+	Alarms           int64   `json:"alarms"`
+	TimetableQueries int64   `json:"timetable_queries"`
+	Total            int64   `json:"total"`
+}
+
+// StopPopularityHandler ranks Stops by how often riders signaled that they
+// wanted to board there in the requested range, by default the last 24 hours,
+// so that planners can see which stops deserve amenities like shelters.
+// Deleted Stops are included without a name.
+func (api *API) StopPopularityHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	demand, err := api.ans.Demand(filter.Since.Truncate(time.Hour), filter.Until)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get demand")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stops, err := api.ms.Stops()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stops")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, popularityByStop(stops, demand))
+}
+
+// popularityByStop totals demand by Stop, most popular first. Demand without
+// a Stop is left out.
+func popularityByStop(stops []*shuttletracker.Stop, demand []*shuttletracker.Demand) []*stopPopularity {
+	byID := map[int64]*stopPopularity{}
+	for _, d := range demand {
+		if d.StopID == 0 {
+			continue
+		}
+		p, ok := byID[d.StopID]
+		if !ok {
+			p = &stopPopularity{StopID: d.StopID}
+			byID[d.StopID] = p
+		}
+		p.BusButtonPresses += d.BusButtonPresses
+		p.ETASubscriptions += d.ETASubscriptions
+		p.Alarms += d.Alarms
+		p.TimetableQueries += d.TimetableQueries
+		p.Total += d.BusButtonPresses + d.ETASubscriptions + d.Alarms + d.TimetableQueries
+	}
+	for _, stop := range stops {
+		if p, ok := byID[stop.ID]; ok {
+			p.Name = stop.Name
+		}
+	}
+
+	popularity := make([]*stopPopularity, 0, len(byID))
+	for _, p := range byID {
+		popularity = append(popularity, p)
+	}
+	sort.Slice(popularity, func(i, j int) bool {
+		if popularity[i].Total != popularity[j].Total {
+			return popularity[i].Total > popularity[j].Total
+		}
+		return popularity[i].StopID < popularity[j].StopID
+	})
+	return popularity
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestDemandByStop(t *testing.T) {
+	hour := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.UTC)
+	stops := []*shuttletracker.Stop{
+		{ID: 1, Latitude: 42.7300, Longitude: -73.6800},
+		{ID: 2, Latitude: 42.7310, Longitude: -73.6800},
+	}
+	presses := []busButtonPress{
+		{hour, 42.7301, -73.6800},
+		{hour, 42.7309, -73.6800},
+		{hour, 42.7308, -73.6801},
+		{hour.Add(time.Hour), 42.7300, -73.6800},
+		// far from every stop
+		{hour, 42.8, -73.6800},
+	}
+	counts := map[demandKey]*shuttletracker.Demand{
+		{hour, 0}: {Hour: hour, ETASubscriptions: 5},
+		{hour, 1}: {Hour: hour, StopID: 1, Alarms: 2, TimetableQueries: 3},
+		// deleted stop
+		{hour, 3}: {Hour: hour, StopID: 3, Alarms: 1},
+	}
+
+	demand := demandByStop(stops, presses, counts)
+	expected := []shuttletracker.Demand{
+		{Hour: hour, StopID: 0, BusButtonPresses: 1, ETASubscriptions: 5},
+		{Hour: hour, StopID: 1, BusButtonPresses: 1, Alarms: 2, TimetableQueries: 3},
+		{Hour: hour, StopID: 2, BusButtonPresses: 2},
+		{Hour: hour.Add(time.Hour), StopID: 1, BusButtonPresses: 1},
+	}
+	if len(demand) != len(expected) {
+		t.Fatalf("got %d totals, expected %d", len(demand), len(expected))
+	}
+	for i, d := range demand {
+		if *d != expected[i] {
+			t.Errorf("got %+v, expected %+v", *d, expected[i])
+		}
+	}
+}
+
+func TestDemandCounterNil(t *testing.T) {
+	var dc *demandCounter
+	dc.countBusButton(fusionBusButton{})
+	dc.countETASubscription(1)
+	dc.countAlarm(1)
+	dc.countTimetableQuery(1)
+	dc.flush()
+}
+
+func TestDemandCounterUnknownStops(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{{ID: 1}}, nil)
+	ans := &mock.AnalyticsService{}
+	var recorded []*shuttletracker.Demand
+	ans.On("RecordDemand", tmock.Anything).Return(nil).Run(func(args tmock.Arguments) {
+		recorded = args.Get(0).([]*shuttletracker.Demand)
+	})
+	dc := newDemandCounter(ms, ans)
+
+	dc.countAlarm(1)
+	dc.countAlarm(2)
+	dc.countAlarm(9999999999)
+	if len(dc.counts) != 1 {
+		t.Errorf("got %d counts, expected 1", len(dc.counts))
+	}
+	dc.flush()
+	if len(recorded) != 1 || recorded[0].StopID != 1 || recorded[0].Alarms != 1 {
+		t.Errorf("recorded %+v", recorded)
+	}
+}
+
+func TestDemandCounterRestoresFailedFlush(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{{ID: 1}}, nil)
+	ans := &mock.AnalyticsService{}
+	ans.On("RecordDemand", tmock.Anything).Return(errors.New("database is down")).Once()
+	var recorded []*shuttletracker.Demand
+	ans.On("RecordDemand", tmock.Anything).Return(nil).Run(func(args tmock.Arguments) {
+		recorded = args.Get(0).([]*shuttletracker.Demand)
+	})
+	dc := newDemandCounter(ms, ans)
+
+	dc.countAlarm(1)
+	dc.countTimetableQuery(1)
+	dc.flush()
+	dc.countAlarm(1)
+	dc.flush()
+	if len(recorded) != 1 || recorded[0].Alarms != 2 || recorded[0].TimetableQueries != 1 {
+		t.Errorf("recorded %+v", recorded)
+	}
+}
+
+func TestCountTimetableQueries(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{{ID: 1}, {ID: 2}}, nil)
+	api := API{demand: newDemandCounter(ms, &mock.AnalyticsService{})}
+	handler := api.countTimetableQueries(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "id") == "2" {
+			http.Error(w, "Stop not found", http.StatusNotFound)
+		}
+	}))
+	for _, id := range []string{"1", "2", "x"} {
+		req := httptest.NewRequest("GET", "/stops/"+id+"/timetable", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+	}
+	if len(api.demand.counts) != 1 {
+		t.Errorf("got %+v", api.demand.counts)
+	}
+}
+
+func TestPopularityByStop(t *testing.T) {
+	hour := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.UTC)
+	union, colonie := "Union", "Colonie"
+	stops := []*shuttletracker.Stop{
+		{ID: 1, Name: &union},
+		{ID: 2, Name: &colonie},
+	}
+	demand := []*shuttletracker.Demand{
+		{Hour: hour, StopID: 0, ETASubscriptions: 50},
+		{Hour: hour, StopID: 1, BusButtonPresses: 1, TimetableQueries: 2},
+		{Hour: hour, StopID: 2, ETASubscriptions: 3, Alarms: 2},
+		{Hour: hour.Add(time.Hour), StopID: 1, Alarms: 1},
+		// deleted stop
+		{Hour: hour, StopID: 3, TimetableQueries: 4},
+	}
+
+	popularity := popularityByStop(stops, demand)
+	expected := []stopPopularity{
+		{StopID: 2, Name: &colonie, ETASubscriptions: 3, Alarms: 2, Total: 5},
+		{StopID: 1, Name: &union, BusButtonPresses: 1, Alarms: 1, TimetableQueries: 2, Total: 4},
+		{StopID: 3, TimetableQueries: 4, Total: 4},
+	}
+	if len(popularity) != len(expected) {
+		t.Fatalf("got %d stops, expected %d", len(popularity), len(expected))
+	}
+	for i, p := range popularity {
+		if *p != expected[i] {
+			t.Errorf("got %+v, expected %+v", *p, expected[i])
+		}
+	}
+}
+
+func TestCountETASubscriptions(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{{ID: 1}}, nil)
+	fm := &fusionManager{
+		serverMsg:     make(chan serverMessage, 10),
+		subscriptions: map[string][]string{},
+		sessions:      map[string]*fusionSession{},
+		replay:        newReplayLog(10),
+		stops:         newKnownStops(ms),
+		demand:        newDemandCounter(ms, &mock.AnalyticsService{}),
+	}
+	fm.handleMsgSubscribe("a", fusionMessageSubscribe{Topic: "eta"})
+	fm.handleMsgSubscribe("b", fusionMessageSubscribe{Topic: "eta", StopID: 1})
+	if len(fm.demand.counts) != 1 {
+		t.Fatalf("got %+v", fm.demand.counts)
+	}
+	for k, d := range fm.demand.counts {
+		if k.stopID != 1 || d.ETASubscriptions != 1 {
+			t.Errorf("got %+v", d)
+		}
+	}
+}
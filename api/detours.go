@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// DetoursHandler lists the Detours in effect at any time during the request's
+// time range, optionally on one Route, like the exports.
+func (api *API) DetoursHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	detours, err := api.ms.Detours(filter)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get detours")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, detours)
+}
+
+// DetoursCreateHandler creates a Detour from the JSON in the request body.
+func (api *API) DetoursCreateHandler(w http.ResponseWriter, r *http.Request) {
+	detour := &shuttletracker.Detour{}
+	if err := json.NewDecoder(r.Body).Decode(detour); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateDetour(api.ms, detour); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ms.CreateDetour(detour); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create detour")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, detour)
+}
+
+// DetoursEditHandler replaces a Detour with the JSON in the request body, e.g.
+// to end it early when the road reopens.
+func (api *API) DetoursEditHandler(w http.ResponseWriter, r *http.Request) {
+	detour := &shuttletracker.Detour{}
+	if err := json.NewDecoder(r.Body).Decode(detour); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateDetour(api.ms, detour); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifyDetour(detour)
+	if err == shuttletracker.ErrDetourNotFound {
+		http.Error(w, "Detour not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify detour")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, detour)
+}
+
+// DetoursDeleteHandler deletes the Detour with the id in the query string.
+func (api *API) DetoursDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.DeleteDetour(id)
+	if err == shuttletracker.ErrDetourNotFound {
+		http.Error(w, "Detour not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete detour")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validateDetour checks that a Detour has at least two points, that it ends
+// after it starts, that its Route exists and it leaves the Route before
+// rejoining it, and that no other Detour on its Route is in effect at the same
+// time.
+func validateDetour(ms shuttletracker.ModelService, detour *shuttletracker.Detour) error {
+	if len(detour.Points) < 2 {
+		return fmt.Errorf("a detour needs at least 2 points")
+	}
+	if detour.Start.IsZero() {
+		return fmt.Errorf("start is required")
+	}
+	if detour.End.IsZero() {
+		return fmt.Errorf("end is required")
+	}
+	if !detour.End.After(detour.Start) {
+		return fmt.Errorf("end %s is not after start %s", detour.End.Format(time.RFC3339), detour.Start.Format(time.RFC3339))
+	}
+	route, err := ms.Route(detour.RouteID)
+	if err == shuttletracker.ErrRouteNotFound {
+		return fmt.Errorf("route %d does not exist", detour.RouteID)
+	} else if err != nil {
+		return err
+	}
+	detoured := *route
+	if !detour.Apply(&detoured) {
+		return fmt.Errorf("detour must leave route %d before it rejoins it", detour.RouteID)
+	}
+
+	others, err := ms.Detours(shuttletracker.HistoryFilter{Since: detour.Start, Until: detour.End, RouteID: &detour.RouteID})
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		// A detour can start as soon as the previous one ends.
+		if other.ID == detour.ID || other.RouteID != detour.RouteID || !other.Overlaps(detour.Start, detour.End) {
+			continue
+		}
+		return fmt.Errorf("route %d has detour %d at the same time", detour.RouteID, other.ID)
+	}
+	return nil
+}
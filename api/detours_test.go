@@ -0,0 +1,85 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestValidateDetour(t *testing.T) {
+	start := time.Date(2019, time.March, 4, 8, 0, 0, 0, time.UTC)
+	at := func(days int) time.Time {
+		return start.AddDate(0, 0, days)
+	}
+	points := func(lats ...float64) []shuttletracker.Point {
+		p := []shuttletracker.Point{}
+		for _, lat := range lats {
+			p = append(p, shuttletracker.Point{Latitude: lat, Longitude: -73.0})
+		}
+		return p
+	}
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Route", int64(1)).Return(&shuttletracker.Route{ID: 1, Points: points(42.0, 42.1, 42.2, 42.3)}, nil)
+	ms.RouteService.On("Route", int64(2)).Return((*shuttletracker.Route)(nil), shuttletracker.ErrRouteNotFound)
+	ms.DetourService.On("Detours", tmock.Anything).Return([]*shuttletracker.Detour{
+		{ID: 5, RouteID: 1, Points: points(42.0, 42.1), Start: at(0), End: at(2)},
+	}, nil)
+
+	tests := []struct {
+		detour shuttletracker.Detour
+		err    string
+	}{
+		{shuttletracker.Detour{RouteID: 1, Points: points(42.1, 42.2), Start: at(2), End: at(3)}, ""},
+		{shuttletracker.Detour{ID: 5, RouteID: 1, Points: points(42.1, 42.2), Start: at(1), End: at(3)}, ""},
+		{shuttletracker.Detour{RouteID: 1, Points: points(42.1), Start: at(2), End: at(3)}, "at least 2 points"},
+		{shuttletracker.Detour{RouteID: 1, Points: points(42.1, 42.2), End: at(3)}, "start is required"},
+		{shuttletracker.Detour{RouteID: 1, Points: points(42.1, 42.2), Start: at(2)}, "end is required"},
+		{shuttletracker.Detour{RouteID: 1, Points: points(42.1, 42.2), Start: at(3), End: at(3)}, "is not after start"},
+		{shuttletracker.Detour{RouteID: 2, Points: points(42.1, 42.2), Start: at(2), End: at(3)}, "route 2 does not exist"},
+		{shuttletracker.Detour{RouteID: 1, Points: points(42.2, 42.1), Start: at(2), End: at(3)}, "must leave route 1 before it rejoins it"},
+		{shuttletracker.Detour{RouteID: 1, Points: points(42.1, 42.2), Start: at(1), End: at(3)}, "route 1 has detour 5"},
+	}
+	for _, test := range tests {
+		err := validateDetour(ms, &test.detour)
+		if test.err == "" && err != nil {
+			t.Errorf("%+v: unexpected error: %s", test.detour, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%+v: got error %v, expected %q", test.detour, err, test.err)
+		}
+	}
+}
+
+func TestDetourApply(t *testing.T) {
+	route := &shuttletracker.Route{Points: []shuttletracker.Point{
+		{Latitude: 42.0, Longitude: -73.0},
+		{Latitude: 42.1, Longitude: -73.0},
+		{Latitude: 42.2, Longitude: -73.0},
+		{Latitude: 42.3, Longitude: -73.0},
+	}}
+	detour := &shuttletracker.Detour{ID: 3, Points: []shuttletracker.Point{
+		{Latitude: 42.1001, Longitude: -73.0},
+		{Latitude: 42.15, Longitude: -73.1},
+		{Latitude: 42.1999, Longitude: -73.0},
+	}}
+	if !detour.Apply(route) {
+		t.Fatalf("unable to apply detour")
+	}
+	expected := []float64{42.0, 42.1001, 42.15, 42.1999, 42.3}
+	if len(route.Points) != len(expected) {
+		t.Fatalf("got %+v, expected latitudes %v", route.Points, expected)
+	}
+	for i, lat := range expected {
+		if route.Points[i].Latitude != lat {
+			t.Errorf("got %+v, expected latitudes %v", route.Points, expected)
+			break
+		}
+	}
+	if route.DetourID == nil || *route.DetourID != 3 {
+		t.Errorf("got detour ID %v, expected 3", route.DetourID)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// delayMaxAge is how long a Vehicle's last Deviation is reported as its
+// current delay. After that, it has probably finished its Trip.
+const delayMaxAge = 30 * time.Minute
+
+// vehicleDelay is a Vehicle's most recent Deviation from its schedule.
+type vehicleDelay struct {
+	*shuttletracker.Deviation
+
+	// Delay is in seconds, and negative when the Vehicle is early.
+	Delay float64 `json:"delay"`
+}
+
+// DelaysHandler returns how far each enabled Vehicle running a scheduled Trip
+// is behind schedule, as of the last Stop it arrived at, by Vehicle ID.
+func (api *API) DelaysHandler(w http.ResponseWriter, r *http.Request) {
+	vehicles, err := api.ms.EnabledVehicles()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get enabled vehicles")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	enabled := map[int64]bool{}
+	for _, vehicle := range vehicles {
+		enabled[vehicle.ID] = true
+	}
+
+	now := time.Now()
+	filter := shuttletracker.HistoryFilter{Since: now.Add(-delayMaxAge), Until: now}
+	delays := map[int64]vehicleDelay{}
+	err = api.ms.ExportDeviations(filter, func(d *shuttletracker.Deviation) error {
+		if enabled[d.VehicleID] {
+			delays[d.VehicleID] = vehicleDelay{d, d.Delay().Seconds()}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get deviations")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = WriteJSON(w, delays)
+	if err != nil {
+		return
+	}
+}
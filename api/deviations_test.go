@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestDelaysHandler(t *testing.T) {
+	now := time.Now()
+	ms := &mock.ModelService{}
+	ms.DeviationService.On("ExportDeviations", tmock.Anything).Return([]*shuttletracker.Deviation{
+		{ID: 1, VehicleID: 4, StopID: 1, Scheduled: now.Add(-20 * time.Minute), Actual: now.Add(-18 * time.Minute)},
+		{ID: 2, VehicleID: 5, StopID: 1, Scheduled: now.Add(-10 * time.Minute), Actual: now.Add(-11 * time.Minute)},
+		{ID: 3, VehicleID: 4, StopID: 2, Scheduled: now.Add(-10 * time.Minute), Actual: now.Add(-4 * time.Minute)},
+		{ID: 4, VehicleID: 6, StopID: 2, Scheduled: now.Add(-10 * time.Minute), Actual: now.Add(-9 * time.Minute)},
+	}, nil)
+	// vehicle 6 has been disabled
+	ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{{ID: 4}, {ID: 5}}, nil)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/eta/delays", nil)
+	if err != nil {
+		t.Fatalf("unable to create HTTP request: %s", err)
+	}
+	api.DelaysHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+
+	var delays map[int64]struct {
+		ID    int64   `json:"id"`
+		Delay float64 `json:"delay"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &delays); err != nil {
+		t.Fatalf("unable to decode delays: %s", err)
+	}
+	if len(delays) != 2 || delays[4].ID != 3 || delays[4].Delay != 360 || delays[5].Delay != -60 {
+		t.Errorf("got %+v, expected vehicle 4 six minutes late and vehicle 5 a minute early", delays)
+	}
+	if _, ok := delays[6]; ok {
+		t.Error("expected disabled vehicle 6 to be left out")
+	}
+
+	filter := ms.DeviationService.Calls[0].Arguments.Get(0).(shuttletracker.HistoryFilter)
+	if filter.Until.Sub(filter.Since) != delayMaxAge {
+		t.Errorf("got filter %+v, expected the last %s", filter, delayMaxAge)
+	}
+}
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// draftPublishInterval is how often Drafts are checked to see whether it's
+// time to publish them.
+const draftPublishInterval = time.Minute
+
+// DraftsHandler lists every Draft.
+func (api *API) DraftsHandler(w http.ResponseWriter, r *http.Request) {
+	drafts, err := api.ms.Drafts()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get drafts")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, drafts)
+}
+
+// DraftsCreateHandler creates a Draft from the JSON in the request body.
+func (api *API) DraftsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	draft := &shuttletracker.Draft{}
+	if err := json.NewDecoder(r.Body).Decode(draft); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateDraft(api.ms, draft); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ms.CreateDraft(draft); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create draft")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, draft)
+}
+
+// DraftsEditHandler replaces an unpublished Draft with the JSON in the
+// request body.
+func (api *API) DraftsEditHandler(w http.ResponseWriter, r *http.Request) {
+	draft := &shuttletracker.Draft{}
+	if err := json.NewDecoder(r.Body).Decode(draft); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateDraft(api.ms, draft); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifyDraft(draft)
+	if err == shuttletracker.ErrDraftNotFound {
+		http.Error(w, "Draft not found", http.StatusNotFound)
+		return
+	} else if err == shuttletracker.ErrDraftPublished {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify draft")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, draft)
+}
+
+// DraftsDeleteHandler deletes the Draft with the id in the query string.
+func (api *API) DraftsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.DeleteDraft(id)
+	if err == shuttletracker.ErrDraftNotFound {
+		http.Error(w, "Draft not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete draft")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// DraftsPublishHandler publishes the Draft with the id in the query string
+// now. The Draft is checked again first, since Routes and Schedules may have
+// changed since it was saved.
+func (api *API) DraftsPublishHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	draft, err := api.ms.Draft(id)
+	if err == shuttletracker.ErrDraftNotFound {
+		http.Error(w, "Draft not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get draft")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err = validateDraft(api.ms, draft); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.PublishDraft(id)
+	if err == shuttletracker.ErrDraftPublished {
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to publish draft")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// draftDiff describes one of a Draft's changes by what it will replace.
+type draftDiff struct {
+	Action string `json:"action"`
+	Type   string `json:"type"`
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+
+	// Before is the current Route or Schedule, and After is what it will
+	// be once the Draft is published. Before is nil for creations and After
+	// is nil for deletions.
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+
+	// Fields lists the fields of a modified Route or Schedule that change.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// DraftDiffHandler previews how the Draft with the id in the query string
+// will change Routes and Schedules.
+func (api *API) DraftDiffHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	draft, err := api.ms.Draft(id)
+	if err == shuttletracker.ErrDraftNotFound {
+		http.Error(w, "Draft not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get draft")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	routes, err := api.ms.Routes()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	schedules, err := api.ms.Schedules()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get schedules")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, diffDraft(draft, routes, schedules))
+}
+
+func diffDraft(draft *shuttletracker.Draft, routes []*shuttletracker.Route, schedules []*shuttletracker.Schedule) []draftDiff {
+	routesByID := map[int64]*shuttletracker.Route{}
+	for _, route := range routes {
+		routesByID[route.ID] = route
+	}
+	schedulesByID := map[int64]*shuttletracker.Schedule{}
+	for _, s := range schedules {
+		schedulesByID[s.ID] = s
+	}
+
+	diffs := []draftDiff{}
+	for _, c := range draft.Changes {
+		d := draftDiff{Action: c.Action}
+		var before, after interface{}
+		if c.Route != nil {
+			d.Type, d.ID, d.Name = "route", c.Route.ID, c.Route.Name
+			after = c.Route
+			if current, ok := routesByID[c.Route.ID]; ok {
+				before = current
+				if c.Action == shuttletracker.DraftDelete {
+					d.Name = current.Name
+				}
+			}
+		} else {
+			d.Type, d.ID, d.Name = "schedule", c.Schedule.ID, c.Schedule.Name
+			after = c.Schedule
+			if current, ok := schedulesByID[c.Schedule.ID]; ok {
+				before = current
+				if c.Action == shuttletracker.DraftDelete {
+					d.Name = current.Name
+				}
+			}
+		}
+		switch c.Action {
+		case shuttletracker.DraftCreate:
+			d.After = after
+		case shuttletracker.DraftModify:
+			d.Before, d.After = before, after
+			d.Fields = changedFields(before, after)
+		case shuttletracker.DraftDelete:
+			d.Before = before
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// changedFields returns the JSON fields that differ between before and after,
+// other than IDs and those that are maintained automatically.
+func changedFields(before, after interface{}) []string {
+	fields := func(v interface{}) map[string]interface{} {
+		m := map[string]interface{}{}
+		b, err := json.Marshal(v)
+		if err == nil {
+			err = json.Unmarshal(b, &m)
+		}
+		if err != nil {
+			log.WithError(err).Error("unable to compare draft change")
+		}
+		return m
+	}
+	b, a := fields(before), fields(after)
+	keys := []string{}
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	changed := []string{}
+	for _, key := range keys {
+		switch key {
+		case "id", "active", "created", "updated":
+			continue
+		}
+		if !reflect.DeepEqual(b[key], a[key]) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
+// validateDraft checks each of a Draft's changes against the Routes,
+// Schedules, and Stops as they'll be after the changes before it, so that
+// a Draft can create a Route and a Schedule for it.
+func validateDraft(ms shuttletracker.ModelService, draft *shuttletracker.Draft) error {
+	if draft.Changes == nil {
+		draft.Changes = []*shuttletracker.DraftChange{}
+	}
+	routes, err := ms.Routes()
+	if err != nil {
+		return err
+	}
+	stops, err := ms.Stops()
+	if err != nil {
+		return err
+	}
+	schedules, err := ms.Schedules()
+	if err != nil {
+		return err
+	}
+	stopExists := map[int64]bool{}
+	for _, stop := range stops {
+		stopExists[stop.ID] = true
+	}
+	scheduleExists := map[int64]bool{}
+	for _, s := range schedules {
+		scheduleExists[s.ID] = true
+	}
+	view := draftModel{ModelService: ms}
+	for _, route := range routes {
+		view.routes = append(view.routes, route)
+	}
+
+	for i, c := range draft.Changes {
+		if err := validateDraftChange(c, &view, stopExists, scheduleExists); err != nil {
+			return fmt.Errorf("change %d: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateDraftChange(c *shuttletracker.DraftChange, view *draftModel, stopExists, scheduleExists map[int64]bool) error {
+	switch c.Action {
+	case shuttletracker.DraftCreate, shuttletracker.DraftModify, shuttletracker.DraftDelete:
+	default:
+		return fmt.Errorf("action must be %s, %s, or %s", shuttletracker.DraftCreate, shuttletracker.DraftModify, shuttletracker.DraftDelete)
+	}
+	if (c.Route == nil) == (c.Schedule == nil) {
+		return fmt.Errorf("exactly one of route and schedule is required")
+	}
+
+	if c.Schedule != nil {
+		s := c.Schedule
+		if c.Action != shuttletracker.DraftCreate && !scheduleExists[s.ID] {
+			return fmt.Errorf("schedule %d does not exist", s.ID)
+		}
+		if c.Action == shuttletracker.DraftDelete {
+			delete(scheduleExists, s.ID)
+			return nil
+		}
+		return validateSchedule(view, s)
+	}
+
+	route := c.Route
+	i := view.route(route.ID)
+	switch c.Action {
+	case shuttletracker.DraftCreate:
+		if route.ID > 0 || route.ID < 0 && i >= 0 {
+			return fmt.Errorf("new routes' IDs must be 0 or a unique negative number")
+		}
+	case shuttletracker.DraftModify, shuttletracker.DraftDelete:
+		if route.ID <= 0 || i < 0 {
+			return fmt.Errorf("route %d does not exist", route.ID)
+		}
+	}
+	if c.Action == shuttletracker.DraftDelete {
+		view.routes = append(view.routes[:i], view.routes[i+1:]...)
+		return nil
+	}
+	if route.Name == "" {
+		return fmt.Errorf("route name is required")
+	}
+	for _, stopID := range route.StopIDs {
+		if !stopExists[stopID] {
+			return fmt.Errorf("stop %d does not exist", stopID)
+		}
+	}
+	// Only new Routes with placeholder IDs can have Schedules in the Draft.
+	if c.Action == shuttletracker.DraftCreate && route.ID < 0 {
+		view.routes = append(view.routes, route)
+	} else if c.Action == shuttletracker.DraftModify {
+		view.routes[i] = route
+	}
+	return nil
+}
+
+// draftModel shows the Routes as they'll be once some of a Draft's changes
+// are made.
+type draftModel struct {
+	shuttletracker.ModelService
+	routes []*shuttletracker.Route
+}
+
+func (dm *draftModel) Routes() ([]*shuttletracker.Route, error) {
+	return dm.routes, nil
+}
+
+func (dm *draftModel) RoutesContext(ctx context.Context) ([]*shuttletracker.Route, error) {
+	return dm.routes, nil
+}
+
+// route returns the index of the Route with the ID, or -1.
+func (dm *draftModel) route(id int64) int {
+	for i, route := range dm.routes {
+		if route.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// publishDrafts publishes Drafts when their time comes. Every instance checks,
+// but publishing locks the Draft so that only one of them succeeds.
+func (api *API) publishDrafts() {
+	ticker := time.NewTicker(draftPublishInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		api.publishDueDrafts(time.Now())
+	}
+}
+
+func (api *API) publishDueDrafts(now time.Time) {
+	drafts, err := api.ms.Drafts()
+	if err != nil {
+		log.WithError(err).Error("unable to get drafts")
+		return
+	}
+	for _, draft := range drafts {
+		if draft.Published != nil || draft.PublishAt == nil || draft.PublishAt.After(now) {
+			continue
+		}
+		if err = validateDraft(api.ms, draft); err != nil {
+			log.WithError(err).WithField("draft", draft.ID).Error("unable to publish draft")
+			continue
+		}
+		err = api.ms.PublishDraft(draft.ID)
+		if err == shuttletracker.ErrDraftPublished {
+			continue
+		} else if err != nil {
+			log.WithError(err).WithField("draft", draft.ID).Error("unable to publish draft")
+			continue
+		}
+		log.WithField("draft", draft.ID).Infof("Published draft %q.", draft.Name)
+		api.cache.invalidate()
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func draftModelService() *mock.ModelService {
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: 1, Name: "East", StopIDs: []int64{2, 3}}}, nil)
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{{ID: 2}, {ID: 3}}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{{ID: 4, RouteID: 1, Name: "Weekday"}}, nil)
+	return ms
+}
+
+func TestValidateDraft(t *testing.T) {
+	ms := draftModelService()
+	at := func(minutes int) shuttletracker.TimeOfDay {
+		return shuttletracker.TimeOfDay(time.Duration(minutes) * time.Minute)
+	}
+	schedule := func(id, routeID int64) *shuttletracker.Schedule {
+		return &shuttletracker.Schedule{ID: id, RouteID: routeID, Days: []time.Weekday{time.Monday}, Trips: []*shuttletracker.Trip{
+			{StopTimes: []shuttletracker.StopTime{{StopID: 2, Arrival: at(480), Departure: at(480)}, {StopID: 3, Arrival: at(490), Departure: at(490)}}},
+		}}
+	}
+	newRoute := &shuttletracker.Route{ID: -1, Name: "West", StopIDs: []int64{2, 3}}
+
+	tests := []struct {
+		changes []*shuttletracker.DraftChange
+		err     string
+	}{
+		{[]*shuttletracker.DraftChange{
+			{Action: "create", Route: newRoute},
+			{Action: "create", Schedule: schedule(0, -1)},
+			{Action: "modify", Schedule: schedule(4, 1)},
+		}, ""},
+		{[]*shuttletracker.DraftChange{{Action: "delete", Schedule: &shuttletracker.Schedule{ID: 4}}}, ""},
+		{[]*shuttletracker.DraftChange{{Action: "rename", Route: newRoute}}, "change 1: action must be"},
+		{[]*shuttletracker.DraftChange{{Action: "create", Route: newRoute, Schedule: schedule(0, -1)}}, "exactly one of route and schedule"},
+		{[]*shuttletracker.DraftChange{{Action: "create", Schedule: schedule(0, -1)}}, "change 1: route -1 does not exist"},
+		{[]*shuttletracker.DraftChange{{Action: "modify", Schedule: schedule(5, 1)}}, "schedule 5 does not exist"},
+		{[]*shuttletracker.DraftChange{{Action: "modify", Route: &shuttletracker.Route{ID: 7, Name: "North"}}}, "route 7 does not exist"},
+		{[]*shuttletracker.DraftChange{{Action: "create", Route: &shuttletracker.Route{Name: "North", StopIDs: []int64{9}}}}, "stop 9 does not exist"},
+		{[]*shuttletracker.DraftChange{{Action: "create", Route: &shuttletracker.Route{ID: 8, Name: "North"}}}, "unique negative number"},
+		{[]*shuttletracker.DraftChange{
+			{Action: "create", Route: newRoute},
+			{Action: "create", Route: newRoute},
+		}, "change 2: new routes' IDs"},
+		{[]*shuttletracker.DraftChange{
+			{Action: "delete", Route: &shuttletracker.Route{ID: 1}},
+			{Action: "modify", Schedule: schedule(4, 1)},
+		}, "change 2: route 1 does not exist"},
+		{[]*shuttletracker.DraftChange{
+			{Action: "modify", Route: &shuttletracker.Route{ID: 1, Name: "East", StopIDs: []int64{2}}},
+			{Action: "modify", Schedule: schedule(4, 1)},
+		}, "change 2: trip 1: stop 3 is not on route 1"},
+	}
+	for i, test := range tests {
+		err := validateDraft(ms, &shuttletracker.Draft{Changes: test.changes})
+		if test.err == "" && err != nil {
+			t.Errorf("test %d: unexpected error: %s", i, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("test %d: got error %v, expected %q", i, err, test.err)
+		}
+	}
+}
+
+func TestDiffDraft(t *testing.T) {
+	routes := []*shuttletracker.Route{{ID: 1, Name: "East", Color: "#ff0000", StopIDs: []int64{2, 3}, Active: true}}
+	schedules := []*shuttletracker.Schedule{{ID: 4, RouteID: 1, Name: "Weekday"}}
+	draft := &shuttletracker.Draft{Changes: []*shuttletracker.DraftChange{
+		{Action: "modify", Route: &shuttletracker.Route{ID: 1, Name: "East", Color: "#00ff00", StopIDs: []int64{3, 2}}},
+		{Action: "delete", Schedule: &shuttletracker.Schedule{ID: 4}},
+		{Action: "create", Route: &shuttletracker.Route{ID: -1, Name: "West"}},
+	}}
+
+	diffs := diffDraft(draft, routes, schedules)
+	if len(diffs) != 3 {
+		t.Fatalf("got %d diffs, expected 3", len(diffs))
+	}
+	if !reflect.DeepEqual(diffs[0].Fields, []string{"color", "stop_ids"}) || diffs[0].Before != routes[0] {
+		t.Errorf("got %+v, expected color and stop_ids to change", diffs[0])
+	}
+	if diffs[1].Type != "schedule" || diffs[1].Name != "Weekday" || diffs[1].Before != schedules[0] || diffs[1].After != nil {
+		t.Errorf("got %+v, expected to delete the weekday schedule", diffs[1])
+	}
+	if diffs[2].Before != nil || diffs[2].After != draft.Changes[2].Route {
+		t.Errorf("got %+v, expected to create a route", diffs[2])
+	}
+}
+
+func TestPublishDueDrafts(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	ms := draftModelService()
+	ms.DraftService.On("Drafts").Return([]*shuttletracker.Draft{
+		{ID: 1, PublishAt: &past},
+		{ID: 2, PublishAt: &future},
+		{ID: 3},
+		{ID: 4, PublishAt: &past, Published: &past},
+		{ID: 5, PublishAt: &past, Changes: []*shuttletracker.DraftChange{{Action: "delete", Route: &shuttletracker.Route{ID: 9}}}},
+	}, nil)
+	ms.DraftService.On("PublishDraft", int64(1)).Return(nil)
+	rc, err := newResponseCache(time.Minute, "", newTestBroadcastService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := API{ms: ms, cache: rc}
+
+	api.publishDueDrafts(now)
+	ms.DraftService.AssertNumberOfCalls(t, "PublishDraft", 1)
+	ms.DraftService.AssertCalled(t, "PublishDraft", int64(1))
+}
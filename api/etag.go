@@ -19,12 +19,31 @@ type etagResponseWriter struct {
 	buf  bytes.Buffer
 	hash hash.Hash
 	w    io.Writer
+
+	// streaming is set once the handler flushes. After that, writes go
+	// straight to the client and the response doesn't get an ETag.
+	streaming bool
 }
 
 func (e *etagResponseWriter) Write(p []byte) (int, error) {
 	return e.w.Write(p)
 }
 
+// Flush stops buffering so that streamed responses don't have to fit in memory.
+func (e *etagResponseWriter) Flush() {
+	if !e.streaming {
+		e.streaming = true
+		e.w = e.ResponseWriter
+		_, err := e.buf.WriteTo(e.ResponseWriter)
+		if err != nil {
+			log.WithError(err).Error("unable to write HTTP response")
+		}
+	}
+	if f, ok := e.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (e *etagResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if w, ok := e.ResponseWriter.(http.Hijacker); ok {
 		return w.Hijack()
@@ -42,6 +61,9 @@ func etag(next http.Handler) http.Handler {
 		ew.w = io.MultiWriter(&ew.buf, ew.hash)
 
 		next.ServeHTTP(ew, r)
+		if ew.streaming {
+			return
+		}
 
 		sum := fmt.Sprintf("%x", ew.hash.Sum(nil))
 		w.Header().Set("ETag", sum)
@@ -84,3 +84,23 @@ func TestETag(t *testing.T) {
 		}
 	}
 }
+
+func TestETagStreaming(t *testing.T) {
+	handler := etag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(" second"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !w.Flushed {
+		t.Error("expected response to be flushed")
+	}
+	if w.Header().Get("ETag") != "" {
+		t.Errorf("expected no ETag on streamed response, got %q", w.Header().Get("ETag"))
+	}
+	if w.Body.String() != "first second" {
+		t.Errorf("got body %q, expected %q", w.Body.String(), "first second")
+	}
+}
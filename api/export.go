@@ -0,0 +1,286 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/export"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// defaultExportRange is how far back exports go if no start time is given.
+const defaultExportRange = time.Hour * 24
+
+// flushEvery is how many rows are written between flushes to the client.
+const flushEvery = 1000
+
+const ndjsonContentType = "application/x-ndjson"
+
+// parseHistoryFilter reads an export's time range and entity filters from the
+// query string. "since" and "until" are RFC 3339 times; "vehicle_id",
+// "route_id", "stop_id", and "group_id" are optional.
+func parseHistoryFilter(r *http.Request) (shuttletracker.HistoryFilter, error) {
+	q := r.URL.Query()
+	filter := shuttletracker.HistoryFilter{
+		Until: time.Now(),
+	}
+
+	var err error
+	if s := q.Get("until"); s != "" {
+		filter.Until, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return filter, err
+		}
+	}
+	filter.Since = filter.Until.Add(-defaultExportRange)
+	if s := q.Get("since"); s != "" {
+		filter.Since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	ids := map[string]**int64{
+		"vehicle_id": &filter.VehicleID,
+		"route_id":   &filter.RouteID,
+		"stop_id":    &filter.StopID,
+		"group_id":   &filter.GroupID,
+	}
+	for param, dest := range ids {
+		s := q.Get(param)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return filter, err
+		}
+		*dest = &id
+	}
+	return filter, nil
+}
+
+// streamer periodically flushes a response that is written row by row and
+// notices when the client goes away.
+type streamer struct {
+	ctx   context.Context
+	flush func()
+	rows  int
+}
+
+// newStreamer creates a streamer. buffered is called before each flush to
+// write out anything buffered between the handler and w.
+func newStreamer(w http.ResponseWriter, r *http.Request, buffered func()) *streamer {
+	s := &streamer{ctx: r.Context(), flush: buffered}
+	if f, ok := w.(http.Flusher); ok {
+		s.flush = func() {
+			buffered()
+			f.Flush()
+		}
+	}
+	return s
+}
+
+// row should be called after each row is written. It returns an error if the
+// client has disconnected, which should stop the export.
+func (s *streamer) row() error {
+	s.rows++
+	if s.rows%flushEvery == 0 {
+		s.flush()
+	}
+	return s.ctx.Err()
+}
+
+// logExportError logs an error that happened after headers were sent, since
+// that's all we can do.
+func logExportError(err error, name string) {
+	if err == context.Canceled {
+		log.Debugf("client disconnected during %s export", name)
+		return
+	}
+	log.WithError(err).Errorf("unable to export %s", name)
+}
+
+func setExportHeaders(w http.ResponseWriter, name, ext, contentType string, filter shuttletracker.HistoryFilter) {
+	filename := fmt.Sprintf("%s-%s-%s.%s", name, filter.Since.Format("20060102T150405"), filter.Until.Format("20060102T150405"), ext)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+// exportCSV streams a CSV file to the client. export should call write with
+// each row; rows are flushed as they are written so that large exports don't
+// need to fit in memory.
+func exportCSV(w http.ResponseWriter, r *http.Request, name string, header []string, export func(filter shuttletracker.HistoryFilter, write func([]string) error) error) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	setExportHeaders(w, name, "csv", "text/csv", filter)
+
+	cw := csv.NewWriter(w)
+	err = cw.Write(header)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Errorf("unable to write %s export", name)
+		return
+	}
+
+	s := newStreamer(w, r, cw.Flush)
+	err = export(filter, func(row []string) error {
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+		if err := s.row(); err != nil {
+			return err
+		}
+		return cw.Error()
+	})
+	cw.Flush()
+	if err != nil {
+		logExportError(err, name)
+	}
+}
+
+// streamNDJSON streams newline-delimited JSON to the client, one value per
+// line, as export calls write.
+func streamNDJSON(w http.ResponseWriter, r *http.Request, name string, export func(write func(interface{}) error) error) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", ndjsonContentType)
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	s := newStreamer(w, r, func() {
+		bw.Flush()
+	})
+	err := export(func(v interface{}) error {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return s.row()
+	})
+	if flushErr := bw.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		logExportError(err, name)
+	}
+}
+
+// exportNDJSON streams history matching the request's filter as NDJSON.
+func exportNDJSON(w http.ResponseWriter, r *http.Request, name string, export func(filter shuttletracker.HistoryFilter, write func(interface{}) error) error) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	setExportHeaders(w, name, "ndjson", ndjsonContentType, filter)
+
+	streamNDJSON(w, r, name, func(write func(interface{}) error) error {
+		return export(filter, write)
+	})
+}
+
+func formatOptionalID(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatInt(*id, 10)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// parseFloat parses a number from a query string. Unlike strconv.ParseFloat,
+// it doesn't accept NaN or infinity, which would get past range checks.
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", s)
+	}
+	return f, nil
+}
+
+// LocationsExportHandler streams Locations as CSV.
+func (api *API) LocationsExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportCSV(w, r, "locations", export.LocationHeader, func(filter shuttletracker.HistoryFilter, write func([]string) error) error {
+		return api.ms.ExportLocations(filter, func(l *shuttletracker.Location) error {
+			return write(export.LocationRecord(l))
+		})
+	})
+}
+
+// ArrivalsExportHandler streams Arrivals as CSV.
+func (api *API) ArrivalsExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportCSV(w, r, "arrivals", export.ArrivalHeader, func(filter shuttletracker.HistoryFilter, write func([]string) error) error {
+		return api.ms.ExportArrivals(filter, func(a *shuttletracker.Arrival) error {
+			return write(export.ArrivalRecord(a))
+		})
+	})
+}
+
+// ETARecordsExportHandler streams ETARecords as CSV.
+func (api *API) ETARecordsExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportCSV(w, r, "etas", export.ETAHeader, func(filter shuttletracker.HistoryFilter, write func([]string) error) error {
+		return api.ms.ExportETARecords(filter, func(e *shuttletracker.ETARecord) error {
+			return write(export.ETARecord(e))
+		})
+	})
+}
+
+// DeviationsExportHandler streams Deviations as CSV. Delays are in seconds.
+func (api *API) DeviationsExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportCSV(w, r, "deviations", export.DeviationHeader, func(filter shuttletracker.HistoryFilter, write func([]string) error) error {
+		return api.ms.ExportDeviations(filter, func(d *shuttletracker.Deviation) error {
+			return write(export.DeviationRecord(d))
+		})
+	})
+}
+
+// LocationsNDJSONExportHandler streams Locations as NDJSON.
+func (api *API) LocationsNDJSONExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportNDJSON(w, r, "locations", func(filter shuttletracker.HistoryFilter, write func(interface{}) error) error {
+		return api.ms.ExportLocations(filter, func(l *shuttletracker.Location) error {
+			return write(l)
+		})
+	})
+}
+
+// ArrivalsNDJSONExportHandler streams Arrivals as NDJSON.
+func (api *API) ArrivalsNDJSONExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportNDJSON(w, r, "arrivals", func(filter shuttletracker.HistoryFilter, write func(interface{}) error) error {
+		return api.ms.ExportArrivals(filter, func(a *shuttletracker.Arrival) error {
+			return write(a)
+		})
+	})
+}
+
+// ETARecordsNDJSONExportHandler streams ETARecords as NDJSON.
+func (api *API) ETARecordsNDJSONExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportNDJSON(w, r, "etas", func(filter shuttletracker.HistoryFilter, write func(interface{}) error) error {
+		return api.ms.ExportETARecords(filter, func(e *shuttletracker.ETARecord) error {
+			return write(e)
+		})
+	})
+}
+
+// DeviationsNDJSONExportHandler streams Deviations as NDJSON.
+func (api *API) DeviationsNDJSONExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportNDJSON(w, r, "deviations", func(filter shuttletracker.HistoryFilter, write func(interface{}) error) error {
+		return api.ms.ExportDeviations(filter, func(d *shuttletracker.Deviation) error {
+			return write(d)
+		})
+	})
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestArrivalsExportHandler(t *testing.T) {
+	since := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.UTC)
+	until := time.Date(2019, time.March, 2, 8, 0, 0, 0, time.UTC)
+	stopID := int64(3)
+	filter := shuttletracker.HistoryFilter{
+		Since:  since,
+		Until:  until,
+		StopID: &stopID,
+	}
+
+	ms := &mock.ModelService{}
+	ms.ArrivalService.On("ExportArrivals", filter).Return([]*shuttletracker.Arrival{
+		{ID: 1, VehicleID: 4, RouteID: 2, StopID: 3, Time: since.Add(time.Hour)},
+	}, nil)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/export/arrivals.csv?since=2019-03-01T08:00:00Z&until=2019-03-02T08:00:00Z&stop_id=3", nil)
+	if err != nil {
+		t.Fatalf("unable to create HTTP request: %s", err)
+	}
+	api.ArrivalsExportHandler(w, req)
+	resp := w.Result()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("got status code %d, expected 200", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Type") != "text/csv" {
+		t.Errorf("got Content-Type %q, expected \"text/csv\"", resp.Header.Get("Content-Type"))
+	}
+	expectedDisposition := `attachment; filename="arrivals-20190301T080000-20190302T080000.csv"`
+	if resp.Header.Get("Content-Disposition") != expectedDisposition {
+		t.Errorf("got Content-Disposition %q, expected %q", resp.Header.Get("Content-Disposition"), expectedDisposition)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	expected := "id,vehicle_id,route_id,stop_id,time\n1,4,2,3,2019-03-01T09:00:00Z\n"
+	if string(body) != expected {
+		t.Errorf("got body %q, expected %q", body, expected)
+	}
+	ms.ArrivalService.AssertExpectations(t)
+}
+
+func TestExportHandlerBadFilter(t *testing.T) {
+	api := API{ms: &mock.ModelService{}}
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/export/locations.csv?vehicle_id=abc", nil)
+	if err != nil {
+		t.Fatalf("unable to create HTTP request: %s", err)
+	}
+	api.LocationsExportHandler(w, req)
+	if w.Result().StatusCode != 400 {
+		t.Errorf("got status code %d, expected 400", w.Result().StatusCode)
+	}
+}
+
+func TestArrivalsNDJSONExportHandler(t *testing.T) {
+	since := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.UTC)
+	until := time.Date(2019, time.March, 2, 8, 0, 0, 0, time.UTC)
+	filter := shuttletracker.HistoryFilter{Since: since, Until: until}
+
+	ms := &mock.ModelService{}
+	ms.ArrivalService.On("ExportArrivals", filter).Return([]*shuttletracker.Arrival{
+		{ID: 1, VehicleID: 4, RouteID: 2, StopID: 3, Time: since.Add(time.Hour)},
+		{ID: 2, VehicleID: 4, RouteID: 2, StopID: 5, Time: since.Add(2 * time.Hour)},
+	}, nil)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/export/arrivals.ndjson?since=2019-03-01T08:00:00Z&until=2019-03-02T08:00:00Z", nil)
+	api.ArrivalsNDJSONExportHandler(w, req)
+	resp := w.Result()
+
+	if resp.Header.Get("Content-Type") != ndjsonContentType {
+		t.Errorf("got Content-Type %q, expected %q", resp.Header.Get("Content-Type"), ndjsonContentType)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	expected := `{"id":1,"vehicle_id":4,"route_id":2,"stop_id":3,"time":"2019-03-01T09:00:00Z"}` + "\n" +
+		`{"id":2,"vehicle_id":4,"route_id":2,"stop_id":5,"time":"2019-03-01T10:00:00Z"}` + "\n"
+	if string(body) != expected {
+		t.Errorf("got body %q, expected %q", body, expected)
+	}
+}
+
+func TestStreamNDJSONClientDisconnected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/export/locations.ndjson", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	rows := 0
+	streamNDJSON(w, req, "test", func(write func(interface{}) error) error {
+		for i := 0; i < 10; i++ {
+			if err := write(i); err != nil {
+				return err
+			}
+			rows++
+			// the client goes away after the first row
+			cancel()
+		}
+		return nil
+	})
+	if rows != 1 {
+		t.Errorf("expected export to stop after 1 row, got %d", rows)
+	}
+}
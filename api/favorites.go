@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// deviceTokenHeader identifies the device whose favorites are requested.
+// Devices make up their own tokens and keep them, e.g. in localStorage.
+const deviceTokenHeader = "X-Device-Token"
+
+// deviceTokenPattern matches device tokens. They must be long enough that
+// they can't be guessed, like a UUID.
+var deviceTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,128}$`)
+
+// deviceToken returns the request's device token, or an error if it's
+// missing or malformed.
+func deviceToken(r *http.Request) (string, error) {
+	token := r.Header.Get(deviceTokenHeader)
+	if token == "" {
+		return "", fmt.Errorf("%s header is required", deviceTokenHeader)
+	}
+	if !deviceTokenPattern.MatchString(token) {
+		return "", fmt.Errorf("%s must be 16 to 128 letters, digits, hyphens, or underscores", deviceTokenHeader)
+	}
+	return token, nil
+}
+
+// FavoritesHandler lists the requesting device's Favorites.
+func (api *API) FavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := deviceToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	favorites, err := api.fs.Favorites(token)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get favorites")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, favorites)
+}
+
+// FavoritesCreateHandler saves a Stop or Route, given by stop_id or route_id
+// in the request body, as one of the requesting device's Favorites.
+func (api *API) FavoritesCreateHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := deviceToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	favorite := &shuttletracker.Favorite{}
+	if err := json.NewDecoder(r.Body).Decode(favorite); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	favorite.DeviceToken = token
+	if err := validateFavorite(api.ms, favorite); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.fs.AddFavorite(favorite); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to add favorite")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, favorite)
+}
+
+// validateFavorite checks that exactly one of a Favorite's Stop and Route is
+// set and that it exists.
+func validateFavorite(ms shuttletracker.ModelService, favorite *shuttletracker.Favorite) error {
+	if (favorite.StopID == nil) == (favorite.RouteID == nil) {
+		return fmt.Errorf("exactly one of stop_id and route_id is required")
+	}
+	if favorite.StopID != nil {
+		if _, err := ms.Stop(*favorite.StopID); err == shuttletracker.ErrStopNotFound {
+			return fmt.Errorf("stop %d does not exist", *favorite.StopID)
+		} else if err != nil {
+			return err
+		}
+		return nil
+	}
+	if _, err := ms.Route(*favorite.RouteID); err == shuttletracker.ErrRouteNotFound {
+		return fmt.Errorf("route %d does not exist", *favorite.RouteID)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FavoritesDeleteHandler removes the Stop or Route given by stop_id or
+// route_id in the query string from the requesting device's Favorites.
+func (api *API) FavoritesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := deviceToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	favorite := &shuttletracker.Favorite{DeviceToken: token}
+	for param, id := range map[string]**int64{"stop_id": &favorite.StopID, "route_id": &favorite.RouteID} {
+		s := r.URL.Query().Get(param)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*id = &n
+	}
+	if (favorite.StopID == nil) == (favorite.RouteID == nil) {
+		http.Error(w, "exactly one of stop_id and route_id is required", http.StatusBadRequest)
+		return
+	}
+	err = api.fs.RemoveFavorite(favorite)
+	if err == shuttletracker.ErrFavoriteNotFound {
+		http.Error(w, "Favorite not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to remove favorite")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+const testDeviceToken = "0123456789abcdef-device"
+
+func TestDeviceToken(t *testing.T) {
+	for token, valid := range map[string]bool{
+		testDeviceToken:          true,
+		"":                       false,
+		"short":                  false,
+		"0123456789abcdef/../x":  false,
+		strings.Repeat("a", 129): false,
+	} {
+		req := httptest.NewRequest("GET", "/favorites/", nil)
+		req.Header.Set(deviceTokenHeader, token)
+		if _, err := deviceToken(req); (err == nil) != valid {
+			t.Errorf("%q: got error %v, expected valid %t", token, err, valid)
+		}
+	}
+}
+
+func TestValidateFavorite(t *testing.T) {
+	id := func(n int64) *int64 {
+		return &n
+	}
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	ms.StopService.On("Stop", int64(2)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	ms.RouteService.On("Route", int64(3)).Return(&shuttletracker.Route{ID: 3}, nil)
+	ms.RouteService.On("Route", int64(4)).Return((*shuttletracker.Route)(nil), shuttletracker.ErrRouteNotFound)
+
+	tests := []struct {
+		favorite shuttletracker.Favorite
+		err      string
+	}{
+		{shuttletracker.Favorite{StopID: id(1)}, ""},
+		{shuttletracker.Favorite{RouteID: id(3)}, ""},
+		{shuttletracker.Favorite{}, "exactly one"},
+		{shuttletracker.Favorite{StopID: id(1), RouteID: id(3)}, "exactly one"},
+		{shuttletracker.Favorite{StopID: id(2)}, "stop 2 does not exist"},
+		{shuttletracker.Favorite{RouteID: id(4)}, "route 4 does not exist"},
+	}
+	for _, test := range tests {
+		err := validateFavorite(ms, &test.favorite)
+		if test.err == "" && err != nil {
+			t.Errorf("%+v: unexpected error: %s", test.favorite, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%+v: got error %v, expected %q", test.favorite, err, test.err)
+		}
+	}
+}
+
+func TestFavoritesCreateHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	fs := &mock.FavoriteService{}
+	fs.On("AddFavorite", tmock.MatchedBy(func(f *shuttletracker.Favorite) bool {
+		return f.DeviceToken == testDeviceToken && f.StopID != nil && *f.StopID == 1 && f.RouteID == nil
+	})).Return(nil)
+	api := API{ms: ms, fs: fs}
+
+	req := httptest.NewRequest("POST", "/favorites/create", strings.NewReader(`{"stop_id": 1}`))
+	req.Header.Set(deviceTokenHeader, testDeviceToken)
+	w := httptest.NewRecorder()
+	api.FavoritesCreateHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	fs.AssertExpectations(t)
+	if strings.Contains(w.Body.String(), testDeviceToken) {
+		t.Errorf("response includes the device token: %s", w.Body)
+	}
+
+	// no device token
+	req = httptest.NewRequest("POST", "/favorites/create", strings.NewReader(`{"stop_id": 1}`))
+	w = httptest.NewRecorder()
+	api.FavoritesCreateHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestFavoritesDeleteHandler(t *testing.T) {
+	fs := &mock.FavoriteService{}
+	fs.On("RemoveFavorite", tmock.MatchedBy(func(f *shuttletracker.Favorite) bool {
+		return f.RouteID != nil && *f.RouteID == 3
+	})).Return(nil)
+	fs.On("RemoveFavorite", tmock.MatchedBy(func(f *shuttletracker.Favorite) bool {
+		return f.RouteID != nil && *f.RouteID == 4
+	})).Return(shuttletracker.ErrFavoriteNotFound)
+	api := API{fs: fs}
+
+	for query, code := range map[string]int{
+		"route_id=3":           http.StatusOK,
+		"route_id=4":           http.StatusNotFound,
+		"":                     http.StatusBadRequest,
+		"route_id=3&stop_id=1": http.StatusBadRequest,
+		"stop_id=one":          http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest("DELETE", "/favorites/?"+query, nil)
+		req.Header.Set(deviceTokenHeader, testDeviceToken)
+		w := httptest.NewRecorder()
+		api.FavoritesDeleteHandler(w, req)
+		if w.Code != code {
+			t.Errorf("%q: got status %d, expected %d", query, w.Code, code)
+		}
+	}
+}
@@ -3,8 +3,22 @@ package api
 import (
 	"net/http"
 	"os"
+
+	"github.com/wtg/shuttletracker"
 )
 
+// staticFiles returns the built frontend in dir, or the embedded frontend if
+// dir is empty and there is one.
+func staticFiles(dir string) http.FileSystem {
+	if dir == "" {
+		if shuttletracker.StaticFiles != nil {
+			return shuttletracker.StaticFiles
+		}
+		dir = "static"
+	}
+	return http.Dir(dir)
+}
+
 type staticFileSystem struct {
 	fs http.FileSystem
 }
@@ -26,3 +40,19 @@ func (sfs staticFileSystem) Open(path string) (http.File, error) {
 
 	return f, nil
 }
+
+// serveStaticFile serves one of the frontend's files, like index.html.
+func (api *API) serveStaticFile(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := staticFileSystem{api.static}.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	s, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, name, s.ModTime(), f)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker/flags"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// flagsChannel tells every instance when an administrator sets a flag.
+const flagsChannel = "api.flags"
+
+// listenFlags sets flags broadcast by any instance.
+func listenFlags(ch chan string) {
+	for payload := range ch {
+		flag := flags.Flag{}
+		if err := json.Unmarshal([]byte(payload), &flag); err != nil {
+			log.WithError(err).Error("unable to unmarshal flag")
+			continue
+		}
+		flags.Set(flag.Name, flag.Percentage)
+	}
+}
+
+// FlagsHandler lists every flag that has been set and its percentage.
+func (api *API) FlagsHandler(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, flags.All())
+}
+
+// SetFlagHandler sets the percentage of clients that a flag is enabled for
+// on every instance. It lasts until the instances restart, after which the
+// configured percentage is used again; reloading the config doesn't change it.
+func (api *API) SetFlagHandler(w http.ResponseWriter, r *http.Request) {
+	flag := flags.Flag{}
+	if err := json.NewDecoder(r.Body).Decode(&flag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// the config file's flags are lowercase, so this is the same flag
+	flag.Name = strings.ToLower(chi.URLParam(r, "name"))
+	if flag.Percentage < 0 || flag.Percentage > 100 {
+		http.Error(w, "percentage must be from 0 to 100", http.StatusBadRequest)
+		return
+	}
+
+	b, err := json.Marshal(flag)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to marshal flag")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// This instance will also receive the broadcast, but the flag is set
+	// now so that it's already in effect when the response is sent.
+	flags.Set(flag.Name, flag.Percentage)
+	if err := api.bs.Broadcast(flagsChannel, string(b)); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to broadcast flag")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, flag)
+}
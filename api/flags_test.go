@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker/flags"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestSetFlagHandler(t *testing.T) {
+	defer flags.Reset()
+	bs := &mock.BroadcastService{}
+	bs.On("Broadcast", flagsChannel, `{"name":"eta-model","percentage":25}`).Return(nil)
+	api := &API{bs: bs}
+	r := chi.NewRouter()
+	r.Put("/flags/{name}", api.SetFlagHandler)
+	r.Get("/flags", api.FlagsHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/flags/ETA-Model", strings.NewReader(`{"percentage": 25}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	bs.AssertExpectations(t)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/flags", nil))
+	all := []flags.Flag{}
+	if err := json.NewDecoder(w.Body).Decode(&all); err != nil {
+		t.Fatalf("unable to decode flags: %s", err)
+	}
+	if len(all) != 1 || all[0] != (flags.Flag{Name: "eta-model", Percentage: 25}) {
+		t.Errorf("got %+v", all)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/flags/eta-model", strings.NewReader(`{"percentage": 101}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d for invalid percentage, expected 400", w.Code)
+	}
+}
+
+func TestListenFlags(t *testing.T) {
+	defer flags.Reset()
+	ch := make(chan string, 2)
+	ch <- "not json"
+	ch <- `{"name":"fusion-snapshots","percentage":100}`
+	close(ch)
+	listenFlags(ch)
+	if !flags.Enabled("fusion-snapshots", "client") {
+		t.Errorf("got %+v, expected flag to be enabled", flags.All())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -12,7 +13,9 @@ import (
 	"github.com/gorilla/websocket"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/health"
 	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/metrics"
 )
 
 var upgrader = websocket.Upgrader{
@@ -20,6 +23,13 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// busButtonBroadcastChannel is used to send bus button presses to every instance.
+const busButtonBroadcastChannel = "fusion.bus_button"
+
+// maxClientSubscriptions is how many topics a client can subscribe to at
+// once. Each topic with subscribers is sent messages and keeps a history.
+const maxClientSubscriptions = 50
+
 var validBusButtonEmoji = [...]string{"🚐", "🚌", "🚗", "🚓", "🚜"};
 
 // Messages from clients must be in this envelope. Depending on Type, fusionManager
@@ -28,10 +38,18 @@ var validBusButtonEmoji = [...]string{"🚐", "🚌", "🚗", "🚓", "🚜"};
 type fusionMessageEnvelope struct {
 	Type    string      `json:"type"`
 	Message interface{} `json:"message"`
+
+	// Sequence numbers topic messages in the order they're sent so that a
+	// resuming client can say which it received last.
+	Sequence uint64 `json:"sequence,omitempty"`
 }
 
 type fusionMessageSubscribe struct {
 	Topic string `json:"topic"`
+
+	// StopID is the Stop a client subscribing to ETAs is showing, if any,
+	// so that the subscription counts as demand there.
+	StopID int64 `json:"stop_id,omitempty"`
 }
 
 type fusionMessageUnsubscribe struct {
@@ -56,6 +74,12 @@ type fusionPosition struct {
 	// Time is when fusionManager receives the position. We don't want to trust
 	// the client's timestamp.
 	Time time.Time `json:"time"`
+
+	// ClientTime is when the client says it captured the position by its own
+	// clock, if it says. Captured is ClientTime corrected by the estimate of
+	// how far off the client's clock is, or Time if either is unknown.
+	ClientTime *time.Time `json:"client_time"`
+	Captured   time.Time  `json:"captured"`
 }
 
 type fusionBusButton struct {
@@ -64,11 +88,25 @@ type fusionBusButton struct {
 	Emoji     string  `json:"emojiChoice"`
 }
 
+// fusionAlarm is sent by a client when its rider sets an alarm for a shuttle
+// arriving at a Stop.
+type fusionAlarm struct {
+	StopID int64 `json:"stop_id"`
+}
+
 type fusionClient struct {
 	id              string
 	conn            *websocket.Conn
 	lastMessageTime time.Time
 	userAgent       string
+	ip              string
+	connected       time.Time
+
+	// token identifies the client's session when it resumes it.
+	token string
+
+	// clock estimates how far off the client's clock is.
+	clock clockEstimate
 }
 
 type clientMessage struct {
@@ -80,10 +118,45 @@ type serverMessage struct {
 	topic    string
 	clientID string
 	msg      interface{}
+
+	// key identifies what a topic message is about, e.g. a vehicle. If another
+	// message with the same topic and key is sent before the batch is flushed,
+	// only the newer one is delivered. Empty keys are never coalesced.
+	key string
+}
+
+// fusionBatchWindow is how long topic messages are held before being sent so
+// that rapid-fire updates can be coalesced and written together.
+const fusionBatchWindow = 100 * time.Millisecond
+
+// topicBatch holds topic messages that are waiting to be sent, in the order
+// they were received.
+type topicBatch struct {
+	messages []serverMessage
+	keys     map[string]int
+}
+
+func newTopicBatch() *topicBatch {
+	return &topicBatch{keys: map[string]int{}}
+}
+
+// add queues a message, replacing any queued message with the same topic and key.
+func (tb *topicBatch) add(sm serverMessage) {
+	if sm.key == "" {
+		tb.messages = append(tb.messages, sm)
+		return
+	}
+	k := sm.topic + "\x00" + sm.key
+	if i, ok := tb.keys[k]; ok {
+		tb.messages[i] = sm
+		return
+	}
+	tb.keys[k] = len(tb.messages)
+	tb.messages = append(tb.messages, sm)
 }
 
 type fusionManagerDebug struct {
-	// subscriptions    []sub
+	subscriptions  map[string][]string
 	clients        []fusionClient
 	tracks         [][]fusionPosition
 	busButtonCount uint64
@@ -96,6 +169,24 @@ type fusionManager struct {
 	clientMsg chan clientMessage
 	serverMsg chan serverMessage
 
+	// busButtons receives bus button presses from every instance.
+	busButtons chan string
+
+	// busButtonFilter keeps presses from the same client from being counted
+	// as many riders. It may be nil.
+	busButtonFilter *busButtonFilter
+
+	// moderation receives disconnections and bans from every instance, and
+	// bans holds the bans that are in effect.
+	moderation chan string
+	bans       *fusionBans
+
+	// countdowns receives the next arrivals at each Stop periodically.
+	countdowns chan map[int64]stopCountdown
+
+	// stops checks that stop arrivals topics are for Stops that exist.
+	stops *knownIDs
+
 	// This is a little gnarly... basically we can ask fusionManager to send some
 	// information about itself to a channel so that we don't have to put its internal
 	// state behind a mutex to inspect it. No locks around maps or slices required.
@@ -109,18 +200,54 @@ type fusionManager struct {
 	subscriptions      map[string][]string
 	subscribeCallbacks map[string][]func(string)
 
+	// batch holds topic messages until flush fires. flush is nil when the
+	// batch is empty.
+	batch *topicBatch
+	flush <-chan time.Time
+
 	clients        map[string]*fusionClient
 	tracks         map[string][]fusionPosition
 	busButtonCount uint64
 
+	// sessions are clients' sessions by resume token, including those of
+	// clients that recently disconnected, and replay holds recent topic
+	// messages for resumed clients.
+	sessions map[string]*fusionSession
+	replay   *replayLog
+
+	// lastCountdowns is the latest next arrivals at each Stop, from
+	// lastCountdownsAt, for new subscribers to stop arrivals topics.
+	lastCountdowns   map[int64]stopCountdown
+	lastCountdownsAt time.Time
+
 	em shuttletracker.ETAService
 	ms shuttletracker.ModelService
+	bs shuttletracker.BroadcastService
+
+	// usage counts clients and subscriptions. It may be nil.
+	usage *usageCounter
+
+	// demand counts bus button presses, ETA subscriptions, and alarms. It may be nil.
+	demand *demandCounter
+
+	// offlineAfter is how long a vehicle can go without reporting before it
+	// is considered offline.
+	offlineAfter time.Duration
+
+	// visibility hides locations and ETAs on Routes that aren't shown to the public.
+	visibility *routeVisibility
+
+	// occupancy is how full riders say each vehicle is. It may be nil.
+	occupancy *occupancyTracker
+
+	// vehicles checks that occupancy reports are about enabled Vehicles.
+	vehicles *knownIDs
 
 	// an ID for Fusion clients to tell if they get reconnected to the same server or not
 	id string
 }
 
-func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.ModelService) (*fusionManager, error) {
+func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.ModelService, bs shuttletracker.BroadcastService, offlineAfter, snapshotInterval time.Duration, historySize int) (*fusionManager, error) {
 	fm := &fusionManager{
 		addClient:          make(chan *fusionClient),
 		removeClient:       make(chan string),
@@ -131,8 +258,22 @@ func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.Mo
 		tracks:             map[string][]fusionPosition{},
 		subscriptions:      map[string][]string{},
 		subscribeCallbacks: map[string][]func(string){},
+		batch:              newTopicBatch(),
+		sessions:           map[string]*fusionSession{},
+		replay:             newReplayLog(historySize),
+		busButtons:         bs.SubscribeBroadcasts(busButtonBroadcastChannel),
+		busButtonFilter:    newBusButtonFilter(ms),
+		moderation:         bs.SubscribeBroadcasts(fusionModerationChannel),
+		bans:               newFusionBans(),
+		countdowns:         make(chan map[int64]stopCountdown),
+		stops:              newKnownStops(ms),
 		em:                 etaManager,
 		ms:                 ms,
+		bs:                 bs,
+		offlineAfter:       offlineAfter,
+		visibility:         newRouteVisibility(ms),
+		occupancy:          newOccupancyTracker(bs),
+		vehicles:           newKnownVehicles(ms),
 	}
 
 	// get notified of new ETAs to push out to the ETA topic
@@ -146,6 +287,7 @@ func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.Mo
 	// ETAManager in the future).
 	fm.subscribeCallbacks["eta"] = []func(string){fm.handleETASubscribe}
 	fm.subscribeCallbacks["vehicle_location"] = []func(string){fm.handleVehicleLocationSubscribe}
+	fm.subscribeCallbacks["snapshot"] = []func(string){fm.handleSnapshotSubscribe}
 
 	// generate a server UUID
 	u, err := uuid.NewV1()
@@ -155,6 +297,9 @@ func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.Mo
 	fm.id = u.String()
 
 	go fm.run()
+	go fm.watchOffline()
+	go fm.watchSnapshots(snapshotInterval)
+	go fm.watchStopCountdowns(stopCountdownInterval)
 	return fm, nil
 }
 
@@ -183,13 +328,22 @@ func (fm *fusionManager) run() {
 			fm.processServerMessage(sm)
 		case debugChan := <-fm.debug:
 			fm.processDebug(debugChan)
+		case <-fm.flush:
+			fm.flushBatch()
+		case payload := <-fm.busButtons:
+			fm.processBusButton(payload)
+		case payload := <-fm.moderation:
+			fm.processModeration(payload)
+		case countdowns := <-fm.countdowns:
+			fm.processCountdowns(countdowns, time.Now())
 		}
 	}
 }
 
-func (fm *fusionManager) sendToTopic(topic string, msg fusionMessageEnvelope) {
+func (fm *fusionManager) sendToTopic(topic, key string, msg fusionMessageEnvelope) {
 	sm := serverMessage{
 		topic: topic,
+		key:   key,
 		msg:   msg,
 	}
 	fm.serverMsg <- sm
@@ -205,26 +359,49 @@ func (fm *fusionManager) sendToClient(clientID string, msg fusionMessageEnvelope
 
 // this is a callback for ETAManager to inform Fusion to push out a new ETA
 func (fm *fusionManager) handleETA(eta shuttletracker.VehicleETA) {
+	eta.Stale = etasStale()
+	// Send the ETA without stops instead of dropping it so that clients
+	// forget the vehicle's earlier ETAs.
+	if fm.visibility.hidden(&eta.RouteID, time.Now()) {
+		eta.StopETAs = []shuttletracker.StopETA{}
+	}
 	fme := fusionMessageEnvelope{
 		Type:    "eta",
 		Message: eta,
 	}
-	fm.sendToTopic("eta", fme)
+	fm.sendToTopic("eta", strconv.FormatInt(eta.VehicleID, 10), fme)
 }
 
 func (fm *fusionManager) handleLocations(locChan chan *shuttletracker.Location) {
 	for location := range locChan {
+		now := time.Now()
+		if fm.visibility.hidden(location.RouteID, now) {
+			continue
+		}
+		// other subscribers get the same Location, so set occupancy on a copy
+		loc := *location
+		fm.occupancy.setOccupancy(&loc, now)
 		fme := fusionMessageEnvelope{
 			Type:    "vehicle_location",
-			Message: location,
+			Message: &loc,
 		}
-		fm.sendToTopic("vehicle_location", fme)
+		key := ""
+		if location.VehicleID != nil {
+			key = strconv.FormatInt(*location.VehicleID, 10)
+		}
+		fm.sendToTopic("vehicle_location", key, fme)
 	}
 }
 
 // this is a callback for Fusion to immediately push out ETAs to newly-subscribed clients
 func (fm *fusionManager) handleETASubscribe(clientID string) {
+	stale := etasStale()
+	now := time.Now()
 	for _, eta := range fm.em.CurrentETAs() {
+		if fm.visibility.hidden(&eta.RouteID, now) {
+			continue
+		}
+		eta.Stale = stale
 		fme := fusionMessageEnvelope{
 			Type:    "eta",
 			Message: eta,
@@ -242,7 +419,12 @@ func (fm *fusionManager) handleVehicleLocationSubscribe(clientID string) {
 		return
 	}
 
+	now := time.Now()
 	for _, location := range locations {
+		if isOffline(location, now, fm.offlineAfter) || fm.visibility.hidden(location.RouteID, now) {
+			continue
+		}
+		fm.occupancy.setOccupancy(location, now)
 		fme := fusionMessageEnvelope{
 			Type:    "vehicle_location",
 			Message: location,
@@ -257,10 +439,14 @@ func decodeFusionMessage(r io.Reader) (string, json.RawMessage, error) {
 		Message: &message,
 	}
 	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
 	err := dec.Decode(&fm)
 	if err != nil {
 		return "", message, err
 	}
+	if fm.Type == "" {
+		return "", message, fmt.Errorf("type is required")
+	}
 	return fm.Type, message, nil
 }
 
@@ -268,32 +454,33 @@ func decodeFusionMessage(r io.Reader) (string, json.RawMessage, error) {
 // it just needs to be unique) and associate this client with it.
 func (fm *fusionManager) processAddClient(client *fusionClient) {
 	fm.clients[client.id] = client
+	metrics.WebsocketClients.Inc()
 
 	fme := fusionMessageEnvelope{
 		Type:    "server_id",
 		Message: fm.id,
 	}
 	fm.sendToClient(client.id, fme)
+	fm.startSession(client, time.Now())
+	fm.sendClock(client, time.Now())
 
 	go fm.handleClient(client)
 }
 
 func (fm *fusionManager) processRemoveClient(clientID string) {
-	// find all of this client's subscriptions and remove them
-	for topic, subs := range fm.subscriptions {
-		for i, subbedClient := range subs {
-			if subbedClient == clientID {
-				subs = append(subs[:i], subs[i+1:]...)
-				fm.subscriptions[topic] = subs
+	if client, ok := fm.clients[clientID]; ok {
+		fm.suspendSession(client, time.Now())
+	}
 
-				// we're done since handleMsgSubscribe doesn't let a client
-				// subscribe more than once to the same topic
-				break
-			}
-		}
+	// find all of this client's subscriptions and remove them
+	for _, topic := range fm.clientTopics(clientID) {
+		fm.removeSubscription(clientID, topic)
 	}
 
 	// remove from clients
+	if _, ok := fm.clients[clientID]; ok {
+		metrics.WebsocketClients.Dec()
+	}
 	delete(fm.clients, clientID)
 }
 
@@ -308,17 +495,33 @@ func (fm *fusionManager) processMessage(cm clientMessage) {
 	case fusionMessageUnsubscribe:
 		fmu := cm.msg.(fusionMessageUnsubscribe)
 		fm.handleMsgUnsubscribe(cm.clientID, fmu)
+	case fusionMessageTopics:
+		fm.handleMsgTopics(cm.clientID)
+	case fusionMessageResume:
+		fmr := cm.msg.(fusionMessageResume)
+		if fm.bans.banned("", fmr.Token, time.Now()) {
+			fm.disconnectClient(cm.clientID, "banned")
+			return
+		}
+		fm.handleMsgResume(cm.clientID, fmr)
+	case fusionMessageReplay:
+		fmr := cm.msg.(fusionMessageReplay)
+		fm.handleMsgReplay(cm.clientID, fmr)
 	case fusionPosition:
 		fp := cm.msg.(fusionPosition)
-		fm.handleMsgPosition(fp)
+		fm.handleMsgPosition(cm.clientID, fp)
+	case fusionClock:
+		fc := cm.msg.(fusionClock)
+		fm.handleMsgClock(cm.clientID, fc)
+	case fusionAlarm:
+		fa := cm.msg.(fusionAlarm)
+		fm.demand.countAlarm(fa.StopID)
 	case fusionBusButton:
 		fbb := cm.msg.(fusionBusButton)
-		for _, emoji := range validBusButtonEmoji {
-				if emoji == fbb.Emoji {
-						fm.handleMsgBusButton(fbb)
-						return
-				}
-		}
+		fm.handleMsgBusButton(cm.clientID, fbb)
+	case fusionOccupancy:
+		fo := cm.msg.(fusionOccupancy)
+		fm.handleMsgOccupancy(cm.clientID, fo)
 	default:
 		// This is an error since it means that an unhandled message type was sent to
 		// the channel, probably by handleClient. This shouldn't happen, so please fix
@@ -328,111 +531,238 @@ func (fm *fusionManager) processMessage(cm clientMessage) {
 }
 
 // Send a message from the server to either all clients subscribed to a topic or
-// only a specific client by its ID.
+// only a specific client by its ID. Topic messages are batched and sent when the
+// batch is flushed.
 func (fm *fusionManager) processServerMessage(sm serverMessage) {
-	b, err := json.Marshal(sm.msg)
+	if len(sm.topic) > 0 {
+		fm.batch.add(sm)
+		if fm.flush == nil {
+			fm.flush = time.After(fusionBatchWindow)
+		}
+	} else if len(sm.clientID) > 0 {
+		client, ok := fm.clients[sm.clientID]
+		if !ok {
+			log.Error("client not found")
+			return
+		}
+		b, err := json.Marshal(sm.msg)
+		if err != nil {
+			log.WithError(err).Error("unable to marshal")
+			return
+		}
+		fm.writeToClient(client, b)
+	} else {
+		log.Error("neither topic nor client ID found on serverMessage")
+	}
+}
+
+// writeToClient writes a marshaled message to a client right away.
+func (fm *fusionManager) writeToClient(client *fusionClient, b []byte) {
+	err := client.conn.WriteMessage(websocket.TextMessage, b)
 	if err != nil {
-		log.WithError(err).Error("unable to marshal")
+		log.WithError(err).Error("unable to write")
 		return
 	}
+	metrics.WebsocketMessages.Inc()
+}
+
+// flushBatch sends each batched topic message to its subscribers. Each message
+// is marshaled and framed once no matter how many clients receive it. Messages
+// are numbered and kept for resumed clients even if nobody is subscribed.
+func (fm *fusionManager) flushBatch() {
+	batch := fm.batch
+	fm.batch = newTopicBatch()
+	fm.flush = nil
+
+	for _, sm := range batch.messages {
+		var b []byte
+		var err error
+		if fme, ok := sm.msg.(fusionMessageEnvelope); ok {
+			b, err = fm.replay.add(sm.topic, fme)
+		} else {
+			b, err = json.Marshal(sm.msg)
+		}
+		if err != nil {
+			log.WithError(err).Error("unable to marshal")
+			continue
+		}
+
+		subs := fm.subscriptions[sm.topic]
+		if len(subs) == 0 {
+			continue
+		}
+		pm, err := websocket.NewPreparedMessage(websocket.TextMessage, b)
+		if err != nil {
+			log.WithError(err).Error("unable to prepare message")
+			continue
+		}
 
-	if len(sm.topic) > 0 {
 		// find clients subscribed to topic
-		for _, clientID := range fm.subscriptions[sm.topic] {
+		for _, clientID := range subs {
 			client, ok := fm.clients[clientID]
 			if !ok {
 				log.Error("client not found")
 				continue
 			}
-			err = client.conn.WriteMessage(websocket.TextMessage, b)
+			err = client.conn.WritePreparedMessage(pm)
 			if err != nil {
 				log.WithError(err).Error("unable to write")
 				continue
 			}
+			metrics.WebsocketMessages.Inc()
 		}
-	} else if len(sm.clientID) > 0 {
-		client, ok := fm.clients[sm.clientID]
-		if !ok {
-			log.Error("client not found")
+	}
+}
+
+func (fm *fusionManager) handleMsgSubscribe(clientID string, fms fusionMessageSubscribe) {
+	topics := fm.clientTopics(clientID)
+	for _, topic := range topics {
+		// if client is already subscribed, do nothing
+		if topic == fms.Topic {
 			return
 		}
-		err = client.conn.WriteMessage(websocket.TextMessage, b)
-		if err != nil {
-			log.WithError(err).Error("unable to write")
-			return
+	}
+	if len(topics) >= maxClientSubscriptions {
+		fm.rejectMessage(clientID, "subscribe", fmt.Errorf("can't subscribe to more than %d topics", maxClientSubscriptions))
+		return
+	}
+	if stopID, ok := stopArrivalsTopicStop(fms.Topic); ok && !fm.stops.exists(stopID, time.Now()) {
+		fm.rejectMessage(clientID, "subscribe", fmt.Errorf("there's no stop %d", stopID))
+		return
+	}
+	fm.addSubscription(clientID, fms.Topic)
+	fm.usage.countTopic(fms.Topic)
+	if fms.Topic == "eta" && fms.StopID != 0 {
+		fm.demand.countETASubscription(fms.StopID)
+	}
+
+	if stopID, ok := stopArrivalsTopicStop(fms.Topic); ok {
+		fm.handleStopArrivalsSubscribe(clientID, stopID)
+	}
+
+	// If this topic has a subscription callback, hit it.
+	// Future optimization: this should probably hit all callbacks concurrently.
+	if cbs, ok := fm.subscribeCallbacks[fms.Topic]; ok {
+		for _, cb := range cbs {
+			cb(clientID)
 		}
-	} else {
-		log.Error("neither topic nor client ID found on serverMessage")
 	}
 }
 
-func (fm *fusionManager) handleMsgSubscribe(clientID string, fms fusionMessageSubscribe) {
+// addSubscription subscribes a client to a topic. It returns false if the
+// client was already subscribed.
+func (fm *fusionManager) addSubscription(clientID, topic string) bool {
 	// grab the list of existing subscriptions
-	subs := fm.subscriptions[fms.Topic]
+	subs := fm.subscriptions[topic]
 	if subs == nil {
 		// this is the first subscriber, so the list doesn't exist
 		subs = []string{}
 	}
 
-	// if client is already subscribed, do nothing
 	for _, subbedClient := range subs {
 		if subbedClient == clientID {
-			return
+			return false
 		}
 	}
 
-	subs = append(subs, clientID)
-	fm.subscriptions[fms.Topic] = subs
-
-	// If this topic has a subscription callback, hit it.
-	// Future optimization: this should probably hit all callbacks concurrently.
-	if cbs, ok := fm.subscribeCallbacks[fms.Topic]; ok {
-		for _, cb := range cbs {
-			cb(clientID)
-		}
-	}
+	fm.subscriptions[topic] = append(subs, clientID)
+	return true
 }
 
-func (fm *fusionManager) handleMsgUnsubscribe(clientID string, fmu fusionMessageUnsubscribe) {
-	subs := fm.subscriptions[fmu.Topic]
+// removeSubscription unsubscribes a client from a topic. It returns false if
+// the client wasn't subscribed. Topics without subscribers are removed, so
+// that they don't pile up.
+func (fm *fusionManager) removeSubscription(clientID, topic string) bool {
+	subs := fm.subscriptions[topic]
 	for i, subbedClient := range subs {
 		if subbedClient == clientID {
 			subs = append(subs[:i], subs[i+1:]...)
-			fm.subscriptions[fmu.Topic] = subs
+			if len(subs) == 0 {
+				delete(fm.subscriptions, topic)
+			} else {
+				fm.subscriptions[topic] = subs
+			}
 
 			// we're done since handleMsgSubscribe doesn't let a client
 			// subscribe more than once to the same topic
-			return
+			return true
 		}
 	}
-	log.Warnf("client requested unsubscribe from topic it's not subscribed to")
+	return false
+}
+
+// clientTopics returns the topics that a client is subscribed to.
+func (fm *fusionManager) clientTopics(clientID string) []string {
+	topics := []string{}
+	for topic, subs := range fm.subscriptions {
+		for _, subbedClient := range subs {
+			if subbedClient == clientID {
+				topics = append(topics, topic)
+				break
+			}
+		}
+	}
+	return topics
+}
+
+func (fm *fusionManager) handleMsgUnsubscribe(clientID string, fmu fusionMessageUnsubscribe) {
+	if !fm.removeSubscription(clientID, fmu.Topic) {
+		log.Warnf("client requested unsubscribe from topic it's not subscribed to")
+		return
+	}
+	fm.forgetTopic(fmu.Topic)
 }
 
-func (fm *fusionManager) handleMsgPosition(fp fusionPosition) {
-	fp.Time = time.Now()
+// handleMsgPosition adds a position to its track. Its Time was set when it
+// was received.
+func (fm *fusionManager) handleMsgPosition(clientID string, fp fusionPosition) {
+	fp.Captured = fp.Time
+	if client, ok := fm.clients[clientID]; ok {
+		fp.Captured = client.clock.captured(fp.ClientTime, fp.Time)
+	}
 	fm.tracks[fp.Track] = append(fm.tracks[fp.Track], fp)
 }
 
-func (fm *fusionManager) handleMsgBusButton(fbb fusionBusButton) {
-	fm.busButtonCount++
-	fme := fusionMessageEnvelope{
-		Type:    "bus_button",
-		Message: fbb,
+// Bus button presses are sent to every instance (including this one) so that
+// all subscribers see them no matter which instance they're connected to.
+func (fm *fusionManager) handleMsgBusButton(clientID string, fbb fusionBusButton) {
+	if !fm.filterBusButton(clientID, fbb) {
+		return
 	}
-	b, err := json.Marshal(fme)
+	fm.demand.countBusButton(fbb)
+	b, err := json.Marshal(fbb)
 	if err != nil {
 		log.WithError(err).Error("unable to marshal")
 		return
 	}
-
-	// find clients subscribed to topic
-	for _, clientID := range fm.subscriptions["bus_button"] {
-		client := fm.clients[clientID]
-		err = client.conn.WriteMessage(websocket.TextMessage, b)
+	// don't block run on the database
+	go func() {
+		err := fm.bs.Broadcast(busButtonBroadcastChannel, string(b))
+		health.ReportDegraded(health.Fusion, err)
 		if err != nil {
-			log.WithError(err).Error("unable to write")
+			log.WithError(err).Error("unable to broadcast bus button")
 		}
+	}()
+}
+
+func (fm *fusionManager) processBusButton(payload string) {
+	fbb := fusionBusButton{}
+	err := json.Unmarshal([]byte(payload), &fbb)
+	if err != nil {
+		log.WithError(err).Error("unable to unmarshal bus button")
+		return
+	}
+
+	fm.busButtonCount++
+	fme := fusionMessageEnvelope{
+		Type:    "bus_button",
+		Message: fbb,
 	}
+	// we're already in run, so queue it directly instead of going through serverMsg
+	fm.processServerMessage(serverMessage{
+		topic: "bus_button",
+		msg:   fme,
+	})
 }
 
 // handleClient is expected to be called inside of a goroutine associated with a client.
@@ -452,49 +782,70 @@ func (fm *fusionManager) handleClient(client *fusionClient) {
 		client.lastMessageTime = time.Now()
 		messageType, message, err := decodeFusionMessage(r)
 		if err != nil {
-			log.WithError(err).Error("unable to decode message")
+			log.WithError(err).Warn("unable to decode message")
+			fm.rejectMessage(client.id, messageType, err)
 			continue
 		}
 
+		var msg interface{}
 		switch messageType {
 		case "subscribe":
 			fms := fusionMessageSubscribe{}
-			err = json.Unmarshal(message, &fms)
-			if err != nil {
-				log.WithError(err).Error("unable to decode fusionMessageSubscribe")
-				break
-			}
-			fm.clientMsg <- clientMessage{client.id, fms}
+			err = decodeClientMessage(message, &fms, "topic")
+			msg = fms
 		case "unsubscribe":
 			fmu := fusionMessageUnsubscribe{}
-			err = json.Unmarshal(message, &fmu)
-			if err != nil {
-				log.WithError(err).Error("unable to decode fusionMessageUnsubscribe")
-				break
+			err = decodeClientMessage(message, &fmu, "topic")
+			msg = fmu
+		case "topics":
+			ft := fusionMessageTopics{}
+			// the message is optional since there's nothing to say
+			if len(message) > 0 && string(message) != "null" {
+				err = decodeClientMessage(message, &ft)
 			}
-			fm.clientMsg <- clientMessage{client.id, fmu}
+			msg = ft
+		case "resume":
+			fmr := fusionMessageResume{}
+			err = decodeClientMessage(message, &fmr, "token", "sequence")
+			msg = fmr
+		case "replay":
+			fmr := fusionMessageReplay{}
+			err = decodeClientMessage(message, &fmr, "topic", "since")
+			msg = fmr
 		case "position":
 			fp := fusionPosition{}
-			err = json.Unmarshal(message, &fp)
-			if err != nil {
-				log.WithError(err).Error("unable to decode fusionPosition")
-				break
-			}
-			fp.Time = time.Now()
-			fm.clientMsg <- clientMessage{client.id, fp}
+			err = decodeClientMessage(message, &fp, "latitude", "longitude", "track")
+			fp.Time = client.lastMessageTime
+			msg = fp
+		case "clock":
+			fc := fusionClock{}
+			err = decodeClientMessage(message, &fc, "server_time", "client_time")
+			fc.received = client.lastMessageTime
+			msg = fc
 		case "bus_button":
 			fbb := fusionBusButton{}
-			err = json.Unmarshal(message, &fbb)
-			if err != nil {
-				log.WithError(err).Error("unable to decode fusionBusButton")
-				break
-			}
-			fm.clientMsg <- clientMessage{client.id, fbb}
+			err = decodeClientMessage(message, &fbb, "latitude", "longitude", "emojiChoice")
+			msg = fbb
+		case "alarm":
+			fa := fusionAlarm{}
+			err = decodeClientMessage(message, &fa, "stop_id")
+			msg = fa
+		case "occupancy":
+			fo := fusionOccupancy{}
+			err = decodeClientMessage(message, &fo, "vehicle_id", "occupancy")
+			msg = fo
 		default:
-			// This is just a warning and not an error since messageType comes straight
-			// from the client. We can't trust it.
-			log.WithError(err).Warnf("unknown message type \"%s\"", messageType)
+			// messageType comes straight from the client, so we can't trust it.
+			err = fmt.Errorf("unknown message type \"%s\"", messageType)
+		}
+		if err != nil {
+			// This is just a warning and not an error since the message comes
+			// straight from the client.
+			log.WithError(err).Warnf("invalid %s message", messageType)
+			fm.rejectMessage(client.id, messageType, err)
+			continue
 		}
+		fm.clientMsg <- clientMessage{client.id, msg}
 	}
 
 	// remove client since the connection is dead
@@ -507,6 +858,11 @@ func (fm *fusionManager) processDebug(ch chan *fusionManagerDebug) {
 		clients:        make([]fusionClient, 0, len(fm.clients)),
 		tracks:         make([][]fusionPosition, 0, len(fm.tracks)),
 		busButtonCount: fm.busButtonCount,
+		subscriptions:  make(map[string][]string, len(fm.subscriptions)),
+	}
+
+	for topic, subs := range fm.subscriptions {
+		debug.subscriptions[topic] = append([]string{}, subs...)
 	}
 
 	for _, v := range fm.clients {
@@ -515,6 +871,9 @@ func (fm *fusionManager) processDebug(ch chan *fusionManagerDebug) {
 			id:              v.id,
 			lastMessageTime: v.lastMessageTime,
 			userAgent:       v.userAgent,
+			ip:              v.ip,
+			connected:       v.connected,
+			token:           v.token,
 		}
 		debug.clients = append(debug.clients, newClient)
 	}
@@ -542,7 +901,7 @@ func (fm *fusionManager) debugInfo() *fusionManagerDebug {
 func (fm *fusionManager) debugHandler(w http.ResponseWriter, r *http.Request) {
 	_, err := fmt.Fprint(w, "fusionManager debug\n\n")
 	if err != nil {
-		log.WithError(err).Error("unable to write response")
+		log.WithContext(r.Context()).WithError(err).Error("unable to write response")
 		return
 	}
 
@@ -551,7 +910,7 @@ func (fm *fusionManager) debugHandler(w http.ResponseWriter, r *http.Request) {
 
 	_, err = fmt.Fprintf(w, "%d tracks\n", len(fmDebug.tracks))
 	if err != nil {
-		log.WithError(err).Error("unable to write response")
+		log.WithContext(r.Context()).WithError(err).Error("unable to write response")
 		return
 	}
 
@@ -561,69 +920,113 @@ func (fm *fusionManager) debugHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	_, err = fmt.Fprintf(w, "%d positions\n", numPositions)
 	if err != nil {
-		log.WithError(err).Error("unable to write response")
+		log.WithContext(r.Context()).WithError(err).Error("unable to write response")
 		return
 	}
 
 	_, err = fmt.Fprintf(w, "%d bus buttons\n\n", fmDebug.busButtonCount)
 	if err != nil {
-		log.WithError(err).Error("unable to write response")
+		log.WithContext(r.Context()).WithError(err).Error("unable to write response")
 		return
 	}
 
 	_, err = fmt.Fprintf(w, "%d clients:\n", len(fmDebug.clients))
 	if err != nil {
-		log.WithError(err).Error("unable to write response")
+		log.WithContext(r.Context()).WithError(err).Error("unable to write response")
 		return
 	}
 	for _, client := range fmDebug.clients {
 		_, err = fmt.Fprintf(w, "%s\t%s\n", client.lastMessageTime.Format(time.RFC3339), client.userAgent)
 		if err != nil {
-			log.WithError(err).Error("unable to write response")
+			log.WithContext(r.Context()).WithError(err).Error("unable to write response")
 			return
 		}
 	}
 }
 
+// exportHandler writes the tracks that match the filters in the query string
+// (see parseTrackFilter) as a JSON array, with ?format=ndjson, one position per
+// line as it is encoded, or with ?format=geojson, as a GeoJSON
+// FeatureCollection with a feature for each track.
 func (fm *fusionManager) exportHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	enc := json.NewEncoder(w)
-	fmDebug := fm.debugInfo()
-	err := enc.Encode(fmDebug.tracks)
+	filter, err := parseTrackFilter(r)
 	if err != nil {
-		log.WithError(err).Error("unable to encode")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tracks := filter.apply(fm.debugInfo().tracks)
+
+	switch r.URL.Query().Get("format") {
+	case "ndjson":
+		streamNDJSON(w, r, "tracks", func(write func(interface{}) error) error {
+			for _, track := range tracks {
+				for _, position := range track {
+					if err := write(position); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		return
+	case "geojson":
+		w.Header().Set("Content-Type", geoJSONContentType)
+		err = json.NewEncoder(w).Encode(tracksGeoJSON(tracks))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(tracks)
+	}
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to encode")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
 func (fm *fusionManager) webSocketHandler(w http.ResponseWriter, r *http.Request) {
+	ip := clientAddress(r)
+	if fm.bans.banned(ip, "", time.Now()) {
+		http.Error(w, "banned", http.StatusForbidden)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.WithError(err).Error("unable to upgrade connection")
+		log.WithContext(r.Context()).WithError(err).Error("unable to upgrade connection")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	u1, err := uuid.NewV1()
 	if err != nil {
-		log.WithError(err).Error("unable to generate UUID")
+		log.WithContext(r.Context()).WithError(err).Error("unable to generate UUID")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	now := time.Now()
 	c := &fusionClient{
 		id:              u1.String(),
 		conn:            conn,
-		lastMessageTime: time.Now(),
+		lastMessageTime: now,
 		userAgent:       r.UserAgent(),
+		ip:              ip,
+		connected:       now,
 	}
+	fm.usage.countClient(r)
 	fm.addClient <- c
 }
-func (fm *fusionManager) router(auth func(http.Handler) http.Handler) http.Handler {
+func (fm *fusionManager) router(auth func(http.Handler) http.Handler, internal bool) http.Handler {
 	r := chi.NewRouter()
 	r.HandleFunc("/", fm.webSocketHandler)
-	r.With(auth).Get("/debug", fm.debugHandler)
-	r.With(auth).Get("/export", fm.exportHandler)
+	if internal {
+		r.With(auth).Get("/debug", fm.debugHandler)
+		r.With(auth).Get("/export", fm.exportHandler)
+		r.With(auth).Get("/clients", fm.clientsHandler)
+		r.With(auth).Delete("/clients", fm.disconnectHandler)
+		r.With(auth).Get("/bans", fm.bansHandler)
+		r.With(auth).Post("/bans/create", fm.bansCreateHandler)
+		r.With(auth).Delete("/bans", fm.bansDeleteHandler)
+	}
 	return r
 }
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// fusionModerationChannel is used to send disconnections and bans to every
+// instance, since an administrator's request may not be served by the
+// instance that the client is connected to.
+const fusionModerationChannel = "fusion.moderation"
+
+// Actions that administrators can take against Fusion clients.
+const (
+	moderationDisconnect = "disconnect"
+	moderationBan        = "ban"
+	moderationUnban      = "unban"
+)
+
+// fusionModeration is broadcast to every instance to act on a client.
+type fusionModeration struct {
+	Action   string    `json:"action"`
+	ClientID string    `json:"client_id,omitempty"`
+	Ban      fusionBan `json:"ban"`
+}
+
+// fusionBan keeps clients with an IP address or resume token from connecting
+// until Until. Only one of IP and Token is set.
+type fusionBan struct {
+	IP    string    `json:"ip,omitempty"`
+	Token string    `json:"token,omitempty"`
+	Until time.Time `json:"until"`
+}
+
+func (fb fusionBan) key() string {
+	if fb.IP != "" {
+		return "ip:" + fb.IP
+	}
+	return "token:" + fb.Token
+}
+
+// fusionBans holds the bans that haven't expired. They're checked by HTTP
+// handlers as well as fusionManager's run, so they're behind a lock. A nil
+// fusionBans bans nobody.
+type fusionBans struct {
+	lock sync.Mutex
+	bans map[string]fusionBan
+}
+
+func newFusionBans() *fusionBans {
+	return &fusionBans{bans: map[string]fusionBan{}}
+}
+
+func (fbs *fusionBans) add(fb fusionBan, now time.Time) {
+	fbs.lock.Lock()
+	defer fbs.lock.Unlock()
+	for key, ban := range fbs.bans {
+		if !now.Before(ban.Until) {
+			delete(fbs.bans, key)
+		}
+	}
+	fbs.bans[fb.key()] = fb
+}
+
+func (fbs *fusionBans) remove(fb fusionBan) {
+	fbs.lock.Lock()
+	defer fbs.lock.Unlock()
+	delete(fbs.bans, fb.key())
+}
+
+// banned returns whether an IP address or resume token is banned. Either can
+// be empty.
+func (fbs *fusionBans) banned(ip, token string, now time.Time) bool {
+	if fbs == nil {
+		return false
+	}
+	fbs.lock.Lock()
+	defer fbs.lock.Unlock()
+	for _, fb := range []fusionBan{{IP: ip}, {Token: token}} {
+		if fb.IP == "" && fb.Token == "" {
+			continue
+		}
+		if ban, ok := fbs.bans[fb.key()]; ok && now.Before(ban.Until) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the bans that haven't expired, the soonest to expire first.
+func (fbs *fusionBans) list(now time.Time) []fusionBan {
+	fbs.lock.Lock()
+	defer fbs.lock.Unlock()
+	bans := []fusionBan{}
+	for _, ban := range fbs.bans {
+		if now.Before(ban.Until) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.Before(bans[j].Until)
+	})
+	return bans
+}
+
+// processModeration acts on a moderation from any instance.
+func (fm *fusionManager) processModeration(payload string) {
+	fmod := fusionModeration{}
+	if err := json.Unmarshal([]byte(payload), &fmod); err != nil {
+		log.WithError(err).Error("unable to unmarshal moderation")
+		return
+	}
+
+	switch fmod.Action {
+	case moderationDisconnect:
+		fm.disconnectClient(fmod.ClientID, "disconnected by an administrator")
+	case moderationBan:
+		fm.bans.add(fmod.Ban, time.Now())
+		for id, client := range fm.clients {
+			if (fmod.Ban.IP != "" && client.ip == fmod.Ban.IP) || (fmod.Ban.Token != "" && client.token == fmod.Ban.Token) {
+				fm.disconnectClient(id, "banned")
+			}
+		}
+		if fmod.Ban.Token != "" {
+			delete(fm.sessions, fmod.Ban.Token)
+		}
+	case moderationUnban:
+		fm.bans.remove(fmod.Ban)
+	default:
+		log.Errorf("unknown moderation action \"%s\"", fmod.Action)
+	}
+}
+
+// disconnectClient removes a client and closes its connection, telling it why.
+// Banned clients can't resume their sessions.
+func (fm *fusionManager) disconnectClient(clientID, reason string) {
+	client, ok := fm.clients[clientID]
+	if !ok {
+		return
+	}
+	fm.processRemoveClient(clientID)
+	if reason == "banned" {
+		delete(fm.sessions, client.token)
+	}
+
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	if err := client.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+		log.WithError(err).Warn("unable to write close message")
+	}
+	if err := client.conn.Close(); err != nil {
+		log.WithError(err).Warn("unable to close connection")
+	}
+}
+
+// moderate sends a moderation to every instance, writing an error response if
+// it can't.
+func (fm *fusionManager) moderate(w http.ResponseWriter, r *http.Request, fmod fusionModeration) bool {
+	b, err := json.Marshal(fmod)
+	if err == nil {
+		err = fm.bs.Broadcast(fusionModerationChannel, string(b))
+	}
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to broadcast moderation")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// fusionClientInfo describes a client connected to this instance.
+type fusionClientInfo struct {
+	ID          string    `json:"id"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	Token       string    `json:"token"`
+	Connected   time.Time `json:"connected"`
+	LastMessage time.Time `json:"last_message"`
+	Topics      []string  `json:"topics"`
+}
+
+// clientsHandler lists the clients connected to this instance, the most
+// recently connected first.
+func (fm *fusionManager) clientsHandler(w http.ResponseWriter, r *http.Request) {
+	fmDebug := fm.debugInfo()
+	clients := make([]fusionClientInfo, 0, len(fmDebug.clients))
+	for _, client := range fmDebug.clients {
+		info := fusionClientInfo{
+			ID:          client.id,
+			IP:          client.ip,
+			UserAgent:   client.userAgent,
+			Token:       client.token,
+			Connected:   client.connected,
+			LastMessage: client.lastMessageTime,
+			Topics:      []string{},
+		}
+		for topic, subs := range fmDebug.subscriptions {
+			for _, id := range subs {
+				if id == client.id {
+					info.Topics = append(info.Topics, topic)
+				}
+			}
+		}
+		sort.Strings(info.Topics)
+		clients = append(clients, info)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Connected.After(clients[j].Connected)
+	})
+	WriteJSON(w, clients)
+}
+
+// disconnectHandler disconnects the client with the ID in the query string,
+// whichever instance it's connected to. It can reconnect right away, so ban
+// it to keep it away.
+func (fm *fusionManager) disconnectHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	fm.moderate(w, r, fusionModeration{Action: moderationDisconnect, ClientID: id})
+}
+
+// fusionBanRequest is the body of a request to ban an IP address or resume
+// token for a duration, e.g. "2h".
+type fusionBanRequest struct {
+	IP       string `json:"ip"`
+	Token    string `json:"token"`
+	Duration string `json:"duration"`
+}
+
+// bansHandler lists the bans that haven't expired.
+func (fm *fusionManager) bansHandler(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, fm.bans.list(time.Now()))
+}
+
+// bansCreateHandler bans an IP address or resume token on every instance and
+// disconnects the clients using it.
+func (fm *fusionManager) bansCreateHandler(w http.ResponseWriter, r *http.Request) {
+	req := fusionBanRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ban, err := req.ban(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if fm.moderate(w, r, fusionModeration{Action: moderationBan, Ban: ban}) {
+		WriteJSON(w, ban)
+	}
+}
+
+// ban validates a ban request and returns the ban it asks for.
+func (req fusionBanRequest) ban(now time.Time) (fusionBan, error) {
+	if (req.IP == "") == (req.Token == "") {
+		return fusionBan{}, fmt.Errorf("exactly one of ip and token is required")
+	}
+	if req.IP != "" && net.ParseIP(req.IP) == nil {
+		return fusionBan{}, fmt.Errorf("ip must be an IP address")
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil || d <= 0 {
+		return fusionBan{}, fmt.Errorf("duration must be a positive duration, e.g. 2h")
+	}
+	return fusionBan{IP: req.IP, Token: req.Token, Until: now.Add(d)}, nil
+}
+
+// bansDeleteHandler lifts the ban on the ip or token in the query string on
+// every instance.
+func (fm *fusionManager) bansDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ban := fusionBan{IP: r.URL.Query().Get("ip"), Token: r.URL.Query().Get("token")}
+	if (ban.IP == "") == (ban.Token == "") {
+		http.Error(w, "exactly one of ip and token is required", http.StatusBadRequest)
+		return
+	}
+	fm.moderate(w, r, fusionModeration{Action: moderationUnban, Ban: ban})
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFusionBans(t *testing.T) {
+	now := time.Now()
+	fbs := newFusionBans()
+	fbs.add(fusionBan{IP: "192.0.2.1", Until: now.Add(time.Hour)}, now)
+	fbs.add(fusionBan{Token: "abc", Until: now.Add(time.Minute)}, now)
+
+	for _, c := range []struct {
+		ip     string
+		token  string
+		now    time.Time
+		banned bool
+	}{
+		{"192.0.2.1", "", now, true},
+		{"192.0.2.2", "", now, false},
+		{"", "abc", now, true},
+		{"192.0.2.2", "abc", now, true},
+		{"", "", now, false},
+		{"", "abc", now.Add(2 * time.Minute), false},
+		{"192.0.2.1", "", now.Add(2 * time.Hour), false},
+	} {
+		if banned := fbs.banned(c.ip, c.token, c.now); banned != c.banned {
+			t.Errorf("%q %q at %s: got %t, expected %t", c.ip, c.token, c.now, banned, c.banned)
+		}
+	}
+
+	if bans := fbs.list(now); len(bans) != 2 || bans[0].Token != "abc" {
+		t.Errorf("got %+v, expected the token's ban first since it expires first", bans)
+	}
+	fbs.remove(fusionBan{IP: "192.0.2.1"})
+	if fbs.banned("192.0.2.1", "", now) {
+		t.Error("expected the IP address to be unbanned")
+	}
+
+	var nilBans *fusionBans
+	if nilBans.banned("192.0.2.1", "abc", now) {
+		t.Error("expected nil bans to ban nobody")
+	}
+}
+
+func TestFusionBanRequest(t *testing.T) {
+	now := time.Now()
+	for _, c := range []struct {
+		req fusionBanRequest
+		err bool
+	}{
+		{fusionBanRequest{IP: "192.0.2.1", Duration: "2h"}, false},
+		{fusionBanRequest{IP: "2001:db8::1", Duration: "30m"}, false},
+		{fusionBanRequest{Token: "abc", Duration: "1h"}, false},
+		{fusionBanRequest{Duration: "1h"}, true},
+		{fusionBanRequest{IP: "192.0.2.1", Token: "abc", Duration: "1h"}, true},
+		{fusionBanRequest{IP: "somewhere", Duration: "1h"}, true},
+		{fusionBanRequest{IP: "192.0.2.1", Duration: "forever"}, true},
+		{fusionBanRequest{IP: "192.0.2.1", Duration: "-1h"}, true},
+	} {
+		ban, err := c.req.ban(now)
+		if (err != nil) != c.err {
+			t.Errorf("%+v: got error %v", c.req, err)
+		}
+		if err == nil && ban.Until.Sub(now) <= 0 {
+			t.Errorf("%+v: got %+v, expected the ban to end in the future", c.req, ban)
+		}
+	}
+}
+
+func TestFusionModerationBan(t *testing.T) {
+	fm := &fusionManager{
+		clients:       map[string]*fusionClient{},
+		subscriptions: map[string][]string{},
+		sessions:      map[string]*fusionSession{},
+		bans:          newFusionBans(),
+	}
+	bannedConn, bannedClientConn := websocketPair(t)
+	fm.clients["banned"] = &fusionClient{id: "banned", conn: bannedConn, ip: "192.0.2.1", token: "abc"}
+	fm.sessions["abc"] = &fusionSession{clientID: "banned"}
+	otherConn, _ := websocketPair(t)
+	fm.clients["other"] = &fusionClient{id: "other", conn: otherConn, ip: "192.0.2.2", token: "def"}
+	fm.addSubscription("other", "eta")
+
+	b, err := json.Marshal(fusionModeration{Action: moderationBan, Ban: fusionBan{IP: "192.0.2.1", Until: time.Now().Add(time.Hour)}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fm.processModeration(string(b))
+
+	if _, ok := fm.clients["banned"]; ok || len(fm.clients) != 1 {
+		t.Errorf("got clients %v, expected only the banned client to be disconnected", fm.clients)
+	}
+	if _, ok := fm.sessions["abc"]; ok {
+		t.Error("expected the banned client's session to not be resumable")
+	}
+	_, _, err = bannedClientConn.ReadMessage()
+	if ce, ok := err.(*websocket.CloseError); !ok || ce.Code != websocket.ClosePolicyViolation || ce.Text != "banned" {
+		t.Errorf("got %v, expected to be told about the ban", err)
+	}
+
+	b, err = json.Marshal(fusionModeration{Action: moderationDisconnect, ClientID: "other"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fm.processModeration(string(b))
+	if len(fm.clients) != 0 || len(fm.subscriptions["eta"]) != 0 {
+		t.Errorf("got clients %v and subscriptions %v, expected the other client to be disconnected", fm.clients, fm.subscriptions)
+	}
+}
+
+func TestWebSocketHandlerBanned(t *testing.T) {
+	fm := &fusionManager{bans: newFusionBans()}
+	fm.bans.add(fusionBan{IP: "192.0.2.1", Until: time.Now().Add(time.Hour)}, time.Now())
+
+	req := httptest.NewRequest("GET", "/fusion/", nil)
+	req.RemoteAddr = "192.0.2.1:51234"
+	// clients can't get around bans by claiming to be someone else
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	w := httptest.NewRecorder()
+	fm.webSocketHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, expected %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// clockSyncSamples is how many clock messages are sent to each client after
+// it connects to estimate how far off its clock is.
+const clockSyncSamples = 3
+
+// fusionClock is sent to a client with ServerTime, and the client replies
+// with the same ServerTime and its own clock's time as ClientTime, like an
+// NTP request.
+type fusionClock struct {
+	ServerTime time.Time  `json:"server_time"`
+	ClientTime *time.Time `json:"client_time,omitempty"`
+
+	// received is when the client's reply was read.
+	received time.Time
+}
+
+func (fc *fusionClock) validate() error {
+	if fc.ServerTime.IsZero() {
+		return fmt.Errorf("server_time is required")
+	}
+	if fc.ClientTime == nil || fc.ClientTime.IsZero() {
+		return fmt.Errorf("client_time is required")
+	}
+	return nil
+}
+
+// clockEstimate is how far ahead of the server a client's clock is. It uses
+// the sample with the shortest round trip, since network delay in either
+// direction makes the estimate worse.
+type clockEstimate struct {
+	offset  time.Duration
+	rtt     time.Duration
+	samples int
+
+	// pending is the ServerTime of the clock message that the client hasn't
+	// replied to yet, if any.
+	pending time.Time
+}
+
+// add estimates the offset from a clock message sent at sent that the
+// client replied to at clientTime by its clock and that was received at
+// received, assuming that the reply was made halfway through the round trip.
+func (ce *clockEstimate) add(sent, clientTime, received time.Time) {
+	rtt := received.Sub(sent)
+	if rtt < 0 {
+		return
+	}
+	offset := clientTime.Sub(sent.Add(rtt / 2))
+	ce.samples++
+	if ce.samples == 1 || rtt < ce.rtt {
+		ce.offset = offset
+		ce.rtt = rtt
+	}
+}
+
+// captured returns when a position received at received was captured
+// according to clientTime, the client's clock, corrected by the estimated
+// offset. It returns received if either is unknown, and positions can't have
+// been captured after they were received.
+func (ce clockEstimate) captured(clientTime *time.Time, received time.Time) time.Time {
+	if clientTime == nil || ce.samples == 0 {
+		return received
+	}
+	captured := clientTime.Add(-ce.offset)
+	if captured.After(received) {
+		return received
+	}
+	return captured
+}
+
+// sendClock sends a client a clock message to reply to.
+func (fm *fusionManager) sendClock(client *fusionClient, now time.Time) {
+	client.clock.pending = now
+	fme := fusionMessageEnvelope{
+		Type:    "clock",
+		Message: fusionClock{ServerTime: now},
+	}
+	fm.sendToClient(client.id, fme)
+}
+
+// handleMsgClock updates a client's clock estimate with its reply to a clock
+// message, and sends another until there are enough samples.
+func (fm *fusionManager) handleMsgClock(clientID string, fc fusionClock) {
+	client, ok := fm.clients[clientID]
+	if !ok {
+		return
+	}
+	if client.clock.pending.IsZero() || !fc.ServerTime.Equal(client.clock.pending) {
+		fm.rejectMessage(clientID, "clock", fmt.Errorf("server_time must be from the last clock message"))
+		return
+	}
+	client.clock.pending = time.Time{}
+	client.clock.add(fc.ServerTime, *fc.ClientTime, fc.received)
+	if client.clock.samples < clockSyncSamples {
+		fm.sendClock(client, time.Now())
+	}
+}
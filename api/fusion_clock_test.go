@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClockEstimate(t *testing.T) {
+	sent := time.Date(2020, 1, 2, 8, 0, 0, 0, time.UTC)
+	ce := clockEstimate{}
+	clientTime := sent.Add(-time.Minute)
+	if captured := ce.captured(&clientTime, sent); !captured.Equal(sent) {
+		t.Errorf("got %s, expected the receive time without an estimate", captured)
+	}
+
+	// the client's clock is 30 seconds ahead, and the round trip took 2 seconds
+	ce.add(sent, sent.Add(31*time.Second), sent.Add(2*time.Second))
+	if ce.offset != 30*time.Second || ce.rtt != 2*time.Second {
+		t.Errorf("got offset %s and round trip %s, expected 30s and 2s", ce.offset, ce.rtt)
+	}
+
+	// a slower round trip is less accurate, so it's ignored
+	ce.add(sent, sent.Add(40*time.Second), sent.Add(10*time.Second))
+	if ce.offset != 30*time.Second || ce.samples != 2 {
+		t.Errorf("got offset %s after %d samples, expected the faster sample to be kept", ce.offset, ce.samples)
+	}
+	// and a faster one is more accurate
+	ce.add(sent, sent.Add(29*time.Second+500*time.Millisecond), sent.Add(time.Second))
+	if ce.offset != 29*time.Second {
+		t.Errorf("got offset %s, expected 29s", ce.offset)
+	}
+
+	received := sent.Add(time.Hour)
+	clientTime = received.Add(29*time.Second - 5*time.Second)
+	if captured := ce.captured(&clientTime, received); !captured.Equal(received.Add(-5 * time.Second)) {
+		t.Errorf("got %s, expected five seconds before it was received", captured)
+	}
+	clientTime = received.Add(time.Minute)
+	if captured := ce.captured(&clientTime, received); !captured.Equal(received) {
+		t.Errorf("got %s, expected positions to not be captured after they're received", captured)
+	}
+	if captured := ce.captured(nil, received); !captured.Equal(received) {
+		t.Errorf("got %s, expected the receive time without a client time", captured)
+	}
+}
+
+func TestFusionClock(t *testing.T) {
+	fm := &fusionManager{
+		serverMsg: make(chan serverMessage, 10),
+		clients:   map[string]*fusionClient{},
+		tracks:    map[string][]fusionPosition{},
+	}
+	client := &fusionClient{id: "client"}
+	fm.clients[client.id] = client
+
+	sent := time.Now()
+	fm.sendClock(client, sent)
+	b, err := json.Marshal((<-fm.serverMsg).msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(string(b), `"type":"clock"`) || strings.Contains(string(b), "client_time") {
+		t.Errorf("got %s, expected a clock message with only the server's time", b)
+	}
+
+	// replies have to be to the last clock message
+	clientTime := sent.Add(time.Minute)
+	fm.handleMsgClock(client.id, fusionClock{ServerTime: sent.Add(-time.Second), ClientTime: &clientTime, received: sent.Add(time.Second)})
+	if fme := (<-fm.serverMsg).msg.(fusionMessageEnvelope); fme.Type != "error" || client.clock.samples != 0 {
+		t.Errorf("got %+v, expected an error", fme)
+	}
+
+	fm.handleMsgClock(client.id, fusionClock{ServerTime: sent, ClientTime: &clientTime, received: sent.Add(2 * time.Second)})
+	if client.clock.samples != 1 || client.clock.offset != time.Minute-time.Second {
+		t.Errorf("got %+v, expected an offset of 59s", client.clock)
+	}
+	if fme := (<-fm.serverMsg).msg.(fusionMessageEnvelope); fme.Type != "clock" {
+		t.Errorf("got %+v, expected another clock message", fme)
+	}
+
+	received := time.Now()
+	clientTime = received.Add(time.Minute - time.Second - 3*time.Second)
+	fm.handleMsgPosition(client.id, fusionPosition{Track: "t", Time: received, ClientTime: &clientTime})
+	fp := fm.tracks["t"][0]
+	if !fp.Time.Equal(received) || !fp.Captured.Equal(received.Add(-3*time.Second)) {
+		t.Errorf("got %+v, expected it to be captured three seconds before it was received", fp)
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// stopCountdownInterval is how often countdowns are sent to stop arrivals
+// topics.
+const stopCountdownInterval = 5 * time.Second
+
+// stopCountdownArrivals is how many arrivals each countdown lists.
+const stopCountdownArrivals = 3
+
+// stopArrivalsTopicPattern is how stop arrivals topics are listed, since
+// there's one for each Stop.
+const stopArrivalsTopicPattern = "stop.{id}.arrivals"
+
+// stopArrivalsTopic returns the name of a Stop's arrivals topic.
+func stopArrivalsTopic(stopID int64) string {
+	return fmt.Sprintf("stop.%d.arrivals", stopID)
+}
+
+// stopArrivalsTopicStop returns the ID of the Stop whose arrivals topic this
+// is, or false if it isn't one.
+func stopArrivalsTopicStop(topic string) (int64, bool) {
+	if !strings.HasPrefix(topic, "stop.") || !strings.HasSuffix(topic, ".arrivals") {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(topic[len("stop."):len(topic)-len(".arrivals")], 10, 64)
+	if err != nil || id < 1 {
+		return 0, false
+	}
+	return id, true
+}
+
+// countdownArrival is a Vehicle expected at a Stop.
+type countdownArrival struct {
+	VehicleID int64 `json:"vehicle_id"`
+	RouteID   int64 `json:"route_id"`
+
+	// Seconds is how long until the Vehicle arrives, or 0 if it's arriving.
+	Seconds int64 `json:"seconds"`
+}
+
+// stopCountdown is the next arrivals at one Stop, kept small for displays
+// that only show that Stop.
+type stopCountdown struct {
+	StopID    int64              `json:"stop_id"`
+	Generated time.Time          `json:"generated"`
+	Stale     bool               `json:"stale"`
+	Arrivals  []countdownArrival `json:"arrivals"`
+}
+
+// watchStopCountdowns works out the next arrivals at every Stop every
+// interval and hands them to run to send to each Stop's subscribers.
+func (fm *fusionManager) watchStopCountdowns(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for now := range ticker.C {
+		fm.countdowns <- stopCountdowns(fm.em.CurrentETAs(), fm.visibility, now)
+	}
+}
+
+// stopCountdowns returns the next arrivals at each Stop that has ETAs, soonest
+// first, leaving out those on hidden Routes.
+func stopCountdowns(etas map[int64]shuttletracker.VehicleETA, visibility *routeVisibility, now time.Time) map[int64]stopCountdown {
+	stale := etasStale()
+	countdowns := map[int64]stopCountdown{}
+	for _, vehicleETA := range etas {
+		routeID := vehicleETA.RouteID
+		if visibility.hidden(&routeID, now) {
+			continue
+		}
+		for _, stopETA := range vehicleETA.StopETAs {
+			if stopETA.ETA.Before(now) && !stopETA.Arriving {
+				continue
+			}
+			seconds := int64(0)
+			if !stopETA.Arriving {
+				seconds = int64(math.Ceil(stopETA.ETA.Sub(now).Seconds()))
+			}
+			countdown, ok := countdowns[stopETA.StopID]
+			if !ok {
+				countdown = stopCountdown{StopID: stopETA.StopID, Generated: now, Stale: stale}
+			}
+			countdown.Arrivals = append(countdown.Arrivals, countdownArrival{
+				VehicleID: vehicleETA.VehicleID,
+				RouteID:   routeID,
+				Seconds:   seconds,
+			})
+			countdowns[stopETA.StopID] = countdown
+		}
+	}
+	for id, countdown := range countdowns {
+		sort.Slice(countdown.Arrivals, func(i, j int) bool {
+			a, b := countdown.Arrivals[i], countdown.Arrivals[j]
+			if a.Seconds != b.Seconds {
+				return a.Seconds < b.Seconds
+			}
+			return a.VehicleID < b.VehicleID
+		})
+		if len(countdown.Arrivals) > stopCountdownArrivals {
+			countdown.Arrivals = countdown.Arrivals[:stopCountdownArrivals]
+		}
+		countdowns[id] = countdown
+	}
+	return countdowns
+}
+
+// processCountdowns sends the latest countdowns to the arrivals topic of each
+// Stop that has subscribers, including Stops without any arrivals, and keeps
+// them for new subscribers.
+func (fm *fusionManager) processCountdowns(countdowns map[int64]stopCountdown, now time.Time) {
+	fm.lastCountdowns = countdowns
+	fm.lastCountdownsAt = now
+	for topic, subs := range fm.subscriptions {
+		stopID, ok := stopArrivalsTopicStop(topic)
+		if !ok || len(subs) == 0 {
+			continue
+		}
+		fm.processServerMessage(serverMessage{
+			topic: topic,
+			key:   topic,
+			msg:   fm.countdownMessage(stopID),
+		})
+	}
+}
+
+// handleStopArrivalsSubscribe sends a new subscriber the latest countdown for
+// a Stop right away instead of making it wait for the next one.
+func (fm *fusionManager) handleStopArrivalsSubscribe(clientID string, stopID int64) {
+	if fm.lastCountdownsAt.IsZero() {
+		return
+	}
+	fm.processServerMessage(serverMessage{
+		clientID: clientID,
+		msg:      fm.countdownMessage(stopID),
+	})
+}
+
+// forgetTopic drops the history of a stop arrivals topic once nobody is
+// subscribed to it and no session will resume it. Other topics are few and
+// are kept.
+func (fm *fusionManager) forgetTopic(topic string) {
+	if _, ok := stopArrivalsTopicStop(topic); !ok || len(fm.subscriptions[topic]) > 0 {
+		return
+	}
+	for _, session := range fm.sessions {
+		for _, t := range session.topics {
+			if t == topic {
+				return
+			}
+		}
+	}
+	fm.replay.forget(topic)
+}
+
+// countdownMessage returns a message with the latest countdown for a Stop.
+func (fm *fusionManager) countdownMessage(stopID int64) fusionMessageEnvelope {
+	countdown, ok := fm.lastCountdowns[stopID]
+	if !ok {
+		countdown = stopCountdown{
+			StopID:    stopID,
+			Generated: fm.lastCountdownsAt,
+			Stale:     etasStale(),
+			Arrivals:  []countdownArrival{},
+		}
+	}
+	return fusionMessageEnvelope{
+		Type:    "stop_arrivals",
+		Message: countdown,
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestStopArrivalsTopicStop(t *testing.T) {
+	for topic, expected := range map[string]int64{
+		"stop.12.arrivals":       12,
+		stopArrivalsTopic(3):     3,
+		"stop.0.arrivals":        0,
+		"stop.-1.arrivals":       0,
+		"stop.x.arrivals":        0,
+		"stop.12":                0,
+		stopArrivalsTopicPattern: 0,
+		"eta":                    0,
+	} {
+		id, ok := stopArrivalsTopicStop(topic)
+		if id != expected || ok != (expected != 0) {
+			t.Errorf("got %d, %t for %q", id, ok, topic)
+		}
+		if err := validateTopic(topic); (err == nil) != (expected != 0 || topic == "eta") {
+			t.Errorf("got %v validating %q", err, topic)
+		}
+	}
+}
+
+func TestStopCountdowns(t *testing.T) {
+	now := time.Now()
+	etas := map[int64]shuttletracker.VehicleETA{
+		1: {VehicleID: 1, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(-10 * time.Second), Arriving: true},
+			{StopID: 2, ETA: now.Add(90 * time.Second)},
+		}},
+		2: {VehicleID: 2, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			// passed
+			{StopID: 1, ETA: now.Add(-time.Minute)},
+			{StopID: 2, ETA: now.Add(30 * time.Second)},
+		}},
+		3: {VehicleID: 3, RouteID: 2, StopETAs: []shuttletracker.StopETA{
+			{StopID: 2, ETA: now.Add(5 * time.Minute)},
+		}},
+		4: {VehicleID: 4, RouteID: 2, StopETAs: []shuttletracker.StopETA{
+			{StopID: 2, ETA: now.Add(10 * time.Minute)},
+		}},
+	}
+	countdowns := stopCountdowns(etas, nil, now)
+	if len(countdowns) != 2 {
+		t.Fatalf("got %d countdowns, expected 2", len(countdowns))
+	}
+	if arrivals := countdowns[1].Arrivals; len(arrivals) != 1 || arrivals[0].VehicleID != 1 || arrivals[0].Seconds != 0 {
+		t.Errorf("got %+v at stop 1", arrivals)
+	}
+	arrivals := countdowns[2].Arrivals
+	expected := []countdownArrival{{2, 1, 30}, {1, 1, 90}, {3, 2, 300}}
+	if len(arrivals) != len(expected) {
+		t.Fatalf("got %+v at stop 2, expected %+v", arrivals, expected)
+	}
+	for i := range expected {
+		if arrivals[i] != expected[i] {
+			t.Errorf("got %+v at stop 2, expected %+v", arrivals, expected)
+			break
+		}
+	}
+}
+
+func TestProcessCountdowns(t *testing.T) {
+	now := time.Now()
+	fm := &fusionManager{
+		batch: newTopicBatch(),
+		subscriptions: map[string][]string{
+			"stop.1.arrivals": {"a"},
+			"stop.2.arrivals": {"b"},
+			"stop.3.arrivals": {},
+			"eta":             {"a"},
+		},
+	}
+	fm.processCountdowns(map[int64]stopCountdown{
+		1: {StopID: 1, Generated: now, Arrivals: []countdownArrival{{VehicleID: 1, RouteID: 1, Seconds: 60}}},
+		4: {StopID: 4, Generated: now, Arrivals: []countdownArrival{{VehicleID: 2, RouteID: 1, Seconds: 60}}},
+	}, now)
+
+	sent := map[string]stopCountdown{}
+	for _, sm := range fm.batch.messages {
+		fme := sm.msg.(fusionMessageEnvelope)
+		if fme.Type != "stop_arrivals" {
+			t.Errorf("got %s message", fme.Type)
+		}
+		sent[sm.topic] = fme.Message.(stopCountdown)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("got messages on %d topics, expected 2", len(sent))
+	}
+	if c := sent["stop.1.arrivals"]; len(c.Arrivals) != 1 || c.StopID != 1 {
+		t.Errorf("got %+v for stop 1", c)
+	}
+	// stops without arrivals get empty countdowns
+	if c := sent["stop.2.arrivals"]; c.Arrivals == nil || len(c.Arrivals) != 0 || c.StopID != 2 || !c.Generated.Equal(now) {
+		t.Errorf("got %+v for stop 2", c)
+	}
+}
+
+func TestStopArrivalsSubscriptions(t *testing.T) {
+	ms := &mock.ModelService{}
+	stops := []*shuttletracker.Stop{}
+	for id := int64(1); id <= maxClientSubscriptions+1; id++ {
+		stops = append(stops, &shuttletracker.Stop{ID: id})
+	}
+	ms.StopService.On("Stops").Return(stops, nil)
+	fm := &fusionManager{
+		serverMsg:     make(chan serverMessage, 10),
+		subscriptions: map[string][]string{},
+		sessions:      map[string]*fusionSession{},
+		replay:        newReplayLog(10),
+		stops:         newKnownStops(ms),
+	}
+	rejected := func() bool {
+		select {
+		case sm := <-fm.serverMsg:
+			return sm.msg.(fusionMessageEnvelope).Type == "error"
+		default:
+			return false
+		}
+	}
+
+	fm.handleMsgSubscribe("a", fusionMessageSubscribe{Topic: stopArrivalsTopic(9999999999)})
+	if !rejected() || len(fm.subscriptions) != 0 {
+		t.Errorf("subscribed to a stop that doesn't exist: %v", fm.subscriptions)
+	}
+
+	for id := int64(1); id <= maxClientSubscriptions; id++ {
+		fm.handleMsgSubscribe("a", fusionMessageSubscribe{Topic: stopArrivalsTopic(id)})
+		if rejected() {
+			t.Fatalf("rejected subscription %d", id)
+		}
+	}
+	fm.handleMsgSubscribe("a", fusionMessageSubscribe{Topic: stopArrivalsTopic(1)})
+	if rejected() {
+		t.Error("rejected subscribing again")
+	}
+	fm.handleMsgSubscribe("a", fusionMessageSubscribe{Topic: stopArrivalsTopic(maxClientSubscriptions + 1)})
+	if !rejected() || len(fm.subscriptions) != maxClientSubscriptions {
+		t.Errorf("got %d subscriptions, expected %d", len(fm.subscriptions), maxClientSubscriptions)
+	}
+
+	// topics without subscribers are forgotten
+	topic := stopArrivalsTopic(1)
+	if _, err := fm.replay.add(topic, fusionMessageEnvelope{Type: "stop_arrivals"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fm.handleMsgSubscribe("b", fusionMessageSubscribe{Topic: topic})
+	fm.handleMsgUnsubscribe("a", fusionMessageUnsubscribe{Topic: topic})
+	if _, ok := fm.replay.topics[topic]; !ok {
+		t.Error("forgot a topic with a subscriber")
+	}
+	fm.handleMsgUnsubscribe("b", fusionMessageUnsubscribe{Topic: topic})
+	if _, ok := fm.subscriptions[topic]; ok {
+		t.Error("kept a topic without subscribers")
+	}
+	if _, ok := fm.replay.topics[topic]; ok {
+		t.Error("kept the history of a topic without subscribers")
+	}
+}
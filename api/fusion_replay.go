@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// replayMessage is a topic message that was sent, already marshaled.
+type replayMessage struct {
+	sequence uint64
+	topic    string
+	data     []byte
+}
+
+// topicHistory is a ring buffer of a topic's most recent messages.
+type topicHistory struct {
+	messages []replayMessage
+	next     int
+	count    int
+
+	// dropped is the sequence number of the newest message that has been
+	// overwritten, or zero if none have been.
+	dropped uint64
+}
+
+// replayLog numbers topic messages as they're sent and keeps the most recent
+// size messages on each topic so that clients can get what they missed.
+// Sequence numbers are shared by every topic, so a client only has to
+// remember the last one it received.
+type replayLog struct {
+	size     int
+	sequence uint64
+	topics   map[string]*topicHistory
+}
+
+func newReplayLog(size int) *replayLog {
+	return &replayLog{
+		size:   size,
+		topics: map[string]*topicHistory{},
+	}
+}
+
+// add numbers a topic message, marshals it, and keeps it, overwriting the
+// topic's oldest message if its history is full.
+func (rl *replayLog) add(topic string, fme fusionMessageEnvelope) ([]byte, error) {
+	fme.Sequence = rl.sequence + 1
+	b, err := json.Marshal(fme)
+	if err != nil {
+		return nil, err
+	}
+	rl.sequence++
+
+	th, ok := rl.topics[topic]
+	if !ok {
+		th = &topicHistory{messages: make([]replayMessage, rl.size)}
+		rl.topics[topic] = th
+	}
+	if rl.size == 0 {
+		th.dropped = rl.sequence
+		return b, nil
+	}
+	if th.count == rl.size {
+		th.dropped = th.messages[th.next].sequence
+	} else {
+		th.count++
+	}
+	th.messages[th.next] = replayMessage{rl.sequence, topic, b}
+	th.next = (th.next + 1) % rl.size
+	return b, nil
+}
+
+// forget drops a topic's history.
+func (rl *replayLog) forget(topic string) {
+	delete(rl.topics, topic)
+}
+
+// after returns a topic's messages numbered after sequence, oldest first. It
+// returns false if some of them have already been overwritten, or if sequence
+// is one that this log never handed out, e.g. because it came from another
+// instance.
+func (rl *replayLog) after(topic string, sequence uint64) ([]replayMessage, bool) {
+	if sequence > rl.sequence {
+		return nil, false
+	}
+	th, ok := rl.topics[topic]
+	if !ok {
+		return []replayMessage{}, true
+	}
+	if sequence < th.dropped {
+		return nil, false
+	}
+	missed := []replayMessage{}
+	for i := 0; i < th.count; i++ {
+		rm := th.messages[(th.next-th.count+i+rl.size)%rl.size]
+		if rm.sequence > sequence {
+			missed = append(missed, rm)
+		}
+	}
+	return missed, true
+}
+
+// fusionMessageReplay is sent by a client to get the messages on a topic that
+// it's subscribed to that were sent after Since, the last sequence number it
+// received.
+type fusionMessageReplay struct {
+	Topic string `json:"topic"`
+	Since uint64 `json:"since"`
+}
+
+func (fmr *fusionMessageReplay) validate() error {
+	if fmr.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	return validateTopic(fmr.Topic)
+}
+
+// fusionReplayed answers a fusionMessageReplay. If Complete is false, too
+// much was missed to replay it all, and the client gets the same messages as
+// when it first subscribed instead.
+type fusionReplayed struct {
+	Topic    string `json:"topic"`
+	Complete bool   `json:"complete"`
+	Replayed int    `json:"replayed"`
+}
+
+// handleMsgReplay sends a client the messages it missed on a topic.
+func (fm *fusionManager) handleMsgReplay(clientID string, fmr fusionMessageReplay) {
+	client, ok := fm.clients[clientID]
+	if !ok {
+		return
+	}
+	subscribed := false
+	for _, id := range fm.subscriptions[fmr.Topic] {
+		if id == clientID {
+			subscribed = true
+			break
+		}
+	}
+	if !subscribed {
+		fm.rejectMessage(clientID, "replay", fmt.Errorf("not subscribed to %s", fmr.Topic))
+		return
+	}
+
+	missed, ok := fm.replay.after(fmr.Topic, fmr.Since)
+	replayed := fusionReplayed{Topic: fmr.Topic, Complete: ok, Replayed: len(missed)}
+
+	// Write directly instead of through serverMsg, which would fill up.
+	b, err := json.Marshal(fusionMessageEnvelope{Type: "replay", Message: replayed})
+	if err != nil {
+		log.WithError(err).Error("unable to marshal")
+		return
+	}
+	fm.writeToClient(client, b)
+	for _, rm := range missed {
+		fm.writeToClient(client, rm.data)
+	}
+	if !ok {
+		for _, cb := range fm.subscribeCallbacks[fmr.Topic] {
+			cb(clientID)
+		}
+	}
+}
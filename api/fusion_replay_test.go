@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReplayLog(t *testing.T) {
+	rl := newReplayLog(2)
+	for _, topic := range []string{"eta", "bus_button", "eta", "eta"} {
+		if _, err := rl.add(topic, fusionMessageEnvelope{Type: topic}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// eta has messages 1, 3, and 4, but only keeps the last two
+	missed, ok := rl.after("eta", 1)
+	if !ok || len(missed) != 2 || missed[0].sequence != 3 || missed[1].sequence != 4 {
+		t.Errorf("got %+v and %t, expected messages 3 and 4", missed, ok)
+	}
+	if fme := (fusionMessageEnvelope{}); json.Unmarshal(missed[0].data, &fme) != nil || fme.Sequence != 3 {
+		t.Errorf("got %s, expected sequence 3", missed[0].data)
+	}
+	if _, ok := rl.after("eta", 0); ok {
+		t.Error("expected an overwritten message to not be replayable")
+	}
+	if missed, ok := rl.after("eta", 3); !ok || len(missed) != 1 || missed[0].sequence != 4 {
+		t.Errorf("got %+v and %t, expected message 4", missed, ok)
+	}
+
+	// other topics are kept separately
+	if missed, ok := rl.after("bus_button", 0); !ok || len(missed) != 1 || missed[0].sequence != 2 {
+		t.Errorf("got %+v and %t, expected message 2", missed, ok)
+	}
+	if missed, ok := rl.after("vehicle_location", 0); !ok || len(missed) != 0 {
+		t.Errorf("got %+v and %t, expected nothing missed on a topic without messages", missed, ok)
+	}
+
+	if missed, ok := rl.after("eta", 4); !ok || len(missed) != 0 {
+		t.Errorf("got %+v and %t, expected nothing missed", missed, ok)
+	}
+	if _, ok := rl.after("eta", 5); ok {
+		t.Error("expected a sequence that was never sent to not be replayable")
+	}
+}
+
+func TestReplayLogWithoutHistory(t *testing.T) {
+	rl := newReplayLog(0)
+	b, err := rl.add("eta", fusionMessageEnvelope{Type: "eta"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if fme := (fusionMessageEnvelope{}); json.Unmarshal(b, &fme) != nil || fme.Sequence != 1 {
+		t.Errorf("got %s, expected messages to still be numbered", b)
+	}
+	if _, ok := rl.after("eta", 0); ok {
+		t.Error("expected nothing to be replayable")
+	}
+	if _, ok := rl.after("eta", 1); !ok {
+		t.Error("expected a client that missed nothing to not need a replay")
+	}
+}
+
+func TestFusionReplay(t *testing.T) {
+	fm := &fusionManager{
+		serverMsg:          make(chan serverMessage, 10),
+		clients:            map[string]*fusionClient{},
+		subscriptions:      map[string][]string{},
+		subscribeCallbacks: map[string][]func(string){},
+		replay:             newReplayLog(2),
+	}
+	conn, clientConn := websocketPair(t)
+	fm.clients["client"] = &fusionClient{id: "client", conn: conn}
+	fm.addSubscription("client", "eta")
+	callbacks := 0
+	fm.subscribeCallbacks["eta"] = []func(string){func(string) { callbacks++ }}
+	for _, message := range []string{"received", "missed"} {
+		if _, err := fm.replay.add("eta", fusionMessageEnvelope{Type: "eta", Message: message}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	fm.handleMsgReplay("client", fusionMessageReplay{Topic: "eta", Since: 1})
+	replayed := struct {
+		Type    string         `json:"type"`
+		Message fusionReplayed `json:"message"`
+	}{}
+	if err := clientConn.ReadJSON(&replayed); err != nil {
+		t.Fatalf("unable to read: %s", err)
+	}
+	if replayed.Type != "replay" || !replayed.Message.Complete || replayed.Message.Replayed != 1 || replayed.Message.Topic != "eta" {
+		t.Errorf("got %+v, expected one replayed eta message", replayed)
+	}
+	fme := fusionMessageEnvelope{}
+	if err := clientConn.ReadJSON(&fme); err != nil {
+		t.Fatalf("unable to read: %s", err)
+	}
+	if fme.Message != "missed" || fme.Sequence != 2 {
+		t.Errorf("got %+v, expected the missed message", fme)
+	}
+	if callbacks != 0 {
+		t.Errorf("got %d subscribe callbacks, expected none", callbacks)
+	}
+
+	// too much was missed
+	if _, err := fm.replay.add("eta", fusionMessageEnvelope{Type: "eta", Message: "overflow"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fm.handleMsgReplay("client", fusionMessageReplay{Topic: "eta", Since: 0})
+	if err := clientConn.ReadJSON(&replayed); err != nil {
+		t.Fatalf("unable to read: %s", err)
+	}
+	if replayed.Message.Complete || callbacks != 1 {
+		t.Errorf("got %+v and %d callbacks, expected an incomplete replay and the subscribe callbacks", replayed, callbacks)
+	}
+
+	// clients can only replay topics they're subscribed to
+	fm.handleMsgReplay("client", fusionMessageReplay{Topic: "bus_button"})
+	sm := <-fm.serverMsg
+	if fme := sm.msg.(fusionMessageEnvelope); fme.Type != "error" {
+		t.Errorf("got %+v, expected an error", fme)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// fusionResumeGracePeriod is how long after a client disconnects that it can
+// resume its session by reconnecting with its resume token.
+const fusionResumeGracePeriod = 2 * time.Minute
+
+// fusionSession is what fusionManager remembers about a client so that it
+// can pick up where it left off after reconnecting.
+type fusionSession struct {
+	// clientID is the connected client using the session. It's empty
+	// while the session is waiting to be resumed.
+	clientID string
+
+	// topics are what the client was subscribed to when it disconnected.
+	topics       []string
+	disconnected time.Time
+}
+
+// fusionMessageResume is sent by a reconnecting client to restore the
+// subscriptions of the session with Token and get the topic messages after
+// Sequence, the last one it received.
+type fusionMessageResume struct {
+	Token    string `json:"token"`
+	Sequence uint64 `json:"sequence"`
+}
+
+// fusionResumed answers a fusionMessageResume. If the session couldn't be
+// resumed, e.g. because it expired, the client keeps the token it was given
+// when it connected and should subscribe again.
+type fusionResumed struct {
+	Resumed  bool `json:"resumed"`
+	Replayed int  `json:"replayed"`
+}
+
+// startSession gives a newly-connected client a session and sends it the
+// session's resume token. Tokens are random since they're all it takes to
+// take over a session.
+func (fm *fusionManager) startSession(client *fusionClient, now time.Time) {
+	for token, session := range fm.sessions {
+		if session.clientID == "" && now.Sub(session.disconnected) > fusionResumeGracePeriod {
+			delete(fm.sessions, token)
+			for _, topic := range session.topics {
+				fm.forgetTopic(topic)
+			}
+		}
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		log.WithError(err).Error("unable to generate resume token")
+		return
+	}
+	client.token = u.String()
+	fm.sessions[client.token] = &fusionSession{clientID: client.id}
+
+	fme := fusionMessageEnvelope{
+		Type:    "resume_token",
+		Message: client.token,
+	}
+	fm.sendToClient(client.id, fme)
+}
+
+// suspendSession remembers what a disconnecting client was subscribed to so
+// that it can resume its session.
+func (fm *fusionManager) suspendSession(client *fusionClient, now time.Time) {
+	session, ok := fm.sessions[client.token]
+	if !ok || session.clientID != client.id {
+		return
+	}
+	session.clientID = ""
+	session.disconnected = now
+	session.topics = fm.clientTopics(client.id)
+}
+
+// handleMsgResume moves a session to the client that asked for it, restores
+// the session's subscriptions, and replays the topic messages that it missed.
+// If too many were missed to replay, the client gets the same messages as when
+// it first subscribed instead.
+func (fm *fusionManager) handleMsgResume(clientID string, fmr fusionMessageResume) {
+	client, ok := fm.clients[clientID]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	session, ok := fm.sessions[fmr.Token]
+	if ok && session.clientID != "" && session.clientID != clientID {
+		// The old connection hasn't noticed that it's dead yet.
+		if old, ok := fm.clients[session.clientID]; ok {
+			fm.processRemoveClient(old.id)
+			if err := old.conn.Close(); err != nil {
+				log.WithError(err).Warn("unable to close replaced connection")
+			}
+		}
+	}
+	if !ok || session.clientID != "" || now.Sub(session.disconnected) > fusionResumeGracePeriod {
+		fm.sendToClient(clientID, fusionMessageEnvelope{Type: "resume", Message: fusionResumed{}})
+		return
+	}
+
+	delete(fm.sessions, client.token)
+	client.token = fmr.Token
+	session.clientID = clientID
+	topics := session.topics
+	session.topics = nil
+	for _, topic := range topics {
+		fm.addSubscription(clientID, topic)
+	}
+
+	// Topics that the client missed too much of get the same messages as
+	// when it first subscribed instead.
+	missed := []replayMessage{}
+	for _, topic := range topics {
+		messages, ok := fm.replay.after(topic, fmr.Sequence)
+		if !ok {
+			for _, cb := range fm.subscribeCallbacks[topic] {
+				cb(clientID)
+			}
+			continue
+		}
+		missed = append(missed, messages...)
+	}
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].sequence < missed[j].sequence
+	})
+	resumed := fusionResumed{Resumed: true, Replayed: len(missed)}
+
+	// Write directly instead of through serverMsg, which would fill up.
+	b, err := json.Marshal(fusionMessageEnvelope{Type: "resume", Message: resumed})
+	if err != nil {
+		log.WithError(err).Error("unable to marshal")
+		return
+	}
+	fm.writeToClient(client, b)
+	for _, rm := range missed {
+		fm.writeToClient(client, rm.data)
+	}
+}
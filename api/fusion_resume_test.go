@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketPair returns the server's and client's ends of a websocket connection.
+func websocketPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("unable to upgrade: %s", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("unable to dial: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return <-conns, client
+}
+
+func TestFusionResume(t *testing.T) {
+	fm := &fusionManager{
+		serverMsg:     make(chan serverMessage, 10),
+		clients:       map[string]*fusionClient{},
+		subscriptions: map[string][]string{},
+		sessions:      map[string]*fusionSession{},
+		replay:        newReplayLog(10),
+	}
+	now := time.Now()
+
+	oldConn, _ := websocketPair(t)
+	old := &fusionClient{id: "old", conn: oldConn}
+	fm.clients[old.id] = old
+	fm.startSession(old, now)
+	if sm := <-fm.serverMsg; sm.msg.(fusionMessageEnvelope).Message != old.token {
+		t.Fatalf("got %+v, expected the resume token", sm)
+	}
+	fm.addSubscription(old.id, "eta")
+	if _, err := fm.replay.add("eta", fusionMessageEnvelope{Type: "eta", Message: "received"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fm.processRemoveClient(old.id)
+
+	// sent while the client was disconnected
+	for _, topic := range []string{"eta", "bus_button"} {
+		if _, err := fm.replay.add(topic, fusionMessageEnvelope{Type: topic, Message: "missed"}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	newConn, clientConn := websocketPair(t)
+	client := &fusionClient{id: "new", conn: newConn}
+	fm.clients[client.id] = client
+	fm.startSession(client, now)
+	<-fm.serverMsg
+	fm.handleMsgResume(client.id, fusionMessageResume{Token: old.token, Sequence: 1})
+
+	if client.token != old.token || len(fm.sessions) != 1 {
+		t.Errorf("got token %s and %d sessions, expected the client to take over the old session", client.token, len(fm.sessions))
+	}
+	if subs := fm.subscriptions["eta"]; len(subs) != 1 || subs[0] != client.id {
+		t.Errorf("got eta subscribers %v, expected the new client", subs)
+	}
+
+	resumed := struct {
+		Type    string        `json:"type"`
+		Message fusionResumed `json:"message"`
+	}{}
+	if err := clientConn.ReadJSON(&resumed); err != nil {
+		t.Fatalf("unable to read: %s", err)
+	}
+	if resumed.Type != "resume" || !resumed.Message.Resumed || resumed.Message.Replayed != 1 {
+		t.Errorf("got %+v, expected one replayed message", resumed)
+	}
+	replayed := fusionMessageEnvelope{}
+	if err := clientConn.ReadJSON(&replayed); err != nil {
+		t.Fatalf("unable to read: %s", err)
+	}
+	if replayed.Type != "eta" || replayed.Message != "missed" || replayed.Sequence != 2 {
+		t.Errorf("got %+v, expected the missed eta message", replayed)
+	}
+
+	// unknown tokens can't be resumed
+	otherConn, _ := websocketPair(t)
+	other := &fusionClient{id: "other", conn: otherConn}
+	fm.clients[other.id] = other
+	fm.handleMsgResume(other.id, fusionMessageResume{Token: "unknown"})
+	if sm := <-fm.serverMsg; sm.msg.(fusionMessageEnvelope).Message.(fusionResumed).Resumed {
+		t.Error("expected an unknown token to not be resumed")
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"time"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// vehicleSnapshot is what a snapshot says about one vehicle.
+type vehicleSnapshot struct {
+	VehicleID int64     `json:"vehicle_id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Heading   float64   `json:"heading"`
+	Time      time.Time `json:"time"`
+	RouteID   *int64    `json:"route_id"`
+	Occupancy string    `json:"occupancy"`
+
+	// NextStopID is the next Stop that the vehicle has an ETA for, if any,
+	// and NextStopETA is when it's expected there.
+	NextStopID  *int64     `json:"next_stop_id"`
+	NextStopETA *time.Time `json:"next_stop_eta"`
+}
+
+// fusionSnapshot summarizes every vehicle that's reporting so that clients
+// that only show an overview can subscribe to one topic.
+type fusionSnapshot struct {
+	Vehicles  []vehicleSnapshot `json:"vehicles"`
+	Generated time.Time         `json:"generated"`
+}
+
+// watchSnapshots sends a snapshot to the snapshot topic every interval.
+func (fm *fusionManager) watchSnapshots(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for now := range ticker.C {
+		snapshot, err := fm.snapshot(now)
+		if err != nil {
+			log.WithError(err).Error("unable to make snapshot")
+			continue
+		}
+		fme := fusionMessageEnvelope{
+			Type:    "snapshot",
+			Message: snapshot,
+		}
+		fm.sendToTopic("snapshot", "snapshot", fme)
+	}
+}
+
+// handleSnapshotSubscribe sends a new subscriber a snapshot right away instead
+// of making it wait for the next one.
+func (fm *fusionManager) handleSnapshotSubscribe(clientID string) {
+	snapshot, err := fm.snapshot(time.Now())
+	if err != nil {
+		log.WithError(err).Error("unable to make snapshot")
+		return
+	}
+	fme := fusionMessageEnvelope{
+		Type:    "snapshot",
+		Message: snapshot,
+	}
+	fm.sendToClient(clientID, fme)
+}
+
+// snapshot summarizes the latest location of each vehicle that isn't offline
+// or on a hidden Route, with its occupancy and next stop.
+func (fm *fusionManager) snapshot(now time.Time) (*fusionSnapshot, error) {
+	locations, err := fm.ms.LatestLocations()
+	if err != nil {
+		return nil, err
+	}
+	etas := fm.em.CurrentETAs()
+
+	snapshot := &fusionSnapshot{
+		Vehicles:  make([]vehicleSnapshot, 0, len(locations)),
+		Generated: now,
+	}
+	for _, location := range locations {
+		if location.VehicleID == nil || isOffline(location, now, fm.offlineAfter) || fm.visibility.hidden(location.RouteID, now) {
+			continue
+		}
+		vs := vehicleSnapshot{
+			VehicleID: *location.VehicleID,
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+			Heading:   location.Heading,
+			Time:      location.Time,
+			RouteID:   location.RouteID,
+			Occupancy: fm.occupancy.consensus(*location.VehicleID, now),
+		}
+		if eta, ok := etas[vs.VehicleID]; ok && len(eta.StopETAs) > 0 {
+			next := eta.StopETAs[0]
+			vs.NextStopID = &next.StopID
+			vs.NextStopETA = &next.ETA
+		}
+		snapshot.Vehicles = append(snapshot.Vehicles, vs)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestFusionSnapshot(t *testing.T) {
+	now := time.Now()
+	moving := int64(1)
+	waiting := int64(2)
+	stopped := int64(3)
+	routeID := int64(4)
+	ms := &mock.ModelService{}
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{
+		{VehicleID: &moving, Latitude: 42.73, Longitude: -73.68, Heading: 90, RouteID: &routeID, Time: now.Add(-time.Minute)},
+		{VehicleID: &waiting, Latitude: 42.72, Longitude: -73.67, Time: now.Add(-time.Minute)},
+		{VehicleID: &stopped, Time: now.Add(-time.Hour)},
+		{Time: now},
+	}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		moving:  {VehicleID: moving, StopETAs: []shuttletracker.StopETA{{StopID: 5, ETA: now.Add(2 * time.Minute)}, {StopID: 6, ETA: now.Add(4 * time.Minute)}}},
+		waiting: {VehicleID: waiting, StopETAs: []shuttletracker.StopETA{}},
+	})
+	occupancy := &occupancyTracker{reports: map[int64]map[string]occupancyReport{}}
+	occupancy.record(occupancyReport{Voter: "a", VehicleID: moving, Level: occupancyLevel("standing"), Time: now}, now)
+	fm := &fusionManager{
+		ms:           ms,
+		em:           em,
+		serverMsg:    make(chan serverMessage, 10),
+		offlineAfter: 5 * time.Minute,
+		occupancy:    occupancy,
+	}
+
+	snapshot, err := fm.snapshot(now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(snapshot.Vehicles) != 2 {
+		t.Fatalf("got %+v, expected the two vehicles that are reporting", snapshot.Vehicles)
+	}
+	vs := snapshot.Vehicles[0]
+	if vs.VehicleID != moving || vs.Heading != 90 || *vs.RouteID != routeID || vs.Occupancy != "standing" {
+		t.Errorf("got %+v, expected the moving vehicle", vs)
+	}
+	if vs.NextStopID == nil || *vs.NextStopID != 5 || !vs.NextStopETA.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("got %+v, expected the moving vehicle to be headed to stop 5", vs)
+	}
+	if vs := snapshot.Vehicles[1]; vs.NextStopID != nil || vs.RouteID != nil || vs.Occupancy != "" {
+		t.Errorf("got %+v, expected the waiting vehicle to have no route, next stop, or occupancy", vs)
+	}
+
+	// new subscribers get a snapshot right away
+	fm.handleSnapshotSubscribe("client")
+	sm := <-fm.serverMsg
+	if fme := sm.msg.(fusionMessageEnvelope); sm.clientID != "client" || fme.Type != "snapshot" {
+		t.Errorf("got %+v, expected a snapshot for the client", sm)
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestTopicBatch(t *testing.T) {
+	tb := newTopicBatch()
+
+	tb.add(serverMessage{topic: "vehicle_location", key: "1", msg: "first"})
+	tb.add(serverMessage{topic: "vehicle_location", key: "2", msg: "second"})
+	tb.add(serverMessage{topic: "eta", key: "1", msg: "eta"})
+	tb.add(serverMessage{topic: "vehicle_location", key: "1", msg: "third"})
+	tb.add(serverMessage{topic: "bus_button", msg: "button"})
+	tb.add(serverMessage{topic: "bus_button", msg: "button"})
+
+	expected := []serverMessage{
+		{topic: "vehicle_location", key: "1", msg: "third"},
+		{topic: "vehicle_location", key: "2", msg: "second"},
+		{topic: "eta", key: "1", msg: "eta"},
+		{topic: "bus_button", msg: "button"},
+		{topic: "bus_button", msg: "button"},
+	}
+	if len(tb.messages) != len(expected) {
+		t.Fatalf("expected %d messages, got %d", len(expected), len(tb.messages))
+	}
+	for i, sm := range tb.messages {
+		if sm != expected[i] {
+			t.Errorf("message %d: expected %+v, got %+v", i, expected[i], sm)
+		}
+	}
+}
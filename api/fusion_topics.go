@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+)
+
+// Levels of login needed to subscribe to a topic.
+const (
+	topicAuthNone = "none"
+)
+
+// fusionTopic is a topic that clients can subscribe to.
+type fusionTopic struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Sticky topics send new subscribers the current state, like every
+	// vehicle's latest location, instead of only what changes after they
+	// subscribe.
+	Sticky bool `json:"sticky"`
+
+	// Auth is the login needed to subscribe.
+	Auth string `json:"auth"`
+
+	// Subscribers is how many clients connected to this instance are
+	// subscribed.
+	Subscribers int `json:"subscribers"`
+}
+
+// fusionTopics are the topics that clients can subscribe to. Add new topics
+// here so that clients can find them.
+var fusionTopics = []fusionTopic{
+	{Name: "vehicle_location", Description: "Vehicles' locations as they're reported, and vehicle_offline when a vehicle stops reporting.", Auth: topicAuthNone},
+	{Name: "eta", Description: "Each vehicle's ETAs to the stops ahead of it whenever they're recalculated.", Auth: topicAuthNone},
+	{Name: "bus_button", Description: "Bus button presses from every client.", Auth: topicAuthNone},
+	{Name: "snapshot", Description: "A summary of every vehicle's location, route, occupancy, and next stop, sent periodically.", Auth: topicAuthNone},
+	{Name: stopArrivalsTopicPattern, Description: "A countdown to the next arrivals at one stop, like stop.12.arrivals, sent every few seconds.", Auth: topicAuthNone},
+}
+
+// fusionMessageTopics is sent by a client to list the topics it can
+// subscribe to.
+type fusionMessageTopics struct{}
+
+func (ft *fusionMessageTopics) validate() error {
+	return nil
+}
+
+// validateTopic checks that clients can subscribe to a topic.
+func validateTopic(topic string) error {
+	for _, t := range fusionTopics {
+		if t.Name == topic && t.Name != stopArrivalsTopicPattern {
+			return nil
+		}
+	}
+	if _, ok := stopArrivalsTopicStop(topic); ok {
+		return nil
+	}
+	return fmt.Errorf("unknown topic \"%s\"; send a topics message to list them", topic)
+}
+
+// handleMsgTopics sends a client the topics it can subscribe to.
+func (fm *fusionManager) handleMsgTopics(clientID string) {
+	topics := make([]fusionTopic, len(fusionTopics))
+	for i, t := range fusionTopics {
+		_, t.Sticky = fm.subscribeCallbacks[t.Name]
+		t.Subscribers = len(fm.subscriptions[t.Name])
+		if t.Name == stopArrivalsTopicPattern {
+			// there's a topic for each Stop
+			t.Sticky = true
+			for topic, subs := range fm.subscriptions {
+				if _, ok := stopArrivalsTopicStop(topic); ok {
+					t.Subscribers += len(subs)
+				}
+			}
+		}
+		topics[i] = t
+	}
+	fme := fusionMessageEnvelope{
+		Type:    "topics",
+		Message: topics,
+	}
+	fm.sendToClient(clientID, fme)
+}
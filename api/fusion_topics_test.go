@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestHandleMsgTopics(t *testing.T) {
+	fm := &fusionManager{
+		serverMsg: make(chan serverMessage, 1),
+		subscriptions: map[string][]string{
+			"eta": {"a", "b"},
+		},
+		subscribeCallbacks: map[string][]func(string){
+			"eta": {func(string) {}},
+		},
+	}
+	fm.handleMsgTopics("a")
+
+	sm := <-fm.serverMsg
+	fme := sm.msg.(fusionMessageEnvelope)
+	if sm.clientID != "a" || fme.Type != "topics" {
+		t.Fatalf("got %+v, expected topics for client a", sm)
+	}
+	topics := fme.Message.([]fusionTopic)
+	if len(topics) != len(fusionTopics) {
+		t.Fatalf("got %d topics, expected %d", len(topics), len(fusionTopics))
+	}
+	for _, topic := range topics {
+		switch topic.Name {
+		case "eta":
+			if !topic.Sticky || topic.Subscribers != 2 {
+				t.Errorf("got %+v, expected a sticky topic with 2 subscribers", topic)
+			}
+		case "bus_button":
+			if topic.Sticky || topic.Subscribers != 0 || topic.Auth != topicAuthNone {
+				t.Errorf("got %+v, expected a public topic without subscribers", topic)
+			}
+		}
+	}
+
+	// the list itself isn't changed
+	for _, topic := range fusionTopics {
+		if topic.Sticky || topic.Subscribers != 0 {
+			t.Errorf("expected %s to be unchanged, got %+v", topic.Name, topic)
+		}
+	}
+}
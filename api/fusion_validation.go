@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// maxPositionSpeed is the fastest that a client's position can be moving, in
+// meters per second (about 225 mph). Anything faster is a GPS error.
+const maxPositionSpeed = 100.0
+
+// fusionError is sent to a client when one of its messages is rejected.
+type fusionError struct {
+	// Type is the type of the rejected message.
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// fusionValidator is implemented by messages from clients that have rules
+// beyond their JSON types.
+type fusionValidator interface {
+	validate() error
+}
+
+// decodeClientMessage decodes the message in an envelope into v, rejecting
+// unknown fields, values of the wrong type, and missing or null required
+// fields, and then validates it.
+func decodeClientMessage(message json.RawMessage, v fusionValidator, required ...string) error {
+	if len(message) == 0 || bytes.Equal(message, []byte("null")) {
+		return fmt.Errorf("message is required")
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return fmt.Errorf("message must be an object")
+	}
+	for _, field := range required {
+		if value, ok := fields[field]; !ok || bytes.Equal(value, []byte("null")) {
+			return fmt.Errorf("%s is required", field)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(message))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			return fmt.Errorf("%s must be %s", te.Field, jsonTypeName(te.Type))
+		}
+		return err
+	}
+	return v.validate()
+}
+
+// jsonTypeName describes the JSON that decodes into a Go type.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// validateCoordinates checks that a position is on Earth and isn't 0, 0,
+// which GPS receivers report when they don't know where they are.
+func validateCoordinates(latitude, longitude float64) error {
+	if latitude < -90 || latitude > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if longitude < -180 || longitude > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180")
+	}
+	if latitude == 0 && longitude == 0 {
+		return fmt.Errorf("latitude and longitude can't both be 0")
+	}
+	return nil
+}
+
+func (fms *fusionMessageSubscribe) validate() error {
+	if fms.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	if err := validateTopic(fms.Topic); err != nil {
+		return err
+	}
+	if fms.StopID < 0 {
+		return fmt.Errorf("stop_id can't be negative")
+	}
+	return nil
+}
+
+func (fmu *fusionMessageUnsubscribe) validate() error {
+	if fmu.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	return validateTopic(fmu.Topic)
+}
+
+func (fmr *fusionMessageResume) validate() error {
+	if fmr.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	return nil
+}
+
+func (fp *fusionPosition) validate() error {
+	if err := validateCoordinates(fp.Latitude, fp.Longitude); err != nil {
+		return err
+	}
+	if fp.Speed != nil && (*fp.Speed < 0 || *fp.Speed > maxPositionSpeed) {
+		return fmt.Errorf("speed must be between 0 and %g meters per second", maxPositionSpeed)
+	}
+	if fp.Heading != nil && (*fp.Heading < 0 || *fp.Heading > 360) {
+		return fmt.Errorf("heading must be between 0 and 360")
+	}
+	if fp.Track == "" {
+		return fmt.Errorf("track is required")
+	}
+	return nil
+}
+
+func (fbb *fusionBusButton) validate() error {
+	if err := validateCoordinates(fbb.Latitude, fbb.Longitude); err != nil {
+		return err
+	}
+	for _, emoji := range validBusButtonEmoji {
+		if emoji == fbb.Emoji {
+			return nil
+		}
+	}
+	return fmt.Errorf("emojiChoice must be one of %v", validBusButtonEmoji)
+}
+
+func (fa *fusionAlarm) validate() error {
+	if fa.StopID <= 0 {
+		return fmt.Errorf("stop_id must be a stop's ID")
+	}
+	return nil
+}
+
+// rejectMessage tells a client why one of its messages of type messageType
+// was rejected.
+func (fm *fusionManager) rejectMessage(clientID, messageType string, err error) {
+	fme := fusionMessageEnvelope{
+		Type:    "error",
+		Message: fusionError{Type: messageType, Error: err.Error()},
+	}
+	fm.sendToClient(clientID, fme)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecodeClientMessage(t *testing.T) {
+	for _, c := range []struct {
+		message  string
+		v        fusionValidator
+		required []string
+		err      string
+	}{
+		{`{"topic": "eta", "stop_id": 3}`, &fusionMessageSubscribe{}, []string{"topic"}, ""},
+		{`{"topic": ""}`, &fusionMessageSubscribe{}, []string{"topic"}, "topic is required"},
+		{`{"topic": "etas"}`, &fusionMessageSubscribe{}, []string{"topic"}, "unknown topic"},
+		{`{"topic": "etas"}`, &fusionMessageUnsubscribe{}, []string{"topic"}, "unknown topic"},
+		{`{"stop_id": 3}`, &fusionMessageSubscribe{}, []string{"topic"}, "topic is required"},
+		{`{"topic": null}`, &fusionMessageSubscribe{}, []string{"topic"}, "topic is required"},
+		{`{"topic": 5}`, &fusionMessageSubscribe{}, []string{"topic"}, "topic must be a string"},
+		{`{"topic": "eta", "stop_id": "3"}`, &fusionMessageSubscribe{}, []string{"topic"}, "stop_id must be an integer"},
+		{`{"topic": "eta", "stops": [3]}`, &fusionMessageSubscribe{}, []string{"topic"}, "unknown field"},
+		{``, &fusionMessageSubscribe{}, []string{"topic"}, "message is required"},
+		{`"eta"`, &fusionMessageSubscribe{}, []string{"topic"}, "message must be an object"},
+		{`{"token": "abc", "sequence": -1}`, &fusionMessageResume{}, []string{"token", "sequence"}, "sequence must be an integer"},
+		{`{"latitude": 42.73, "longitude": -73.68, "speed": 5, "heading": null, "track": "t"}`, &fusionPosition{}, []string{"latitude", "longitude", "track"}, ""},
+		{`{"latitude": 91, "longitude": -73.68, "track": "t"}`, &fusionPosition{}, []string{"latitude", "longitude", "track"}, "latitude must be between -90 and 90"},
+		{`{"latitude": 42.73, "longitude": 181, "track": "t"}`, &fusionPosition{}, []string{"latitude", "longitude", "track"}, "longitude must be between -180 and 180"},
+		{`{"latitude": 0, "longitude": 0, "track": "t"}`, &fusionPosition{}, []string{"latitude", "longitude", "track"}, "can't both be 0"},
+		{`{"longitude": -73.68, "track": "t"}`, &fusionPosition{}, []string{"latitude", "longitude", "track"}, "latitude is required"},
+		{`{"latitude": 42.73, "longitude": -73.68, "speed": 300, "track": "t"}`, &fusionPosition{}, []string{"latitude", "longitude", "track"}, "speed must be between 0 and 100"},
+		{`{"latitude": 42.73, "longitude": -73.68, "heading": -1, "track": "t"}`, &fusionPosition{}, []string{"latitude", "longitude", "track"}, "heading must be between 0 and 360"},
+		{`{"latitude": 42.73, "longitude": -73.68, "emojiChoice": "🚌"}`, &fusionBusButton{}, []string{"latitude", "longitude", "emojiChoice"}, ""},
+		{`{"latitude": 42.73, "longitude": -73.68, "emojiChoice": "🍕"}`, &fusionBusButton{}, []string{"latitude", "longitude", "emojiChoice"}, "emojiChoice must be one of"},
+		{`{"stop_id": 0}`, &fusionAlarm{}, []string{"stop_id"}, "stop_id must be a stop's ID"},
+	} {
+		err := decodeClientMessage(json.RawMessage(c.message), c.v, c.required...)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", c.message, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: got error %v, expected %q", c.message, err, c.err)
+		}
+	}
+}
+
+func TestDecodeFusionMessage(t *testing.T) {
+	for _, c := range []struct {
+		envelope    string
+		messageType string
+		err         bool
+	}{
+		{`{"type": "subscribe", "message": {"topic": "eta"}}`, "subscribe", false},
+		{`{"message": {"topic": "eta"}}`, "", true},
+		{`{"type": "subscribe", "topic": "eta"}`, "", true},
+		{`{"type": 1}`, "", true},
+	} {
+		messageType, _, err := decodeFusionMessage(strings.NewReader(c.envelope))
+		if messageType != c.messageType || (err != nil) != c.err {
+			t.Errorf("%s: got type %q and error %v", c.envelope, messageType, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// VehicleGroupsHandler returns all VehicleGroups.
+func (api *API) VehicleGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := api.ms.VehicleGroups()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get vehicle groups")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, groups)
+}
+
+// VehicleGroupsCreateHandler creates a VehicleGroup from the JSON in the request body.
+func (api *API) VehicleGroupsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	group := &shuttletracker.VehicleGroup{}
+	if err := json.NewDecoder(r.Body).Decode(group); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateVehicleGroup(group); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ms.CreateVehicleGroup(group); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create vehicle group")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, group)
+}
+
+// VehicleGroupsEditHandler renames or redescribes a VehicleGroup.
+func (api *API) VehicleGroupsEditHandler(w http.ResponseWriter, r *http.Request) {
+	group := &shuttletracker.VehicleGroup{}
+	if err := json.NewDecoder(r.Body).Decode(group); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateVehicleGroup(group); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifyVehicleGroup(group)
+	if err == shuttletracker.ErrVehicleGroupNotFound {
+		http.Error(w, "Vehicle group not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify vehicle group")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, group)
+}
+
+// VehicleGroupsDeleteHandler deletes the VehicleGroup with the id in the query
+// string. Its vehicles are kept but no longer belong to a group.
+func (api *API) VehicleGroupsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.DeleteVehicleGroup(id)
+	if err == shuttletracker.ErrVehicleGroupNotFound {
+		http.Error(w, "Vehicle group not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete vehicle group")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validateVehicleGroup checks that a VehicleGroup has a name.
+func validateVehicleGroup(group *shuttletracker.VehicleGroup) error {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return nil
+}
+
+// validateGroupMembership checks that the VehicleGroup a Vehicle is being put in exists.
+func validateGroupMembership(ms shuttletracker.ModelService, vehicle *shuttletracker.Vehicle) error {
+	if vehicle.GroupID == nil {
+		return nil
+	}
+	_, err := ms.VehicleGroup(*vehicle.GroupID)
+	if err == shuttletracker.ErrVehicleGroupNotFound {
+		return fmt.Errorf("vehicle group %d does not exist", *vehicle.GroupID)
+	}
+	return err
+}
+
+// parseGroupFilter reads the optional "group_id" from the query string of
+// endpoints that list current vehicles or their locations.
+func parseGroupFilter(r *http.Request) (shuttletracker.HistoryFilter, error) {
+	filter := shuttletracker.HistoryFilter{}
+	s := r.URL.Query().Get("group_id")
+	if s == "" {
+		return filter, nil
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return filter, err
+	}
+	filter.GroupID = &id
+	return filter, nil
+}
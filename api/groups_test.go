@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestVehicleGroupsCreateHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.VehicleGroupService.On("CreateVehicleGroup", tmock.Anything).Return(nil)
+	api := API{ms: ms}
+
+	body := bytes.NewBufferString(`{"name": " East Campus fleet "}`)
+	w := httptest.NewRecorder()
+	api.VehicleGroupsCreateHandler(w, httptest.NewRequest("POST", "/groups/create", body))
+	if w.Code != 200 {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	ms.VehicleGroupService.AssertCalled(t, "CreateVehicleGroup", &shuttletracker.VehicleGroup{Name: "East Campus fleet"})
+
+	body = bytes.NewBufferString(`{"name": " "}`)
+	w = httptest.NewRecorder()
+	api.VehicleGroupsCreateHandler(w, httptest.NewRequest("POST", "/groups/create", body))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+	ms.VehicleGroupService.AssertNumberOfCalls(t, "CreateVehicleGroup", 1)
+}
+
+func TestVehicleGroupsDeleteHandlerNotFound(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.VehicleGroupService.On("DeleteVehicleGroup", int64(2)).Return(shuttletracker.ErrVehicleGroupNotFound)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	api.VehicleGroupsDeleteHandler(w, httptest.NewRequest("DELETE", "/groups/?id=2", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status code %d, expected 404", w.Code)
+	}
+}
+
+func TestVehiclesHandlerGroupID(t *testing.T) {
+	east := int64(1)
+	athletics := int64(2)
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicles").Return([]*shuttletracker.Vehicle{
+		{ID: 1, GroupID: &east},
+		{ID: 2, GroupID: &athletics},
+		{ID: 3},
+	}, nil)
+	ms.MaintenanceService.On("OutOfService", tmock.Anything).Return([]*shuttletracker.MaintenanceRecord{}, nil)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	api.VehiclesHandler(w, httptest.NewRequest("GET", "/vehicles/?group_id=2", nil))
+	if w.Code != 200 {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	vehicles := []shuttletracker.Vehicle{}
+	if err := json.NewDecoder(w.Body).Decode(&vehicles); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if len(vehicles) != 1 || vehicles[0].ID != 2 {
+		t.Errorf("got %+v, expected only vehicle 2", vehicles)
+	}
+
+	w = httptest.NewRecorder()
+	api.VehiclesHandler(w, httptest.NewRequest("GET", "/vehicles/?group_id=east", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+}
+
+func TestVehiclesEditHandlerUnknownGroup(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.VehicleGroupService.On("VehicleGroup", int64(9)).Return((*shuttletracker.VehicleGroup)(nil), shuttletracker.ErrVehicleGroupNotFound)
+	api := API{ms: ms}
+
+	body := bytes.NewBufferString(`{"id": 4, "group_id": 9}`)
+	w := httptest.NewRecorder()
+	api.VehiclesEditHandler(w, httptest.NewRequest("POST", "/vehicles/edit", body))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+	ms.VehicleService.AssertNotCalled(t, "ModifyVehicle", tmock.Anything)
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/gtfsrt"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// mphToMetersPerSecond converts shuttletracker.Location speeds to the units GTFS-realtime expects.
+const mphToMetersPerSecond = 0.44704
+
+// gtfsFeed periodically regenerates GTFS-realtime feeds so that aggregators
+// polling them don't cause any database queries.
+type gtfsFeed struct {
+	ms       shuttletracker.ModelService
+	em       shuttletracker.ETAService
+	interval time.Duration
+
+	// Vehicles that haven't reported in this long are left out of the feed.
+	offlineAfter time.Duration
+
+	// visibility leaves out vehicles on Routes that are hidden from the public.
+	visibility *routeVisibility
+
+	// Our route and stop IDs can be mapped to the IDs used in a static GTFS
+	// feed. Unmapped IDs are used as-is.
+	routeIDs map[string]string
+	stopIDs  map[string]string
+
+	mutex            sync.RWMutex
+	vehiclePositions []byte
+	tripUpdates      []byte
+}
+
+func newGTFSFeed(cfg Config, ms shuttletracker.ModelService, em shuttletracker.ETAService, offlineAfter time.Duration, visibility *routeVisibility) (*gtfsFeed, error) {
+	interval, err := time.ParseDuration(cfg.GTFSInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &gtfsFeed{
+		ms:           ms,
+		em:           em,
+		interval:     interval,
+		offlineAfter: offlineAfter,
+		visibility:   visibility,
+		routeIDs:     cfg.GTFSRouteIDs,
+		stopIDs:      cfg.GTFSStopIDs,
+	}, nil
+}
+
+func (gf *gtfsFeed) routeID(id int64) string {
+	s := strconv.FormatInt(id, 10)
+	if mapped, ok := gf.routeIDs[s]; ok {
+		return mapped
+	}
+	return s
+}
+
+func (gf *gtfsFeed) stopID(id int64) string {
+	s := strconv.FormatInt(id, 10)
+	if mapped, ok := gf.stopIDs[s]; ok {
+		return mapped
+	}
+	return s
+}
+
+func (gf *gtfsFeed) run() {
+	gf.update()
+	ticker := time.NewTicker(gf.interval)
+	for range ticker.C {
+		gf.update()
+	}
+}
+
+func (gf *gtfsFeed) update() {
+	vp, err := gf.buildVehiclePositions()
+	if err != nil {
+		log.WithError(err).Error("unable to build GTFS-realtime vehicle positions")
+	} else {
+		gf.mutex.Lock()
+		gf.vehiclePositions = vp
+		gf.mutex.Unlock()
+	}
+
+	tu, err := gf.buildTripUpdates()
+	if err != nil {
+		log.WithError(err).Error("unable to build GTFS-realtime trip updates")
+	} else {
+		gf.mutex.Lock()
+		gf.tripUpdates = tu
+		gf.mutex.Unlock()
+	}
+}
+
+func (gf *gtfsFeed) buildVehiclePositions() ([]byte, error) {
+	vehicles, err := gf.ms.EnabledVehicles()
+	if err != nil {
+		return nil, err
+	}
+	locations, err := gf.ms.LatestLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := map[int64]*shuttletracker.Vehicle{}
+	for _, vehicle := range vehicles {
+		enabled[vehicle.ID] = vehicle
+	}
+
+	now := time.Now()
+	fm := &gtfsrt.FeedMessage{
+		Header: gtfsrt.FeedHeader{Timestamp: uint64(now.Unix())},
+	}
+	for _, loc := range locations {
+		if loc.VehicleID == nil || isOffline(loc, now, gf.offlineAfter) || gf.visibility.hidden(loc.RouteID, now) {
+			continue
+		}
+		vehicle, ok := enabled[*loc.VehicleID]
+		if !ok {
+			continue
+		}
+
+		vehicleID := strconv.FormatInt(vehicle.ID, 10)
+		vp := &gtfsrt.VehiclePosition{
+			Vehicle: &gtfsrt.VehicleDescriptor{
+				ID:    vehicleID,
+				Label: vehicle.Name,
+			},
+			Position: &gtfsrt.Position{
+				Latitude:  float32(loc.Latitude),
+				Longitude: float32(loc.Longitude),
+				Bearing:   float32(loc.Heading),
+				Speed:     float32(loc.Speed * mphToMetersPerSecond),
+			},
+			Timestamp: uint64(loc.Time.Unix()),
+		}
+		if loc.RouteID != nil {
+			vp.Trip = &gtfsrt.TripDescriptor{RouteID: gf.routeID(*loc.RouteID)}
+		}
+		fm.Entities = append(fm.Entities, gtfsrt.FeedEntity{
+			ID:      vehicleID,
+			Vehicle: vp,
+		})
+	}
+
+	return fm.Marshal(), nil
+}
+
+// buildTripUpdates converts the ETA manager's current predictions into a feed
+// with one TripUpdate per vehicle on a route.
+func (gf *gtfsFeed) buildTripUpdates() ([]byte, error) {
+	vehicles, err := gf.ms.EnabledVehicles()
+	if err != nil {
+		return nil, err
+	}
+	enabled := map[int64]*shuttletracker.Vehicle{}
+	for _, vehicle := range vehicles {
+		enabled[vehicle.ID] = vehicle
+	}
+
+	now := time.Now()
+	fm := &gtfsrt.FeedMessage{
+		Header: gtfsrt.FeedHeader{Timestamp: uint64(now.Unix())},
+	}
+	for _, eta := range gf.em.CurrentETAs() {
+		vehicle, ok := enabled[eta.VehicleID]
+		if !ok || eta.RouteID == 0 || len(eta.StopETAs) == 0 || gf.visibility.hidden(&eta.RouteID, now) {
+			continue
+		}
+
+		vehicleID := strconv.FormatInt(vehicle.ID, 10)
+		tu := &gtfsrt.TripUpdate{
+			Trip: gtfsrt.TripDescriptor{RouteID: gf.routeID(eta.RouteID)},
+			Vehicle: &gtfsrt.VehicleDescriptor{
+				ID:    vehicleID,
+				Label: vehicle.Name,
+			},
+			Timestamp: uint64(eta.Updated.Unix()),
+		}
+		for _, stopETA := range eta.StopETAs {
+			tu.StopTimeUpdates = append(tu.StopTimeUpdates, gtfsrt.StopTimeUpdate{
+				StopID:  gf.stopID(stopETA.StopID),
+				Arrival: gtfsrt.StopTimeEvent{Time: stopETA.ETA.Unix()},
+			})
+		}
+		fm.Entities = append(fm.Entities, gtfsrt.FeedEntity{
+			ID:         vehicleID,
+			TripUpdate: tu,
+		})
+	}
+
+	return fm.Marshal(), nil
+}
+
+func writeProtobuf(w http.ResponseWriter, b []byte) {
+	if b == nil {
+		http.Error(w, "feed not generated yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", protobufContentType)
+	_, err := w.Write(b)
+	if err != nil {
+		log.WithError(err).Error("unable to write GTFS-realtime feed")
+	}
+}
+
+// GTFSVehiclePositionsHandler serves the most recently generated GTFS-realtime VehiclePositions feed.
+func (api *API) GTFSVehiclePositionsHandler(w http.ResponseWriter, r *http.Request) {
+	api.gtfs.mutex.RLock()
+	b := api.gtfs.vehiclePositions
+	api.gtfs.mutex.RUnlock()
+	writeProtobuf(w, b)
+}
+
+// GTFSTripUpdatesHandler serves the most recently generated GTFS-realtime TripUpdates feed.
+func (api *API) GTFSTripUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	api.gtfs.mutex.RLock()
+	b := api.gtfs.tripUpdates
+	api.gtfs.mutex.RUnlock()
+	writeProtobuf(w, b)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestGTFSFeedHidesRoutes(t *testing.T) {
+	now := time.Now()
+	visibleRouteID, hiddenRouteID := int64(1), int64(2)
+	visibleID, hiddenID := int64(3), int64(4)
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: visibleRouteID}, hiddenRoute(hiddenRouteID, now)}, nil)
+	ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{
+		{ID: visibleID, Name: "Visible Bus"},
+		{ID: hiddenID, Name: "Hidden Bus"},
+	}, nil)
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{
+		{VehicleID: &visibleID, RouteID: &visibleRouteID, Time: now},
+		{VehicleID: &hiddenID, RouteID: &hiddenRouteID, Time: now},
+	}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		visibleID: {VehicleID: visibleID, RouteID: visibleRouteID, StopETAs: []shuttletracker.StopETA{{StopID: 1, ETA: now}}},
+		hiddenID:  {VehicleID: hiddenID, RouteID: hiddenRouteID, StopETAs: []shuttletracker.StopETA{{StopID: 1, ETA: now}}},
+	})
+	gf, err := newGTFSFeed(Config{GTFSInterval: "15s"}, ms, em, 5*time.Minute, newRouteVisibility(ms))
+	if err != nil {
+		t.Fatalf("unable to create feed: %s", err)
+	}
+
+	vp, err := gf.buildVehiclePositions()
+	if err != nil {
+		t.Fatalf("unable to build vehicle positions: %s", err)
+	}
+	tu, err := gf.buildTripUpdates()
+	if err != nil {
+		t.Fatalf("unable to build trip updates: %s", err)
+	}
+	for name, feed := range map[string][]byte{"vehicle positions": vp, "trip updates": tu} {
+		if !bytes.Contains(feed, []byte("Visible Bus")) {
+			t.Errorf("%s left out the vehicle on a visible route", name)
+		}
+		if bytes.Contains(feed, []byte("Hidden Bus")) {
+			t.Errorf("%s included the vehicle on a hidden route", name)
+		}
+	}
+}
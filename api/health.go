@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/wtg/shuttletracker/health"
+)
+
+// etasStale reports whether ETAs may be out of date because the data feed,
+// database, or ETA calculation isn't working.
+func etasStale() bool {
+	return !health.Healthy(health.Updater) || !health.Healthy(health.Database) || !health.Healthy(health.ETA)
+}
+
+// healthy reports whether every component is healthy.
+func healthy() bool {
+	for _, c := range health.Components() {
+		if c.State != health.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthHandler reports the health of each component for load balancers and
+// monitoring. It responds with 503 if any component is down.
+func (api *API) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	components := health.Components()
+	status := http.StatusOK
+	for _, c := range components {
+		if c.State == health.Down {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	WriteJSON(w, components)
+}
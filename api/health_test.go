@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestHealthHandler(t *testing.T) {
+	defer health.Report(health.Database, nil)
+	defer health.Report(health.Fusion, nil)
+
+	health.ReportDegraded(health.Fusion, errors.New("unable to broadcast"))
+	api := API{}
+	w := httptest.NewRecorder()
+	api.HealthHandler(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status code %d with a degraded component, expected 200", w.Code)
+	}
+
+	health.Report(health.Database, errors.New("connection refused"))
+	w = httptest.NewRecorder()
+	api.HealthHandler(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status code %d with a component down, expected 503", w.Code)
+	}
+	components := []health.Component{}
+	if err := json.NewDecoder(w.Body).Decode(&components); err != nil {
+		t.Fatalf("unable to decode components: %s", err)
+	}
+	states := map[string]health.State{}
+	for _, c := range components {
+		states[c.Name] = c.State
+	}
+	if states[health.Database] != health.Down || states[health.Fusion] != health.Degraded {
+		t.Errorf("got %+v", components)
+	}
+}
+
+func TestETAHandlerStale(t *testing.T) {
+	defer health.Report(health.Updater, nil)
+
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{1: {VehicleID: 1}})
+	api := API{etaManager: em}
+
+	for _, stale := range []bool{false, true} {
+		if stale {
+			health.Report(health.Updater, errors.New("data feed status code 502"))
+		}
+		w := httptest.NewRecorder()
+		api.ETAHandler(w, httptest.NewRequest("GET", "/eta", nil))
+		etas := map[int64]shuttletracker.VehicleETA{}
+		if err := json.NewDecoder(w.Body).Decode(&etas); err != nil {
+			t.Fatalf("unable to decode ETAs: %s", err)
+		}
+		if etas[1].Stale != stale {
+			t.Errorf("got stale %t, expected %t", etas[1].Stale, stale)
+		}
+	}
+}
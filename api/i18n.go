@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// translations maps languages, like "es" or "pt-br", to translations of the
+// English messages that the server writes, like error messages and Alert
+// message formats. Messages without a translation are left in English.
+type translations map[string]map[string]string
+
+// loadTranslations reads translations from a JSON file, or returns none if
+// path is empty. Languages are case-insensitive, and translations of message
+// formats must have as many %s as the original.
+func loadTranslations(path string) (translations, error) {
+	t := translations{}
+	if path == "" {
+		return t, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	catalog := map[string]map[string]string{}
+	if err := json.Unmarshal(b, &catalog); err != nil {
+		return nil, fmt.Errorf("unable to parse translations: %s", err)
+	}
+	for lang, messages := range catalog {
+		for message, translation := range messages {
+			if strings.Count(message, "%s") != strings.Count(translation, "%s") {
+				return nil, fmt.Errorf("%s translation of %q has a different number of %%s", lang, message)
+			}
+		}
+		t[strings.ToLower(lang)] = messages
+	}
+	return t, nil
+}
+
+// language returns the language that the request's Accept-Language header
+// prefers most of those with translations, or an empty string for English.
+// A language like "es" is also used for "es-mx" if there's nothing more
+// specific.
+func (t translations) language(r *http.Request) string {
+	header := r.Header.Get("Accept-Language")
+	if len(t) == 0 || header == "" {
+		return ""
+	}
+
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	prefs := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		lang := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if lang != "" && q > 0 {
+			prefs = append(prefs, weighted{lang, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool {
+		return prefs[i].q > prefs[j].q
+	})
+
+	for _, pref := range prefs {
+		if pref.lang == "en" || strings.HasPrefix(pref.lang, "en-") {
+			return ""
+		}
+		if _, ok := t[pref.lang]; ok {
+			return pref.lang
+		}
+		if i := strings.Index(pref.lang, "-"); i > 0 {
+			if _, ok := t[pref.lang[:i]]; ok {
+				return pref.lang[:i]
+			}
+		}
+	}
+	return ""
+}
+
+// translate returns a message in a language, or in English if there's no
+// translation.
+func (t translations) translate(lang, message string) string {
+	if translation, ok := t[lang][message]; ok {
+		return translation
+	}
+	return message
+}
+
+// translateAlert returns a copy of an Alert with its Message in a language.
+func (t translations) translateAlert(lang string, alert *shuttletracker.Alert) *shuttletracker.Alert {
+	if alert == nil || lang == "" {
+		return alert
+	}
+	translated := *alert
+	if translation, ok := t[lang][alert.MessageFormat]; ok {
+		translated.Message = alert.TranslatedMessage(translation)
+	}
+	return &translated
+}
+
+type languageKey struct{}
+
+// requestLanguage returns the language that the request's response should
+// be in, or an empty string for English.
+func requestLanguage(ctx context.Context) string {
+	lang, _ := ctx.Value(languageKey{}).(string)
+	return lang
+}
+
+// localize picks the language for each request from its Accept-Language
+// header and translates plain text error responses, like those written by
+// http.Error, into it. Handlers translate anything else with
+// requestLanguage.
+func (api *API) localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(api.i18n) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Language")
+		lang := api.i18n.language(r)
+		// the wrapper can't hijack connections
+		if lang == "" || websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Language", lang)
+		tw := &translatingWriter{ResponseWriter: w, translations: api.i18n, lang: lang}
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), languageKey{}, lang)))
+		tw.finish()
+	})
+}
+
+// translatingWriter holds plain text error responses until the handler is
+// done so that they can be translated as a whole.
+type translatingWriter struct {
+	http.ResponseWriter
+	translations translations
+	lang         string
+
+	wroteHeader bool
+	buffering   bool
+	body        strings.Builder
+}
+
+func (tw *translatingWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.buffering = code >= 400 && strings.HasPrefix(tw.Header().Get("Content-Type"), "text/plain")
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *translatingWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.buffering {
+		return tw.body.Write(b)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush sends anything written so far, if the underlying writer can.
+func (tw *translatingWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok && !tw.buffering {
+		f.Flush()
+	}
+}
+
+// finish writes the translated error response, if there is one.
+func (tw *translatingWriter) finish() {
+	if !tw.buffering {
+		return
+	}
+	message := strings.TrimSuffix(tw.body.String(), "\n")
+	fmt.Fprintln(tw.ResponseWriter, tw.translations.translate(tw.lang, message))
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+var testTranslations = translations{
+	"es": {
+		"Stop not found":                       "Parada no encontrada",
+		"%s is reporting locations again.":     "%s vuelve a informar su ubicación.",
+		"Shuttles are being tracked normally.": "Los autobuses se rastrean con normalidad.",
+	},
+	"pt-br": {"Stop not found": "Parada não encontrada"},
+}
+
+func TestTranslationsLanguage(t *testing.T) {
+	for header, expected := range map[string]string{
+		"":                            "",
+		"es":                          "es",
+		"ES-MX":                       "es",
+		"fr, es;q=0.5":                "es",
+		"en-US, es;q=0.9":             "",
+		"es;q=0.5, pt-BR":             "pt-br",
+		"pt-PT":                       "",
+		"es;q=0, pt-BR;q=0.1, en;q=0": "pt-br",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", header)
+		if lang := testTranslations.language(req); lang != expected {
+			t.Errorf("%q: got %q, expected %q", header, lang, expected)
+		}
+	}
+}
+
+func TestLoadTranslations(t *testing.T) {
+	dir := t.TempDir()
+	write := func(contents string) string {
+		path := filepath.Join(dir, "translations.json")
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tr, err := loadTranslations(write(`{"ES": {"Stop not found": "Parada no encontrada"}}`))
+	if err != nil {
+		t.Fatalf("unable to load translations: %s", err)
+	}
+	if tr.translate("es", "Stop not found") != "Parada no encontrada" || tr.translate("es", "Route not found") != "Route not found" {
+		t.Errorf("got %v", tr)
+	}
+
+	if _, err := loadTranslations(write(`{"es": {"%s is back inside the service area.": "Está dentro del área de servicio."}}`)); err == nil {
+		t.Error("expected an error for a translation without the same placeholders")
+	}
+	if tr, err := loadTranslations(""); err != nil || len(tr) != 0 {
+		t.Errorf("got %v and %v without a file", tr, err)
+	}
+}
+
+func TestLocalizeErrors(t *testing.T) {
+	api := API{i18n: testTranslations}
+	handler := errorRequestID(api.localize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			WriteJSON(w, requestLanguage(r.Context()))
+			return
+		}
+		http.Error(w, "Stop not found", http.StatusNotFound)
+	})))
+
+	for _, test := range []struct {
+		path, lang, body string
+	}{
+		{"/missing", "es", "Parada no encontrada\nRequest ID"},
+		{"/missing", "en", "Stop not found\nRequest ID"},
+		{"/ok", "es-419", `"es"`},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept-Language", test.lang)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if !strings.HasPrefix(w.Body.String(), test.body) {
+			t.Errorf("%s in %s: got %q, expected it to start with %q", test.path, test.lang, w.Body, test.body)
+		}
+		if w.Header().Get("Vary") != "Accept-Language" {
+			t.Errorf("got Vary %q", w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestTranslateAlert(t *testing.T) {
+	alert := &shuttletracker.Alert{}
+	alert.SetMessage("%s is reporting locations again.", "Bus 1")
+	if alert.Message != "Bus 1 is reporting locations again." {
+		t.Errorf("got message %q", alert.Message)
+	}
+	translated := testTranslations.translateAlert("es", alert)
+	if translated.Message != "Bus 1 vuelve a informar su ubicación." {
+		t.Errorf("got translated message %q", translated.Message)
+	}
+	if alert.Message != "Bus 1 is reporting locations again." {
+		t.Error("the original alert was modified")
+	}
+
+	// alerts without a format can't be translated
+	untranslatable := &shuttletracker.Alert{Message: "Bus 1 is reporting locations again."}
+	if m := testTranslations.translateAlert("es", untranslatable).Message; m != untranslatable.Message {
+		t.Errorf("got %q", m)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// knownIDsTTL is how long IDs are kept to check IDs sent by clients.
+const knownIDsTTL = 30 * time.Second
+
+// knownIDs tells whether IDs sent by clients are of things that exist, like
+// Stops, so that made-up IDs aren't counted or subscribed to.
+type knownIDs struct {
+	what string
+	list func() ([]int64, error)
+
+	lock    sync.Mutex
+	ids     map[int64]bool
+	fetched time.Time
+}
+
+// newKnownStops checks IDs against every Stop.
+func newKnownStops(ss shuttletracker.StopService) *knownIDs {
+	return &knownIDs{what: "stops", list: func() ([]int64, error) {
+		stops, err := ss.Stops()
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int64, len(stops))
+		for i, stop := range stops {
+			ids[i] = stop.ID
+		}
+		return ids, nil
+	}}
+}
+
+// newKnownVehicles checks IDs against enabled Vehicles.
+func newKnownVehicles(vs shuttletracker.VehicleService) *knownIDs {
+	return &knownIDs{what: "vehicles", list: func() ([]int64, error) {
+		vehicles, err := vs.EnabledVehicles()
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int64, len(vehicles))
+		for i, vehicle := range vehicles {
+			ids[i] = vehicle.ID
+		}
+		return ids, nil
+	}}
+}
+
+// exists returns whether the provided ID is known. If the IDs can't be read,
+// the ones read last are used.
+func (ki *knownIDs) exists(id int64, now time.Time) bool {
+	ki.lock.Lock()
+	defer ki.lock.Unlock()
+	if now.Sub(ki.fetched) > knownIDsTTL || now.Before(ki.fetched) {
+		ids, err := ki.list()
+		if err != nil {
+			log.WithError(err).Errorf("unable to get %s", ki.what)
+			return ki.ids[id]
+		}
+		ki.ids = make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			ki.ids[id] = true
+		}
+		ki.fetched = now
+	}
+	return ki.ids[id]
+}
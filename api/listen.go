@@ -0,0 +1,167 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// internalSocketName is the FileDescriptorName of systemd sockets for
+// InternalListenURL.
+const internalSocketName = "internal"
+
+// listenAndServe serves the API on every listener until the server is shut
+// down or one of them fails.
+func (api *API) listenAndServe() error {
+	listeners, internal, err := api.listen()
+	if err != nil {
+		return err
+	}
+	serve := api.configureTLS()
+
+	errs := make(chan error, len(listeners)+len(internal))
+	for _, l := range listeners {
+		l := l
+		log.Infof("Listening on %s.", l.Addr())
+		go func() {
+			errs <- serve(l)
+		}()
+	}
+	// The internal listener is meant for a private network, so it doesn't
+	// bother with HTTPS.
+	for _, l := range internal {
+		l := l
+		log.Infof("Listening on %s for internal endpoints.", l.Addr())
+		go func() {
+			errs <- api.internal.Serve(l)
+		}()
+	}
+	// Shutdown closes every listener, so the first error is either
+	// http.ErrServerClosed or a reason to stop.
+	return <-errs
+}
+
+// listen returns the sockets passed by systemd socket activation, if there
+// are any, or otherwise one for each address in ListenURL. If
+// InternalListenURL is set, it also returns sockets for the internal
+// endpoints: those from systemd named "internal", or one for each address.
+func (api *API) listen() (listeners, internal []net.Listener, err error) {
+	inherited, err := systemdListeners()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(inherited) > 0 {
+		for name, ls := range inherited {
+			if name == internalSocketName && api.internal != nil {
+				internal = append(internal, ls...)
+			} else {
+				listeners = append(listeners, ls...)
+			}
+		}
+		log.Infof("Using %d sockets from systemd.", len(listeners)+len(internal))
+		return listeners, internal, nil
+	}
+
+	listeners, err = listenAll(listenAddrs(api.cfg.ListenURL))
+	if err != nil || api.internal == nil {
+		return listeners, nil, err
+	}
+	internal, err = listenAll(listenAddrs(api.cfg.InternalListenURL))
+	if err != nil {
+		closeAll(listeners)
+		return nil, nil, err
+	}
+	return listeners, internal, nil
+}
+
+// listenAll listens on every address, or on none if any of them fail.
+func listenAll(addrs []string) ([]net.Listener, error) {
+	listeners := []net.Listener{}
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeAll(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// listenAddrs splits a comma-separated list of addresses.
+func listenAddrs(listenURL string) []string {
+	addrs := []string{}
+	for _, addr := range strings.Split(listenURL, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		// net.Listen's default
+		addrs = append(addrs, ":http")
+	}
+	return addrs
+}
+
+// systemdListeners returns the sockets passed to this process by systemd
+// socket activation, keyed by the FileDescriptorName of their socket units.
+// It returns nil if there are none. See sd_listen_fds(3).
+func systemdListeners() (map[string][]net.Listener, error) {
+	names, err := systemdFDNames(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"))
+	if err != nil || names == nil {
+		return nil, err
+	}
+	// Child processes shouldn't think that the sockets are theirs.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := map[string][]net.Listener{}
+	for i, name := range names {
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to use socket %d from systemd: %s", listenFDsStart+i, err)
+		}
+		listeners[name] = append(listeners[name], l)
+	}
+	return listeners, nil
+}
+
+// systemdFDNames returns the name of each file descriptor described by the
+// LISTEN_* environment variables, or nil if they're meant for another process.
+func systemdFDNames(pid, fds, fdNames string) ([]string, error) {
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	names := strings.Split(fdNames, ":")
+	if fdNames == "" || len(names) != n {
+		// systemd names sockets "unknown" when it doesn't say otherwise.
+		names = make([]string, n)
+		for i := range names {
+			names[i] = "unknown"
+		}
+	}
+	return names, nil
+}
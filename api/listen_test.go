@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestListenAddrs(t *testing.T) {
+	for listenURL, expected := range map[string][]string{
+		"0.0.0.0:8080":               {"0.0.0.0:8080"},
+		"0.0.0.0:8080, [::1]:8080,":  {"0.0.0.0:8080", "[::1]:8080"},
+		"":                           {":http"},
+		"127.0.0.1:80,127.0.0.1:443": {"127.0.0.1:80", "127.0.0.1:443"},
+	} {
+		if addrs := listenAddrs(listenURL); !reflect.DeepEqual(addrs, expected) {
+			t.Errorf("got %v for %q, expected %v", addrs, listenURL, expected)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	api := &API{cfg: Config{ListenURL: "127.0.0.1:0,127.0.0.1:0"}}
+	listeners, internal, err := api.listen()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer closeAll(listeners)
+	if len(listeners) != 2 || listeners[0].Addr().String() == listeners[1].Addr().String() {
+		t.Errorf("got listeners %v, expected two different addresses", listeners)
+	}
+	if len(internal) != 0 {
+		t.Errorf("got internal listeners %v, expected none", internal)
+	}
+}
+
+func TestListenInternal(t *testing.T) {
+	api := &API{
+		cfg:      Config{ListenURL: "127.0.0.1:0", InternalListenURL: "127.0.0.1:0"},
+		internal: &http.Server{},
+	}
+	listeners, internal, err := api.listen()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer closeAll(listeners)
+	defer closeAll(internal)
+	if len(listeners) != 1 || len(internal) != 1 {
+		t.Errorf("got listeners %v and internal listeners %v, expected one of each", listeners, internal)
+	}
+}
+
+func TestSystemdFDNames(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	for _, c := range []struct {
+		pid, fds, names string
+		expected        []string
+	}{
+		{"", "", "", nil},
+		{"1", "2", "", nil},
+		{pid, "2", "public:internal", []string{"public", "internal"}},
+		{pid, "2", "", []string{"unknown", "unknown"}},
+	} {
+		names, err := systemdFDNames(c.pid, c.fds, c.names)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("got %v, expected %v", names, c.expected)
+		}
+	}
+	if _, err := systemdFDNames(pid, "two", ""); err == nil {
+		t.Error("expected error for invalid LISTEN_FDS")
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// requestIDHeader carries request IDs from load balancers and back to clients.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits request IDs provided by clients so that they can't
+// fill up logs.
+const maxRequestIDLength = 64
+
+// requestID assigns each request an ID so that a bug report can be matched with
+// server logs. The ID is sent back in the X-Request-ID header and added to log
+// entries created with log.WithContext. IDs set by a load balancer are kept.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			u, err := uuid.NewV4()
+			if err != nil {
+				log.WithError(err).Error("unable to generate request ID")
+			}
+			id = u.String()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(log.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// accessLog logs each request after it has been served.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+			if websocket.IsWebSocketUpgrade(r) {
+				status = http.StatusSwitchingProtocols
+			}
+		}
+		log.WithContext(r.Context()).
+			WithField("method", r.Method).
+			WithField("path", r.URL.Path).
+			WithField("status", status).
+			WithField("duration", time.Since(start).Seconds()).
+			WithField("size", ww.BytesWritten()).
+			WithField("remote_addr", r.RemoteAddr).
+			Info("served request")
+	})
+}
+
+// errorRequestID adds the request ID to the end of plain text error responses,
+// like those written by http.Error, so that users can include it in bug reports.
+func errorRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the wrapper can't hijack connections
+		if websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() >= 400 && strings.HasPrefix(ww.Header().Get("Content-Type"), "text/plain") {
+			_, err := fmt.Fprintf(ww, "Request ID: %s\n", log.RequestID(r.Context()))
+			if err != nil {
+				log.WithContext(r.Context()).WithError(err).Error("unable to write request ID")
+			}
+		}
+	})
+}
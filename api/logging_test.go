@@ -0,0 +1,60 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	r := chi.NewRouter()
+	r.Use(requestID)
+	r.Use(accessLog)
+	r.Use(errorRequestID)
+	r.Get("/ok", func(w http.ResponseWriter, r *http.Request) {
+		seen = log.RequestID(r.Context())
+		_, _ = w.Write([]byte("ok"))
+	})
+	r.Get("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	id := w.Header().Get(requestIDHeader)
+	if id == "" || id != seen {
+		t.Errorf("got request ID %q in header and %q in context", id, seen)
+	}
+	if w.Body.String() != "ok" {
+		t.Errorf("successful response was modified: %q", w.Body.String())
+	}
+
+	// IDs from load balancers are kept
+	req := httptest.NewRequest("GET", "/error", nil)
+	req.Header.Set(requestIDHeader, "abc123")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if id := w.Header().Get(requestIDHeader); id != "abc123" {
+		t.Errorf("got request ID %q, expected abc123", id)
+	}
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if string(body) != "oops\nRequest ID: abc123\n" {
+		t.Errorf("unexpected error response %q", body)
+	}
+
+	// but not if they're too long
+	req = httptest.NewRequest("GET", "/ok", nil)
+	req.Header.Set(requestIDHeader, strings.Repeat("a", maxRequestIDLength+1))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if id := w.Header().Get(requestIDHeader); len(id) > maxRequestIDLength {
+		t.Errorf("expected long request ID to be replaced, got %q", id)
+	}
+}
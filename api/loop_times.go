@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// RouteLoopTimesHandler returns how long vehicles have recently taken to go
+// around each route by the hour of the day they started, as saved by
+// analytics.LoopTimeCalculator, optionally for only the route with
+// "route_id". Routes hidden from the public are left out.
+func (api *API) RouteLoopTimesHandler(w http.ResponseWriter, r *http.Request) {
+	var routeID *int64
+	if s := r.URL.Query().Get("route_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		routeID = &id
+	}
+	loopTimes, err := api.ans.LoopTimes()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get loop times")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	visible := make([]*shuttletracker.LoopTime, 0, len(loopTimes))
+	for _, lt := range loopTimes {
+		if routeID != nil && *routeID != lt.RouteID {
+			continue
+		}
+		if api.visibility.hidden(&lt.RouteID, now) {
+			continue
+		}
+		visible = append(visible, lt)
+	}
+	WriteJSON(w, visible)
+}
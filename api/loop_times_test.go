@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestRouteLoopTimesHandler(t *testing.T) {
+	ans := &mock.AnalyticsService{}
+	ans.On("LoopTimes").Return([]*shuttletracker.LoopTime{
+		{RouteID: 1, Hour: 8, Loops: 3, Mean: 1200, Median: 1100, Min: 1000, Max: 1500},
+		{RouteID: 2, Hour: 8, Loops: 1, Mean: 900, Median: 900, Min: 900, Max: 900},
+		{RouteID: 1, Hour: 9, Loops: 2, Mean: 1300, Median: 1300, Min: 1200, Max: 1400},
+	}, nil)
+	api := API{
+		ans: ans,
+	}
+
+	req := httptest.NewRequest("GET", "/routes/loop-times?route_id=1", nil)
+	w := httptest.NewRecorder()
+	api.RouteLoopTimesHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	var loopTimes []shuttletracker.LoopTime
+	if err := json.NewDecoder(w.Body).Decode(&loopTimes); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if len(loopTimes) != 2 || loopTimes[0].Hour != 8 || loopTimes[1].Hour != 9 {
+		t.Errorf("got %+v, expected route 1's loop times at 8 and 9", loopTimes)
+	}
+
+	req = httptest.NewRequest("GET", "/routes/loop-times?route_id=one", nil)
+	w = httptest.NewRecorder()
+	api.RouteLoopTimesHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// MaintenanceHandler lists MaintenanceRecords, most recent first, for one
+// Vehicle if the query string has a vehicle_id.
+func (api *API) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var vehicleID *int64
+	if v := r.URL.Query().Get("vehicle_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		vehicleID = &id
+	}
+	records, err := api.ms.MaintenanceRecords(vehicleID)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get maintenance records")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, records)
+}
+
+// MaintenanceCreateHandler creates a MaintenanceRecord from the JSON in the request body.
+func (api *API) MaintenanceCreateHandler(w http.ResponseWriter, r *http.Request) {
+	record := &shuttletracker.MaintenanceRecord{}
+	if err := json.NewDecoder(r.Body).Decode(record); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateMaintenanceRecord(api.ms, record); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ms.CreateMaintenanceRecord(record); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create maintenance record")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, record)
+}
+
+// MaintenanceEditHandler replaces a MaintenanceRecord with the JSON in the
+// request body, e.g. once it's known when the Vehicle will be back in service.
+func (api *API) MaintenanceEditHandler(w http.ResponseWriter, r *http.Request) {
+	record := &shuttletracker.MaintenanceRecord{}
+	if err := json.NewDecoder(r.Body).Decode(record); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateMaintenanceRecord(api.ms, record); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifyMaintenanceRecord(record)
+	if err == shuttletracker.ErrMaintenanceRecordNotFound {
+		http.Error(w, "Maintenance record not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify maintenance record")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, record)
+}
+
+// MaintenanceDeleteHandler deletes the MaintenanceRecord with the id in the query string.
+func (api *API) MaintenanceDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.DeleteMaintenanceRecord(id)
+	if err == shuttletracker.ErrMaintenanceRecordNotFound {
+		http.Error(w, "Maintenance record not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete maintenance record")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validateMaintenanceRecord checks that a MaintenanceRecord has a type, a
+// valid date, and a Vehicle that exists, and that its out-of-service window
+// starts before it ends.
+func validateMaintenanceRecord(ms shuttletracker.ModelService, record *shuttletracker.MaintenanceRecord) error {
+	record.Type = strings.TrimSpace(record.Type)
+	if record.Type == "" {
+		return fmt.Errorf("type is required")
+	}
+	if _, err := time.Parse(shuttletracker.DateFormat, record.Date); err != nil {
+		return fmt.Errorf("date %q is not like %s", record.Date, shuttletracker.DateFormat)
+	}
+	start, end := record.OutOfServiceStart, record.OutOfServiceEnd
+	if start == nil && end != nil {
+		return fmt.Errorf("out_of_service_end requires out_of_service_start")
+	}
+	if start != nil && end != nil && !end.After(*start) {
+		return fmt.Errorf("out_of_service_end %s is not after out_of_service_start %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+	_, err := ms.Vehicle(record.VehicleID)
+	if err == shuttletracker.ErrVehicleNotFound {
+		return fmt.Errorf("vehicle %d does not exist", record.VehicleID)
+	}
+	return err
+}
+
+// markOutOfService sets whether each Vehicle is out of service for
+// maintenance at t, and until when. If several MaintenanceRecords overlap,
+// the Vehicle is out of service until the last of them ends.
+func (api *API) markOutOfService(vehicles []*shuttletracker.Vehicle, t time.Time) error {
+	records, err := api.ms.OutOfService(t)
+	if err != nil {
+		return err
+	}
+	byVehicle := map[int64][]*shuttletracker.MaintenanceRecord{}
+	for _, record := range records {
+		byVehicle[record.VehicleID] = append(byVehicle[record.VehicleID], record)
+	}
+	for _, vehicle := range vehicles {
+		vehicle.OutOfService = false
+		vehicle.OutOfServiceUntil = nil
+		for _, record := range byVehicle[vehicle.ID] {
+			if !record.OutOfServiceAt(t) {
+				continue
+			}
+			if record.OutOfServiceEnd == nil {
+				// it isn't known when the vehicle will be back
+				vehicle.OutOfService = true
+				vehicle.OutOfServiceUntil = nil
+				break
+			}
+			if !vehicle.OutOfService || (vehicle.OutOfServiceUntil != nil && record.OutOfServiceEnd.After(*vehicle.OutOfServiceUntil)) {
+				end := *record.OutOfServiceEnd
+				vehicle.OutOfServiceUntil = &end
+			}
+			vehicle.OutOfService = true
+		}
+	}
+	return nil
+}
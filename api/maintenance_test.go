@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestMarkOutOfService(t *testing.T) {
+	now := time.Now()
+	start, soon, later := now.Add(-time.Hour), now.Add(time.Hour), now.Add(48*time.Hour)
+	ms := &mock.ModelService{}
+	ms.MaintenanceService.On("OutOfService", now).Return([]*shuttletracker.MaintenanceRecord{
+		{VehicleID: 1, OutOfServiceStart: &start, OutOfServiceEnd: &soon},
+		{VehicleID: 1, OutOfServiceStart: &start, OutOfServiceEnd: &later},
+		{VehicleID: 2, OutOfServiceStart: &start, OutOfServiceEnd: &soon},
+		{VehicleID: 2, OutOfServiceStart: &start},
+	}, nil)
+	api := API{ms: ms}
+	vehicles := []*shuttletracker.Vehicle{{ID: 1}, {ID: 2}, {ID: 3, OutOfService: true}}
+
+	if err := api.markOutOfService(vehicles, now); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !vehicles[0].OutOfService || vehicles[0].OutOfServiceUntil == nil || !vehicles[0].OutOfServiceUntil.Equal(later) {
+		t.Errorf("got %+v, expected vehicle 1 to be out of service until %s", vehicles[0], later)
+	}
+	if !vehicles[1].OutOfService || vehicles[1].OutOfServiceUntil != nil {
+		t.Errorf("got %+v, expected vehicle 2 to be out of service indefinitely", vehicles[1])
+	}
+	if vehicles[2].OutOfService {
+		t.Errorf("got %+v, expected vehicle 3 to be in service", vehicles[2])
+	}
+}
+
+func TestMaintenanceCreateHandlerValidation(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicle", int64(1)).Return(&shuttletracker.Vehicle{ID: 1}, nil)
+	ms.VehicleService.On("Vehicle", int64(2)).Return((*shuttletracker.Vehicle)(nil), shuttletracker.ErrVehicleNotFound)
+	ms.MaintenanceService.On("CreateMaintenanceRecord", tmock.Anything).Return(nil)
+	api := API{ms: ms}
+
+	tests := []struct {
+		body   string
+		status int
+		err    string
+	}{
+		{`{"vehicle_id": 1, "date": "2019-03-04", "type": "brakes", "out_of_service_start": "2019-03-04T08:00:00Z"}`, http.StatusOK, ""},
+		{`{"vehicle_id": 1, "date": "2019-03-04", "type": " "}`, http.StatusBadRequest, "type is required"},
+		{`{"vehicle_id": 1, "date": "3/4/2019", "type": "brakes"}`, http.StatusBadRequest, "is not like"},
+		{`{"vehicle_id": 2, "date": "2019-03-04", "type": "brakes"}`, http.StatusBadRequest, "vehicle 2 does not exist"},
+		{`{"vehicle_id": 1, "date": "2019-03-04", "type": "brakes", "out_of_service_end": "2019-03-05T08:00:00Z"}`, http.StatusBadRequest, "requires out_of_service_start"},
+		{`{"vehicle_id": 1, "date": "2019-03-04", "type": "brakes", "out_of_service_start": "2019-03-05T08:00:00Z", "out_of_service_end": "2019-03-04T08:00:00Z"}`, http.StatusBadRequest, "is not after"},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest("POST", "/maintenance/create", bytes.NewBufferString(test.body))
+		w := httptest.NewRecorder()
+		api.MaintenanceCreateHandler(w, req)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.err) {
+			t.Errorf("test %d: got %d %q, expected %d %q", i, w.Code, w.Body.String(), test.status, test.err)
+		}
+	}
+	ms.MaintenanceService.AssertNumberOfCalls(t, "CreateMaintenanceRecord", 1)
+}
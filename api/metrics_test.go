@@ -0,0 +1,32 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker/metrics"
+)
+
+func TestInstrument(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(instrument)
+	r.Get("/teapots/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	for _, path := range []string{"/teapots/1", "/teapots/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	expected := `shuttletracker_http_request_duration_seconds_count{method="GET",route="/teapots/{id}",status="418"} 2`
+	if !strings.Contains(string(body), expected) {
+		t.Errorf("expected metrics to contain %q, got:\n%s", expected, body)
+	}
+}
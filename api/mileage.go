@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/analytics"
+	"github.com/wtg/shuttletracker/log"
+)
+
+const metersPerMile = 1609.344
+
+// dailyMiles is how many miles a vehicle traveled on one day.
+type dailyMiles struct {
+	Day   string  `json:"day"`
+	Miles float64 `json:"miles"`
+}
+
+// vehicleMileage is how far a vehicle has traveled, for maintenance scheduling.
+type vehicleMileage struct {
+	VehicleID int64        `json:"vehicle_id"`
+	Days      []dailyMiles `json:"days"`
+
+	// LifetimeMiles is every day's miles since mileage was first
+	// calculated, including today so far.
+	LifetimeMiles float64 `json:"lifetime_miles"`
+}
+
+// VehicleMileageHandler reports how many miles each vehicle traveled on each
+// day in the requested range, which accepts the same filters as exports, and
+// in total. Past days come from analytics.MileageCalculator, and today is
+// added up on request.
+func (api *API) VehicleMileageHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vehicles, err := api.ms.Vehicles()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get vehicles")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	y, m, d := filter.Since.In(time.Local).Date()
+	saved, err := api.ans.Mileage(time.Date(y, m, d, 0, 0, 0, 0, time.Local), filter.Until)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get mileage")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	totals, err := api.ans.TotalMileage()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get total mileage")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	today, err := analytics.MileageToday(api.ms, time.Now())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to calculate today's mileage")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	byVehicle := map[int64]*vehicleMileage{}
+	report := []*vehicleMileage{}
+	for _, vehicle := range vehicles {
+		if !filter.MatchesVehicle(vehicle) {
+			continue
+		}
+		vm := &vehicleMileage{
+			VehicleID:     vehicle.ID,
+			Days:          []dailyMiles{},
+			LifetimeMiles: totals[vehicle.ID] / metersPerMile,
+		}
+		byVehicle[vehicle.ID] = vm
+		report = append(report, vm)
+	}
+	add := func(mileage *shuttletracker.Mileage) {
+		vm, ok := byVehicle[mileage.VehicleID]
+		if !ok {
+			return
+		}
+		vm.Days = append(vm.Days, dailyMiles{
+			Day:   mileage.Day.In(time.Local).Format(shuttletracker.DateFormat),
+			Miles: mileage.Distance / metersPerMile,
+		})
+	}
+	for _, mileage := range saved {
+		add(mileage)
+	}
+	for _, mileage := range today {
+		if vm, ok := byVehicle[mileage.VehicleID]; ok {
+			vm.LifetimeMiles += mileage.Distance / metersPerMile
+		}
+		if mileage.Day.Before(filter.Until) {
+			add(mileage)
+		}
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].VehicleID < report[j].VehicleID
+	})
+	WriteJSON(w, report)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestVehicleMileageHandler(t *testing.T) {
+	yesterday := time.Now().AddDate(0, 0, -1)
+	y, m, d := yesterday.Date()
+	yesterday = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicles").Return([]*shuttletracker.Vehicle{{ID: 1}, {ID: 2}}, nil)
+	ms.LocationService.On("ExportLocations", tmock.Anything).Return([]*shuttletracker.Location{}, nil)
+	ans := &mock.AnalyticsService{}
+	ans.On("Mileage", tmock.Anything, tmock.Anything).Return([]*shuttletracker.Mileage{
+		{VehicleID: 1, Day: yesterday, Distance: 2 * metersPerMile},
+	}, nil)
+	ans.On("TotalMileage").Return(map[int64]float64{1: 10 * metersPerMile}, nil)
+	api := API{ms: ms, ans: ans}
+
+	w := httptest.NewRecorder()
+	api.VehicleMileageHandler(w, httptest.NewRequest("GET", "/vehicles/mileage", nil))
+
+	var report []vehicleMileage
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("unable to decode mileage: %s", err)
+	}
+	if len(report) != 2 {
+		t.Fatalf("got %+v, expected both vehicles", report)
+	}
+	if len(report[0].Days) != 1 || report[0].Days[0].Day != yesterday.Format("2006-01-02") || math.Abs(report[0].Days[0].Miles-2) > 1e-9 {
+		t.Errorf("got %+v, expected 2 miles yesterday", report[0].Days)
+	}
+	if math.Abs(report[0].LifetimeMiles-10) > 1e-9 || report[1].LifetimeMiles != 0 || len(report[1].Days) != 0 {
+		t.Errorf("got %+v, expected 10 miles for vehicle 1 and none for vehicle 2", report)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// Limits on how many stops /stops/nearby returns.
+const (
+	defaultNearbyStops = 10
+	maxNearbyStops     = 50
+)
+
+// nearbyStop is a Stop and how far it is from the requested position, in meters.
+type nearbyStop struct {
+	*shuttletracker.Stop
+	Distance float64 `json:"distance"`
+}
+
+// NearbyStopsHandler returns the Stops closest to "lat" and "lng", nearest
+// first, up to "limit" (default 10), so that clients don't have to download
+// and sort every Stop themselves.
+func (api *API) NearbyStopsHandler(w http.ResponseWriter, r *http.Request) {
+	latitude, longitude, limit, err := parseNearbyStops(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stops, err := api.ms.Stops()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stops")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, nearestStops(stops, latitude, longitude, limit))
+}
+
+// parseNearbyStops reads the position and limit from the query string.
+func parseNearbyStops(r *http.Request) (latitude, longitude float64, limit int, err error) {
+	q := r.URL.Query()
+	latitude, err = parseFloat(q.Get("lat"))
+	if err != nil || latitude < -90 || latitude > 90 {
+		return 0, 0, 0, fmt.Errorf("lat must be a latitude")
+	}
+	longitude, err = parseFloat(q.Get("lng"))
+	if err != nil || longitude < -180 || longitude > 180 {
+		return 0, 0, 0, fmt.Errorf("lng must be a longitude")
+	}
+	limit = defaultNearbyStops
+	if s := q.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxNearbyStops {
+			return 0, 0, 0, fmt.Errorf("limit must be between 1 and %d", maxNearbyStops)
+		}
+	}
+	return latitude, longitude, limit, nil
+}
+
+// nearestStops returns up to limit Stops sorted by their distance from a position.
+func nearestStops(stops []*shuttletracker.Stop, latitude, longitude float64, limit int) []nearbyStop {
+	nearby := make([]nearbyStop, 0, len(stops))
+	for _, stop := range stops {
+		d := shuttletracker.DistanceBetween(latitude, longitude, stop.Latitude, stop.Longitude)
+		nearby = append(nearby, nearbyStop{stop, d})
+	}
+	sort.SliceStable(nearby, func(i, j int) bool {
+		return nearby[i].Distance < nearby[j].Distance
+	})
+	if len(nearby) > limit {
+		nearby = nearby[:limit]
+	}
+	return nearby
+}
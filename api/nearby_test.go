@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestNearbyStopsHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{
+		{ID: 1, Latitude: 42.7300, Longitude: -73.6800},
+		{ID: 2, Latitude: 42.7400, Longitude: -73.6800},
+		{ID: 3, Latitude: 42.7310, Longitude: -73.6800},
+	}, nil)
+	api := API{
+		ms: ms,
+	}
+
+	req := httptest.NewRequest("GET", "/stops/nearby?lat=42.7311&lng=-73.6800&limit=2", nil)
+	w := httptest.NewRecorder()
+	api.NearbyStopsHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+
+	var nearby []struct {
+		ID       int64   `json:"id"`
+		Distance float64 `json:"distance"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&nearby); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if len(nearby) != 2 {
+		t.Fatalf("got %d stops, expected 2", len(nearby))
+	}
+	if nearby[0].ID != 3 || nearby[1].ID != 1 {
+		t.Errorf("got stops %d and %d, expected 3 and 1", nearby[0].ID, nearby[1].ID)
+	}
+	if nearby[0].Distance < 10 || nearby[0].Distance > 12 {
+		t.Errorf("got distance %f, expected about 11 meters", nearby[0].Distance)
+	}
+}
+
+func TestNearbyStopsHandlerInvalid(t *testing.T) {
+	ms := &mock.ModelService{}
+	api := API{
+		ms: ms,
+	}
+
+	for _, query := range []string{
+		"",
+		"lat=42.73",
+		"lat=north&lng=-73.68",
+		"lat=91&lng=-73.68",
+		"lat=NaN&lng=-73.68",
+		"lat=42.73&lng=-Inf",
+		"lat=42.73&lng=-181",
+		"lat=42.73&lng=-73.68&limit=0",
+		"lat=42.73&lng=-73.68&limit=51",
+	} {
+		req := httptest.NewRequest("GET", "/stops/nearby?"+query, nil)
+		w := httptest.NewRecorder()
+		api.NearbyStopsHandler(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: got status code %d, expected 400", query, w.Code)
+		}
+	}
+	ms.StopService.AssertNotCalled(t, "Stops")
+}
@@ -13,7 +13,7 @@ import (
 func (api *API) AdminMessageHandler(w http.ResponseWriter, r *http.Request) {
 	message, err := api.msg.Message()
 	if err != nil {
-		log.WithError(err).Error("unable to get message")
+		log.WithContext(r.Context()).WithError(err).Error("unable to get message")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -25,7 +25,7 @@ func (api *API) SetAdminMessage(w http.ResponseWriter, r *http.Request) {
 	message := &shuttletracker.Message{}
 	err := json.NewDecoder(r.Body).Decode(message)
 	if err != nil {
-		log.WithError(err).Error("unable to decode message")
+		log.WithContext(r.Context()).WithError(err).Error("unable to decode message")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -36,7 +36,7 @@ func (api *API) SetAdminMessage(w http.ResponseWriter, r *http.Request) {
 	message.Message = template.HTMLEscapeString(message.Message)
 	err = api.msg.SetMessage(message)
 	if err != nil {
-		log.WithError(err).Error("unable to update message")
+		log.WithContext(r.Context()).WithError(err).Error("unable to update message")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// occupancyBroadcastChannel is used to send occupancy reports to every
+// instance so that they all agree on how full each vehicle is.
+const occupancyBroadcastChannel = "fusion.occupancy"
+
+// occupancyLevels are how full riders can say a vehicle is, from emptiest to
+// fullest.
+var occupancyLevels = [...]string{"empty", "some_seats", "standing", "full"}
+
+const (
+	// occupancyHalfLife is how long it takes for a report to count half as
+	// much as a new one, since riders get on and off.
+	occupancyHalfLife = 5 * time.Minute
+
+	// occupancyMaxAge is how long a report counts at all.
+	occupancyMaxAge = 20 * time.Minute
+
+	// occupancyReportInterval is how often each session can report, since
+	// every report is sent to every instance.
+	occupancyReportInterval = 15 * time.Second
+
+	// occupancyPruneInterval is how often reports that no longer count are
+	// forgotten.
+	occupancyPruneInterval = time.Minute
+)
+
+// fusionOccupancy is sent by a client when its rider reports how full a
+// vehicle is.
+type fusionOccupancy struct {
+	VehicleID int64  `json:"vehicle_id"`
+	Occupancy string `json:"occupancy"`
+}
+
+func (fo *fusionOccupancy) validate() error {
+	if fo.VehicleID <= 0 {
+		return fmt.Errorf("vehicle_id must be a vehicle's ID")
+	}
+	if occupancyLevel(fo.Occupancy) < 0 {
+		return fmt.Errorf("occupancy must be one of %v", occupancyLevels)
+	}
+	return nil
+}
+
+// occupancyLevel returns the index of an occupancy level, or -1 if it isn't one.
+func occupancyLevel(occupancy string) int {
+	for i, level := range occupancyLevels {
+		if level == occupancy {
+			return i
+		}
+	}
+	return -1
+}
+
+// occupancyReport is a rider's report of how full a vehicle is. Voter
+// identifies the rider's session without giving away its resume token.
+type occupancyReport struct {
+	Voter     string    `json:"voter"`
+	VehicleID int64     `json:"vehicle_id"`
+	Level     int       `json:"level"`
+	Time      time.Time `json:"time"`
+}
+
+// occupancyTracker keeps recent occupancy reports from every instance's
+// clients to work out how full each vehicle is. Only each session's latest
+// report about a vehicle counts, so that one rider can't outvote the rest by
+// reconnecting. A nil occupancyTracker knows nothing.
+type occupancyTracker struct {
+	bs shuttletracker.BroadcastService
+
+	lock    sync.Mutex
+	reports map[int64]map[string]occupancyReport
+
+	// reported is when each of this instance's sessions last reported.
+	reported map[string]time.Time
+}
+
+func newOccupancyTracker(bs shuttletracker.BroadcastService) *occupancyTracker {
+	ot := &occupancyTracker{
+		bs:       bs,
+		reports:  map[int64]map[string]occupancyReport{},
+		reported: map[string]time.Time{},
+	}
+	go ot.listen(bs.SubscribeBroadcasts(occupancyBroadcastChannel))
+	return ot
+}
+
+// handleMsgOccupancy reports how full a client says an enabled Vehicle is.
+func (fm *fusionManager) handleMsgOccupancy(clientID string, fo fusionOccupancy) {
+	client, ok := fm.clients[clientID]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if !fm.vehicles.exists(fo.VehicleID, now) {
+		fm.rejectMessage(clientID, "occupancy", fmt.Errorf("there's no vehicle %d in service", fo.VehicleID))
+		return
+	}
+	session := client.token
+	if session == "" {
+		session = client.id
+	}
+	if err := fm.occupancy.report(session, fo, now); err != nil {
+		fm.rejectMessage(clientID, "occupancy", err)
+	}
+}
+
+// report sends a session's occupancy report to every instance, unless the
+// session reported too recently.
+func (ot *occupancyTracker) report(session string, fo fusionOccupancy, now time.Time) error {
+	if ot == nil {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(session))
+	voter := hex.EncodeToString(sum[:16])
+	ot.lock.Lock()
+	if last, ok := ot.reported[voter]; ok && now.Sub(last) < occupancyReportInterval {
+		ot.lock.Unlock()
+		return fmt.Errorf("wait %s between reports", occupancyReportInterval)
+	}
+	ot.reported[voter] = now
+	ot.lock.Unlock()
+
+	b, err := json.Marshal(occupancyReport{
+		Voter:     voter,
+		VehicleID: fo.VehicleID,
+		Level:     occupancyLevel(fo.Occupancy),
+		Time:      now,
+	})
+	if err != nil {
+		log.WithError(err).Error("unable to marshal occupancy report")
+		return nil
+	}
+	// don't block run on the database
+	go func() {
+		if err := ot.bs.Broadcast(occupancyBroadcastChannel, string(b)); err != nil {
+			log.WithError(err).Error("unable to broadcast occupancy report")
+		}
+	}()
+	return nil
+}
+
+// listen records reports from every instance and periodically forgets the
+// ones that no longer count.
+func (ot *occupancyTracker) listen(ch chan string) {
+	ticker := time.NewTicker(occupancyPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case payload, ok := <-ch:
+			if !ok {
+				return
+			}
+			report := occupancyReport{}
+			if err := json.Unmarshal([]byte(payload), &report); err != nil {
+				log.WithError(err).Error("unable to unmarshal occupancy report")
+				continue
+			}
+			ot.record(report, time.Now())
+		case now := <-ticker.C:
+			ot.prune(now)
+		}
+	}
+}
+
+// record keeps a report, replacing the session's previous report about the
+// vehicle.
+func (ot *occupancyTracker) record(report occupancyReport, now time.Time) {
+	if report.Level < 0 || report.Level >= len(occupancyLevels) {
+		return
+	}
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	reports, ok := ot.reports[report.VehicleID]
+	if !ok {
+		reports = map[string]occupancyReport{}
+		ot.reports[report.VehicleID] = reports
+	}
+	reports[report.Voter] = report
+}
+
+// prune forgets reports that no longer count, vehicles without any, and
+// sessions that can report again.
+func (ot *occupancyTracker) prune(now time.Time) {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	for vehicleID, reports := range ot.reports {
+		for voter, r := range reports {
+			if now.Sub(r.Time) > occupancyMaxAge {
+				delete(reports, voter)
+			}
+		}
+		if len(reports) == 0 {
+			delete(ot.reports, vehicleID)
+		}
+	}
+	for voter, last := range ot.reported {
+		if now.Sub(last) >= occupancyReportInterval {
+			delete(ot.reported, voter)
+		}
+	}
+}
+
+// consensus returns how full riders say a vehicle is, or an empty string if
+// nobody has said recently. Each report's level is weighted by how recent it
+// is, and the weighted average is rounded to the nearest level.
+func (ot *occupancyTracker) consensus(vehicleID int64, now time.Time) string {
+	if ot == nil {
+		return ""
+	}
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	total := 0.0
+	weights := 0.0
+	for _, r := range ot.reports[vehicleID] {
+		age := now.Sub(r.Time)
+		if age > occupancyMaxAge {
+			continue
+		}
+		if age < 0 {
+			age = 0
+		}
+		weight := math.Pow(0.5, float64(age)/float64(occupancyHalfLife))
+		total += weight * float64(r.Level)
+		weights += weight
+	}
+	if weights == 0 {
+		return ""
+	}
+	return occupancyLevels[int(math.Round(total/weights))]
+}
+
+// setOccupancy sets a Location's Occupancy to the consensus for its vehicle.
+func (ot *occupancyTracker) setOccupancy(location *shuttletracker.Location, now time.Time) {
+	if location.VehicleID == nil {
+		return
+	}
+	location.Occupancy = ot.consensus(*location.VehicleID, now)
+}
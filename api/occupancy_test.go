@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestDecodeOccupancy(t *testing.T) {
+	for _, c := range []struct {
+		message string
+		err     string
+	}{
+		{`{"vehicle_id": 3, "occupancy": "standing"}`, ""},
+		{`{"vehicle_id": 3, "occupancy": "packed"}`, "occupancy must be one of"},
+		{`{"vehicle_id": 0, "occupancy": "full"}`, "vehicle_id must be a vehicle's ID"},
+		{`{"occupancy": "full"}`, "vehicle_id is required"},
+	} {
+		err := decodeClientMessage(json.RawMessage(c.message), &fusionOccupancy{}, "vehicle_id", "occupancy")
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", c.message, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: got error %v, expected %q", c.message, err, c.err)
+		}
+	}
+}
+
+func TestOccupancyConsensus(t *testing.T) {
+	now := time.Now()
+	ot := &occupancyTracker{reports: map[int64]map[string]occupancyReport{}}
+	if occupancy := ot.consensus(1, now); occupancy != "" {
+		t.Errorf("got %q, expected nothing without reports", occupancy)
+	}
+
+	ot.record(occupancyReport{Voter: "a", VehicleID: 1, Level: occupancyLevel("full"), Time: now}, now)
+	ot.record(occupancyReport{Voter: "b", VehicleID: 1, Level: occupancyLevel("empty"), Time: now}, now)
+	ot.record(occupancyReport{Voter: "c", VehicleID: 1, Level: occupancyLevel("standing"), Time: now}, now)
+	if occupancy := ot.consensus(1, now); occupancy != "standing" {
+		t.Errorf("got %q, expected the average of full, empty, and standing", occupancy)
+	}
+
+	// only each client's latest report counts
+	ot.record(occupancyReport{Voter: "b", VehicleID: 1, Level: occupancyLevel("full"), Time: now}, now)
+	if occupancy := ot.consensus(1, now); occupancy != "full" {
+		t.Errorf("got %q, expected full after b changed its report", occupancy)
+	}
+
+	// older reports count for less
+	later := now.Add(3 * occupancyHalfLife)
+	ot.record(occupancyReport{Voter: "d", VehicleID: 1, Level: occupancyLevel("empty"), Time: later}, later)
+	if occupancy := ot.consensus(1, later); occupancy != "some_seats" {
+		t.Errorf("got %q, expected a new empty report to outweigh three old full ones", occupancy)
+	}
+
+	// and expire
+	if occupancy := ot.consensus(1, later.Add(occupancyMaxAge+time.Second)); occupancy != "" {
+		t.Errorf("got %q, expected expired reports to not count", occupancy)
+	}
+	if occupancy := ot.consensus(2, later); occupancy != "" {
+		t.Errorf("got %q, expected other vehicles to be unaffected", occupancy)
+	}
+}
+
+func TestOccupancyPrune(t *testing.T) {
+	now := time.Now()
+	ot := &occupancyTracker{
+		reports:  map[int64]map[string]occupancyReport{},
+		reported: map[string]time.Time{"a": now, "b": now.Add(-occupancyReportInterval)},
+	}
+	ot.record(occupancyReport{Voter: "a", VehicleID: 1, Level: occupancyLevel("full"), Time: now}, now)
+	ot.record(occupancyReport{Voter: "b", VehicleID: 2, Level: occupancyLevel("full"), Time: now.Add(-occupancyMaxAge - time.Second)}, now)
+	ot.prune(now)
+	if _, ok := ot.reports[2]; ok || len(ot.reports[1]) != 1 {
+		t.Errorf("got %+v, expected only vehicle 1's report", ot.reports)
+	}
+	if _, ok := ot.reported["b"]; ok || len(ot.reported) != 1 {
+		t.Errorf("got %+v, expected only a to still be waiting", ot.reported)
+	}
+}
+
+func TestHandleMsgOccupancy(t *testing.T) {
+	bs := &mock.BroadcastService{}
+	bs.On("Broadcast", occupancyBroadcastChannel, tmock.AnythingOfType("string")).Return(nil)
+	vs := &mock.VehicleService{}
+	vs.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{{ID: 1}}, nil)
+	fm := &fusionManager{
+		clients: map[string]*fusionClient{
+			"a": {id: "a", token: "abc"},
+			"b": {id: "b", token: "abc"},
+		},
+		serverMsg: make(chan serverMessage, 1),
+		occupancy: &occupancyTracker{bs: bs, reports: map[int64]map[string]occupancyReport{}, reported: map[string]time.Time{}},
+		vehicles:  newKnownVehicles(vs),
+	}
+	reject := func(clientID string, fo fusionOccupancy) bool {
+		fm.handleMsgOccupancy(clientID, fo)
+		select {
+		case sm := <-fm.serverMsg:
+			return sm.clientID == clientID
+		default:
+			return false
+		}
+	}
+
+	if !reject("a", fusionOccupancy{VehicleID: 2, Occupancy: "full"}) {
+		t.Errorf("expected a report about a vehicle that isn't in service to be rejected")
+	}
+	if reject("a", fusionOccupancy{VehicleID: 1, Occupancy: "full"}) {
+		t.Errorf("expected the first report to be accepted")
+	}
+	// the same session on another connection still has to wait
+	if !reject("b", fusionOccupancy{VehicleID: 1, Occupancy: "empty"}) {
+		t.Errorf("expected a second report from the session to be rejected")
+	}
+	if len(fm.occupancy.reported) != 1 {
+		t.Errorf("got %+v, expected one voter", fm.occupancy.reported)
+	}
+	for voter := range fm.occupancy.reported {
+		if strings.Contains(voter, "abc") {
+			t.Errorf("got voter %q, expected it to not include the resume token", voter)
+		}
+	}
+}
+
+func TestSetOccupancy(t *testing.T) {
+	now := time.Now()
+	vehicleID := int64(1)
+	location := &shuttletracker.Location{VehicleID: &vehicleID}
+
+	var nilTracker *occupancyTracker
+	nilTracker.setOccupancy(location, now)
+	if location.Occupancy != "" {
+		t.Errorf("got %q, expected a nil tracker to know nothing", location.Occupancy)
+	}
+
+	ot := &occupancyTracker{reports: map[int64]map[string]occupancyReport{}}
+	ot.record(occupancyReport{Voter: "a", VehicleID: vehicleID, Level: occupancyLevel("some_seats"), Time: now}, now)
+	ot.setOccupancy(location, now)
+	if location.Occupancy != "some_seats" {
+		t.Errorf("got %q, expected some_seats", location.Occupancy)
+	}
+}
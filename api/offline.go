@@ -0,0 +1,69 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// offlineCheckInterval is how often fusionManager looks for vehicles that have
+// stopped reporting.
+const offlineCheckInterval = 30 * time.Second
+
+// vehicleOffline is sent to the vehicle_location topic when a vehicle hasn't
+// reported in a while, so that clients can stop showing it.
+type vehicleOffline struct {
+	VehicleID int64 `json:"vehicle_id"`
+
+	// LastLocation is when the vehicle last reported its location.
+	LastLocation time.Time `json:"last_location"`
+}
+
+// isOffline reports whether a vehicle whose most recent location is loc had
+// stopped reporting at now.
+func isOffline(loc *shuttletracker.Location, now time.Time, offlineAfter time.Duration) bool {
+	return now.Sub(loc.Time) > offlineAfter
+}
+
+// watchOffline periodically publishes vehicle_offline messages.
+func (fm *fusionManager) watchOffline() {
+	offline := map[int64]bool{}
+	ticker := time.NewTicker(offlineCheckInterval)
+	for now := range ticker.C {
+		fm.checkOffline(offline, now)
+	}
+}
+
+// checkOffline publishes a vehicle_offline message for each vehicle that has
+// stopped reporting since the last check. offline holds the IDs of vehicles
+// that are already known to be offline.
+func (fm *fusionManager) checkOffline(offline map[int64]bool, now time.Time) {
+	locations, err := fm.ms.LatestLocations()
+	if err != nil {
+		log.WithError(err).Error("unable to get latest vehicle locations")
+		return
+	}
+
+	for _, loc := range locations {
+		if loc.VehicleID == nil {
+			continue
+		}
+		id := *loc.VehicleID
+		if !isOffline(loc, now, fm.offlineAfter) {
+			delete(offline, id)
+			continue
+		}
+		if offline[id] {
+			continue
+		}
+		offline[id] = true
+		log.WithField("vehicle_id", id).Info("Vehicle stopped reporting.")
+		fme := fusionMessageEnvelope{
+			Type:    "vehicle_offline",
+			Message: vehicleOffline{VehicleID: id, LastLocation: loc.Time},
+		}
+		fm.sendToTopic("vehicle_location", strconv.FormatInt(id, 10), fme)
+	}
+}
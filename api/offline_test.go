@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestCheckOffline(t *testing.T) {
+	now := time.Now()
+	reporting := int64(1)
+	stopped := int64(2)
+	ms := &mock.ModelService{}
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{
+		{VehicleID: &reporting, Time: now.Add(-time.Minute)},
+		{VehicleID: &stopped, Time: now.Add(-10 * time.Minute)},
+		{Time: now.Add(-time.Hour)},
+	}, nil)
+	fm := &fusionManager{
+		ms:           ms,
+		serverMsg:    make(chan serverMessage, 10),
+		offlineAfter: 5 * time.Minute,
+	}
+
+	offline := map[int64]bool{}
+	fm.checkOffline(offline, now)
+	if len(fm.serverMsg) != 1 {
+		t.Fatalf("got %d messages, expected 1", len(fm.serverMsg))
+	}
+	sm := <-fm.serverMsg
+	if sm.topic != "vehicle_location" || sm.key != "2" {
+		t.Errorf("got topic %q and key %q, expected vehicle_location and 2", sm.topic, sm.key)
+	}
+	fme := sm.msg.(fusionMessageEnvelope)
+	if fme.Type != "vehicle_offline" {
+		t.Errorf("got type %q, expected vehicle_offline", fme.Type)
+	}
+	if vo := fme.Message.(vehicleOffline); vo.VehicleID != stopped || !vo.LastLocation.Equal(now.Add(-10*time.Minute)) {
+		t.Errorf("got unexpected message %+v", vo)
+	}
+
+	// a vehicle is only reported once while it's offline
+	fm.checkOffline(offline, now.Add(offlineCheckInterval))
+	if len(fm.serverMsg) != 0 {
+		t.Errorf("got %d messages, expected 0", len(fm.serverMsg))
+	}
+	if !offline[stopped] || offline[reporting] {
+		t.Errorf("got unexpected offline vehicles %v", offline)
+	}
+}
@@ -0,0 +1,451 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// The handlers below implement a subset of the OneBusAway REST API so that
+// existing transit apps can use Shuttle Tracker. We don't have GTFS trips, so
+// each vehicle on a route is presented as a trip of its own.
+//
+// See http://developer.onebusaway.org/modules/onebusaway-application-modules/current/api/where/index.html
+
+// obaRouteTypeBus is the GTFS route_type for buses.
+const obaRouteTypeBus = 3
+
+type obaResponse struct {
+	Code        int         `json:"code"`
+	CurrentTime int64       `json:"currentTime"`
+	Text        string      `json:"text"`
+	Version     int         `json:"version"`
+	Data        interface{} `json:"data,omitempty"`
+}
+
+type obaEntryData struct {
+	Entry      interface{}   `json:"entry"`
+	References obaReferences `json:"references"`
+}
+
+type obaListData struct {
+	List          interface{}   `json:"list"`
+	LimitExceeded bool          `json:"limitExceeded"`
+	References    obaReferences `json:"references"`
+}
+
+type obaReferences struct {
+	Agencies   []obaAgency   `json:"agencies"`
+	Routes     []obaRoute    `json:"routes"`
+	Stops      []obaStop     `json:"stops"`
+	Trips      []obaTrip     `json:"trips"`
+	Situations []interface{} `json:"situations"`
+}
+
+type obaAgency struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Timezone string `json:"timezone"`
+	Lang     string `json:"lang"`
+}
+
+type obaRoute struct {
+	ID          string `json:"id"`
+	AgencyID    string `json:"agencyId"`
+	ShortName   string `json:"shortName"`
+	LongName    string `json:"longName"`
+	Description string `json:"description"`
+	Type        int    `json:"type"`
+	Color       string `json:"color"`
+	TextColor   string `json:"textColor"`
+}
+
+type obaStop struct {
+	ID           string   `json:"id"`
+	Code         string   `json:"code"`
+	Name         string   `json:"name"`
+	Lat          float64  `json:"lat"`
+	Lon          float64  `json:"lon"`
+	Direction    string   `json:"direction"`
+	LocationType int      `json:"locationType"`
+	RouteIDs     []string `json:"routeIds"`
+
+	WheelchairBoarding string `json:"wheelchairBoarding"`
+}
+
+type obaTrip struct {
+	ID           string `json:"id"`
+	RouteID      string `json:"routeId"`
+	TripHeadsign string `json:"tripHeadsign"`
+	ServiceID    string `json:"serviceId"`
+}
+
+type obaArrivalsAndDepartures struct {
+	StopID                string                   `json:"stopId"`
+	ArrivalsAndDepartures []obaArrivalAndDeparture `json:"arrivalsAndDepartures"`
+	NearbyStopIDs         []string                 `json:"nearbyStopIds"`
+}
+
+type obaArrivalAndDeparture struct {
+	RouteID                string `json:"routeId"`
+	TripID                 string `json:"tripId"`
+	ServiceDate            int64  `json:"serviceDate"`
+	VehicleID              string `json:"vehicleId"`
+	StopID                 string `json:"stopId"`
+	StopSequence           int    `json:"stopSequence"`
+	RouteShortName         string `json:"routeShortName"`
+	TripHeadsign           string `json:"tripHeadsign"`
+	Predicted              bool   `json:"predicted"`
+	PredictedArrivalTime   int64  `json:"predictedArrivalTime"`
+	PredictedDepartureTime int64  `json:"predictedDepartureTime"`
+	ScheduledArrivalTime   int64  `json:"scheduledArrivalTime"`
+	ScheduledDepartureTime int64  `json:"scheduledDepartureTime"`
+	NumberOfStopsAway      int    `json:"numberOfStopsAway"`
+	Status                 string `json:"status"`
+}
+
+type obaLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type obaVehicleStatus struct {
+	VehicleID              string         `json:"vehicleId"`
+	LastUpdateTime         int64          `json:"lastUpdateTime"`
+	LastLocationUpdateTime int64          `json:"lastLocationUpdateTime"`
+	Location               obaLocation    `json:"location"`
+	TripID                 string         `json:"tripId"`
+	TripStatus             *obaTripStatus `json:"tripStatus"`
+	Status                 string         `json:"status"`
+	Phase                  string         `json:"phase"`
+}
+
+type obaTripStatus struct {
+	ActiveTripID      string      `json:"activeTripId"`
+	VehicleID         string      `json:"vehicleId"`
+	Position          obaLocation `json:"position"`
+	LastKnownLocation obaLocation `json:"lastKnownLocation"`
+	Orientation       float64     `json:"orientation"`
+	Predicted         bool        `json:"predicted"`
+	ScheduleDeviation int         `json:"scheduleDeviation"`
+	Status            string      `json:"status"`
+	Phase             string      `json:"phase"`
+}
+
+// obaTime converts a time to milliseconds since the Unix epoch.
+func obaTime(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// obaID prefixes one of our IDs with the agency ID.
+func (api *API) obaID(id int64) string {
+	return api.cfg.OBAAgencyID + "_" + strconv.FormatInt(id, 10)
+}
+
+func (api *API) obaTripID(routeID, vehicleID int64) string {
+	return fmt.Sprintf("%s_%d-%d", api.cfg.OBAAgencyID, routeID, vehicleID)
+}
+
+// parseOBAID parses the "{id}.json" URL parameter. The agency prefix is optional.
+func (api *API) parseOBAID(r *http.Request) (int64, error) {
+	s := strings.TrimSuffix(chi.URLParam(r, "id"), ".json")
+	s = strings.TrimPrefix(s, api.cfg.OBAAgencyID+"_")
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func (api *API) obaReferences() obaReferences {
+	return obaReferences{
+		Agencies: []obaAgency{{
+			ID:       api.cfg.OBAAgencyID,
+			Name:     api.cfg.OBAAgencyName,
+			URL:      api.cfg.OBAAgencyURL,
+			Timezone: time.Local.String(),
+			Lang:     "en",
+		}},
+		Routes:     []obaRoute{},
+		Stops:      []obaStop{},
+		Trips:      []obaTrip{},
+		Situations: []interface{}{},
+	}
+}
+
+func (api *API) obaRoute(route *shuttletracker.Route) obaRoute {
+	return obaRoute{
+		ID:          api.obaID(route.ID),
+		AgencyID:    api.cfg.OBAAgencyID,
+		ShortName:   route.Name,
+		LongName:    route.Name,
+		Description: route.Description,
+		Type:        obaRouteTypeBus,
+		Color:       strings.TrimPrefix(route.Color, "#"),
+		TextColor:   "FFFFFF",
+	}
+}
+
+func (api *API) obaStop(stop *shuttletracker.Stop, routes []*shuttletracker.Route) obaStop {
+	s := obaStop{
+		ID:       api.obaID(stop.ID),
+		Code:     strconv.FormatInt(stop.ID, 10),
+		Lat:      stop.Latitude,
+		Lon:      stop.Longitude,
+		RouteIDs: []string{},
+
+		// Stops that aren't marked accessible haven't necessarily been checked.
+		WheelchairBoarding: "UNKNOWN",
+	}
+	if stop.WheelchairAccessible {
+		s.WheelchairBoarding = "ACCESSIBLE"
+	}
+	if stop.Name != nil {
+		s.Name = *stop.Name
+	}
+	for _, route := range routes {
+		for _, id := range route.StopIDs {
+			if id == stop.ID {
+				s.RouteIDs = append(s.RouteIDs, api.obaID(route.ID))
+				break
+			}
+		}
+	}
+	return s
+}
+
+func writeOBA(w http.ResponseWriter, code int, text string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(obaResponse{
+		Code:        code,
+		CurrentTime: obaTime(time.Now()),
+		Text:        text,
+		Version:     2,
+		Data:        data,
+	})
+	if err != nil {
+		log.WithError(err).Error("unable to write OneBusAway response")
+	}
+}
+
+func writeOBAError(w http.ResponseWriter, code int, err error) {
+	writeOBA(w, code, err.Error(), nil)
+}
+
+// OBAStopHandler returns a stop and the routes that serve it.
+func (api *API) OBAStopHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := api.parseOBAID(r)
+	if err != nil {
+		writeOBAError(w, http.StatusBadRequest, err)
+		return
+	}
+	stop, err := api.ms.Stop(id)
+	if err == shuttletracker.ErrStopNotFound {
+		writeOBAError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stop")
+		writeOBAError(w, http.StatusInternalServerError, err)
+		return
+	}
+	routes, err := api.ms.RoutesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
+		writeOBAError(w, http.StatusInternalServerError, err)
+		return
+	}
+	routes = api.visibility.visible(routes, time.Now())
+
+	entry := api.obaStop(stop, routes)
+	refs := api.obaReferences()
+	for _, route := range routes {
+		for _, routeID := range entry.RouteIDs {
+			if routeID == api.obaID(route.ID) {
+				refs.Routes = append(refs.Routes, api.obaRoute(route))
+			}
+		}
+	}
+	writeOBA(w, http.StatusOK, "OK", obaEntryData{Entry: entry, References: refs})
+}
+
+// OBARouteHandler returns a route.
+func (api *API) OBARouteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := api.parseOBAID(r)
+	if err != nil {
+		writeOBAError(w, http.StatusBadRequest, err)
+		return
+	}
+	route, err := api.ms.Route(id)
+	if err == nil && api.visibility.hidden(&route.ID, time.Now()) {
+		err = shuttletracker.ErrRouteNotFound
+	}
+	if err == shuttletracker.ErrRouteNotFound {
+		writeOBAError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get route")
+		writeOBAError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeOBA(w, http.StatusOK, "OK", obaEntryData{Entry: api.obaRoute(route), References: api.obaReferences()})
+}
+
+// OBAArrivalsAndDeparturesForStopHandler returns predicted arrivals at a stop.
+func (api *API) OBAArrivalsAndDeparturesForStopHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := api.parseOBAID(r)
+	if err != nil {
+		writeOBAError(w, http.StatusBadRequest, err)
+		return
+	}
+	stop, err := api.ms.Stop(id)
+	if err == shuttletracker.ErrStopNotFound {
+		writeOBAError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stop")
+		writeOBAError(w, http.StatusInternalServerError, err)
+		return
+	}
+	routes, err := api.ms.RoutesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
+		writeOBAError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// Predictions on hidden Routes are left out along with the Routes.
+	routes = api.visibility.visible(routes, time.Now())
+	routesByID := map[int64]*shuttletracker.Route{}
+	for _, route := range routes {
+		routesByID[route.ID] = route
+	}
+
+	now := time.Now()
+	serviceDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	entry := obaArrivalsAndDepartures{
+		StopID:                api.obaID(stop.ID),
+		ArrivalsAndDepartures: []obaArrivalAndDeparture{},
+		NearbyStopIDs:         []string{},
+	}
+	refs := api.obaReferences()
+	refs.Stops = append(refs.Stops, api.obaStop(stop, routes))
+	referencedRoutes := map[int64]bool{}
+
+	for _, vehicleETA := range api.etaManager.CurrentETAs() {
+		route, ok := routesByID[vehicleETA.RouteID]
+		if !ok {
+			continue
+		}
+		for i, stopETA := range vehicleETA.StopETAs {
+			if stopETA.StopID != stop.ID {
+				continue
+			}
+			// We have no schedule, so predictions are reported as being on time.
+			eta := obaTime(stopETA.ETA)
+			tripID := api.obaTripID(route.ID, vehicleETA.VehicleID)
+			entry.ArrivalsAndDepartures = append(entry.ArrivalsAndDepartures, obaArrivalAndDeparture{
+				RouteID:                api.obaID(route.ID),
+				TripID:                 tripID,
+				ServiceDate:            obaTime(serviceDate),
+				VehicleID:              api.obaID(vehicleETA.VehicleID),
+				StopID:                 api.obaID(stop.ID),
+				RouteShortName:         route.Name,
+				TripHeadsign:           route.Name,
+				Predicted:              true,
+				PredictedArrivalTime:   eta,
+				PredictedDepartureTime: eta,
+				ScheduledArrivalTime:   eta,
+				ScheduledDepartureTime: eta,
+				NumberOfStopsAway:      i,
+				Status:                 "default",
+			})
+			refs.Trips = append(refs.Trips, obaTrip{
+				ID:           tripID,
+				RouteID:      api.obaID(route.ID),
+				TripHeadsign: route.Name,
+			})
+			if !referencedRoutes[route.ID] {
+				refs.Routes = append(refs.Routes, api.obaRoute(route))
+				referencedRoutes[route.ID] = true
+			}
+			break
+		}
+	}
+	sort.Slice(entry.ArrivalsAndDepartures, func(i, j int) bool {
+		return entry.ArrivalsAndDepartures[i].PredictedArrivalTime < entry.ArrivalsAndDepartures[j].PredictedArrivalTime
+	})
+
+	writeOBA(w, http.StatusOK, "OK", obaEntryData{Entry: entry, References: refs})
+}
+
+// OBAVehiclesForRouteHandler returns the status of each vehicle currently on a route.
+func (api *API) OBAVehiclesForRouteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := api.parseOBAID(r)
+	if err != nil {
+		writeOBAError(w, http.StatusBadRequest, err)
+		return
+	}
+	route, err := api.ms.Route(id)
+	if err == nil && api.visibility.hidden(&route.ID, time.Now()) {
+		err = shuttletracker.ErrRouteNotFound
+	}
+	if err == shuttletracker.ErrRouteNotFound {
+		writeOBAError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get route")
+		writeOBAError(w, http.StatusInternalServerError, err)
+		return
+	}
+	locations, err := api.ms.LatestLocationsContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get latest locations")
+		writeOBAError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	refs := api.obaReferences()
+	refs.Routes = append(refs.Routes, api.obaRoute(route))
+	list := []obaVehicleStatus{}
+	for _, loc := range locations {
+		if loc.VehicleID == nil || loc.RouteID == nil || *loc.RouteID != route.ID || isOffline(loc, time.Now(), api.offlineAfter) {
+			continue
+		}
+		position := obaLocation{Lat: loc.Latitude, Lon: loc.Longitude}
+		tripID := api.obaTripID(route.ID, *loc.VehicleID)
+		list = append(list, obaVehicleStatus{
+			VehicleID:              api.obaID(*loc.VehicleID),
+			LastUpdateTime:         obaTime(loc.Time),
+			LastLocationUpdateTime: obaTime(loc.Time),
+			Location:               position,
+			TripID:                 tripID,
+			TripStatus: &obaTripStatus{
+				ActiveTripID:      tripID,
+				VehicleID:         api.obaID(*loc.VehicleID),
+				Position:          position,
+				LastKnownLocation: position,
+				// OneBusAway orientation is counterclockwise from east.
+				Orientation: math.Mod(450-loc.Heading, 360),
+				Predicted:   true,
+				Status:      "default",
+				Phase:       "in_progress",
+			},
+			Status: "SCHEDULED",
+			Phase:  "in_progress",
+		})
+		refs.Trips = append(refs.Trips, obaTrip{
+			ID:           tripID,
+			RouteID:      api.obaID(route.ID),
+			TripHeadsign: route.Name,
+		})
+	}
+
+	writeOBA(w, http.StatusOK, "OK", obaListData{List: list, References: refs})
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func obaRequest(t *testing.T, id string) *http.Request {
+	req, err := http.NewRequest("GET", "", nil)
+	if err != nil {
+		t.Fatalf("unable to create HTTP request: %s", err)
+	}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestOBAArrivalsAndDeparturesForStopHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(2)).Return(&shuttletracker.Stop{ID: 2}, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: 1, Name: "West", StopIDs: []int64{2}}}, nil)
+	em := &mock.ETAService{}
+	eta := time.Now().Add(time.Minute)
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		3: {
+			VehicleID: 3,
+			RouteID:   1,
+			StopETAs:  []shuttletracker.StopETA{{StopID: 5}, {StopID: 2, ETA: eta}},
+		},
+	})
+
+	api := API{
+		cfg:          Config{OBAAgencyID: "rpi"},
+		ms:           ms,
+		etaManager:   em,
+		offlineAfter: 5 * time.Minute,
+	}
+	w := httptest.NewRecorder()
+	api.OBAArrivalsAndDeparturesForStopHandler(w, obaRequest(t, "rpi_2.json"))
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Fatalf("got status code %d, expected 200", resp.StatusCode)
+	}
+
+	var body struct {
+		Code int
+		Data struct {
+			Entry      obaArrivalsAndDepartures
+			References obaReferences
+		}
+	}
+	err := json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if body.Code != 200 {
+		t.Errorf("got code %d, expected 200", body.Code)
+	}
+	ads := body.Data.Entry.ArrivalsAndDepartures
+	if len(ads) != 1 {
+		t.Fatalf("got %d arrivals, expected 1", len(ads))
+	}
+	if ads[0].RouteID != "rpi_1" || ads[0].VehicleID != "rpi_3" || ads[0].StopID != "rpi_2" {
+		t.Errorf("unexpected arrival: %+v", ads[0])
+	}
+	if ads[0].PredictedArrivalTime != obaTime(eta) || ads[0].NumberOfStopsAway != 1 {
+		t.Errorf("unexpected arrival: %+v", ads[0])
+	}
+	if len(body.Data.References.Routes) != 1 || len(body.Data.References.Stops) != 1 {
+		t.Errorf("unexpected references: %+v", body.Data.References)
+	}
+}
+
+func TestOBAStopHandlerNotFound(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(2)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+
+	api := API{
+		cfg:          Config{OBAAgencyID: "rpi"},
+		ms:           ms,
+		offlineAfter: 5 * time.Minute,
+	}
+	w := httptest.NewRecorder()
+	api.OBAStopHandler(w, obaRequest(t, "2.json"))
+	if w.Result().StatusCode != 404 {
+		t.Errorf("got status code %d, expected 404", w.Result().StatusCode)
+	}
+}
+
+func TestOBAHidesRoutes(t *testing.T) {
+	now := time.Now()
+	vehicleID, hiddenRouteID := int64(3), int64(4)
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(2)).Return(&shuttletracker.Stop{ID: 2}, nil)
+	hidden := hiddenRoute(hiddenRouteID, now)
+	hidden.StopIDs = []int64{2}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: 1, Name: "West", StopIDs: []int64{2}}, hidden}, nil)
+	ms.RouteService.On("Route", hiddenRouteID).Return(hidden, nil)
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{
+		{VehicleID: &vehicleID, RouteID: &hiddenRouteID, Time: now},
+	}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		vehicleID: {VehicleID: vehicleID, RouteID: hiddenRouteID, StopETAs: []shuttletracker.StopETA{{StopID: 2, ETA: now.Add(time.Minute)}}},
+	})
+	api := API{
+		cfg:          Config{OBAAgencyID: "rpi"},
+		ms:           ms,
+		etaManager:   em,
+		offlineAfter: 5 * time.Minute,
+		visibility:   newRouteVisibility(ms),
+	}
+
+	w := httptest.NewRecorder()
+	api.OBAArrivalsAndDeparturesForStopHandler(w, obaRequest(t, "rpi_2.json"))
+	var body struct {
+		Data struct {
+			Entry      obaArrivalsAndDepartures
+			References obaReferences
+		}
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ads := body.Data.Entry.ArrivalsAndDepartures; len(ads) != 0 {
+		t.Errorf("got arrivals on a hidden route: %+v", ads)
+	}
+	if stops := body.Data.References.Stops; len(stops) != 1 || len(stops[0].RouteIDs) != 1 || stops[0].RouteIDs[0] != "rpi_1" {
+		t.Errorf("got stop references %+v, expected only route rpi_1", stops)
+	}
+
+	w = httptest.NewRecorder()
+	api.OBAStopHandler(w, obaRequest(t, "rpi_2.json"))
+	body.Data.References = obaReferences{}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if routes := body.Data.References.Routes; len(routes) != 1 || routes[0].ID != "rpi_1" {
+		t.Errorf("got route references %+v, expected only rpi_1", routes)
+	}
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"route":              api.OBARouteHandler,
+		"vehicles-for-route": api.OBAVehiclesForRouteHandler,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, obaRequest(t, "rpi_4.json"))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status code %d for a hidden route, expected 404", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// playbackChunk is how much history is loaded at a time during playback, so
+// that a day of Locations doesn't have to fit in memory and a database
+// connection isn't held for the whole replay.
+const playbackChunk = time.Hour
+
+// Playback speeds are multiples of real time.
+const (
+	defaultPlaybackSpeed = 60
+	maxPlaybackSpeed     = 3600
+)
+
+// playbackClockInterval is how often a "clock" event reports the playback
+// time, so that clients can keep time while no vehicles are reporting.
+const playbackClockInterval = time.Second
+
+// playback replays Locations from since until until at speed times real time.
+type playback struct {
+	ctx    context.Context
+	since  time.Time
+	until  time.Time
+	speed  float64
+	filter shuttletracker.HistoryFilter
+
+	began time.Time
+	event func(name string, v interface{}) error
+}
+
+// parsePlayback reads a playback's day, route, vehicle, and speed from the
+// query string. "date" is required, like 2019-03-01; "start" and "end" are
+// optional times of day on it, like 17:30.
+func parsePlayback(r *http.Request) (*playback, error) {
+	q := r.URL.Query()
+	day, err := time.ParseInLocation("2006-01-02", q.Get("date"), time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("date must be like 2019-03-01")
+	}
+	p := &playback{
+		ctx:   r.Context(),
+		since: day,
+		until: day.AddDate(0, 0, 1),
+		speed: defaultPlaybackSpeed,
+	}
+
+	times := map[string]*time.Time{"start": &p.since, "end": &p.until}
+	for param, dest := range times {
+		s := q.Get(param)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse("15:04", s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a time like 17:30", param)
+		}
+		*dest = time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+	}
+	if !p.since.Before(p.until) {
+		return nil, fmt.Errorf("start must be before end")
+	}
+
+	if s := q.Get("speed"); s != "" {
+		p.speed, err = parseFloat(s)
+		if err != nil || p.speed < 1 || p.speed > maxPlaybackSpeed {
+			return nil, fmt.Errorf("speed must be from 1 to %d", maxPlaybackSpeed)
+		}
+	}
+
+	ids := map[string]**int64{"route": &p.filter.RouteID, "vehicle": &p.filter.VehicleID}
+	for param, dest := range ids {
+		s := q.Get(param)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an ID", param)
+		}
+		*dest = &id
+	}
+	return p, nil
+}
+
+// now returns the playback time.
+func (p *playback) now() time.Time {
+	return p.since.Add(time.Duration(float64(time.Since(p.began)) * p.speed))
+}
+
+// waitUntil waits until the playback time reaches t, sending clock events
+// while it waits.
+func (p *playback) waitUntil(t time.Time) error {
+	for {
+		d := time.Duration(float64(t.Sub(p.now())) / p.speed)
+		if d <= 0 {
+			return nil
+		}
+		if d > playbackClockInterval {
+			d = playbackClockInterval
+		}
+		select {
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		case <-time.After(d):
+		}
+		if err := p.event("clock", p.now()); err != nil {
+			return err
+		}
+	}
+}
+
+// run sends each Location in a "location" event at its time, then an "end"
+// event.
+func (p *playback) run(ls shuttletracker.LocationService) error {
+	p.began = time.Now()
+	for since := p.since; since.Before(p.until); since = since.Add(playbackChunk) {
+		filter := p.filter
+		filter.Since = since
+		filter.Until = since.Add(playbackChunk)
+		if filter.Until.After(p.until) {
+			filter.Until = p.until
+		}
+		locations := []*shuttletracker.Location{}
+		err := ls.ExportLocations(filter, func(l *shuttletracker.Location) error {
+			locations = append(locations, l)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, l := range locations {
+			if err := p.waitUntil(l.Time); err != nil {
+				return err
+			}
+			if err := p.event("location", l); err != nil {
+				return err
+			}
+		}
+	}
+	return p.event("end", p.until)
+}
+
+// PlaybackHandler replays a day of vehicle positions as server-sent events at
+// an accelerated clock, e.g. /playback?date=2019-03-01&route=2&speed=60 plays
+// an hour of service on route 2 every minute. Each Location is sent in a
+// "location" event when the playback clock reaches its time, the playback
+// time is sent in a "clock" event every second, and an "end" event is sent
+// when the replay is over.
+func (api *API) PlaybackHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePlayback(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	p.event = func(name string, v interface{}) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if err := p.run(api.ms); err != nil && err != context.Canceled {
+		log.WithContext(r.Context()).WithError(err).Error("unable to play back locations")
+	}
+}
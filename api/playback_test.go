@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestPlaybackHandler(t *testing.T) {
+	start := time.Date(2019, time.March, 1, 8, 0, 0, 0, time.Local)
+	routeID := int64(2)
+	ms := &mock.ModelService{}
+	ms.LocationService.On("ExportLocations", shuttletracker.HistoryFilter{
+		Since:   start,
+		Until:   start.Add(5 * time.Minute),
+		RouteID: &routeID,
+	}).Return([]*shuttletracker.Location{
+		{ID: 1, Time: start.Add(30 * time.Second)},
+		{ID: 2, Time: start.Add(time.Minute)},
+	}, nil)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	began := time.Now()
+	api.PlaybackHandler(w, httptest.NewRequest("GET", "/playback?date=2019-03-01&start=08:00&end=08:05&route=2&speed=3600", nil))
+	if elapsed := time.Since(began); elapsed < time.Second/60 {
+		t.Errorf("playback took %s, expected at least a minute at 3600x", elapsed)
+	}
+
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("got Content-Type %q", w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	first := strings.Index(body, "event: location\ndata: {\"id\":1,")
+	second := strings.Index(body, "event: location\ndata: {\"id\":2,")
+	end := strings.Index(body, "event: end\n")
+	if first < 0 || second < first || end < second {
+		t.Errorf("expected two locations in order and then the end, got:\n%s", body)
+	}
+	ms.LocationService.AssertExpectations(t)
+}
+
+func TestPlaybackHandlerChunks(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.LocationService.On("ExportLocations", tmock.AnythingOfType("shuttletracker.HistoryFilter")).Return([]*shuttletracker.Location{}, nil)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	api.PlaybackHandler(w, httptest.NewRequest("GET", "/playback?date=2019-03-01&start=22:30&speed=3600", nil))
+	// 22:30 to 23:30 and 23:30 to midnight
+	ms.LocationService.AssertNumberOfCalls(t, "ExportLocations", 2)
+}
+
+func TestPlaybackHandlerBadRequest(t *testing.T) {
+	api := API{ms: &mock.ModelService{}}
+	for _, query := range []string{
+		"",
+		"date=March+1",
+		"date=2019-03-01&speed=0",
+		"date=2019-03-01&speed=10000",
+		"date=2019-03-01&speed=NaN",
+		"date=2019-03-01&start=18:00&end=17:00",
+		"date=2019-03-01&route=blue",
+	} {
+		w := httptest.NewRecorder()
+		api.PlaybackHandler(w, httptest.NewRequest("GET", "/playback?"+query, nil))
+		if w.Code != 400 {
+			t.Errorf("got status code %d for %q, expected 400", w.Code, query)
+		}
+	}
+}
@@ -1,42 +1,112 @@
 package api
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/gtfs"
 	"github.com/wtg/shuttletracker/log"
 )
 
+// ETAHandler returns every Vehicle's ETAs. If the rider's position is in the
+// "lat" and "lng" query parameters, each StopETA includes how long it takes
+// them to walk to the Stop and whether they can get there in time.
 func (api *API) ETAHandler(w http.ResponseWriter, r *http.Request) {
+	latitude, longitude, located, err := parseRiderPosition(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	etas := api.etaManager.CurrentETAs()
-	err := WriteJSON(w, etas)
+	now := time.Now()
+	for id, eta := range etas {
+		if api.visibility.hidden(&eta.RouteID, now) {
+			delete(etas, id)
+		}
+	}
+	if etasStale() {
+		for id, eta := range etas {
+			eta.Stale = true
+			etas[id] = eta
+		}
+	}
+	if located {
+		stops, err := api.ms.Stops()
+		if err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("unable to get stops")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		walkingTimes := api.walking.walkingTimes(r.Context(), latitude, longitude, stops)
+		for id, eta := range etas {
+			// the ETA manager's StopETAs are shared, so don't modify them
+			stopETAs := make([]shuttletracker.StopETA, len(eta.StopETAs))
+			for i, stopETA := range eta.StopETAs {
+				if walkingTime, ok := walkingTimes[stopETA.StopID]; ok {
+					stopETA.WalkingTime = walkingSeconds(walkingTime)
+					stopETA.Catchable = catchable(now, walkingTime, stopETA.ETA)
+				}
+				stopETAs[i] = stopETA
+			}
+			eta.StopETAs = stopETAs
+			etas[id] = eta
+		}
+	}
+	err = WriteJSON(w, etas)
 	if err != nil {
 		return
 	}
 }
 
-// RoutesHandler finds all of the routes in the database
+// RoutesHandler finds all of the routes in the database that are shown to the
+// public right now.
 func (api *API) RoutesHandler(w http.ResponseWriter, r *http.Request) {
-	routes, err := api.ms.Routes()
+	routes, err := api.ms.RoutesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	visible := make([]*shuttletracker.Route, 0, len(routes))
+	for _, route := range routes {
+		if route.VisibleAt(now) {
+			visible = append(visible, route)
+		}
+	}
+	WriteNegotiated(w, r, visible)
+}
+
+// RoutesAllHandler finds all of the routes in the database, including those
+// that are hidden from the public, for administrators.
+func (api *API) RoutesAllHandler(w http.ResponseWriter, r *http.Request) {
+	routes, err := api.ms.RoutesContext(r.Context())
 	if err != nil {
-		log.WithError(err).Error("unable to get routes")
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	WriteJSON(w, routes)
+	WriteNegotiated(w, r, routes)
 }
 
 // StopsHandler finds all of the route stops in the database
 func (api *API) StopsHandler(w http.ResponseWriter, r *http.Request) {
 	stops, err := api.ms.Stops()
 	if err != nil {
-		log.WithError(err).Error("unable to get stops")
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stops")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	WriteJSON(w, stops)
+	WriteNegotiated(w, r, stops)
 }
 
 // RoutesCreateHandler adds a new route to the database
@@ -44,18 +114,56 @@ func (api *API) RoutesCreateHandler(w http.ResponseWriter, r *http.Request) {
 	route := &shuttletracker.Route{}
 	err := json.NewDecoder(r.Body).Decode(route)
 	if err != nil {
-		log.WithError(err).Error("unable to decode route")
+		log.WithContext(r.Context()).WithError(err).Error("unable to decode route")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := validateRouteStyle(route); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateSegments(route); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	err = api.ms.CreateRoute(route)
 	if err != nil {
-		log.WithError(err).Error("unable to create route")
+		log.WithContext(r.Context()).WithError(err).Error("unable to create route")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// maxGTFSImportSize limits the size of uploaded GTFS feeds.
+const maxGTFSImportSize = 64 << 20
+
+// RoutesImportGTFSHandler creates routes and stops from a zipped GTFS feed in the request body.
+func (api *API) RoutesImportGTFSHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxGTFSImportSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	feed, err := gtfs.Parse(zr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := gtfs.Import(feed, api.ms)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to import GTFS feed")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, result)
+}
+
 // RoutesDeleteHandler deletes a route from database
 func (api *API) RoutesDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
@@ -74,24 +182,40 @@ func (api *API) RoutesDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// RoutesEditHandler Only handles editing enabled flag for now
+// RoutesEditHandler handles editing a route's enabled flag, schedule, styling,
+// how it's drawn, its directional segments, and when it's shown to the public.
 func (api *API) RoutesEditHandler(w http.ResponseWriter, r *http.Request) {
 	route := &shuttletracker.Route{}
 	err := json.NewDecoder(r.Body).Decode(route)
 	if err != nil {
-		log.WithError(err).Error("Unable to decode route")
+		log.WithContext(r.Context()).WithError(err).Error("Unable to decode route")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	en := route.Enabled
-	sched := route.Schedule
+	if err := validateRouteStyle(route); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	changes := *route
 	route, err = api.ms.Route(route.ID)
-	route.Enabled = en
-	route.Schedule = sched
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	route.Enabled = changes.Enabled
+	route.Schedule = changes.Schedule
+	route.Color = changes.Color
+	route.Label = changes.Label
+	route.Icon = changes.Icon
+	route.Width = changes.Width
+	route.ZIndex = changes.ZIndex
+	route.DashPattern = changes.DashPattern
+	route.Segments = changes.Segments
+	route.Visibility = changes.Visibility
+	if err := validateSegments(route); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	err = api.ms.ModifyRoute(route)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -99,16 +223,104 @@ func (api *API) RoutesEditHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// RoutesReorderStopsHandler replaces the order of a route's stops with the
+// stop_ids in the request body, e.g. from a drag-and-drop editor. The route's
+// segments are kept unless new ones are sent, and either way they must match
+// the new order.
+func (api *API) RoutesReorderStopsHandler(w http.ResponseWriter, r *http.Request) {
+	changes := &shuttletracker.Route{}
+	if err := json.NewDecoder(r.Body).Decode(changes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	route, err := api.ms.Route(changes.ID)
+	if err == shuttletracker.ErrRouteNotFound {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get route")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := validateStopOrder(api.ms, route, changes.StopIDs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	route.StopIDs = changes.StopIDs
+	if changes.Segments != nil {
+		route.Segments = changes.Segments
+	}
+	if err := validateSegments(route); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = api.ms.ModifyRouteStops(route)
+	if err == shuttletracker.ErrRouteNotFound {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to reorder route stops")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, route)
+}
+
+// validateStopOrder checks that every stop in a new order exists and that
+// the order has exactly the stops that the route already has, each as many
+// times as the route visits it.
+func validateStopOrder(ms shuttletracker.ModelService, route *shuttletracker.Route, stopIDs []int64) error {
+	stops, err := ms.Stops()
+	if err != nil {
+		return err
+	}
+	exists := map[int64]bool{}
+	for _, stop := range stops {
+		exists[stop.ID] = true
+	}
+	visits := map[int64]int{}
+	for _, id := range route.StopIDs {
+		visits[id]++
+	}
+	remaining := map[int64]int{}
+	for id, n := range visits {
+		remaining[id] = n
+	}
+	for _, id := range stopIDs {
+		if !exists[id] {
+			return fmt.Errorf("stop %d does not exist", id)
+		}
+		if visits[id] == 0 {
+			return fmt.Errorf("stop %d is not on route %d", id, route.ID)
+		}
+		if remaining[id] == 0 {
+			return fmt.Errorf("stop %d is only on route %d %d time(s)", id, route.ID, visits[id])
+		}
+		remaining[id]--
+	}
+	for _, id := range route.StopIDs {
+		if remaining[id] > 0 {
+			return fmt.Errorf("stop %d on route %d is missing", id, route.ID)
+		}
+	}
+	return nil
+}
+
 // StopsCreateHandler adds a new route stop to the database
 func (api *API) StopsCreateHandler(w http.ResponseWriter, r *http.Request) {
 	stop := &shuttletracker.Stop{}
 
 	err := json.NewDecoder(r.Body).Decode(stop)
 	if err != nil {
-		log.WithError(err).Error("unable to decode stop")
+		log.WithContext(r.Context()).WithError(err).Error("unable to decode stop")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := validateStop(stop); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if stop.ID < 0 {
 		err = api.ms.CreateStop(stop)
@@ -116,13 +328,78 @@ func (api *API) StopsCreateHandler(w http.ResponseWriter, r *http.Request) {
 		err = api.ms.CreateStopWithID(stop)
 	}
 	if err != nil {
-		log.WithError(err).Error("unable to create stop")
+		log.WithContext(r.Context()).WithError(err).Error("unable to create stop")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	WriteJSON(w, stop)
 }
 
+// StopsEditHandler replaces a stop's name, description, position, amenities,
+// and photo with the JSON in the request body.
+func (api *API) StopsEditHandler(w http.ResponseWriter, r *http.Request) {
+	stop := &shuttletracker.Stop{}
+	if err := json.NewDecoder(r.Body).Decode(stop); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateStop(stop); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifyStop(stop)
+	if err == shuttletracker.ErrStopNotFound {
+		http.Error(w, "Stop not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify stop")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, stop)
+}
+
+var errInvalidPhotoURL = errors.New("photo_url must be an http or https URL")
+
+// validateStop checks that a stop's photo, if it has one, is on the web.
+func validateStop(stop *shuttletracker.Stop) error {
+	if stop.PhotoURL == "" {
+		return nil
+	}
+	u, err := url.Parse(stop.PhotoURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errInvalidPhotoURL
+	}
+	return nil
+}
+
+// validateSegments checks that a route's segments, if it has any, list its
+// stops in order without leaving any out.
+func validateSegments(route *shuttletracker.Route) error {
+	if len(route.Segments) == 0 {
+		return nil
+	}
+	i := 0
+	for _, segment := range route.Segments {
+		if len(segment.StopIDs) == 0 {
+			return fmt.Errorf("segment %q has no stops", segment.Name)
+		}
+		if segment.DirectionID < 0 {
+			return fmt.Errorf("segment %q has a negative direction_id", segment.Name)
+		}
+		for _, stopID := range segment.StopIDs {
+			if i >= len(route.StopIDs) || route.StopIDs[i] != stopID {
+				return fmt.Errorf("segment %q doesn't continue the route's stops in order at stop %d", segment.Name, stopID)
+			}
+			i++
+		}
+	}
+	if i != len(route.StopIDs) {
+		return fmt.Errorf("segments leave out the route's last %d stops", len(route.StopIDs)-i)
+	}
+	return nil
+}
+
 func (api *API) StopsDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
 	if err != nil {
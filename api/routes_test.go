@@ -1,3 +1,174 @@
 package api
 
-import ()
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestValidateStop(t *testing.T) {
+	tests := []struct {
+		photoURL string
+		valid    bool
+	}{
+		{"", true},
+		{"https://shuttles.rpi.edu/stops/union.jpg", true},
+		{"http://example.com/a.png", true},
+		{"javascript:alert(1)", false},
+		{"/stops/union.jpg", false},
+		{"https://", false},
+	}
+	for _, test := range tests {
+		err := validateStop(&shuttletracker.Stop{PhotoURL: test.photoURL})
+		if test.valid && err != nil {
+			t.Errorf("%q: unexpected error: %s", test.photoURL, err)
+		} else if !test.valid && err != errInvalidPhotoURL {
+			t.Errorf("%q: got error %v, expected errInvalidPhotoURL", test.photoURL, err)
+		}
+	}
+}
+
+func TestStopsEditHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("ModifyStop", tmock.Anything).Return(nil)
+	api := API{ms: ms}
+
+	body := bytes.NewBufferString(`{"id": 4, "name": "Union", "latitude": 42.73, "longitude": -73.67, "shelter": true,
+		"bench": true, "wheelchair_accessible": true, "photo_url": "https://example.com/union.jpg"}`)
+	w := httptest.NewRecorder()
+	api.StopsEditHandler(w, httptest.NewRequest("POST", "/stops/edit", body))
+	if w.Code != 200 {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	stop := &shuttletracker.Stop{}
+	if err := json.NewDecoder(w.Body).Decode(stop); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if !stop.Shelter || stop.Lighting || !stop.Bench || !stop.WheelchairAccessible || stop.PhotoURL != "https://example.com/union.jpg" {
+		t.Errorf("got %+v, expected amenities to be saved", stop)
+	}
+	ms.StopService.AssertNumberOfCalls(t, "ModifyStop", 1)
+}
+
+func TestStopsEditHandlerNotFound(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("ModifyStop", tmock.Anything).Return(shuttletracker.ErrStopNotFound)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	api.StopsEditHandler(w, httptest.NewRequest("POST", "/stops/edit", bytes.NewBufferString(`{"id": 9}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status code %d, expected 404", w.Code)
+	}
+}
+
+func TestValidateSegments(t *testing.T) {
+	stopIDs := []int64{1, 2, 3, 2, 1}
+	tests := []struct {
+		segments []shuttletracker.RouteSegment
+		valid    bool
+	}{
+		{nil, true},
+		{[]shuttletracker.RouteSegment{
+			{DirectionID: 0, Name: "Outbound", StopIDs: []int64{1, 2, 3}},
+			{DirectionID: 1, Name: "Inbound", StopIDs: []int64{2, 1}},
+		}, true},
+		{[]shuttletracker.RouteSegment{
+			{DirectionID: 0, Name: "Outbound", StopIDs: []int64{1, 2, 3}},
+		}, false},
+		{[]shuttletracker.RouteSegment{
+			{DirectionID: 0, Name: "Outbound", StopIDs: []int64{1, 2, 3}},
+			{DirectionID: 1, Name: "Inbound", StopIDs: []int64{1, 2}},
+		}, false},
+		{[]shuttletracker.RouteSegment{
+			{DirectionID: 0, Name: "Outbound", StopIDs: []int64{1, 2, 3, 2, 1, 4}},
+		}, false},
+		{[]shuttletracker.RouteSegment{
+			{DirectionID: 0, Name: "Outbound", StopIDs: []int64{1, 2, 3, 2, 1}},
+			{DirectionID: 1, Name: "Inbound"},
+		}, false},
+		{[]shuttletracker.RouteSegment{
+			{DirectionID: -1, Name: "Outbound", StopIDs: []int64{1, 2, 3, 2, 1}},
+		}, false},
+	}
+	for i, test := range tests {
+		err := validateSegments(&shuttletracker.Route{StopIDs: stopIDs, Segments: test.segments})
+		if test.valid && err != nil {
+			t.Errorf("%d: unexpected error: %s", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%d: expected an error", i)
+		}
+	}
+
+	route := &shuttletracker.Route{StopIDs: stopIDs, Segments: tests[1].segments}
+	for i, direction := range []int64{0, 0, 0, 1, 1} {
+		if segment := route.SegmentAt(i); segment == nil || segment.DirectionID != direction {
+			t.Errorf("stop %d: got segment %+v, expected direction %d", i, segment, direction)
+		}
+	}
+	if segment := route.SegmentAt(len(stopIDs)); segment != nil {
+		t.Errorf("got segment %+v past the last stop", segment)
+	}
+}
+
+func TestRoutesReorderStopsHandler(t *testing.T) {
+	newAPI := func() (*API, *mock.ModelService) {
+		ms := &mock.ModelService{}
+		route := &shuttletracker.Route{
+			ID:      1,
+			StopIDs: []int64{1, 2, 3, 2},
+			Segments: []shuttletracker.RouteSegment{
+				{DirectionID: 0, StopIDs: []int64{1, 2, 3}},
+				{DirectionID: 1, StopIDs: []int64{2}},
+			},
+		}
+		ms.RouteService.On("Route", int64(1)).Return(route, nil)
+		ms.RouteService.On("Route", int64(2)).Return((*shuttletracker.Route)(nil), shuttletracker.ErrRouteNotFound)
+		ms.StopService.On("Stops").Return([]*shuttletracker.Stop{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}, nil)
+		ms.RouteService.On("ModifyRouteStops", tmock.Anything).Return(nil)
+		return &API{ms: ms}, ms
+	}
+
+	for _, c := range []struct {
+		body   string
+		status int
+	}{
+		{`{"id": 1, "stop_ids": [2, 3, 1, 2], "segments": []}`, http.StatusOK},
+		{`{"id": 1, "stop_ids": [1, 2, 3, 2], "segments": [{"direction_id": 0, "stop_ids": [1, 2]}, {"direction_id": 1, "stop_ids": [3, 2]}]}`, http.StatusOK},
+		// the route's segments don't match the new order
+		{`{"id": 1, "stop_ids": [2, 3, 1, 2]}`, http.StatusBadRequest},
+		// stop 4 isn't on the route
+		{`{"id": 1, "stop_ids": [1, 2, 3, 4], "segments": []}`, http.StatusBadRequest},
+		// stop 5 doesn't exist
+		{`{"id": 1, "stop_ids": [1, 2, 3, 5], "segments": []}`, http.StatusBadRequest},
+		// stop 2 is left out
+		{`{"id": 1, "stop_ids": [1, 2, 3], "segments": []}`, http.StatusBadRequest},
+		// stop 3 is visited twice
+		{`{"id": 1, "stop_ids": [1, 2, 3, 3], "segments": []}`, http.StatusBadRequest},
+		{`{"id": 2, "stop_ids": []}`, http.StatusNotFound},
+	} {
+		api, ms := newAPI()
+		req := httptest.NewRequest("POST", "/routes/reorder-stops", bytes.NewBufferString(c.body))
+		w := httptest.NewRecorder()
+		api.RoutesReorderStopsHandler(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: got status code %d, expected %d: %s", c.body, w.Code, c.status, w.Body.String())
+			continue
+		}
+		if c.status != http.StatusOK {
+			ms.RouteService.AssertNotCalled(t, "ModifyRouteStops", tmock.Anything)
+			continue
+		}
+		modified := ms.RouteService.Calls[len(ms.RouteService.Calls)-1].Arguments[0].(*shuttletracker.Route)
+		if len(modified.StopIDs) != 4 || validateSegments(modified) != nil {
+			t.Errorf("%s: got %+v", c.body, modified)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// maxScheduleImportSize limits the size of uploaded schedule CSVs.
+const maxScheduleImportSize = 8 << 20
+
+// scheduleImportColumns are the columns that a schedule CSV must have.
+// "direction" and "departure" are optional.
+var scheduleImportColumns = []string{"route", "schedule", "days", "trip", "stop", "arrival"}
+
+// importError is a problem with a line of an imported file. Line 1 is the
+// header.
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// scheduleImport is the result of importing a schedule CSV. Nothing is
+// imported if there are any Errors.
+type scheduleImport struct {
+	Created   int                        `json:"created"`
+	Replaced  int                        `json:"replaced"`
+	Schedules []*shuttletracker.Schedule `json:"schedules"`
+	Errors    []importError              `json:"errors"`
+}
+
+// SchedulesImportHandler creates Schedules from a CSV in the request body,
+// with a line for each StopTime. Schedules with the same Route and name as
+// an existing Schedule replace it. If any line has a problem, it responds
+// with 400 and every problem, and nothing is imported. With "dry_run=true",
+// the CSV is only checked.
+func (api *API) SchedulesImportHandler(w http.ResponseWriter, r *http.Request) {
+	routes, err := api.ms.Routes()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stops, err := api.ms.Stops()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stops")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	schedules, lines, errs := parseScheduleCSV(http.MaxBytesReader(w, r.Body, maxScheduleImportSize), routes, stops)
+	if len(errs) == 0 {
+		for _, s := range schedules {
+			if err := validateSchedule(api.ms, s); err != nil {
+				errs = append(errs, importError{Line: lines[s], Error: fmt.Sprintf("schedule %q: %s", s.Name, err)})
+			}
+		}
+	}
+	result := scheduleImport{Schedules: schedules, Errors: errs}
+	if len(errs) > 0 {
+		result.Schedules = []*shuttletracker.Schedule{}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		WriteJSON(w, result)
+		return
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		WriteJSON(w, result)
+		return
+	}
+
+	existing, err := api.ms.Schedules()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get schedules")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, s := range schedules {
+		for _, e := range existing {
+			if e.RouteID == s.RouteID && strings.EqualFold(e.Name, s.Name) {
+				s.ID = e.ID
+			}
+		}
+		if s.ID != 0 {
+			result.Replaced++
+		} else {
+			result.Created++
+		}
+	}
+	if err = api.ms.ReplaceSchedules(schedules); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to import schedules")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, result)
+}
+
+// parseScheduleCSV reads Schedules from a CSV with a line for each StopTime,
+// in the order each Trip visits its Stops. Lines are grouped into Schedules
+// by Route and schedule name, and into Trips by trip name. Routes and Stops
+// can be given by ID or name. It returns the line that each Schedule starts
+// on, and a problem for each line that couldn't be read.
+func parseScheduleCSV(r io.Reader, routes []*shuttletracker.Route, stops []*shuttletracker.Stop) ([]*shuttletracker.Schedule, map[*shuttletracker.Schedule]int, []importError) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, []importError{{Line: 1, Error: "file is empty"}}
+	} else if err != nil {
+		return nil, nil, []importError{{Line: 1, Error: err.Error()}}
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	var errs []importError
+	for _, name := range scheduleImportColumns {
+		if _, ok := columns[name]; !ok {
+			errs = append(errs, importError{Line: 1, Error: fmt.Sprintf("missing column %q", name)})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	stopsByID := map[int64]*shuttletracker.Stop{}
+	for _, stop := range stops {
+		stopsByID[stop.ID] = stop
+	}
+
+	type scheduleKey struct {
+		routeID int64
+		name    string
+	}
+	type tripKey struct {
+		schedule scheduleKey
+		name     string
+	}
+	schedules := []*shuttletracker.Schedule{}
+	scheduleLines := map[*shuttletracker.Schedule]int{}
+	byKey := map[scheduleKey]*shuttletracker.Schedule{}
+	trips := map[tripKey]*shuttletracker.Trip{}
+	tripLines := map[*shuttletracker.Trip]int{}
+
+	line := 1
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if pe, ok := err.(*csv.ParseError); ok {
+				return nil, nil, append(errs, importError{Line: pe.Line, Error: pe.Err.Error()})
+			}
+			return nil, nil, append(errs, importError{Line: line + 1, Error: err.Error()})
+		}
+		line++
+		get := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[i])
+		}
+		if strings.TrimSpace(strings.Join(fields, "")) == "" {
+			continue
+		}
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, importError{Line: line, Error: fmt.Sprintf(format, args...)})
+		}
+
+		route := findImportRoute(routes, get("route"))
+		if route == nil {
+			fail("route %q does not exist", get("route"))
+			continue
+		}
+		key := scheduleKey{route.ID, strings.ToLower(get("schedule"))}
+		var days []time.Weekday
+		if s := get("days"); s != "" {
+			days, err = parseDays(s)
+			if err != nil {
+				fail("%s", err)
+				continue
+			}
+		}
+		schedule := byKey[key]
+		if schedule == nil {
+			if days == nil {
+				fail("days are required on the first line of a schedule")
+				continue
+			}
+			schedule = &shuttletracker.Schedule{RouteID: route.ID, Name: get("schedule"), Days: days, Trips: []*shuttletracker.Trip{}}
+			byKey[key] = schedule
+			scheduleLines[schedule] = line
+			schedules = append(schedules, schedule)
+		} else if days != nil && !sameDays(days, schedule.Days) {
+			fail("days %q differ from line %d", get("days"), scheduleLines[schedule])
+			continue
+		}
+
+		if get("trip") == "" {
+			fail("trip is required")
+			continue
+		}
+		stop := findImportStop(route, stopsByID, get("stop"))
+		if stop == nil {
+			fail("stop %q is not on route %s", get("stop"), route.Name)
+			continue
+		}
+		arrival, err := shuttletracker.ParseTimeOfDay(get("arrival"))
+		if err != nil {
+			fail("arrival: %s", err)
+			continue
+		}
+		departure := arrival
+		if s := get("departure"); s != "" {
+			departure, err = shuttletracker.ParseTimeOfDay(s)
+			if err != nil {
+				fail("departure: %s", err)
+				continue
+			}
+		}
+		if departure < arrival {
+			fail("departs at %s, before arriving at %s", departure, arrival)
+			continue
+		}
+
+		tk := tripKey{key, get("trip")}
+		trip := trips[tk]
+		if trip == nil {
+			trip = &shuttletracker.Trip{Direction: get("direction")}
+			trips[tk] = trip
+			tripLines[trip] = line
+			schedule.Trips = append(schedule.Trips, trip)
+		} else if last := trip.StopTimes[len(trip.StopTimes)-1]; arrival < last.Departure {
+			fail("arrives at %s, before leaving the previous stop at %s", arrival, last.Departure)
+			continue
+		}
+		trip.StopTimes = append(trip.StopTimes, shuttletracker.StopTime{StopID: stop.ID, Arrival: arrival, Departure: departure})
+	}
+
+	for tk, trip := range trips {
+		if len(trip.StopTimes) < 2 {
+			errs = append(errs, importError{Line: tripLines[trip], Error: fmt.Sprintf("trip %q must stop at least twice", tk.name)})
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line
+	})
+	return schedules, scheduleLines, errs
+}
+
+// findImportRoute finds a Route by ID or case-insensitive name.
+func findImportRoute(routes []*shuttletracker.Route, s string) *shuttletracker.Route {
+	id, err := strconv.ParseInt(s, 10, 64)
+	for _, route := range routes {
+		if err == nil && route.ID == id || strings.EqualFold(route.Name, s) {
+			return route
+		}
+	}
+	return nil
+}
+
+// findImportStop finds one of a Route's Stops by ID or case-insensitive name.
+func findImportStop(route *shuttletracker.Route, stops map[int64]*shuttletracker.Stop, s string) *shuttletracker.Stop {
+	id, err := strconv.ParseInt(s, 10, 64)
+	for _, stopID := range route.StopIDs {
+		stop := stops[stopID]
+		if stop == nil {
+			continue
+		}
+		if err == nil && stop.ID == id || stop.Name != nil && strings.EqualFold(*stop.Name, s) {
+			return stop
+		}
+	}
+	return nil
+}
+
+// parseDays parses days of the week like "Mon-Fri", "Sat, Sun", "weekdays",
+// or "1 2 3", where 0 is Sunday.
+func parseDays(s string) ([]time.Weekday, error) {
+	seen := map[time.Weekday]bool{}
+	tokens := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ',' || r == ';' || r == '/' || r == ' '
+	})
+	for _, token := range tokens {
+		switch token {
+		case "weekdays":
+			token = "mon-fri"
+		case "weekends":
+			token = "sat-sun"
+		}
+		bounds := strings.SplitN(token, "-", 2)
+		first, err := parseDay(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseDay(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		// Ranges like Fri-Mon wrap around the weekend.
+		for d := first; ; d = (d + 1) % 7 {
+			seen[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("%q has no days", s)
+	}
+	days := []time.Weekday{}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if seen[d] {
+			days = append(days, d)
+		}
+	}
+	return days, nil
+}
+
+// parseDay parses a day of the week's number or a prefix of its name, like "tu".
+func parseDay(s string) (time.Weekday, error) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 6 {
+		return time.Weekday(n), nil
+	}
+	if len(s) >= 2 {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.HasPrefix(strings.ToLower(d.String()), s) {
+				return d, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%q is not a day of the week", s)
+}
+
+func sameDays(a, b []time.Weekday) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func scheduleImportModel() *mock.ModelService {
+	union, sage := "Union", "Sage"
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+		{ID: 1, Name: "East", StopIDs: []int64{2, 3}},
+		{ID: 4, Name: "West", StopIDs: []int64{2}},
+	}, nil)
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{
+		{ID: 2, Name: &union},
+		{ID: 3, Name: &sage},
+	}, nil)
+	return ms
+}
+
+func TestSchedulesImportHandler(t *testing.T) {
+	ms := scheduleImportModel()
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{{ID: 9, RouteID: 1, Name: "weekday"}}, nil)
+	ms.ScheduleService.On("ReplaceSchedules", tmock.AnythingOfType("[]*shuttletracker.Schedule")).Return(nil)
+	api := API{ms: ms}
+
+	body := "\ufeffRoute,Schedule,Days,Trip,Direction,Stop,Arrival,Departure\n" +
+		"East,Weekday,Mon-Fri,1,east,Union,07:30,07:31\n" +
+		"East,Weekday,,1,east,Sage,07:40,\n" +
+		"\n" +
+		"1,Weekday,,2,east,2,08:30,08:30\n" +
+		"1,Weekday,,2,east,3,08:40,08:40\n" +
+		"east,Saturday,Sat,1,,union,24:10,\n" +
+		"east,Saturday,,1,,sage,24:20,\n"
+	w := httptest.NewRecorder()
+	api.SchedulesImportHandler(w, httptest.NewRequest("POST", "/routes/schedules/import", strings.NewReader(body)))
+	if w.Code != 200 {
+		t.Fatalf("got status code %d: %s", w.Code, w.Body)
+	}
+
+	result := scheduleImport{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unable to decode result: %s", err)
+	}
+	if result.Created != 1 || result.Replaced != 1 || len(result.Errors) != 0 {
+		t.Errorf("got %+v, expected one schedule created and one replaced", result)
+	}
+
+	ms.ScheduleService.AssertNumberOfCalls(t, "ReplaceSchedules", 1)
+	schedules := ms.ScheduleService.Calls[1].Arguments.Get(0).([]*shuttletracker.Schedule)
+	if len(schedules) != 2 {
+		t.Fatalf("got %d schedules, expected 2", len(schedules))
+	}
+	weekday := schedules[0]
+	if weekday.ID != 9 || !reflect.DeepEqual(weekday.Days, []time.Weekday{1, 2, 3, 4, 5}) || len(weekday.Trips) != 2 {
+		t.Fatalf("got %+v, expected weekday schedule 9 with two trips", weekday)
+	}
+	expected := []shuttletracker.StopTime{
+		{StopID: 2, Arrival: shuttletracker.TimeOfDay(7*time.Hour + 30*time.Minute), Departure: shuttletracker.TimeOfDay(7*time.Hour + 31*time.Minute)},
+		{StopID: 3, Arrival: shuttletracker.TimeOfDay(7*time.Hour + 40*time.Minute), Departure: shuttletracker.TimeOfDay(7*time.Hour + 40*time.Minute)},
+	}
+	if !reflect.DeepEqual(weekday.Trips[0].StopTimes, expected) || weekday.Trips[0].Direction != "east" {
+		t.Errorf("got trip %+v, expected %+v", weekday.Trips[0], expected)
+	}
+	saturday := schedules[1]
+	if saturday.ID != 0 || saturday.Name != "Saturday" || !reflect.DeepEqual(saturday.Days, []time.Weekday{time.Saturday}) {
+		t.Errorf("got %+v, expected Saturday schedule", saturday)
+	}
+}
+
+func TestSchedulesImportHandlerErrors(t *testing.T) {
+	ms := scheduleImportModel()
+	api := API{ms: ms}
+
+	body := "route,schedule,days,trip,stop,arrival,departure\n" +
+		"East,Weekday,Mon-Fri,1,Union,07:30,07:31\n" +
+		"East,Weekday,Sat,1,Sage,07:40,\n" +
+		"North,Weekday,Mon,1,Union,07:30,\n" +
+		"West,Weekday,Mon,1,Sage,07:30,\n" +
+		"West,Weekday,Mon,1,Union,7:30pm,\n" +
+		"East,Weekday,,1,Sage,07:20,\n" +
+		"East,Sunday,Someday,1,Union,07:20,\n" +
+		"East,Sunday,,1,Union,07:20,\n"
+	w := httptest.NewRecorder()
+	api.SchedulesImportHandler(w, httptest.NewRequest("POST", "/routes/schedules/import", strings.NewReader(body)))
+	if w.Code != 400 {
+		t.Fatalf("got status code %d, expected 400: %s", w.Code, w.Body)
+	}
+
+	result := scheduleImport{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unable to decode result: %s", err)
+	}
+	expected := []importError{
+		{Line: 2, Error: `trip "1" must stop at least twice`},
+		{Line: 3, Error: `days "Sat" differ from line 2`},
+		{Line: 4, Error: `route "North" does not exist`},
+		{Line: 5, Error: `stop "Sage" is not on route West`},
+		{Line: 6, Error: `arrival: "7:30pm" is not a time like "08:15"`},
+		{Line: 7, Error: "arrives at 07:20:00, before leaving the previous stop at 07:31:00"},
+		{Line: 8, Error: `"someday" is not a day of the week`},
+		{Line: 9, Error: "days are required on the first line of a schedule"},
+	}
+	if !reflect.DeepEqual(result.Errors, expected) {
+		t.Errorf("got errors %+v, expected %+v", result.Errors, expected)
+	}
+	ms.ScheduleService.AssertNotCalled(t, "ReplaceSchedules", tmock.Anything)
+}
+
+func TestSchedulesImportHandlerMissingColumns(t *testing.T) {
+	api := API{ms: scheduleImportModel()}
+	w := httptest.NewRecorder()
+	api.SchedulesImportHandler(w, httptest.NewRequest("POST", "/routes/schedules/import", strings.NewReader("route,trip,stop\n")))
+	if w.Code != 400 || !strings.Contains(w.Body.String(), `missing column \"arrival\"`) {
+		t.Errorf("got status code %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	tests := map[string][]time.Weekday{
+		"Mon-Fri":      {1, 2, 3, 4, 5},
+		"sat, sun":     {0, 6},
+		"Weekends":     {0, 6},
+		"Fri-Mon":      {0, 1, 5, 6},
+		"1 3/5;tues":   {1, 2, 3, 5},
+		"Thursday,Thu": {4},
+	}
+	for s, expected := range tests {
+		days, err := parseDays(s)
+		if err != nil || !reflect.DeepEqual(days, expected) {
+			t.Errorf("%q: got %v, %v, expected %v", s, days, err, expected)
+		}
+	}
+	for _, s := range []string{"", "t", "7", "Mon-", "Funday"} {
+		if days, err := parseDays(s); err == nil {
+			t.Errorf("%q: got %v, expected error", s, days)
+		}
+	}
+}
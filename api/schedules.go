@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// SchedulesHandler lists every Schedule and its Trips.
+func (api *API) SchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := api.ms.Schedules()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get schedules")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, schedules)
+}
+
+// SchedulesCreateHandler creates a Schedule from the JSON in the request body.
+func (api *API) SchedulesCreateHandler(w http.ResponseWriter, r *http.Request) {
+	schedule := &shuttletracker.Schedule{}
+	if err := json.NewDecoder(r.Body).Decode(schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateSchedule(api.ms, schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ms.CreateSchedule(schedule); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create schedule")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, schedule)
+}
+
+// SchedulesEditHandler replaces a Schedule and all of its Trips with the JSON
+// in the request body.
+func (api *API) SchedulesEditHandler(w http.ResponseWriter, r *http.Request) {
+	schedule := &shuttletracker.Schedule{}
+	if err := json.NewDecoder(r.Body).Decode(schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateSchedule(api.ms, schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifySchedule(schedule)
+	if err == shuttletracker.ErrScheduleNotFound {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify schedule")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, schedule)
+}
+
+// SchedulesDeleteHandler deletes the Schedule with the id in the query string.
+func (api *API) SchedulesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.DeleteSchedule(id)
+	if err == shuttletracker.ErrScheduleNotFound {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete schedule")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validateSchedule checks that a Schedule is for an existing Route, that its
+// Trips only visit that Route's Stops, and that each Trip's times make sense.
+func validateSchedule(ms shuttletracker.ModelService, schedule *shuttletracker.Schedule) error {
+	routes, err := ms.Routes()
+	if err != nil {
+		return err
+	}
+	var route *shuttletracker.Route
+	for _, r := range routes {
+		if r.ID == schedule.RouteID {
+			route = r
+		}
+	}
+	if route == nil {
+		return fmt.Errorf("route %d does not exist", schedule.RouteID)
+	}
+	onRoute := map[int64]bool{}
+	for _, stopID := range route.StopIDs {
+		onRoute[stopID] = true
+	}
+
+	seen := map[int]bool{}
+	for _, day := range schedule.Days {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("day %d is not between 0 (Sunday) and 6 (Saturday)", day)
+		}
+		if seen[int(day)] {
+			return fmt.Errorf("%s is listed more than once", day)
+		}
+		seen[int(day)] = true
+	}
+
+	for i, trip := range schedule.Trips {
+		if len(trip.StopTimes) < 2 {
+			return fmt.Errorf("trip %d must stop at least twice", i+1)
+		}
+		var last shuttletracker.TimeOfDay
+		for j, st := range trip.StopTimes {
+			if !onRoute[st.StopID] {
+				return fmt.Errorf("trip %d: stop %d is not on route %d", i+1, st.StopID, route.ID)
+			}
+			if st.Departure < st.Arrival {
+				return fmt.Errorf("trip %d: departs stop %d at %s, before arriving at %s", i+1, st.StopID, st.Departure, st.Arrival)
+			}
+			if j > 0 && st.Arrival < last {
+				return fmt.Errorf("trip %d: arrives at stop %d at %s, before leaving the previous stop at %s", i+1, st.StopID, st.Arrival, last)
+			}
+			last = st.Departure
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestSchedulesCreateHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: 1, StopIDs: []int64{2, 3}}}, nil)
+	ms.ScheduleService.On("CreateSchedule", tmock.AnythingOfType("*shuttletracker.Schedule")).Return(nil)
+	api := API{ms: ms}
+
+	body := `{"route_id": 1, "name": "Weekday", "days": [1, 2, 3, 4, 5], "trips": [{"direction": "east", "stop_times": [
+		{"stop_id": 2, "arrival": "08:00", "departure": "08:01"},
+		{"stop_id": 3, "arrival": "24:10:30", "departure": "24:10:30"}]}]}`
+	w := httptest.NewRecorder()
+	api.SchedulesCreateHandler(w, httptest.NewRequest("POST", "/routes/schedules/create", strings.NewReader(body)))
+	if w.Code != 200 {
+		t.Fatalf("got status code %d: %s", w.Code, w.Body)
+	}
+	schedule := ms.ScheduleService.Calls[0].Arguments.Get(0).(*shuttletracker.Schedule)
+	st := schedule.Trips[0].StopTimes[1]
+	if st.Arrival != shuttletracker.TimeOfDay(24*time.Hour+10*time.Minute+30*time.Second) {
+		t.Errorf("got arrival %s", st.Arrival)
+	}
+	if !strings.Contains(w.Body.String(), `"arrival": "24:10:30"`) {
+		t.Errorf("got response %s", w.Body)
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: 1, StopIDs: []int64{2, 3}}}, nil)
+	stopTimes := func(stopIDs ...int64) []shuttletracker.StopTime {
+		sts := []shuttletracker.StopTime{}
+		for i, id := range stopIDs {
+			at := shuttletracker.TimeOfDay(time.Duration(8*60+i) * time.Minute)
+			sts = append(sts, shuttletracker.StopTime{StopID: id, Arrival: at, Departure: at})
+		}
+		return sts
+	}
+
+	for _, c := range []struct {
+		schedule *shuttletracker.Schedule
+		problem  string
+	}{
+		{&shuttletracker.Schedule{RouteID: 1, Trips: []*shuttletracker.Trip{{StopTimes: stopTimes(2, 3, 2)}}}, ""},
+		{&shuttletracker.Schedule{RouteID: 5}, "route 5 does not exist"},
+		{&shuttletracker.Schedule{RouteID: 1, Days: []time.Weekday{1, 1}}, "Monday is listed more than once"},
+		{&shuttletracker.Schedule{RouteID: 1, Trips: []*shuttletracker.Trip{{StopTimes: stopTimes(2, 4)}}}, "stop 4 is not on route 1"},
+		{&shuttletracker.Schedule{RouteID: 1, Trips: []*shuttletracker.Trip{{StopTimes: stopTimes(2)}}}, "must stop at least twice"},
+	} {
+		err := validateSchedule(ms, c.schedule)
+		if c.problem == "" && err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if c.problem != "" && (err == nil || !strings.Contains(err.Error(), c.problem)) {
+			t.Errorf("got %v, expected %q", err, c.problem)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// ShiftsHandler lists the Shifts that were ongoing during the request's time
+// range, optionally for one Vehicle, like the exports.
+func (api *API) ShiftsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shifts, err := api.ms.Shifts(filter)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get shifts")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, shifts)
+}
+
+// ShiftsCreateHandler creates a Shift from the JSON in the request body.
+func (api *API) ShiftsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	shift := &shuttletracker.Shift{}
+	if err := json.NewDecoder(r.Body).Decode(shift); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateShift(api.ms, shift); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ms.CreateShift(shift); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create shift")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, shift)
+}
+
+// ShiftsEditHandler replaces a Shift with the JSON in the request body, e.g.
+// to end it.
+func (api *API) ShiftsEditHandler(w http.ResponseWriter, r *http.Request) {
+	shift := &shuttletracker.Shift{}
+	if err := json.NewDecoder(r.Body).Decode(shift); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateShift(api.ms, shift); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifyShift(shift)
+	if err == shuttletracker.ErrShiftNotFound {
+		http.Error(w, "Shift not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify shift")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, shift)
+}
+
+// ShiftsDeleteHandler deletes the Shift with the id in the query string.
+func (api *API) ShiftsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.DeleteShift(id)
+	if err == shuttletracker.ErrShiftNotFound {
+		http.Error(w, "Shift not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete shift")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ShiftLocationsHandler streams the Locations of a Shift's Vehicle during the
+// Shift as NDJSON.
+func (api *API) ShiftLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shift, err := api.ms.Shift(id)
+	if err == shuttletracker.ErrShiftNotFound {
+		http.Error(w, "Shift not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get shift")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filter := shuttletracker.HistoryFilter{
+		Since:     shift.Start,
+		Until:     time.Now(),
+		VehicleID: &shift.VehicleID,
+	}
+	if shift.End != nil {
+		filter.Until = *shift.End
+	}
+	streamNDJSON(w, r, "shift locations", func(write func(interface{}) error) error {
+		return api.ms.ExportLocations(filter, func(l *shuttletracker.Location) error {
+			return write(l)
+		})
+	})
+}
+
+// validateShift checks that a Shift has an operator and a Vehicle that
+// exists, that it ends after it starts, and that neither its Vehicle nor its
+// operator is assigned to another Shift at the same time.
+func validateShift(ms shuttletracker.ModelService, shift *shuttletracker.Shift) error {
+	shift.Operator = strings.TrimSpace(shift.Operator)
+	if shift.Operator == "" {
+		return fmt.Errorf("operator is required")
+	}
+	if shift.Start.IsZero() {
+		return fmt.Errorf("start is required")
+	}
+	if shift.End != nil && !shift.End.After(shift.Start) {
+		return fmt.Errorf("end %s is not after start %s", shift.End.Format(time.RFC3339), shift.Start.Format(time.RFC3339))
+	}
+	_, err := ms.Vehicle(shift.VehicleID)
+	if err == shuttletracker.ErrVehicleNotFound {
+		return fmt.Errorf("vehicle %d does not exist", shift.VehicleID)
+	} else if err != nil {
+		return err
+	}
+
+	// Shifts without an end go on indefinitely.
+	until := shift.Start.AddDate(100, 0, 0)
+	if shift.End != nil {
+		until = *shift.End
+	}
+	others, err := ms.Shifts(shuttletracker.HistoryFilter{Since: shift.Start, Until: until})
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		// Shifts can start as soon as the previous one ends.
+		if other.ID == shift.ID || !other.Overlaps(shift.Start, until) {
+			continue
+		}
+		if other.VehicleID == shift.VehicleID {
+			return fmt.Errorf("vehicle %d is assigned to %s during shift %d", shift.VehicleID, other.Operator, other.ID)
+		}
+		if strings.EqualFold(other.Operator, shift.Operator) {
+			return fmt.Errorf("%s is assigned to vehicle %d during shift %d", shift.Operator, other.VehicleID, other.ID)
+		}
+	}
+	return nil
+}
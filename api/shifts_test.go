@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestValidateShift(t *testing.T) {
+	start := time.Date(2019, time.March, 4, 8, 0, 0, 0, time.UTC)
+	at := func(hours int) *time.Time {
+		t := start.Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicle", int64(3)).Return(&shuttletracker.Vehicle{ID: 3}, nil)
+	ms.VehicleService.On("Vehicle", int64(4)).Return(&shuttletracker.Vehicle{ID: 4}, nil)
+	ms.VehicleService.On("Vehicle", int64(5)).Return((*shuttletracker.Vehicle)(nil), shuttletracker.ErrVehicleNotFound)
+	ms.ShiftService.On("Shifts", tmock.Anything).Return([]*shuttletracker.Shift{
+		{ID: 1, Operator: "Alex", VehicleID: 3, Start: start, End: at(4)},
+		{ID: 2, Operator: "Sam", VehicleID: 4, Start: *at(2)},
+	}, nil)
+
+	tests := []struct {
+		shift shuttletracker.Shift
+		err   string
+	}{
+		{shuttletracker.Shift{Operator: "Jordan", VehicleID: 3, Start: *at(4), End: at(8)}, ""},
+		{shuttletracker.Shift{ID: 1, Operator: "Alex", VehicleID: 3, Start: start, End: at(5)}, ""},
+		{shuttletracker.Shift{Operator: " ", VehicleID: 3, Start: start}, "operator is required"},
+		{shuttletracker.Shift{Operator: "Jordan", VehicleID: 3}, "start is required"},
+		{shuttletracker.Shift{Operator: "Jordan", VehicleID: 3, Start: start, End: &start}, "is not after start"},
+		{shuttletracker.Shift{Operator: "Jordan", VehicleID: 5, Start: start}, "vehicle 5 does not exist"},
+		{shuttletracker.Shift{Operator: "Jordan", VehicleID: 3, Start: *at(3), End: at(5)}, "vehicle 3 is assigned to Alex during shift 1"},
+		{shuttletracker.Shift{Operator: "Jordan", VehicleID: 4, Start: *at(10)}, "vehicle 4 is assigned to Sam during shift 2"},
+		{shuttletracker.Shift{Operator: "alex", VehicleID: 4, Start: *at(1), End: at(2)}, "alex is assigned to vehicle 3 during shift 1"},
+	}
+	for _, test := range tests {
+		err := validateShift(ms, &test.shift)
+		if test.err == "" && err != nil {
+			t.Errorf("%+v: unexpected error: %s", test.shift, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%+v: got error %v, expected %q", test.shift, err, test.err)
+		}
+	}
+}
+
+func TestShiftsDeleteHandlerNotFound(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.ShiftService.On("DeleteShift", int64(7)).Return(shuttletracker.ErrShiftNotFound)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	api.ShiftsDeleteHandler(w, httptest.NewRequest("DELETE", "/shifts/?id=7", nil))
+	if w.Code != 404 {
+		t.Errorf("got status code %d, expected 404", w.Code)
+	}
+}
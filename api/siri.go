@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+const siriVersion = "2.0"
+
+// The SIRI types below cover the subset of SIRI-VM (Vehicle Monitoring) that
+// we produce. See http://www.siri.org.uk/ for the full schema.
+
+type siri struct {
+	XMLName         xml.Name            `xml:"http://www.siri.org.uk/siri Siri"`
+	Version         string              `xml:"version,attr"`
+	ServiceDelivery siriServiceDelivery `xml:"ServiceDelivery"`
+}
+
+type siriServiceDelivery struct {
+	ResponseTimestamp         time.Time                     `xml:"ResponseTimestamp"`
+	ProducerRef               string                        `xml:"ProducerRef,omitempty"`
+	VehicleMonitoringDelivery siriVehicleMonitoringDelivery `xml:"VehicleMonitoringDelivery"`
+}
+
+type siriVehicleMonitoringDelivery struct {
+	Version           string                `xml:"version,attr"`
+	ResponseTimestamp time.Time             `xml:"ResponseTimestamp"`
+	VehicleActivity   []siriVehicleActivity `xml:"VehicleActivity"`
+}
+
+type siriVehicleActivity struct {
+	RecordedAtTime          time.Time                   `xml:"RecordedAtTime"`
+	ValidUntilTime          time.Time                   `xml:"ValidUntilTime"`
+	MonitoredVehicleJourney siriMonitoredVehicleJourney `xml:"MonitoredVehicleJourney"`
+}
+
+type siriMonitoredVehicleJourney struct {
+	LineRef           string              `xml:"LineRef,omitempty"`
+	PublishedLineName string              `xml:"PublishedLineName,omitempty"`
+	OperatorRef       string              `xml:"OperatorRef,omitempty"`
+	Monitored         bool                `xml:"Monitored"`
+	VehicleLocation   siriVehicleLocation `xml:"VehicleLocation"`
+	Bearing           float64             `xml:"Bearing"`
+	VehicleRef        string              `xml:"VehicleRef"`
+}
+
+type siriVehicleLocation struct {
+	Longitude float64 `xml:"Longitude"`
+	Latitude  float64 `xml:"Latitude"`
+}
+
+// siriLineRef maps one of our route IDs to the LineRef our consumers expect.
+// Unmapped IDs are used as-is.
+func (api *API) siriLineRef(id int64) string {
+	s := strconv.FormatInt(id, 10)
+	if mapped, ok := api.cfg.SIRILineRefs[s]; ok {
+		return mapped
+	}
+	return s
+}
+
+// SIRIVehicleMonitoringHandler serves a SIRI-VM delivery containing the latest
+// location of each enabled vehicle.
+func (api *API) SIRIVehicleMonitoringHandler(w http.ResponseWriter, r *http.Request) {
+	vehicles, err := api.ms.EnabledVehiclesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get enabled vehicles")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	locations, err := api.ms.LatestLocationsContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get latest locations")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	routes, err := api.ms.RoutesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	enabled := map[int64]*shuttletracker.Vehicle{}
+	for _, vehicle := range vehicles {
+		enabled[vehicle.ID] = vehicle
+	}
+	routeNames := map[int64]string{}
+	for _, route := range routes {
+		routeNames[route.ID] = route.Name
+	}
+
+	now := time.Now()
+	delivery := siriVehicleMonitoringDelivery{
+		Version:           siriVersion,
+		ResponseTimestamp: now,
+	}
+	for _, loc := range locations {
+		if loc.VehicleID == nil || isOffline(loc, now, api.offlineAfter) || api.visibility.hidden(loc.RouteID, now) {
+			continue
+		}
+		vehicle, ok := enabled[*loc.VehicleID]
+		if !ok {
+			continue
+		}
+
+		journey := siriMonitoredVehicleJourney{
+			OperatorRef: api.cfg.SIRIOperatorRef,
+			Monitored:   true,
+			VehicleLocation: siriVehicleLocation{
+				Longitude: loc.Longitude,
+				Latitude:  loc.Latitude,
+			},
+			Bearing:    loc.Heading,
+			VehicleRef: strconv.FormatInt(vehicle.ID, 10),
+		}
+		if loc.RouteID != nil {
+			journey.LineRef = api.siriLineRef(*loc.RouteID)
+			journey.PublishedLineName = routeNames[*loc.RouteID]
+		}
+		delivery.VehicleActivity = append(delivery.VehicleActivity, siriVehicleActivity{
+			RecordedAtTime:          loc.Time,
+			ValidUntilTime:          loc.Time.Add(api.offlineAfter),
+			MonitoredVehicleJourney: journey,
+		})
+	}
+
+	s := siri{
+		Version: siriVersion,
+		ServiceDelivery: siriServiceDelivery{
+			ResponseTimestamp:         now,
+			ProducerRef:               api.cfg.SIRIOperatorRef,
+			VehicleMonitoringDelivery: delivery,
+		},
+	}
+	b, err := xml.MarshalIndent(s, "", " ")
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to marshal SIRI")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
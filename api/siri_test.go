@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestSIRIVehicleMonitoringHandler(t *testing.T) {
+	vehicleID := int64(1)
+	disabledID := int64(2)
+	routeID := int64(3)
+	now := time.Now()
+
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{{ID: vehicleID}}, nil)
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{
+		{VehicleID: &vehicleID, RouteID: &routeID, Latitude: 42.73, Longitude: -73.68, Heading: 90, Time: now},
+		{VehicleID: &disabledID, Time: now},
+	}, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: routeID, Name: "West"}}, nil)
+
+	api := API{
+		cfg: Config{
+			SIRIOperatorRef: "RPI",
+			SIRILineRefs:    map[string]string{"3": "WEST"},
+		},
+		offlineAfter: 5 * time.Minute,
+		ms:           ms,
+	}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/siri/vehicle-monitoring", nil)
+	if err != nil {
+		t.Fatalf("unable to create HTTP request: %s", err)
+	}
+	api.SIRIVehicleMonitoringHandler(w, req)
+	resp := w.Result()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("got status code %d, expected 200", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Type") != "application/xml" {
+		t.Errorf("got Content-Type \"%s\", expected \"application/xml\"", resp.Header.Get("Content-Type"))
+	}
+
+	var s siri
+	err = xml.NewDecoder(resp.Body).Decode(&s)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activities := s.ServiceDelivery.VehicleMonitoringDelivery.VehicleActivity
+	if len(activities) != 1 {
+		t.Fatalf("got %d vehicle activities, expected 1", len(activities))
+	}
+	journey := activities[0].MonitoredVehicleJourney
+	if journey.VehicleRef != "1" {
+		t.Errorf("got VehicleRef %s, expected 1", journey.VehicleRef)
+	}
+	if journey.LineRef != "WEST" {
+		t.Errorf("got LineRef %s, expected WEST", journey.LineRef)
+	}
+	if journey.OperatorRef != "RPI" {
+		t.Errorf("got OperatorRef %s, expected RPI", journey.OperatorRef)
+	}
+	if journey.VehicleLocation.Latitude != 42.73 || journey.VehicleLocation.Longitude != -73.68 {
+		t.Errorf("got location %+v, expected 42.73, -73.68", journey.VehicleLocation)
+	}
+}
+
+func TestSIRIVehicleMonitoringHidesRoutes(t *testing.T) {
+	now := time.Now()
+	vehicleID, routeID := int64(1), int64(2)
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{{ID: vehicleID}}, nil)
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{
+		{VehicleID: &vehicleID, RouteID: &routeID, Time: now},
+	}, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{hiddenRoute(routeID, now)}, nil)
+	api := API{offlineAfter: 5 * time.Minute, ms: ms, visibility: newRouteVisibility(ms)}
+
+	w := httptest.NewRecorder()
+	api.SIRIVehicleMonitoringHandler(w, httptest.NewRequest("GET", "/siri/vehicle-monitoring", nil))
+	var s siri
+	if err := xml.NewDecoder(w.Body).Decode(&s); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if activities := s.ServiceDelivery.VehicleMonitoringDelivery.VehicleActivity; len(activities) != 0 {
+		t.Errorf("got %d vehicle activities on a hidden route, expected none", len(activities))
+	}
+}
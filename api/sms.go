@@ -0,0 +1,204 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// smsDepartures is how many departures an SMS reply lists, so that it fits
+// in one or two messages.
+const smsDepartures = 3
+
+// smsHelp is the reply to texts that aren't a Stop.
+const smsHelp = "Text a stop's number, like 12, or part of its name to get its next shuttles."
+
+// twiml is a Twilio response that replies to an incoming text.
+type twiml struct {
+	XMLName xml.Name `xml:"Response"`
+	Message string   `xml:"Message"`
+}
+
+// SMSHandler answers texts forwarded by Twilio's incoming message webhook.
+// Texting a Stop's ID or part of its name replies with its next departures.
+// If TwilioAuthToken is set, requests must be signed with it.
+func (api *API) SMSHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if api.cfg.TwilioAuthToken != "" {
+		u := api.publicURL() + r.URL.RequestURI()
+		if !validTwilioSignature(api.cfg.TwilioAuthToken, u, r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+			http.Error(w, "invalid Twilio signature", http.StatusForbidden)
+			return
+		}
+	}
+
+	reply, err := api.smsReply(r.PostForm.Get("Body"), time.Now())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to reply to SMS")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := xml.Marshal(twiml{Message: reply})
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to marshal TwiML")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
+
+// validTwilioSignature returns whether signature is Twilio's signature of a
+// request to u with form parameters.
+func validTwilioSignature(authToken, u string, form url.Values, signature string) bool {
+	return hmac.Equal([]byte(twilioSignature(authToken, u, form)), []byte(signature))
+}
+
+// twilioSignature signs a request to u with form parameters like Twilio does:
+// the base64 HMAC-SHA1 of the URL followed by each parameter's name and
+// value, sorted by name.
+func twilioSignature(authToken, u string, form url.Values) string {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(u))
+	for _, name := range names {
+		for _, value := range form[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// smsReply returns the reply to a text asking about a Stop.
+func (api *API) smsReply(body string, now time.Time) (string, error) {
+	stops, err := api.ms.Stops()
+	if err != nil {
+		return "", err
+	}
+	matches := matchStops(body, stops)
+	switch {
+	case strings.TrimSpace(body) == "":
+		return smsHelp, nil
+	case len(matches) == 0:
+		return fmt.Sprintf("No stop matches %q. %s", strings.TrimSpace(body), smsHelp), nil
+	case len(matches) > 1:
+		choices := []string{}
+		for _, stop := range matches {
+			choices = append(choices, fmt.Sprintf("%d %s", stop.ID, stopName(stop)))
+		}
+		if len(choices) > 5 {
+			choices = append(choices[:5], "...")
+		}
+		return "Which stop? Text its number: " + strings.Join(choices, ", "), nil
+	}
+
+	stop := matches[0]
+	departures, err := api.nextDepartures(stop.ID, now, smsDepartures)
+	if err != nil {
+		return "", err
+	}
+	if len(departures.Departures) == 0 {
+		return stopName(stop) + ": no shuttles in the next 24 hours.", nil
+	}
+	routes, err := api.ms.Routes()
+	if err != nil {
+		return "", err
+	}
+	routeNames := map[int64]string{}
+	for _, route := range routes {
+		routeNames[route.ID] = route.Name
+	}
+
+	parts := []string{}
+	for _, d := range departures.Departures {
+		part := routeNames[d.RouteID] + " " + smsTime(d.Time, now)
+		if d.Type == departureScheduled && departures.Realtime {
+			part += " (scheduled)"
+		}
+		parts = append(parts, strings.TrimSpace(part))
+	}
+	reply := stopName(stop) + ": " + strings.Join(parts, ", ")
+	if !departures.Realtime {
+		reply += ". Live tracking is down, so these are scheduled times."
+	}
+	return reply, nil
+}
+
+// matchStops returns the Stops that a text refers to: the one with its ID,
+// like "12" or "#12", the one with its exact name, or otherwise those whose
+// names contain it, ignoring case.
+func matchStops(body string, stops []*shuttletracker.Stop) []*shuttletracker.Stop {
+	query := strings.ToLower(strings.TrimSpace(body))
+	query = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(query, "stop"), "#"))
+	if query == "" {
+		return nil
+	}
+	if id, err := strconv.ParseInt(query, 10, 64); err == nil {
+		for _, stop := range stops {
+			if stop.ID == id {
+				return []*shuttletracker.Stop{stop}
+			}
+		}
+		return nil
+	}
+
+	matches := []*shuttletracker.Stop{}
+	for _, stop := range stops {
+		if stop.Name == nil {
+			continue
+		}
+		name := strings.ToLower(*stop.Name)
+		if name == query {
+			return []*shuttletracker.Stop{stop}
+		}
+		if strings.Contains(name, query) {
+			matches = append(matches, stop)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ID < matches[j].ID
+	})
+	return matches
+}
+
+// stopName returns a Stop's name, or its ID if it doesn't have one.
+func stopName(stop *shuttletracker.Stop) string {
+	if stop.Name != nil && *stop.Name != "" {
+		return *stop.Name
+	}
+	return "Stop " + strconv.FormatInt(stop.ID, 10)
+}
+
+// smsTime describes when a departure is: how many minutes away it is if it's
+// within the hour, or the time otherwise.
+func smsTime(t, now time.Time) string {
+	minutes := math.Ceil(t.Sub(now).Minutes())
+	switch {
+	case minutes < 1:
+		return "now"
+	case minutes < 60:
+		return fmt.Sprintf("%.0f min", minutes)
+	default:
+		return t.In(now.Location()).Format("3:04 PM")
+	}
+}
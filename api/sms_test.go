@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestValidTwilioSignature(t *testing.T) {
+	// from Twilio's documentation
+	form := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	u := "https://mycompany.com/myapp.php?foo=1&bar=2"
+	if !validTwilioSignature("12345", u, form, "0/KCTR6DLpKmkAf8muzZqo1nDgQ=") {
+		t.Error("valid signature was rejected")
+	}
+	form.Set("Digits", "5678")
+	if validTwilioSignature("12345", u, form, "0/KCTR6DLpKmkAf8muzZqo1nDgQ=") {
+		t.Error("signature of different parameters was accepted")
+	}
+}
+
+func TestSMSHandler(t *testing.T) {
+	defer health.Report(health.Updater, nil)
+
+	name := func(s string) *string {
+		return &s
+	}
+	now := time.Now()
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{
+		{ID: 1, Name: name("Student Union")},
+		{ID: 2, Name: name("Union Station")},
+		{ID: 3, Name: name("Blitman")},
+		{ID: 4},
+	}, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+		{ID: 1, Name: "West", Enabled: true},
+		{ID: 2, Name: "East", Enabled: true},
+	}, nil)
+	in := func(minutes int) shuttletracker.TimeOfDay {
+		t := now.Add(time.Duration(minutes) * time.Minute)
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		return shuttletracker.TimeOfDay(t.Sub(midnight).Truncate(time.Second))
+	}
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{
+		{ID: 1, RouteID: 1, Days: []time.Weekday{0, 1, 2, 3, 4, 5, 6}, Trips: []*shuttletracker.Trip{
+			{ID: 1, StopTimes: []shuttletracker.StopTime{
+				{StopID: 3, Arrival: in(40), Departure: in(40)},
+				{StopID: 1, Arrival: in(45), Departure: in(45)},
+			}},
+		}},
+	}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		1: {VehicleID: 1, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(3 * time.Minute)},
+			{StopID: 3, ETA: now.Add(9 * time.Minute)},
+		}},
+		2: {VehicleID: 2, RouteID: 2, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(12 * time.Minute)},
+		}},
+	})
+	api := API{ms: ms, etaManager: em, cfg: Config{PublicURL: "https://shuttles.rpi.edu", TwilioAuthToken: "secret"}}
+
+	text := func(body string, sign bool) (int, string) {
+		form := url.Values{"From": {"+15185550100"}, "Body": {body}}
+		req := httptest.NewRequest("POST", "/sms", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if sign {
+			req.Header.Set("X-Twilio-Signature", twilioSignature("secret", "https://shuttles.rpi.edu/sms", form))
+		}
+		w := httptest.NewRecorder()
+		api.SMSHandler(w, req)
+		if w.Code != 200 {
+			return w.Code, ""
+		}
+		response := twiml{}
+		if err := xml.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("unable to decode TwiML: %s", err)
+		}
+		return w.Code, response.Message
+	}
+
+	if code, _ := text("1", false); code != 403 {
+		t.Errorf("got status code %d for unsigned text", code)
+	}
+
+	for body, expected := range map[string]string{
+		"1":             "Student Union: West 3 min, East 12 min",
+		" #3 ":          "Blitman: West 9 min, West 40 min (scheduled)",
+		"student union": "Student Union: West 3 min, East 12 min",
+		"blit":          "Blitman: West 9 min, West 40 min (scheduled)",
+		"4":             "Stop 4: no shuttles in the next 24 hours.",
+		"union":         "Which stop? Text its number: 1 Student Union, 2 Union Station",
+		"library":       `No stop matches "library". ` + smsHelp,
+		"":              smsHelp,
+	} {
+		code, reply := text(body, true)
+		if code != 200 {
+			t.Errorf("got status code %d for %q", code, body)
+		} else if reply != expected {
+			t.Errorf("got %q for %q, expected %q", reply, body, expected)
+		}
+	}
+
+	health.Report(health.Updater, errors.New("data feed status code 502"))
+	if _, reply := text("3", true); reply != "Blitman: West 40 min. Live tracking is down, so these are scheduled times." {
+		t.Errorf("got %q while ETAs are stale", reply)
+	}
+}
+
+func TestSMSTime(t *testing.T) {
+	now := time.Date(2019, 3, 4, 14, 0, 0, 0, time.Local)
+	for d, expected := range map[time.Duration]string{
+		-time.Minute:                 "now",
+		30 * time.Second:             "1 min",
+		59 * time.Minute:             "59 min",
+		90 * time.Minute:             "3:30 PM",
+		10*time.Hour + 5*time.Minute: "12:05 AM",
+	} {
+		if got := smsTime(now.Add(d), now); got != expected {
+			t.Errorf("got %q for %s, expected %q", got, d, expected)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// statusIncidentChannel tells every instance about Alerts, since only the
+// leader receives them from the alert manager.
+const statusIncidentChannel = "api.status_incident"
+
+// Overall statuses reported by /status.
+const (
+	statusOperational = "operational"
+	statusDegraded    = "degraded"
+	statusOutage      = "outage"
+)
+
+// statusDescriptions describe each overall status to riders.
+var statusDescriptions = map[string]string{
+	statusOperational: "Shuttles are being tracked normally.",
+	statusDegraded:    "Some shuttles may not be shown or may have inaccurate ETAs.",
+	statusOutage:      "Shuttles are not being tracked right now.",
+}
+
+// Status summarizes the health of the service for a public status page. It
+// deliberately leaves out anything an administrator would need to debug.
+type Status struct {
+	Status            string                `json:"status"`
+	Description       string                `json:"description"`
+	FeedUpdated       *time.Time            `json:"feed_updated"`
+	VehiclesReporting int                   `json:"vehicles_reporting"`
+	RoutesActive      int                   `json:"routes_active"`
+	LastIncident      *shuttletracker.Alert `json:"last_incident"`
+	IncidentResolved  bool                  `json:"incident_resolved"`
+	Generated         time.Time             `json:"generated"`
+}
+
+// statusTracker remembers the most recent incident and which problems are
+// still ongoing, along with the Alert that reported each one.
+type statusTracker struct {
+	bs shuttletracker.BroadcastService
+
+	lock         sync.Mutex
+	lastIncident *shuttletracker.Alert
+	open         map[string]*shuttletracker.Alert
+}
+
+func newStatusTracker(as shuttletracker.AlertService, bs shuttletracker.BroadcastService) *statusTracker {
+	st := &statusTracker{
+		bs:   bs,
+		open: map[string]*shuttletracker.Alert{},
+	}
+	go st.listen(bs.SubscribeBroadcasts(statusIncidentChannel))
+	as.Subscribe(st.handleAlert)
+	return st
+}
+
+// handleAlert is called by the alert manager, so it must not block.
+func (st *statusTracker) handleAlert(alert *shuttletracker.Alert) {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		log.WithError(err).Error("unable to marshal alert")
+		return
+	}
+	go func() {
+		if err := st.bs.Broadcast(statusIncidentChannel, string(b)); err != nil {
+			log.WithError(err).Error("unable to broadcast alert")
+		}
+	}()
+}
+
+func (st *statusTracker) listen(ch chan string) {
+	for payload := range ch {
+		alert := &shuttletracker.Alert{}
+		if err := json.Unmarshal([]byte(payload), alert); err != nil {
+			log.WithError(err).Error("unable to unmarshal alert")
+			continue
+		}
+		st.record(alert)
+	}
+}
+
+// record updates the last incident and ongoing problems. Alerts that report a
+// problem going away resolve the matching incident instead of replacing it.
+func (st *statusTracker) record(alert *shuttletracker.Alert) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if t := resolves(alert.Type); t != "" {
+		delete(st.open, incidentKey(t, alert))
+		return
+	}
+	st.open[incidentKey(alert.Type, alert)] = alert
+	st.lastIncident = alert
+}
+
+// resolves returns the type of Alert that an Alert of type t resolves, if any.
+func resolves(t string) string {
+	switch t {
+	case shuttletracker.AlertFeedRecovered:
+		return shuttletracker.AlertFeedDown
+	case shuttletracker.AlertVehicleReporting:
+		return shuttletracker.AlertVehicleSilent
+	case shuttletracker.AlertGeofenceReentered:
+		return shuttletracker.AlertGeofenceViolation
+	case shuttletracker.AlertVehicleUnstuck:
+		return shuttletracker.AlertVehicleStuck
+	case shuttletracker.AlertServiceRestored:
+		return shuttletracker.AlertServiceGap
+	}
+	return ""
+}
+
+// incidentKey identifies the problem that an Alert of type t reports by the
+// vehicle or route that alert is about.
+func incidentKey(t string, alert *shuttletracker.Alert) string {
+	switch {
+	case alert.VehicleID != nil:
+		return t + "." + strconv.FormatInt(*alert.VehicleID, 10)
+	case alert.RouteID != nil:
+		return t + ".route." + strconv.FormatInt(*alert.RouteID, 10)
+	}
+	return t
+}
+
+// incident returns the last incident, whether it has been resolved, and
+// whether any problems are ongoing.
+func (st *statusTracker) incident() (*shuttletracker.Alert, bool, bool) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if st.lastIncident == nil {
+		return nil, true, len(st.open) > 0
+	}
+	key := incidentKey(st.lastIncident.Type, st.lastIncident)
+	return st.lastIncident, st.open[key] == nil, len(st.open) > 0
+}
+
+// ongoing returns the Alerts of type t that haven't been resolved, ordered by
+// vehicle.
+func (st *statusTracker) ongoing(t string) []*shuttletracker.Alert {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	alerts := []*shuttletracker.Alert{}
+	for _, alert := range st.open {
+		if alert.Type == t {
+			alerts = append(alerts, alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].VehicleID == nil || alerts[j].VehicleID == nil {
+			return alerts[j].VehicleID != nil
+		}
+		return *alerts[i].VehicleID < *alerts[j].VehicleID
+	})
+	return alerts
+}
+
+// StatusHandler reports overall health for a public status page. Unlike the
+// other endpoints, it may be requested from any origin.
+func (api *API) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	routes, err := api.ms.RoutesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	locations, err := api.ms.LatestLocationsContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get latest locations")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	status := Status{Generated: now}
+	for _, route := range routes {
+		if route.Enabled && route.Active {
+			status.RoutesActive++
+		}
+	}
+	for _, loc := range locations {
+		if status.FeedUpdated == nil || loc.Created.After(*status.FeedUpdated) {
+			created := loc.Created
+			status.FeedUpdated = &created
+		}
+		if now.Sub(loc.Created) <= api.statusStaleAfter {
+			status.VehiclesReporting++
+		}
+	}
+
+	ongoing := false
+	status.LastIncident, status.IncidentResolved, ongoing = api.status.incident()
+
+	switch {
+	case status.RoutesActive > 0 && status.VehiclesReporting == 0:
+		status.Status = statusOutage
+	case ongoing || !healthy():
+		status.Status = statusDegraded
+	default:
+		status.Status = statusOperational
+	}
+	lang := requestLanguage(r.Context())
+	status.Description = api.i18n.translate(lang, statusDescriptions[status.Status])
+	status.LastIncident = api.i18n.translateAlert(lang, status.LastIncident)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-cache")
+	WriteJSON(w, status)
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestStatusHandler(t *testing.T) {
+	now := time.Now()
+	vehicleID := int64(2)
+	type testCase struct {
+		name      string
+		locations []*shuttletracker.Location
+		alerts    []*shuttletracker.Alert
+		status    string
+		reporting int
+		resolved  bool
+	}
+	cases := []testCase{
+		{
+			name:      "operational",
+			locations: []*shuttletracker.Location{{Created: now.Add(-time.Minute)}, {Created: now.Add(-time.Hour)}},
+			status:    statusOperational,
+			reporting: 1,
+			resolved:  true,
+		},
+		{
+			name:      "outage",
+			locations: []*shuttletracker.Location{{Created: now.Add(-time.Hour)}},
+			status:    statusOutage,
+			resolved:  true,
+		},
+		{
+			name:      "degraded",
+			locations: []*shuttletracker.Location{{Created: now}},
+			alerts:    []*shuttletracker.Alert{{Type: shuttletracker.AlertVehicleSilent, VehicleID: &vehicleID}},
+			status:    statusDegraded,
+			reporting: 1,
+		},
+		{
+			name:      "resolved",
+			locations: []*shuttletracker.Location{{Created: now}},
+			alerts: []*shuttletracker.Alert{
+				{Type: shuttletracker.AlertFeedDown},
+				{Type: shuttletracker.AlertFeedRecovered},
+			},
+			status:    statusOperational,
+			reporting: 1,
+			resolved:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ms := &mock.ModelService{}
+			ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+				{Enabled: true, Active: true},
+				{Enabled: true, Active: false},
+			}, nil)
+			ms.LocationService.On("LatestLocations").Return(c.locations, nil)
+			bs := &mock.BroadcastService{}
+			bs.On("SubscribeBroadcasts", statusIncidentChannel).Return(make(chan string))
+			as := &mock.AlertService{}
+			as.On("Subscribe", tmock.AnythingOfType("func(*shuttletracker.Alert)")).Return()
+
+			api := API{
+				ms:               ms,
+				status:           newStatusTracker(as, bs),
+				statusStaleAfter: 5 * time.Minute,
+			}
+			for _, alert := range c.alerts {
+				api.status.record(alert)
+			}
+
+			w := httptest.NewRecorder()
+			api.StatusHandler(w, httptest.NewRequest("GET", "/status", nil))
+
+			status := Status{}
+			if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+				t.Fatalf("unable to decode status: %s", err)
+			}
+			if status.Status != c.status {
+				t.Errorf("got status %s, expected %s", status.Status, c.status)
+			}
+			if status.Description != statusDescriptions[c.status] {
+				t.Errorf("got description %q for status %s", status.Description, c.status)
+			}
+			if status.RoutesActive != 1 {
+				t.Errorf("got %d routes active, expected 1", status.RoutesActive)
+			}
+			if status.VehiclesReporting != c.reporting {
+				t.Errorf("got %d vehicles reporting, expected %d", status.VehiclesReporting, c.reporting)
+			}
+			if status.IncidentResolved != c.resolved {
+				t.Errorf("got incident resolved %t, expected %t", status.IncidentResolved, c.resolved)
+			}
+			if len(c.alerts) > 0 && status.LastIncident.Type != c.alerts[0].Type {
+				t.Errorf("got last incident %+v", status.LastIncident)
+			}
+			if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+				t.Error("expected /status to allow any origin")
+			}
+		})
+	}
+}
+
+func TestStatusTrackerBroadcastsAlerts(t *testing.T) {
+	ch := make(chan string)
+	bs := &mock.BroadcastService{}
+	bs.On("SubscribeBroadcasts", statusIncidentChannel).Return(ch)
+	bs.On("Broadcast", statusIncidentChannel, tmock.AnythingOfType("string")).Return(nil).Run(func(args tmock.Arguments) {
+		ch <- args.String(1)
+	})
+	as := &mock.AlertService{}
+	var handle func(*shuttletracker.Alert)
+	as.On("Subscribe", tmock.AnythingOfType("func(*shuttletracker.Alert)")).Return().Run(func(args tmock.Arguments) {
+		handle = args.Get(0).(func(*shuttletracker.Alert))
+	})
+
+	st := newStatusTracker(as, bs)
+	handle(&shuttletracker.Alert{Type: shuttletracker.AlertFeedDown, Message: "down"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if alert, _, _ := st.incident(); alert != nil {
+			if alert.Message != "down" {
+				t.Errorf("got alert %+v", alert)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("alert was not recorded")
+}
+
+func TestStuckVehiclesHandler(t *testing.T) {
+	bs := &mock.BroadcastService{}
+	bs.On("SubscribeBroadcasts", statusIncidentChannel).Return(make(chan string))
+	as := &mock.AlertService{}
+	as.On("Subscribe", tmock.AnythingOfType("func(*shuttletracker.Alert)")).Return()
+	api := API{status: newStatusTracker(as, bs)}
+
+	first, second := int64(1), int64(2)
+	api.status.record(&shuttletracker.Alert{Type: shuttletracker.AlertVehicleStuck, VehicleID: &second})
+	api.status.record(&shuttletracker.Alert{Type: shuttletracker.AlertVehicleSilent, VehicleID: &first})
+	api.status.record(&shuttletracker.Alert{Type: shuttletracker.AlertVehicleStuck, VehicleID: &first})
+	api.status.record(&shuttletracker.Alert{Type: shuttletracker.AlertVehicleUnstuck, VehicleID: &first})
+
+	w := httptest.NewRecorder()
+	api.StuckVehiclesHandler(w, httptest.NewRequest("GET", "/vehicles/stuck", nil))
+	alerts := []*shuttletracker.Alert{}
+	if err := json.NewDecoder(w.Body).Decode(&alerts); err != nil {
+		t.Fatalf("unable to decode alerts: %s", err)
+	}
+	if len(alerts) != 1 || *alerts[0].VehicleID != second {
+		t.Errorf("got %+v, expected only vehicle 2 to be stuck", alerts)
+	}
+}
+
+func TestServiceRestoredResolvesRoute(t *testing.T) {
+	bs := &mock.BroadcastService{}
+	bs.On("SubscribeBroadcasts", statusIncidentChannel).Return(make(chan string))
+	as := &mock.AlertService{}
+	as.On("Subscribe", tmock.AnythingOfType("func(*shuttletracker.Alert)")).Return()
+	st := newStatusTracker(as, bs)
+
+	west, east := int64(1), int64(2)
+	st.record(&shuttletracker.Alert{Type: shuttletracker.AlertServiceGap, RouteID: &west})
+	st.record(&shuttletracker.Alert{Type: shuttletracker.AlertServiceGap, RouteID: &east})
+	st.record(&shuttletracker.Alert{Type: shuttletracker.AlertServiceRestored, RouteID: &east})
+	if _, resolved, ongoing := st.incident(); !resolved || !ongoing {
+		t.Errorf("got resolved %t and ongoing %t, expected the east route's gap to be resolved but not the west's", resolved, ongoing)
+	}
+	if gaps := st.ongoing(shuttletracker.AlertServiceGap); len(gaps) != 1 || *gaps[0].RouteID != west {
+		t.Errorf("got %+v, expected the west route's gap", gaps)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// Stops closer together than the radius passed to /stops/duplicates are
+// candidate duplicates whatever they're named.
+const (
+	defaultDuplicateRadius = 25
+	maxDuplicateRadius     = 500
+)
+
+// Stops with similar names are candidate duplicates up to this far apart, in
+// meters, since imports sometimes place the same stop on opposite curbs.
+const similarNameRadius = 200
+
+// minNameSimilarity is how similar two stops' names must be for them to be
+// candidate duplicates when they're outside of the radius.
+const minNameSimilarity = 0.8
+
+// duplicateStops is a pair of Stops that are likely the same stop.
+type duplicateStops struct {
+	Stops          [2]*shuttletracker.Stop `json:"stops"`
+	Distance       float64                 `json:"distance"`
+	NameSimilarity float64                 `json:"name_similarity"`
+}
+
+// stopMerge is the body of a request to merge two Stops.
+type stopMerge struct {
+	KeepID  int64 `json:"keep_id"`
+	MergeID int64 `json:"merge_id"`
+}
+
+// StopDuplicatesHandler lists pairs of Stops that are within "radius" meters
+// (default 25) of each other, or that have similar names and are within 200
+// meters, closest first, so that administrators can find stops that were
+// imported more than once.
+func (api *API) StopDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	radius := float64(defaultDuplicateRadius)
+	if s := r.URL.Query().Get("radius"); s != "" {
+		var err error
+		radius, err = parseFloat(s)
+		if err != nil || radius <= 0 || radius > maxDuplicateRadius {
+			http.Error(w, fmt.Sprintf("radius must be more than 0 and at most %d meters", maxDuplicateRadius), http.StatusBadRequest)
+			return
+		}
+	}
+	stops, err := api.ms.Stops()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stops")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, findDuplicateStops(stops, radius))
+}
+
+// StopsMergeHandler merges the Stop with "merge_id" into the Stop with
+// "keep_id": routes, schedules, and history that referenced it reference the
+// kept Stop instead, and it's deleted.
+func (api *API) StopsMergeHandler(w http.ResponseWriter, r *http.Request) {
+	merge := stopMerge{}
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if merge.KeepID == merge.MergeID {
+		http.Error(w, "keep_id and merge_id must be different stops", http.StatusBadRequest)
+		return
+	}
+	err := api.ms.MergeStops(merge.KeepID, merge.MergeID)
+	if err == shuttletracker.ErrStopNotFound {
+		http.Error(w, "Stop not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to merge stops")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stop, err := api.ms.Stop(merge.KeepID)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stop")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, stop)
+}
+
+// findDuplicateStops returns the pairs of Stops that are within radius meters
+// of each other or that have similar names, closest first.
+func findDuplicateStops(stops []*shuttletracker.Stop, radius float64) []duplicateStops {
+	duplicates := []duplicateStops{}
+	for i, a := range stops {
+		for _, b := range stops[i+1:] {
+			d := shuttletracker.DistanceBetween(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+			if d > radius && d > similarNameRadius {
+				continue
+			}
+			similarity := nameSimilarity(a.Name, b.Name)
+			if d > radius && similarity < minNameSimilarity {
+				continue
+			}
+			duplicates = append(duplicates, duplicateStops{[2]*shuttletracker.Stop{a, b}, d, similarity})
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Distance < duplicates[j].Distance
+	})
+	return duplicates
+}
+
+// nameSimilarity returns how alike two stop names are from 0 to 1, ignoring
+// case, punctuation, and spacing. Stops without names aren't similar to any.
+func nameSimilarity(a, b *string) float64 {
+	if a == nil || b == nil {
+		return 0
+	}
+	x, y := normalizeStopName(*a), normalizeStopName(*b)
+	if len(x) == 0 || len(y) == 0 {
+		return 0
+	}
+	longest := len(x)
+	if len(y) > longest {
+		longest = len(y)
+	}
+	return 1 - float64(levenshtein(x, y))/float64(longest)
+}
+
+func normalizeStopName(name string) []rune {
+	return []rune(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name))
+}
+
+// levenshtein returns the number of single rune insertions, deletions, and
+// substitutions needed to turn a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestStopDuplicatesHandler(t *testing.T) {
+	union := "Student Union"
+	union2 := "Student union."
+	sage := "Sage Ave"
+	colonie := "Colonie Apartments"
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{
+		{ID: 1, Name: &union, Latitude: 42.7300, Longitude: -73.6800},
+		// about 110 meters north, but named the same
+		{ID: 2, Name: &union2, Latitude: 42.7310, Longitude: -73.6800},
+		// about 11 meters from the first
+		{ID: 3, Name: &sage, Latitude: 42.7301, Longitude: -73.6800},
+		{ID: 4, Name: &colonie, Latitude: 42.7400, Longitude: -73.6800},
+	}, nil)
+	api := API{
+		ms: ms,
+	}
+
+	req := httptest.NewRequest("GET", "/stops/duplicates", nil)
+	w := httptest.NewRecorder()
+	api.StopDuplicatesHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+
+	var duplicates []struct {
+		Stops          []shuttletracker.Stop `json:"stops"`
+		Distance       float64               `json:"distance"`
+		NameSimilarity float64               `json:"name_similarity"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&duplicates); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if len(duplicates) != 2 {
+		t.Fatalf("got %d duplicates, expected 2", len(duplicates))
+	}
+	if duplicates[0].Stops[0].ID != 1 || duplicates[0].Stops[1].ID != 3 {
+		t.Errorf("got stops %d and %d, expected 1 and 3", duplicates[0].Stops[0].ID, duplicates[0].Stops[1].ID)
+	}
+	if duplicates[1].Stops[0].ID != 1 || duplicates[1].Stops[1].ID != 2 {
+		t.Errorf("got stops %d and %d, expected 1 and 2", duplicates[1].Stops[0].ID, duplicates[1].Stops[1].ID)
+	}
+	if duplicates[1].NameSimilarity != 1 {
+		t.Errorf("got name similarity %f, expected 1", duplicates[1].NameSimilarity)
+	}
+}
+
+func TestStopDuplicatesHandlerInvalid(t *testing.T) {
+	ms := &mock.ModelService{}
+	api := API{
+		ms: ms,
+	}
+
+	for _, query := range []string{"radius=far", "radius=0", "radius=501", "radius=NaN"} {
+		req := httptest.NewRequest("GET", "/stops/duplicates?"+query, nil)
+		w := httptest.NewRecorder()
+		api.StopDuplicatesHandler(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: got status code %d, expected 400", query, w.Code)
+		}
+	}
+	ms.StopService.AssertNotCalled(t, "Stops")
+}
+
+func TestNameSimilarity(t *testing.T) {
+	a, b, c, d := "Sage", "sage ave.", "Page", "Union"
+	for _, test := range []struct {
+		a, b     *string
+		expected float64
+	}{
+		{&a, &a, 1},
+		{&a, &b, 4.0 / 7},
+		{&a, &c, 0.75},
+		{&a, &d, 0},
+		{&a, nil, 0},
+	} {
+		if similarity := nameSimilarity(test.a, test.b); similarity != test.expected {
+			t.Errorf("got similarity %f, expected %f", similarity, test.expected)
+		}
+	}
+}
+
+func TestStopsMergeHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("MergeStops", int64(1), int64(2)).Return(nil)
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	ms.StopService.On("MergeStops", int64(1), int64(3)).Return(shuttletracker.ErrStopNotFound)
+	api := API{
+		ms: ms,
+	}
+
+	for _, test := range []struct {
+		body string
+		code int
+	}{
+		{`{"keep_id": 1, "merge_id": 2}`, http.StatusOK},
+		{`{"keep_id": 1, "merge_id": 3}`, http.StatusNotFound},
+		{`{"keep_id": 1, "merge_id": 1}`, http.StatusBadRequest},
+		{`{"keep_id": 1`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", "/stops/merge", strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		api.StopsMergeHandler(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: got status code %d, expected %d", test.body, w.Code, test.code)
+		}
+	}
+	ms.StopService.AssertExpectations(t)
+}
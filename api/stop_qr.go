@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/qr"
+)
+
+// publicURL returns PublicURL without a trailing slash. The host that a
+// request was made to isn't used instead, since clients can send any Host
+// header they like.
+func (api *API) publicURL() string {
+	return strings.TrimSuffix(api.cfg.PublicURL, "/")
+}
+
+// stopLink returns the short link to a Stop's live arrivals.
+func (api *API) stopLink(stopID int64) string {
+	return api.publicURL() + "/s/" + strconv.FormatInt(stopID, 10)
+}
+
+// StopQRHandler returns a PNG of a QR code linking to the Stop's live
+// arrivals, for printing on its sign. Each module is "scale" pixels wide
+// (default 10). QR codes aren't available unless PublicURL is set.
+func (api *API) StopQRHandler(w http.ResponseWriter, r *http.Request) {
+	if api.cfg.PublicURL == "" {
+		http.Error(w, "stop QR codes need API.PublicURL to be set", http.StatusNotFound)
+		return
+	}
+	scale := 10
+	if s := r.URL.Query().Get("scale"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 40 {
+			http.Error(w, "scale must be between 1 and 40", http.StatusBadRequest)
+			return
+		}
+		scale = n
+	}
+	id, ok := api.urlStop(w, r)
+	if !ok {
+		return
+	}
+
+	code, err := qr.Encode(api.stopLink(id))
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to encode QR code")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := code.PNG(scale)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to encode QR code")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	_, _ = w.Write(b)
+}
+
+// StopLinkHandler redirects short links from QR codes to the Stop's live
+// arrivals. The redirect is temporary so that printed codes can be pointed
+// somewhere else later.
+func (api *API) StopLinkHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := api.urlStop(w, r)
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, "/etas?stop="+strconv.FormatInt(id, 10), http.StatusFound)
+}
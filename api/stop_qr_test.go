@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+	"github.com/wtg/shuttletracker/qr"
+)
+
+func TestStopQRHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	ms.StopService.On("Stop", int64(2)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	api := API{ms: ms, cfg: Config{PublicURL: "https://shuttles.rpi.edu/"}}
+
+	request := func(target, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		w := httptest.NewRecorder()
+		api.StopQRHandler(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		return w
+	}
+
+	w := request("/stops/1/qr.png?scale=2", "1")
+	if w.Code != 200 {
+		t.Fatalf("got status code %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("got content type %q", ct)
+	}
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("unable to decode PNG: %s", err)
+	}
+	code, err := qr.Encode("https://shuttles.rpi.edu/s/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width := img.Bounds().Dx(); width != (code.Size+2*qr.QuietZone)*2 {
+		t.Errorf("got width %d", width)
+	}
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			r, _, _, _ := img.At((x+qr.QuietZone)*2, (y+qr.QuietZone)*2).RGBA()
+			if (r == 0) != code.Black(x, y) {
+				t.Fatalf("module %d, %d doesn't match the link", x, y)
+			}
+		}
+	}
+
+	if w := request("/stops/2/qr.png", "2"); w.Code != 404 {
+		t.Errorf("got status code %d for missing stop", w.Code)
+	}
+	if w := request("/stops/1/qr.png?scale=0", "1"); w.Code != 400 {
+		t.Errorf("got status code %d for bad scale", w.Code)
+	}
+}
+
+func TestStopLink(t *testing.T) {
+	api := API{cfg: Config{PublicURL: "https://shuttles.rpi.edu/"}}
+	if link := api.stopLink(3); link != "https://shuttles.rpi.edu/s/3" {
+		t.Errorf("got %q", link)
+	}
+}
+
+func TestStopQRHandlerWithoutPublicURL(t *testing.T) {
+	api := API{}
+	req := httptest.NewRequest("GET", "/stops/1/qr.png", nil)
+	req.Host = "evil.example.com"
+	w := httptest.NewRecorder()
+	api.StopQRHandler(w, req)
+	if w.Code != 404 {
+		t.Errorf("got status code %d without a public URL", w.Code)
+	}
+}
+
+func TestStopLinkHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	ms.StopService.On("Stop", int64(2)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	api := API{ms: ms}
+
+	for id, expected := range map[string]int{"1": 302, "2": 404, "x": 400} {
+		req := httptest.NewRequest("GET", "/s/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		w := httptest.NewRecorder()
+		api.StopLinkHandler(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		if w.Code != expected {
+			t.Errorf("got status code %d for %s, expected %d", w.Code, id, expected)
+		}
+		if expected == 302 && w.Header().Get("Location") != "/etas?stop=1" {
+			t.Errorf("got location %q", w.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// maxStyleLabelLength limits labels so that they fit on a map marker.
+const maxStyleLabelLength = 32
+
+// maxRouteWidth is the widest that a route can be drawn, in pixels.
+const maxRouteWidth = 20
+
+var (
+	styleColorRegexp  = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	styleIconRegexp   = regexp.MustCompile(`^[a-z0-9-]{1,64}$`)
+	dashPatternRegexp = regexp.MustCompile(`^[0-9]{1,3}( [0-9]{1,3}){0,7}$`)
+
+	errInvalidColor       = errors.New("color must be a hex color like #ff0000")
+	errLabelTooLong       = errors.New("label is too long")
+	errInvalidIcon        = errors.New("icon must contain only lowercase letters, digits, and dashes")
+	errInvalidWidth       = fmt.Errorf("width must be from 1 to %d", maxRouteWidth)
+	errInvalidDashPattern = errors.New("dash pattern must be up to 8 lengths separated by spaces, like \"10 5\"")
+)
+
+// validateStyle checks the display styling shared by vehicles and routes.
+// Empty values are allowed and mean that the frontend should use its default.
+func validateStyle(color, label, icon string) error {
+	if color != "" && !styleColorRegexp.MatchString(color) {
+		return errInvalidColor
+	}
+	if utf8.RuneCountInString(label) > maxStyleLabelLength {
+		return errLabelTooLong
+	}
+	if icon != "" && !styleIconRegexp.MatchString(icon) {
+		return errInvalidIcon
+	}
+	return nil
+}
+
+// validateRouteStyle checks a Route's styling and how it's drawn. Routes need
+// a color and width so that overlapping Routes can be told apart.
+func validateRouteStyle(route *shuttletracker.Route) error {
+	if err := validateStyle(route.Color, route.Label, route.Icon); err != nil {
+		return err
+	}
+	if route.Color == "" {
+		return errInvalidColor
+	}
+	if route.Width < 1 || route.Width > maxRouteWidth {
+		return errInvalidWidth
+	}
+	if route.DashPattern != "" && !dashPatternRegexp.MatchString(route.DashPattern) {
+		return errInvalidDashPattern
+	}
+	return nil
+}
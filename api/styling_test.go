@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestValidateStyle(t *testing.T) {
+	for _, c := range []struct {
+		color, label, icon string
+		err                error
+	}{
+		{"", "", "", nil},
+		{"#fff", "E", "bus", nil},
+		{"#1F6FEB", "Articulated", "articulated-bus", nil},
+		{"#1f6feb80", "", "", nil},
+		{"red", "", "", errInvalidColor},
+		{"#12345", "", "", errInvalidColor},
+		{"1f6feb", "", "", errInvalidColor},
+		{"", strings.Repeat("x", maxStyleLabelLength), "", nil},
+		{"", strings.Repeat("x", maxStyleLabelLength+1), "", errLabelTooLong},
+		{"", "", "Bus", errInvalidIcon},
+		{"", "", "../bus", errInvalidIcon},
+	} {
+		if err := validateStyle(c.color, c.label, c.icon); err != c.err {
+			t.Errorf("validateStyle(%q, %q, %q) = %v, expected %v", c.color, c.label, c.icon, err, c.err)
+		}
+	}
+}
+
+func TestValidateRouteStyle(t *testing.T) {
+	for _, c := range []struct {
+		route shuttletracker.Route
+		err   error
+	}{
+		{shuttletracker.Route{Color: "#ff0000", Width: 4}, nil},
+		{shuttletracker.Route{Color: "#ff0000", Width: maxRouteWidth, ZIndex: -3, DashPattern: "10 5 2 5"}, nil},
+		{shuttletracker.Route{Width: 4}, errInvalidColor},
+		{shuttletracker.Route{Color: "blue", Width: 4}, errInvalidColor},
+		{shuttletracker.Route{Color: "#ff0000"}, errInvalidWidth},
+		{shuttletracker.Route{Color: "#ff0000", Width: maxRouteWidth + 1}, errInvalidWidth},
+		{shuttletracker.Route{Color: "#ff0000", Width: 4, DashPattern: "10,5"}, errInvalidDashPattern},
+		{shuttletracker.Route{Color: "#ff0000", Width: 4, DashPattern: "10 -5"}, errInvalidDashPattern},
+		{shuttletracker.Route{Color: "#ff0000", Width: 4, DashPattern: "1 2 3 4 5 6 7 8 9"}, errInvalidDashPattern},
+	} {
+		if err := validateRouteStyle(&c.route); err != c.err {
+			t.Errorf("validateRouteStyle(%+v) = %v, expected %v", c.route, err, c.err)
+		}
+	}
+}
+
+func TestVehiclesEditHandlerInvalidStyle(t *testing.T) {
+	ms := &mock.ModelService{}
+	api := API{
+		ms: ms,
+	}
+
+	body := bytes.NewBufferString(`{"id": 4, "color": "blue"}`)
+	req := httptest.NewRequest("POST", "/vehicles/edit", body)
+	w := httptest.NewRecorder()
+	api.VehiclesEditHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+	ms.VehicleService.AssertNotCalled(t, "ModifyVehicle", tmock.Anything)
+}
+
+func TestRoutesEditHandlerStyle(t *testing.T) {
+	ms := &mock.ModelService{}
+	existing := &shuttletracker.Route{ID: 1, Name: "East", Color: "#ffffff", Enabled: true}
+	ms.RouteService.On("Route", int64(1)).Return(existing, nil)
+	ms.RouteService.On("ModifyRoute", tmock.Anything).Return(nil)
+	api := API{
+		ms: ms,
+	}
+
+	body := bytes.NewBufferString(`{"id": 1, "name": "ignored", "enabled": true, "color": "#ff0000", "width": 6,
+		"label": "E", "icon": "bus", "z_index": 2, "dash_pattern": "10 5"}`)
+	req := httptest.NewRequest("POST", "/routes/edit", body)
+	w := httptest.NewRecorder()
+	api.RoutesEditHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	modified := ms.RouteService.Calls[1].Arguments[0].(*shuttletracker.Route)
+	if modified.Name != "East" {
+		t.Errorf("got name %q, expected the name to be unchanged", modified.Name)
+	}
+	if modified.Color != "#ff0000" || modified.Label != "E" || modified.Icon != "bus" {
+		t.Errorf("got unexpected styling %q %q %q", modified.Color, modified.Label, modified.Icon)
+	}
+	if modified.Width != 6 || modified.ZIndex != 2 || modified.DashPattern != "10 5" {
+		t.Errorf("got unexpected rendering %d %d %q", modified.Width, modified.ZIndex, modified.DashPattern)
+	}
+
+	body = bytes.NewBufferString(`{"id": 1, "icon": "Bus Icon"}`)
+	req = httptest.NewRequest("POST", "/routes/edit", body)
+	w = httptest.NewRecorder()
+	api.RoutesEditHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// timetable is the planned Departures from a Stop on a date.
+type timetable struct {
+	StopID     int64                      `json:"stop_id"`
+	Date       string                     `json:"date"`
+	Departures []shuttletracker.Departure `json:"departures"`
+}
+
+// urlStop returns the ID of the Stop in the URL. If it isn't a Stop, it
+// responds with an error and returns false.
+func (api *API) urlStop(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	stop, ok := api.urlStopDetails(w, r)
+	if !ok {
+		return 0, false
+	}
+	return stop.ID, true
+}
+
+// urlStopDetails is like urlStop but returns the whole Stop.
+func (api *API) urlStopDetails(w http.ResponseWriter, r *http.Request) (*shuttletracker.Stop, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	stop, err := api.ms.Stop(id)
+	if err == shuttletracker.ErrStopNotFound {
+		http.Error(w, "Stop not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get stop")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return stop, true
+}
+
+// scheduledDepartures returns the Departures from a Stop between since and
+// until on enabled Routes, according to the service calendar.
+func (api *API) scheduledDepartures(stopID int64, since, until time.Time) ([]shuttletracker.Departure, error) {
+	routes, err := api.ms.Routes()
+	if err != nil {
+		return nil, err
+	}
+	enabled := map[int64]bool{}
+	for _, route := range routes {
+		enabled[route.ID] = route.Enabled
+	}
+	schedules, err := api.ms.Schedules()
+	if err != nil {
+		return nil, err
+	}
+	running := []*shuttletracker.Schedule{}
+	for _, s := range schedules {
+		if enabled[s.RouteID] {
+			running = append(running, s)
+		}
+	}
+	periods, err := api.ms.ServicePeriods()
+	if err != nil {
+		return nil, err
+	}
+	return shuttletracker.Calendar(periods).Departures(running, stopID, since, until), nil
+}
+
+// StopTimetableHandler returns the planned Departures from a Stop on the date
+// in the "date" query parameter, like "2019-03-04", or today by default.
+// Dates are in the server's time zone.
+func (api *API) StopTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if s := r.URL.Query().Get("date"); s != "" {
+		var err error
+		day, err = time.ParseInLocation(shuttletracker.DateFormat, s, time.Local)
+		if err != nil {
+			http.Error(w, "date must be like \"2019-03-04\"", http.StatusBadRequest)
+			return
+		}
+	}
+	id, ok := api.urlStop(w, r)
+	if !ok {
+		return
+	}
+
+	departures, err := api.scheduledDepartures(id, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get departures")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, timetable{
+		StopID:     id,
+		Date:       day.Format(shuttletracker.DateFormat),
+		Departures: departures,
+	})
+}
+
+// nextDeparturesHorizon is how far ahead scheduled departures are looked for,
+// so that the first one tomorrow morning is found late at night.
+const nextDeparturesHorizon = 24 * time.Hour
+
+// realtimeSlack is how much later than a Vehicle's ETA a scheduled departure
+// on the same Route can be and still be assumed to be the Vehicle's Trip.
+// Vehicles are usually running a little early or late.
+const realtimeSlack = 5 * time.Minute
+
+// Kinds of upcoming departures.
+const (
+	departureRealtime  = "realtime"
+	departureScheduled = "scheduled"
+)
+
+// upcomingDeparture is when a shuttle is expected at a Stop, either predicted
+// from a Vehicle's location or planned by a Schedule.
+type upcomingDeparture struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	RouteID int64     `json:"route_id"`
+
+	// VehicleID is set for realtime departures.
+	VehicleID *int64 `json:"vehicle_id,omitempty"`
+
+	// The rest are set for scheduled departures.
+	ScheduleID *int64 `json:"schedule_id,omitempty"`
+	TripID     *int64 `json:"trip_id,omitempty"`
+	Direction  string `json:"direction,omitempty"`
+
+	// Catchable is whether the rider can walk to the Stop in time, if they
+	// sent their location.
+	Catchable *bool `json:"catchable,omitempty"`
+}
+
+// nextDepartures is the upcoming departures from a Stop.
+type nextDepartures struct {
+	StopID int64 `json:"stop_id"`
+
+	// WalkingTime is how long it takes the rider to walk to the Stop, in
+	// seconds, if they sent their location.
+	WalkingTime *float64 `json:"walking_time,omitempty"`
+
+	// Realtime is false when predictions aren't available, e.g. because
+	// the data feed is down, so only scheduled departures are included.
+	Realtime   bool                `json:"realtime"`
+	Departures []upcomingDeparture `json:"departures"`
+}
+
+// NextDeparturesHandler returns the next departures from a Stop, up to
+// "limit" (default 5). Vehicles' ETAs are used where there are any, and
+// Schedules fill in the rest. Scheduled departures on a Route up to shortly
+// after a Vehicle's ETA on the same Route are assumed to be that Vehicle and
+// are left out. If the rider's position is in the "lat" and "lng" query
+// parameters, the response includes how long it takes them to walk to the
+// Stop and whether they can catch each departure.
+func (api *API) NextDeparturesHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 5
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 50 {
+			http.Error(w, "limit must be between 1 and 50", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	latitude, longitude, located, err := parseRiderPosition(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stop, ok := api.urlStopDetails(w, r)
+	if !ok {
+		return
+	}
+	id := stop.ID
+
+	now := time.Now()
+	result, err := api.nextDepartures(id, now, limit)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get departures")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if located {
+		walkingTime := api.walking.walkingTimes(r.Context(), latitude, longitude, []*shuttletracker.Stop{stop})[id]
+		result.WalkingTime = walkingSeconds(walkingTime)
+		for i := range result.Departures {
+			result.Departures[i].Catchable = catchable(now, walkingTime, result.Departures[i].Time)
+		}
+	}
+	WriteJSON(w, result)
+}
+
+// nextDepartures returns the first limit departures from a Stop after now, as
+// described by NextDeparturesHandler. Departures on Routes that are hidden
+// from the public are left out.
+func (api *API) nextDepartures(id int64, now time.Time, limit int) (nextDepartures, error) {
+	result := nextDepartures{StopID: id, Realtime: !etasStale(), Departures: []upcomingDeparture{}}
+	// covered is how late the last realtime departure on each Route is.
+	covered := map[int64]time.Time{}
+	if result.Realtime {
+		for _, vehicleETA := range api.etaManager.CurrentETAs() {
+			vehicleID, routeID := vehicleETA.VehicleID, vehicleETA.RouteID
+			if api.visibility.hidden(&routeID, now) {
+				continue
+			}
+			for _, stopETA := range vehicleETA.StopETAs {
+				if stopETA.StopID != id || stopETA.ETA.Before(now) && !stopETA.Arriving {
+					continue
+				}
+				result.Departures = append(result.Departures, upcomingDeparture{
+					Type:      departureRealtime,
+					Time:      stopETA.ETA,
+					RouteID:   vehicleETA.RouteID,
+					VehicleID: &vehicleID,
+				})
+				if until := stopETA.ETA.Add(realtimeSlack); until.After(covered[vehicleETA.RouteID]) {
+					covered[vehicleETA.RouteID] = until
+				}
+			}
+		}
+	}
+
+	scheduled, err := api.scheduledDepartures(id, now, now.Add(nextDeparturesHorizon))
+	if err != nil {
+		return nextDepartures{}, err
+	}
+	for _, d := range scheduled {
+		d := d
+		if !d.Time.After(covered[d.RouteID]) || api.visibility.hidden(&d.RouteID, now) {
+			continue
+		}
+		result.Departures = append(result.Departures, upcomingDeparture{
+			Type:       departureScheduled,
+			Time:       d.Time,
+			RouteID:    d.RouteID,
+			ScheduleID: &d.ScheduleID,
+			TripID:     &d.TripID,
+			Direction:  d.Direction,
+		})
+	}
+
+	sort.SliceStable(result.Departures, func(i, j int) bool {
+		return result.Departures[i].Time.Before(result.Departures[j].Time)
+	})
+	if len(result.Departures) > limit {
+		result.Departures = result.Departures[:limit]
+	}
+	return result, nil
+}
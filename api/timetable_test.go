@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestStopTimetableHandler(t *testing.T) {
+	at := func(s string) shuttletracker.TimeOfDay {
+		tod, err := shuttletracker.ParseTimeOfDay(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tod
+	}
+	trip := func(id int64, times ...string) *shuttletracker.Trip {
+		trip := &shuttletracker.Trip{ID: id, Direction: "east"}
+		for i, s := range times {
+			trip.StopTimes = append(trip.StopTimes, shuttletracker.StopTime{StopID: int64(i + 1), Arrival: at(s), Departure: at(s)})
+		}
+		return trip
+	}
+
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: 1, Enabled: true}, {ID: 2}}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{
+		{ID: 1, RouteID: 1, Days: []time.Weekday{time.Monday}, Trips: []*shuttletracker.Trip{
+			trip(10, "09:00", "09:10"),
+			trip(11, "08:00", "08:10"),
+			// Departs stop 1 early Tuesday morning.
+			trip(12, "24:30", "24:40"),
+		}},
+		{ID: 2, RouteID: 1, Days: []time.Weekday{time.Sunday}, Trips: []*shuttletracker.Trip{
+			trip(20, "24:15", "24:25"),
+			// A loop that doesn't depart from its last stop.
+			{ID: 21, StopTimes: []shuttletracker.StopTime{
+				{StopID: 1, Arrival: at("23:40"), Departure: at("23:40")},
+				{StopID: 2, Arrival: at("24:00"), Departure: at("24:00")},
+				{StopID: 1, Arrival: at("24:20"), Departure: at("24:20")},
+			}},
+		}},
+		// Route 2 is disabled.
+		{ID: 3, RouteID: 2, Days: []time.Weekday{time.Monday}, Trips: []*shuttletracker.Trip{
+			trip(30, "10:00", "10:10"),
+		}},
+	}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{}, nil)
+	api := API{ms: ms}
+
+	req := httptest.NewRequest("GET", "/stops/1/timetable?date=2019-03-04", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	w := httptest.NewRecorder()
+	api.StopTimetableHandler(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+	if w.Code != 200 {
+		t.Fatalf("got status code %d: %s", w.Code, w.Body)
+	}
+
+	tt := timetable{}
+	if err := json.Unmarshal(w.Body.Bytes(), &tt); err != nil {
+		t.Fatalf("unable to decode timetable: %s", err)
+	}
+	if tt.StopID != 1 || tt.Date != "2019-03-04" {
+		t.Errorf("got stop %d on %s", tt.StopID, tt.Date)
+	}
+	expected := []int64{20, 11, 10}
+	if len(tt.Departures) != len(expected) {
+		t.Fatalf("got departures %+v, expected trips %v", tt.Departures, expected)
+	}
+	for i, id := range expected {
+		if tt.Departures[i].TripID != id {
+			t.Errorf("got departures %+v, expected trips %v", tt.Departures, expected)
+			break
+		}
+	}
+	monday := time.Date(2019, time.March, 4, 0, 15, 0, 0, time.Local)
+	if !tt.Departures[0].Time.Equal(monday) || tt.Departures[0].ScheduleID != 2 || tt.Departures[0].Direction != "east" {
+		t.Errorf("got %+v, expected to depart at %s", tt.Departures[0], monday)
+	}
+}
+
+func TestStopTimetableHandlerBadRequest(t *testing.T) {
+	api := API{ms: &mock.ModelService{}}
+	for _, target := range []string{"/stops/1/timetable?date=March+4", "/stops/x/timetable"} {
+		req := httptest.NewRequest("GET", target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", req.URL.Path[len("/stops/"):len(req.URL.Path)-len("/timetable")])
+		w := httptest.NewRecorder()
+		api.StopTimetableHandler(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		if w.Code != 400 {
+			t.Errorf("%s: got status code %d, expected 400", target, w.Code)
+		}
+	}
+}
+
+func TestNextDeparturesHandler(t *testing.T) {
+	defer health.Report(health.Updater, nil)
+
+	now := time.Now()
+	in := func(minutes int) shuttletracker.TimeOfDay {
+		t := now.Add(time.Duration(minutes) * time.Minute)
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		return shuttletracker.TimeOfDay(t.Sub(midnight).Truncate(time.Second))
+	}
+	trip := func(id int64, minutes int) *shuttletracker.Trip {
+		return &shuttletracker.Trip{ID: id, Direction: "east", StopTimes: []shuttletracker.StopTime{
+			{StopID: 1, Arrival: in(minutes), Departure: in(minutes)},
+			{StopID: 2, Arrival: in(minutes + 10), Departure: in(minutes + 10)},
+		}}
+	}
+	everyDay := []time.Weekday{0, 1, 2, 3, 4, 5, 6}
+
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	// route 3 is only shown for a minute on another day
+	otherDay := (now.Weekday() + 3) % 7
+	hidden := &shuttletracker.Route{ID: 3, Enabled: true, Visibility: shuttletracker.RouteSchedule{{
+		StartDay:  otherDay,
+		StartTime: time.Date(0, 1, 1, 12, 0, 0, 0, time.Local),
+		EndDay:    otherDay,
+		EndTime:   time.Date(0, 1, 1, 12, 1, 0, 0, time.Local),
+	}}}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{ID: 1, Enabled: true}, {ID: 2, Enabled: true}, hidden}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{
+		{ID: 1, RouteID: 1, Days: everyDay, Trips: []*shuttletracker.Trip{trip(10, 4), trip(11, 30)}},
+		{ID: 2, RouteID: 2, Days: everyDay, Trips: []*shuttletracker.Trip{trip(20, 15)}},
+		{ID: 3, RouteID: 3, Days: everyDay, Trips: []*shuttletracker.Trip{trip(30, 2)}},
+	}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		// Running a little late for trip 10.
+		7: {VehicleID: 7, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(6 * time.Minute)},
+			{StopID: 2, ETA: now.Add(16 * time.Minute)},
+		}},
+		// a test vehicle on the hidden route
+		8: {VehicleID: 8, RouteID: 3, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(time.Minute)},
+		}},
+	})
+	api := API{ms: ms, etaManager: em, visibility: newRouteVisibility(ms)}
+
+	get := func() nextDepartures {
+		req := httptest.NewRequest("GET", "/stops/1/next-departures?limit=3", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		w := httptest.NewRecorder()
+		api.NextDeparturesHandler(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		if w.Code != 200 {
+			t.Fatalf("got status code %d: %s", w.Code, w.Body)
+		}
+		result := nextDepartures{}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("unable to decode departures: %s", err)
+		}
+		return result
+	}
+	describe := func(departures []upcomingDeparture) []string {
+		described := []string{}
+		for _, d := range departures {
+			if d.VehicleID != nil {
+				described = append(described, fmt.Sprintf("%s vehicle %d", d.Type, *d.VehicleID))
+			} else {
+				described = append(described, fmt.Sprintf("%s trip %d", d.Type, *d.TripID))
+			}
+		}
+		return described
+	}
+
+	result := get()
+	expected := []string{"realtime vehicle 7", "scheduled trip 20", "scheduled trip 11"}
+	if !result.Realtime || !reflect.DeepEqual(describe(result.Departures), expected) {
+		t.Errorf("got realtime %t and %v, expected %v", result.Realtime, describe(result.Departures), expected)
+	}
+
+	health.Report(health.Updater, errors.New("data feed status code 502"))
+	result = get()
+	expected = []string{"scheduled trip 10", "scheduled trip 20", "scheduled trip 11"}
+	if result.Realtime || !reflect.DeepEqual(describe(result.Departures), expected) {
+		t.Errorf("got realtime %t and %v, expected %v", result.Realtime, describe(result.Departures), expected)
+	}
+}
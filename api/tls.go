@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// configureTLS sets up HTTPS if a certificate or autocert domains are
+// configured, in which case RedirectListenURL also serves redirects from
+// HTTP. It returns a function that serves the API on a listener.
+func (api *API) configureTLS() func(net.Listener) error {
+	server := api.server
+	redirect := redirectToHTTPS(listenAddrs(api.cfg.ListenURL)[0])
+
+	switch {
+	case len(api.cfg.AutocertDomains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(api.cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(api.cfg.AutocertCacheDir),
+			Email:      api.cfg.AutocertEmail,
+		}
+		server.TLSConfig = m.TLSConfig()
+		// Let's Encrypt can also verify domains over the redirect listener.
+		api.serveRedirects(m.HTTPHandler(redirect))
+		log.Infof("Serving HTTPS with certificates for %v.", api.cfg.AutocertDomains)
+		return func(l net.Listener) error {
+			return server.ServeTLS(l, "", "")
+		}
+	case api.cfg.TLSCertFile != "":
+		api.serveRedirects(redirect)
+		log.Info("Serving HTTPS.")
+		return func(l net.Listener) error {
+			return server.ServeTLS(l, api.cfg.TLSCertFile, api.cfg.TLSKeyFile)
+		}
+	default:
+		return server.Serve
+	}
+}
+
+// serveRedirects serves handler on RedirectListenURL, if it's set.
+func (api *API) serveRedirects(handler http.Handler) {
+	if api.redirect == nil {
+		return
+	}
+	api.redirect.Handler = handler
+	go func() {
+		if err := api.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("Unable to serve HTTPS redirects.")
+		}
+	}()
+}
+
+// redirectToHTTPS redirects requests to the same host and path on the HTTPS
+// port in listenURL.
+func redirectToHTTPS(listenURL string) http.Handler {
+	_, port, _ := net.SplitHostPort(listenURL)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
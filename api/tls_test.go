@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, c := range []struct {
+		listenURL string
+		target    string
+		expected  string
+	}{
+		{":443", "http://shuttles.rpi.edu/vehicles?x=1", "https://shuttles.rpi.edu/vehicles?x=1"},
+		{"0.0.0.0:8443", "http://shuttles.rpi.edu:8080/", "https://shuttles.rpi.edu:8443/"},
+	} {
+		w := httptest.NewRecorder()
+		redirectToHTTPS(c.listenURL).ServeHTTP(w, httptest.NewRequest("GET", c.target, nil))
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("got status %d, expected %d", w.Code, http.StatusMovedPermanently)
+		}
+		if location := w.Header().Get("Location"); location != c.expected {
+			t.Errorf("got Location %q, expected %q", location, c.expected)
+		}
+	}
+}
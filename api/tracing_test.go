@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+// tracedModel records the spans that vehicles and their locations are read in.
+type tracedModel struct {
+	*mock.ModelService
+	spans []trace.SpanContext
+}
+
+func (tm *tracedModel) EnabledVehiclesContext(ctx context.Context) ([]*shuttletracker.Vehicle, error) {
+	tm.spans = append(tm.spans, trace.SpanContextFromContext(ctx))
+	return tm.ModelService.EnabledVehiclesContext(ctx)
+}
+
+func (tm *tracedModel) LocationsSinceContext(ctx context.Context, vehicleID int64, since time.Time) ([]*shuttletracker.Location, error) {
+	tm.spans = append(tm.spans, trace.SpanContextFromContext(ctx))
+	return tm.ModelService.LocationsSinceContext(ctx, vehicleID, since)
+}
+
+func TestTraceRequests(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	var handlerSpan trace.SpanContext
+	r := chi.NewRouter()
+	r.Use(traceRequests)
+	r.Get("/teapots/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	req := httptest.NewRequest("GET", "/teapots/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, expected 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /teapots/{id}" {
+		t.Errorf("got span name %q", span.Name())
+	}
+	if span.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected trace to continue from traceparent header, got parent %s", span.Parent().TraceID())
+	}
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Error("expected handler's context to contain request span")
+	}
+	found := false
+	for _, attr := range span.Attributes() {
+		if attr.Key == semconv.HTTPStatusCodeKey && attr.Value.AsInt64() == http.StatusTeapot {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected status code attribute, got %v", span.Attributes())
+	}
+}
+
+func TestUpdatesHandlerQueriesInRequestSpan(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{{ID: 1}}, nil)
+	ms.LocationService.On("LocationsSince", int64(1)).Return([]*shuttletracker.Location{}, nil)
+	tm := &tracedModel{ModelService: ms}
+	api := API{ms: tm}
+
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "GET /updates/")
+	defer span.End()
+	api.UpdatesHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/updates/", nil).WithContext(ctx))
+
+	if len(tm.spans) != 2 {
+		t.Fatalf("got %d queries, expected 2", len(tm.spans))
+	}
+	for _, sc := range tm.spans {
+		if sc.SpanID() != span.SpanContext().SpanID() {
+			t.Errorf("queried in span %s, expected the request's span %s", sc.SpanID(), span.SpanContext().SpanID())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+const geoJSONContentType = "application/geo+json"
+
+// trackFilter limits which Fusion tracks and positions are exported.
+type trackFilter struct {
+	// Positions from Since (inclusive) until Until (exclusive) are kept.
+	// Either can be zero to not limit the range on that side.
+	Since time.Time
+	Until time.Time
+
+	// BBox is the west, south, east, and north edges of the area that
+	// positions must be in, or nil to keep positions anywhere.
+	BBox []float64
+
+	// MinLength is how many meters the positions that are kept from a
+	// track must cover for it to be exported.
+	MinLength float64
+}
+
+// parseTrackFilter reads a trackFilter from the query string. "since" and
+// "until" are RFC 3339 times, "bbox" is "west,south,east,north" in degrees,
+// and "min_length" is in meters. All of them are optional.
+func parseTrackFilter(r *http.Request) (trackFilter, error) {
+	q := r.URL.Query()
+	tf := trackFilter{}
+	var err error
+	if s := q.Get("since"); s != "" {
+		tf.Since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return tf, err
+		}
+	}
+	if s := q.Get("until"); s != "" {
+		tf.Until, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return tf, err
+		}
+	}
+	if !tf.Since.IsZero() && !tf.Until.IsZero() && !tf.Until.After(tf.Since) {
+		return tf, fmt.Errorf("until must be after since")
+	}
+	if s := q.Get("bbox"); s != "" {
+		parts := strings.Split(s, ",")
+		if len(parts) != 4 {
+			return tf, fmt.Errorf("bbox must be west,south,east,north")
+		}
+		tf.BBox = make([]float64, 4)
+		for i, part := range parts {
+			tf.BBox[i], err = parseFloat(strings.TrimSpace(part))
+			if err != nil {
+				return tf, fmt.Errorf("bbox must be west,south,east,north")
+			}
+		}
+		if tf.BBox[0] > tf.BBox[2] || tf.BBox[1] > tf.BBox[3] {
+			return tf, fmt.Errorf("bbox's west and south edges must not be past its east and north edges")
+		}
+	}
+	if s := q.Get("min_length"); s != "" {
+		tf.MinLength, err = parseFloat(s)
+		if err != nil || tf.MinLength < 0 {
+			return tf, fmt.Errorf("min_length must be a number of meters")
+		}
+	}
+	return tf, nil
+}
+
+// matches returns whether a position is inside the time range and area.
+func (tf trackFilter) matches(fp fusionPosition) bool {
+	if !tf.Since.IsZero() && fp.Time.Before(tf.Since) {
+		return false
+	}
+	if !tf.Until.IsZero() && !fp.Time.Before(tf.Until) {
+		return false
+	}
+	if tf.BBox != nil && (fp.Longitude < tf.BBox[0] || fp.Latitude < tf.BBox[1] ||
+		fp.Longitude > tf.BBox[2] || fp.Latitude > tf.BBox[3]) {
+		return false
+	}
+	return true
+}
+
+// apply returns the positions of each track that match the filter, leaving out
+// tracks without any or that are shorter than MinLength.
+func (tf trackFilter) apply(tracks [][]fusionPosition) [][]fusionPosition {
+	filtered := [][]fusionPosition{}
+	for _, track := range tracks {
+		kept := []fusionPosition{}
+		for _, fp := range track {
+			if tf.matches(fp) {
+				kept = append(kept, fp)
+			}
+		}
+		if len(kept) == 0 || trackLength(kept) < tf.MinLength {
+			continue
+		}
+		filtered = append(filtered, kept)
+	}
+	return filtered
+}
+
+// trackLength returns the distance between a track's consecutive positions in meters.
+func trackLength(track []fusionPosition) float64 {
+	length := 0.0
+	for i := 1; i < len(track); i++ {
+		length += shuttletracker.DistanceBetween(track[i-1].Latitude, track[i-1].Longitude, track[i].Latitude, track[i].Longitude)
+	}
+	return length
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// tracksGeoJSON makes each track a LineString feature, or a Point if it only
+// has one position, with its ID, when it started and ended, how many
+// positions it has, and its length in meters.
+func tracksGeoJSON(tracks [][]fusionPosition) geoJSONFeatureCollection {
+	fc := geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]geoJSONFeature, 0, len(tracks)),
+	}
+	for _, track := range tracks {
+		coordinates := make([][2]float64, len(track))
+		for i, fp := range track {
+			coordinates[i] = [2]float64{fp.Longitude, fp.Latitude}
+		}
+		geometry := geoJSONGeometry{Type: "LineString", Coordinates: coordinates}
+		if len(coordinates) == 1 {
+			geometry = geoJSONGeometry{Type: "Point", Coordinates: coordinates[0]}
+		}
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geometry,
+			Properties: map[string]interface{}{
+				"track":     track[0].Track,
+				"start":     track[0].Time,
+				"end":       track[len(track)-1].Time,
+				"positions": len(track),
+				"length":    trackLength(track),
+			},
+		})
+	}
+	return fc
+}
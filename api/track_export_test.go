@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrackFilter(t *testing.T) {
+	for _, c := range []struct {
+		query string
+		err   string
+	}{
+		{"", ""},
+		{"since=2020-01-02T08:00:00Z&until=2020-01-02T12:00:00Z&bbox=-73.7,42.7,-73.6,42.8&min_length=500", ""},
+		{"since=yesterday", "cannot parse"},
+		{"since=2020-01-02T12:00:00Z&until=2020-01-02T08:00:00Z", "until must be after since"},
+		{"bbox=-73.7,42.7,-73.6", "bbox must be"},
+		{"bbox=-73.7,42.7,-73.6,north", "bbox must be"},
+		{"bbox=-73.6,42.7,-73.7,42.8", "edges must not be past"},
+		{"min_length=-1", "min_length must be"},
+		{"min_length=NaN", "min_length must be"},
+		{"bbox=-73.7,NaN,-73.6,42.8", "bbox must be"},
+	} {
+		_, err := parseTrackFilter(httptest.NewRequest("GET", "/fusion/export?"+c.query, nil))
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", c.query, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: got error %v, expected %q", c.query, err, c.err)
+		}
+	}
+}
+
+func TestTrackFilterApply(t *testing.T) {
+	start := time.Date(2020, 1, 2, 8, 0, 0, 0, time.UTC)
+	position := func(track string, minutes int, latitude, longitude float64) fusionPosition {
+		return fusionPosition{Track: track, Time: start.Add(time.Duration(minutes) * time.Minute), Latitude: latitude, Longitude: longitude}
+	}
+	tracks := [][]fusionPosition{
+		// about 1.1 km north, partly before since
+		{position("a", -10, 42.72, -73.68), position("a", 0, 42.73, -73.68), position("a", 5, 42.74, -73.68)},
+		// outside of the bounding box
+		{position("b", 0, 40.71, -74.00), position("b", 5, 40.72, -74.00)},
+		// only one position
+		{position("c", 1, 42.73, -73.67)},
+	}
+	tf := trackFilter{
+		Since: start,
+		Until: start.Add(time.Hour),
+		BBox:  []float64{-73.7, 42.7, -73.6, 42.8},
+	}
+
+	filtered := tf.apply(tracks)
+	if len(filtered) != 2 || len(filtered[0]) != 2 || filtered[0][0].Time != start || filtered[1][0].Track != "c" {
+		t.Fatalf("got %+v, expected the last two positions of a and c", filtered)
+	}
+
+	tf.MinLength = 1000
+	filtered = tf.apply(tracks)
+	if len(filtered) != 1 || filtered[0][0].Track != "a" {
+		t.Errorf("got %+v, expected only a to be long enough", filtered)
+	}
+
+	fc := tracksGeoJSON(tf.apply(tracks))
+	if len(fc.Features) != 1 {
+		t.Fatalf("got %+v, expected one feature", fc)
+	}
+	f := fc.Features[0]
+	if f.Geometry.Type != "LineString" || f.Properties["positions"] != 2 || f.Properties["track"] != "a" {
+		t.Errorf("got %+v, expected a's LineString", f)
+	}
+	if coordinates := f.Geometry.Coordinates.([][2]float64); coordinates[0] != [2]float64{-73.68, 42.73} {
+		t.Errorf("got %v, expected longitude before latitude", coordinates)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// maxTrackerIDLength is the longest tracker ID that can be stored with a Location.
+const maxTrackerIDLength = 10
+
+// TrackerDevicesHandler lists the TrackerDevices that were installed during the
+// request's time range, optionally in one Vehicle, like the exports. Add
+// tracker_id to see where one tracker has been.
+func (api *API) TrackerDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	devices, err := api.ms.TrackerDevices(filter)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get tracker devices")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if trackerID := r.URL.Query().Get("tracker_id"); trackerID != "" {
+		matching := []*shuttletracker.TrackerDevice{}
+		for _, device := range devices {
+			if device.TrackerID == trackerID {
+				matching = append(matching, device)
+			}
+		}
+		devices = matching
+	}
+	WriteJSON(w, devices)
+}
+
+// TrackerDevicesCreateHandler creates a TrackerDevice from the JSON in the request body.
+func (api *API) TrackerDevicesCreateHandler(w http.ResponseWriter, r *http.Request) {
+	device := &shuttletracker.TrackerDevice{}
+	if err := json.NewDecoder(r.Body).Decode(device); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateTrackerDevice(api.ms, device); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ms.CreateTrackerDevice(device); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create tracker device")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, device)
+}
+
+// TrackerDevicesEditHandler replaces a TrackerDevice with the JSON in the
+// request body, e.g. to end it when the tracker is removed.
+func (api *API) TrackerDevicesEditHandler(w http.ResponseWriter, r *http.Request) {
+	device := &shuttletracker.TrackerDevice{}
+	if err := json.NewDecoder(r.Body).Decode(device); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateTrackerDevice(api.ms, device); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := api.ms.ModifyTrackerDevice(device)
+	if err == shuttletracker.ErrTrackerDeviceNotFound {
+		http.Error(w, "Tracker device not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify tracker device")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, device)
+}
+
+// TrackerDevicesDeleteHandler deletes the TrackerDevice with the id in the query string.
+func (api *API) TrackerDevicesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.ms.DeleteTrackerDevice(id)
+	if err == shuttletracker.ErrTrackerDeviceNotFound {
+		http.Error(w, "Tracker device not found", http.StatusNotFound)
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete tracker device")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validateTrackerDevice checks that a TrackerDevice has a tracker ID and a
+// Vehicle that exists, that it ends after it starts, that its tracker isn't
+// installed in another Vehicle at the same time, and that no other tracker in
+// its Vehicle at the same time has the same priority.
+func validateTrackerDevice(ms shuttletracker.ModelService, device *shuttletracker.TrackerDevice) error {
+	device.TrackerID = strings.TrimSpace(device.TrackerID)
+	if device.TrackerID == "" {
+		return fmt.Errorf("tracker_id is required")
+	}
+	if len(device.TrackerID) > maxTrackerIDLength {
+		return fmt.Errorf("tracker_id can be at most %d characters", maxTrackerIDLength)
+	}
+	if device.Start.IsZero() {
+		return fmt.Errorf("start is required")
+	}
+	if device.End != nil && !device.End.After(device.Start) {
+		return fmt.Errorf("end %s is not after start %s", device.End.Format(time.RFC3339), device.Start.Format(time.RFC3339))
+	}
+	_, err := ms.Vehicle(device.VehicleID)
+	if err == shuttletracker.ErrVehicleNotFound {
+		return fmt.Errorf("vehicle %d does not exist", device.VehicleID)
+	} else if err != nil {
+		return err
+	}
+
+	// Trackers without an end stay installed indefinitely.
+	until := device.Start.AddDate(100, 0, 0)
+	if device.End != nil {
+		until = *device.End
+	}
+	others, err := ms.TrackerDevices(shuttletracker.HistoryFilter{Since: device.Start, Until: until})
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		// A tracker can be installed as soon as the previous one is removed.
+		if other.ID == device.ID || !other.Overlaps(device.Start, until) {
+			continue
+		}
+		if other.TrackerID == device.TrackerID {
+			return fmt.Errorf("tracker %s is installed in vehicle %d during tracker device %d", device.TrackerID, other.VehicleID, other.ID)
+		}
+		if other.VehicleID == device.VehicleID && other.Priority == device.Priority {
+			return fmt.Errorf("vehicle %d has tracker %s with priority %d installed during tracker device %d",
+				device.VehicleID, other.TrackerID, other.Priority, other.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestValidateTrackerDevice(t *testing.T) {
+	start := time.Date(2019, time.March, 4, 8, 0, 0, 0, time.UTC)
+	at := func(days int) *time.Time {
+		t := start.AddDate(0, 0, days)
+		return &t
+	}
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicle", int64(3)).Return(&shuttletracker.Vehicle{ID: 3}, nil)
+	ms.VehicleService.On("Vehicle", int64(4)).Return(&shuttletracker.Vehicle{ID: 4}, nil)
+	ms.VehicleService.On("Vehicle", int64(5)).Return((*shuttletracker.Vehicle)(nil), shuttletracker.ErrVehicleNotFound)
+	ms.TrackerDeviceService.On("TrackerDevices", tmock.Anything).Return([]*shuttletracker.TrackerDevice{
+		{ID: 1, TrackerID: "100", VehicleID: 3, Start: start, End: at(10)},
+		{ID: 2, TrackerID: "200", VehicleID: 4, Start: *at(5)},
+	}, nil)
+
+	tests := []struct {
+		device shuttletracker.TrackerDevice
+		err    string
+	}{
+		{shuttletracker.TrackerDevice{TrackerID: "100", VehicleID: 4, Start: *at(10), End: at(12)}, "vehicle 4 has tracker 200 with priority 0"},
+		{shuttletracker.TrackerDevice{TrackerID: "100", VehicleID: 4, Priority: 1, Start: *at(10), End: at(12)}, ""},
+		{shuttletracker.TrackerDevice{TrackerID: "100", VehicleID: 3, Start: *at(10)}, ""},
+		{shuttletracker.TrackerDevice{TrackerID: "300", VehicleID: 4, Start: *at(1), End: at(5)}, ""},
+		{shuttletracker.TrackerDevice{ID: 1, TrackerID: "100", VehicleID: 3, Start: start, End: at(4)}, ""},
+		{shuttletracker.TrackerDevice{TrackerID: " ", VehicleID: 3, Start: start}, "tracker_id is required"},
+		{shuttletracker.TrackerDevice{TrackerID: "12345678901", VehicleID: 3, Start: start}, "at most 10 characters"},
+		{shuttletracker.TrackerDevice{TrackerID: "300", VehicleID: 3}, "start is required"},
+		{shuttletracker.TrackerDevice{TrackerID: "300", VehicleID: 3, Start: *at(20), End: at(20)}, "is not after start"},
+		{shuttletracker.TrackerDevice{TrackerID: "300", VehicleID: 5, Start: start}, "vehicle 5 does not exist"},
+		{shuttletracker.TrackerDevice{TrackerID: "100", VehicleID: 4, Start: *at(2), End: at(4)}, "tracker 100 is installed in vehicle 3 during tracker device 1"},
+		{shuttletracker.TrackerDevice{TrackerID: "300", VehicleID: 3, Start: *at(9)}, "vehicle 3 has tracker 100 with priority 0 installed during tracker device 1"},
+	}
+	for _, test := range tests {
+		err := validateTrackerDevice(ms, &test.device)
+		if test.err == "" && err != nil {
+			t.Errorf("%+v: unexpected error: %s", test.device, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%+v: got error %v, expected %q", test.device, err, test.err)
+		}
+	}
+}
+
+func TestTrackerDevicesHandlerTrackerID(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.TrackerDeviceService.On("TrackerDevices", tmock.Anything).Return([]*shuttletracker.TrackerDevice{
+		{ID: 1, TrackerID: "100", VehicleID: 3},
+		{ID: 2, TrackerID: "200", VehicleID: 4},
+	}, nil)
+	api := API{ms: ms}
+
+	w := httptest.NewRecorder()
+	api.TrackerDevicesHandler(w, httptest.NewRequest("GET", "/trackers/?tracker_id=200", nil))
+	if w.Code != 200 {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	devices := []shuttletracker.TrackerDevice{}
+	if err := json.NewDecoder(w.Body).Decode(&devices); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if len(devices) != 1 || devices[0].ID != 2 {
+		t.Errorf("got %+v, expected only tracker device 2", devices)
+	}
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// planTransferTime is the least time that riders are given to get off one
+// shuttle and onto another at the same Stop.
+const planTransferTime = 2 * time.Minute
+
+// planLeg is a ride on one Route from one Stop to another, either predicted
+// from a Vehicle's ETAs or planned by a Schedule.
+type planLeg struct {
+	Type       string    `json:"type"`
+	RouteID    int64     `json:"route_id"`
+	FromStopID int64     `json:"from_stop_id"`
+	ToStopID   int64     `json:"to_stop_id"`
+	Departure  time.Time `json:"departure"`
+	Arrival    time.Time `json:"arrival"`
+
+	// VehicleID is set for realtime legs.
+	VehicleID *int64 `json:"vehicle_id,omitempty"`
+
+	// The rest are set for scheduled legs.
+	ScheduleID *int64 `json:"schedule_id,omitempty"`
+	TripID     *int64 `json:"trip_id,omitempty"`
+	Direction  string `json:"direction,omitempty"`
+}
+
+// itinerary is a way to get from one Stop to another, directly or with a
+// transfer.
+type itinerary struct {
+	Departure time.Time `json:"departure"`
+	Arrival   time.Time `json:"arrival"`
+	Transfers int       `json:"transfers"`
+	Legs      []planLeg `json:"legs"`
+}
+
+func newItinerary(legs ...planLeg) itinerary {
+	return itinerary{
+		Departure: legs[0].Departure,
+		Arrival:   legs[len(legs)-1].Arrival,
+		Transfers: len(legs) - 1,
+		Legs:      legs,
+	}
+}
+
+// dominates returns whether it is at least as good as other in every way:
+// it leaves no earlier, arrives no later, and has no more transfers.
+func (it itinerary) dominates(other itinerary) bool {
+	return !it.Departure.Before(other.Departure) && !it.Arrival.After(other.Arrival) && it.Transfers <= other.Transfers
+}
+
+// tripPlan is the best itineraries from one Stop to another.
+type tripPlan struct {
+	FromStopID int64 `json:"from_stop_id"`
+	ToStopID   int64 `json:"to_stop_id"`
+
+	// Realtime is false when predictions aren't available, e.g. because
+	// the data feed is down, so itineraries only use Schedules.
+	Realtime    bool        `json:"realtime"`
+	Itineraries []itinerary `json:"itineraries"`
+}
+
+// tripPlanner finds legs between Stops on Routes, remembering the ones it has
+// found while planning one trip.
+type tripPlanner struct {
+	now       time.Time
+	realtime  bool
+	etas      map[int64]shuttletracker.VehicleETA
+	calendar  shuttletracker.Calendar
+	schedules map[int64][]*shuttletracker.Schedule
+	found     map[[3]int64][]planLeg
+}
+
+// legs returns the legs on a Route from one Stop to another that depart
+// within nextDeparturesHorizon, in order of departure. Vehicles' ETAs are used
+// where there are any, and Schedules fill in the rest, like next departures.
+func (tp *tripPlanner) legs(routeID, fromStopID, toStopID int64) []planLeg {
+	key := [3]int64{routeID, fromStopID, toStopID}
+	if legs, ok := tp.found[key]; ok {
+		return legs
+	}
+
+	legs := []planLeg{}
+	// covered is how late the last realtime departure on the Route is.
+	covered := time.Time{}
+	for _, vehicleETA := range tp.etas {
+		if vehicleETA.RouteID != routeID {
+			continue
+		}
+		vehicleID := vehicleETA.VehicleID
+		for i, from := range vehicleETA.StopETAs {
+			if from.StopID != fromStopID || from.ETA.Before(tp.now) && !from.Arriving {
+				continue
+			}
+			for _, to := range vehicleETA.StopETAs[i+1:] {
+				if to.StopID != toStopID {
+					continue
+				}
+				legs = append(legs, planLeg{
+					Type:       departureRealtime,
+					RouteID:    routeID,
+					FromStopID: fromStopID,
+					ToStopID:   toStopID,
+					Departure:  from.ETA,
+					Arrival:    to.ETA,
+					VehicleID:  &vehicleID,
+				})
+				if until := from.ETA.Add(realtimeSlack); until.After(covered) {
+					covered = until
+				}
+				break
+			}
+			break
+		}
+	}
+
+	rides := tp.calendar.Rides(tp.schedules[routeID], fromStopID, toStopID, tp.now, tp.now.Add(nextDeparturesHorizon))
+	for _, ride := range rides {
+		if !ride.Time.After(covered) {
+			continue
+		}
+		ride := ride
+		legs = append(legs, planLeg{
+			Type:       departureScheduled,
+			RouteID:    routeID,
+			FromStopID: fromStopID,
+			ToStopID:   toStopID,
+			Departure:  ride.Time,
+			Arrival:    ride.Arrival,
+			ScheduleID: &ride.ScheduleID,
+			TripID:     &ride.TripID,
+			Direction:  ride.Direction,
+		})
+	}
+
+	sort.SliceStable(legs, func(i, j int) bool {
+		return legs[i].Departure.Before(legs[j].Departure)
+	})
+	tp.found[key] = legs
+	return legs
+}
+
+// next returns the leg on a Route from one Stop to another that departs no
+// earlier than earliest and arrives first, if there is one.
+func (tp *tripPlanner) next(routeID, fromStopID, toStopID int64, earliest time.Time) (planLeg, bool) {
+	best := planLeg{}
+	found := false
+	for _, leg := range tp.legs(routeID, fromStopID, toStopID) {
+		if leg.Departure.Before(earliest) {
+			continue
+		}
+		if !found || leg.Arrival.Before(best.Arrival) {
+			best = leg
+			found = true
+		}
+	}
+	return best, found
+}
+
+// plan returns up to limit itineraries from one Stop to another on routes,
+// the earliest to arrive first. Itineraries either ride one Route that
+// serves both Stops or transfer once at a Stop that a Route serving each has
+// in common. Only the first limit legs to each transfer Stop are tried, and
+// itineraries that another beats in every way are left out.
+func (tp *tripPlanner) plan(routes []*shuttletracker.Route, fromStopID, toStopID int64, limit int) []itinerary {
+	serves := func(route *shuttletracker.Route, stopID int64) bool {
+		for _, id := range route.StopIDs {
+			if id == stopID {
+				return true
+			}
+		}
+		return false
+	}
+
+	itineraries := []itinerary{}
+	for _, first := range routes {
+		if !serves(first, fromStopID) {
+			continue
+		}
+		if serves(first, toStopID) {
+			for _, leg := range tp.legs(first.ID, fromStopID, toStopID) {
+				itineraries = append(itineraries, newItinerary(leg))
+			}
+		}
+		for _, second := range routes {
+			if second.ID == first.ID || !serves(second, toStopID) {
+				continue
+			}
+			for _, transferStopID := range first.StopIDs {
+				if transferStopID == fromStopID || transferStopID == toStopID || !serves(second, transferStopID) {
+					continue
+				}
+				firstLegs := tp.legs(first.ID, fromStopID, transferStopID)
+				if len(firstLegs) > limit {
+					firstLegs = firstLegs[:limit]
+				}
+				for _, firstLeg := range firstLegs {
+					secondLeg, ok := tp.next(second.ID, transferStopID, toStopID, firstLeg.Arrival.Add(planTransferTime))
+					if ok {
+						itineraries = append(itineraries, newItinerary(firstLeg, secondLeg))
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(itineraries, func(i, j int) bool {
+		a, b := itineraries[i], itineraries[j]
+		if !a.Arrival.Equal(b.Arrival) {
+			return a.Arrival.Before(b.Arrival)
+		}
+		if a.Transfers != b.Transfers {
+			return a.Transfers < b.Transfers
+		}
+		return a.Departure.After(b.Departure)
+	})
+	best := []itinerary{}
+	for i, it := range itineraries {
+		dominated := false
+		for j, other := range itineraries {
+			// of equally good itineraries, keep the first
+			if j != i && other.dominates(it) && (j < i || !it.dominates(other)) {
+				dominated = true
+				break
+			}
+		}
+		if !dominated {
+			best = append(best, it)
+		}
+		if len(best) == limit {
+			break
+		}
+	}
+	return best
+}
+
+// TripPlanHandler returns itineraries from the Stop in the "from_stop" query
+// parameter to the one in "to_stop", up to "limit" (default 5), the earliest
+// to arrive first.
+func (api *API) TripPlanHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 5
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 20 {
+			http.Error(w, "limit must be between 1 and 20", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	stopIDs := [2]int64{}
+	for i, param := range []string{"from_stop", "to_stop"} {
+		id, err := strconv.ParseInt(r.URL.Query().Get(param), 10, 64)
+		if err != nil {
+			http.Error(w, param+" must be a stop's ID", http.StatusBadRequest)
+			return
+		}
+		stopIDs[i] = id
+	}
+	fromStopID, toStopID := stopIDs[0], stopIDs[1]
+	if fromStopID == toStopID {
+		http.Error(w, "from_stop and to_stop must be different", http.StatusBadRequest)
+		return
+	}
+	for _, id := range stopIDs {
+		_, err := api.ms.Stop(id)
+		if err == shuttletracker.ErrStopNotFound {
+			http.Error(w, "Stop not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("unable to get stop")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	now := time.Now()
+	tp, routes, err := api.tripPlanner(now)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to plan trip")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, tripPlan{
+		FromStopID:  fromStopID,
+		ToStopID:    toStopID,
+		Realtime:    tp.realtime,
+		Itineraries: tp.plan(routes, fromStopID, toStopID, limit),
+	})
+}
+
+// tripPlanner returns a tripPlanner for trips starting at now and the enabled
+// Routes that aren't hidden. It only uses ETAs if they're up to date.
+func (api *API) tripPlanner(now time.Time) (*tripPlanner, []*shuttletracker.Route, error) {
+	allRoutes, err := api.ms.Routes()
+	if err != nil {
+		return nil, nil, err
+	}
+	routes := []*shuttletracker.Route{}
+	for _, route := range allRoutes {
+		if route.Enabled && !api.visibility.hidden(&route.ID, now) {
+			routes = append(routes, route)
+		}
+	}
+	schedules, err := api.ms.Schedules()
+	if err != nil {
+		return nil, nil, err
+	}
+	periods, err := api.ms.ServicePeriods()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tp := &tripPlanner{
+		now:       now,
+		calendar:  shuttletracker.Calendar(periods),
+		schedules: map[int64][]*shuttletracker.Schedule{},
+		found:     map[[3]int64][]planLeg{},
+	}
+	for _, s := range schedules {
+		tp.schedules[s.RouteID] = append(tp.schedules[s.RouteID], s)
+	}
+	if !etasStale() {
+		tp.realtime = true
+		tp.etas = api.etaManager.CurrentETAs()
+	}
+	return tp, routes, nil
+}
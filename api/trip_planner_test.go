@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestTripPlanHandler(t *testing.T) {
+	defer health.Report(health.Updater, nil)
+
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	in := func(minutes int) shuttletracker.TimeOfDay {
+		t := now.Add(time.Duration(minutes) * time.Minute)
+		return shuttletracker.TimeOfDay(t.Sub(midnight).Truncate(time.Second))
+	}
+	// trip visits stops at minutes from now, alternating stop IDs and minutes
+	trip := func(id int64, stops ...int) *shuttletracker.Trip {
+		trip := &shuttletracker.Trip{ID: id}
+		for i := 0; i < len(stops); i += 2 {
+			at := in(stops[i+1])
+			trip.StopTimes = append(trip.StopTimes, shuttletracker.StopTime{StopID: int64(stops[i]), Arrival: at, Departure: at})
+		}
+		return trip
+	}
+	everyDay := []time.Weekday{0, 1, 2, 3, 4, 5, 6}
+
+	ms := &mock.ModelService{}
+	for id := int64(1); id <= 3; id++ {
+		ms.StopService.On("Stop", id).Return(&shuttletracker.Stop{ID: id}, nil)
+	}
+	ms.StopService.On("Stop", int64(4)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+		{ID: 1, Enabled: true, StopIDs: []int64{1, 2}},
+		{ID: 2, Enabled: true, StopIDs: []int64{2, 3}},
+		{ID: 3, Enabled: true, StopIDs: []int64{1, 3}},
+		{ID: 4, StopIDs: []int64{1, 3}},
+	}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{
+		{ID: 1, RouteID: 1, Days: everyDay, Trips: []*shuttletracker.Trip{
+			trip(10, 1, 5, 2, 10),
+			// leaves earlier than trip 10 but makes the same connection
+			trip(12, 1, 4, 2, 10),
+			trip(11, 1, 30, 2, 35),
+		}},
+		{ID: 2, RouteID: 2, Days: everyDay, Trips: []*shuttletracker.Trip{
+			// too soon to transfer to from trip 10
+			trip(20, 2, 11, 3, 16),
+			trip(21, 2, 15, 3, 20),
+		}},
+		{ID: 3, RouteID: 3, Days: everyDay, Trips: []*shuttletracker.Trip{
+			trip(30, 1, 2, 3, 40),
+			trip(31, 1, 50, 3, 60),
+		}},
+		// Route 4 is disabled.
+		{ID: 4, RouteID: 4, Days: everyDay, Trips: []*shuttletracker.Trip{trip(40, 1, 6, 3, 8)}},
+	}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		// Running a little early for trip 30.
+		7: {VehicleID: 7, RouteID: 3, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(time.Minute)},
+			{StopID: 3, ETA: now.Add(25 * time.Minute)},
+		}},
+	})
+	api := API{ms: ms, etaManager: em}
+
+	get := func() tripPlan {
+		w := httptest.NewRecorder()
+		api.TripPlanHandler(w, httptest.NewRequest("GET", "/plan?from_stop=1&to_stop=3", nil))
+		if w.Code != 200 {
+			t.Fatalf("got status code %d: %s", w.Code, w.Body)
+		}
+		plan := tripPlan{}
+		if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+			t.Fatalf("unable to decode plan: %s", err)
+		}
+		return plan
+	}
+	describe := func(itineraries []itinerary) []string {
+		described := []string{}
+		for _, it := range itineraries {
+			legs := []string{}
+			for _, leg := range it.Legs {
+				if leg.VehicleID != nil {
+					legs = append(legs, fmt.Sprintf("%s vehicle %d", leg.Type, *leg.VehicleID))
+				} else {
+					legs = append(legs, fmt.Sprintf("%s trip %d", leg.Type, *leg.TripID))
+				}
+			}
+			described = append(described, strings.Join(legs, " then "))
+		}
+		return described
+	}
+
+	plan := get()
+	expected := []string{"scheduled trip 10 then scheduled trip 21", "realtime vehicle 7", "scheduled trip 31"}
+	if !plan.Realtime || !reflect.DeepEqual(describe(plan.Itineraries), expected) {
+		t.Errorf("got realtime %t and %v, expected %v", plan.Realtime, describe(plan.Itineraries), expected)
+	}
+	if len(plan.Itineraries) > 0 {
+		first := plan.Itineraries[0]
+		if first.Transfers != 1 || !first.Departure.Equal(in(5).On(midnight)) || !first.Arrival.Equal(in(20).On(midnight)) {
+			t.Errorf("got %+v", first)
+		}
+	}
+
+	health.Report(health.Updater, errors.New("data feed status code 502"))
+	plan = get()
+	expected = []string{"scheduled trip 10 then scheduled trip 21", "scheduled trip 30", "scheduled trip 31"}
+	if plan.Realtime || !reflect.DeepEqual(describe(plan.Itineraries), expected) {
+		t.Errorf("got realtime %t and %v, expected %v", plan.Realtime, describe(plan.Itineraries), expected)
+	}
+}
+
+func TestTripPlanHandlerBadRequest(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	ms.StopService.On("Stop", int64(4)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	api := API{ms: ms}
+
+	for query, code := range map[string]int{
+		"from_stop=1":                   400,
+		"from_stop=1&to_stop=1":         400,
+		"from_stop=1&to_stop=x":         400,
+		"from_stop=1&to_stop=2&limit=0": 400,
+		"from_stop=1&to_stop=4":         404,
+	} {
+		w := httptest.NewRecorder()
+		api.TripPlanHandler(w, httptest.NewRequest("GET", "/plan?"+query, nil))
+		if w.Code != code {
+			t.Errorf("%s: got status code %d, expected %d", query, w.Code, code)
+		}
+	}
+}
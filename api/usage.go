@@ -0,0 +1,158 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// usageRecordInterval is how often each instance adds its usage to the totals.
+const usageRecordInterval = 5 * time.Minute
+
+// usageCounter counts anonymous, aggregate usage: requests by route, Fusion
+// subscriptions by topic, and unique websocket clients each day. A nil
+// usageCounter counts nothing.
+type usageCounter struct {
+	us shuttletracker.UsageService
+
+	lock    sync.Mutex
+	usage   *shuttletracker.Usage
+	clients map[string]bool
+}
+
+func newUsageCounter(us shuttletracker.UsageService) *usageCounter {
+	uc := &usageCounter{us: us}
+	uc.reset(time.Now())
+	return uc
+}
+
+// reset starts counting usage for the day of t. The lock must be held.
+func (uc *usageCounter) reset(t time.Time) *shuttletracker.Usage {
+	old := uc.usage
+	uc.usage = &shuttletracker.Usage{
+		Day:       usageDay(t),
+		Endpoints: map[string]int64{},
+		Topics:    map[string]int64{},
+	}
+	uc.clients = map[string]bool{}
+	return old
+}
+
+func usageDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// current returns the usage for today, first recording the previous day's
+// usage if the day has changed. The lock must be held.
+func (uc *usageCounter) current() *shuttletracker.Usage {
+	now := time.Now()
+	if !usageDay(now).Equal(uc.usage.Day) {
+		go uc.save(uc.reset(now))
+	}
+	return uc.usage
+}
+
+func (uc *usageCounter) countEndpoint(method, route string) {
+	if uc == nil {
+		return
+	}
+	uc.lock.Lock()
+	uc.current().Endpoints[method+" "+route]++
+	uc.lock.Unlock()
+}
+
+func (uc *usageCounter) countTopic(topic string) {
+	if uc == nil {
+		return
+	}
+	uc.lock.Lock()
+	uc.current().Topics[topic]++
+	uc.lock.Unlock()
+}
+
+// countClient counts a websocket client once per day. Clients are identified
+// by a hash of their address, user agent, and the day, so the stored value
+// can't be used to follow anyone.
+func (uc *usageCounter) countClient(r *http.Request) {
+	if uc == nil {
+		return
+	}
+	uc.lock.Lock()
+	defer uc.lock.Unlock()
+	usage := uc.current()
+	sum := sha256.Sum256([]byte(usage.Day.Format("2006-01-02") + "|" + clientAddress(r) + "|" + r.UserAgent()))
+	client := hex.EncodeToString(sum[:16])
+	if !uc.clients[client] {
+		uc.clients[client] = true
+		usage.Clients = append(usage.Clients, client)
+	}
+}
+
+// middleware counts each request by its route pattern. Requests that don't
+// match a route aren't counted.
+func (uc *usageCounter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			uc.countEndpoint(r.Method, rctx.RoutePattern())
+		}
+	})
+}
+
+// run records usage periodically.
+func (uc *usageCounter) run() {
+	ticker := time.NewTicker(usageRecordInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		uc.flush()
+	}
+}
+
+// flush records usage that has been counted so far.
+func (uc *usageCounter) flush() {
+	if uc == nil {
+		return
+	}
+	uc.lock.Lock()
+	usage := uc.reset(time.Now())
+	uc.lock.Unlock()
+	uc.save(usage)
+}
+
+func (uc *usageCounter) save(usage *shuttletracker.Usage) {
+	if len(usage.Endpoints) == 0 && len(usage.Topics) == 0 && len(usage.Clients) == 0 {
+		return
+	}
+	if err := uc.us.RecordUsage(usage); err != nil {
+		log.WithError(err).Error("unable to record usage")
+	}
+}
+
+// UsageHandler returns usage for each day, by default for the past 30 days.
+func (api *API) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if d := r.URL.Query().Get("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 {
+			http.Error(w, "days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	usage, err := api.uss.Usage(usageDay(time.Now()).AddDate(0, 0, 1-days))
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get usage")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, usage)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestUsageCounter(t *testing.T) {
+	us := &mock.UsageService{}
+	uc := newUsageCounter(us)
+
+	r := chi.NewRouter()
+	r.Use(uc.middleware)
+	r.Get("/stops/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	for _, path := range []string{"/stops/1", "/stops/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	uc.countTopic("eta")
+	uc.countTopic("eta")
+	for _, addr := range []string{"192.0.2.1:1234", "192.0.2.1:5678", "192.0.2.2:1234"} {
+		req := httptest.NewRequest("GET", "/fusion/", nil)
+		req.RemoteAddr = addr
+		uc.countClient(req)
+	}
+
+	var recorded *shuttletracker.Usage
+	us.On("RecordUsage", tmock.AnythingOfType("*shuttletracker.Usage")).Return(nil).Run(func(args tmock.Arguments) {
+		recorded = args.Get(0).(*shuttletracker.Usage)
+	})
+	uc.lock.Lock()
+	usage := uc.reset(time.Now())
+	uc.lock.Unlock()
+	uc.save(usage)
+
+	if recorded == nil {
+		t.Fatal("usage was not recorded")
+	}
+	if len(recorded.Endpoints) != 1 || recorded.Endpoints["GET /stops/{id}"] != 2 {
+		t.Errorf("got endpoints %v", recorded.Endpoints)
+	}
+	if recorded.Topics["eta"] != 2 {
+		t.Errorf("got topics %v", recorded.Topics)
+	}
+	if len(recorded.Clients) != 2 {
+		t.Errorf("got %d clients, expected 2", len(recorded.Clients))
+	}
+	if !recorded.Day.Equal(usageDay(time.Now())) {
+		t.Errorf("got day %s", recorded.Day)
+	}
+
+	// nothing new to record
+	uc.lock.Lock()
+	usage = uc.reset(time.Now())
+	uc.lock.Unlock()
+	uc.save(usage)
+	us.AssertNumberOfCalls(t, "RecordUsage", 1)
+}
+
+func TestUsageCounterNil(t *testing.T) {
+	var uc *usageCounter
+	uc.countEndpoint("GET", "/")
+	uc.countTopic("eta")
+	uc.countClient(httptest.NewRequest("GET", "/fusion/", nil))
+}
+
+func TestUsageHandler(t *testing.T) {
+	us := &mock.UsageService{}
+	us.On("Usage", tmock.AnythingOfType("time.Time")).Return([]*shuttletracker.DailyUsage{}, nil)
+	api := API{uss: us}
+
+	w := httptest.NewRecorder()
+	api.UsageHandler(w, httptest.NewRequest("GET", "/usage?days=7", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status code %d, expected 200", w.Code)
+	}
+	since := us.Calls[0].Arguments.Get(0).(time.Time)
+	if expected := usageDay(time.Now()).AddDate(0, 0, -6); !since.Equal(expected) {
+		t.Errorf("got since %s, expected %s", since, expected)
+	}
+
+	w = httptest.NewRecorder()
+	api.UsageHandler(w, httptest.NewRequest("GET", "/usage?days=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// vehicleHistoryInterval is the least time between the Locations returned in a
+// vehicle's history. Trackers report every few seconds, which is more than
+// dispatchers need to see where a vehicle went.
+const vehicleHistoryInterval = 30 * time.Second
+
+// maxVehicleHistoryRange is the longest window of a vehicle's history that can
+// be requested at once, since every Location in it is read.
+const maxVehicleHistoryRange = 7 * 24 * time.Hour
+
+// Statuses that a vehicle's history can change to.
+const (
+	vehicleStatusOnline       = "online"
+	vehicleStatusOffline      = "offline"
+	vehicleStatusOutOfService = "out_of_service"
+	vehicleStatusInService    = "in_service"
+)
+
+// vehicleHistory is everything that happened to a Vehicle during a window.
+type vehicleHistory struct {
+	Vehicle          *shuttletracker.Vehicle    `json:"vehicle"`
+	From             time.Time                  `json:"from"`
+	To               time.Time                  `json:"to"`
+	RouteAssignments []*routeAssignment         `json:"route_assignments"`
+	Locations        []*shuttletracker.Location `json:"locations"`
+	Arrivals         []*shuttletracker.Arrival  `json:"arrivals"`
+	StatusChanges    []*vehicleStatusChange     `json:"status_changes"`
+}
+
+// routeAssignment is a stretch of time that a Vehicle's Locations were on a
+// Route. End is the time of the first Location after it, or of its own last
+// Location if there were none.
+type routeAssignment struct {
+	RouteID int64     `json:"route_id"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+// vehicleStatusChange records a Vehicle coming online or going offline, which
+// is derived from gaps in its Locations, or going out of or back into service
+// for maintenance.
+type vehicleStatusChange struct {
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"`
+}
+
+// VehicleHistoryHandler returns a vehicle's route assignments, downsampled
+// locations, arrivals at stops, and status changes from "from" until "to", so
+// that dispatchers can reconstruct its day. Both are RFC 3339 times; the
+// window defaults to the start of today until now.
+func (api *API) VehicleHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseVehicleHistoryRange(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vehicle, err := api.ms.Vehicle(id)
+	if err == shuttletracker.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get vehicle")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history, err := api.vehicleHistory(vehicle, from, to)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get vehicle history")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, history)
+}
+
+// parseVehicleHistoryRange reads the window of a vehicle's history from the query string.
+func parseVehicleHistoryRange(r *http.Request, now time.Time) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	to = now
+	if s := q.Get("to"); s != "" {
+		to, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return from, to, err
+		}
+	}
+	y, m, d := to.In(time.Local).Date()
+	from = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	if s := q.Get("from"); s != "" {
+		from, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return from, to, err
+		}
+	}
+	if !to.After(from) {
+		return from, to, fmt.Errorf("to must be after from")
+	}
+	if to.Sub(from) > maxVehicleHistoryRange {
+		return from, to, fmt.Errorf("history can cover at most %s", maxVehicleHistoryRange)
+	}
+	return from, to, nil
+}
+
+func (api *API) vehicleHistory(vehicle *shuttletracker.Vehicle, from, to time.Time) (*vehicleHistory, error) {
+	history := &vehicleHistory{
+		Vehicle:          vehicle,
+		From:             from,
+		To:               to,
+		RouteAssignments: []*routeAssignment{},
+		Locations:        []*shuttletracker.Location{},
+		Arrivals:         []*shuttletracker.Arrival{},
+		StatusChanges:    []*vehicleStatusChange{},
+	}
+	filter := shuttletracker.HistoryFilter{Since: from, Until: to, VehicleID: &vehicle.ID}
+
+	var last *shuttletracker.Location
+	var assignment *routeAssignment
+	err := api.ms.ExportLocations(filter, func(l *shuttletracker.Location) error {
+		if last == nil || l.Time.Sub(last.Time) > api.offlineAfter {
+			if last != nil {
+				history.changeStatus(last.Time.Add(api.offlineAfter), vehicleStatusOffline)
+			}
+			history.changeStatus(l.Time, vehicleStatusOnline)
+		}
+
+		if assignment != nil && (l.RouteID == nil || *l.RouteID != assignment.RouteID) {
+			assignment.End = l.Time
+			assignment = nil
+		}
+		if assignment == nil && l.RouteID != nil {
+			assignment = &routeAssignment{RouteID: *l.RouteID, Start: l.Time}
+			history.RouteAssignments = append(history.RouteAssignments, assignment)
+		}
+
+		kept := len(history.Locations)
+		if kept == 0 || l.Time.Sub(history.Locations[kept-1].Time) >= vehicleHistoryInterval {
+			history.Locations = append(history.Locations, l)
+		}
+		last = l
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if assignment != nil {
+		assignment.End = last.Time
+	}
+	// Keep where the vehicle ended up even if it was dropped by downsampling.
+	if kept := len(history.Locations); kept > 0 && history.Locations[kept-1] != last {
+		history.Locations = append(history.Locations, last)
+	}
+	if last != nil && to.Sub(last.Time) > api.offlineAfter {
+		history.changeStatus(last.Time.Add(api.offlineAfter), vehicleStatusOffline)
+	}
+
+	err = api.ms.ExportArrivals(filter, func(a *shuttletracker.Arrival) error {
+		history.Arrivals = append(history.Arrivals, a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := api.ms.MaintenanceRecords(&vehicle.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range records {
+		if m.OutOfServiceStart != nil && !m.OutOfServiceStart.Before(from) && m.OutOfServiceStart.Before(to) {
+			history.changeStatus(*m.OutOfServiceStart, vehicleStatusOutOfService)
+		}
+		if m.OutOfServiceEnd != nil && !m.OutOfServiceEnd.Before(from) && m.OutOfServiceEnd.Before(to) {
+			history.changeStatus(*m.OutOfServiceEnd, vehicleStatusInService)
+		}
+	}
+	sort.SliceStable(history.StatusChanges, func(i, j int) bool {
+		return history.StatusChanges[i].Time.Before(history.StatusChanges[j].Time)
+	})
+
+	return history, nil
+}
+
+func (h *vehicleHistory) changeStatus(t time.Time, status string) {
+	h.StatusChanges = append(h.StatusChanges, &vehicleStatusChange{Time: t, Status: status})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestVehicleHistoryHandler(t *testing.T) {
+	from := time.Date(2019, time.March, 4, 8, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return from.Add(time.Duration(seconds) * time.Second)
+	}
+	route := func(id int64) *int64 {
+		return &id
+	}
+	vehicleID := int64(3)
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicle", vehicleID).Return(&shuttletracker.Vehicle{ID: vehicleID}, nil)
+	ms.LocationService.On("ExportLocations", tmock.Anything).Return([]*shuttletracker.Location{
+		{ID: 1, Time: at(0), RouteID: route(1)},
+		{ID: 2, Time: at(10), RouteID: route(1)},
+		{ID: 3, Time: at(40), RouteID: route(1)},
+		{ID: 4, Time: at(50), RouteID: route(2)},
+		{ID: 5, Time: at(1000), RouteID: route(2)},
+		{ID: 6, Time: at(1010)},
+	}, nil)
+	ms.ArrivalService.On("ExportArrivals", tmock.Anything).Return([]*shuttletracker.Arrival{
+		{ID: 7, VehicleID: vehicleID, RouteID: 1, StopID: 2, Time: at(20)},
+	}, nil)
+	outOfService := at(2000)
+	ms.MaintenanceService.On("MaintenanceRecords", &vehicleID).Return([]*shuttletracker.MaintenanceRecord{
+		{ID: 8, VehicleID: vehicleID, OutOfServiceStart: &outOfService},
+	}, nil)
+	api := API{ms: ms, offlineAfter: 5 * time.Minute}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "3")
+	req := httptest.NewRequest("GET", "/vehicles/3/history?from=2019-03-04T08:00:00Z&to=2019-03-04T09:00:00Z", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	api.VehicleHistoryHandler(w, req)
+	if w.Code != 200 {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	history := vehicleHistory{}
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+
+	locations := []int64{}
+	for _, l := range history.Locations {
+		locations = append(locations, l.ID)
+	}
+	expectedLocations := []int64{1, 3, 5, 6}
+	if len(locations) != len(expectedLocations) {
+		t.Fatalf("got locations %v, expected %v", locations, expectedLocations)
+	}
+	for i := range locations {
+		if locations[i] != expectedLocations[i] {
+			t.Errorf("got locations %v, expected %v", locations, expectedLocations)
+			break
+		}
+	}
+
+	expectedAssignments := []routeAssignment{
+		{RouteID: 1, Start: at(0), End: at(50)},
+		{RouteID: 2, Start: at(50), End: at(1010)},
+	}
+	if len(history.RouteAssignments) != len(expectedAssignments) {
+		t.Fatalf("got %d route assignments, expected %d", len(history.RouteAssignments), len(expectedAssignments))
+	}
+	for i, expected := range expectedAssignments {
+		a := history.RouteAssignments[i]
+		if a.RouteID != expected.RouteID || !a.Start.Equal(expected.Start) || !a.End.Equal(expected.End) {
+			t.Errorf("got route assignment %+v, expected %+v", a, expected)
+		}
+	}
+
+	if len(history.Arrivals) != 1 || history.Arrivals[0].ID != 7 {
+		t.Errorf("got arrivals %+v, expected arrival 7", history.Arrivals)
+	}
+
+	expectedChanges := []vehicleStatusChange{
+		{Time: at(0), Status: vehicleStatusOnline},
+		{Time: at(350), Status: vehicleStatusOffline},
+		{Time: at(1000), Status: vehicleStatusOnline},
+		{Time: at(1310), Status: vehicleStatusOffline},
+		{Time: at(2000), Status: vehicleStatusOutOfService},
+	}
+	if len(history.StatusChanges) != len(expectedChanges) {
+		t.Fatalf("got %d status changes, expected %d", len(history.StatusChanges), len(expectedChanges))
+	}
+	for i, expected := range expectedChanges {
+		c := history.StatusChanges[i]
+		if c.Status != expected.Status || !c.Time.Equal(expected.Time) {
+			t.Errorf("got status change %+v, expected %+v", c, expected)
+		}
+	}
+}
+
+func TestParseVehicleHistoryRange(t *testing.T) {
+	now := time.Date(2019, time.March, 4, 14, 0, 0, 0, time.Local)
+	tests := []struct {
+		query string
+		from  time.Time
+		err   bool
+	}{
+		{"", time.Date(2019, time.March, 4, 0, 0, 0, 0, time.Local), false},
+		{"from=2019-03-03T00:00:00Z&to=2019-03-04T00:00:00Z", time.Date(2019, time.March, 3, 0, 0, 0, 0, time.UTC), false},
+		{"from=2019-03-04T00:00:00Z&to=2019-03-03T00:00:00Z", time.Time{}, true},
+		{"from=2019-01-01T00:00:00Z&to=2019-03-03T00:00:00Z", time.Time{}, true},
+		{"from=yesterday", time.Time{}, true},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/vehicles/3/history?"+test.query, nil)
+		from, _, err := parseVehicleHistoryRange(req, now)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.query, err)
+		} else if !from.Equal(test.from) {
+			t.Errorf("%q: got from %s, expected %s", test.query, from, test.from)
+		}
+	}
+}
@@ -2,26 +2,49 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/go-chi/chi"
+
 	"github.com/wtg/shuttletracker"
 	"github.com/wtg/shuttletracker/log"
 )
 
 var (
 	lastUpdate time.Time
+
+	errNegativeCapacity = errors.New("capacity can't be negative")
 )
 
-// VehiclesHandler returns all the vehicles.
+// VehiclesHandler returns all the vehicles, or those in the group_id given in
+// the query string, and whether maintenance is keeping them out of service.
 func (api *API) VehiclesHandler(w http.ResponseWriter, r *http.Request) {
-	vehicles, err := api.ms.Vehicles()
+	filter, err := parseGroupFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	all, err := api.ms.VehiclesContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	vehicles := []*shuttletracker.Vehicle{}
+	for _, vehicle := range all {
+		if filter.MatchesVehicle(vehicle) {
+			vehicles = append(vehicles, vehicle)
+		}
+	}
+	err = api.markOutOfService(vehicles, time.Now())
 	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get maintenance records")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	WriteJSON(w, vehicles)
+	WriteNegotiated(w, r, vehicles)
 }
 
 // VehiclesCreateHandler adds a new vehicle.
@@ -33,6 +56,18 @@ func (api *API) VehiclesCreateHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if vehicle.Capacity < 0 {
+		http.Error(w, errNegativeCapacity.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateStyle(vehicle.Color, vehicle.Label, vehicle.Icon); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateGroupMembership(api.ms, &vehicle); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	err = api.ms.CreateVehicle(&vehicle)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -43,28 +78,48 @@ func (api *API) VehiclesEditHandler(w http.ResponseWriter, r *http.Request) {
 	vehicle := &shuttletracker.Vehicle{}
 	err := json.NewDecoder(r.Body).Decode(vehicle)
 	if err != nil {
-		log.WithError(err).Error("unable to decode vehicle")
+		log.WithContext(r.Context()).WithError(err).Error("unable to decode vehicle")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	name := vehicle.Name
-	enabled := vehicle.Enabled
-	trackerID := vehicle.TrackerID
+	if vehicle.Capacity < 0 {
+		http.Error(w, errNegativeCapacity.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateStyle(vehicle.Color, vehicle.Label, vehicle.Icon); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateGroupMembership(api.ms, vehicle); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changes := *vehicle
 	vehicle, err = api.ms.Vehicle(vehicle.ID)
 	if err != nil {
-		log.WithError(err).Error("unable to retrieve vehicle")
+		log.WithContext(r.Context()).WithError(err).Error("unable to retrieve vehicle")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	vehicle.Name = name
-	vehicle.Enabled = enabled
-	vehicle.TrackerID = trackerID
+	vehicle.Name = changes.Name
+	vehicle.Enabled = changes.Enabled
+	vehicle.TrackerID = changes.TrackerID
+	vehicle.Capacity = changes.Capacity
+	vehicle.WheelchairAccessible = changes.WheelchairAccessible
+	vehicle.Make = changes.Make
+	vehicle.Model = changes.Model
+	vehicle.LicensePlate = changes.LicensePlate
+	vehicle.Color = changes.Color
+	vehicle.Label = changes.Label
+	vehicle.Icon = changes.Icon
+	vehicle.GroupID = changes.GroupID
 
 	err = api.ms.ModifyVehicle(vehicle)
 	if err != nil {
-		log.WithError(err).Error("unable to modify vehicle")
+		log.WithContext(r.Context()).WithError(err).Error("unable to modify vehicle")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -86,51 +141,118 @@ func (api *API) VehiclesDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// UpdatesHandler gets the most recent update for each enabled vehicle.
+// VehicleByPlateHandler returns the vehicle with a license plate, so that
+// dispatchers can find a vehicle that someone has reported.
+func (api *API) VehicleByPlateHandler(w http.ResponseWriter, r *http.Request) {
+	vehicle, err := api.ms.VehicleWithLicensePlate(chi.URLParam(r, "plate"))
+	if err == shuttletracker.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get vehicle")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, vehicle)
+}
+
+// vehicleDataAge adds ages relative to now to a shuttletracker.VehicleDataAge.
+type vehicleDataAge struct {
+	shuttletracker.VehicleDataAge
+
+	// PositionAge is how long ago the tracker recorded its latest position, and
+	// FeedAge is how long ago the data feed last included the vehicle. Both are
+	// in seconds. If PositionAge grows while FeedAge stays small, the tracker
+	// has stopped reporting; if FeedAge grows, the data feed has.
+	PositionAge float64 `json:"position_age"`
+	FeedAge     float64 `json:"feed_age"`
+}
+
+// VehicleDataAgesHandler reports how fresh each vehicle's position in the data feed is.
+func (api *API) VehicleDataAgesHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	ages := []vehicleDataAge{}
+	for _, age := range api.updater.VehicleDataAges() {
+		ages = append(ages, vehicleDataAge{
+			VehicleDataAge: age,
+			PositionAge:    now.Sub(age.TrackerTime).Seconds(),
+			FeedAge:        now.Sub(age.Received).Seconds(),
+		})
+	}
+	WriteJSON(w, ages)
+}
+
+// StuckVehiclesHandler returns the ongoing alert for each vehicle that is on
+// its route but hasn't moved for a while, so that dispatchers can check on it.
+func (api *API) StuckVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, api.status.ongoing(shuttletracker.AlertVehicleStuck))
+}
+
+// UpdatesHandler gets the most recent update for each enabled vehicle, or
+// each one in the group_id given in the query string.
 func (api *API) UpdatesHandler(w http.ResponseWriter, r *http.Request) {
-	vehicles, err := api.ms.EnabledVehicles()
+	filter, err := parseGroupFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vehicles, err := api.ms.EnabledVehiclesContext(r.Context())
 	if err != nil {
-		log.WithError(err).Error("Unable to get enabled vehicles.")
+		log.WithContext(r.Context()).WithError(err).Error("Unable to get enabled vehicles.")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// slice of capacity len(vehicles) and size zero
 	updates := make([]*shuttletracker.Location, 0, len(vehicles))
+	now := time.Now()
 	for _, vehicle := range vehicles {
+		if !filter.MatchesVehicle(vehicle) {
+			continue
+		}
 		since := time.Now().Add(time.Minute * -5)
-		vehicleUpdates, err := api.ms.LocationsSince(vehicle.ID, since)
+		vehicleUpdates, err := api.ms.LocationsSinceContext(r.Context(), vehicle.ID, since)
 		if err != nil {
-			log.WithError(err).Error("Unable to get last vehicle update.")
+			log.WithContext(r.Context()).WithError(err).Error("Unable to get last vehicle update.")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		// if there is an update since the time, append it to all updates
-		if len(vehicleUpdates) > 0 {
+		// if there is an update since the time and it isn't on a hidden route, append it to all updates
+		if len(vehicleUpdates) > 0 && !api.visibility.hidden(vehicleUpdates[0].RouteID, now) {
+			api.occupancy.setOccupancy(vehicleUpdates[0], now)
 			updates = append(updates, vehicleUpdates[0])
 		}
 	}
 
 	// Convert updates to JSON
-	WriteJSON(w, updates) // it's good to take some REST in our server :)
+	WriteNegotiated(w, r, updates) // it's good to take some REST in our server :)
 }
 
-// HistoryHandler returns the last 30 days worth of updates for all enabled vehicles
+// HistoryHandler returns the last 30 days worth of updates for all enabled vehicles,
+// or those in the group_id given in the query string
 func (api *API) HistoryHandler(w http.ResponseWriter, r *http.Request){
-	vehicles, err := api.ms.EnabledVehicles()
+	filter, err := parseGroupFilter(r)
 	if err != nil {
-		log.WithError(err).Error("Unable to get enabled vehicles")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vehicles, err := api.ms.EnabledVehiclesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("Unable to get enabled vehicles")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	history := make([][]*shuttletracker.Location, 0, len(vehicles))
 	for _, vehicle := range vehicles {
+		if !filter.MatchesVehicle(vehicle) {
+			continue
+		}
 		since := time.Now().Add(time.Minute * -43200)
-		vehicleUpdates, err := api.ms.LocationsSince(vehicle.ID, since)
+		vehicleUpdates, err := api.ms.LocationsSinceContext(r.Context(), vehicle.ID, since)
 		if err != nil{
-			log.WithError(err).Error("Unable to get last vehicle update.")
+			log.WithContext(r.Context()).WithError(err).Error("Unable to get last vehicle update.")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi"
+	tmock "github.com/stretchr/testify/mock"
+
 	"github.com/wtg/shuttletracker"
 	"github.com/wtg/shuttletracker/mock"
 )
@@ -17,6 +21,7 @@ import (
 func TestVehiclesHandlerNoVehicles(t *testing.T) {
 	ms := &mock.ModelService{}
 	ms.VehicleService.On("Vehicles").Return([]*shuttletracker.Vehicle{}, nil)
+	ms.MaintenanceService.On("OutOfService", tmock.Anything).Return([]*shuttletracker.MaintenanceRecord{}, nil)
 
 	api := API{
 		ms: ms,
@@ -59,7 +64,7 @@ func TestVehiclesHandlerNoVehicles(t *testing.T) {
 func vehiclesEqual(first, second *shuttletracker.Vehicle) bool {
 	// ensure that we are comparing all of the fields
 	val := reflect.ValueOf(*first)
-	if val.NumField() != 6 {
+	if val.NumField() != 17 {
 		return false
 	}
 
@@ -76,6 +81,26 @@ func vehiclesEqual(first, second *shuttletracker.Vehicle) bool {
 		return false
 	} else if first.TrackerID != second.TrackerID {
 		return false
+	} else if first.Capacity != second.Capacity {
+		return false
+	} else if first.WheelchairAccessible != second.WheelchairAccessible {
+		return false
+	} else if first.Make != second.Make || first.Model != second.Model {
+		return false
+	} else if first.LicensePlate != second.LicensePlate {
+		return false
+	} else if first.OutOfService != second.OutOfService {
+		return false
+	} else if (first.OutOfServiceUntil == nil) != (second.OutOfServiceUntil == nil) {
+		return false
+	} else if first.OutOfServiceUntil != nil && !first.OutOfServiceUntil.Equal(*second.OutOfServiceUntil) {
+		return false
+	} else if first.Color != second.Color || first.Label != second.Label || first.Icon != second.Icon {
+		return false
+	} else if (first.GroupID == nil) != (second.GroupID == nil) {
+		return false
+	} else if first.GroupID != nil && *first.GroupID != *second.GroupID {
+		return false
 	}
 
 	return true
@@ -84,15 +109,22 @@ func TestVehiclesHandlerTwoVehicles(t *testing.T) {
 	ms := &mock.ModelService{}
 	vehicles := []*shuttletracker.Vehicle{
 		{
+			ID:      1,
 			Name:    "Vehicle 1",
 			Enabled: true,
 		},
 		{
+			ID:      2,
 			Name:    "Vehicle 2",
 			Enabled: true,
 		},
 	}
 	ms.VehicleService.On("Vehicles").Return(vehicles, nil)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	end := start.Add(24 * time.Hour)
+	ms.MaintenanceService.On("OutOfService", tmock.Anything).Return([]*shuttletracker.MaintenanceRecord{
+		{VehicleID: 2, OutOfServiceStart: &start, OutOfServiceEnd: &end},
+	}, nil)
 
 	api := API{
 		ms: ms,
@@ -132,6 +164,9 @@ func TestVehiclesHandlerTwoVehicles(t *testing.T) {
 			t.Errorf("got different vehicles at index %d: %+v expected %+v", i, returnedVehicles[i], vehicles[i])
 		}
 	}
+	if returnedVehicles[0].OutOfService || !returnedVehicles[1].OutOfService || !returnedVehicles[1].OutOfServiceUntil.Equal(end) {
+		t.Errorf("got %+v, expected only vehicle 2 to be out of service until %s", returnedVehicles, end)
+	}
 
 	ms.VehicleService.AssertExpectations(t)
 	ms.VehicleService.AssertNumberOfCalls(t, "Vehicles", 1)
@@ -199,11 +234,19 @@ func TestVehiclesEditHandler(t *testing.T) {
 		Created:   vehicleTime,
 	}
 	changedVehicle := &shuttletracker.Vehicle{
-		ID:        4,
-		Name:      "Vehicle 2 changed",
-		Enabled:   false,
-		TrackerID: "3",
-		Created:   vehicleTime,
+		ID:                   4,
+		Name:                 "Vehicle 2 changed",
+		Enabled:              false,
+		TrackerID:            "3",
+		Created:              vehicleTime,
+		Capacity:             40,
+		WheelchairAccessible: true,
+		Make:                 "Gillig",
+		Model:                "Low Floor",
+		LicensePlate:         "AB 1234",
+		Color:                "#1f6feb",
+		Label:                "Artic",
+		Icon:                 "articulated-bus",
 	}
 	ms.VehicleService.On("Vehicle", int64(4)).Return(existingVehicle, nil)
 
@@ -276,11 +319,82 @@ func TestVehiclesEditHandler(t *testing.T) {
 			if argVehicle.Enabled != changedVehicle.Enabled {
 				t.Error("got unexpected vehicle.Enabled value")
 			}
+			if argVehicle.Capacity != changedVehicle.Capacity || argVehicle.WheelchairAccessible != changedVehicle.WheelchairAccessible {
+				t.Error("got unexpected vehicle.Capacity or vehicle.WheelchairAccessible value")
+			}
+			if argVehicle.Make != changedVehicle.Make || argVehicle.Model != changedVehicle.Model {
+				t.Error("got unexpected vehicle.Make or vehicle.Model value")
+			}
+			if argVehicle.LicensePlate != changedVehicle.LicensePlate {
+				t.Error("got unexpected vehicle.LicensePlate value")
+			}
+			if argVehicle.Color != changedVehicle.Color || argVehicle.Label != changedVehicle.Label || argVehicle.Icon != changedVehicle.Icon {
+				t.Error("got unexpected vehicle.Color, vehicle.Label, or vehicle.Icon value")
+			}
 			break
 		}
 	}
 }
 
+func TestVehiclesEditHandlerNegativeCapacity(t *testing.T) {
+	ms := &mock.ModelService{}
+	api := API{
+		ms: ms,
+	}
+
+	body := bytes.NewBufferString(`{"id": 4, "capacity": -1}`)
+	req := httptest.NewRequest("POST", "/vehicles/edit", body)
+	w := httptest.NewRecorder()
+	api.VehiclesEditHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+	ms.VehicleService.AssertNotCalled(t, "ModifyVehicle", tmock.Anything)
+}
+
+func TestVehicleByPlateHandler(t *testing.T) {
+	ms := &mock.ModelService{}
+	vehicle := &shuttletracker.Vehicle{ID: 4, Name: "Vehicle 4", LicensePlate: "AB-1234"}
+	ms.VehicleService.On("VehicleWithLicensePlate", "ab 1234").Return(vehicle, nil)
+	ms.VehicleService.On("VehicleWithLicensePlate", "XYZ").Return((*shuttletracker.Vehicle)(nil), shuttletracker.ErrVehicleNotFound)
+	api := API{
+		ms: ms,
+	}
+
+	for plate, expected := range map[string]int{"ab 1234": http.StatusOK, "XYZ": http.StatusNotFound} {
+		req := httptest.NewRequest("GET", "/vehicles/plate/", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("plate", plate)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		api.VehicleByPlateHandler(w, req)
+
+		if w.Code != expected {
+			t.Errorf("got status code %d for %q, expected %d", w.Code, plate, expected)
+			continue
+		}
+		if expected != http.StatusOK {
+			continue
+		}
+		returned := &shuttletracker.Vehicle{}
+		if err := json.NewDecoder(w.Body).Decode(returned); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !vehiclesEqual(vehicle, returned) {
+			t.Errorf("got %+v, expected %+v", returned, vehicle)
+		}
+	}
+}
+
+func TestNormalizeLicensePlate(t *testing.T) {
+	for plate, expected := range map[string]string{"ab 1234": "AB1234", " AB-1234 ": "AB1234", "": ""} {
+		if actual := shuttletracker.NormalizeLicensePlate(plate); actual != expected {
+			t.Errorf("got %q for %q, expected %q", actual, plate, expected)
+		}
+	}
+}
+
 func TestVehiclesDeleteHandler(t *testing.T) {
 	ms := &mock.ModelService{}
 	vehicleID := int64(7)
@@ -316,3 +430,26 @@ func TestVehiclesDeleteHandler(t *testing.T) {
 	ms.VehicleService.AssertExpectations(t)
 	ms.VehicleService.AssertNumberOfCalls(t, "DeleteVehicle", 1)
 }
+
+func TestVehicleDataAgesHandler(t *testing.T) {
+	now := time.Now()
+	ups := &mock.UpdaterService{}
+	ups.On("VehicleDataAges").Return([]shuttletracker.VehicleDataAge{
+		{VehicleID: 1, TrackerTime: now.Add(-10 * time.Minute), Received: now.Add(-10 * time.Second)},
+	})
+	api := API{updater: ups}
+
+	w := httptest.NewRecorder()
+	api.VehicleDataAgesHandler(w, httptest.NewRequest("GET", "/vehicles/data-ages", nil))
+
+	var ages []vehicleDataAge
+	if err := json.NewDecoder(w.Body).Decode(&ages); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(ages) != 1 {
+		t.Fatalf("got %d ages, expected 1", len(ages))
+	}
+	if ages[0].VehicleID != 1 || ages[0].PositionAge < 600 || ages[0].FeedAge < 10 || ages[0].FeedAge > 60 {
+		t.Errorf("got %+v", ages[0])
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// routeVisibilityTTL is how long Routes are kept to check their visibility.
+// Visibility is checked for every location and ETA that's pushed out, which
+// is too often to read the Routes each time.
+const routeVisibilityTTL = 30 * time.Second
+
+// routeVisibility tells which Routes are hidden from the public by their
+// visibility intervals. A nil routeVisibility hides nothing.
+type routeVisibility struct {
+	rs shuttletracker.RouteService
+
+	lock    sync.Mutex
+	routes  map[int64]*shuttletracker.Route
+	fetched time.Time
+}
+
+func newRouteVisibility(rs shuttletracker.RouteService) *routeVisibility {
+	return &routeVisibility{rs: rs}
+}
+
+// hidden returns whether the Route with the provided ID is hidden from the
+// public at now. Vehicles that aren't on a Route are never hidden, and if
+// the Routes can't be read, nothing is hidden rather than everything.
+func (rv *routeVisibility) hidden(routeID *int64, now time.Time) bool {
+	if rv == nil || routeID == nil {
+		return false
+	}
+	rv.lock.Lock()
+	defer rv.lock.Unlock()
+	if now.Sub(rv.fetched) > routeVisibilityTTL || now.Before(rv.fetched) {
+		routes, err := rv.rs.Routes()
+		if err != nil {
+			log.WithError(err).Error("unable to get routes for visibility")
+			return false
+		}
+		rv.routes = make(map[int64]*shuttletracker.Route, len(routes))
+		for _, route := range routes {
+			rv.routes[route.ID] = route
+		}
+		rv.fetched = now
+	}
+	route, ok := rv.routes[*routeID]
+	return ok && !route.VisibleAt(now)
+}
+
+// visible returns the Routes that aren't hidden from the public at now.
+func (rv *routeVisibility) visible(routes []*shuttletracker.Route, now time.Time) []*shuttletracker.Route {
+	visible := make([]*shuttletracker.Route, 0, len(routes))
+	for _, route := range routes {
+		if !rv.hidden(&route.ID, now) {
+			visible = append(visible, route)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+// lateNightRoute is only shown from 10 PM Friday until 3 AM Saturday.
+func lateNightRoute(id int64) *shuttletracker.Route {
+	return &shuttletracker.Route{
+		ID: id,
+		Visibility: shuttletracker.RouteSchedule{{
+			StartDay:  time.Friday,
+			StartTime: time.Date(0, 1, 1, 22, 0, 0, 0, time.Local),
+			EndDay:    time.Saturday,
+			EndTime:   time.Date(0, 1, 1, 3, 0, 0, 0, time.Local),
+		}},
+	}
+}
+
+// hiddenRoute is only shown for a minute on a day other than now's.
+func hiddenRoute(id int64, now time.Time) *shuttletracker.Route {
+	otherDay := (now.Weekday() + 3) % 7
+	return &shuttletracker.Route{
+		ID: id,
+		Visibility: shuttletracker.RouteSchedule{{
+			StartDay:  otherDay,
+			StartTime: time.Date(0, 1, 1, 12, 0, 0, 0, time.Local),
+			EndDay:    otherDay,
+			EndTime:   time.Date(0, 1, 1, 12, 1, 0, 0, time.Local),
+		}},
+	}
+}
+
+func TestRouteVisibleAt(t *testing.T) {
+	route := lateNightRoute(1)
+	for _, c := range []struct {
+		t       time.Time
+		visible bool
+	}{
+		// Friday, March 1, 2019
+		{time.Date(2019, time.March, 1, 12, 0, 0, 0, time.Local), false},
+		{time.Date(2019, time.March, 1, 22, 0, 0, 0, time.Local), true},
+		{time.Date(2019, time.March, 2, 1, 30, 0, 0, time.Local), true},
+		{time.Date(2019, time.March, 2, 3, 1, 0, 0, time.Local), false},
+		{time.Date(2019, time.March, 8, 23, 0, 0, 0, time.Local), true},
+	} {
+		if visible := route.VisibleAt(c.t); visible != c.visible {
+			t.Errorf("%s: got visible %t, expected %t", c.t, visible, c.visible)
+		}
+	}
+
+	if !(&shuttletracker.Route{}).VisibleAt(time.Now()) {
+		t.Error("route without visibility intervals is hidden")
+	}
+}
+
+func TestRouteVisibilityHidden(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{lateNightRoute(1), {ID: 2}}, nil)
+	rv := newRouteVisibility(ms)
+
+	friday := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.Local)
+	one, two, unknown := int64(1), int64(2), int64(3)
+	if !rv.hidden(&one, friday) {
+		t.Error("late night route isn't hidden during the day")
+	}
+	if rv.hidden(&two, friday) || rv.hidden(&unknown, friday) || rv.hidden(nil, friday) {
+		t.Error("unexpectedly hidden")
+	}
+	// Routes are only read again once they're stale.
+	ms.RouteService.AssertNumberOfCalls(t, "Routes", 1)
+	if rv.hidden(&one, friday.Add(11*time.Hour)) {
+		t.Error("late night route is hidden at night")
+	}
+	ms.RouteService.AssertNumberOfCalls(t, "Routes", 2)
+
+	var nilVisibility *routeVisibility
+	if nilVisibility.hidden(&one, friday) {
+		t.Error("nil routeVisibility hid a route")
+	}
+}
+
+func TestRoutesHandlerHidesRoutes(t *testing.T) {
+	ms := &mock.ModelService{}
+	now := time.Now().In(time.Local)
+	hidden := &shuttletracker.Route{
+		ID: 1,
+		Visibility: shuttletracker.RouteSchedule{{
+			StartDay:  now.Weekday(),
+			StartTime: now.Add(time.Minute),
+			EndDay:    now.Weekday(),
+			EndTime:   now.Add(2 * time.Minute),
+		}},
+	}
+	if now.Add(2*time.Minute).Weekday() != now.Weekday() {
+		t.Skip("too close to midnight")
+	}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{hidden, {ID: 2}}, nil)
+	api := API{
+		ms: ms,
+	}
+
+	for _, c := range []struct {
+		handler  func(*API, *httptest.ResponseRecorder)
+		expected int
+	}{
+		{func(api *API, w *httptest.ResponseRecorder) {
+			api.RoutesHandler(w, httptest.NewRequest("GET", "/routes/", nil))
+		}, 1},
+		{func(api *API, w *httptest.ResponseRecorder) {
+			api.RoutesAllHandler(w, httptest.NewRequest("GET", "/routes/all", nil))
+		}, 2},
+	} {
+		w := httptest.NewRecorder()
+		c.handler(&api, w)
+		routes := []*shuttletracker.Route{}
+		if err := json.NewDecoder(w.Body).Decode(&routes); err != nil {
+			t.Fatalf("unable to decode routes: %s", err)
+		}
+		if len(routes) != c.expected {
+			t.Errorf("got %d routes, expected %d", len(routes), c.expected)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// walkingDetourFactor is how much farther than a straight line riders walk
+// to a Stop, since they have to follow paths and streets.
+const walkingDetourFactor = 1.3
+
+// walkingEstimator estimates how long it takes riders to walk to Stops, with
+// a routing engine if one is configured or along straight lines otherwise.
+type walkingEstimator struct {
+	// speed is in meters per second.
+	speed float64
+
+	// routerURL is the base URL of a routing engine with an OSRM-compatible
+	// table service, or empty.
+	routerURL string
+	client    *http.Client
+}
+
+func newWalkingEstimator(speed float64, routerURL string) *walkingEstimator {
+	return &walkingEstimator{
+		speed:     speed,
+		routerURL: strings.TrimSuffix(routerURL, "/"),
+		client:    &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// walkingTimes returns how long it takes to walk from a position to each
+// Stop, by Stop ID. If the routing engine can't be reached or can't find a
+// way to a Stop, the straight-line estimate is used for it.
+func (we *walkingEstimator) walkingTimes(ctx context.Context, latitude, longitude float64, stops []*shuttletracker.Stop) map[int64]time.Duration {
+	times := make(map[int64]time.Duration, len(stops))
+	for _, stop := range stops {
+		times[stop.ID] = we.straightLine(latitude, longitude, stop)
+	}
+	if we.routerURL == "" || len(stops) == 0 {
+		return times
+	}
+	routed, err := we.route(ctx, latitude, longitude, stops)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Warn("unable to get walking times from router")
+		return times
+	}
+	for id, d := range routed {
+		times[id] = d
+	}
+	return times
+}
+
+// straightLine estimates how long it takes to walk from a position to a Stop
+// from the distance between them.
+func (we *walkingEstimator) straightLine(latitude, longitude float64, stop *shuttletracker.Stop) time.Duration {
+	meters := shuttletracker.DistanceBetween(latitude, longitude, stop.Latitude, stop.Longitude) * walkingDetourFactor
+	return time.Duration(meters / we.speed * float64(time.Second))
+}
+
+// osrmTable is the part of an OSRM table service response that's used.
+type osrmTable struct {
+	Code      string       `json:"code"`
+	Durations [][]*float64 `json:"durations"`
+}
+
+// route asks the routing engine how long it takes to walk from a position to
+// each Stop in one request. Stops that it can't find a way to are left out.
+func (we *walkingEstimator) route(ctx context.Context, latitude, longitude float64, stops []*shuttletracker.Stop) (map[int64]time.Duration, error) {
+	coordinate := func(latitude, longitude float64) string {
+		return strconv.FormatFloat(longitude, 'f', 6, 64) + "," + strconv.FormatFloat(latitude, 'f', 6, 64)
+	}
+	coordinates := []string{coordinate(latitude, longitude)}
+	for _, stop := range stops {
+		coordinates = append(coordinates, coordinate(stop.Latitude, stop.Longitude))
+	}
+	u := we.routerURL + "/table/v1/foot/" + strings.Join(coordinates, ";") + "?" + url.Values{
+		"sources":     {"0"},
+		"annotations": {"duration"},
+	}.Encode()
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := we.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("router status code %d", resp.StatusCode)
+	}
+	table := osrmTable{}
+	if err := json.NewDecoder(resp.Body).Decode(&table); err != nil {
+		return nil, err
+	}
+	if table.Code != "Ok" || len(table.Durations) != 1 || len(table.Durations[0]) != len(coordinates) {
+		return nil, fmt.Errorf("unexpected router response with code %q", table.Code)
+	}
+
+	times := make(map[int64]time.Duration, len(stops))
+	for i, stop := range stops {
+		seconds := table.Durations[0][i+1]
+		if seconds == nil {
+			continue
+		}
+		times[stop.ID] = time.Duration(*seconds * float64(time.Second))
+	}
+	return times, nil
+}
+
+// parseRiderPosition reads the rider's position from the "lat" and "lng"
+// query parameters. ok is false if neither is set.
+func parseRiderPosition(r *http.Request) (latitude, longitude float64, ok bool, err error) {
+	q := r.URL.Query()
+	if q.Get("lat") == "" && q.Get("lng") == "" {
+		return 0, 0, false, nil
+	}
+	latitude, err = parseFloat(q.Get("lat"))
+	if err != nil || latitude < -90 || latitude > 90 {
+		return 0, 0, false, fmt.Errorf("lat must be a latitude")
+	}
+	longitude, err = parseFloat(q.Get("lng"))
+	if err != nil || longitude < -180 || longitude > 180 {
+		return 0, 0, false, fmt.Errorf("lng must be a longitude")
+	}
+	return latitude, longitude, true, nil
+}
+
+// walkingSeconds returns a walking time in seconds, rounded up, for responses.
+func walkingSeconds(d time.Duration) *float64 {
+	seconds := math.Ceil(d.Seconds())
+	return &seconds
+}
+
+// catchable returns whether a rider who starts walking at now and takes
+// walkingTime to get to a Stop gets there by when a shuttle does.
+func catchable(now time.Time, walkingTime time.Duration, departure time.Time) *bool {
+	ok := !now.Add(walkingTime).After(departure)
+	return &ok
+}
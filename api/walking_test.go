@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestWalkingTimesStraightLine(t *testing.T) {
+	we := newWalkingEstimator(1.3, "")
+	stops := []*shuttletracker.Stop{
+		{ID: 1, Latitude: 42.73, Longitude: -73.68},
+		// about 1000 m north
+		{ID: 2, Latitude: 42.739, Longitude: -73.68},
+	}
+	times := we.walkingTimes(context.Background(), 42.73, -73.68, stops)
+	if times[1] != 0 {
+		t.Errorf("got %s to walk nowhere", times[1])
+	}
+	// 1000 m at 1.3 m/s along paths 1.3 times as long as a straight line
+	if times[2] < 990*time.Second || times[2] > 1010*time.Second {
+		t.Errorf("got %s, expected about 1000s", times[2])
+	}
+}
+
+func TestWalkingTimesRouter(t *testing.T) {
+	var path string
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.URL.Query().Get("sources") != "0" {
+			t.Errorf("got query %s", r.URL.RawQuery)
+		}
+		// no way to the second stop
+		fmt.Fprint(w, `{"code": "Ok", "durations": [[0, 120.5, null]]}`)
+	}))
+	defer router.Close()
+
+	we := newWalkingEstimator(1.3, router.URL+"/")
+	stops := []*shuttletracker.Stop{
+		{ID: 1, Latitude: 42.73, Longitude: -73.68},
+		{ID: 2, Latitude: 42.739, Longitude: -73.68},
+	}
+	times := we.walkingTimes(context.Background(), 42.73, -73.68, stops)
+	if path != "/table/v1/foot/-73.680000,42.730000;-73.680000,42.730000;-73.680000,42.739000" {
+		t.Errorf("got path %s", path)
+	}
+	if times[1] != 120500*time.Millisecond {
+		t.Errorf("got %s, expected the router's 120.5s", times[1])
+	}
+	if times[2] < 990*time.Second || times[2] > 1010*time.Second {
+		t.Errorf("got %s, expected the straight-line estimate", times[2])
+	}
+
+	// unreachable routers fall back to straight lines
+	router.Close()
+	times = we.walkingTimes(context.Background(), 42.73, -73.68, stops)
+	if times[1] != 0 || times[2] < 990*time.Second {
+		t.Errorf("got %v, expected straight-line estimates", times)
+	}
+}
+
+func TestNextDeparturesHandlerWalking(t *testing.T) {
+	now := time.Now()
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1, Latitude: 42.739, Longitude: -73.68}, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		7: {VehicleID: 7, RouteID: 1, StopETAs: []shuttletracker.StopETA{{StopID: 1, ETA: now.Add(5 * time.Minute)}}},
+		8: {VehicleID: 8, RouteID: 1, StopETAs: []shuttletracker.StopETA{{StopID: 1, ETA: now.Add(30 * time.Minute)}}},
+	})
+	api := API{ms: ms, etaManager: em, walking: newWalkingEstimator(1.3, "")}
+
+	for _, target := range []string{"/stops/1/next-departures?lat=42.73&lng=-73.68", "/stops/1/next-departures?lat=42.73"} {
+		req := httptest.NewRequest("GET", target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		w := httptest.NewRecorder()
+		api.NextDeparturesHandler(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		if strings.HasSuffix(target, "lat=42.73") {
+			if w.Code != 400 {
+				t.Errorf("%s: got status code %d, expected 400", target, w.Code)
+			}
+			continue
+		}
+		if w.Code != 200 {
+			t.Fatalf("got status code %d: %s", w.Code, w.Body)
+		}
+		result := nextDepartures{}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("unable to decode departures: %s", err)
+		}
+		// about 1000 m away, so about 17 minutes
+		if result.WalkingTime == nil || *result.WalkingTime < 990 || *result.WalkingTime > 1010 {
+			t.Errorf("got walking time %v", result.WalkingTime)
+		}
+		if len(result.Departures) != 2 {
+			t.Fatalf("got departures %+v", result.Departures)
+		}
+		for i, expected := range []bool{false, true} {
+			if c := result.Departures[i].Catchable; c == nil || *c != expected {
+				t.Errorf("got catchable %v for %+v, expected %t", c, result.Departures[i], expected)
+			}
+		}
+	}
+}
+
+func TestETAHandlerWalking(t *testing.T) {
+	now := time.Now()
+	stopETAs := []shuttletracker.StopETA{{StopID: 1, ETA: now.Add(30 * time.Minute)}, {StopID: 2, ETA: now.Add(time.Minute)}}
+	ms := &mock.ModelService{}
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{
+		{ID: 1, Latitude: 42.739, Longitude: -73.68},
+		{ID: 2, Latitude: 42.73, Longitude: -73.68},
+	}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{7: {VehicleID: 7, StopETAs: stopETAs}})
+	api := API{ms: ms, etaManager: em, walking: newWalkingEstimator(1.3, "")}
+
+	w := httptest.NewRecorder()
+	api.ETAHandler(w, httptest.NewRequest("GET", "/eta/?lat=42.73&lng=-73.68", nil))
+	etas := map[int64]shuttletracker.VehicleETA{}
+	if err := json.NewDecoder(w.Body).Decode(&etas); err != nil {
+		t.Fatalf("unable to decode ETAs: %s", err)
+	}
+	got := etas[7].StopETAs
+	if len(got) != 2 || got[0].Catchable == nil || !*got[0].Catchable || got[1].Catchable == nil || !*got[1].Catchable {
+		t.Errorf("got %+v, expected both to be catchable", got)
+	}
+	if got[0].WalkingTime == nil || *got[0].WalkingTime < 990 || got[1].WalkingTime == nil || *got[1].WalkingTime != 0 {
+		t.Errorf("got %+v", got)
+	}
+	if stopETAs[0].WalkingTime != nil {
+		t.Error("the ETA manager's StopETAs were modified")
+	}
+}
+
+func TestParseRiderPosition(t *testing.T) {
+	for query, valid := range map[string]bool{
+		"":                       true,
+		"lat=42.73&lng=-73.68":   true,
+		"lat=42.73":              false,
+		"lat=91&lng=-73.68":      false,
+		"lat=NaN&lng=-73.68":     false,
+		"lat=42.73&lng=+Inf":     false,
+		"lat=42.73&lng=Infinity": false,
+		"lat=north&lng=-73.68":   false,
+	} {
+		_, _, _, err := parseRiderPosition(httptest.NewRequest("GET", "/eta?"+query, nil))
+		if valid && err != nil {
+			t.Errorf("%q: unexpected error: %s", query, err)
+		} else if !valid && err == nil {
+			t.Errorf("%q: expected error", query)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// widgetKeysTTL is how long WidgetKeys are kept to check widget requests,
+// which come from every visitor to every page with a widget.
+const widgetKeysTTL = 30 * time.Second
+
+// widgetCacheTTL is how long widget responses are cached. It's short
+// because they include next arrivals.
+const widgetCacheTTL = 15 * time.Second
+
+// widgetArrivals is how many next arrivals widgets get.
+const widgetArrivals = 5
+
+// domainPattern matches domain names like "rpi.edu" and "localhost".
+var domainPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// widgetEmbeds checks widget keys and caches widget responses.
+type widgetEmbeds struct {
+	wks   shuttletracker.WidgetKeyService
+	cache *responseCache
+
+	lock    sync.Mutex
+	keys    map[string]*shuttletracker.WidgetKey
+	fetched time.Time
+}
+
+func newWidgetEmbeds(wks shuttletracker.WidgetKeyService) *widgetEmbeds {
+	return &widgetEmbeds{
+		wks:   wks,
+		cache: &responseCache{store: newMemoryStore(), ttl: widgetCacheTTL, key: widgetCacheKey},
+	}
+}
+
+// widgetCacheKey caches widget responses by key and Stop only, so that
+// parameters that don't change them, like cache busters, don't fill the
+// cache.
+func widgetCacheKey(r *http.Request) string {
+	query := r.URL.Query()
+	stop := query.Get("stop_id")
+	if id, err := strconv.ParseInt(stop, 10, 64); err == nil {
+		stop = strconv.FormatInt(id, 10)
+	}
+	return "widget|" + query.Get("key") + "|" + stop
+}
+
+// key returns the WidgetKey with a key, or nil if there isn't one.
+func (we *widgetEmbeds) key(key string, now time.Time) (*shuttletracker.WidgetKey, error) {
+	we.lock.Lock()
+	defer we.lock.Unlock()
+	if now.Sub(we.fetched) > widgetKeysTTL || now.Before(we.fetched) {
+		keys, err := we.wks.WidgetKeys()
+		if err != nil {
+			return nil, err
+		}
+		we.keys = make(map[string]*shuttletracker.WidgetKey, len(keys))
+		for _, k := range keys {
+			we.keys[k.Key] = k
+		}
+		we.fetched = now
+	}
+	return we.keys[key], nil
+}
+
+// forget makes the next request read WidgetKeys again, after they're changed
+// on this instance. Other instances notice within widgetKeysTTL.
+func (we *widgetEmbeds) forget() {
+	we.lock.Lock()
+	defer we.lock.Unlock()
+	we.fetched = time.Time{}
+}
+
+// allowedHost returns whether a host is one of domains or a subdomain of one.
+func allowedHost(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// widgetAuth only lets requests with a widget key in the "key" query
+// parameter through, and only from pages on the key's domains, as told by the
+// Origin or Referer header. Browsers on those pages are allowed to read the
+// response.
+func (api *API) widgetAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k := r.URL.Query().Get("key")
+		if k == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		key, err := api.widgets.key(k, time.Now())
+		if err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("unable to get widget keys")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if key == nil {
+			http.Error(w, "Widget key not found", http.StatusForbidden)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		page := origin
+		if page == "" {
+			page = r.Header.Get("Referer")
+		}
+		u, err := url.Parse(page)
+		if page == "" || err != nil || !allowedHost(u.Host, key.Domains) {
+			http.Error(w, "widget key can't be used from this site", http.StatusForbidden)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// widgetRoute is a Route as widgets show it.
+type widgetRoute struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// widgetVehicle is a running Vehicle's latest location.
+type widgetVehicle struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	RouteID   *int64    `json:"route_id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Heading   float64   `json:"heading"`
+	Time      time.Time `json:"time"`
+}
+
+// widgetArrival is when a shuttle on a Route is next at the widget's Stop.
+type widgetArrival struct {
+	RouteID  int64     `json:"route_id"`
+	Time     time.Time `json:"time"`
+	Realtime bool      `json:"realtime"`
+}
+
+// widget is everything an embedded widget shows, kept small.
+type widget struct {
+	Generated time.Time       `json:"generated"`
+	Routes    []widgetRoute   `json:"routes"`
+	Vehicles  []widgetVehicle `json:"vehicles"`
+
+	// StopID and Arrivals are set if the widget asked for a Stop.
+	StopID   *int64          `json:"stop_id,omitempty"`
+	StopName string          `json:"stop_name,omitempty"`
+	Arrivals []widgetArrival `json:"arrivals,omitempty"`
+}
+
+// WidgetHandler returns the shown Routes, running Vehicles, and, if the
+// "stop_id" query parameter is set, the next arrivals at that Stop, for
+// embedding on other sites.
+func (api *API) WidgetHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	result := widget{Generated: now, Routes: []widgetRoute{}, Vehicles: []widgetVehicle{}}
+	if s := r.URL.Query().Get("stop_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "stop_id must be a stop's ID", http.StatusBadRequest)
+			return
+		}
+		stop, err := api.ms.Stop(id)
+		if err == shuttletracker.ErrStopNotFound {
+			http.Error(w, "Stop not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("unable to get stop")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		departures, err := api.nextDepartures(id, now, widgetArrivals)
+		if err != nil {
+			log.WithContext(r.Context()).WithError(err).Error("unable to get departures")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.StopID = &id
+		result.StopName = stopName(stop)
+		result.Arrivals = []widgetArrival{}
+		for _, d := range departures.Departures {
+			result.Arrivals = append(result.Arrivals, widgetArrival{
+				RouteID:  d.RouteID,
+				Time:     d.Time,
+				Realtime: d.Type == departureRealtime,
+			})
+		}
+	}
+
+	routes, err := api.ms.RoutesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get routes")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, route := range routes {
+		if route.Enabled && !api.visibility.hidden(&route.ID, now) {
+			result.Routes = append(result.Routes, widgetRoute{ID: route.ID, Name: route.Name, Color: route.Color})
+		}
+	}
+
+	vehicles, err := api.ms.VehiclesContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get vehicles")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byID := map[int64]*shuttletracker.Vehicle{}
+	for _, vehicle := range vehicles {
+		byID[vehicle.ID] = vehicle
+	}
+	locations, err := api.ms.LatestLocationsContext(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get locations")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, location := range locations {
+		if location.VehicleID == nil || isOffline(location, now, api.offlineAfter) || api.visibility.hidden(location.RouteID, now) {
+			continue
+		}
+		vehicle, ok := byID[*location.VehicleID]
+		if !ok || !vehicle.Enabled {
+			continue
+		}
+		result.Vehicles = append(result.Vehicles, widgetVehicle{
+			ID:        vehicle.ID,
+			Name:      vehicle.Name,
+			RouteID:   location.RouteID,
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+			Heading:   location.Heading,
+			Time:      location.Time,
+		})
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(widgetCacheTTL.Seconds())))
+	WriteJSON(w, result)
+}
+
+// WidgetKeysHandler lists every WidgetKey.
+func (api *API) WidgetKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := api.widgets.wks.WidgetKeys()
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to get widget keys")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, keys)
+}
+
+// WidgetKeysCreateHandler creates a WidgetKey with a random key for the name
+// and domains in the request body.
+func (api *API) WidgetKeysCreateHandler(w http.ResponseWriter, r *http.Request) {
+	key := &shuttletracker.WidgetKey{}
+	if err := json.NewDecoder(r.Body).Decode(key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateWidgetKey(key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to generate widget key")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key.Key = hex.EncodeToString(b)
+	if err := api.widgets.wks.CreateWidgetKey(key); err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to create widget key")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.widgets.forget()
+	WriteJSON(w, key)
+}
+
+// WidgetKeysDeleteHandler deletes the WidgetKey with the ID in the "id" query
+// parameter.
+func (api *API) WidgetKeysDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = api.widgets.wks.DeleteWidgetKey(id)
+	if err == shuttletracker.ErrWidgetKeyNotFound {
+		http.Error(w, "Widget key not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("unable to delete widget key")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.widgets.forget()
+}
+
+// validateWidgetKey checks that a WidgetKey has a name and at least one
+// domain, and lowercases its domains.
+func validateWidgetKey(key *shuttletracker.WidgetKey) error {
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(key.Domains) == 0 {
+		return fmt.Errorf("at least one domain is required")
+	}
+	for i, domain := range key.Domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if !domainPattern.MatchString(domain) {
+			return fmt.Errorf("%q is not a domain like \"rpi.edu\"", domain)
+		}
+		key.Domains[i] = domain
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestAllowedHost(t *testing.T) {
+	domains := []string{"rpi.edu", "example.com"}
+	for _, tc := range []struct {
+		host    string
+		allowed bool
+	}{
+		{"rpi.edu", true},
+		{"RPI.edu", true},
+		{"cs.rpi.edu", true},
+		{"www.cs.rpi.edu:8080", true},
+		{"example.com", true},
+		{"notrpi.edu", false},
+		{"rpi.edu.evil.com", false},
+		{"", false},
+	} {
+		if allowed := allowedHost(tc.host, domains); allowed != tc.allowed {
+			t.Errorf("%q: got %t, expected %t", tc.host, allowed, tc.allowed)
+		}
+	}
+}
+
+func TestValidateWidgetKey(t *testing.T) {
+	key := &shuttletracker.WidgetKey{Name: " Registrar ", Domains: []string{"Registrar.RPI.edu "}}
+	if err := validateWidgetKey(key); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if key.Name != "Registrar" || key.Domains[0] != "registrar.rpi.edu" {
+		t.Errorf("got %+v", key)
+	}
+
+	for _, key := range []*shuttletracker.WidgetKey{
+		{Domains: []string{"rpi.edu"}},
+		{Name: "Registrar"},
+		{Name: "Registrar", Domains: []string{"https://rpi.edu"}},
+		{Name: "Registrar", Domains: []string{"rpi.edu/"}},
+		{Name: "Registrar", Domains: []string{".rpi.edu"}},
+	} {
+		if err := validateWidgetKey(key); err == nil {
+			t.Errorf("expected error for %+v", key)
+		}
+	}
+}
+
+func TestWidgetKeyCache(t *testing.T) {
+	wks := &mock.WidgetKeyService{}
+	wks.On("WidgetKeys").Return([]*shuttletracker.WidgetKey{{ID: 1, Key: "abc"}}, nil).Once()
+	wks.On("WidgetKeys").Return([]*shuttletracker.WidgetKey{}, nil).Once()
+	wks.On("WidgetKeys").Return([]*shuttletracker.WidgetKey(nil), errors.New("database is down")).Once()
+	we := newWidgetEmbeds(wks)
+
+	now := time.Now()
+	if key, err := we.key("abc", now); err != nil || key == nil || key.ID != 1 {
+		t.Errorf("got %+v, %v", key, err)
+	}
+	if key, err := we.key("def", now.Add(widgetKeysTTL)); err != nil || key != nil {
+		t.Errorf("got %+v, %v for an unknown key", key, err)
+	}
+	we.forget()
+	if key, err := we.key("abc", now.Add(widgetKeysTTL)); err != nil || key != nil {
+		t.Errorf("got %+v, %v for a deleted key", key, err)
+	}
+	if _, err := we.key("abc", now.Add(3*widgetKeysTTL)); err == nil {
+		t.Errorf("expected error")
+	}
+	wks.AssertExpectations(t)
+}
+
+func TestWidgetHandler(t *testing.T) {
+	now := time.Now()
+	ms := &mock.ModelService{}
+	stopName := "Union"
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1, Name: &stopName}, nil)
+	ms.StopService.On("Stop", int64(2)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+		{ID: 1, Name: "East", Color: "#ff0000", Enabled: true},
+		{ID: 2, Name: "West", Color: "#0000ff"},
+	}, nil)
+	ms.ScheduleService.On("Schedules").Return([]*shuttletracker.Schedule{}, nil)
+	ms.CalendarService.On("ServicePeriods").Return([]*shuttletracker.ServicePeriod{}, nil)
+	ms.VehicleService.On("Vehicles").Return([]*shuttletracker.Vehicle{
+		{ID: 1, Name: "Bus 1", Enabled: true},
+		{ID: 2, Name: "Bus 2", Enabled: true},
+		{ID: 3, Name: "Bus 3"},
+	}, nil)
+	routeID := int64(1)
+	vehicleIDs := []int64{1, 2, 3}
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{
+		{VehicleID: &vehicleIDs[0], RouteID: &routeID, Latitude: 42.73, Longitude: -73.68, Time: now},
+		{VehicleID: &vehicleIDs[1], RouteID: &routeID, Time: now.Add(-time.Hour)},
+		{VehicleID: &vehicleIDs[2], RouteID: &routeID, Time: now},
+	}, nil)
+	em := &mock.ETAService{}
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{
+		1: {VehicleID: 1, RouteID: 1, StopETAs: []shuttletracker.StopETA{
+			{StopID: 1, ETA: now.Add(time.Minute)},
+		}},
+	})
+	wks := &mock.WidgetKeyService{}
+	wks.On("WidgetKeys").Return([]*shuttletracker.WidgetKey{
+		{ID: 1, Key: "abc", Name: "Registrar", Domains: []string{"rpi.edu"}},
+	}, nil)
+	api := API{ms: ms, etaManager: em, widgets: newWidgetEmbeds(wks), offlineAfter: 5 * time.Minute}
+	handler := api.widgetAuth(api.widgets.cache.middleware(http.HandlerFunc(api.WidgetHandler)))
+
+	get := func(query, origin, referer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/widget/?"+query, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if referer != "" {
+			req.Header.Set("Referer", referer)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tc := range []struct {
+		query, origin, referer string
+		status                 int
+	}{
+		{"", "https://registrar.rpi.edu", "", http.StatusBadRequest},
+		{"key=def", "https://registrar.rpi.edu", "", http.StatusForbidden},
+		{"key=abc", "https://example.com", "", http.StatusForbidden},
+		{"key=abc", "", "", http.StatusForbidden},
+		{"key=abc&stop_id=x", "https://registrar.rpi.edu", "", http.StatusBadRequest},
+		{"key=abc&stop_id=2", "https://registrar.rpi.edu", "", http.StatusNotFound},
+		{"key=abc", "", "https://rpi.edu/shuttles.html", http.StatusOK},
+	} {
+		if w := get(tc.query, tc.origin, tc.referer); w.Code != tc.status {
+			t.Errorf("%q from %q/%q: got status %d, expected %d", tc.query, tc.origin, tc.referer, w.Code, tc.status)
+		}
+	}
+
+	w := get("key=abc&stop_id=1", "https://registrar.rpi.edu", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://registrar.rpi.edu" {
+		t.Errorf("got Access-Control-Allow-Origin %q", origin)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=15" {
+		t.Errorf("got Cache-Control %q", cc)
+	}
+	result := widget{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unable to decode: %s", err)
+	}
+	if len(result.Routes) != 1 || result.Routes[0].Name != "East" || result.Routes[0].Color != "#ff0000" {
+		t.Errorf("got routes %+v", result.Routes)
+	}
+	if len(result.Vehicles) != 1 || result.Vehicles[0].ID != 1 || result.Vehicles[0].Latitude != 42.73 {
+		t.Errorf("got vehicles %+v", result.Vehicles)
+	}
+	if result.StopID == nil || *result.StopID != 1 || result.StopName != "Union" {
+		t.Errorf("got stop %v %q", result.StopID, result.StopName)
+	}
+	if len(result.Arrivals) != 1 || result.Arrivals[0].RouteID != 1 || !result.Arrivals[0].Realtime {
+		t.Errorf("got arrivals %+v", result.Arrivals)
+	}
+
+	// parameters that don't change the response share its cache entry
+	for _, query := range []string{"key=abc&stop_id=01&_=1", "_=2&stop_id=1&key=abc"} {
+		if w := get(query, "https://registrar.rpi.edu", ""); w.Code != http.StatusOK {
+			t.Errorf("%q: got status %d", query, w.Code)
+		}
+	}
+	ms.StopService.AssertNumberOfCalls(t, "Stop", 2)
+
+	// cached responses are still only for allowed sites
+	if w := get("key=abc&stop_id=1", "https://example.com", ""); w.Code != http.StatusForbidden {
+		t.Errorf("got status %d from another site", w.Code)
+	}
+	if w := get("key=abc&stop_id=1", "https://www.rpi.edu", ""); w.Header().Get("Access-Control-Allow-Origin") != "https://www.rpi.edu" {
+		t.Errorf("got Access-Control-Allow-Origin %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestWidgetKeysCreateHandler(t *testing.T) {
+	wks := &mock.WidgetKeyService{}
+	wks.On("CreateWidgetKey", tmock.AnythingOfType("*shuttletracker.WidgetKey")).Return(nil)
+	api := API{widgets: newWidgetEmbeds(wks)}
+
+	body, _ := json.Marshal(shuttletracker.WidgetKey{Name: "Registrar", Domains: []string{"RPI.edu"}})
+	w := httptest.NewRecorder()
+	api.WidgetKeysCreateHandler(w, httptest.NewRequest("POST", "/widget/keys/create", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	key := shuttletracker.WidgetKey{}
+	if err := json.Unmarshal(w.Body.Bytes(), &key); err != nil {
+		t.Fatalf("unable to decode: %s", err)
+	}
+	if len(key.Key) != 32 || key.Domains[0] != "rpi.edu" {
+		t.Errorf("got %+v", key)
+	}
+
+	w = httptest.NewRecorder()
+	api.WidgetKeysCreateHandler(w, httptest.NewRequest("POST", "/widget/keys/create", bytes.NewReader([]byte(`{"name":"Registrar"}`))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d without domains", w.Code)
+	}
+	wks.AssertNumberOfCalls(t, "CreateWidgetKey", 1)
+}
+
+func TestWidgetKeysDeleteHandler(t *testing.T) {
+	wks := &mock.WidgetKeyService{}
+	wks.On("DeleteWidgetKey", int64(1)).Return(nil)
+	wks.On("DeleteWidgetKey", int64(2)).Return(shuttletracker.ErrWidgetKeyNotFound)
+	api := API{widgets: newWidgetEmbeds(wks)}
+
+	for query, status := range map[string]int{
+		"id=1": http.StatusOK,
+		"id=2": http.StatusNotFound,
+		"id=x": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		api.WidgetKeysDeleteHandler(w, httptest.NewRequest("DELETE", "/widget/keys/?"+query, nil))
+		if w.Code != status {
+			t.Errorf("%s: got status %d, expected %d", query, w.Code, status)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package archive writes a snapshot of each day's locations, arrivals, and ETA
+// predictions to a directory or S3-compatible storage, so that a data
+// warehouse can load history without scraping the export endpoints.
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/export"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// checkInterval is how often Archiver looks for days that have ended and
+// haven't been archived yet.
+const checkInterval = time.Hour
+
+// doneFile is written to a day's directory after every other file, so that
+// loaders can tell a complete day from one that's still being written.
+const doneFile = "_SUCCESS"
+
+// Config configures archiving.
+type Config struct {
+	// Destination is a directory or an S3 URL with a bucket and optional
+	// prefix, e.g. "s3://warehouse/shuttletracker". Archiving is disabled
+	// if it's empty.
+	Destination string
+
+	// S3Endpoint, S3Region, S3AccessKeyID, and S3SecretAccessKey are used
+	// for S3 destinations. The endpoint can be any S3-compatible service.
+	S3Endpoint        string
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+
+	// Backfill is how many days before yesterday are archived if they
+	// haven't been, e.g. when archiving is first enabled.
+	Backfill int
+}
+
+// NewConfig creates a new Config.
+func NewConfig(v *viper.Viper) *Config {
+	cfg := &Config{
+		S3Endpoint: "https://s3.amazonaws.com",
+		S3Region:   "us-east-1",
+		Backfill:   7,
+	}
+	v.SetDefault("archive.destination", cfg.Destination)
+	v.SetDefault("archive.s3endpoint", cfg.S3Endpoint)
+	v.SetDefault("archive.s3region", cfg.S3Region)
+	v.SetDefault("archive.s3accesskeyid", cfg.S3AccessKeyID)
+	v.SetDefault("archive.s3secretaccesskey", cfg.S3SecretAccessKey)
+	v.SetDefault("archive.backfill", cfg.Backfill)
+	return cfg
+}
+
+// Archiver writes gzipped CSV files for each day once it has ended, named like
+// "2019-03-01/locations.csv.gz". Days are in the server's time zone.
+type Archiver struct {
+	ms       shuttletracker.ModelService
+	leader   shuttletracker.LeaderService
+	store    store
+	backfill int
+
+	stop chan struct{}
+}
+
+// New creates an Archiver. Only the leader archives so that multiple
+// instances don't write the same files.
+func New(cfg Config, ms shuttletracker.ModelService, leader shuttletracker.LeaderService) (*Archiver, error) {
+	if cfg.Backfill < 0 {
+		return nil, errors.New("backfill can't be negative")
+	}
+	a := &Archiver{
+		ms:       ms,
+		leader:   leader,
+		backfill: cfg.Backfill,
+		stop:     make(chan struct{}),
+	}
+	if cfg.Destination == "" {
+		return a, nil
+	}
+	var err error
+	a.store, err = newStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Run archives days as they end until Stop is called.
+func (a *Archiver) Run() {
+	if a.store == nil {
+		log.Debug("No archive destination configured.")
+		return
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		a.archive(time.Now())
+		select {
+		case <-ticker.C:
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Stop makes Run return after the file it's currently writing.
+func (a *Archiver) Stop() {
+	close(a.stop)
+}
+
+// archive writes each day that ended before now and hasn't been archived.
+func (a *Archiver) archive(now time.Time) {
+	if !a.leader.Leader() {
+		return
+	}
+	today := day(now)
+	for d := today.AddDate(0, 0, -1-a.backfill); d.Before(today); d = d.AddDate(0, 0, 1) {
+		select {
+		case <-a.stop:
+			return
+		default:
+		}
+		prefix := d.Format("2006-01-02") + "/"
+		done, err := a.store.exists(prefix + doneFile)
+		if err != nil {
+			log.WithError(err).Error("unable to check archive")
+			return
+		}
+		if done {
+			continue
+		}
+		if err := a.archiveDay(d, prefix); err != nil {
+			log.WithError(err).Errorf("unable to archive %s", d.Format("2006-01-02"))
+			return
+		}
+		log.Infof("Archived %s.", d.Format("2006-01-02"))
+	}
+}
+
+// archiveDay writes every file for the day starting at d.
+func (a *Archiver) archiveDay(d time.Time, prefix string) error {
+	filter := shuttletracker.HistoryFilter{Since: d, Until: d.AddDate(0, 0, 1)}
+	files := []struct {
+		name   string
+		header []string
+		export func(write func([]string) error) error
+	}{
+		{"locations", export.LocationHeader, func(write func([]string) error) error {
+			return a.ms.ExportLocations(filter, func(l *shuttletracker.Location) error {
+				return write(export.LocationRecord(l))
+			})
+		}},
+		{"arrivals", export.ArrivalHeader, func(write func([]string) error) error {
+			return a.ms.ExportArrivals(filter, func(arrival *shuttletracker.Arrival) error {
+				return write(export.ArrivalRecord(arrival))
+			})
+		}},
+		{"etas", export.ETAHeader, func(write func([]string) error) error {
+			return a.ms.ExportETARecords(filter, func(e *shuttletracker.ETARecord) error {
+				return write(export.ETARecord(e))
+			})
+		}},
+	}
+	for _, f := range files {
+		if err := a.writeCSV(prefix+f.name+".csv.gz", f.header, f.export); err != nil {
+			return err
+		}
+	}
+	return a.store.put(prefix+doneFile, strings.NewReader(""), 0)
+}
+
+// writeCSV writes gzipped CSV to a temporary file and then stores it, since
+// S3 needs to know its size before uploading.
+func (a *Archiver) writeCSV(key string, header []string, export func(write func([]string) error) error) error {
+	tmp, err := ioutil.TempFile("", "shuttletracker-archive-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	w := csv.NewWriter(gz)
+	if err = w.Write(header); err != nil {
+		return err
+	}
+	if err = export(w.Write); err != nil {
+		return err
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return a.store.put(key, tmp, size)
+}
+
+// day returns midnight at the start of t's day in the server's time zone.
+func day(t time.Time) time.Time {
+	t = t.In(time.Local)
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
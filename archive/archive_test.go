@@ -0,0 +1,81 @@
+package archive
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2019, time.March, 3, 1, 0, 0, 0, time.Local)
+	yesterday := time.Date(2019, time.March, 2, 0, 0, 0, 0, time.Local)
+	dayBefore := time.Date(2019, time.March, 1, 0, 0, 0, 0, time.Local)
+	// the day before yesterday was already archived
+	if err := (dirStore{dir}).put("2019-03-01/"+doneFile, strings.NewReader(""), 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	filter := shuttletracker.HistoryFilter{Since: yesterday, Until: day(now)}
+	routeID := int64(2)
+	ms := &stmock.ModelService{}
+	ms.LocationService.On("ExportLocations", filter).Return([]*shuttletracker.Location{
+		{ID: 1, TrackerID: "t", RouteID: &routeID, Latitude: 42.73, Time: yesterday, Created: yesterday},
+	}, nil)
+	ms.ArrivalService.On("ExportArrivals", filter).Return([]*shuttletracker.Arrival{}, nil)
+	ms.ETARecordService.On("ExportETARecords", filter).Return([]*shuttletracker.ETARecord{}, nil)
+	leader := &stmock.LeaderService{}
+	leader.On("Leader").Return(true)
+
+	a, err := New(Config{Destination: dir, Backfill: 1}, ms, leader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a.archive(now)
+
+	ms.LocationService.AssertNotCalled(t, "ExportLocations", shuttletracker.HistoryFilter{Since: dayBefore, Until: yesterday})
+	for _, name := range []string{"arrivals.csv.gz", "etas.csv.gz", doneFile} {
+		if _, err := os.Stat(filepath.Join(dir, "2019-03-02", name)); err != nil {
+			t.Errorf("expected %s: %s", name, err)
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, "2019-03-02", "locations.csv.gz"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "1,t,,2,42.73,") {
+		t.Errorf("got locations:\n%s", b)
+	}
+}
+
+func TestNewDisabled(t *testing.T) {
+	a, err := New(Config{}, &stmock.ModelService{}, &stmock.LeaderService{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Run returns immediately without a destination.
+	a.Run()
+	a.Stop()
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// store is somewhere that archived files can be written. Keys are paths
+// separated by slashes.
+type store interface {
+	put(key string, r io.Reader, size int64) error
+	exists(key string) (bool, error)
+}
+
+// newStore returns an S3 store if cfg.Destination is an s3:// URL, or
+// otherwise a store in that directory.
+func newStore(cfg Config) (store, error) {
+	if strings.HasPrefix(cfg.Destination, "s3://") {
+		return newS3Store(cfg)
+	}
+	return dirStore{cfg.Destination}, nil
+}
+
+// dirStore writes files in a local directory, such as a mounted network
+// filesystem.
+type dirStore struct {
+	dir string
+}
+
+// put writes to a temporary file that is renamed when it's complete, so that
+// a partial file is never at key.
+func (ds dirStore) put(key string, r io.Reader, size int64) error {
+	path := filepath.Join(ds.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (ds dirStore) exists(key string) (bool, error) {
+	_, err := os.Stat(filepath.Join(ds.dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,23 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// Arrival records a Vehicle arriving at a Stop.
+type Arrival struct {
+	ID        int64     `json:"id"`
+	VehicleID int64     `json:"vehicle_id"`
+	RouteID   int64     `json:"route_id"`
+	StopID    int64     `json:"stop_id"`
+	Time      time.Time `json:"time"`
+}
+
+// ArrivalService is an interface for interacting with Arrivals.
+type ArrivalService interface {
+	CreateArrival(arrival *Arrival) error
+
+	// ExportArrivals calls fn with each Arrival matching the filter, oldest
+	// first, without loading them all into memory.
+	ExportArrivals(filter HistoryFilter, fn func(*Arrival) error) error
+}
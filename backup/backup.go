@@ -0,0 +1,108 @@
+// Package backup exports routes, stops, and vehicles as JSON and imports
+// them, so that they can be moved between deployments.
+package backup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Version is the version of the format written by Export. Import rejects
+// other versions.
+const Version = 1
+
+// Data is everything that Export writes and Import reads.
+type Data struct {
+	Version  int                       `json:"version"`
+	Exported time.Time                 `json:"exported"`
+	Stops    []*shuttletracker.Stop    `json:"stops"`
+	Routes   []*shuttletracker.Route   `json:"routes"`
+	Vehicles []*shuttletracker.Vehicle `json:"vehicles"`
+}
+
+// ImportResult summarizes what an import created.
+type ImportResult struct {
+	Stops    []*shuttletracker.Stop
+	Routes   []*shuttletracker.Route
+	Vehicles []*shuttletracker.Vehicle
+
+	// SkippedVehicles have tracker IDs that already belong to a vehicle.
+	SkippedVehicles []*shuttletracker.Vehicle
+}
+
+// Export returns every route, stop, and vehicle.
+func Export(ms shuttletracker.ModelService) (*Data, error) {
+	stops, err := ms.Stops()
+	if err != nil {
+		return nil, err
+	}
+	routes, err := ms.Routes()
+	if err != nil {
+		return nil, err
+	}
+	vehicles, err := ms.Vehicles()
+	if err != nil {
+		return nil, err
+	}
+	return &Data{
+		Version:  Version,
+		Exported: time.Now(),
+		Stops:    stops,
+		Routes:   routes,
+		Vehicles: vehicles,
+	}, nil
+}
+
+// Import creates everything in data. Stops and routes get new IDs, and each
+// route's stops are updated to match. Vehicles are skipped if their tracker
+// ID is already in use, so importing the same data twice doesn't duplicate
+// vehicles. Anything created before an error isn't removed.
+func Import(data *Data, ms shuttletracker.ModelService) (*ImportResult, error) {
+	if data.Version != Version {
+		return nil, fmt.Errorf("unsupported version %d; expected %d", data.Version, Version)
+	}
+	result := &ImportResult{}
+
+	stopIDs := map[int64]int64{}
+	for _, stop := range data.Stops {
+		oldID := stop.ID
+		if err := ms.CreateStop(stop); err != nil {
+			return result, err
+		}
+		stopIDs[oldID] = stop.ID
+		result.Stops = append(result.Stops, stop)
+	}
+
+	for _, route := range data.Routes {
+		for i, oldID := range route.StopIDs {
+			id, ok := stopIDs[oldID]
+			if !ok {
+				return result, fmt.Errorf("route %q has stop %d, which isn't in the import", route.Name, oldID)
+			}
+			route.StopIDs[i] = id
+		}
+		if err := ms.CreateRoute(route); err != nil {
+			return result, err
+		}
+		result.Routes = append(result.Routes, route)
+	}
+
+	for _, vehicle := range data.Vehicles {
+		_, err := ms.VehicleWithTrackerID(vehicle.TrackerID)
+		if err == nil {
+			result.SkippedVehicles = append(result.SkippedVehicles, vehicle)
+			continue
+		}
+		if err != shuttletracker.ErrVehicleNotFound {
+			return result, err
+		}
+		if err := ms.CreateVehicle(vehicle); err != nil {
+			return result, err
+		}
+		result.Vehicles = append(result.Vehicles, vehicle)
+	}
+
+	return result, nil
+}
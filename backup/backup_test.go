@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"testing"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestImport(t *testing.T) {
+	data := &Data{
+		Version: Version,
+		Stops:   []*shuttletracker.Stop{{ID: 10}, {ID: 20}},
+		Routes:  []*shuttletracker.Route{{ID: 5, Name: "West", StopIDs: []int64{20, 10, 20}}},
+		Vehicles: []*shuttletracker.Vehicle{
+			{ID: 1, Name: "Bus 1", TrackerID: "1111"},
+			{ID: 2, Name: "Bus 2", TrackerID: "2222"},
+		},
+	}
+
+	ms := &mock.ModelService{}
+	nextID := int64(100)
+	ms.StopService.On("CreateStop", tmock.AnythingOfType("*shuttletracker.Stop")).Return(nil).Run(func(args tmock.Arguments) {
+		args.Get(0).(*shuttletracker.Stop).ID = nextID
+		nextID++
+	})
+	ms.RouteService.On("CreateRoute", tmock.AnythingOfType("*shuttletracker.Route")).Return(nil)
+	ms.VehicleService.On("VehicleWithTrackerID", "1111").Return(&shuttletracker.Vehicle{ID: 7}, nil)
+	ms.VehicleService.On("VehicleWithTrackerID", "2222").Return((*shuttletracker.Vehicle)(nil), shuttletracker.ErrVehicleNotFound)
+	ms.VehicleService.On("CreateVehicle", tmock.AnythingOfType("*shuttletracker.Vehicle")).Return(nil)
+
+	result, err := Import(data, ms)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ms.StopService.AssertNumberOfCalls(t, "CreateStop", 2)
+	ms.VehicleService.AssertNumberOfCalls(t, "CreateVehicle", 1)
+
+	stopIDs := result.Routes[0].StopIDs
+	if len(stopIDs) != 3 || stopIDs[0] != 101 || stopIDs[1] != 100 || stopIDs[2] != 101 {
+		t.Errorf("got stop IDs %v, expected [101 100 101]", stopIDs)
+	}
+	if len(result.Vehicles) != 1 || result.Vehicles[0].TrackerID != "2222" {
+		t.Errorf("got vehicles %+v", result.Vehicles)
+	}
+	if len(result.SkippedVehicles) != 1 || result.SkippedVehicles[0].TrackerID != "1111" {
+		t.Errorf("got skipped vehicles %+v", result.SkippedVehicles)
+	}
+}
+
+func TestImportUnknownStop(t *testing.T) {
+	data := &Data{
+		Version: Version,
+		Routes:  []*shuttletracker.Route{{Name: "West", StopIDs: []int64{3}}},
+	}
+	ms := &mock.ModelService{}
+	if _, err := Import(data, ms); err == nil {
+		t.Error("expected error for route with unknown stop")
+	}
+	ms.RouteService.AssertNotCalled(t, "CreateRoute", tmock.Anything)
+}
+
+func TestImportVersion(t *testing.T) {
+	if _, err := Import(&Data{Version: Version + 1}, &mock.ModelService{}); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+}
@@ -0,0 +1,243 @@
+package shuttletracker
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Types of ServicePeriods.
+const (
+	// ServicePeriodSemester is when usual service runs. If there are any
+	// semesters, there's no service on days outside of them.
+	ServicePeriodSemester = "semester"
+
+	// ServicePeriodHoliday is when there's no service at all.
+	ServicePeriodHoliday = "holiday"
+
+	// ServicePeriodReduced is when only some Schedules run, like during a
+	// break.
+	ServicePeriodReduced = "reduced"
+)
+
+// DateFormat is the format of dates in ServicePeriods.
+const DateFormat = "2006-01-02"
+
+// ServicePeriod is a range of days when service differs from other days.
+type ServicePeriod struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Start and End are the first and last days of the period, like
+	// "2019-01-07", in the server's time zone.
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	// ScheduleIDs are the Schedules that run during a reduced-service period.
+	ScheduleIDs []int64 `json:"schedule_ids"`
+}
+
+// Contains returns whether day is in the ServicePeriod.
+func (sp *ServicePeriod) Contains(day time.Time) bool {
+	d := day.Format(DateFormat)
+	return sp.Start <= d && d <= sp.End
+}
+
+// Calendar is every ServicePeriod. It decides which days have service and
+// which Schedules run on them.
+type Calendar []*ServicePeriod
+
+// Period returns the holiday or reduced-service period that day is in, if
+// any. Holidays take precedence.
+func (c Calendar) Period(day time.Time) *ServicePeriod {
+	var reduced *ServicePeriod
+	for _, p := range c {
+		if !p.Contains(day) {
+			continue
+		}
+		switch p.Type {
+		case ServicePeriodHoliday:
+			return p
+		case ServicePeriodReduced:
+			reduced = p
+		}
+	}
+	return reduced
+}
+
+// InSemester returns whether day is in a semester, or true if no semesters
+// are defined.
+func (c Calendar) InSemester(day time.Time) bool {
+	found := false
+	for _, p := range c {
+		if p.Type != ServicePeriodSemester {
+			continue
+		}
+		if p.Contains(day) {
+			return true
+		}
+		found = true
+	}
+	return !found
+}
+
+// Runs returns whether schedule runs on day. Schedules run on their days of
+// the week during semesters, except on holidays. During reduced service,
+// only the period's Schedules run, on their days of the week, whether or
+// not it's during a semester.
+func (c Calendar) Runs(schedule *Schedule, day time.Time) bool {
+	if !schedule.RunsOn(day) {
+		return false
+	}
+	if p := c.Period(day); p != nil {
+		if p.Type == ServicePeriodHoliday {
+			return false
+		}
+		for _, id := range p.ScheduleIDs {
+			if id == schedule.ID {
+				return true
+			}
+		}
+		return false
+	}
+	return c.InSemester(day)
+}
+
+// RouteRuns returns whether a Route has any service on day. Without any
+// Schedules, a Route runs on every day that isn't a holiday, outside of a
+// semester, or in a reduced-service period that doesn't include it. With
+// Schedules, it runs when one of them does.
+func (c Calendar) RouteRuns(routeID int64, schedules []*Schedule, day time.Time) bool {
+	has := false
+	for _, s := range schedules {
+		if s.RouteID != routeID {
+			continue
+		}
+		if c.Runs(s, day) {
+			return true
+		}
+		has = true
+	}
+	if has {
+		return false
+	}
+	if p := c.Period(day); p != nil {
+		return false
+	}
+	return c.InSemester(day)
+}
+
+// Departure is when a scheduled Trip is planned to leave a Stop.
+type Departure struct {
+	Time       time.Time `json:"time"`
+	RouteID    int64     `json:"route_id"`
+	ScheduleID int64     `json:"schedule_id"`
+	TripID     int64     `json:"trip_id"`
+	Direction  string    `json:"direction"`
+}
+
+// Departures returns the Departures from a Stop from since (inclusive) until
+// until (exclusive) by Trips that run according to the Calendar, in order.
+// Trips don't depart from their last Stop.
+func (c Calendar) Departures(schedules []*Schedule, stopID int64, since, until time.Time) []Departure {
+	departures := []Departure{}
+	y, m, d := since.Date()
+	// Trips that started the day before may run past midnight.
+	for day := time.Date(y, m, d-1, 0, 0, 0, 0, since.Location()); day.Before(until); day = day.AddDate(0, 0, 1) {
+		for _, s := range schedules {
+			if !c.Runs(s, day) {
+				continue
+			}
+			for _, trip := range s.Trips {
+				for i, st := range trip.StopTimes {
+					if st.StopID != stopID || i == len(trip.StopTimes)-1 {
+						continue
+					}
+					t := st.Departure.On(day)
+					if t.Before(since) || !t.Before(until) {
+						continue
+					}
+					departures = append(departures, Departure{
+						Time:       t,
+						RouteID:    s.RouteID,
+						ScheduleID: s.ID,
+						TripID:     trip.ID,
+						Direction:  trip.Direction,
+					})
+				}
+			}
+		}
+	}
+	sort.SliceStable(departures, func(i, j int) bool {
+		return departures[i].Time.Before(departures[j].Time)
+	})
+	return departures
+}
+
+// Ride is a scheduled Trip from one Stop to another: its Departure from the
+// first and when it's planned to arrive at the second.
+type Ride struct {
+	Departure
+	Arrival time.Time `json:"arrival"`
+}
+
+// Rides returns the Rides from one Stop to another that depart from since
+// (inclusive) until until (exclusive) by Trips that run according to the
+// Calendar, in order of departure. A Trip that visits the first Stop more
+// than once, like a loop, has a Ride from each visit to the next visit to the
+// second Stop.
+func (c Calendar) Rides(schedules []*Schedule, fromStopID, toStopID int64, since, until time.Time) []Ride {
+	rides := []Ride{}
+	y, m, d := since.Date()
+	// Trips that started the day before may run past midnight.
+	for day := time.Date(y, m, d-1, 0, 0, 0, 0, since.Location()); day.Before(until); day = day.AddDate(0, 0, 1) {
+		for _, s := range schedules {
+			if !c.Runs(s, day) {
+				continue
+			}
+			for _, trip := range s.Trips {
+				for i, st := range trip.StopTimes {
+					if st.StopID != fromStopID {
+						continue
+					}
+					t := st.Departure.On(day)
+					if t.Before(since) || !t.Before(until) {
+						continue
+					}
+					for _, next := range trip.StopTimes[i+1:] {
+						if next.StopID != toStopID {
+							continue
+						}
+						rides = append(rides, Ride{
+							Departure: Departure{
+								Time:       t,
+								RouteID:    s.RouteID,
+								ScheduleID: s.ID,
+								TripID:     trip.ID,
+								Direction:  trip.Direction,
+							},
+							Arrival: next.Arrival.On(day),
+						})
+						break
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(rides, func(i, j int) bool {
+		return rides[i].Time.Before(rides[j].Time)
+	})
+	return rides
+}
+
+// CalendarService is an interface for interacting with ServicePeriods.
+type CalendarService interface {
+	ServicePeriods() ([]*ServicePeriod, error)
+	CreateServicePeriod(period *ServicePeriod) error
+	ModifyServicePeriod(period *ServicePeriod) error
+	DeleteServicePeriod(id int64) error
+}
+
+// ErrServicePeriodNotFound indicates that a ServicePeriod is not in the service.
+var ErrServicePeriodNotFound = errors.New("Service period not found")
@@ -0,0 +1,16 @@
+package shuttletracker
+
+// LeaderService elects one of possibly many running instances to do work that
+// must only happen once, like storing locations from the data feed or sending
+// alerts.
+type LeaderService interface {
+	// Leader reports whether this instance is currently the leader.
+	Leader() bool
+}
+
+// BroadcastService sends messages to every running instance, including the
+// one that sent them. It is used to keep process-local state consistent.
+type BroadcastService interface {
+	Broadcast(channel, payload string) error
+	SubscribeBroadcasts(channel string) chan string
+}
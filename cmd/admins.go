@@ -21,6 +21,7 @@ var Remove bool
 func init() {
 	adminsCmd.Flags().BoolVar(&Add, "add", false, "add administrator")
 	adminsCmd.Flags().BoolVar(&Remove, "remove", false, "remove administrator")
+	config.AddFlags(adminsCmd.Flags())
 
 	rootCmd.AddCommand(adminsCmd)
 }
@@ -29,6 +30,8 @@ var adminsCmd = &cobra.Command{
 	Use:   "admins",
 	Short: "Manage Shuttle Tracker administrators",
 	Long:  "List, add, or remove Shuttle Tracker administrators by RCS ID.",
+	// admins is kept so that existing scripts keep working.
+	Deprecated: "use \"shuttletracker user\" instead.",
 	Args: func(cms *cobra.Command, args []string) error {
 		if (Add || Remove) && len(args) != 1 {
 			return errors.New("expects exactly one argument")
@@ -42,9 +45,9 @@ var adminsCmd = &cobra.Command{
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
+		cfg, err := config.New(cmd.Flags())
 		if err != nil {
-			_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration.")
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration:", err)
 			os.Exit(1)
 		}
 
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/backup"
+	"github.com/wtg/shuttletracker/config"
+	"github.com/wtg/shuttletracker/postgres"
+)
+
+func init() {
+	config.AddFlags(exportCmd.Flags())
+	config.AddFlags(importCmd.Flags())
+	rootCmd.AddCommand(exportCmd, importCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [FILE]",
+	Short: "Export routes, stops, and vehicles as JSON",
+	Long:  "Write every route, stop, and vehicle to FILE, or to standard output if FILE is omitted or \"-\", so that they can be imported into another deployment.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := backup.Export(modelService(cmd))
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to export:", err)
+			os.Exit(1)
+		}
+
+		var w io.Writer = os.Stdout
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Create(args[0])
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to create file:", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to write export:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "Import routes, stops, and vehicles from JSON",
+	Long:  "Create the routes, stops, and vehicles in FILE, which was written by export. Use \"-\" to read from standard input. Vehicles whose tracker IDs are already in use are skipped.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to open file:", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			r = f
+		}
+		data := &backup.Data{}
+		if err := json.NewDecoder(r).Decode(data); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to read export:", err)
+			os.Exit(1)
+		}
+
+		result, err := backup.Import(data, modelService(cmd))
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to import:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %d stops, %d routes, and %d vehicles.\n", len(result.Stops), len(result.Routes), len(result.Vehicles))
+		for _, vehicle := range result.SkippedVehicles {
+			fmt.Printf("Skipped vehicle %q; tracker %s is already in use.\n", vehicle.Name, vehicle.TrackerID)
+		}
+	},
+}
+
+// modelService connects to Postgres or exits.
+func modelService(cmd *cobra.Command) shuttletracker.ModelService {
+	cfg, err := config.New(cmd.Flags())
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration:", err)
+		os.Exit(1)
+	}
+	pg, err := postgres.New(*cfg.Postgres)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to connect to Postgres:", err)
+		os.Exit(1)
+	}
+	return pg
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker/config"
+	"github.com/wtg/shuttletracker/gtfs"
+	"github.com/wtg/shuttletracker/postgres"
+)
+
+func init() {
+	config.AddFlags(importGTFSCmd.Flags())
+	rootCmd.AddCommand(importGTFSCmd)
+}
+
+var importGTFSCmd = &cobra.Command{
+	Use:   "import-gtfs FILE",
+	Short: "Import routes and stops from a GTFS feed",
+	Long:  "Create routes, stops, and route schedules from a zipped static GTFS feed. Imported routes are disabled until enabled by an administrator.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.New(cmd.Flags())
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration:", err)
+			os.Exit(1)
+		}
+
+		zr, err := zip.OpenReader(args[0])
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to open GTFS feed:", err)
+			os.Exit(1)
+		}
+		defer zr.Close()
+
+		feed, err := gtfs.Parse(&zr.Reader)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to parse GTFS feed:", err)
+			os.Exit(1)
+		}
+
+		pg, err := postgres.New(*cfg.Postgres)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to connect to Postgres:", err)
+			os.Exit(1)
+		}
+
+		result, err := gtfs.Import(feed, pg)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to import GTFS feed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %d routes and %d stops.\n", len(result.Routes), len(result.Stops))
+	},
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker/loadtest"
+)
+
+var loadtestCfg = loadtest.Config{}
+
+func init() {
+	flags := loadtestCmd.Flags()
+	flags.IntVar(&loadtestCfg.Subscribers, "subscribers", 100, "number of websocket clients subscribed to vehicle locations")
+	flags.IntVar(&loadtestCfg.Pollers, "pollers", 10, "number of clients polling REST endpoints")
+	flags.DurationVar(&loadtestCfg.PollInterval, "interval", 5*time.Second, "how often each poller makes a request")
+	flags.StringSliceVar(&loadtestCfg.Paths, "paths", []string{"/vehicles", "/updates", "/routes", "/stops", "/eta"}, "paths requested by pollers")
+	flags.DurationVar(&loadtestCfg.Duration, "duration", time.Minute, "how long to generate load")
+
+	rootCmd.AddCommand(loadtestCmd)
+}
+
+var loadtestCmd = &cobra.Command{
+	Use:   "loadtest URL",
+	Short: "Simulate clients against a Shuttle Tracker instance",
+	Long:  "Connect websocket subscribers and REST pollers to the Shuttle Tracker instance at URL, then report latency percentiles.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		loadtestCfg.Target = args[0]
+		fmt.Printf("Running %d subscribers and %d pollers against %s for %s...\n",
+			loadtestCfg.Subscribers, loadtestCfg.Pollers, loadtestCfg.Target, loadtestCfg.Duration)
+
+		report, err := loadtest.Run(context.Background(), loadtestCfg)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to run load test:", err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		_, _ = fmt.Fprintln(w, "\tcount\terrors\tp50\tp90\tp99\tmax\t")
+		printSummary(w, "websocket connect", report.Connect)
+		printSummary(w, "websocket subscribe", report.Subscribe)
+		printSummary(w, "websocket delivery", report.Delivery)
+		paths := make([]string, 0, len(report.Poll))
+		for path := range report.Poll {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			printSummary(w, "GET "+path, report.Poll[path])
+		}
+		_ = w.Flush()
+	},
+}
+
+func printSummary(w *tabwriter.Writer, name string, s loadtest.Summary) {
+	_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t\n", name, s.Count, s.Errors,
+		s.P50.Round(time.Millisecond), s.P90.Round(time.Millisecond), s.P99.Round(time.Millisecond), s.Max.Round(time.Millisecond))
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker/config"
+	"github.com/wtg/shuttletracker/postgres"
+)
+
+func init() {
+	config.AddFlags(migrateCmd.Flags())
+	rootCmd.AddCommand(migrateCmd)
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Bring the database schema up to date",
+	Long: "Create and update database tables, then exit. serve does this too when it starts, " +
+		"but running migrate first lets a deploy fail before any instance is replaced.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.New(cmd.Flags())
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration:", err)
+			os.Exit(1)
+		}
+
+		pg, err := postgres.New(*cfg.Postgres)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to migrate database:", err)
+			os.Exit(1)
+		}
+		if err := pg.Close(); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to close database:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Database schema is up to date.")
+	},
+}
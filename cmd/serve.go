@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kochman/runner"
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/alerts"
+	"github.com/wtg/shuttletracker/analytics"
+	"github.com/wtg/shuttletracker/api"
+	"github.com/wtg/shuttletracker/archive"
+	"github.com/wtg/shuttletracker/config"
+	"github.com/wtg/shuttletracker/eta"
+	"github.com/wtg/shuttletracker/events"
+	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/mqtt"
+	"github.com/wtg/shuttletracker/postgres"
+	"github.com/wtg/shuttletracker/spoofer"
+	"github.com/wtg/shuttletracker/tracing"
+	"github.com/wtg/shuttletracker/updater"
+)
+
+func init() {
+	config.AddFlags(serveCmd.Flags())
+	rootCmd.AddCommand(serveCmd)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the server",
+	Long:  "Track vehicles, calculate ETAs, and serve the website and API until SIGINT or SIGTERM is received. SIGHUP reloads settings that can change while running.",
+	Args:  cobra.NoArgs,
+	Run:   serve,
+}
+
+// serve runs every subsystem until a signal is received.
+func serve(cmd *cobra.Command, args []string) {
+	log.Info("Shuttle Tracker starting...")
+
+	// Config
+	cfg, err := config.New(cmd.Flags())
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration:", err)
+		os.Exit(1)
+	}
+	defer log.Flush(5 * time.Second)
+
+	stopTracing, err := tracing.Start(*cfg.Tracing)
+	if err != nil {
+		log.WithError(err).Error("unable to start tracing")
+		return
+	}
+	defer func() {
+		if err := stopTracing(context.Background()); err != nil {
+			log.WithError(err).Error("unable to flush traces")
+		}
+	}()
+
+	runner := runner.New()
+
+	pg, err := postgres.New(*cfg.Postgres)
+	if err != nil {
+		log.WithError(err).Error("unable to create Postgres")
+		return
+	}
+
+	// Model service
+	var ms shuttletracker.ModelService = pg
+
+	// Message service
+	var msg shuttletracker.MessageService = pg
+
+	// User service
+	var us shuttletracker.UserService = pg
+
+	// User service
+	var fdb shuttletracker.FeedbackService = pg
+
+	// Usage service
+	var uss shuttletracker.UsageService = pg
+
+	// Analytics service
+	var ans shuttletracker.AnalyticsService = pg
+
+	// Favorite service
+	var fs shuttletracker.FavoriteService = pg
+
+	// Widget key service
+	var wks shuttletracker.WidgetKeyService = pg
+
+	// Coordination between multiple instances
+	var leader shuttletracker.LeaderService = pg
+	var bs shuttletracker.BroadcastService = pg
+
+	// Make spoofer
+	spoofer, err := spoofer.New(*cfg.Spoofer, ms)
+	if err != nil {
+		log.WithError(err).Error("Could not create spoofer.")
+		return
+	}
+	runner.Add(spoofer)
+
+	// Make shuttle position updater
+	updater, err := updater.New(*cfg.Updater, ms, spoofer, leader)
+	if err != nil {
+		log.WithError(err).Error("Could not create updater.")
+		return
+	}
+	runner.Add(updater)
+
+	etaManager, err := eta.NewManager(ms)
+	if err != nil {
+		log.WithError(err).Error("unable to create ETA manager")
+		return
+	}
+	runner.Add(etaManager)
+
+	// Save arrivals and predictions for later analysis
+	recorder := eta.NewRecorder(ms, etaManager, leader)
+	runner.Add(recorder)
+
+	// Make operational alert manager
+	alertManager, err := alerts.New(*cfg.Alerts, ms, updater, leader)
+	if err != nil {
+		log.WithError(err).Error("unable to create alert manager")
+		return
+	}
+	runner.Add(alertManager)
+
+	// Summarize history for planners
+	densityAggregator, err := analytics.NewDensityAggregator(*cfg.Analytics, ms, ans, leader)
+	if err != nil {
+		log.WithError(err).Error("unable to create density aggregator")
+		return
+	}
+	runner.Add(densityAggregator)
+	mileageCalculator := analytics.NewMileageCalculator(ms, ans, leader)
+	runner.Add(mileageCalculator)
+	loopTimeCalculator := analytics.NewLoopTimeCalculator(ms, ans, leader)
+	runner.Add(loopTimeCalculator)
+
+	// Write each day's history for the data warehouse
+	archiver, err := archive.New(*cfg.Archive, ms, leader)
+	if err != nil {
+		log.WithError(err).Error("unable to create archiver")
+		return
+	}
+	runner.Add(archiver)
+
+	// Make MQTT publisher
+	mqttPublisher, err := mqtt.New(*cfg.MQTT, ms, etaManager, leader)
+	if err != nil {
+		log.WithError(err).Error("unable to create MQTT publisher")
+		return
+	}
+	runner.Add(mqttPublisher)
+
+	// Make event stream publisher
+	eventBus, err := events.New(*cfg.Events, ms, etaManager, alertManager, leader)
+	if err != nil {
+		log.WithError(err).Error("unable to create event bus")
+		return
+	}
+	runner.Add(eventBus)
+
+	// Make API server
+	api, err := api.New(*cfg.API, ms, msg, us, updater, etaManager, fdb, bs, alertManager, uss, ans, fs, wks)
+	if err != nil {
+		log.WithError(err).Error("Could not create API server.")
+		return
+	}
+	runner.Add(api)
+
+	// Stop gracefully on SIGINT or SIGTERM, in this order. The API stops
+	// first so that requests in progress can still use everything else.
+	stoppers := []interface{ Stop() }{api, updater, spoofer, alertManager, mqttPublisher, eventBus, recorder, densityAggregator, mileageCalculator, loopTimeCalculator, archiver, etaManager}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		log.Infof("Received %s; shutting down. Send it again to exit immediately.", <-signals)
+		go func() {
+			<-signals
+			os.Exit(1)
+		}()
+		for _, s := range stoppers {
+			s.Stop()
+		}
+	}()
+
+	// Apply settings that can change while running on SIGHUP.
+	config.OnReload(func(cfg *config.Config) error {
+		return updater.Reload(*cfg.Updater)
+	})
+	config.OnReload(func(cfg *config.Config) error {
+		return alertManager.Reload(*cfg.Alerts)
+	})
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := config.Reload(cmd.Flags()); err != nil {
+				log.WithError(err).Error("unable to reload configuration")
+				continue
+			}
+			log.Info("Reloaded configuration.")
+		}
+	}()
+
+	// Run all runnables until they've stopped
+	runner.Run()
+
+	if err := pg.Close(); err != nil {
+		log.WithError(err).Error("unable to close Postgres")
+	}
+	log.Info("Shuttle Tracker stopped.")
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/config"
+	"github.com/wtg/shuttletracker/postgres"
+)
+
+func init() {
+	config.AddFlags(userCmd.PersistentFlags())
+	userCmd.AddCommand(userAddCmd, userRemoveCmd, userListCmd)
+	rootCmd.AddCommand(userCmd)
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage Shuttle Tracker administrators",
+	Long:  "List, add, or remove the users, identified by RCS ID, who can log in to the admin interface.",
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add RCS_ID",
+	Short: "Add an administrator",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		us := userService(cmd)
+		// CAS usernames are compared in lowercase.
+		username := strings.ToLower(args[0])
+		if err := us.CreateUser(&shuttletracker.User{Username: username}); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to add admin:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Added %s.\n", username)
+	},
+}
+
+var userRemoveCmd = &cobra.Command{
+	Use:   "remove RCS_ID",
+	Short: "Remove an administrator",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		us := userService(cmd)
+		username := strings.ToLower(args[0])
+		if err := us.DeleteUser(username); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to remove admin:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %s.\n", username)
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List administrators",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		users, err := userService(cmd).Users()
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to get users:", err)
+			os.Exit(1)
+		}
+		if len(users) == 0 {
+			fmt.Println("No Shuttle Tracker administrators.")
+			return
+		}
+		for _, user := range users {
+			fmt.Println(user.Username)
+		}
+	},
+}
+
+// userService connects to Postgres or exits.
+func userService(cmd *cobra.Command) shuttletracker.UserService {
+	cfg, err := config.New(cmd.Flags())
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration:", err)
+		os.Exit(1)
+	}
+	pg, err := postgres.New(*cfg.Postgres)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to connect to Postgres:", err)
+		os.Exit(1)
+	}
+	return pg
+}
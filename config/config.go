@@ -1,40 +1,94 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"sort"
 	"strings"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/wtg/shuttletracker/alerts"
+	"github.com/wtg/shuttletracker/analytics"
 	"github.com/wtg/shuttletracker/api"
+	"github.com/wtg/shuttletracker/archive"
+	"github.com/wtg/shuttletracker/events"
+	"github.com/wtg/shuttletracker/flags"
 	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/mqtt"
 	"github.com/wtg/shuttletracker/postgres"
 	"github.com/wtg/shuttletracker/spoofer"
+	"github.com/wtg/shuttletracker/tracing"
 	"github.com/wtg/shuttletracker/updater"
 )
 
-// Config is the global configuration struct.
+// configFlag is the flag that sets the path of the config file.
+const configFlag = "config"
+
+// twelveFactorKey is the setting that enables twelve-factor mode.
+const twelveFactorKey = "twelvefactor"
+
+// Config is the global configuration struct. Most of its fields are the
+// configuration for one subsystem, and each setting is named by the
+// subsystem and field, e.g. API.ListenURL. Every setting can be set in the
+// config file, by an environment variable (API_LISTENURL), or by a
+// command-line flag (--api.listenurl), in increasing order of precedence.
+// Settings that are maps or structs can only be set in the config file.
 type Config struct {
-	Updater  *updater.Config
-	API      *api.Config
-	Log      *log.Config
+	// TwelveFactor reads settings only from the environment and flags, logs
+	// JSON to stdout, and serves the frontend embedded in the binary, so
+	// that Shuttle Tracker can run in a container without any files. PORT,
+	// if it's set, is the default port to listen on.
+	TwelveFactor bool
+
+	// Updater fetches vehicle locations from the iTRAK data feed.
+	Updater *updater.Config
+	// API serves the website, JSON, and realtime feeds.
+	API *api.Config
+	// Log sets the log level and format and where errors are reported.
+	Log *log.Config
+	// Postgres is where everything is stored.
 	Postgres *postgres.Config
-	Spoofer  *spoofer.Config
+	// Spoofer replays recorded locations instead of using the data feed.
+	Spoofer *spoofer.Config
+	// Alerts posts operational problems to Slack or Discord.
+	Alerts *alerts.Config
+	// MQTT publishes vehicle locations and ETAs to an MQTT broker.
+	MQTT *mqtt.Config
+	// Events publishes vehicle locations, ETAs, and alerts to Kafka or NATS.
+	Events *events.Config
+	// Tracing sends OpenTelemetry traces to a collector.
+	Tracing *tracing.Config
+	// Flags enables experimental behavior for a percentage of clients.
+	Flags *flags.Config
+	// Analytics summarizes history for planners.
+	Analytics *analytics.Config
+	// Archive writes each day's history to a directory or S3.
+	Archive *archive.Config
 }
 
-// New creates a new, global Config. Reads in configuration from config files.
-func New() (*Config, error) {
-	cfg := &Config{}
-
+// newViper creates a viper that reads from the environment and knows every
+// subsystem's settings and their defaults.
+func newViper(cfg *Config) (*viper.Viper, error) {
 	// Create a global viper. Eventually, we should be creating sub-vipers and passing them into each NewConfig(),
 	// but I have been unsuccessful in getting the resulting sub-vipers merged into one viper.
 	v := viper.New()
 	v.AutomaticEnv()
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.SetDefault(twelveFactorKey, false)
 
 	cfg.API = api.NewConfig(v)
 	cfg.Updater = updater.NewConfig(v)
 	cfg.Spoofer = spoofer.NewConfig(v)
 	cfg.Log = log.NewConfig(v)
+	cfg.Alerts = alerts.NewConfig(v)
+	cfg.MQTT = mqtt.NewConfig(v)
+	cfg.Events = events.NewConfig(v)
+	cfg.Tracing = tracing.NewConfig(v)
+	cfg.Flags = flags.NewConfig(v)
+	cfg.Analytics = analytics.NewConfig(v)
+	cfg.Archive = archive.NewConfig(v)
 
 	pgCfg, err := postgres.NewConfig(v)
 	if err != nil {
@@ -42,27 +96,125 @@ func New() (*Config, error) {
 	}
 	cfg.Postgres = pgCfg
 
-	v.SetConfigName("conf")
-	v.AddConfigPath(".")
-	if err := v.ReadInConfig(); err != nil {
-		log.Info("No config file found; only reading from environment")
+	return v, nil
+}
+
+// AddFlags adds a flag to fs for every setting that can be set by one, named
+// by its lowercase key (e.g. --api.listenurl), and a --config flag for the
+// path of the config file.
+func AddFlags(fs *pflag.FlagSet) {
+	fs.String(configFlag, "", "path of the config file (default: conf.json, conf.yaml, etc. in the working directory)")
+
+	v, err := newViper(&Config{})
+	if err != nil {
+		return
 	}
+	keys := v.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		usage := fmt.Sprintf("overrides $%s and the config file", strings.ToUpper(strings.Replace(key, ".", "_", -1)))
+		switch def := v.Get(key).(type) {
+		case bool:
+			fs.Bool(key, def, usage)
+		case int:
+			fs.Int(key, def, usage)
+		case float64:
+			fs.Float64(key, def, usage)
+		case string:
+			fs.String(key, def, usage)
+		}
+	}
+}
 
-	if err := v.Unmarshal(&cfg); err != nil {
+// New creates a new, global Config. Settings are read from flags added by
+// AddFlags to fs, then the environment, then the config file. fs may be nil.
+// If any setting is invalid, the error is a ValidationError listing them all.
+func New(fs *pflag.FlagSet) (*Config, error) {
+	cfg, v, err := read(fs)
+	if err != nil {
 		return nil, err
 	}
 
-	// I have no idea why, but this config needs to be reset after reading the file
-	cfg.Spoofer = spoofer.BackupConfig(v)
-
-	// Special case for setting log level after reading config
+	// Special case for setting log level and format after reading config
 	log.SetLevel(cfg.Log.Level)
+	log.SetFormat(cfg.Log.Format)
+	log.SetOutput(cfg.Log.Output)
+	if cfg.Log.SentryDSN != "" {
+		log.EnableSentry(cfg.Log.SentryDSN, cfg.Log.SentryEnvironment)
+	}
+	flags.Load(*cfg.Flags)
+	analytics.LoadDrivingLimits(*cfg.Analytics)
 	log.Debugf("All settings: %+v", v.AllSettings())
 	log.Debugf("API configuration: %+v", cfg.API)
 	log.Debugf("Updater configuration: %+v", cfg.Updater)
 	log.Debugf("Log configuration: %+v", cfg.Log)
 	log.Debugf("Postgres configuration: %+v", cfg.Postgres)
 	log.Debugf("Spoofer configuration: %+v", cfg.Spoofer)
+	log.Debugf("Alerts configuration: %+v", cfg.Alerts)
+	log.Debugf("MQTT configuration: %+v", cfg.MQTT)
+	log.Debugf("Events configuration: %+v", cfg.Events)
+	log.Debugf("Tracing configuration: %+v", cfg.Tracing)
+	log.Debugf("Flags configuration: %+v", cfg.Flags)
+	log.Debugf("Analytics configuration: %+v", cfg.Analytics)
+	log.Debugf("Archive destination: %s", cfg.Archive.Destination)
 
 	return cfg, nil
 }
+
+// read reads and validates a Config without applying any of it.
+func read(fs *pflag.FlagSet) (*Config, *viper.Viper, error) {
+	cfg := &Config{}
+	v, err := newViper(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := ""
+	if fs != nil {
+		for _, key := range v.AllKeys() {
+			if f := fs.Lookup(key); f != nil {
+				if err := v.BindPFlag(key, f); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		path, _ = fs.GetString(configFlag)
+	}
+
+	if v.GetBool(twelveFactorKey) {
+		if path != "" {
+			return nil, nil, fmt.Errorf("--%s can't be used with %s, which only reads from the environment and flags", configFlag, twelveFactorKey)
+		}
+		v.SetDefault("log.format", "json")
+		v.SetDefault("log.output", "stdout")
+		if port := os.Getenv("PORT"); port != "" {
+			v.SetDefault("api.listenurl", ":"+port)
+		}
+	} else if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, nil, fmt.Errorf("unable to read config file %s: %s", path, err)
+		}
+	} else {
+		v.SetConfigName("conf")
+		v.AddConfigPath(".")
+		err := v.ReadInConfig()
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+			log.Info("No config file found; only reading from environment and flags")
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("unable to read config file: %s", err)
+		}
+	}
+
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, nil, err
+	}
+
+	// I have no idea why, but this config needs to be reset after reading the file
+	cfg.Spoofer = spoofer.BackupConfig(v)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, v, nil
+}
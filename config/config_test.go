@@ -0,0 +1,101 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+func TestPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conf.json")
+	conf := `{"API": {"ListenURL": "file:1", "MapboxAPIKey": "file", "CasURL": "https://cas.example.com/"}, "Updater": {"Workers": 2, "DataFeed": "https://file.example.com/"}}`
+	if err := ioutil.WriteFile(path, []byte(conf), 0600); err != nil {
+		t.Fatalf("unable to write config file: %s", err)
+	}
+
+	os.Setenv("API_LISTENURL", "env:2")
+	os.Setenv("UPDATER_WORKERS", "3")
+	defer os.Unsetenv("API_LISTENURL")
+	defer os.Unsetenv("UPDATER_WORKERS")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(flags)
+	if err := flags.Parse([]string{"--config", path, "--api.listenurl", "flag:3"}); err != nil {
+		t.Fatalf("unable to parse flags: %s", err)
+	}
+
+	cfg, err := New(flags)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.API.ListenURL != "flag:3" {
+		t.Errorf("got API.ListenURL %q, expected flag to win", cfg.API.ListenURL)
+	}
+	if cfg.Updater.Workers != 3 {
+		t.Errorf("got Updater.Workers %d, expected environment to win", cfg.Updater.Workers)
+	}
+	if cfg.API.MapboxAPIKey != "file" || cfg.Updater.DataFeed != "https://file.example.com/" {
+		t.Errorf("got %q and %q, expected config file values", cfg.API.MapboxAPIKey, cfg.Updater.DataFeed)
+	}
+	if cfg.API.CacheTTL != "1m" {
+		t.Errorf("got API.CacheTTL %q, expected default", cfg.API.CacheTTL)
+	}
+}
+
+func TestMissingConfigFile(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(flags)
+	if err := flags.Parse([]string{"--config", "/nonexistent/conf.json"}); err != nil {
+		t.Fatalf("unable to parse flags: %s", err)
+	}
+	if _, err := New(flags); err == nil {
+		t.Error("expected error for missing config file")
+	}
+}
+
+func TestTwelveFactor(t *testing.T) {
+	defer log.SetFormat("text")
+	defer log.SetOutput("stderr")
+	os.Setenv("TWELVEFACTOR", "true")
+	os.Setenv("PORT", "5000")
+	os.Setenv("API_CASURL", "https://cas.example.com/")
+	defer os.Unsetenv("TWELVEFACTOR")
+	defer os.Unsetenv("PORT")
+	defer os.Unsetenv("API_CASURL")
+
+	// This binary wasn't built with the frontend.
+	_, err := New(nil)
+	if err == nil || !strings.Contains(err.Error(), "\n  twelvefactor: ") {
+		t.Errorf("got %v, expected twelvefactor problem", err)
+	}
+
+	os.Setenv("API_STATICDIR", "static")
+	defer os.Unsetenv("API_STATICDIR")
+	cfg, err := New(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.API.ListenURL != ":5000" || cfg.Log.Format != "json" || cfg.Log.Output != "stdout" {
+		t.Errorf("got API.ListenURL %q, Log.Format %q, and Log.Output %q", cfg.API.ListenURL, cfg.Log.Format, cfg.Log.Output)
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(flags)
+	if err := flags.Parse([]string{"--config", "conf.json"}); err != nil {
+		t.Fatalf("unable to parse flags: %s", err)
+	}
+	if _, err := New(flags); err == nil {
+		t.Error("expected error for config file in twelve-factor mode")
+	}
+}
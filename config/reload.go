@@ -0,0 +1,53 @@
+package config
+
+import (
+	"sync"
+
+	"github.com/spf13/pflag"
+
+	"github.com/wtg/shuttletracker/analytics"
+	"github.com/wtg/shuttletracker/flags"
+	"github.com/wtg/shuttletracker/log"
+)
+
+var (
+	reloadLock sync.Mutex
+	reloaders  []func(*Config) error
+)
+
+// OnReload registers f to apply settings from a reloaded Config to a running
+// subsystem. f should only change settings that are safe to change while
+// running and leave the rest as they were.
+func OnReload(f func(*Config) error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	reloaders = append(reloaders, f)
+}
+
+// Reload reads the configuration again the same way as New. If it's valid,
+// the log level and format, flags, and driving limits are applied, and then
+// every function passed to OnReload is called with it. Other settings, like
+// addresses and credentials, keep their values until restart. If any function
+// returns an error, the rest are still called and the first error is returned.
+func Reload(fs *pflag.FlagSet) error {
+	cfg, _, err := read(fs)
+	if err != nil {
+		return err
+	}
+
+	log.SetLevel(cfg.Log.Level)
+	log.SetFormat(cfg.Log.Format)
+	log.SetOutput(cfg.Log.Output)
+	flags.Load(*cfg.Flags)
+	analytics.LoadDrivingLimits(*cfg.Analytics)
+
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	var first error
+	for _, f := range reloaders {
+		if err := f(cfg); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
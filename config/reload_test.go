@@ -0,0 +1,67 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	"github.com/wtg/shuttletracker/flags"
+)
+
+func TestReload(t *testing.T) {
+	defer func() {
+		reloaders = nil
+		flags.Reset()
+	}()
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conf.json")
+	write := func(conf string) {
+		if err := ioutil.WriteFile(path, []byte(conf), 0600); err != nil {
+			t.Fatalf("unable to write config file: %s", err)
+		}
+	}
+	write(`{"API": {"CasURL": "https://cas.example.com/"}, "Updater": {"UpdateInterval": "10s"}}`)
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(fs)
+	if err := fs.Parse([]string{"--config", path}); err != nil {
+		t.Fatalf("unable to parse flags: %s", err)
+	}
+	if _, err := New(fs); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	reloads := 0
+	interval := ""
+	OnReload(func(cfg *Config) error {
+		reloads++
+		interval = cfg.Updater.UpdateInterval
+		return nil
+	})
+
+	write(`{"API": {"CasURL": "https://cas.example.com/"}, "Updater": {"UpdateInterval": "5s"}, "Flags": {"Percentages": {"eta-model": 20}}}`)
+	if err := Reload(fs); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if reloads != 1 || interval != "5s" {
+		t.Errorf("got %d reloads with interval %q, expected 1 with 5s", reloads, interval)
+	}
+	if all := flags.All(); len(all) != 1 || all[0].Percentage != 20 {
+		t.Errorf("got flags %+v, expected eta-model at 20%%", all)
+	}
+
+	write(`{"API": {"CasURL": "https://cas.example.com/"}, "Updater": {"UpdateInterval": "soon"}}`)
+	if _, ok := Reload(fs).(ValidationError); !ok {
+		t.Error("expected ValidationError for invalid configuration")
+	}
+	if reloads != 1 {
+		t.Error("expected invalid configuration not to be applied")
+	}
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/analytics"
+)
+
+// ValidationError lists every problem found in a Config. Each problem starts
+// with the key of the setting that caused it, e.g. "api.cachettl", which is
+// also the name of its flag and, uppercased with underscores, its
+// environment variable.
+type ValidationError []string
+
+func (ve ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(ve, "\n  ")
+}
+
+// validator collects problems so that they can all be reported at once.
+type validator struct {
+	problems ValidationError
+}
+
+func (v *validator) problemf(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, key+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(key, value string) bool {
+	if value == "" {
+		v.problemf(key, "is required")
+		return false
+	}
+	return true
+}
+
+// duration checks that value is a duration of at least min.
+func (v *validator) duration(key, value string, min time.Duration) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		v.problemf(key, "%q is not a duration like \"30s\" or \"5m\"", value)
+		return
+	}
+	if d < min {
+		v.problemf(key, "%s is shorter than the minimum of %s", d, min)
+	}
+}
+
+// url checks that value, if it's set, is an absolute URL with one of schemes.
+func (v *validator) url(key, value string, schemes ...string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		v.problemf(key, "%q is not a URL like \"%s://host/path\"", value, schemes[0])
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return
+		}
+	}
+	v.problemf(key, "URL scheme %q must be one of %s", u.Scheme, strings.Join(schemes, ", "))
+}
+
+// hostPort checks that value, if it's set, is an address like "localhost:8080".
+func (v *validator) hostPort(key, value string) {
+	if value == "" {
+		return
+	}
+	if _, port, err := net.SplitHostPort(value); err != nil || port == "" {
+		v.problemf(key, "%q is not an address like \"localhost:8080\"", value)
+	}
+}
+
+func (v *validator) intRange(key string, value, min, max int) {
+	if value < min || value > max {
+		v.problemf(key, "%d is outside of the range %d to %d", value, min, max)
+	}
+}
+
+func (v *validator) floatRange(key string, value, min, max float64) {
+	if value < min || value > max {
+		v.problemf(key, "%g is outside of the range %g to %g", value, min, max)
+	}
+}
+
+func (v *validator) oneOf(key, value string, options ...string) {
+	for _, option := range options {
+		if value == option {
+			return
+		}
+	}
+	v.problemf(key, "%q must be one of %s", value, strings.Join(options, ", "))
+}
+
+// Validate checks every setting and returns a ValidationError listing all
+// problems, or nil if there are none. It catches mistakes at startup that
+// would otherwise surface later, one at a time, when a subsystem is created.
+func (cfg *Config) Validate() error {
+	v := &validator{}
+	const maxInt = int(^uint(0) >> 1)
+
+	if !cfg.Spoofer.SpoofUpdates && v.required("updater.datafeed", cfg.Updater.DataFeed) {
+		v.url("updater.datafeed", cfg.Updater.DataFeed, "https", "http")
+	}
+	v.duration("updater.updateinterval", cfg.Updater.UpdateInterval, time.Second)
+	v.intRange("updater.workers", cfg.Updater.Workers, 1, 1024)
+	v.intRange("updater.coalesceevery", cfg.Updater.CoalesceEvery, 0, maxInt)
+	v.floatRange("updater.coalescedistance", cfg.Updater.CoalesceDistance, 0, 100000)
+	v.floatRange("updater.coalesceheading", cfg.Updater.CoalesceHeading, 0, 180)
+	if cfg.Updater.SourceTimeout != "" {
+		v.duration("updater.sourcetimeout", cfg.Updater.SourceTimeout, time.Second)
+	}
+
+	// ListenURL can be several comma-separated addresses.
+	if v.required("api.listenurl", cfg.API.ListenURL) {
+		for _, addr := range strings.Split(cfg.API.ListenURL, ",") {
+			v.hostPort("api.listenurl", strings.TrimSpace(addr))
+		}
+	}
+	if cfg.API.Authenticate && v.required("api.casurl", cfg.API.CasURL) {
+		v.url("api.casurl", cfg.API.CasURL, "https", "http")
+	}
+	if cfg.API.DebugEndpoints && !cfg.API.Authenticate {
+		v.problemf("api.debugendpoints", "can't be enabled while api.authenticate is false, since anyone could profile the server")
+	}
+	if (cfg.API.TLSCertFile == "") != (cfg.API.TLSKeyFile == "") {
+		v.problemf("api.tlskeyfile", "api.tlscertfile and api.tlskeyfile must be set together")
+	}
+	if len(cfg.API.AutocertDomains) > 0 {
+		if cfg.API.TLSCertFile != "" {
+			v.problemf("api.autocertdomains", "can't be used with api.tlscertfile; choose one way to get certificates")
+		}
+		v.required("api.autocertcachedir", cfg.API.AutocertCacheDir)
+	}
+	v.hostPort("api.redirectlistenurl", cfg.API.RedirectListenURL)
+	if cfg.API.RedirectListenURL != "" && cfg.API.TLSCertFile == "" && len(cfg.API.AutocertDomains) == 0 {
+		v.problemf("api.redirectlistenurl", "requires api.tlscertfile or api.autocertdomains, since there is no HTTPS to redirect to")
+	}
+	for _, addr := range strings.Split(cfg.API.InternalListenURL, ",") {
+		addr = strings.TrimSpace(addr)
+		v.hostPort("api.internallistenurl", addr)
+		for _, public := range strings.Split(cfg.API.ListenURL, ",") {
+			if addr != "" && addr == strings.TrimSpace(public) {
+				v.problemf("api.internallistenurl", "%q is also in api.listenurl", addr)
+			}
+		}
+	}
+	if cfg.TwelveFactor {
+		if len(cfg.API.AutocertDomains) > 0 {
+			v.problemf("api.autocertdomains", "can't be used with twelvefactor, since certificates would be lost on restart; use api.tlscertfile or terminate TLS in front of Shuttle Tracker")
+		}
+		if cfg.API.StaticDir == "" && shuttletracker.StaticFiles == nil {
+			v.problemf("twelvefactor", "requires a binary built with -tags embedstatic, which includes the frontend, unless api.staticdir is set")
+		}
+	}
+	v.intRange("api.googlemapmindistance", cfg.API.GoogleMapMinDistance, 0, maxInt)
+	v.duration("api.gtfsinterval", cfg.API.GTFSInterval, time.Second)
+	v.duration("api.cachettl", cfg.API.CacheTTL, 0)
+	v.url("api.cacheredisurl", cfg.API.CacheRedisURL, "redis", "rediss")
+	v.duration("api.statusstaleafter", cfg.API.StatusStaleAfter, time.Second)
+	v.duration("api.vehicleofflineafter", cfg.API.VehicleOfflineAfter, time.Second)
+	v.duration("api.fusionsnapshotinterval", cfg.API.FusionSnapshotInterval, time.Second)
+	v.intRange("api.fusionhistorysize", cfg.API.FusionHistorySize, 0, maxInt)
+	if cfg.API.WalkingSpeed <= 0 {
+		v.problemf("api.walkingspeed", "%g is not a positive speed", cfg.API.WalkingSpeed)
+	}
+	v.url("api.walkingrouterurl", cfg.API.WalkingRouterURL, "https", "http")
+	v.url("api.publicurl", cfg.API.PublicURL, "https", "http")
+	if cfg.API.TwilioAuthToken != "" && cfg.API.PublicURL == "" {
+		v.problemf("api.publicurl", "is required to check Twilio signatures when api.twilioauthtoken is set")
+	}
+	for _, proxy := range cfg.API.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			v.problemf("api.trustedproxies", "%q is not an IP address or CIDR range", proxy)
+		}
+	}
+
+	v.oneOf("log.level", cfg.Log.Level, "debug", "info", "warn", "warning", "error", "fatal", "panic")
+	v.oneOf("log.format", cfg.Log.Format, "text", "json")
+	v.oneOf("log.output", cfg.Log.Output, "stderr", "stdout")
+	v.url("log.sentrydsn", cfg.Log.SentryDSN, "https", "http")
+	if u, err := url.Parse(cfg.Log.SentryDSN); err == nil && cfg.Log.SentryDSN != "" &&
+		(u.User == nil || strings.Trim(u.Path, "/") == "") {
+		v.problemf("log.sentrydsn", "must include a public key and project ID, like \"https://key@host/1\"")
+	}
+
+	if v.required("postgres.url", cfg.Postgres.URL) && strings.Contains(cfg.Postgres.URL, "://") {
+		// lib/pq also accepts "host=... dbname=..." connection strings.
+		v.url("postgres.url", cfg.Postgres.URL, "postgres", "postgresql")
+	}
+	v.duration("postgres.slowquerythreshold", cfg.Postgres.SlowQueryThreshold, 0)
+
+	v.duration("spoof.spoofinterval", cfg.Spoofer.SpoofInterval, time.Second)
+
+	v.url("alerts.slackwebhookurl", cfg.Alerts.SlackWebhookURL, "https")
+	v.url("alerts.discordwebhookurl", cfg.Alerts.DiscordWebhookURL, "https")
+	v.duration("alerts.checkinterval", cfg.Alerts.CheckInterval, time.Second)
+	v.duration("alerts.feeddownthreshold", cfg.Alerts.FeedDownThreshold, time.Second)
+	v.duration("alerts.vehiclesilentthreshold", cfg.Alerts.VehicleSilentThreshold, time.Second)
+	v.duration("alerts.vehiclestuckthreshold", cfg.Alerts.VehicleStuckThreshold, 0)
+	v.floatRange("alerts.vehiclestuckdistance", cfg.Alerts.VehicleStuckDistance, 1, 10000)
+	v.duration("alerts.servicegapthreshold", cfg.Alerts.ServiceGapThreshold, 0)
+	v.duration("alerts.dedupewindow", cfg.Alerts.DedupeWindow, 0)
+	v.intRange("alerts.dailycap", cfg.Alerts.DailyCap, 0, maxInt)
+	if g := cfg.Alerts.Geofence; g.MinLatitude != 0 || g.MaxLatitude != 0 || g.MinLongitude != 0 || g.MaxLongitude != 0 {
+		v.floatRange("alerts.geofence.minlatitude", g.MinLatitude, -90, 90)
+		v.floatRange("alerts.geofence.maxlatitude", g.MaxLatitude, -90, 90)
+		v.floatRange("alerts.geofence.minlongitude", g.MinLongitude, -180, 180)
+		v.floatRange("alerts.geofence.maxlongitude", g.MaxLongitude, -180, 180)
+		if g.MinLatitude >= g.MaxLatitude {
+			v.problemf("alerts.geofence.minlatitude", "must be less than alerts.geofence.maxlatitude")
+		}
+		if g.MinLongitude >= g.MaxLongitude {
+			v.problemf("alerts.geofence.minlongitude", "must be less than alerts.geofence.maxlongitude")
+		}
+	}
+
+	if cfg.MQTT.BrokerURL != "" {
+		v.url("mqtt.brokerurl", cfg.MQTT.BrokerURL, "tcp", "ssl", "ws", "wss")
+		v.required("mqtt.locationtopic", cfg.MQTT.LocationTopic)
+		v.required("mqtt.etatopic", cfg.MQTT.ETATopic)
+	}
+	v.intRange("mqtt.qos", cfg.MQTT.QoS, 0, 2)
+
+	v.oneOf("events.backend", cfg.Events.Backend, "", "nats", "kafka")
+	switch cfg.Events.Backend {
+	case "nats":
+		if v.required("events.natsurl", cfg.Events.NATSURL) {
+			v.url("events.natsurl", cfg.Events.NATSURL, "nats", "tls")
+		}
+	case "kafka":
+		if len(cfg.Events.KafkaBrokers) == 0 {
+			v.problemf("events.kafkabrokers", "is required when events.backend is kafka")
+		}
+		for _, broker := range cfg.Events.KafkaBrokers {
+			v.hostPort("events.kafkabrokers", broker)
+		}
+	}
+
+	v.hostPort("tracing.endpoint", cfg.Tracing.Endpoint)
+	v.floatRange("tracing.sampleratio", cfg.Tracing.SampleRatio, 0, 1)
+	if cfg.Tracing.Endpoint != "" {
+		v.required("tracing.servicename", cfg.Tracing.ServiceName)
+	}
+
+	v.floatRange("analytics.densitycellsize", cfg.Analytics.DensityCellSize, 0.0001, 1)
+	v.floatRange("analytics.speedlimit", cfg.Analytics.SpeedLimit, 1, 200)
+	segments := make([]string, 0, len(cfg.Analytics.SpeedLimits))
+	for key := range cfg.Analytics.SpeedLimits {
+		segments = append(segments, key)
+	}
+	sort.Strings(segments)
+	for _, key := range segments {
+		if _, _, err := analytics.ParseSegmentKey(key); err != nil {
+			v.problemf("analytics.speedlimits."+key, "%s", err)
+			continue
+		}
+		v.floatRange("analytics.speedlimits."+key, cfg.Analytics.SpeedLimits[key], 1, 200)
+	}
+	v.floatRange("analytics.harshacceleration", cfg.Analytics.HarshAcceleration, 0, 50)
+
+	if strings.HasPrefix(cfg.Archive.Destination, "s3://") {
+		if u, err := url.Parse(cfg.Archive.Destination); err != nil || u.Host == "" {
+			v.problemf("archive.destination", "%q is not a URL like \"s3://bucket/prefix\"", cfg.Archive.Destination)
+		}
+		if v.required("archive.s3endpoint", cfg.Archive.S3Endpoint) {
+			v.url("archive.s3endpoint", cfg.Archive.S3Endpoint, "https", "http")
+		}
+		v.required("archive.s3region", cfg.Archive.S3Region)
+		v.required("archive.s3accesskeyid", cfg.Archive.S3AccessKeyID)
+		v.required("archive.s3secretaccesskey", cfg.Archive.S3SecretAccessKey)
+	}
+	v.intRange("archive.backfill", cfg.Archive.Backfill, 0, 366)
+
+	names := make([]string, 0, len(cfg.Flags.Percentages))
+	for name := range cfg.Flags.Percentages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v.intRange("flags.percentages."+name, cfg.Flags.Percentages[name], 0, 100)
+	}
+
+	if len(v.problems) > 0 {
+		return v.problems
+	}
+	return nil
+}
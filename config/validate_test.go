@@ -0,0 +1,171 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func validConfig(t *testing.T) *Config {
+	cfg := &Config{}
+	if _, err := newViper(cfg); err != nil {
+		t.Fatalf("unable to create viper: %s", err)
+	}
+	cfg.API.CasURL = "https://cas.example.com/cas/"
+	return cfg
+}
+
+func TestValidateDefaults(t *testing.T) {
+	cfg := validConfig(t)
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.API.CacheTTL = "1 minute"
+	cfg.API.CasURL = ""
+	cfg.API.ListenURL = "8080"
+	cfg.Updater.Workers = 0
+	cfg.Updater.DataFeed = "shuttles.rpi.edu/datafeed"
+	cfg.Log.Level = "loud"
+	cfg.Events.Backend = "kafka"
+	cfg.Events.KafkaBrokers = nil
+	cfg.Alerts.SlackWebhookURL = "http://hooks.slack.com/services/x"
+	cfg.Alerts.Geofence.MinLatitude = 43
+	cfg.Alerts.Geofence.MaxLatitude = 42
+	cfg.Alerts.Geofence.MinLongitude = -74
+	cfg.Alerts.Geofence.MaxLongitude = -73
+
+	err := cfg.Validate()
+	ve, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("got %v, expected ValidationError", err)
+	}
+	keys := []string{
+		"updater.datafeed",
+		"updater.workers",
+		"api.listenurl",
+		"api.casurl",
+		"api.cachettl",
+		"log.level",
+		"alerts.slackwebhookurl",
+		"alerts.geofence.minlatitude",
+		"events.kafkabrokers",
+	}
+	if len(ve) != len(keys) {
+		t.Errorf("got %d problems, expected %d:\n%s", len(ve), len(keys), ve)
+	}
+	for _, key := range keys {
+		if !strings.Contains(ve.Error(), "\n  "+key+": ") {
+			t.Errorf("expected a problem with %s in:\n%s", key, ve)
+		}
+	}
+}
+
+func TestValidateMutuallyExclusive(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.API.Authenticate = false
+	cfg.API.DebugEndpoints = true
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "api.debugendpoints: ") {
+		t.Errorf("got %v, expected api.debugendpoints problem", err)
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.API.TLSCertFile = "cert.pem"
+	cfg.API.TLSKeyFile = "key.pem"
+	cfg.API.RedirectListenURL = ":80"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	cfg.API.AutocertDomains = []string{"shuttles.rpi.edu"}
+	cfg.API.TLSKeyFile = ""
+	ve, ok := cfg.Validate().(ValidationError)
+	if !ok || len(ve) != 2 {
+		t.Errorf("got %v, expected problems with api.tlskeyfile and api.autocertdomains", ve)
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.API.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	cfg.API.TrustedProxies = []string{"10.0.0.0/33", "lb.rpi.edu"}
+	ve, ok := cfg.Validate().(ValidationError)
+	if !ok || len(ve) != 2 {
+		t.Errorf("got %v, expected two problems with api.trustedproxies", ve)
+	}
+}
+
+func TestValidateSpoofingWithoutDataFeed(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Updater.DataFeed = ""
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for missing data feed")
+	}
+	cfg.Spoofer.SpoofUpdates = true
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error while spoofing: %s", err)
+	}
+}
+
+func TestValidatePostgresConnectionString(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Postgres.URL = "host=localhost dbname=shuttletracker sslmode=disable"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	cfg.Postgres.URL = "mysql://localhost/shuttletracker"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for non-Postgres URL")
+	}
+}
+
+func TestValidateInternalListenURL(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.API.ListenURL = "0.0.0.0:8080"
+	cfg.API.InternalListenURL = "10.0.0.5:9090, 127.0.0.1:9090"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	cfg.API.InternalListenURL = "0.0.0.0:8080"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "api.internallistenurl: ") {
+		t.Errorf("got %v, expected api.internallistenurl problem", err)
+	}
+}
+
+func TestValidateFlags(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Flags.Percentages = map[string]int{"eta-model": 10, "fusion-snapshots": 101}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "flags.percentages.fusion-snapshots: ") {
+		t.Errorf("got %v, expected flags.percentages.fusion-snapshots problem", err)
+	}
+}
+
+func TestValidateSpeedLimits(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Analytics.SpeedLimits = map[string]float64{"3": 15, "3-20": 10, "west": 20}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "analytics.speedlimits.west: ") {
+		t.Errorf("got %v, expected analytics.speedlimits.west problem", err)
+	}
+}
+
+func TestValidateTwilioWithoutPublicURL(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.API.TwilioAuthToken = "secret"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "api.publicurl: ") {
+		t.Errorf("got %v, expected api.publicurl problem", err)
+	}
+	cfg.API.PublicURL = "https://shuttles.rpi.edu"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,93 @@
+package shuttletracker
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Detour temporarily replaces part of a Route, e.g. while a road is closed for
+// construction. Its Points leave the Route at the Route's point nearest to the
+// first of them and rejoin it at the point nearest to the last of them.
+type Detour struct {
+	ID          int64   `json:"id"`
+	RouteID     int64   `json:"route_id"`
+	Description string  `json:"description"`
+	Points      []Point `json:"points"`
+
+	// The Detour is in effect from Start (inclusive) until End (exclusive),
+	// after which the Route reverts to its own Points.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Overlaps returns whether any of the Detour is from since (inclusive) until
+// until (exclusive).
+func (d *Detour) Overlaps(since, until time.Time) bool {
+	return d.Start.Before(until) && d.End.After(since)
+}
+
+// ActiveAt returns whether the Detour is in effect at t.
+func (d *Detour) ActiveAt(t time.Time) bool {
+	return !t.Before(d.Start) && t.Before(d.End)
+}
+
+// Apply replaces the part of a Route's Points that the Detour bypasses with
+// the Detour's Points and records the Detour in the Route's DetourID. It
+// returns false without changing the Route if the Detour would rejoin the
+// Route before leaving it.
+func (d *Detour) Apply(route *Route) bool {
+	if len(d.Points) < 2 || len(route.Points) < 2 {
+		return false
+	}
+	leave := nearestPointIndex(route.Points, d.Points[0])
+	rejoin := nearestPointIndex(route.Points, d.Points[len(d.Points)-1])
+	if rejoin <= leave {
+		return false
+	}
+	points := make([]Point, 0, leave+len(d.Points)+len(route.Points)-rejoin-1)
+	points = append(points, route.Points[:leave]...)
+	points = append(points, d.Points...)
+	points = append(points, route.Points[rejoin+1:]...)
+	route.Points = points
+	id := d.ID
+	route.DetourID = &id
+	return true
+}
+
+// nearestPointIndex returns the index of the point closest to p. Distances are
+// approximated on a plane, which is plenty to compare points along a Route.
+func nearestPointIndex(points []Point, p Point) int {
+	scale := math.Cos(p.Latitude * math.Pi / 180)
+	nearest := 0
+	min := math.Inf(1)
+	for i, q := range points {
+		dLat := q.Latitude - p.Latitude
+		dLon := (q.Longitude - p.Longitude) * scale
+		if d := dLat*dLat + dLon*dLon; d < min {
+			nearest, min = i, d
+		}
+	}
+	return nearest
+}
+
+// DetourService is an interface for interacting with Detours. Routes returned
+// by a RouteService while one of their Detours is in effect have the Detour
+// applied.
+type DetourService interface {
+	Detour(id int64) (*Detour, error)
+
+	// Detours returns the Detours in effect at any time from the filter's
+	// Since until its Until, on its Route if it has one, earliest first.
+	Detours(filter HistoryFilter) ([]*Detour, error)
+
+	CreateDetour(detour *Detour) error
+	ModifyDetour(detour *Detour) error
+	DeleteDetour(id int64) error
+}
+
+// ErrDetourNotFound indicates that a Detour is not in the service.
+var ErrDetourNotFound = errors.New("Detour not found")
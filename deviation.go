@@ -0,0 +1,35 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// Deviation compares an Arrival with the time that a scheduled Trip was
+// planned to arrive at the Stop.
+type Deviation struct {
+	ID        int64 `json:"id"`
+	ArrivalID int64 `json:"arrival_id"`
+
+	// TripID is nil once the Trip has been removed from its Schedule.
+	TripID *int64 `json:"trip_id"`
+
+	VehicleID int64     `json:"vehicle_id"`
+	RouteID   int64     `json:"route_id"`
+	StopID    int64     `json:"stop_id"`
+	Scheduled time.Time `json:"scheduled"`
+	Actual    time.Time `json:"actual"`
+}
+
+// Delay is how late the Vehicle arrived. It's negative if it was early.
+func (d *Deviation) Delay() time.Duration {
+	return d.Actual.Sub(d.Scheduled)
+}
+
+// DeviationService is an interface for interacting with Deviations.
+type DeviationService interface {
+	CreateDeviation(deviation *Deviation) error
+
+	// ExportDeviations calls fn with each Deviation whose actual arrival
+	// matches the filter, oldest first, without loading them all into memory.
+	ExportDeviations(filter HistoryFilter, fn func(*Deviation) error) error
+}
@@ -0,0 +1,63 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// Actions that a DraftChange can take.
+const (
+	DraftCreate = "create"
+	DraftModify = "modify"
+	DraftDelete = "delete"
+)
+
+// Draft is a set of changes to Routes and Schedules that are staged so that
+// they can be reviewed and then published all at once, like a new semester's
+// service, instead of being made one at a time on live data.
+type Draft struct {
+	ID      int64          `json:"id"`
+	Name    string         `json:"name"`
+	Changes []*DraftChange `json:"changes"`
+
+	// PublishAt is when the Draft will be published automatically. If it's
+	// nil, the Draft is only published on request.
+	PublishAt *time.Time `json:"publish_at"`
+
+	// Published is when the Draft was published. Published Drafts can't be
+	// changed.
+	Published *time.Time `json:"published"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// DraftChange creates, modifies, or deletes a Route or Schedule. Exactly one
+// of Route and Schedule is set, and only its ID is needed to delete it.
+// Routes created by a Draft can be given negative IDs so that Schedules in the
+// same Draft can refer to them; they get real IDs when the Draft is published.
+type DraftChange struct {
+	Action   string    `json:"action"`
+	Route    *Route    `json:"route,omitempty"`
+	Schedule *Schedule `json:"schedule,omitempty"`
+}
+
+// DraftService is an interface for interacting with Drafts.
+type DraftService interface {
+	Draft(id int64) (*Draft, error)
+	Drafts() ([]*Draft, error)
+	CreateDraft(draft *Draft) error
+	ModifyDraft(draft *Draft) error
+	DeleteDraft(id int64) error
+
+	// PublishDraft makes all of a Draft's changes at once. If any of them
+	// fail, none of them are made.
+	PublishDraft(id int64) error
+}
+
+// ErrDraftNotFound indicates that a Draft is not in the service.
+var ErrDraftNotFound = errors.New("Draft not found")
+
+// ErrDraftPublished indicates that a Draft can't be changed or published
+// because it has already been published.
+var ErrDraftPublished = errors.New("Draft has already been published")
@@ -11,6 +11,14 @@ type VehicleETA struct {
 	RouteID   int64     `json:"route_id"`
 	StopETAs  []StopETA `json:"stop_etas"`
 	Updated   time.Time `json:"updated"`
+
+	// Stale is set when ETAs may be out of date because something they depend
+	// on, like the data feed, isn't working.
+	Stale bool `json:"stale"`
+
+	// Algorithm identifies how the ETAs were calculated, so that the
+	// accuracy of different versions can be compared.
+	Algorithm string `json:"algorithm"`
 }
 
 // StopETA represents a time when a Vehicle is expected to arrive at a Stop.
@@ -18,6 +26,16 @@ type StopETA struct {
 	StopID   int64     `json:"stop_id"`
 	ETA      time.Time `json:"eta"`
 	Arriving bool      `json:"arriving"`
+
+	// DirectionID is the direction of the Route's Segment that the Vehicle
+	// will be traveling when it arrives, if the Route has Segments.
+	DirectionID *int64 `json:"direction_id,omitempty"`
+
+	// WalkingTime is how long it takes a rider who sent their location to
+	// walk to the Stop, in seconds, and Catchable is whether they'll get
+	// there in time. They're only set in responses to those riders.
+	WalkingTime *float64 `json:"walking_time,omitempty"`
+	Catchable   *bool    `json:"catchable,omitempty"`
 }
 
 // ETAService is an interface for interacting with vehicle estimated times of arrival.
@@ -25,3 +43,24 @@ type ETAService interface {
 	Subscribe(func(VehicleETA))
 	CurrentETAs() map[int64]VehicleETA
 }
+
+// ETARecord is a prediction that was made for a Vehicle arriving at a Stop,
+// kept so that predictions can be compared to actual Arrivals.
+type ETARecord struct {
+	ID        int64     `json:"id"`
+	VehicleID int64     `json:"vehicle_id"`
+	RouteID   int64     `json:"route_id"`
+	StopID    int64     `json:"stop_id"`
+	ETA       time.Time `json:"eta"`
+	Algorithm string    `json:"algorithm"`
+	Created   time.Time `json:"created"`
+}
+
+// ETARecordService is an interface for interacting with ETARecords.
+type ETARecordService interface {
+	CreateETARecords(records []*ETARecord) error
+
+	// ExportETARecords calls fn with each ETARecord created within the filter's
+	// time range, oldest first, without loading them all into memory.
+	ExportETARecords(filter HistoryFilter, fn func(*ETARecord) error) error
+}
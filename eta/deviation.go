@@ -0,0 +1,100 @@
+package eta
+
+import (
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// maxDeviation is how far from its scheduled time an Arrival can be and still
+// be matched to a Trip. Vehicles further off schedule than this aren't
+// running any particular Trip.
+const maxDeviation = 30 * time.Minute
+
+// tripProgress is how far through a Trip a Vehicle has gotten.
+type tripProgress struct {
+	trip *shuttletracker.Trip
+	day  time.Time
+	stop int
+}
+
+// TripMatcher matches Arrivals to the scheduled Trips that Vehicles are
+// running. It is not safe for concurrent use.
+type TripMatcher struct {
+	// current holds the Trip that each Vehicle was last matched to.
+	current map[int64]tripProgress
+}
+
+// NewTripMatcher creates a TripMatcher.
+func NewTripMatcher() *TripMatcher {
+	return &TripMatcher{
+		current: map[int64]tripProgress{},
+	}
+}
+
+// Match returns a Deviation comparing the Arrival to the StopTime that it
+// most likely corresponds to, or nil if there isn't one. A Vehicle is assumed
+// to continue the Trip it was last matched to if the Stop is later in it;
+// otherwise, the StopTime at the Stop that is closest to the Arrival among
+// Schedules that run according to the Calendar is used.
+func (tm *TripMatcher) Match(arrival *shuttletracker.Arrival, schedules []*shuttletracker.Schedule, calendar shuttletracker.Calendar) *shuttletracker.Deviation {
+	best, bestDiff := tripProgress{}, maxDeviation+1
+
+	if p, ok := tm.current[arrival.VehicleID]; ok {
+		for i := p.stop + 1; i < len(p.trip.StopTimes); i++ {
+			if p.trip.StopTimes[i].StopID != arrival.StopID {
+				continue
+			}
+			if diff := absDuration(arrival.Time.Sub(p.trip.StopTimes[i].Arrival.On(p.day))); diff <= maxDeviation {
+				best, bestDiff = tripProgress{p.trip, p.day, i}, diff
+			}
+			break
+		}
+	}
+
+	if best.trip == nil {
+		y, m, d := arrival.Time.Date()
+		today := time.Date(y, m, d, 0, 0, 0, 0, arrival.Time.Location())
+		// Trips that started yesterday may run past midnight.
+		for _, day := range []time.Time{today, today.AddDate(0, 0, -1)} {
+			for _, s := range schedules {
+				if s.RouteID != arrival.RouteID || !calendar.Runs(s, day) {
+					continue
+				}
+				for _, trip := range s.Trips {
+					for i, st := range trip.StopTimes {
+						if st.StopID != arrival.StopID {
+							continue
+						}
+						if diff := absDuration(arrival.Time.Sub(st.Arrival.On(day))); diff < bestDiff {
+							best, bestDiff = tripProgress{trip, day, i}, diff
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if best.trip == nil {
+		delete(tm.current, arrival.VehicleID)
+		return nil
+	}
+	tm.current[arrival.VehicleID] = best
+	tripID := best.trip.ID
+	return &shuttletracker.Deviation{
+		ArrivalID: arrival.ID,
+		TripID:    &tripID,
+		VehicleID: arrival.VehicleID,
+		RouteID:   arrival.RouteID,
+		StopID:    arrival.StopID,
+		Scheduled: best.trip.StopTimes[best.stop].Arrival.On(best.day),
+		Actual:    arrival.Time,
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
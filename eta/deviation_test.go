@@ -0,0 +1,97 @@
+package eta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestTripMatcher(t *testing.T) {
+	at := func(s string) shuttletracker.TimeOfDay {
+		tod, err := shuttletracker.ParseTimeOfDay(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tod
+	}
+	// Two trips through stops 1, 2, and 3, ten minutes apart.
+	schedule := &shuttletracker.Schedule{
+		ID:      1,
+		RouteID: 2,
+		Days:    []time.Weekday{time.Monday},
+		Trips: []*shuttletracker.Trip{
+			{ID: 10, StopTimes: []shuttletracker.StopTime{
+				{StopID: 1, Arrival: at("08:00")},
+				{StopID: 2, Arrival: at("08:05")},
+				{StopID: 3, Arrival: at("08:10")},
+			}},
+			{ID: 11, StopTimes: []shuttletracker.StopTime{
+				{StopID: 1, Arrival: at("08:10")},
+				{StopID: 2, Arrival: at("08:15")},
+				{StopID: 3, Arrival: at("08:20")},
+			}},
+		},
+	}
+	schedules := []*shuttletracker.Schedule{schedule}
+	monday := time.Date(2019, time.March, 4, 0, 0, 0, 0, time.UTC)
+	arrive := func(stopID int64, clock string) *shuttletracker.Arrival {
+		return &shuttletracker.Arrival{ID: 5, VehicleID: 7, RouteID: 2, StopID: stopID, Time: at(clock).On(monday)}
+	}
+
+	tm := NewTripMatcher()
+	d := tm.Match(arrive(1, "08:01"), schedules, nil)
+	if d == nil || *d.TripID != 10 || d.Delay() != time.Minute {
+		t.Fatalf("got %+v, expected to be a minute late on trip 10", d)
+	}
+	if d.ArrivalID != 5 || d.Scheduled != at("08:00").On(monday) {
+		t.Errorf("got %+v, expected arrival 5 scheduled at 08:00", d)
+	}
+
+	// Running late enough that trip 11 is closer, but still on trip 10.
+	d = tm.Match(arrive(2, "08:12"), schedules, nil)
+	if d == nil || *d.TripID != 10 || d.Delay() != 7*time.Minute {
+		t.Errorf("got %+v, expected to be 7 minutes late on trip 10", d)
+	}
+
+	// Starting over picks the closest trip.
+	d = tm.Match(arrive(1, "08:09"), schedules, nil)
+	if d == nil || *d.TripID != 11 || d.Delay() != -time.Minute {
+		t.Errorf("got %+v, expected to be a minute early on trip 11", d)
+	}
+
+	// Nothing is scheduled on Tuesdays.
+	tuesday := arrive(1, "08:00")
+	tuesday.Time = tuesday.Time.AddDate(0, 0, 1)
+	if d = tm.Match(tuesday, schedules, nil); d != nil {
+		t.Errorf("got %+v, expected no match", d)
+	}
+
+	// Or on holidays.
+	holiday := shuttletracker.Calendar{{Type: shuttletracker.ServicePeriodHoliday, Start: "2019-03-04", End: "2019-03-04"}}
+	if d = NewTripMatcher().Match(arrive(1, "08:00"), schedules, holiday); d != nil {
+		t.Errorf("got %+v, expected no match", d)
+	}
+
+	// Or this far from a trip.
+	if d = NewTripMatcher().Match(arrive(1, "09:00"), schedules, nil); d != nil {
+		t.Errorf("got %+v, expected no match", d)
+	}
+}
+
+func TestTripMatcherPastMidnight(t *testing.T) {
+	late, _ := shuttletracker.ParseTimeOfDay("24:30")
+	schedules := []*shuttletracker.Schedule{{
+		RouteID: 2,
+		Days:    []time.Weekday{time.Saturday},
+		Trips: []*shuttletracker.Trip{
+			{ID: 10, StopTimes: []shuttletracker.StopTime{{StopID: 1, Arrival: late}}},
+		},
+	}}
+	sunday := time.Date(2019, time.March, 3, 0, 32, 0, 0, time.UTC)
+	arrival := &shuttletracker.Arrival{VehicleID: 7, RouteID: 2, StopID: 1, Time: sunday}
+	d := NewTripMatcher().Match(arrival, schedules, nil)
+	if d == nil || d.Delay() != 2*time.Minute {
+		t.Errorf("got %+v, expected to be 2 minutes late", d)
+	}
+}
@@ -13,28 +13,10 @@ import (
 	//"github.com/wtg/shuttletracker/updater"
 )
 
-const earthRadius = 6371000.0 // meters
-
-func haversine(theta float64) float64 {
-	return (1 - math.Cos(theta)) / 2
-}
-
 func toRadians(n float64) float64 {
 	return n * math.Pi / 180
 }
 
-func distanceBetween(p1, p2 shuttletracker.Point) float64 {
-	lat1Rad := toRadians(p1.Latitude)
-	lon1Rad := toRadians(p1.Longitude)
-	lat2Rad := toRadians(p2.Latitude)
-	lon2Rad := toRadians(p2.Longitude)
-
-	return 2 * earthRadius * math.Asin(math.Sqrt(
-		haversine(lat2Rad-lat1Rad)+
-			math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-				haversine(lon2Rad-lon1Rad)))
-}
-
 func calculateRouteDistance(route *shuttletracker.Route) float64 {
 	totalDistance := 0.0
 	for i, p1 := range route.Points {
@@ -42,7 +24,7 @@ func calculateRouteDistance(route *shuttletracker.Route) float64 {
 			break
 		}
 		p2 := route.Points[i+1]
-		totalDistance += distanceBetween(p1, p2)
+		totalDistance += shuttletracker.DistanceBetween(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude)
 	}
 	return totalDistance
 }
@@ -63,7 +45,7 @@ func calculateDistance(lds []locationDistance) float64 {
 		p1 := shuttletracker.Point{Latitude: l1.Latitude, Longitude: l1.Longitude}
 		l2 := lds[i+1].loc
 		p2 := shuttletracker.Point{Latitude: l2.Latitude, Longitude: l2.Longitude}
-		total += distanceBetween(p1, p2)
+		total += shuttletracker.DistanceBetween(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude)
 	}
 	return total
 }
@@ -84,8 +66,8 @@ func findClosestLine(point shuttletracker.Point, route *shuttletracker.Route) (p
 	for i := range route.Points[1:] {
 		tempP1 := route.Points[i]
 		tempP2 := route.Points[i+1]
-		d1 := distanceBetween(point, tempP1)
-		d2 := distanceBetween(point, tempP2)
+		d1 := shuttletracker.DistanceBetween(point.Latitude, point.Longitude, tempP1.Latitude, tempP1.Longitude)
+		d2 := shuttletracker.DistanceBetween(point.Latitude, point.Longitude, tempP2.Latitude, tempP2.Longitude)
 		d := d1 + d2
 		if d < totalDistance {
 			p1 = tempP1
@@ -106,7 +88,7 @@ func findMinimumDistanceIndices(points []shuttletracker.Point, locs []*shuttletr
 		minDistance := math.Inf(1)
 		var minIndex int
 		for j, p := range points {
-			d := distanceBetween(p, locPoint)
+			d := shuttletracker.DistanceBetween(p.Latitude, p.Longitude, locPoint.Latitude, locPoint.Longitude)
 			if d < minDistance {
 				minIndex = j
 				minDistance = d
@@ -137,7 +119,7 @@ func crossTrackDistance(p shuttletracker.Point, route *shuttletracker.Route) flo
 	p1, p2 := findClosestLine(p, route)
 
 	// find angular distance from first line point to input point
-	angDist := distanceBetween(p1, p) / earthRadius
+	angDist := shuttletracker.DistanceBetween(p1.Latitude, p1.Longitude, p.Latitude, p.Longitude) / shuttletracker.EarthRadius
 
 	// find bearing from first line point to input point
 	b1 := findInitialBearing(p1, p)
@@ -145,5 +127,5 @@ func crossTrackDistance(p shuttletracker.Point, route *shuttletracker.Route) flo
 	// find bearing from first line point to second line point
 	b2 := findInitialBearing(p1, p2)
 
-	return math.Asin(math.Sin(angDist)*math.Sin(b1-b2)) * earthRadius
+	return math.Asin(math.Sin(angDist)*math.Sin(b1-b2)) * shuttletracker.EarthRadius
 }
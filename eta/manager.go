@@ -1,16 +1,38 @@
 package eta
 
 import (
+	"context"
 	"errors"
 	"math"
+	"strconv"
 	"sync"
 	"time"
 
 	// "github.com/wcharczuk/go-chart"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/flags"
+	"github.com/wtg/shuttletracker/health"
 	"github.com/wtg/shuttletracker/log"
-	"github.com/wtg/shuttletracker/updater"
+	"github.com/wtg/shuttletracker/metrics"
+	"github.com/wtg/shuttletracker/tracing"
+)
+
+var tracer = tracing.Tracer("eta")
+
+// Algorithm identifies how ETAManager calculates ETAs. Change it whenever the
+// calculation changes so that ETA accuracy before and after can be compared.
+const Algorithm = "distance-v1"
+
+// StopOrderFlag is the flag for vehicles whose ETAs are only calculated once
+// they've visited their route's stops in order, which is calculated with
+// AlgorithmStopOrder so that it can be compared with Algorithm.
+const (
+	StopOrderFlag      = "eta-stop-order"
+	AlgorithmStopOrder = "distance-v1-stop-order"
 )
 
 // ETAManager implements ETAService and provides ETAs for Vehicles to Stops.
@@ -22,10 +44,13 @@ type ETAManager struct {
 
 	sm          *sync.Mutex
 	subscribers []func(shuttletracker.VehicleETA)
+	stop        chan struct{}
 }
 
-// NewManager creates an ETAManager subscribed to Location updates from Updater.
-func NewManager(ms shuttletracker.ModelService, updater *updater.Updater) (*ETAManager, error) {
+// NewManager creates an ETAManager subscribed to new Locations. Locations come
+// from the database, so every instance calculates the same ETAs no matter which
+// one stored the Locations.
+func NewManager(ms shuttletracker.ModelService) (*ETAManager, error) {
 	em := &ETAManager{
 		ms:          ms,
 		etaChan:     make(chan *shuttletracker.VehicleETA, 50),
@@ -33,18 +58,21 @@ func NewManager(ms shuttletracker.ModelService, updater *updater.Updater) (*ETAM
 		etasReqChan: make(chan chan map[int64]shuttletracker.VehicleETA),
 		sm:          &sync.Mutex{},
 		subscribers: []func(shuttletracker.VehicleETA){},
+		stop:        make(chan struct{}),
 	}
 
-	// subscribe to new Locations with Updater
-	updater.Subscribe(em.locationSubscriber)
+	// subscribe to new Locations
+	go em.locationSubscriber(ms.SubscribeLocations())
 
 	return em, nil
 }
 
-// This gets new Locations from Updater. As soon as this happens, we'll
+// This gets new Locations. As soon as this happens, we'll
 // determine new ETAs for the vehicle in another goroutine.
-func (em *ETAManager) locationSubscriber(loc *shuttletracker.Location) {
-	go em.handleNewLocation(loc)
+func (em *ETAManager) locationSubscriber(locChan chan *shuttletracker.Location) {
+	for loc := range locChan {
+		go em.handleNewLocation(loc)
+	}
 }
 
 func (em *ETAManager) handleNewLocation(loc *shuttletracker.Location) {
@@ -53,13 +81,22 @@ func (em *ETAManager) handleNewLocation(loc *shuttletracker.Location) {
 		return
 	}
 	vehicleID := *loc.VehicleID
+	timer := prometheus.NewTimer(metrics.ETACalculationDuration)
+	_, span := tracer.Start(context.Background(), "calculate ETAs",
+		trace.WithAttributes(attribute.Int64(log.VehicleIDField, vehicleID)))
 	eta, err := em.calculateVehicleETAs(vehicleID)
 	if err != nil {
-		log.WithError(err).Errorf("unable to calculate ETAs for vehicle ID %d", vehicleID)
+		span.RecordError(err)
+	}
+	span.End()
+	timer.ObserveDuration()
+	health.ReportDegraded(health.ETA, err)
+	if err != nil {
+		log.WithVehicleID(vehicleID).WithError(err).Error("unable to calculate ETAs")
 		return
 	}
 
-	log.Debugf("calculated ETAs for vehicle ID %d", vehicleID)
+	log.WithVehicleID(vehicleID).Debug("calculated ETAs")
 	em.etaChan <- eta
 }
 
@@ -81,6 +118,12 @@ func (em *ETAManager) calculateVehicleETAs(vehicleID int64) (*shuttletracker.Veh
 		VehicleID: vehicleID,
 		StopETAs:  []shuttletracker.StopETA{},
 		Updated:   time.Now(),
+		Algorithm: Algorithm,
+	}
+
+	// disabled vehicles aren't tracked, so riders shouldn't expect them
+	if !vehicle.Enabled {
+		return eta, nil
 	}
 
 	// get route info for vehicle's current route
@@ -95,6 +138,11 @@ func (em *ETAManager) calculateVehicleETAs(vehicleID int64) (*shuttletracker.Veh
 	if err != nil {
 		return nil, err
 	}
+	// Vehicles can stay near a route after it stops running, e.g. on their
+	// way back to the garage, and riders shouldn't be told they're coming.
+	if !route.Enabled || !route.Active {
+		return eta, nil
+	}
 
 	lastDepartureTrack, err := em.getLastDepartureTrack(vehicle, route)
 	if err != nil {
@@ -110,15 +158,17 @@ func (em *ETAManager) calculateVehicleETAs(vehicleID int64) (*shuttletracker.Veh
 	}
 
 	// stops visited in correct order?
-	// inOrder, err := em.stopsVisitedInOrder(route, lastDepartureTrack)
-	// if err != nil {
-	// 	log.WithError(err).Error("unable to determine if stops visited in order")
-	// 	return
-	// }
-	// if !inOrder {
-	// 	log.Debug("stops not visited in order")
-	// 	return
-	// }
+	if flags.Enabled(StopOrderFlag, strconv.FormatInt(vehicleID, 10)) {
+		eta.Algorithm = AlgorithmStopOrder
+		inOrder, err := em.stopsVisitedInOrder(route, lastDepartureTrack)
+		if err != nil {
+			return nil, err
+		}
+		if !inOrder {
+			log.WithVehicleID(vehicleID).Debug("stops not visited in order")
+			return eta, nil
+		}
+	}
 
 	durs, err := em.determineAverageTravelTimes(route)
 	if err != nil {
@@ -176,7 +226,7 @@ func (em *ETAManager) calculateVehicleETAs(vehicleID int64) (*shuttletracker.Veh
 			return nil, err
 		}
 		stopPoint := shuttletracker.Point{Latitude: stop.Latitude, Longitude: stop.Longitude}
-		directDistance := distanceBetween(locPoint, stopPoint)
+		directDistance := shuttletracker.DistanceBetween(locPoint.Latitude, locPoint.Longitude, stopPoint.Latitude, stopPoint.Longitude)
 		if directDistance/totalDuration.Seconds() > 15.6 {
 			log.Warn("ETA is impossibly soon")
 			continue
@@ -187,6 +237,10 @@ func (em *ETAManager) calculateVehicleETAs(vehicleID int64) (*shuttletracker.Veh
 			ETA:      etaTime,
 			Arriving: arriving,
 		}
+		if segment := route.SegmentAt(i); segment != nil {
+			directionID := segment.DirectionID
+			stopETA.DirectionID = &directionID
+		}
 		eta.StopETAs = append(eta.StopETAs, stopETA)
 	}
 
@@ -196,23 +250,33 @@ func (em *ETAManager) calculateVehicleETAs(vehicleID int64) (*shuttletracker.Veh
 // Run is in charge of managing all of the state inside of ETAManager.
 func (em *ETAManager) Run() {
 	err := em.createInitialETAs()
+	health.ReportDegraded(health.ETA, err)
 	if err != nil {
 		log.WithError(err).Error("unable to create initial ETAs")
 	}
 
-	ticker := time.Tick(time.Minute)
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 	for {
 		select {
 		case eta := <-em.etaChan:
 			em.handleNewETA(eta)
 		case etasReplyChan := <-em.etasReqChan:
 			em.processETAsRequest(etasReplyChan)
-		case <-ticker:
+		case <-ticker.C:
 			em.cleanup()
+		case <-em.stop:
+			return
 		}
 	}
 }
 
+// Stop makes Run return. It should be called after the API has stopped, since
+// CurrentETAs blocks once Run has returned.
+func (em *ETAManager) Stop() {
+	close(em.stop)
+}
+
 func (em *ETAManager) createInitialETAs() error {
 	vehicles, err := em.ms.Vehicles()
 	if err != nil {
@@ -221,10 +285,10 @@ func (em *ETAManager) createInitialETAs() error {
 	for _, vehicle := range vehicles {
 		eta, err := em.calculateVehicleETAs(vehicle.ID)
 		if err != nil {
-			log.WithError(err).Errorf("unable to calculate ETAs for vehicle ID %d", vehicle.ID)
+			log.WithVehicleID(vehicle.ID).WithError(err).Error("unable to calculate ETAs")
 			continue
 		}
-		log.Debugf("calculated ETAs for vehicle ID %d", vehicle.ID)
+		log.WithVehicleID(vehicle.ID).Debug("calculated ETAs")
 		em.etaChan <- eta
 	}
 	return nil
@@ -256,9 +320,15 @@ func (em *ETAManager) processETAsRequest(c chan map[int64]shuttletracker.Vehicle
 func (em *ETAManager) cleanup() {
 	log.Debug("ETAManager cleanup")
 	now := time.Now()
+	disabled := em.disabledVehicles()
 	for _, vehicleETA := range em.etas {
 		stopETAs := vehicleETA.StopETAs
 		shouldPush := false
+		if disabled[vehicleETA.VehicleID] && len(stopETAs) > 0 {
+			// the vehicle was disabled since its ETAs were calculated
+			stopETAs = []shuttletracker.StopETA{}
+			shouldPush = true
+		}
 		for i := len(stopETAs) - 1; i >= 0; i-- {
 			stopETA := stopETAs[i]
 			if now.After(stopETA.ETA) {
@@ -273,6 +343,22 @@ func (em *ETAManager) cleanup() {
 	}
 }
 
+// disabledVehicles returns the IDs of Vehicles that aren't enabled.
+func (em *ETAManager) disabledVehicles() map[int64]bool {
+	disabled := map[int64]bool{}
+	vehicles, err := em.ms.Vehicles()
+	if err != nil {
+		log.WithError(err).Error("unable to get vehicles")
+		return disabled
+	}
+	for _, vehicle := range vehicles {
+		if !vehicle.Enabled {
+			disabled[vehicle.ID] = true
+		}
+	}
+	return disabled
+}
+
 // Subscribe allows callers to provide a callback to receive new VehicleETAs.
 func (em *ETAManager) Subscribe(sub func(shuttletracker.VehicleETA)) {
 	em.sm.Lock()
@@ -426,7 +512,7 @@ func (em *ETAManager) findRouteLoops(route *shuttletracker.Route) ([][]*shuttlet
 		locDistances := []locationDistance{}
 		for i, loc1 := range locations {
 			locPoint := shuttletracker.Point{Latitude: loc1.Latitude, Longitude: loc1.Longitude}
-			d := distanceBetween(stopPoint, locPoint)
+			d := shuttletracker.DistanceBetween(stopPoint.Latitude, stopPoint.Longitude, locPoint.Latitude, locPoint.Longitude)
 			locDistances = append(locDistances, locationDistance{loc: loc1, dist: d, index: i})
 		}
 
@@ -499,7 +585,7 @@ func (em *ETAManager) getLastDepartureTrack(vehicle *shuttletracker.Vehicle, rou
 	for ; i < len(locs); i++ {
 		loc := locs[i]
 		locPoint := shuttletracker.Point{Latitude: loc.Latitude, Longitude: loc.Longitude}
-		d := distanceBetween(stopPoint, locPoint)
+		d := shuttletracker.DistanceBetween(stopPoint.Latitude, stopPoint.Longitude, locPoint.Latitude, locPoint.Longitude)
 		if d < 30 {
 			break
 		}
@@ -675,7 +761,7 @@ func (em *ETAManager) findStopZoneIndices(route *shuttletracker.Route, locs []*s
 		minDistance := math.Inf(1)
 		for j := minIndex; j < len(stopPoints); j++ {
 			p := stopPoints[j]
-			d := distanceBetween(p, locPoint)
+			d := shuttletracker.DistanceBetween(p.Latitude, p.Longitude, locPoint.Latitude, locPoint.Longitude)
 			if d < minDistance {
 				minIndex = j
 				minDistance = d
@@ -0,0 +1,38 @@
+package eta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestCleanupDisabledVehicles(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("Vehicles").Return([]*shuttletracker.Vehicle{
+		{ID: 1, Enabled: true},
+		{ID: 2, Enabled: false},
+	}, nil)
+	future := time.Now().Add(time.Minute)
+	em := &ETAManager{
+		ms:      ms,
+		etaChan: make(chan *shuttletracker.VehicleETA, 2),
+		etas: map[int64]*shuttletracker.VehicleETA{
+			1: {VehicleID: 1, StopETAs: []shuttletracker.StopETA{{StopID: 3, ETA: future}}},
+			2: {VehicleID: 2, StopETAs: []shuttletracker.StopETA{{StopID: 3, ETA: future}}},
+		},
+	}
+
+	em.cleanup()
+	if len(em.etaChan) != 1 {
+		t.Fatalf("got %d updated ETAs, expected 1", len(em.etaChan))
+	}
+	eta := <-em.etaChan
+	if eta.VehicleID != 2 || len(eta.StopETAs) != 0 {
+		t.Errorf("got %+v, expected vehicle 2's ETAs to be cleared", eta)
+	}
+	if len(em.etas[1].StopETAs) != 1 {
+		t.Error("expected vehicle 1's ETAs to be kept")
+	}
+}
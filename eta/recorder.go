@@ -0,0 +1,171 @@
+package eta
+
+import (
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// etaRecordInterval is how often each Vehicle's predictions are saved.
+// Saving every update would produce several rows per second.
+const etaRecordInterval = time.Minute
+
+// ArrivalDetector turns VehicleETAs into Arrivals. A Vehicle arrives at a Stop
+// when its ETAs first say that it is arriving there. It is not safe for
+// concurrent use.
+type ArrivalDetector struct {
+	// arriving holds the Stops that each Vehicle is currently arriving at.
+	arriving map[int64]map[int64]bool
+}
+
+// NewArrivalDetector creates an ArrivalDetector.
+func NewArrivalDetector() *ArrivalDetector {
+	return &ArrivalDetector{
+		arriving: map[int64]map[int64]bool{},
+	}
+}
+
+// Arrivals returns an Arrival for each Stop that the Vehicle has started arriving at
+// since its previous VehicleETA. Vehicles that aren't on a Route never arrive.
+func (ad *ArrivalDetector) Arrivals(eta shuttletracker.VehicleETA) []*shuttletracker.Arrival {
+	var arrivals []*shuttletracker.Arrival
+	if eta.RouteID == 0 {
+		delete(ad.arriving, eta.VehicleID)
+		return nil
+	}
+	prev := ad.arriving[eta.VehicleID]
+	current := map[int64]bool{}
+	for _, stopETA := range eta.StopETAs {
+		if !stopETA.Arriving {
+			continue
+		}
+		current[stopETA.StopID] = true
+		if prev[stopETA.StopID] {
+			continue
+		}
+		arrivals = append(arrivals, &shuttletracker.Arrival{
+			VehicleID: eta.VehicleID,
+			RouteID:   eta.RouteID,
+			StopID:    stopETA.StopID,
+			Time:      stopETA.ETA,
+		})
+	}
+	ad.arriving[eta.VehicleID] = current
+	return arrivals
+}
+
+// Recorder saves Arrivals, how far they were from the schedule, and periodic
+// snapshots of predictions so that they can be exported and compared later.
+type Recorder struct {
+	ms       shuttletracker.ModelService
+	leader   shuttletracker.LeaderService
+	etas     chan shuttletracker.VehicleETA
+	detector *ArrivalDetector
+	matcher  *TripMatcher
+
+	// lastRecorded is owned by Run.
+	lastRecorded map[int64]time.Time
+
+	stop chan struct{}
+}
+
+// NewRecorder creates a Recorder subscribed to ETAs from em. Only the leader
+// saves anything so that multiple instances don't create duplicates.
+func NewRecorder(ms shuttletracker.ModelService, em shuttletracker.ETAService, leader shuttletracker.LeaderService) *Recorder {
+	r := &Recorder{
+		ms:           ms,
+		leader:       leader,
+		etas:         make(chan shuttletracker.VehicleETA, 50),
+		detector:     NewArrivalDetector(),
+		matcher:      NewTripMatcher(),
+		lastRecorded: map[int64]time.Time{},
+		stop:         make(chan struct{}),
+	}
+	em.Subscribe(r.handleETA)
+	return r
+}
+
+// Run saves ETAs as they arrive.
+func (r *Recorder) Run() {
+	for {
+		select {
+		case eta := <-r.etas:
+			r.record(eta)
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Stop makes Run return after saving the ETA it's currently handling.
+func (r *Recorder) Stop() {
+	close(r.stop)
+}
+
+func (r *Recorder) record(eta shuttletracker.VehicleETA) {
+	// Keep detecting arrivals even if we aren't the leader so that we're up to
+	// date if we become the leader.
+	arrivals := r.detector.Arrivals(eta)
+	if !r.leader.Leader() {
+		return
+	}
+
+	for _, arrival := range arrivals {
+		if err := r.ms.CreateArrival(arrival); err != nil {
+			log.WithError(err).Error("unable to create arrival")
+			continue
+		}
+		r.recordDeviation(arrival)
+	}
+
+	if eta.RouteID == 0 || len(eta.StopETAs) == 0 || eta.Updated.Sub(r.lastRecorded[eta.VehicleID]) < etaRecordInterval {
+		return
+	}
+	records := make([]*shuttletracker.ETARecord, 0, len(eta.StopETAs))
+	for _, stopETA := range eta.StopETAs {
+		records = append(records, &shuttletracker.ETARecord{
+			VehicleID: eta.VehicleID,
+			RouteID:   eta.RouteID,
+			StopID:    stopETA.StopID,
+			ETA:       stopETA.ETA,
+			Algorithm: eta.Algorithm,
+		})
+	}
+	if err := r.ms.CreateETARecords(records); err != nil {
+		log.WithError(err).Error("unable to create ETA records")
+		return
+	}
+	r.lastRecorded[eta.VehicleID] = eta.Updated
+}
+
+// recordDeviation saves how far an Arrival was from the scheduled Trip that
+// the Vehicle is running, if any.
+func (r *Recorder) recordDeviation(arrival *shuttletracker.Arrival) {
+	schedules, err := r.ms.Schedules()
+	if err != nil {
+		log.WithError(err).Error("unable to get schedules")
+		return
+	}
+	periods, err := r.ms.ServicePeriods()
+	if err != nil {
+		log.WithError(err).Error("unable to get service periods")
+		return
+	}
+	deviation := r.matcher.Match(arrival, schedules, shuttletracker.Calendar(periods))
+	if deviation == nil {
+		return
+	}
+	if err := r.ms.CreateDeviation(deviation); err != nil {
+		log.WithError(err).Error("unable to create deviation")
+	}
+}
+
+// handleETA is called by the ETA manager, so it must not block.
+func (r *Recorder) handleETA(eta shuttletracker.VehicleETA) {
+	select {
+	case r.etas <- eta:
+	default:
+		log.Warn("ETA recorder queue full; dropping ETA")
+	}
+}
@@ -0,0 +1,47 @@
+package eta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestArrivalDetector(t *testing.T) {
+	ad := NewArrivalDetector()
+	now := time.Now()
+	eta := shuttletracker.VehicleETA{
+		VehicleID: 1,
+		RouteID:   2,
+		StopETAs: []shuttletracker.StopETA{
+			{StopID: 3, ETA: now, Arriving: true},
+			{StopID: 4, ETA: now.Add(time.Minute)},
+		},
+	}
+
+	arrivals := ad.Arrivals(eta)
+	if len(arrivals) != 1 {
+		t.Fatalf("got %d arrivals, expected 1", len(arrivals))
+	}
+	expected := shuttletracker.Arrival{VehicleID: 1, RouteID: 2, StopID: 3, Time: now}
+	if *arrivals[0] != expected {
+		t.Errorf("got %+v, expected %+v", arrivals[0], expected)
+	}
+
+	// Still arriving at the same stop, so nothing new.
+	if arrivals = ad.Arrivals(eta); len(arrivals) != 0 {
+		t.Errorf("got %d arrivals, expected 0", len(arrivals))
+	}
+
+	// Leaves the stop, then arrives at the next one.
+	eta.StopETAs = []shuttletracker.StopETA{{StopID: 4, ETA: now, Arriving: true}}
+	if arrivals = ad.Arrivals(eta); len(arrivals) != 1 || arrivals[0].StopID != 4 {
+		t.Errorf("got %+v, expected an arrival at stop 4", arrivals)
+	}
+
+	// Vehicles that leave their route don't arrive anywhere.
+	eta.RouteID = 0
+	if arrivals = ad.Arrivals(eta); len(arrivals) != 0 {
+		t.Errorf("got %d arrivals, expected 0", len(arrivals))
+	}
+}
@@ -0,0 +1,240 @@
+// Package events streams everything that happens in Shuttle Tracker to Kafka or
+// NATS so that other teams can build analytics without querying our database.
+//
+// Each event is published as JSON to a subject (NATS) or topic (Kafka) named
+// "<prefix>.<type>", e.g. "shuttletracker.location".
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/eta"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// Event types.
+const (
+	TypeLocation = "location"
+	TypeArrival  = "arrival"
+	TypeAlert    = "alert"
+	TypeETA      = "eta"
+)
+
+// Event is the envelope that every published message is wrapped in.
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Config holds event stream settings. Backend is "nats", "kafka", or empty to
+// disable publishing.
+type Config struct {
+	Backend       string
+	NATSURL       string
+	KafkaBrokers  []string
+	SubjectPrefix string
+}
+
+// eventQueueSize is how many events can wait to be sent to the broker. Events
+// are dropped while it's full so that a slow broker doesn't hold up locations.
+const eventQueueSize = 1000
+
+// ErrUnknownBackend indicates that the configured backend isn't supported.
+var ErrUnknownBackend = errors.New("unknown event stream backend")
+
+// publisher sends messages to a broker. key identifies the entity that a
+// message is about so that brokers can keep its messages in order.
+type publisher interface {
+	connect() error
+	publish(subject, key string, data []byte) error
+	// close sends anything that is buffered and disconnects.
+	close() error
+}
+
+// queuedEvent is a marshaled event waiting to be sent.
+type queuedEvent struct {
+	eventType string
+	subject   string
+	key       string
+	data      []byte
+}
+
+// Bus publishes locations, arrivals, alerts, and ETAs to a message broker.
+type Bus struct {
+	cfg    Config
+	ms     shuttletracker.ModelService
+	leader shuttletracker.LeaderService
+	pub    publisher
+	etas   chan shuttletracker.VehicleETA
+	alerts chan *shuttletracker.Alert
+	queue  chan queuedEvent
+	stop   chan struct{}
+
+	// arrivals is owned by Run.
+	arrivals *eta.ArrivalDetector
+}
+
+// New creates a Bus. Only the leader publishes events so that consumers don't
+// receive duplicates when multiple instances are running.
+func New(cfg Config, ms shuttletracker.ModelService, em shuttletracker.ETAService, as shuttletracker.AlertService, leader shuttletracker.LeaderService) (*Bus, error) {
+	b := &Bus{
+		cfg:      cfg,
+		ms:       ms,
+		leader:   leader,
+		etas:     make(chan shuttletracker.VehicleETA, 100),
+		alerts:   make(chan *shuttletracker.Alert, 50),
+		queue:    make(chan queuedEvent, eventQueueSize),
+		stop:     make(chan struct{}),
+		arrivals: eta.NewArrivalDetector(),
+	}
+
+	switch cfg.Backend {
+	case "":
+		return b, nil
+	case "nats":
+		b.pub = newNATSPublisher(cfg.NATSURL)
+	case "kafka":
+		b.pub = newKafkaPublisher(cfg.KafkaBrokers)
+	default:
+		return nil, ErrUnknownBackend
+	}
+
+	em.Subscribe(b.handleETA)
+	as.Subscribe(b.handleAlert)
+	return b, nil
+}
+
+// NewConfig creates a new Config.
+func NewConfig(v *viper.Viper) *Config {
+	cfg := &Config{
+		NATSURL:       "nats://127.0.0.1:4222",
+		KafkaBrokers:  []string{"127.0.0.1:9092"},
+		SubjectPrefix: "shuttletracker",
+	}
+	v.SetDefault("events.backend", cfg.Backend)
+	v.SetDefault("events.natsurl", cfg.NATSURL)
+	v.SetDefault("events.kafkabrokers", cfg.KafkaBrokers)
+	v.SetDefault("events.subjectprefix", cfg.SubjectPrefix)
+	return cfg
+}
+
+// Run connects to the broker and publishes events forever. It does nothing if
+// no backend is configured.
+func (b *Bus) Run() {
+	if b.pub == nil {
+		log.Debug("No event stream backend configured.")
+		return
+	}
+
+	for {
+		err := b.pub.connect()
+		if err == nil {
+			break
+		}
+		log.WithError(err).Errorf("unable to connect to %s", b.cfg.Backend)
+		select {
+		case <-time.After(time.Second * 10):
+		case <-b.stop:
+			return
+		}
+	}
+	defer func() {
+		if err := b.pub.close(); err != nil {
+			log.WithError(err).Errorf("unable to disconnect from %s", b.cfg.Backend)
+		}
+	}()
+	sent := make(chan struct{})
+	go b.send(sent)
+	defer func() {
+		close(b.queue)
+		<-sent
+	}()
+	log.Debugf("Publishing events to %s.", b.cfg.Backend)
+
+	locChan := b.ms.SubscribeLocations()
+	for {
+		select {
+		case loc := <-locChan:
+			key := ""
+			if loc.VehicleID != nil {
+				key = strconv.FormatInt(*loc.VehicleID, 10)
+			}
+			b.publish(TypeLocation, key, loc.Time, loc)
+		case vehicleETA := <-b.etas:
+			key := strconv.FormatInt(vehicleETA.VehicleID, 10)
+			for _, arrival := range b.arrivals.Arrivals(vehicleETA) {
+				b.publish(TypeArrival, key, arrival.Time, arrival)
+			}
+			b.publish(TypeETA, key, vehicleETA.Updated, vehicleETA)
+		case alert := <-b.alerts:
+			key := ""
+			if alert.VehicleID != nil {
+				key = strconv.FormatInt(*alert.VehicleID, 10)
+			}
+			b.publish(TypeAlert, key, alert.Created, alert)
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Stop makes Run send any buffered events, disconnect, and return.
+func (b *Bus) Stop() {
+	close(b.stop)
+}
+
+func (b *Bus) publish(eventType, key string, t time.Time, data interface{}) {
+	if !b.leader.Leader() {
+		return
+	}
+	msg, err := json.Marshal(Event{
+		Type: eventType,
+		Time: t,
+		Data: data,
+	})
+	if err != nil {
+		log.WithError(err).Errorf("unable to marshal %s event", eventType)
+		return
+	}
+	select {
+	case b.queue <- queuedEvent{eventType, b.cfg.SubjectPrefix + "." + eventType, key, msg}:
+	default:
+		log.Warnf("event stream queue full; dropping %s event", eventType)
+	}
+}
+
+// send publishes queued events until the queue is closed. Publishing can take
+// as long as the broker does, so it's kept out of Run, which receives locations.
+func (b *Bus) send(sent chan<- struct{}) {
+	defer close(sent)
+	for e := range b.queue {
+		if err := b.pub.publish(e.subject, e.key, e.data); err != nil {
+			log.WithError(err).Errorf("unable to publish %s event", e.eventType)
+		}
+	}
+}
+
+// handleETA is called by the ETA manager, so it must not block.
+func (b *Bus) handleETA(vehicleETA shuttletracker.VehicleETA) {
+	select {
+	case b.etas <- vehicleETA:
+	default:
+		log.Warn("event stream ETA queue full; dropping ETA")
+	}
+}
+
+// handleAlert is called by the alert manager, so it must not block.
+func (b *Bus) handleAlert(alert *shuttletracker.Alert) {
+	select {
+	case b.alerts <- alert:
+	default:
+		log.Warn("event stream alert queue full; dropping alert")
+	}
+}
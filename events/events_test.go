@@ -0,0 +1,66 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestNewUnknownBackend(t *testing.T) {
+	_, err := New(Config{Backend: "carrier pigeon"}, nil, nil, nil, nil)
+	if err != ErrUnknownBackend {
+		t.Errorf("got error %v, expected %v", err, ErrUnknownBackend)
+	}
+}
+
+// blockedPublisher doesn't finish publishing until unblock is closed, like an
+// unreachable broker.
+type blockedPublisher struct {
+	unblock chan struct{}
+}
+
+func (bp *blockedPublisher) connect() error { return nil }
+
+func (bp *blockedPublisher) publish(subject, key string, data []byte) error {
+	<-bp.unblock
+	return nil
+}
+
+func (bp *blockedPublisher) close() error { return nil }
+
+func TestBlockedPublisherDoesNotBlockLocations(t *testing.T) {
+	locs := make(chan *shuttletracker.Location)
+	ms := &mock.ModelService{}
+	ms.LocationService.On("SubscribeLocations").Return(locs)
+	leader := &mock.LeaderService{}
+	leader.On("Leader").Return(true)
+	b, err := New(Config{}, ms, nil, nil, leader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	bp := &blockedPublisher{unblock: make(chan struct{})}
+	b.pub = bp
+	done := make(chan struct{})
+	go func() {
+		b.Run()
+		close(done)
+	}()
+
+	for i := 0; i < 2*eventQueueSize; i++ {
+		select {
+		case locs <- &shuttletracker.Location{}:
+		case <-time.After(time.Second):
+			t.Fatalf("location %d wasn't received while publishing was blocked", i)
+		}
+	}
+
+	close(bp.unblock)
+	b.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Run didn't return after publishing was unblocked")
+	}
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaBatchTimeout bounds how long a publish can wait for a batch to fill.
+// Writes are synchronous, so the default of one second would hold up sending
+// every other event.
+const kafkaBatchTimeout = time.Millisecond * 10
+
+type kafkaPublisher struct {
+	brokers []string
+
+	// writers holds one writer per topic. It is only used by Bus.send.
+	writers map[string]*kafka.Writer
+}
+
+func newKafkaPublisher(brokers []string) *kafkaPublisher {
+	return &kafkaPublisher{
+		brokers: brokers,
+		writers: map[string]*kafka.Writer{},
+	}
+}
+
+// connect checks that a broker is reachable. Writers connect on their own.
+func (kp *kafkaPublisher) connect() error {
+	err := errors.New("no Kafka brokers configured")
+	for _, broker := range kp.brokers {
+		var conn *kafka.Conn
+		conn, err = kafka.Dial("tcp", broker)
+		if err == nil {
+			return conn.Close()
+		}
+	}
+	return err
+}
+
+func (kp *kafkaPublisher) close() error {
+	var err error
+	for _, w := range kp.writers {
+		if closeErr := w.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Messages are keyed so that each vehicle's events stay in order within a partition.
+func (kp *kafkaPublisher) publish(topic, key string, data []byte) error {
+	w, ok := kp.writers[topic]
+	if !ok {
+		w = kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      kp.brokers,
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: kafkaBatchTimeout,
+		})
+		kp.writers[topic] = w
+	}
+	return w.WriteMessages(context.Background(), kafka.Message{
+		Key:   []byte(key),
+		Value: data,
+	})
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+type natsPublisher struct {
+	url  string
+	conn *nats.Conn
+}
+
+func newNATSPublisher(url string) *natsPublisher {
+	return &natsPublisher{url: url}
+}
+
+func (np *natsPublisher) connect() error {
+	// Reconnect forever once the initial connection succeeds. Messages
+	// published while disconnected are buffered by the client.
+	conn, err := nats.Connect(np.url, nats.Name("shuttletracker"), nats.MaxReconnects(-1))
+	if err != nil {
+		return err
+	}
+	np.conn = conn
+	return nil
+}
+
+func (np *natsPublisher) close() error {
+	if err := np.conn.Flush(); err != nil {
+		return err
+	}
+	np.conn.Close()
+	return nil
+}
+
+// NATS has no notion of keys; subjects are ordered per publisher.
+func (np *natsPublisher) publish(subject, key string, data []byte) error {
+	return np.conn.Publish(subject, data)
+}
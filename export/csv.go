@@ -0,0 +1,89 @@
+// Package export turns history into CSV rows, so that the API's exports and
+// the daily archives have the same columns.
+package export
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+var (
+	// LocationHeader names the columns of LocationRecord.
+	LocationHeader = []string{"id", "tracker_id", "vehicle_id", "route_id", "latitude", "longitude", "heading", "speed", "time", "created"}
+	// ArrivalHeader names the columns of ArrivalRecord.
+	ArrivalHeader = []string{"id", "vehicle_id", "route_id", "stop_id", "time"}
+	// ETAHeader names the columns of ETARecord. algorithm was added last so
+	// that existing readers of the columns by position keep working.
+	ETAHeader = []string{"id", "vehicle_id", "route_id", "stop_id", "eta", "created", "algorithm"}
+	// DeviationHeader names the columns of DeviationRecord. Delays are in
+	// seconds.
+	DeviationHeader = []string{"id", "arrival_id", "trip_id", "vehicle_id", "route_id", "stop_id", "scheduled", "actual", "delay"}
+)
+
+// LocationRecord is a Location's row.
+func LocationRecord(l *shuttletracker.Location) []string {
+	return []string{
+		strconv.FormatInt(l.ID, 10),
+		l.TrackerID,
+		formatOptionalID(l.VehicleID),
+		formatOptionalID(l.RouteID),
+		formatFloat(l.Latitude),
+		formatFloat(l.Longitude),
+		formatFloat(l.Heading),
+		formatFloat(l.Speed),
+		l.Time.Format(time.RFC3339),
+		l.Created.Format(time.RFC3339),
+	}
+}
+
+// ArrivalRecord is an Arrival's row.
+func ArrivalRecord(a *shuttletracker.Arrival) []string {
+	return []string{
+		strconv.FormatInt(a.ID, 10),
+		strconv.FormatInt(a.VehicleID, 10),
+		strconv.FormatInt(a.RouteID, 10),
+		strconv.FormatInt(a.StopID, 10),
+		a.Time.Format(time.RFC3339),
+	}
+}
+
+// ETARecord is an ETARecord's row.
+func ETARecord(e *shuttletracker.ETARecord) []string {
+	return []string{
+		strconv.FormatInt(e.ID, 10),
+		strconv.FormatInt(e.VehicleID, 10),
+		strconv.FormatInt(e.RouteID, 10),
+		strconv.FormatInt(e.StopID, 10),
+		e.ETA.Format(time.RFC3339),
+		e.Created.Format(time.RFC3339),
+		e.Algorithm,
+	}
+}
+
+// DeviationRecord is a Deviation's row.
+func DeviationRecord(d *shuttletracker.Deviation) []string {
+	return []string{
+		strconv.FormatInt(d.ID, 10),
+		strconv.FormatInt(d.ArrivalID, 10),
+		formatOptionalID(d.TripID),
+		strconv.FormatInt(d.VehicleID, 10),
+		strconv.FormatInt(d.RouteID, 10),
+		strconv.FormatInt(d.StopID, 10),
+		d.Scheduled.Format(time.RFC3339),
+		d.Actual.Format(time.RFC3339),
+		formatFloat(d.Delay().Seconds()),
+	}
+}
+
+func formatOptionalID(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatInt(*id, 10)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,45 @@
+package export
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestRecordsMatchHeaders(t *testing.T) {
+	at := time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC)
+	vehicleID := int64(4)
+	for _, c := range []struct {
+		header, record []string
+	}{
+		{LocationHeader, LocationRecord(&shuttletracker.Location{ID: 1, VehicleID: &vehicleID, Latitude: 42.73, Time: at, Created: at})},
+		{ArrivalHeader, ArrivalRecord(&shuttletracker.Arrival{ID: 1, Time: at})},
+		{ETAHeader, ETARecord(&shuttletracker.ETARecord{ID: 1, ETA: at, Created: at})},
+		{DeviationHeader, DeviationRecord(&shuttletracker.Deviation{ID: 1, Scheduled: at, Actual: at})},
+	} {
+		if len(c.record) != len(c.header) {
+			t.Errorf("got %v for %v", c.record, c.header)
+		}
+	}
+}
+
+func TestLocationRecord(t *testing.T) {
+	at := time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC)
+	vehicleID := int64(4)
+	record := LocationRecord(&shuttletracker.Location{ID: 1, TrackerID: "t", VehicleID: &vehicleID, Latitude: 42.73, Longitude: -73.68, Time: at, Created: at})
+	expected := []string{"1", "t", "4", "", "42.73", "-73.68", "0", "0", "2019-03-01T09:00:00Z", "2019-03-01T09:00:00Z"}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("got %v, expected %v", record, expected)
+	}
+}
+
+func TestETARecordAlgorithmIsLast(t *testing.T) {
+	at := time.Date(2019, time.March, 1, 9, 0, 0, 0, time.UTC)
+	record := ETARecord(&shuttletracker.ETARecord{ID: 1, VehicleID: 4, RouteID: 2, StopID: 3, ETA: at, Algorithm: "distance-v1", Created: at})
+	expected := []string{"1", "4", "2", "3", "2019-03-01T09:00:00Z", "2019-03-01T09:00:00Z", "distance-v1"}
+	if !reflect.DeepEqual(record, expected) || ETAHeader[len(ETAHeader)-1] != "algorithm" {
+		t.Errorf("got %v for %v, expected %v", record, ETAHeader, expected)
+	}
+}
@@ -0,0 +1,27 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// Favorite is a Stop or Route that a rider has saved. Riders are identified by
+// a device token that their app or browser makes up, so that favorites sync
+// between the web frontend and the mobile app without an account. Exactly one
+// of StopID and RouteID is set.
+type Favorite struct {
+	DeviceToken string    `json:"-"`
+	StopID      *int64    `json:"stop_id"`
+	RouteID     *int64    `json:"route_id"`
+	Created     time.Time `json:"created"`
+}
+
+// FavoriteService is an interface for interacting with Favorites.
+type FavoriteService interface {
+	Favorites(deviceToken string) ([]*Favorite, error)
+	AddFavorite(favorite *Favorite) error
+	RemoveFavorite(favorite *Favorite) error
+}
+
+// ErrFavoriteNotFound indicates that a Favorite is not found.
+var ErrFavoriteNotFound = errors.New("Favorite not found")
@@ -0,0 +1,139 @@
+// Package flags turns experimental behavior on for a percentage of clients,
+// e.g. a new ETA model or Fusion message type, so that it can be tried out
+// and rolled back without a redeploy. Subsystems ask whether a flag is
+// Enabled for a client; flags that were never set are disabled.
+package flags
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// Config configures flags.
+type Config struct {
+	// Percentages maps each flag's name to the percentage of clients that
+	// it's enabled for, from 0 to 100. Viper lowercases the names.
+	Percentages map[string]int
+}
+
+// NewConfig creates a new Config.
+func NewConfig(v *viper.Viper) *Config {
+	cfg := &Config{
+		Percentages: map[string]int{},
+	}
+	v.SetDefault("flags.percentages", cfg.Percentages)
+	return cfg
+}
+
+// Flag is a flag and the percentage of clients that it's enabled for.
+type Flag struct {
+	Name       string `json:"name"`
+	Percentage int    `json:"percentage"`
+}
+
+var (
+	lock sync.RWMutex
+	// configured are the percentages in the config, and set are those set
+	// by administrators since startup, which take precedence.
+	configured  = map[string]int{}
+	set         = map[string]int{}
+	percentages = map[string]int{}
+)
+
+// Load replaces the configured flags with those in cfg. Flags set by
+// administrators keep their percentages.
+func Load(cfg Config) {
+	lock.Lock()
+	defer lock.Unlock()
+	configured = map[string]int{}
+	for name, percentage := range cfg.Percentages {
+		configured[name] = clamp(percentage)
+	}
+	merge()
+}
+
+// Set enables a flag for a percentage of clients until restart, even if the
+// config is loaded again. Zero disables it.
+func Set(name string, percentage int) {
+	percentage = clamp(percentage)
+	lock.Lock()
+	set[name] = percentage
+	merge()
+	lock.Unlock()
+	log.WithField("flag", name).WithField("percentage", percentage).Info("flag set")
+}
+
+// Reset forgets every flag, including those set by administrators.
+func Reset() {
+	lock.Lock()
+	defer lock.Unlock()
+	configured = map[string]int{}
+	set = map[string]int{}
+	merge()
+}
+
+// merge works out each flag's percentage. lock must be held.
+func merge() {
+	percentages = map[string]int{}
+	for name, percentage := range configured {
+		percentages[name] = percentage
+	}
+	for name, percentage := range set {
+		percentages[name] = percentage
+	}
+}
+
+func clamp(percentage int) int {
+	if percentage < 0 {
+		return 0
+	}
+	if percentage > 100 {
+		return 100
+	}
+	return percentage
+}
+
+// Enabled reports whether a flag is enabled for a client. key identifies the
+// client, e.g. a Fusion client ID or a vehicle ID, and the same key is always
+// in or out of a flag unless its percentage changes. Raising the percentage
+// only adds clients. Each flag picks different clients.
+func Enabled(name, key string) bool {
+	lock.RLock()
+	percentage := percentages[name]
+	lock.RUnlock()
+	switch percentage {
+	case 0:
+		return false
+	case 100:
+		return true
+	}
+	return bucket(name, key) < percentage
+}
+
+// bucket places a client in one of 100 buckets for a flag.
+func bucket(name, key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % 100)
+}
+
+// All returns every flag that has been set, by name.
+func All() []Flag {
+	lock.RLock()
+	defer lock.RUnlock()
+	flags := make([]Flag, 0, len(percentages))
+	for name, percentage := range percentages {
+		flags = append(flags, Flag{Name: name, Percentage: percentage})
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
@@ -0,0 +1,66 @@
+package flags
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestEnabled(t *testing.T) {
+	defer Reset()
+	Load(Config{Percentages: map[string]int{"on": 100, "off": 0, "half": 50, "too-much": 150}})
+
+	if Enabled("unset", "a") {
+		t.Error("expected unset flag to be disabled")
+	}
+	if !Enabled("on", "a") || Enabled("off", "a") || !Enabled("too-much", "a") {
+		t.Errorf("got %+v", All())
+	}
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if Enabled("half", key) {
+			enabled++
+		}
+		if Enabled("half", key) != Enabled("half", key) {
+			t.Fatalf("expected %s to be consistently enabled or disabled", key)
+		}
+	}
+	if enabled < 400 || enabled > 600 {
+		t.Errorf("got %d of 1000 clients enabled at 50%%", enabled)
+	}
+}
+
+func TestSetOnlyAddsClients(t *testing.T) {
+	defer Reset()
+	Set("rollout", 10)
+	before := []string{}
+	for i := 0; i < 1000; i++ {
+		if key := strconv.Itoa(i); Enabled("rollout", key) {
+			before = append(before, key)
+		}
+	}
+	Set("rollout", 30)
+	for _, key := range before {
+		if !Enabled("rollout", key) {
+			t.Errorf("expected %s to stay enabled after raising percentage", key)
+		}
+	}
+
+	flags := All()
+	if len(flags) != 1 || flags[0] != (Flag{Name: "rollout", Percentage: 30}) {
+		t.Errorf("got %+v", flags)
+	}
+}
+
+func TestLoadKeepsSetFlags(t *testing.T) {
+	defer Reset()
+	Load(Config{Percentages: map[string]int{"eta-model": 10, "fusion-snapshots": 20}})
+	Set("eta-model", 50)
+	Load(Config{Percentages: map[string]int{"eta-model": 30}})
+
+	flags := All()
+	if len(flags) != 1 || flags[0] != (Flag{Name: "eta-model", Percentage: 50}) {
+		t.Errorf("got %+v, expected only eta-model at the percentage it was set to", flags)
+	}
+}
@@ -157,7 +157,8 @@ Vue.component('route-card', {
       }
     },
     toggleRoute: function(id){
-      data = {id: id, enabled: !this.info.enabled};
+      // editing replaces the whole route, so send the rest of it unchanged
+      data = Object.assign({}, this.info, {id: id, enabled: !this.info.enabled});
       $.ajax({
         url: "/routes/edit",
         type: "POST",
@@ -107,19 +107,36 @@ export default class Fusion {
     private subscriptionTopics = new Set<string>();
     private serverID = null;
 
+    // resumeToken identifies our session so that we can resume it after
+    // reconnecting, and lastSequence is the last topic message we received.
+    // nextToken is the token for the session started by a reconnection,
+    // which we use if the old one can't be resumed.
+    private resumeToken: string | null = null;
+    private nextToken: string | null = null;
+    private lastSequence = 0;
+
     constructor() {
         const wsURL = this.relativeWSURL('fusion/');
         this.ws = new SocketManager(wsURL);
         this.ws.registerMessageReceivedCallback((data) => {
             const message = JSON.parse(data);
+            if (message.sequence) {
+                this.lastSequence = message.sequence;
+            }
             for (const callback of this.callbacks) {
                 callback(message);
             }
         });
         this.ws.registerReconnectCallback(() => {
-            for (const topic of this.subscriptionTopics) {
-                this.requestSubscription(topic);
+            if (this.resumeToken === null) {
+                this.resubscribe();
+                return;
             }
+            const data = {
+                type: 'resume',
+                message: { token: this.resumeToken, sequence: this.lastSequence },
+            };
+            this.ws.send(JSON.stringify(data));
         });
     }
 
@@ -146,6 +163,36 @@ export default class Fusion {
             }
         });
 
+        // keep track of our session so that we can resume it
+        this.registerMessageReceivedCallback((message: any) => {
+            if (message.type === 'resume_token') {
+                if (this.resumeToken === null) {
+                    this.resumeToken = message.message;
+                } else {
+                    this.nextToken = message.message;
+                }
+            } else if (message.type === 'resume' && !message.message.resumed) {
+                // the session expired, so start over with the new one
+                this.resumeToken = this.nextToken;
+                this.resubscribe();
+            }
+        });
+
+        // answer clock messages so that the server can correct our positions' times
+        this.registerMessageReceivedCallback((message: any) => {
+            if (message.type !== 'clock') {
+                return;
+            }
+            const data = {
+                type: 'clock',
+                message: {
+                    server_time: message.message.server_time,
+                    client_time: new Date().toISOString(),
+                },
+            };
+            this.ws.send(JSON.stringify(data));
+        });
+
         // register location callback
         UserLocationService.getInstance().registerCallback((position) => {
             if (!store.state.settings.fusionPositionEnabled) {
@@ -159,6 +206,7 @@ export default class Fusion {
                     heading: position.coords.heading,
                     speed: position.coords.speed,
                     track: this.track,
+                    client_time: new Date(position.timestamp).toISOString(),
                 },
             };
             this.ws.send(JSON.stringify(data));
@@ -217,6 +265,18 @@ export default class Fusion {
         this.ws.send(JSON.stringify(data));
     }
 
+    // Report how full a vehicle is: 'empty', 'some_seats', 'standing', or 'full'.
+    public sendOccupancy(vehicleID: number, occupancy: string) {
+        const data = {
+            type: 'occupancy',
+            message: {
+                vehicle_id: vehicleID,
+                occupancy,
+            },
+        };
+        this.ws.send(JSON.stringify(data));
+    }
+
     public subscribe(topic: string) {
         this.subscriptionTopics.add(topic);
         this.requestSubscription(topic);
@@ -227,6 +287,12 @@ export default class Fusion {
         this.requestUnsubscription(topic);
     }
 
+    private resubscribe() {
+        for (const topic of this.subscriptionTopics) {
+            this.requestSubscription(topic);
+        }
+    }
+
     private requestSubscription(topic: string) {
         const data = {
             type: 'subscribe',
@@ -257,12 +323,17 @@ export default class Fusion {
                 new Date(stopETA.eta),
                 stopETA.arriving,
             );
+            eta.directionID = stopETA.direction_id;
             etas.push(eta);
         }
         store.commit('updateETAs', { vehicleID: message.message.vehicle_id, etas });
     }
 
     private handleVehicleLocations(message: any) {
+        if (message.type === 'vehicle_offline') {
+            store.commit('setVehicleOffline', message.message.vehicle_id);
+            return;
+        }
         if (message.type !== 'vehicle_location') {
             return;
         }
@@ -104,6 +104,14 @@ const store: StoreOptions<StoreState> = {
         }
       }
     },
+    setVehicleOffline(state, vehicleID: number) {
+      for (const vehicle of state.Vehicles) {
+        if (vehicle.id === vehicleID) {
+          vehicle.showOnMap(false);
+          break;
+        }
+      }
+    },
     addAdminMessage(state, message: AdminMessageUpdate) {
       state.adminMessage = message;
     },
@@ -200,6 +208,7 @@ const store: StoreOptions<StoreState> = {
             const line = new L.Polyline(points, {
               color: r.color,
               weight: r.width,
+              dashArray: r.dash_pattern || undefined,
               opacity: 1,
             });
             if (r.id === id) {
@@ -213,7 +222,9 @@ const store: StoreOptions<StoreState> = {
     getRoutePolyLines(state: StoreState): L.Polyline[] {
       const arr = new Array<L.Polyline>();
       if (state.Routes !== undefined && state.Routes.length !== 0) {
-        state.Routes.forEach((r: Route) => {
+        // lines added later are drawn on top, so add the lowest z-index first
+        const routes = state.Routes.slice().sort((a: Route, b: Route) => a.z_index - b.z_index);
+        routes.forEach((r: Route) => {
           if (r.shouldShow()) {
             const points = new Array<L.LatLng>();
             if (r.points !== undefined) {
@@ -224,6 +235,7 @@ const store: StoreOptions<StoreState> = {
             const line = new L.Polyline(points, {
               color: r.color,
               weight: r.width,
+              dashArray: r.dash_pattern || undefined,
               opacity: 1,
             });
             arr.push(line);
@@ -268,6 +280,12 @@ const store: StoreOptions<StoreState> = {
         commit('setOnline', false);
       });
     },
+    // administrators also need the routes that are hidden from the public
+    grabAllRoutes({ commit }) {
+      InfoService.GrabRoutes(true).then((ret: Route[]) => commit('setRoutes', ret)).catch(() => {
+        commit('setOnline', false);
+      });
+    },
     grabStops({ commit }) {
       InfoService.GrabStops().then((ret: Stop[]) => commit('setStops', ret)).catch(() => {
         commit('setOnline', false);
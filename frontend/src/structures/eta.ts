@@ -4,6 +4,8 @@ export default class ETA {
     public routeID: number;
     public eta: Date;
     public arriving: boolean;
+    // direction of the route segment the vehicle will be on, if the route has segments
+    public directionID?: number;
 
     constructor(stopID: number, vehicleID: number, routeID: number, eta: Date, arriving: boolean) {
         this.stopID = stopID;
@@ -1,5 +1,11 @@
 import routeScheduleInterval from './routeScheduleInterval';
 
+export interface RouteSegment {
+    direction_id: number;
+    name: string;
+    stop_ids: number[];
+}
+
 export interface RouteInterface {
     id: number;
     name: string;
@@ -13,6 +19,12 @@ export interface RouteInterface {
         longitude: number,
     }>;
     stop_ids: number[];
+    label?: string;
+    icon?: string;
+    z_index?: number;
+    dash_pattern?: string;
+    segments?: RouteSegment[];
+    visibility?: routeScheduleInterval[];
 }
 
 /**
@@ -32,6 +44,13 @@ export default class Route implements RouteInterface {
         longitude: number,
     }>;
     public stop_ids: number[];
+    public label: string = '';
+    public icon: string = '';
+    public z_index: number = 0;
+    public dash_pattern: string = '';
+    public segments: RouteSegment[] = [];
+    // when the route is shown to the public; always if empty
+    public visibility: routeScheduleInterval[] = [];
 
     constructor(id: number, name: string, description: string, enabled: boolean,
                 color: string, width: number, points: Array<{
@@ -13,6 +13,14 @@ export default class AdminServiceProvider {
         });
     }
 
+    // ReorderRouteStops saves a new order of a route's own stops, along with segments that match it.
+    public static ReorderRouteStops(route: Route): Promise<Response> {
+        return fetch('/routes/reorder-stops', {
+            method: 'POST',
+            body: JSON.stringify({id: route.id, stop_ids: route.stop_ids, segments: route.segments}),
+        });
+    }
+
     public static DeleteRoute(route: Route): Promise<Response> {
         return fetch('/routes?id=' + String(route.id), {
             method: 'DELETE',
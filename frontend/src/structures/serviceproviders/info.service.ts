@@ -1,6 +1,6 @@
-import Vehicle from '../vehicle';
-import Route from '../route';
-import { Stop } from '../stop';
+import Vehicle, { VehicleDetails } from '../vehicle';
+import Route, { RouteSegment } from '../route';
+import { Stop, StopAmenities } from '../stop';
 import Form from '../form';
 import AdminMessageUpdate from '@/structures/adminMessageUpdate';
 import FeedbackMessageUpdate from '@/structures/feedbackMessageUpdate';
@@ -20,17 +20,20 @@ export default class InfoServiceProvider {
                 updated: string,
                 enabled: boolean,
                 tracker_id: string,
-            }) => {
-                ret.push(new Vehicle(element.id, element.name,
-                    new Date(element.created), new Date(element.updated), element.enabled, Number(element.tracker_id)));
+            } & VehicleDetails) => {
+                const vehicle = new Vehicle(element.id, element.name,
+                    new Date(element.created), new Date(element.updated), element.enabled, Number(element.tracker_id));
+                vehicle.setDetails(element);
+                ret.push(vehicle);
             });
             return ret;
         });
 
     }
 
-    public GrabRoutes(): Promise<Route[]> {
-        return fetch(Resources.BasePath + 'routes').then((data) => data.json()).then((data) => {
+    // GrabRoutes gets the routes shown to the public, or every route for administrators if all is set.
+    public GrabRoutes(all: boolean = false): Promise<Route[]> {
+        return fetch(Resources.BasePath + (all ? 'routes/all' : 'routes')).then((data) => data.json()).then((data) => {
             const ret = new Array<Route>();
             data.forEach((element: {
                 id: number,
@@ -55,14 +58,40 @@ export default class InfoServiceProvider {
                 ],
                 active: boolean,
                 stop_ids: number[],
+                label: string,
+                icon: string,
+                z_index: number,
+                dash_pattern: string,
+                segments: RouteSegment[],
+                visibility: [
+                    {
+                        id: number;
+                        route_id: number;
+                        start_day: number;
+                        start_time: Date;
+                        end_day: number;
+                        end_time: Date;
+                    }
+                ],
             }) => {
                 const myschedule: routeScheduleInterval[] = [];
                 element.schedule.forEach((interval) => {
                     myschedule.push(new routeScheduleInterval(interval.id, interval.route_id, interval.start_day, new Date(interval.start_time), interval.end_day, new Date(interval.end_time)));
                 });
-                ret.push(new Route(element.id, element.name, element.description,
+                const visibility: routeScheduleInterval[] = [];
+                (element.visibility || []).forEach((interval) => {
+                    visibility.push(new routeScheduleInterval(interval.id, interval.route_id, interval.start_day, new Date(interval.start_time), interval.end_day, new Date(interval.end_time)));
+                });
+                const route = new Route(element.id, element.name, element.description,
                     element.enabled, element.color, Number(element.width), element.points, myschedule, element.active,
-                    element.stop_ids));
+                    element.stop_ids);
+                route.label = element.label || '';
+                route.icon = element.icon || '';
+                route.z_index = element.z_index || 0;
+                route.dash_pattern = element.dash_pattern || '';
+                route.segments = element.segments || [];
+                route.visibility = visibility;
+                ret.push(route);
             });
             return ret;
         });
@@ -80,9 +109,11 @@ export default class InfoServiceProvider {
                 created: string,
                 updated: string,
                 // routesOn: Route[],
-            }) => {
-                ret.push(new Stop(element.id, element.name, element.description, Number(element.latitude),
-                    Number(element.longitude), element.created, element.updated));
+            } & StopAmenities) => {
+                const stop = new Stop(element.id, element.name, element.description, Number(element.latitude),
+                    Number(element.longitude), element.created, element.updated);
+                stop.setAmenities(element);
+                ret.push(stop);
             });
             return ret;
         });
@@ -9,6 +9,17 @@ import {DarkTheme} from '@/structures/theme';
 export const StopSVGLight = require('@/assets/circle.svg') as string;
 export const StopSVGDark = require('@/assets/circle.svg') as string;
 
+/**
+ * StopAmenities describes what riders can expect while waiting at a stop
+ */
+export interface StopAmenities {
+    shelter: boolean;
+    lighting: boolean;
+    bench: boolean;
+    wheelchair_accessible: boolean;
+    photo_url: string;
+}
+
 /**
  * Stop represents a single stop on a route
  */
@@ -33,6 +44,11 @@ export class Stop {
     public updated: string;
     public routesOn: Route[];
     public marker: L.Marker | null;
+    public shelter: boolean = false;
+    public lighting: boolean = false;
+    public bench: boolean = false;
+    public wheelchair_accessible: boolean = false;
+    public photo_url: string = '';
 
     constructor(id: number, name: string, description: string,
                 lat: number, lng: number, created: string, updated: string) {
@@ -47,14 +63,41 @@ export class Stop {
         this.marker = null;
     }
 
+    // copies a stop's amenities and photo from JSON
+    public setAmenities(amenities: StopAmenities) {
+        this.shelter = amenities.shelter || false;
+        this.lighting = amenities.lighting || false;
+        this.bench = amenities.bench || false;
+        this.wheelchair_accessible = amenities.wheelchair_accessible || false;
+        this.photo_url = amenities.photo_url || '';
+    }
+
     public getMessage(): string {
+        let message = this.name;
         if (this.routesOn.length > 0) {
-            return this.name +
-                ` is on route${this.routesOn.length > 1 ? 's' : ''} `
+            message += ` is on route${this.routesOn.length > 1 ? 's' : ''} `
                 + this.routesOn.filter((route: Route) => route.shouldShow()).map((route: Route) => `<i>${route.name}</i>`).join(', ');
-        } else {
-            return this.name;
         }
+        const amenities = [];
+        if (this.shelter) {
+            amenities.push('shelter');
+        }
+        if (this.lighting) {
+            amenities.push('lighting');
+        }
+        if (this.bench) {
+            amenities.push('bench');
+        }
+        if (this.wheelchair_accessible) {
+            amenities.push('wheelchair accessible');
+        }
+        if (amenities.length > 0) {
+            message += `<br>${amenities.join(', ')}`;
+        }
+        if (this.photo_url !== '') {
+            message += `<br><img src="${encodeURI(this.photo_url)}" alt="${this.name}" width="200">`;
+        }
+        return message;
     }
 
     public getOrCreateMarker(state: StoreState): L.Marker {
@@ -89,13 +132,18 @@ export class Stop {
     }
 
     public asJSON(): {
-        id: number, name: string; description: string; latitude: number; longitude: number } {
+        id: number, name: string; description: string; latitude: number; longitude: number } & StopAmenities {
         return {
             id: this.id,
             name: this.name,
             description: this.description,
             latitude: Number(this.latitude),
             longitude: Number(this.longitude),
+            shelter: this.shelter,
+            lighting: this.lighting,
+            bench: this.bench,
+            wheelchair_accessible: this.wheelchair_accessible,
+            photo_url: this.photo_url,
         };
     }
 }
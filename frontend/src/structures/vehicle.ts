@@ -12,6 +12,21 @@ const tinycolor = require('tinycolor2');
 const vehicleInactiveDurationMS = 5 * 60 * 1000;  // five minutes in milliseconds
 
 
+/**
+ * VehicleDetails describes a vehicle itself, rather than how it's tracked
+ */
+export interface VehicleDetails {
+    capacity: number;
+    wheelchair_accessible: boolean;
+    make: string;
+    model: string;
+    license_plate: string;
+    color: string;
+    label: string;
+    icon: string;
+    group_id: number | null;
+}
+
 /**
  * Vehicle represents a returned vehicle value
  */
@@ -31,6 +46,15 @@ export default class Vehicle {
     public lastUpdate: Date;
     public tracker_id: number;
     public location: Location | null;
+    public capacity: number = 0;
+    public wheelchair_accessible: boolean = false;
+    public make: string = '';
+    public model: string = '';
+    public license_plate: string = '';
+    public color: string = '';
+    public label: string = '';
+    public icon: string = '';
+    public group_id: number | null = null;
     private hideTimer: number | null = null;
     private pointIndex: number | null;
     private endPointIndex: number | null;
@@ -80,7 +104,8 @@ export default class Vehicle {
         const speed = Math.round(this.location.speed * 100) / 100;
         const direction = getCardinalDirection(this.location.heading);
         const routeOnMsg = this.Route === undefined ? '' : `on route <i>${this.Route.name}</i>`;
-        let message = `<b>${this.name}</b> ${routeOnMsg}<br>`
+        const label = this.label === '' ? '' : ` (${this.label})`;
+        let message = `<b>${this.name}</b>${label} ${routeOnMsg}<br>`
             + `Traveling ${direction} at ${speed} mph`;
         if (this.location !== undefined) {
             message += '<br>as of ' + this.location.time.toLocaleTimeString();
@@ -123,7 +148,7 @@ export default class Vehicle {
     public setRoute(r: Route | undefined, darkEnabled: boolean) {
         if (r === undefined) {
             this.marker.setIcon(L.icon({
-                iconUrl: getMarkerString('#FFF'),
+                iconUrl: getMarkerString(this.color !== '' ? this.color : '#FFF'),
                 iconSize: [32, 32], // size of the icon
                 iconAnchor: [16, 16], // point of the icon which will correspond to marker's location
                 popupAnchor: [0, 0],   // point from which the popup should open relative to the iconAnchor
@@ -133,14 +158,16 @@ export default class Vehicle {
         }
         this.Route = r;
         this.RouteID = r.id;
-        let markerColor = r.color;
+        // a vehicle's own color takes precedence over its route's
+        const color = this.color !== '' ? this.color : r.color;
+        let markerColor = color;
         if (darkEnabled) {
-            const darkColor = tinycolor(r.color);
+            const darkColor = tinycolor(color);
             darkColor.darken(15);
             markerColor = darkColor.toString();
         }
         this.marker.setIcon(L.icon({
-            iconUrl: getMarkerString(r.color),
+            iconUrl: getMarkerString(color),
             iconSize: [32, 32], // size of the icon
             iconAnchor: [16, 16], // point of the icon which will correspond to marker's location
             popupAnchor: [0, 0],   // point from which the popup should open relative to the iconAnchor
@@ -301,12 +328,34 @@ export default class Vehicle {
         map.removeLayer(this.marker);
     }
 
-    public asJSON(): { id: number; tracker_id: string; name: string; enabled: boolean } {
+    // copies a vehicle's capacity, accessibility, make, model, license plate, styling, and group from JSON
+    public setDetails(details: VehicleDetails) {
+        this.capacity = details.capacity || 0;
+        this.wheelchair_accessible = details.wheelchair_accessible || false;
+        this.make = details.make || '';
+        this.model = details.model || '';
+        this.license_plate = details.license_plate || '';
+        this.color = details.color || '';
+        this.label = details.label || '';
+        this.icon = details.icon || '';
+        this.group_id = details.group_id || null;
+    }
+
+    public asJSON(): { id: number; tracker_id: string; name: string; enabled: boolean } & VehicleDetails {
         return {
             id: this.id,
             enabled: this.enabled,
             tracker_id: String(this.tracker_id),
             name: this.name,
+            capacity: this.capacity,
+            wheelchair_accessible: this.wheelchair_accessible,
+            make: this.make,
+            model: this.model,
+            license_plate: this.license_plate,
+            color: this.color,
+            label: this.label,
+            icon: this.icon,
+            group_id: this.group_id,
         };
     }
 
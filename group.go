@@ -0,0 +1,30 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// VehicleGroup organizes Vehicles that belong to the same operation, e.g. the
+// East Campus fleet or athletics charters, for deployments that track more
+// than one.
+type VehicleGroup struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+// VehicleGroupService is an interface for interacting with VehicleGroups.
+// Deleting a VehicleGroup removes its Vehicles from it.
+type VehicleGroupService interface {
+	VehicleGroup(id int64) (*VehicleGroup, error)
+	VehicleGroups() ([]*VehicleGroup, error)
+	CreateVehicleGroup(group *VehicleGroup) error
+	ModifyVehicleGroup(group *VehicleGroup) error
+	DeleteVehicleGroup(id int64) error
+}
+
+// ErrVehicleGroupNotFound indicates that a VehicleGroup is not in the service.
+var ErrVehicleGroupNotFound = errors.New("VehicleGroup not found")
@@ -0,0 +1,310 @@
+// Package gtfs reads static GTFS feeds so that their routes, stops, and
+// schedules can be imported into Shuttle Tracker.
+//
+// See https://developers.google.com/transit/gtfs/reference for the format.
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Feed is the subset of a static GTFS feed that Shuttle Tracker uses.
+type Feed struct {
+	Stops     []Stop
+	Routes    []Route
+	Trips     []Trip
+	StopTimes []StopTime
+	Services  []Service
+
+	// Shapes maps shape IDs to their points, in order.
+	Shapes map[string][]shuttletracker.Point
+}
+
+// Stop is a row of stops.txt.
+type Stop struct {
+	ID          string
+	Name        string
+	Description string
+	Latitude    float64
+	Longitude   float64
+}
+
+// Route is a row of routes.txt.
+type Route struct {
+	ID          string
+	ShortName   string
+	LongName    string
+	Description string
+
+	// Color is a six-digit hexadecimal color without a leading "#".
+	Color string
+}
+
+// Trip is a row of trips.txt.
+type Trip struct {
+	ID        string
+	RouteID   string
+	ServiceID string
+	ShapeID   string
+}
+
+// StopTime is a row of stop_times.txt.
+type StopTime struct {
+	TripID   string
+	StopID   string
+	Sequence int
+
+	// Arrival and Departure are offsets from midnight. They may exceed 24 hours
+	// for trips that run past midnight.
+	Arrival   time.Duration
+	Departure time.Duration
+}
+
+// Service is a row of calendar.txt.
+type Service struct {
+	ID   string
+	Days [7]bool
+}
+
+// ErrMissingFile indicates that a required file is not in a feed.
+var ErrMissingFile = errors.New("missing required GTFS file")
+
+// Parse reads a zipped GTFS feed. stops.txt, routes.txt, trips.txt, and
+// stop_times.txt are required; shapes.txt and calendar.txt are optional.
+func Parse(zr *zip.Reader) (*Feed, error) {
+	feed := &Feed{
+		Shapes: map[string][]shuttletracker.Point{},
+	}
+
+	err := readFile(zr, "stops.txt", true, func(row record) error {
+		// Skip stations, entrances, and other non-stop locations.
+		if t := row.get("location_type"); t != "" && t != "0" {
+			return nil
+		}
+		lat, err := row.float("stop_lat")
+		if err != nil {
+			return err
+		}
+		lon, err := row.float("stop_lon")
+		if err != nil {
+			return err
+		}
+		feed.Stops = append(feed.Stops, Stop{
+			ID:          row.get("stop_id"),
+			Name:        row.get("stop_name"),
+			Description: row.get("stop_desc"),
+			Latitude:    lat,
+			Longitude:   lon,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readFile(zr, "routes.txt", true, func(row record) error {
+		feed.Routes = append(feed.Routes, Route{
+			ID:          row.get("route_id"),
+			ShortName:   row.get("route_short_name"),
+			LongName:    row.get("route_long_name"),
+			Description: row.get("route_desc"),
+			Color:       row.get("route_color"),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readFile(zr, "trips.txt", true, func(row record) error {
+		feed.Trips = append(feed.Trips, Trip{
+			ID:        row.get("trip_id"),
+			RouteID:   row.get("route_id"),
+			ServiceID: row.get("service_id"),
+			ShapeID:   row.get("shape_id"),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readFile(zr, "stop_times.txt", true, func(row record) error {
+		seq, err := strconv.Atoi(row.get("stop_sequence"))
+		if err != nil {
+			return err
+		}
+		st := StopTime{
+			TripID:   row.get("trip_id"),
+			StopID:   row.get("stop_id"),
+			Sequence: seq,
+		}
+		// Times are only required for timepoints, so they may be empty.
+		if s := row.get("arrival_time"); s != "" {
+			st.Arrival, err = parseTime(s)
+			if err != nil {
+				return err
+			}
+		}
+		if s := row.get("departure_time"); s != "" {
+			st.Departure, err = parseTime(s)
+			if err != nil {
+				return err
+			}
+		}
+		feed.StopTimes = append(feed.StopTimes, st)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type shapePoint struct {
+		point    shuttletracker.Point
+		sequence int
+	}
+	shapePoints := map[string][]shapePoint{}
+	err = readFile(zr, "shapes.txt", false, func(row record) error {
+		lat, err := row.float("shape_pt_lat")
+		if err != nil {
+			return err
+		}
+		lon, err := row.float("shape_pt_lon")
+		if err != nil {
+			return err
+		}
+		seq, err := strconv.Atoi(row.get("shape_pt_sequence"))
+		if err != nil {
+			return err
+		}
+		id := row.get("shape_id")
+		shapePoints[id] = append(shapePoints[id], shapePoint{
+			point:    shuttletracker.Point{Latitude: lat, Longitude: lon},
+			sequence: seq,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for id, points := range shapePoints {
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].sequence < points[j].sequence
+		})
+		for _, p := range points {
+			feed.Shapes[id] = append(feed.Shapes[id], p.point)
+		}
+	}
+
+	// calendar.txt lists days starting with Monday, but time.Weekday starts with Sunday.
+	days := []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+	err = readFile(zr, "calendar.txt", false, func(row record) error {
+		service := Service{ID: row.get("service_id")}
+		for i, day := range days {
+			service.Days[i] = row.get(day) == "1"
+		}
+		feed.Services = append(feed.Services, service)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// record is a CSV row keyed by column name.
+type record map[string]string
+
+func (r record) get(column string) string {
+	return strings.TrimSpace(r[column])
+}
+
+func (r record) float(column string) (float64, error) {
+	return strconv.ParseFloat(r.get(column), 64)
+}
+
+// readFile calls fn with each row of the named file in the feed.
+func readFile(zr *zip.Reader, name string, required bool, fn func(row record) error) error {
+	var file *zip.File
+	for _, f := range zr.File {
+		// Some producers put the feed in a subdirectory of the zip.
+		if f.Name == name || strings.HasSuffix(f.Name, "/"+name) {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		if required {
+			return fmt.Errorf("%w: %s", ErrMissingFile, name)
+		}
+		return nil
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	r := csv.NewReader(rc)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	line := 1
+	for {
+		fields, err := r.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		line++
+
+		row := record{}
+		for i, field := range fields {
+			if i < len(header) {
+				row[header[i]] = field
+			}
+		}
+		if err = fn(row); err != nil {
+			return fmt.Errorf("%s line %d: %w", name, line, err)
+		}
+	}
+}
+
+// parseTime parses a GTFS time of the form HH:MM:SS as an offset from midnight.
+func parseTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var units [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		units[i] = n
+	}
+	return time.Duration(units[0])*time.Hour + time.Duration(units[1])*time.Minute + time.Duration(units[2])*time.Second, nil
+}
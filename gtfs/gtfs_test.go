@@ -0,0 +1,144 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func zipFeed(t *testing.T, files map[string]string) *zip.Reader {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, contents := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("unable to create %s: %s", name, err)
+		}
+		if _, err = f.Write([]byte(contents)); err != nil {
+			t.Fatalf("unable to write %s: %s", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("unable to close zip: %s", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("unable to read zip: %s", err)
+	}
+	return zr
+}
+
+var testFeed = map[string]string{
+	"stops.txt": "\ufeffstop_id,stop_name,stop_lat,stop_lon,location_type\n" +
+		"union,Student Union,42.73,-73.68,0\n" +
+		"blitman,Blitman,42.74,-73.69,\n" +
+		"station,Some Station,42.75,-73.70,1\n",
+	"routes.txt": "route_id,route_short_name,route_long_name,route_color\n" +
+		"west,W,West Route,FF0000\n",
+	"trips.txt": "route_id,service_id,trip_id,shape_id\n" +
+		"west,weekday,t1,s1\n" +
+		"west,weekday,t2,s1\n",
+	"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+		"t1,07:00:00,07:00:00,union,1\n" +
+		"t1,07:10:00,07:10:00,blitman,2\n" +
+		"t2,24:50:00,24:50:00,blitman,2\n" +
+		"t2,24:40:00,24:40:00,union,1\n",
+	"shapes.txt": "shape_id,shape_pt_lat,shape_pt_lon,shape_pt_sequence\n" +
+		"s1,2,2,2\n" +
+		"s1,1,1,1\n",
+	"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday\n" +
+		"weekday,1,0,0,0,0,0,0\n",
+}
+
+func TestParse(t *testing.T) {
+	feed, err := Parse(zipFeed(t, testFeed))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(feed.Stops) != 2 {
+		t.Errorf("got %d stops, expected 2", len(feed.Stops))
+	}
+	if feed.Stops[0].ID != "union" {
+		t.Errorf("got stop ID %q, expected \"union\"", feed.Stops[0].ID)
+	}
+	if len(feed.StopTimes) != 4 || feed.StopTimes[2].Arrival != 24*time.Hour+50*time.Minute {
+		t.Errorf("unexpected stop times: %+v", feed.StopTimes)
+	}
+	expectedShape := []shuttletracker.Point{{Latitude: 1, Longitude: 1}, {Latitude: 2, Longitude: 2}}
+	if len(feed.Shapes["s1"]) != 2 || feed.Shapes["s1"][0] != expectedShape[0] || feed.Shapes["s1"][1] != expectedShape[1] {
+		t.Errorf("got shape %+v, expected %+v", feed.Shapes["s1"], expectedShape)
+	}
+	if len(feed.Services) != 1 || !feed.Services[0].Days[time.Monday] || feed.Services[0].Days[time.Sunday] {
+		t.Errorf("unexpected services: %+v", feed.Services)
+	}
+}
+
+func TestParseMissingFile(t *testing.T) {
+	_, err := Parse(zipFeed(t, map[string]string{"stops.txt": "stop_id\n"}))
+	if !errors.Is(err, ErrMissingFile) {
+		t.Errorf("got error %v, expected %v", err, ErrMissingFile)
+	}
+}
+
+func TestImport(t *testing.T) {
+	feed, err := Parse(zipFeed(t, testFeed))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ms := &mock.ModelService{}
+	ms.RouteService.On("ImportRoutes", tmock.AnythingOfType("[]*shuttletracker.Stop"), tmock.AnythingOfType("[]*shuttletracker.Route")).Return(nil)
+
+	result, err := Import(feed, ms)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ms.RouteService.AssertNumberOfCalls(t, "ImportRoutes", 1)
+
+	if len(result.Stops) != 2 || result.Stops[0].ID != -1 || result.Stops[1].ID != -2 {
+		t.Fatalf("got stops %+v, expected two with placeholder IDs", result.Stops)
+	}
+	route := result.Routes[0]
+	if route.Name != "West Route" || route.Color != "#FF0000" || route.Enabled {
+		t.Errorf("unexpected route: %+v", route)
+	}
+	if len(route.StopIDs) != 2 || route.StopIDs[0] != -1 || route.StopIDs[1] != -2 {
+		t.Errorf("got stop IDs %v, expected [-1 -2]", route.StopIDs)
+	}
+	if len(route.Points) != 2 {
+		t.Errorf("got %d points, expected 2", len(route.Points))
+	}
+
+	// The second trip runs past midnight, so Monday's service ends on Tuesday.
+	if len(route.Schedule) != 1 {
+		t.Fatalf("got %d schedule intervals, expected 1", len(route.Schedule))
+	}
+	interval := route.Schedule[0]
+	if interval.StartDay != time.Monday || interval.StartTime.Hour() != 7 {
+		t.Errorf("got start %s %s, expected Monday 07:00", interval.StartDay, interval.StartTime.Format("15:04"))
+	}
+	if interval.EndDay != time.Tuesday || interval.EndTime.Hour() != 0 || interval.EndTime.Minute() != 50 {
+		t.Errorf("got end %s %s, expected Tuesday 00:50", interval.EndDay, interval.EndTime.Format("15:04"))
+	}
+}
+
+func TestImportError(t *testing.T) {
+	feed, err := Parse(zipFeed(t, testFeed))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ms := &mock.ModelService{}
+	ms.RouteService.On("ImportRoutes", tmock.Anything, tmock.Anything).Return(errors.New("database is down"))
+	if result, err := Import(feed, ms); err == nil || result != nil {
+		t.Errorf("got %+v, %v, expected an error", result, err)
+	}
+}
@@ -0,0 +1,179 @@
+package gtfs
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Imported route width and color, if the feed doesn't specify one. GTFS
+// defaults to white, which is invisible on our map.
+const (
+	defaultRouteWidth = 4
+	defaultRouteColor = "#000000"
+)
+
+// ImportResult summarizes what an import created.
+type ImportResult struct {
+	Routes []*shuttletracker.Route `json:"routes"`
+	Stops  []*shuttletracker.Stop  `json:"stops"`
+}
+
+// Import creates a Stop for each stop in the feed and a Route for each route.
+// A route's stops come from its trip with the most stops, its points from that
+// trip's shape (or from its stops if there is no shape), and its schedule from
+// the earliest and latest times its trips run on each day of the week.
+//
+// Imported routes are disabled so that administrators can review them first.
+// Everything is created at once, so nothing is created if anything fails.
+func Import(feed *Feed, ms shuttletracker.ModelService) (*ImportResult, error) {
+	result := &ImportResult{}
+
+	// Stops get placeholder IDs until they're created.
+	stopIDs := map[string]int64{}
+	stopPoints := map[string]shuttletracker.Point{}
+	for i, s := range feed.Stops {
+		stop := &shuttletracker.Stop{
+			ID:        -int64(i + 1),
+			Latitude:  s.Latitude,
+			Longitude: s.Longitude,
+		}
+		if s.Name != "" {
+			name := s.Name
+			stop.Name = &name
+		}
+		if s.Description != "" {
+			description := s.Description
+			stop.Description = &description
+		}
+		result.Stops = append(result.Stops, stop)
+		stopIDs[s.ID] = stop.ID
+		stopPoints[s.ID] = shuttletracker.Point{Latitude: s.Latitude, Longitude: s.Longitude}
+	}
+
+	tripStopTimes := map[string][]StopTime{}
+	for _, st := range feed.StopTimes {
+		tripStopTimes[st.TripID] = append(tripStopTimes[st.TripID], st)
+	}
+	for _, stopTimes := range tripStopTimes {
+		sort.SliceStable(stopTimes, func(i, j int) bool {
+			return stopTimes[i].Sequence < stopTimes[j].Sequence
+		})
+	}
+	routeTrips := map[string][]Trip{}
+	for _, trip := range feed.Trips {
+		routeTrips[trip.RouteID] = append(routeTrips[trip.RouteID], trip)
+	}
+	services := map[string]Service{}
+	for _, service := range feed.Services {
+		services[service.ID] = service
+	}
+
+	for _, r := range feed.Routes {
+		route := &shuttletracker.Route{
+			Name:        r.LongName,
+			Description: r.Description,
+			Color:       defaultRouteColor,
+			Width:       defaultRouteWidth,
+		}
+		if route.Name == "" {
+			route.Name = r.ShortName
+		}
+		if r.Color != "" {
+			route.Color = "#" + r.Color
+		}
+
+		trips := routeTrips[r.ID]
+		var representative *Trip
+		for i, trip := range trips {
+			if representative == nil || len(tripStopTimes[trip.ID]) > len(tripStopTimes[representative.ID]) {
+				representative = &trips[i]
+			}
+		}
+		if representative != nil {
+			for _, st := range tripStopTimes[representative.ID] {
+				id, ok := stopIDs[st.StopID]
+				if !ok {
+					continue
+				}
+				route.StopIDs = append(route.StopIDs, id)
+				if representative.ShapeID == "" || len(feed.Shapes[representative.ShapeID]) == 0 {
+					route.Points = append(route.Points, stopPoints[st.StopID])
+				}
+			}
+			if len(route.Points) == 0 {
+				route.Points = feed.Shapes[representative.ShapeID]
+			}
+		}
+		route.Schedule = schedule(trips, tripStopTimes, services)
+
+		result.Routes = append(result.Routes, route)
+	}
+
+	if err := ms.ImportRoutes(result.Stops, result.Routes); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// schedule returns one interval for each day of the week that any of the trips
+// run, spanning from the first departure to the last arrival.
+func schedule(trips []Trip, tripStopTimes map[string][]StopTime, services map[string]Service) shuttletracker.RouteSchedule {
+	type span struct {
+		start, end time.Duration
+		ok         bool
+	}
+	var spans [7]span
+	for _, trip := range trips {
+		service, ok := services[trip.ServiceID]
+		stopTimes := tripStopTimes[trip.ID]
+		if !ok || len(stopTimes) == 0 {
+			continue
+		}
+		start := stopTimes[0].Departure
+		end := stopTimes[len(stopTimes)-1].Arrival
+		for day, runs := range service.Days {
+			if !runs {
+				continue
+			}
+			s := &spans[day]
+			if !s.ok || start < s.start {
+				s.start = start
+			}
+			if !s.ok || end > s.end {
+				s.end = end
+			}
+			s.ok = true
+		}
+	}
+
+	// Times are stored without a date, so any day works as long as it isn't
+	// affected by daylight saving time.
+	midnight := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.Local)
+	const oneDay = 24 * time.Hour
+	var sched shuttletracker.RouteSchedule
+	for day, s := range spans {
+		if !s.ok || s.end <= s.start {
+			continue
+		}
+		// Service may run past midnight, but our schedules can't wrap from
+		// Saturday to Sunday, so it's cut off just before midnight instead.
+		startDay, startTime := day+int(s.start/oneDay), s.start%oneDay
+		endDay, endTime := day+int(s.end/oneDay), s.end%oneDay
+		if startDay > int(time.Saturday) {
+			continue
+		}
+		if endDay > int(time.Saturday) {
+			endDay, endTime = int(time.Saturday), oneDay-time.Second
+		}
+		interval := shuttletracker.RouteActiveInterval{
+			StartDay:  time.Weekday(startDay),
+			StartTime: midnight.Add(startTime),
+			EndDay:    time.Weekday(endDay),
+			EndTime:   midnight.Add(endTime),
+		}
+		sched = append(sched, interval)
+	}
+	return sched
+}
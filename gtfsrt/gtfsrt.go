@@ -0,0 +1,213 @@
+// Package gtfsrt encodes GTFS-realtime feeds. It implements only the subset of
+// gtfs-realtime.proto that Shuttle Tracker produces, and writes the protobuf wire
+// format directly so that we don't need generated code.
+//
+// Field numbers come from https://github.com/google/transit/blob/master/gtfs-realtime/proto/gtfs-realtime.proto
+package gtfsrt
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Version is the GTFS-realtime specification version that we produce.
+const Version = "2.0"
+
+// FeedMessage is the top-level GTFS-realtime message.
+type FeedMessage struct {
+	Header   FeedHeader
+	Entities []FeedEntity
+}
+
+// FeedHeader contains metadata about a feed. Incrementality is always FULL_DATASET.
+type FeedHeader struct {
+	// Timestamp is when the feed was created, in seconds since the Unix epoch.
+	Timestamp uint64
+}
+
+// FeedEntity is a single update in a feed. Exactly one of its pointers should be set.
+type FeedEntity struct {
+	ID         string
+	TripUpdate *TripUpdate
+	Vehicle    *VehiclePosition
+}
+
+// TripUpdate contains predicted arrival times for a vehicle at upcoming stops.
+type TripUpdate struct {
+	Trip            TripDescriptor
+	Vehicle         *VehicleDescriptor
+	StopTimeUpdates []StopTimeUpdate
+
+	// Timestamp is when the predictions were made, in seconds since the Unix epoch.
+	Timestamp uint64
+}
+
+// StopTimeUpdate is a predicted arrival at a single stop.
+type StopTimeUpdate struct {
+	StopID  string
+	Arrival StopTimeEvent
+}
+
+// StopTimeEvent is a predicted time, in seconds since the Unix epoch.
+type StopTimeEvent struct {
+	Time int64
+}
+
+// VehiclePosition is the realtime position of a vehicle.
+type VehiclePosition struct {
+	Trip     *TripDescriptor
+	Vehicle  *VehicleDescriptor
+	Position *Position
+
+	// Timestamp is when the position was measured, in seconds since the Unix epoch.
+	Timestamp uint64
+}
+
+// TripDescriptor identifies the trip that a vehicle is serving. We don't have
+// GTFS trips, so only the route is provided.
+type TripDescriptor struct {
+	RouteID string
+}
+
+// VehicleDescriptor identifies a vehicle.
+type VehicleDescriptor struct {
+	ID    string
+	Label string
+}
+
+// Position is a geographic position of a vehicle.
+type Position struct {
+	Latitude  float32
+	Longitude float32
+
+	// Bearing is in degrees clockwise from true north.
+	Bearing float32
+
+	// Speed is in meters per second.
+	Speed float32
+}
+
+// Marshal encodes a FeedMessage in the protobuf wire format.
+func (fm *FeedMessage) Marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 1, fm.Header.marshal())
+	for i := range fm.Entities {
+		b = appendMessage(b, 2, fm.Entities[i].marshal())
+	}
+	return b
+}
+
+func (fh *FeedHeader) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, Version)
+	// incrementality (2) is FULL_DATASET, which is the default, so it's omitted.
+	b = appendVarint(b, 3, fh.Timestamp)
+	return b
+}
+
+func (fe *FeedEntity) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, fe.ID)
+	if fe.TripUpdate != nil {
+		b = appendMessage(b, 3, fe.TripUpdate.marshal())
+	}
+	if fe.Vehicle != nil {
+		b = appendMessage(b, 4, fe.Vehicle.marshal())
+	}
+	return b
+}
+
+func (tu *TripUpdate) marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 1, tu.Trip.marshal())
+	for i := range tu.StopTimeUpdates {
+		b = appendMessage(b, 2, tu.StopTimeUpdates[i].marshal())
+	}
+	if tu.Vehicle != nil {
+		b = appendMessage(b, 3, tu.Vehicle.marshal())
+	}
+	if tu.Timestamp != 0 {
+		b = appendVarint(b, 4, tu.Timestamp)
+	}
+	return b
+}
+
+func (stu *StopTimeUpdate) marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 2, stu.Arrival.marshal())
+	b = appendString(b, 4, stu.StopID)
+	return b
+}
+
+func (ste *StopTimeEvent) marshal() []byte {
+	var b []byte
+	// time is an int64, which is encoded as a plain (not zigzag) varint.
+	b = appendVarint(b, 2, uint64(ste.Time))
+	return b
+}
+
+func (vp *VehiclePosition) marshal() []byte {
+	var b []byte
+	if vp.Trip != nil {
+		b = appendMessage(b, 1, vp.Trip.marshal())
+	}
+	if vp.Position != nil {
+		b = appendMessage(b, 2, vp.Position.marshal())
+	}
+	if vp.Timestamp != 0 {
+		b = appendVarint(b, 5, vp.Timestamp)
+	}
+	if vp.Vehicle != nil {
+		b = appendMessage(b, 8, vp.Vehicle.marshal())
+	}
+	return b
+}
+
+func (td *TripDescriptor) marshal() []byte {
+	var b []byte
+	if td.RouteID != "" {
+		b = appendString(b, 5, td.RouteID)
+	}
+	return b
+}
+
+func (vd *VehicleDescriptor) marshal() []byte {
+	var b []byte
+	if vd.ID != "" {
+		b = appendString(b, 1, vd.ID)
+	}
+	if vd.Label != "" {
+		b = appendString(b, 2, vd.Label)
+	}
+	return b
+}
+
+func (p *Position) marshal() []byte {
+	var b []byte
+	b = appendFloat(b, 1, p.Latitude)
+	b = appendFloat(b, 2, p.Longitude)
+	b = appendFloat(b, 3, p.Bearing)
+	b = appendFloat(b, 5, p.Speed)
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendFloat(b []byte, num protowire.Number, f float32) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+	return protowire.AppendFixed32(b, math.Float32bits(f))
+}
@@ -0,0 +1,99 @@
+package gtfsrt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMarshalEmptyFeed(t *testing.T) {
+	fm := &FeedMessage{
+		Header: FeedHeader{Timestamp: 1},
+	}
+	// header (1): version (1) "2.0", timestamp (3) 1
+	expected := []byte{0x0a, 0x07, 0x0a, 0x03, '2', '.', '0', 0x18, 0x01}
+	actual := fm.Marshal()
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("got %x, expected %x", actual, expected)
+	}
+}
+
+func TestMarshalVehiclePosition(t *testing.T) {
+	fm := &FeedMessage{
+		Header: FeedHeader{Timestamp: 1},
+		Entities: []FeedEntity{
+			{
+				ID: "4",
+				Vehicle: &VehiclePosition{
+					Trip:    &TripDescriptor{RouteID: "1"},
+					Vehicle: &VehicleDescriptor{ID: "4"},
+					Position: &Position{
+						Latitude:  1,
+						Longitude: 1,
+					},
+					Timestamp: 2,
+				},
+			},
+		},
+	}
+
+	expected := []byte{
+		0x0a, 0x07, 0x0a, 0x03, '2', '.', '0', 0x18, 0x01,
+		// entity (2)
+		0x12, 0x27,
+		// id (1)
+		0x0a, 0x01, '4',
+		// vehicle (4)
+		0x22, 0x22,
+		// trip (1) with route_id (5)
+		0x0a, 0x03, 0x2a, 0x01, '1',
+		// position (2): latitude, longitude, bearing, speed
+		0x12, 0x14,
+		0x0d, 0x00, 0x00, 0x80, 0x3f,
+		0x15, 0x00, 0x00, 0x80, 0x3f,
+		0x1d, 0x00, 0x00, 0x00, 0x00,
+		0x2d, 0x00, 0x00, 0x00, 0x00,
+		// timestamp (5)
+		0x28, 0x02,
+		// vehicle (8) with id (1)
+		0x42, 0x03, 0x0a, 0x01, '4',
+	}
+	actual := fm.Marshal()
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("got %x, expected %x", actual, expected)
+	}
+}
+
+func TestMarshalTripUpdate(t *testing.T) {
+	fm := &FeedMessage{
+		Header: FeedHeader{Timestamp: 1},
+		Entities: []FeedEntity{
+			{
+				ID: "4",
+				TripUpdate: &TripUpdate{
+					Trip: TripDescriptor{RouteID: "1"},
+					StopTimeUpdates: []StopTimeUpdate{
+						{StopID: "7", Arrival: StopTimeEvent{Time: 3}},
+					},
+				},
+			},
+		},
+	}
+
+	expected := []byte{
+		0x0a, 0x07, 0x0a, 0x03, '2', '.', '0', 0x18, 0x01,
+		// entity (2)
+		0x12, 0x13,
+		// id (1)
+		0x0a, 0x01, '4',
+		// trip_update (3)
+		0x1a, 0x0e,
+		// trip (1) with route_id (5)
+		0x0a, 0x03, 0x2a, 0x01, '1',
+		// stop_time_update (2): arrival (2) with time (2), stop_id (4)
+		0x12, 0x07, 0x12, 0x02, 0x10, 0x03, 0x22, 0x01, '7',
+	}
+	actual := fm.Marshal()
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("got %x, expected %x", actual, expected)
+	}
+}
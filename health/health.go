@@ -0,0 +1,121 @@
+// Package health keeps track of whether each subsystem is working so that
+// others can degrade gracefully when one isn't, e.g. by serving cached
+// responses instead of errors while the database is down.
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/metrics"
+)
+
+// Components that report their health.
+const (
+	Database  = "database"
+	Updater   = "updater"
+	ETA       = "eta"
+	Fusion    = "fusion"
+	Notifiers = "notifiers"
+)
+
+// State is how well a component is working.
+type State string
+
+// A Degraded component is still partly working, e.g. some of its requests
+// fail. A Down component isn't working at all.
+const (
+	OK       State = "ok"
+	Degraded State = "degraded"
+	Down     State = "down"
+)
+
+// Component is the most recently reported health of a subsystem.
+type Component struct {
+	Name    string    `json:"name"`
+	State   State     `json:"state"`
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since"`
+	Updated time.Time `json:"updated"`
+}
+
+var (
+	lock       sync.Mutex
+	components = map[string]*Component{}
+)
+
+// Report sets a component's state. It's healthy if err is nil and down otherwise.
+func Report(name string, err error) {
+	if err != nil {
+		set(name, Down, err.Error())
+		return
+	}
+	set(name, OK, "")
+}
+
+// ReportDegraded marks a component as degraded if err isn't nil, or healthy otherwise.
+func ReportDegraded(name string, err error) {
+	if err != nil {
+		set(name, Degraded, err.Error())
+		return
+	}
+	set(name, OK, "")
+}
+
+func set(name string, state State, message string) {
+	now := time.Now()
+	lock.Lock()
+	c, ok := components[name]
+	if !ok {
+		c = &Component{Name: name, State: OK, Since: now}
+		components[name] = c
+	}
+	changed := c.State != state
+	if changed {
+		c.Since = now
+	}
+	c.State = state
+	c.Message = message
+	c.Updated = now
+	lock.Unlock()
+
+	if state == OK {
+		metrics.ComponentHealthy.WithLabelValues(name).Set(1)
+	} else {
+		metrics.ComponentHealthy.WithLabelValues(name).Set(0)
+	}
+	if !changed {
+		return
+	}
+	entry := log.WithField("component", name).WithField("state", state)
+	if state == OK {
+		entry.Info("component recovered")
+	} else {
+		entry.WithField("message", message).Warn("component is unhealthy")
+	}
+}
+
+// Healthy reports whether a component is OK. Components that haven't
+// reported yet are assumed to be healthy.
+func Healthy(name string) bool {
+	lock.Lock()
+	defer lock.Unlock()
+	c, ok := components[name]
+	return !ok || c.State == OK
+}
+
+// Components returns the health of every component that has reported, by name.
+func Components() []Component {
+	lock.Lock()
+	defer lock.Unlock()
+	cs := make([]Component, 0, len(components))
+	for _, c := range components {
+		cs = append(cs, *c)
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].Name < cs[j].Name
+	})
+	return cs
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	defer func() {
+		components = map[string]*Component{}
+	}()
+
+	if !Healthy(Database) {
+		t.Error("expected component that hasn't reported to be healthy")
+	}
+
+	Report(Database, errors.New("connection refused"))
+	ReportDegraded(Fusion, errors.New("unable to broadcast"))
+	Report(Updater, nil)
+	if Healthy(Database) || Healthy(Fusion) || !Healthy(Updater) {
+		t.Errorf("got %+v", Components())
+	}
+
+	cs := Components()
+	if len(cs) != 3 {
+		t.Fatalf("got %d components, expected 3", len(cs))
+	}
+	if cs[0].Name != Database || cs[0].State != Down || cs[0].Message != "connection refused" {
+		t.Errorf("got %+v", cs[0])
+	}
+	if cs[1].Name != Fusion || cs[1].State != Degraded {
+		t.Errorf("got %+v", cs[1])
+	}
+
+	since := cs[0].Since
+	Report(Database, errors.New("connection refused"))
+	if c := Components()[0]; !c.Since.Equal(since) {
+		t.Error("expected Since not to change when state doesn't")
+	}
+	Report(Database, nil)
+	if c := Components()[0]; c.State != OK || c.Message != "" || c.Since.Equal(since) {
+		t.Errorf("got %+v", c)
+	}
+}
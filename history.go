@@ -0,0 +1,27 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// HistoryFilter selects historical records, such as Locations or Arrivals,
+// from Since (inclusive) until Until (exclusive). A nil ID matches every
+// Vehicle, Route, Stop, or VehicleGroup.
+type HistoryFilter struct {
+	Since     time.Time
+	Until     time.Time
+	VehicleID *int64
+	RouteID   *int64
+	StopID    *int64
+
+	// GroupID selects the records of Vehicles in a VehicleGroup.
+	GroupID *int64
+}
+
+// MatchesVehicle returns whether the filter's VehicleID and GroupID select a Vehicle.
+func (f HistoryFilter) MatchesVehicle(v *Vehicle) bool {
+	if f.VehicleID != nil && v.ID != *f.VehicleID {
+		return false
+	}
+	return f.GroupID == nil || (v.GroupID != nil && *v.GroupID == *f.GroupID)
+}
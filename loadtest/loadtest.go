@@ -0,0 +1,245 @@
+// Package loadtest simulates many Shuttle Tracker clients against a running
+// instance so that its capacity can be checked before busy periods.
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Config describes the load to generate.
+type Config struct {
+	// Target is the base URL of the instance, e.g. https://shuttles.rpi.edu.
+	Target string
+
+	// Subscribers is how many Fusion websocket clients subscribe to vehicle locations.
+	Subscribers int
+
+	// Pollers is how many clients repeatedly request Paths, in turn, every PollInterval.
+	Pollers      int
+	PollInterval time.Duration
+	Paths        []string
+
+	// Duration is how long to generate load.
+	Duration time.Duration
+}
+
+// Report contains the latencies observed during a load test.
+type Report struct {
+	// Connect is how long it took for a websocket to be ready.
+	Connect Summary
+
+	// Subscribe is how long it took to receive the first vehicle location after subscribing.
+	Subscribe Summary
+
+	// Delivery is how long vehicle locations created during the test took to
+	// reach subscribers. It assumes that both machines' clocks are in sync.
+	Delivery Summary
+
+	// Poll contains the latencies of each path.
+	Poll map[string]Summary
+}
+
+type fusionEnvelope struct {
+	Type    string          `json:"type"`
+	Message json.RawMessage `json:"message"`
+}
+
+type fusionSubscribe struct {
+	Type    string            `json:"type"`
+	Message map[string]string `json:"message"`
+}
+
+type fusionLocation struct {
+	Created time.Time `json:"created"`
+}
+
+type tester struct {
+	cfg    Config
+	wsURL  string
+	client *http.Client
+
+	connect   latencies
+	subscribe latencies
+	delivery  latencies
+	poll      map[string]*latencies
+}
+
+// Run generates load against cfg.Target until cfg.Duration has passed or ctx
+// is cancelled.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	target, err := url.Parse(cfg.Target)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, errors.New("target must be an http or https URL")
+	}
+	if cfg.Pollers > 0 && (len(cfg.Paths) == 0 || cfg.PollInterval <= 0) {
+		return nil, errors.New("pollers need paths and a positive interval")
+	}
+	wsURL := *target
+	wsURL.Scheme = strings.Replace(target.Scheme, "http", "ws", 1)
+	wsURL.Path = strings.TrimSuffix(target.Path, "/") + "/fusion/"
+
+	t := &tester{
+		cfg:    cfg,
+		wsURL:  wsURL.String(),
+		client: &http.Client{Timeout: 10 * time.Second},
+		poll:   map[string]*latencies{},
+	}
+	for _, path := range cfg.Paths {
+		t.poll[path] = &latencies{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < cfg.Subscribers; i++ {
+		wg.Add(1)
+		go func() {
+			t.subscriber(ctx)
+			wg.Done()
+		}()
+	}
+	for i := 0; i < cfg.Pollers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			t.poller(ctx, i)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+
+	report := &Report{
+		Connect:   t.connect.summary(),
+		Subscribe: t.subscribe.summary(),
+		Delivery:  t.delivery.summary(),
+		Poll:      map[string]Summary{},
+	}
+	for path, l := range t.poll {
+		report.Poll[path] = l.summary()
+	}
+	return report, nil
+}
+
+// subscriber connects to Fusion, subscribes to vehicle locations, and reads
+// until ctx is done.
+func (t *tester) subscriber(ctx context.Context) {
+	start := time.Now()
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, t.wsURL, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			t.connect.fail()
+		}
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	// the server sends its ID once the client is registered
+	fe := fusionEnvelope{}
+	if err := conn.ReadJSON(&fe); err != nil || fe.Type != "server_id" {
+		if ctx.Err() == nil {
+			t.connect.fail()
+		}
+		return
+	}
+	t.connect.record(time.Since(start))
+
+	subscribed := time.Now()
+	sub := fusionSubscribe{Type: "subscribe", Message: map[string]string{"topic": "vehicle_location"}}
+	if err := conn.WriteJSON(sub); err != nil {
+		if ctx.Err() == nil {
+			t.subscribe.fail()
+		}
+		return
+	}
+
+	received := false
+	for {
+		fe := fusionEnvelope{}
+		if err := conn.ReadJSON(&fe); err != nil {
+			if ctx.Err() == nil {
+				t.delivery.fail()
+			}
+			return
+		}
+		if fe.Type != "vehicle_location" {
+			continue
+		}
+		now := time.Now()
+		if !received {
+			received = true
+			t.subscribe.record(now.Sub(subscribed))
+		}
+
+		// locations sent when subscribing were created before the test
+		loc := fusionLocation{}
+		if err := json.Unmarshal(fe.Message, &loc); err != nil {
+			t.delivery.fail()
+			continue
+		}
+		if loc.Created.After(subscribed) {
+			t.delivery.record(now.Sub(loc.Created))
+		}
+	}
+}
+
+// poller requests each path in turn until ctx is done. Pollers start at
+// different paths so that load is spread across them.
+func (t *tester) poller(ctx context.Context, n int) {
+	ticker := time.NewTicker(t.cfg.PollInterval)
+	defer ticker.Stop()
+	for i := n; ; i++ {
+		path := t.cfg.Paths[i%len(t.cfg.Paths)]
+		t.get(ctx, path)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *tester) get(ctx context.Context, path string) {
+	l := t.poll[path]
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(t.cfg.Target, "/")+path, nil)
+	if err != nil {
+		l.fail()
+		return
+	}
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			l.fail()
+		}
+		return
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		if ctx.Err() == nil {
+			l.fail()
+		}
+		return
+	}
+	l.record(time.Since(start))
+}
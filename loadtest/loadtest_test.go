@@ -0,0 +1,118 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPercentile(t *testing.T) {
+	l := &latencies{}
+	for i := 100; i > 0; i-- {
+		l.record(time.Duration(i) * time.Millisecond)
+	}
+	l.fail()
+
+	s := l.summary()
+	expected := Summary{
+		Count:  100,
+		Errors: 1,
+		P50:    50 * time.Millisecond,
+		P90:    90 * time.Millisecond,
+		P99:    99 * time.Millisecond,
+		Max:    100 * time.Millisecond,
+	}
+	if s != expected {
+		t.Errorf("got %+v, expected %+v", s, expected)
+	}
+
+	if s := (&latencies{}).summary(); s != (Summary{}) {
+		t.Errorf("expected empty summary, got %+v", s)
+	}
+}
+
+// fakeFusion sends a vehicle location when a client subscribes and a new one
+// every 10 ms after that.
+func fakeFusion(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	send := func(typ string, msg interface{}) error {
+		b, _ := json.Marshal(msg)
+		return conn.WriteJSON(fusionEnvelope{Type: typ, Message: b})
+	}
+	if err := send("server_id", "test"); err != nil {
+		return
+	}
+	sub := fusionSubscribe{}
+	if err := conn.ReadJSON(&sub); err != nil {
+		return
+	}
+	if err := send("vehicle_location", fusionLocation{Created: time.Now().Add(-time.Hour)}); err != nil {
+		return
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := send("vehicle_location", fusionLocation{Created: time.Now()}); err != nil {
+			return
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fusion/", fakeFusion)
+	mux.HandleFunc("/vehicles", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("[]"))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	report, err := Run(context.Background(), Config{
+		Target:       server.URL,
+		Subscribers:  3,
+		Pollers:      2,
+		PollInterval: 10 * time.Millisecond,
+		Paths:        []string{"/vehicles", "/broken"},
+		Duration:     200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if report.Connect.Count != 3 || report.Connect.Errors != 0 {
+		t.Errorf("unexpected connect summary: %+v", report.Connect)
+	}
+	if report.Subscribe.Count != 3 {
+		t.Errorf("unexpected subscribe summary: %+v", report.Subscribe)
+	}
+	if report.Delivery.Count == 0 || report.Delivery.Max > time.Minute {
+		t.Errorf("unexpected delivery summary: %+v", report.Delivery)
+	}
+	if report.Poll["/vehicles"].Count == 0 || report.Poll["/vehicles"].Errors != 0 {
+		t.Errorf("unexpected /vehicles summary: %+v", report.Poll["/vehicles"])
+	}
+	if report.Poll["/broken"].Count != 0 || report.Poll["/broken"].Errors == 0 {
+		t.Errorf("unexpected /broken summary: %+v", report.Poll["/broken"])
+	}
+}
+
+func TestRunInvalidTarget(t *testing.T) {
+	_, err := Run(context.Background(), Config{Target: "ftp://example.com", Duration: time.Second})
+	if err == nil {
+		t.Error("expected error for non-HTTP target")
+	}
+}
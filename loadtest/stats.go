@@ -0,0 +1,63 @@
+package loadtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Summary describes the latencies of one kind of operation.
+type Summary struct {
+	Count  int
+	Errors int
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// latencies collects samples from many goroutines.
+type latencies struct {
+	lock    sync.Mutex
+	samples []time.Duration
+	errors  int
+}
+
+func (l *latencies) record(d time.Duration) {
+	l.lock.Lock()
+	l.samples = append(l.samples, d)
+	l.lock.Unlock()
+}
+
+func (l *latencies) fail() {
+	l.lock.Lock()
+	l.errors++
+	l.lock.Unlock()
+}
+
+func (l *latencies) summary() Summary {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	s := Summary{Count: len(l.samples), Errors: l.errors}
+	if len(l.samples) == 0 {
+		return s
+	}
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.P50 = percentile(sorted, 50)
+	s.P90 = percentile(sorted, 90)
+	s.P99 = percentile(sorted, 99)
+	s.Max = sorted[len(sorted)-1]
+	return s
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -1,7 +1,9 @@
 package shuttletracker
 
 import (
+	"context"
 	"errors"
+	"math"
 	"time"
 )
 
@@ -21,6 +23,26 @@ type Location struct {
 
 	// RouteID is a pointer to an int64 because it may be null.
 	RouteID *int64 `json:"route_id"`
+
+	// Occupancy is how full riders say the vehicle is, or empty if nobody
+	// has said recently. It isn't stored with the location; the API sets it
+	// from riders' reports.
+	Occupancy string `json:"occupancy"`
+}
+
+// EarthRadius is the Earth's mean radius in meters.
+const EarthRadius = 6371000.0
+
+// DistanceBetween returns the great-circle distance in meters between two
+// positions in degrees.
+func DistanceBetween(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := phi2 - phi1
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(a))
 }
 
 // LocationService is an interface for interacting with information about vehicle positions.
@@ -30,8 +52,21 @@ type LocationService interface {
 	LocationsSince(vehicleID int64, since time.Time) ([]*Location, error)
 	LatestLocation(vehicleID int64) (*Location, error)
 	LatestLocations() ([]*Location, error)
+
+	// LocationsSinceContext and LatestLocationsContext make their queries
+	// part of ctx's trace.
+	LocationsSinceContext(ctx context.Context, vehicleID int64, since time.Time) ([]*Location, error)
+	LatestLocationsContext(ctx context.Context) ([]*Location, error)
+
 	Location(id int64) (*Location, error)
 	SubscribeLocations() chan *Location
+
+	// PublishLocation sends a Location to subscribers without storing it.
+	PublishLocation(location *Location) error
+
+	// ExportLocations calls fn with each Location matching the filter, oldest
+	// first, without loading them all into memory.
+	ExportLocations(filter HistoryFilter, fn func(*Location) error) error
 }
 
 var (
@@ -1,9 +1,12 @@
 package log
 
 import (
+	"context"
+	"os"
 	"path"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -15,10 +18,34 @@ var (
 
 type Config struct {
 	Level string
+
+	// Format is either "text" or "json". JSON logs have one object per line
+	// so that they can be ingested by log aggregators.
+	Format string
+
+	// Output is either "stderr" or "stdout".
+	Output string
+
+	// SentryDSN enables sending errors to Sentry. SentryEnvironment
+	// distinguishes e.g. production from staging.
+	SentryDSN         string
+	SentryEnvironment string
 }
 
+// Field names used throughout Shuttle Tracker so that structured logs can be
+// searched consistently.
+const (
+	VehicleIDField = "vehicle_id"
+	RouteIDField   = "route_id"
+	RequestIDField = "request_id"
+)
+
 type Fields map[string]interface{}
 
+type contextKey int
+
+const requestIDKey contextKey = iota
+
 func init() {
 	logger = logrus.New()
 }
@@ -26,9 +53,15 @@ func init() {
 // NewConfig creates a new Config.
 func NewConfig(v *viper.Viper) *Config {
 	cfg := &Config{
-		Level: "info",
+		Level:  "info",
+		Format: "text",
+		Output: "stderr",
 	}
 	v.SetDefault("log.level", cfg.Level)
+	v.SetDefault("log.format", cfg.Format)
+	v.SetDefault("log.output", cfg.Output)
+	v.SetDefault("log.sentrydsn", cfg.SentryDSN)
+	v.SetDefault("log.sentryenvironment", cfg.SentryEnvironment)
 	return cfg
 }
 
@@ -41,6 +74,49 @@ func SetLevel(level string) {
 	logger.Level = parsed
 }
 
+// SetFormat sets how log entries are written. It accepts "text" or "json".
+func SetFormat(format string) {
+	switch format {
+	case "text":
+		logger.Formatter = &logrus.TextFormatter{}
+	case "json":
+		logger.Formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	default:
+		Errorf("unknown log format \"%s\"", format)
+	}
+}
+
+// SetOutput sets where log entries are written. It accepts "stderr" or "stdout".
+func SetOutput(output string) {
+	switch output {
+	case "stderr":
+		logger.Out = os.Stderr
+	case "stdout":
+		logger.Out = os.Stdout
+	default:
+		Errorf("unknown log output \"%s\"", output)
+	}
+}
+
+// EnableSentry sends every error that is logged to Sentry.
+func EnableSentry(dsn, environment string) {
+	hook, err := newSentryHook(dsn, environment)
+	if err != nil {
+		WithError(err).Error("unable to enable Sentry")
+		return
+	}
+	logger.Hooks.Add(hook)
+	sentry = hook
+}
+
+// Flush waits up to timeout for errors that have been logged to be sent to
+// Sentry. It should be called before exiting.
+func Flush(timeout time.Duration) {
+	if sentry != nil {
+		sentry.flush(timeout)
+	}
+}
+
 func contextFields(lvl ...int) Fields {
 	level := 2
 	if len(lvl) == 1 {
@@ -73,6 +149,37 @@ func WithFields(f ...Fields) *logrus.Entry {
 	return e
 }
 
+// WithVehicleID returns an entry about a Vehicle.
+func WithVehicleID(id int64) *logrus.Entry {
+	return WithFields(contextFields()).WithField(VehicleIDField, id)
+}
+
+// WithRouteID returns an entry about a Route.
+func WithRouteID(id int64) *logrus.Entry {
+	return WithFields(contextFields()).WithField(RouteIDField, id)
+}
+
+// ContextWithRequestID returns a copy of ctx that carries a request ID, which
+// is added to entries created with WithContext.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithContext returns an entry that includes the request ID carried by ctx.
+func WithContext(ctx context.Context) *logrus.Entry {
+	e := WithFields(contextFields())
+	if id := RequestID(ctx); id != "" {
+		e = e.WithField(RequestIDField, id)
+	}
+	return e
+}
+
 func WithError(err error) *logrus.Entry {
 	return WithFields(contextFields()).WithField("error", err)
 }
@@ -0,0 +1,53 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSONFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out := logger.Out
+	logger.Out = buf
+	defer func() {
+		logger.Out = out
+		SetFormat("text")
+	}()
+
+	SetFormat("json")
+	WithVehicleID(4).WithError(errors.New("oops")).Error("unable to do something")
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unable to unmarshal %q: %s", buf.String(), err)
+	}
+	expected := map[string]interface{}{
+		"msg":          "unable to do something",
+		"level":        "error",
+		"error":        "oops",
+		VehicleIDField: float64(4),
+		"package":      "log",
+		"file":         "log_test.go",
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("got %s %v, expected %v", k, entry[k], v)
+		}
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out := logger.Out
+	logger.Out = buf
+	defer func() { logger.Out = out }()
+
+	SetFormat("text")
+	WithRouteID(2).Error("something happened")
+	if !strings.Contains(buf.String(), RouteIDField+"=2") {
+		t.Errorf("expected route ID in %q", buf.String())
+	}
+}
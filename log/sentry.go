@@ -0,0 +1,276 @@
+package log
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// sentryQueueSize is how many events can wait to be sent before new ones are dropped.
+const sentryQueueSize = 100
+
+// modulePath identifies Shuttle Tracker's own stack frames.
+const modulePath = "github.com/wtg/shuttletracker"
+
+// sentry is the hook added by EnableSentry, if any.
+var sentry *sentryHook
+
+// sentryTags are fields that are sent as tags so that events can be searched by them.
+var sentryTags = []string{"package", VehicleIDField, RouteIDField, RequestIDField}
+
+// sentryHook sends error entries to Sentry, or anything compatible with its
+// store API, along with a stack trace and the entry's fields.
+type sentryHook struct {
+	storeURL    string
+	auth        string
+	environment string
+	client      *http.Client
+	events      chan *sentryEvent
+
+	// pending counts events that have been queued but not yet sent.
+	pending sync.WaitGroup
+}
+
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger"`
+	Platform    string                 `json:"platform"`
+	Message     string                 `json:"message"`
+	Culprit     string                 `json:"culprit,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Tags        map[string]string      `json:"tags"`
+	Extra       map[string]interface{} `json:"extra"`
+	Exception   *sentryException       `json:"exception,omitempty"`
+}
+
+type sentryException struct {
+	Values []sentryExceptionValue `json:"values"`
+}
+
+type sentryExceptionValue struct {
+	Type       string           `json:"type"`
+	Value      string           `json:"value"`
+	Stacktrace sentryStacktrace `json:"stacktrace"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// newSentryHook creates a sentryHook from a DSN of the form
+// https://public_key@host/project_id.
+func newSentryHook(dsn, environment string) (*sentryHook, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, errors.New("Sentry DSN must include a public key and project ID")
+	}
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=shuttletracker/1.0, sentry_key=%s", u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+
+	sh := &sentryHook{
+		storeURL:    fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		auth:        auth,
+		environment: environment,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		events:      make(chan *sentryEvent, sentryQueueSize),
+	}
+	go sh.run()
+	return sh, nil
+}
+
+func (sh *sentryHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+// Fire queues an event for the entry. It doesn't block, since entries are
+// logged from request handlers.
+func (sh *sentryHook) Fire(entry *logrus.Entry) error {
+	event := sh.event(entry)
+	sh.pending.Add(1)
+	select {
+	case sh.events <- event:
+	default:
+		sh.pending.Done()
+		// Warn doesn't fire this hook, so this can't loop.
+		logger.Warn("Sentry queue is full; dropping event")
+	}
+	return nil
+}
+
+// flush waits until every queued event has been sent or timeout has passed.
+func (sh *sentryHook) flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		sh.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logger.Warn("timed out sending events to Sentry")
+	}
+}
+
+func (sh *sentryHook) event(entry *logrus.Entry) *sentryEvent {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	hostname, _ := os.Hostname()
+
+	event := &sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   entry.Time.UTC().Format("2006-01-02T15:04:05"),
+		Level:       entry.Level.String(),
+		Logger:      "shuttletracker",
+		Platform:    "go",
+		Message:     entry.Message,
+		ServerName:  hostname,
+		Environment: sh.environment,
+		Tags:        map[string]string{},
+		Extra:       map[string]interface{}{},
+	}
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		event.Extra[k] = v
+	}
+	for _, tag := range sentryTags {
+		if v, ok := entry.Data[tag]; ok {
+			event.Tags[tag] = fmt.Sprint(v)
+		}
+	}
+
+	frames := stackFrames()
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].InApp {
+			event.Culprit = frames[i].Function
+			break
+		}
+	}
+	exception := sentryExceptionValue{
+		Type:       "error",
+		Value:      entry.Message,
+		Stacktrace: sentryStacktrace{Frames: frames},
+	}
+	if err, ok := entry.Data["error"].(error); ok {
+		exception.Type = fmt.Sprintf("%T", err)
+		exception.Value = err.Error()
+	}
+	event.Exception = &sentryException{Values: []sentryExceptionValue{exception}}
+	return event
+}
+
+// stackFrames returns the stack of the code that logged an entry, oldest call
+// first, without frames from logrus or this package.
+func stackFrames() []sentryFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	stack := []sentryFrame{}
+	for {
+		frame, more := frames.Next()
+		function := frame.Function
+		logging := strings.HasPrefix(function, "github.com/Sirupsen/logrus.") ||
+			(strings.HasPrefix(function, modulePath+"/log.") && !strings.HasSuffix(frame.File, "_test.go"))
+		if !logging && !strings.HasPrefix(function, "runtime.") {
+			module, name := splitFunction(function)
+			_, file := splitPath(frame.File)
+			stack = append(stack, sentryFrame{
+				Function: name,
+				Module:   module,
+				Filename: file,
+				AbsPath:  frame.File,
+				Lineno:   frame.Line,
+				InApp:    strings.HasPrefix(function, modulePath),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+
+	// Sentry expects the most recent call last.
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return stack
+}
+
+// splitFunction splits a function like "github.com/wtg/shuttletracker/api.(*API).Handler"
+// into its package and name.
+func splitFunction(function string) (string, string) {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return "", function
+	}
+	return function[:slash+1+dot], function[slash+1+dot+1:]
+}
+
+func splitPath(p string) (string, string) {
+	i := strings.LastIndex(p, "/")
+	return p[:i+1], p[i+1:]
+}
+
+func (sh *sentryHook) run() {
+	for event := range sh.events {
+		if err := sh.send(event); err != nil {
+			logger.WithField("error", err).Warn("unable to send event to Sentry")
+		}
+		sh.pending.Done()
+	}
+}
+
+func (sh *sentryHook) send(event *sentryEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sh.storeURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", sh.auth)
+
+	resp, err := sh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Sentry returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSentryHook(t *testing.T) {
+	events := make(chan sentryEvent, 1)
+	var auth, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("X-Sentry-Auth")
+		path = r.URL.Path
+		event := sentryEvent{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("unable to decode event: %s", err)
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "://", "://abc123@", 1) + "/42"
+	hook, err := newSentryHook(dsn, "testing")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	logger.Hooks.Add(hook)
+	defer func() {
+		for level := range logger.Hooks {
+			logger.Hooks[level] = nil
+		}
+	}()
+
+	WithVehicleID(4).WithError(errors.New("oops")).Error("unable to do something")
+
+	var event sentryEvent
+	select {
+	case event = <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	if path != "/api/42/store/" {
+		t.Errorf("got path %s", path)
+	}
+	if !strings.Contains(auth, "sentry_key=abc123") {
+		t.Errorf("got auth header %q", auth)
+	}
+	if event.Message != "unable to do something" || event.Level != "error" || event.Environment != "testing" {
+		t.Errorf("got event %+v", event)
+	}
+	if event.Tags[VehicleIDField] != "4" {
+		t.Errorf("got tags %v", event.Tags)
+	}
+	exception := event.Exception.Values[0]
+	if exception.Value != "oops" {
+		t.Errorf("got exception value %q", exception.Value)
+	}
+	frames := exception.Stacktrace.Frames
+	last := frames[len(frames)-1]
+	if last.Function != "TestSentryHook" || last.Module != "github.com/wtg/shuttletracker/log" {
+		t.Errorf("got last frame %+v", last)
+	}
+}
+
+func TestSentryHookInvalidDSN(t *testing.T) {
+	for _, dsn := range []string{"https://sentry.example.com/42", "https://abc123@sentry.example.com/", "://"} {
+		if _, err := newSentryHook(dsn, ""); err == nil {
+			t.Errorf("expected error for %q", dsn)
+		}
+	}
+}
+
+func TestSentryHookFlush(t *testing.T) {
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&received, 1)
+	}))
+	defer server.Close()
+
+	hook, err := newSentryHook(strings.Replace(server.URL, "://", "://abc123@", 1)+"/42", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := hook.Fire(logger.WithField("i", i)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	hook.flush(5 * time.Second)
+	if n := atomic.LoadInt32(&received); n != 3 {
+		t.Errorf("got %d events after flush, expected 3", n)
+	}
+}
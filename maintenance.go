@@ -0,0 +1,56 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// MaintenanceRecord is maintenance done on a Vehicle, like an inspection or a
+// repair, and when it kept the Vehicle out of service.
+type MaintenanceRecord struct {
+	ID        int64 `json:"id"`
+	VehicleID int64 `json:"vehicle_id"`
+
+	// Date is the day the maintenance was done, like "2019-03-04".
+	Date  string `json:"date"`
+	Type  string `json:"type"`
+	Notes string `json:"notes"`
+
+	// OutOfServiceStart and OutOfServiceEnd are when the Vehicle can't be
+	// used because of the maintenance. Both are nil if it stayed in service,
+	// and OutOfServiceEnd is nil if it isn't known when it will be back.
+	OutOfServiceStart *time.Time `json:"out_of_service_start"`
+	OutOfServiceEnd   *time.Time `json:"out_of_service_end"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// OutOfServiceAt returns whether the maintenance kept its Vehicle out of
+// service at t.
+func (m *MaintenanceRecord) OutOfServiceAt(t time.Time) bool {
+	if m.OutOfServiceStart == nil || m.OutOfServiceStart.After(t) {
+		return false
+	}
+	return m.OutOfServiceEnd == nil || m.OutOfServiceEnd.After(t)
+}
+
+// MaintenanceService is an interface for interacting with MaintenanceRecords.
+type MaintenanceService interface {
+	MaintenanceRecord(id int64) (*MaintenanceRecord, error)
+
+	// MaintenanceRecords returns a Vehicle's MaintenanceRecords, or every
+	// Vehicle's if vehicleID is nil, most recent first.
+	MaintenanceRecords(vehicleID *int64) ([]*MaintenanceRecord, error)
+
+	// OutOfService returns the MaintenanceRecords that keep their Vehicles
+	// out of service at t.
+	OutOfService(t time.Time) ([]*MaintenanceRecord, error)
+
+	CreateMaintenanceRecord(record *MaintenanceRecord) error
+	ModifyMaintenanceRecord(record *MaintenanceRecord) error
+	DeleteMaintenanceRecord(id int64) error
+}
+
+// ErrMaintenanceRecordNotFound indicates that a MaintenanceRecord is not in the service.
+var ErrMaintenanceRecordNotFound = errors.New("Maintenance record not found")
@@ -0,0 +1,141 @@
+// Package metrics defines the Prometheus metrics that every subsystem reports
+// so that they're registered in one place and served together at /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shuttletracker"
+
+var (
+	// HTTPRequestDuration is how long the API takes to respond, by chi route pattern.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to respond to HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// DBQueryDuration is how long database queries take, by statement type and
+	// table, and by a hash of the statement so that individual queries can be
+	// found in slow query logs.
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "postgres",
+		Name:      "query_duration_seconds",
+		Help:      "Time taken by database queries.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query", "statement"})
+
+	// UpdaterCycleDuration is how long each data feed update takes.
+	UpdaterCycleDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "updater",
+		Name:      "cycle_duration_seconds",
+		Help:      "Time taken to fetch, parse, and store the data feed.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// FeedErrors counts data feed failures by reason.
+	FeedErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "updater",
+		Name:      "feed_errors_total",
+		Help:      "Data feed requests or vehicles that couldn't be handled.",
+	}, []string{"reason"})
+
+	// VehicleTrackerTime is when each vehicle's tracker recorded its latest
+	// position, as a Unix timestamp. Subtract it from time() to get its age.
+	VehicleTrackerTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "updater",
+		Name:      "vehicle_tracker_timestamp_seconds",
+		Help:      "When each vehicle's tracker recorded its latest position.",
+	}, []string{"vehicle"})
+
+	// VehicleReceivedTime is when the data feed last included each vehicle, as
+	// a Unix timestamp.
+	VehicleReceivedTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "updater",
+		Name:      "vehicle_received_timestamp_seconds",
+		Help:      "When the data feed last included each vehicle.",
+	}, []string{"vehicle"})
+
+	// VehicleDataDelay is how old each vehicle's position was when the data
+	// feed last included it.
+	VehicleDataDelay = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "updater",
+		Name:      "vehicle_data_delay_seconds",
+		Help:      "Age of each vehicle's position when it was last received.",
+	}, []string{"vehicle"})
+
+	// ETACalculationDuration is how long it takes to calculate a vehicle's ETAs.
+	ETACalculationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "eta",
+		Name:      "calculation_duration_seconds",
+		Help:      "Time taken to calculate ETAs for a vehicle.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// ComponentHealthy is 1 if a subsystem last reported that it was healthy and 0 otherwise.
+	ComponentHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "component_healthy",
+		Help:      "Whether each subsystem last reported that it was healthy.",
+	}, []string{"component"})
+
+	// WebsocketClients is how many Fusion clients are connected to this instance.
+	WebsocketClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "fusion",
+		Name:      "clients",
+		Help:      "Connected Fusion websocket clients.",
+	})
+
+	// WebsocketMessages counts messages written to Fusion clients.
+	WebsocketMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fusion",
+		Name:      "messages_sent_total",
+		Help:      "Messages written to Fusion websocket clients.",
+	})
+
+	// BusButtonsDropped counts bus button presses that weren't counted or
+	// broadcast, by reason.
+	BusButtonsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fusion",
+		Name:      "bus_buttons_dropped_total",
+		Help:      "Bus button presses dropped as duplicates, implausible, or outweighed.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		HTTPRequestDuration,
+		DBQueryDuration,
+		UpdaterCycleDuration,
+		FeedErrors,
+		VehicleTrackerTime,
+		VehicleReceivedTime,
+		VehicleDataDelay,
+		ETACalculationDuration,
+		ComponentHealthy,
+		WebsocketClients,
+		WebsocketMessages,
+		BusButtonsDropped,
+	)
+}
+
+// Handler serves all metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,22 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// AlertService implements a mock of shuttletracker.AlertService.
+type AlertService struct {
+	mock.Mock
+}
+
+// SendAlert sends an Alert.
+func (as *AlertService) SendAlert(alert *shuttletracker.Alert) {
+	as.Called(alert)
+}
+
+// Subscribe registers a callback to receive every Alert.
+func (as *AlertService) Subscribe(f func(*shuttletracker.Alert)) {
+	as.Called(f)
+}
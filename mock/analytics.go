@@ -0,0 +1,80 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// AnalyticsService implements a mock of shuttletracker.AnalyticsService.
+type AnalyticsService struct {
+	mock.Mock
+}
+
+// SetDensity replaces the density grid for an hour.
+func (as *AnalyticsService) SetDensity(hour time.Time, cells []*shuttletracker.DensityCell) error {
+	args := as.Called(hour, cells)
+	return args.Error(0)
+}
+
+// LastDensityHour returns the most recent hour that has a density grid.
+func (as *AnalyticsService) LastDensityHour() (time.Time, error) {
+	args := as.Called()
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+// Density adds up the density grids for a range of hours.
+func (as *AnalyticsService) Density(since, until time.Time) ([]*shuttletracker.DensityCell, error) {
+	args := as.Called(since, until)
+	return args.Get(0).([]*shuttletracker.DensityCell), args.Error(1)
+}
+
+// RecordDemand adds to the demand totals.
+func (as *AnalyticsService) RecordDemand(demand []*shuttletracker.Demand) error {
+	args := as.Called(demand)
+	return args.Error(0)
+}
+
+// Demand returns the demand totals for a range of hours.
+func (as *AnalyticsService) Demand(since, until time.Time) ([]*shuttletracker.Demand, error) {
+	args := as.Called(since, until)
+	return args.Get(0).([]*shuttletracker.Demand), args.Error(1)
+}
+
+// SetMileage replaces the Mileage for a day.
+func (as *AnalyticsService) SetMileage(day time.Time, mileage []*shuttletracker.Mileage) error {
+	args := as.Called(day, mileage)
+	return args.Error(0)
+}
+
+// LastMileageDay returns the most recent day that has Mileage.
+func (as *AnalyticsService) LastMileageDay() (time.Time, error) {
+	args := as.Called()
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+// Mileage returns the Mileage for a range of days.
+func (as *AnalyticsService) Mileage(since, until time.Time) ([]*shuttletracker.Mileage, error) {
+	args := as.Called(since, until)
+	return args.Get(0).([]*shuttletracker.Mileage), args.Error(1)
+}
+
+// TotalMileage returns each vehicle's total Mileage.
+func (as *AnalyticsService) TotalMileage() (map[int64]float64, error) {
+	args := as.Called()
+	return args.Get(0).(map[int64]float64), args.Error(1)
+}
+
+// SetLoopTimes replaces every Route's LoopTimes.
+func (as *AnalyticsService) SetLoopTimes(loopTimes []*shuttletracker.LoopTime) error {
+	args := as.Called(loopTimes)
+	return args.Error(0)
+}
+
+// LoopTimes returns every Route's LoopTimes.
+func (as *AnalyticsService) LoopTimes() ([]*shuttletracker.LoopTime, error) {
+	args := as.Called()
+	return args.Get(0).([]*shuttletracker.LoopTime), args.Error(1)
+}
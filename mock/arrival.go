@@ -0,0 +1,29 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ArrivalService implements a mock of shuttletracker.ArrivalService.
+type ArrivalService struct {
+	mock.Mock
+}
+
+// CreateArrival creates an Arrival.
+func (as *ArrivalService) CreateArrival(arrival *shuttletracker.Arrival) error {
+	args := as.Called(arrival)
+	return args.Error(0)
+}
+
+// ExportArrivals calls fn with each of the mocked Arrivals.
+func (as *ArrivalService) ExportArrivals(filter shuttletracker.HistoryFilter, fn func(*shuttletracker.Arrival) error) error {
+	args := as.Called(filter)
+	for _, a := range args.Get(0).([]*shuttletracker.Arrival) {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
@@ -0,0 +1,35 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+	"github.com/wtg/shuttletracker"
+)
+
+// CalendarService implements a mock of shuttletracker.CalendarService.
+type CalendarService struct {
+	mock.Mock
+}
+
+// ServicePeriods gets all ServicePeriods.
+func (cs *CalendarService) ServicePeriods() ([]*shuttletracker.ServicePeriod, error) {
+	args := cs.Called()
+	return args.Get(0).([]*shuttletracker.ServicePeriod), args.Error(1)
+}
+
+// CreateServicePeriod creates a ServicePeriod.
+func (cs *CalendarService) CreateServicePeriod(period *shuttletracker.ServicePeriod) error {
+	args := cs.Called(period)
+	return args.Error(0)
+}
+
+// ModifyServicePeriod modifies a ServicePeriod.
+func (cs *CalendarService) ModifyServicePeriod(period *shuttletracker.ServicePeriod) error {
+	args := cs.Called(period)
+	return args.Error(0)
+}
+
+// DeleteServicePeriod deletes a ServicePeriod.
+func (cs *CalendarService) DeleteServicePeriod(id int64) error {
+	args := cs.Called(id)
+	return args.Error(0)
+}
@@ -0,0 +1,33 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+)
+
+// LeaderService implements a mock of shuttletracker.LeaderService.
+type LeaderService struct {
+	mock.Mock
+}
+
+// Leader reports whether this instance is the leader.
+func (ls *LeaderService) Leader() bool {
+	args := ls.Called()
+	return args.Bool(0)
+}
+
+// BroadcastService implements a mock of shuttletracker.BroadcastService.
+type BroadcastService struct {
+	mock.Mock
+}
+
+// Broadcast sends a message to every instance.
+func (bs *BroadcastService) Broadcast(channel, payload string) error {
+	args := bs.Called(channel, payload)
+	return args.Error(0)
+}
+
+// SubscribeBroadcasts returns a chan that receives messages sent on a channel.
+func (bs *BroadcastService) SubscribeBroadcasts(channel string) chan string {
+	args := bs.Called(channel)
+	return args.Get(0).(chan string)
+}
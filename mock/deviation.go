@@ -0,0 +1,29 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// DeviationService implements a mock of shuttletracker.DeviationService.
+type DeviationService struct {
+	mock.Mock
+}
+
+// CreateDeviation creates a Deviation.
+func (ds *DeviationService) CreateDeviation(deviation *shuttletracker.Deviation) error {
+	args := ds.Called(deviation)
+	return args.Error(0)
+}
+
+// ExportDeviations calls fn with each of the mocked Deviations.
+func (ds *DeviationService) ExportDeviations(filter shuttletracker.HistoryFilter, fn func(*shuttletracker.Deviation) error) error {
+	args := ds.Called(filter)
+	for _, d := range args.Get(0).([]*shuttletracker.Deviation) {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
@@ -0,0 +1,48 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// DraftService implements a mock of shuttletracker.DraftService.
+type DraftService struct {
+	mock.Mock
+}
+
+// Draft gets a Draft.
+func (ds *DraftService) Draft(id int64) (*shuttletracker.Draft, error) {
+	args := ds.Called(id)
+	return args.Get(0).(*shuttletracker.Draft), args.Error(1)
+}
+
+// Drafts gets all Drafts.
+func (ds *DraftService) Drafts() ([]*shuttletracker.Draft, error) {
+	args := ds.Called()
+	return args.Get(0).([]*shuttletracker.Draft), args.Error(1)
+}
+
+// CreateDraft creates a Draft.
+func (ds *DraftService) CreateDraft(draft *shuttletracker.Draft) error {
+	args := ds.Called(draft)
+	return args.Error(0)
+}
+
+// ModifyDraft modifies a Draft.
+func (ds *DraftService) ModifyDraft(draft *shuttletracker.Draft) error {
+	args := ds.Called(draft)
+	return args.Error(0)
+}
+
+// DeleteDraft deletes a Draft.
+func (ds *DraftService) DeleteDraft(id int64) error {
+	args := ds.Called(id)
+	return args.Error(0)
+}
+
+// PublishDraft publishes a Draft.
+func (ds *DraftService) PublishDraft(id int64) error {
+	args := ds.Called(id)
+	return args.Error(0)
+}
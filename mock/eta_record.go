@@ -0,0 +1,29 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ETARecordService implements a mock of shuttletracker.ETARecordService.
+type ETARecordService struct {
+	mock.Mock
+}
+
+// CreateETARecords creates ETARecords.
+func (es *ETARecordService) CreateETARecords(records []*shuttletracker.ETARecord) error {
+	args := es.Called(records)
+	return args.Error(0)
+}
+
+// ExportETARecords calls fn with each of the mocked ETARecords.
+func (es *ETARecordService) ExportETARecords(filter shuttletracker.HistoryFilter, fn func(*shuttletracker.ETARecord) error) error {
+	args := es.Called(filter)
+	for _, r := range args.Get(0).([]*shuttletracker.ETARecord) {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
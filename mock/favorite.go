@@ -0,0 +1,30 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// FavoriteService implements a mock of shuttletracker.FavoriteService.
+type FavoriteService struct {
+	mock.Mock
+}
+
+// Favorites returns a device's Favorites.
+func (fs *FavoriteService) Favorites(deviceToken string) ([]*shuttletracker.Favorite, error) {
+	args := fs.Called(deviceToken)
+	return args.Get(0).([]*shuttletracker.Favorite), args.Error(1)
+}
+
+// AddFavorite saves a Favorite.
+func (fs *FavoriteService) AddFavorite(favorite *shuttletracker.Favorite) error {
+	args := fs.Called(favorite)
+	return args.Error(0)
+}
+
+// RemoveFavorite removes a Favorite.
+func (fs *FavoriteService) RemoveFavorite(favorite *shuttletracker.Favorite) error {
+	args := fs.Called(favorite)
+	return args.Error(0)
+}
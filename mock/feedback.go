@@ -23,20 +23,20 @@ func (fs *FeedbackService) DeleteForm(id int64) error {
 	return args.Error(0)
 }
 
-// Form gets a form
-func (fs *FeedbackService) Form(id int64) (*shuttletracker.Form, error) {
-	args := fs.Called(id)
-	return args.Get(0).(*shuttletracker.Form), args.Error(1)
+// GetAdminForm gets the Form with admin set.
+func (fs *FeedbackService) GetAdminForm() *shuttletracker.Form {
+	args := fs.Called()
+	return args.Get(0).(*shuttletracker.Form)
 }
 
-// EditForm edits form
-func (fs *FeedbackService) EditForm(form *shuttletracker.Form) error {
-	args := fs.Called(form)
-	return args.Error(0)
+// GetForm gets a form
+func (fs *FeedbackService) GetForm(id int64) (*shuttletracker.Form, error) {
+	args := fs.Called(id)
+	return args.Get(0).(*shuttletracker.Form), args.Error(1)
 }
 
-// Forms returns all forms
-func (fs *FeedbackService) Forms() ([]*shuttletracker.Form, error) {
+// GetForms returns all forms
+func (fs *FeedbackService) GetForms() ([]*shuttletracker.Form, error) {
 	args := fs.Called()
 	return args.Get(0).([]*shuttletracker.Form), args.Error(1)
 }
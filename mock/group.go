@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// VehicleGroupService implements a mock of shuttletracker.VehicleGroupService.
+type VehicleGroupService struct {
+	mock.Mock
+}
+
+// VehicleGroup gets a VehicleGroup.
+func (gs *VehicleGroupService) VehicleGroup(id int64) (*shuttletracker.VehicleGroup, error) {
+	args := gs.Called(id)
+	return args.Get(0).(*shuttletracker.VehicleGroup), args.Error(1)
+}
+
+// VehicleGroups gets all VehicleGroups.
+func (gs *VehicleGroupService) VehicleGroups() ([]*shuttletracker.VehicleGroup, error) {
+	args := gs.Called()
+	return args.Get(0).([]*shuttletracker.VehicleGroup), args.Error(1)
+}
+
+// CreateVehicleGroup creates a VehicleGroup.
+func (gs *VehicleGroupService) CreateVehicleGroup(group *shuttletracker.VehicleGroup) error {
+	args := gs.Called(group)
+	return args.Error(0)
+}
+
+// ModifyVehicleGroup modifies a VehicleGroup.
+func (gs *VehicleGroupService) ModifyVehicleGroup(group *shuttletracker.VehicleGroup) error {
+	args := gs.Called(group)
+	return args.Error(0)
+}
+
+// DeleteVehicleGroup deletes a VehicleGroup.
+func (gs *VehicleGroupService) DeleteVehicleGroup(id int64) error {
+	args := gs.Called(id)
+	return args.Error(0)
+}
@@ -1,6 +1,7 @@
 package mock
 
 import (
+	"context"
 	"time"
 
 	"github.com/stretchr/testify/mock"
@@ -31,6 +32,11 @@ func (ls *LocationService) LocationsSince(vehicleID int64, since time.Time) ([]*
 	return args.Get(0).([]*shuttletracker.Location), args.Error(1)
 }
 
+// LocationsSinceContext is mocked as LocationsSince.
+func (ls *LocationService) LocationsSinceContext(ctx context.Context, vehicleID int64, since time.Time) ([]*shuttletracker.Location, error) {
+	return ls.LocationsSince(vehicleID, since)
+}
+
 // LatestLocation returns the most recent Location for a Vehicle.
 func (ls *LocationService) LatestLocation(vehicleID int64) (*shuttletracker.Location, error) {
 	args := ls.Called(vehicleID)
@@ -43,6 +49,11 @@ func (ls *LocationService) LatestLocations() ([]*shuttletracker.Location, error)
 	return args.Get(0).([]*shuttletracker.Location), args.Error(1)
 }
 
+// LatestLocationsContext is mocked as LatestLocations.
+func (ls *LocationService) LatestLocationsContext(ctx context.Context) ([]*shuttletracker.Location, error) {
+	return ls.LatestLocations()
+}
+
 // Location returns a Location by its ID.
 func (ls *LocationService) Location(id int64) (*shuttletracker.Location, error) {
 	args := ls.Called(id)
@@ -54,3 +65,20 @@ func (ls *LocationService) SubscribeLocations() chan *shuttletracker.Location {
 	args := ls.Called()
 	return args.Get(0).(chan *shuttletracker.Location)
 }
+
+// PublishLocation sends a Location to subscribers.
+func (ls *LocationService) PublishLocation(location *shuttletracker.Location) error {
+	args := ls.Called(location)
+	return args.Error(0)
+}
+
+// ExportLocations calls fn with each of the mocked Locations.
+func (ls *LocationService) ExportLocations(filter shuttletracker.HistoryFilter, fn func(*shuttletracker.Location) error) error {
+	args := ls.Called(filter)
+	for _, l := range args.Get(0).([]*shuttletracker.Location) {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
@@ -0,0 +1,50 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// MaintenanceService implements a mock of shuttletracker.MaintenanceService.
+type MaintenanceService struct {
+	mock.Mock
+}
+
+// MaintenanceRecord gets a MaintenanceRecord.
+func (ms *MaintenanceService) MaintenanceRecord(id int64) (*shuttletracker.MaintenanceRecord, error) {
+	args := ms.Called(id)
+	return args.Get(0).(*shuttletracker.MaintenanceRecord), args.Error(1)
+}
+
+// MaintenanceRecords gets a Vehicle's MaintenanceRecords.
+func (ms *MaintenanceService) MaintenanceRecords(vehicleID *int64) ([]*shuttletracker.MaintenanceRecord, error) {
+	args := ms.Called(vehicleID)
+	return args.Get(0).([]*shuttletracker.MaintenanceRecord), args.Error(1)
+}
+
+// OutOfService gets the MaintenanceRecords that keep Vehicles out of service at t.
+func (ms *MaintenanceService) OutOfService(t time.Time) ([]*shuttletracker.MaintenanceRecord, error) {
+	args := ms.Called(t)
+	return args.Get(0).([]*shuttletracker.MaintenanceRecord), args.Error(1)
+}
+
+// CreateMaintenanceRecord creates a MaintenanceRecord.
+func (ms *MaintenanceService) CreateMaintenanceRecord(record *shuttletracker.MaintenanceRecord) error {
+	args := ms.Called(record)
+	return args.Error(0)
+}
+
+// ModifyMaintenanceRecord modifies a MaintenanceRecord.
+func (ms *MaintenanceService) ModifyMaintenanceRecord(record *shuttletracker.MaintenanceRecord) error {
+	args := ms.Called(record)
+	return args.Error(0)
+}
+
+// DeleteMaintenanceRecord deletes a MaintenanceRecord.
+func (ms *MaintenanceService) DeleteMaintenanceRecord(id int64) error {
+	args := ms.Called(id)
+	return args.Error(0)
+}
@@ -3,8 +3,19 @@ package mock
 // ModelService implements shuttletracker.ModelService.
 type ModelService struct {
 	VehicleService
+	VehicleGroupService
+	TrackerDeviceService
 	RouteService
+	DetourService
 	StopService
+	ScheduleService
+	CalendarService
+	DraftService
 	LocationService
+	ArrivalService
+	DeviationService
+	ETARecordService
+	ShiftService
+	MaintenanceService
 	FeedbackService
 }
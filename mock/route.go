@@ -1,6 +1,8 @@
 package mock
 
 import (
+	"context"
+
 	"github.com/stretchr/testify/mock"
 
 	"github.com/wtg/shuttletracker"
@@ -35,8 +37,25 @@ func (rs *RouteService) ModifyRoute(route *shuttletracker.Route) error {
 	return args.Error(0)
 }
 
+// ModifyRouteStops modifies a Route's stops.
+func (rs *RouteService) ModifyRouteStops(route *shuttletracker.Route) error {
+	args := rs.Called(route)
+	return args.Error(0)
+}
+
+// ImportRoutes creates Stops and Routes.
+func (rs *RouteService) ImportRoutes(stops []*shuttletracker.Stop, routes []*shuttletracker.Route) error {
+	args := rs.Called(stops, routes)
+	return args.Error(0)
+}
+
 // Routes returns all Routes.
 func (rs *RouteService) Routes() ([]*shuttletracker.Route, error) {
 	args := rs.Called()
 	return args.Get(0).([]*shuttletracker.Route), args.Error(1)
 }
+
+// RoutesContext is mocked as Routes.
+func (rs *RouteService) RoutesContext(ctx context.Context) ([]*shuttletracker.Route, error) {
+	return rs.Routes()
+}
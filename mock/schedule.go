@@ -0,0 +1,47 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+	"github.com/wtg/shuttletracker"
+)
+
+// ScheduleService implements a mock of shuttletracker.ScheduleService.
+type ScheduleService struct {
+	mock.Mock
+}
+
+// Schedule gets a Schedule.
+func (ss *ScheduleService) Schedule(id int64) (*shuttletracker.Schedule, error) {
+	args := ss.Called(id)
+	return args.Get(0).(*shuttletracker.Schedule), args.Error(1)
+}
+
+// Schedules gets all Schedules.
+func (ss *ScheduleService) Schedules() ([]*shuttletracker.Schedule, error) {
+	args := ss.Called()
+	return args.Get(0).([]*shuttletracker.Schedule), args.Error(1)
+}
+
+// CreateSchedule creates a Schedule.
+func (ss *ScheduleService) CreateSchedule(schedule *shuttletracker.Schedule) error {
+	args := ss.Called(schedule)
+	return args.Error(0)
+}
+
+// ModifySchedule modifies a Schedule.
+func (ss *ScheduleService) ModifySchedule(schedule *shuttletracker.Schedule) error {
+	args := ss.Called(schedule)
+	return args.Error(0)
+}
+
+// DeleteSchedule deletes a Schedule.
+func (ss *ScheduleService) DeleteSchedule(id int64) error {
+	args := ss.Called(id)
+	return args.Error(0)
+}
+
+// ReplaceSchedules creates and modifies Schedules.
+func (ss *ScheduleService) ReplaceSchedules(schedules []*shuttletracker.Schedule) error {
+	args := ss.Called(schedules)
+	return args.Error(0)
+}
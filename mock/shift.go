@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ShiftService implements a mock of shuttletracker.ShiftService.
+type ShiftService struct {
+	mock.Mock
+}
+
+// Shift gets a Shift.
+func (ss *ShiftService) Shift(id int64) (*shuttletracker.Shift, error) {
+	args := ss.Called(id)
+	return args.Get(0).(*shuttletracker.Shift), args.Error(1)
+}
+
+// Shifts gets the Shifts matching the filter.
+func (ss *ShiftService) Shifts(filter shuttletracker.HistoryFilter) ([]*shuttletracker.Shift, error) {
+	args := ss.Called(filter)
+	return args.Get(0).([]*shuttletracker.Shift), args.Error(1)
+}
+
+// CreateShift creates a Shift.
+func (ss *ShiftService) CreateShift(shift *shuttletracker.Shift) error {
+	args := ss.Called(shift)
+	return args.Error(0)
+}
+
+// ModifyShift modifies a Shift.
+func (ss *ShiftService) ModifyShift(shift *shuttletracker.Shift) error {
+	args := ss.Called(shift)
+	return args.Error(0)
+}
+
+// DeleteShift deletes a Shift.
+func (ss *ShiftService) DeleteShift(id int64) error {
+	args := ss.Called(id)
+	return args.Error(0)
+}
@@ -16,6 +16,24 @@ func (ss *StopService) CreateStop(stop *shuttletracker.Stop) error {
 	return args.Error(0)
 }
 
+// CreateStopWithID creates a Stop with a specific ID.
+func (ss *StopService) CreateStopWithID(stop *shuttletracker.Stop) error {
+	args := ss.Called(stop)
+	return args.Error(0)
+}
+
+// ModifyStop modifies a Stop.
+func (ss *StopService) ModifyStop(stop *shuttletracker.Stop) error {
+	args := ss.Called(stop)
+	return args.Error(0)
+}
+
+// MergeStops merges one Stop into another.
+func (ss *StopService) MergeStops(keepID, mergeID int64) error {
+	args := ss.Called(keepID, mergeID)
+	return args.Error(0)
+}
+
 // DeleteStop deletes a Stop.
 func (ss *StopService) DeleteStop(id int64) error {
 	args := ss.Called(id)
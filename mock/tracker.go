@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// TrackerDeviceService implements a mock of shuttletracker.TrackerDeviceService.
+type TrackerDeviceService struct {
+	mock.Mock
+}
+
+// TrackerDevice gets a TrackerDevice.
+func (ts *TrackerDeviceService) TrackerDevice(id int64) (*shuttletracker.TrackerDevice, error) {
+	args := ts.Called(id)
+	return args.Get(0).(*shuttletracker.TrackerDevice), args.Error(1)
+}
+
+// TrackerDevices gets the TrackerDevices matching the filter.
+func (ts *TrackerDeviceService) TrackerDevices(filter shuttletracker.HistoryFilter) ([]*shuttletracker.TrackerDevice, error) {
+	args := ts.Called(filter)
+	return args.Get(0).([]*shuttletracker.TrackerDevice), args.Error(1)
+}
+
+// CreateTrackerDevice creates a TrackerDevice.
+func (ts *TrackerDeviceService) CreateTrackerDevice(device *shuttletracker.TrackerDevice) error {
+	args := ts.Called(device)
+	return args.Error(0)
+}
+
+// ModifyTrackerDevice modifies a TrackerDevice.
+func (ts *TrackerDeviceService) ModifyTrackerDevice(device *shuttletracker.TrackerDevice) error {
+	args := ts.Called(device)
+	return args.Error(0)
+}
+
+// DeleteTrackerDevice deletes a TrackerDevice.
+func (ts *TrackerDeviceService) DeleteTrackerDevice(id int64) error {
+	args := ts.Called(id)
+	return args.Error(0)
+}
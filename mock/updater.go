@@ -16,3 +16,9 @@ func (us *UpdaterService) GetLastResponse() *shuttletracker.DataFeedResponse {
 	args := us.Called()
 	return args.Get(0).(*shuttletracker.DataFeedResponse)
 }
+
+// VehicleDataAges returns how fresh each vehicle's position in the data feed is.
+func (us *UpdaterService) VehicleDataAges() []shuttletracker.VehicleDataAge {
+	args := us.Called()
+	return args.Get(0).([]shuttletracker.VehicleDataAge)
+}
@@ -0,0 +1,26 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// UsageService implements a mock of shuttletracker.UsageService.
+type UsageService struct {
+	mock.Mock
+}
+
+// RecordUsage adds usage to the totals.
+func (us *UsageService) RecordUsage(usage *shuttletracker.Usage) error {
+	args := us.Called(usage)
+	return args.Error(0)
+}
+
+// Usage returns usage for each day since a time.
+func (us *UsageService) Usage(since time.Time) ([]*shuttletracker.DailyUsage, error) {
+	args := us.Called(since)
+	return args.Get(0).([]*shuttletracker.DailyUsage), args.Error(1)
+}
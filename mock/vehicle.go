@@ -1,6 +1,8 @@
 package mock
 
 import (
+	"context"
+
 	"github.com/stretchr/testify/mock"
 
 	"github.com/wtg/shuttletracker"
@@ -35,6 +37,12 @@ func (vs *VehicleService) VehicleWithTrackerID(trackerID string) (*shuttletracke
 	return args.Get(0).(*shuttletracker.Vehicle), args.Error(1)
 }
 
+// VehicleWithLicensePlate returns a Vehicle with the specified license plate.
+func (vs *VehicleService) VehicleWithLicensePlate(plate string) (*shuttletracker.Vehicle, error) {
+	args := vs.Called(plate)
+	return args.Get(0).(*shuttletracker.Vehicle), args.Error(1)
+}
+
 // Vehicles gets all Vehicles.
 func (vs *VehicleService) Vehicles() ([]*shuttletracker.Vehicle, error) {
 	args := vs.Called()
@@ -47,6 +55,16 @@ func (vs *VehicleService) EnabledVehicles() ([]*shuttletracker.Vehicle, error) {
 	return args.Get(0).([]*shuttletracker.Vehicle), args.Error(1)
 }
 
+// VehiclesContext is mocked as Vehicles.
+func (vs *VehicleService) VehiclesContext(ctx context.Context) ([]*shuttletracker.Vehicle, error) {
+	return vs.Vehicles()
+}
+
+// EnabledVehiclesContext is mocked as EnabledVehicles.
+func (vs *VehicleService) EnabledVehiclesContext(ctx context.Context) ([]*shuttletracker.Vehicle, error) {
+	return vs.EnabledVehicles()
+}
+
 // ModifyVehicle modifies a Vehicle.
 func (vs *VehicleService) ModifyVehicle(vehicle *shuttletracker.Vehicle) error {
 	args := vs.Called(vehicle)
@@ -0,0 +1,30 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// WidgetKeyService implements a mock of shuttletracker.WidgetKeyService.
+type WidgetKeyService struct {
+	mock.Mock
+}
+
+// WidgetKeys returns all WidgetKeys.
+func (wks *WidgetKeyService) WidgetKeys() ([]*shuttletracker.WidgetKey, error) {
+	args := wks.Called()
+	return args.Get(0).([]*shuttletracker.WidgetKey), args.Error(1)
+}
+
+// CreateWidgetKey creates a WidgetKey.
+func (wks *WidgetKeyService) CreateWidgetKey(key *shuttletracker.WidgetKey) error {
+	args := wks.Called(key)
+	return args.Error(0)
+}
+
+// DeleteWidgetKey deletes a WidgetKey.
+func (wks *WidgetKeyService) DeleteWidgetKey(id int64) error {
+	args := wks.Called(id)
+	return args.Error(0)
+}
@@ -1,9 +1,21 @@
 package shuttletracker
 
-// ModelService is a collection of interfaces related to vehicles, routes, stops, and their locations.
+// ModelService is a collection of interfaces related to vehicles, vehicle groups, trackers, routes, detours,
+// stops, schedules, shifts, maintenance, and their history.
 type ModelService interface {
 	VehicleService
+	VehicleGroupService
+	TrackerDeviceService
 	RouteService
+	DetourService
 	StopService
+	ScheduleService
+	CalendarService
+	DraftService
 	LocationService
+	ArrivalService
+	DeviationService
+	ETARecordService
+	ShiftService
+	MaintenanceService
 }
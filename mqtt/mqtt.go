@@ -0,0 +1,177 @@
+// Package mqtt publishes vehicle locations and ETAs to an MQTT broker so that
+// devices like digital signage can receive them without connecting to us.
+package mqtt
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/spf13/viper"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// Config holds MQTT settings. Topics may contain "{vehicle_id}" and
+// "{route_id}", which are replaced with the IDs of each update's vehicle and
+// route. Updates for vehicles that aren't on a route use "none" for {route_id}.
+type Config struct {
+	BrokerURL     string
+	ClientID      string
+	Username      string
+	Password      string
+	LocationTopic string
+	ETATopic      string
+	QoS           int
+
+	// Retain asks the broker to keep the latest message on each topic so that
+	// newly connected subscribers get it immediately.
+	Retain bool
+}
+
+// Publisher publishes updates to an MQTT broker.
+type Publisher struct {
+	cfg    Config
+	ms     shuttletracker.ModelService
+	em     shuttletracker.ETAService
+	leader shuttletracker.LeaderService
+	client paho.Client
+	etas   chan shuttletracker.VehicleETA
+	stop   chan struct{}
+}
+
+// New creates a Publisher. Only the leader publishes when multiple instances
+// are running.
+func New(cfg Config, ms shuttletracker.ModelService, em shuttletracker.ETAService, leader shuttletracker.LeaderService) (*Publisher, error) {
+	p := &Publisher{
+		cfg:    cfg,
+		ms:     ms,
+		em:     em,
+		leader: leader,
+		etas:   make(chan shuttletracker.VehicleETA, 50),
+		stop:   make(chan struct{}),
+	}
+	if cfg.BrokerURL == "" {
+		return p, nil
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.BrokerURL).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectionLostHandler(func(c paho.Client, err error) {
+			log.WithError(err).Warn("lost connection to MQTT broker")
+		})
+	p.client = paho.NewClient(opts)
+	return p, nil
+}
+
+// NewConfig creates a new Config.
+func NewConfig(v *viper.Viper) *Config {
+	cfg := &Config{
+		ClientID:      "shuttletracker",
+		LocationTopic: "shuttletracker/vehicles/{vehicle_id}/location",
+		ETATopic:      "shuttletracker/vehicles/{vehicle_id}/eta",
+		Retain:        true,
+	}
+	v.SetDefault("mqtt.brokerurl", cfg.BrokerURL)
+	v.SetDefault("mqtt.clientid", cfg.ClientID)
+	v.SetDefault("mqtt.username", cfg.Username)
+	v.SetDefault("mqtt.password", cfg.Password)
+	v.SetDefault("mqtt.locationtopic", cfg.LocationTopic)
+	v.SetDefault("mqtt.etatopic", cfg.ETATopic)
+	v.SetDefault("mqtt.qos", cfg.QoS)
+	v.SetDefault("mqtt.retain", cfg.Retain)
+	return cfg
+}
+
+// Run connects to the broker and publishes updates forever. It does nothing if
+// no broker is configured.
+func (p *Publisher) Run() {
+	if p.client == nil {
+		log.Debug("No MQTT broker configured.")
+		return
+	}
+
+	// Keep trying until the broker is reachable. After that, the client
+	// reconnects on its own.
+	for {
+		token := p.client.Connect()
+		token.Wait()
+		if token.Error() == nil {
+			break
+		}
+		log.WithError(token.Error()).Error("unable to connect to MQTT broker")
+		select {
+		case <-time.After(time.Second * 10):
+		case <-p.stop:
+			return
+		}
+	}
+	defer p.client.Disconnect(250)
+	log.Debugf("Connected to MQTT broker at %s.", p.cfg.BrokerURL)
+
+	p.em.Subscribe(p.handleETA)
+	locChan := p.ms.SubscribeLocations()
+	for {
+		select {
+		case loc := <-locChan:
+			if loc.VehicleID == nil {
+				continue
+			}
+			p.publish(topic(p.cfg.LocationTopic, *loc.VehicleID, loc.RouteID), loc)
+		case eta := <-p.etas:
+			var routeID *int64
+			if eta.RouteID != 0 {
+				routeID = &eta.RouteID
+			}
+			p.publish(topic(p.cfg.ETATopic, eta.VehicleID, routeID), eta)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Stop makes Run disconnect from the broker and return.
+func (p *Publisher) Stop() {
+	close(p.stop)
+}
+
+// handleETA is called by the ETA manager, so it must not block.
+func (p *Publisher) handleETA(eta shuttletracker.VehicleETA) {
+	select {
+	case p.etas <- eta:
+	default:
+		log.Warn("MQTT ETA queue full; dropping ETA")
+	}
+}
+
+func (p *Publisher) publish(topic string, data interface{}) {
+	if !p.leader.Leader() {
+		return
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.WithError(err).Error("unable to marshal MQTT message")
+		return
+	}
+	// Don't wait for the broker to acknowledge; the client queues messages
+	// while it's reconnecting.
+	p.client.Publish(topic, byte(p.cfg.QoS), p.cfg.Retain, b)
+}
+
+func topic(pattern string, vehicleID int64, routeID *int64) string {
+	route := "none"
+	if routeID != nil {
+		route = strconv.FormatInt(*routeID, 10)
+	}
+	return strings.NewReplacer(
+		"{vehicle_id}", strconv.FormatInt(vehicleID, 10),
+		"{route_id}", route,
+	).Replace(pattern)
+}
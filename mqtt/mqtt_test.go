@@ -0,0 +1,26 @@
+package mqtt
+
+import (
+	"testing"
+)
+
+func TestTopic(t *testing.T) {
+	routeID := int64(2)
+	type testCase struct {
+		pattern  string
+		routeID  *int64
+		expected string
+	}
+	cases := []testCase{
+		{"shuttletracker/vehicles/{vehicle_id}/location", &routeID, "shuttletracker/vehicles/1/location"},
+		{"signs/{route_id}/{vehicle_id}", &routeID, "signs/2/1"},
+		{"signs/{route_id}/{vehicle_id}", nil, "signs/none/1"},
+		{"static", nil, "static"},
+	}
+	for _, c := range cases {
+		actual := topic(c.pattern, 1, c.routeID)
+		if actual != c.expected {
+			t.Errorf("got topic %q for %q, expected %q", actual, c.pattern, c.expected)
+		}
+	}
+}
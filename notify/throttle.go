@@ -0,0 +1,116 @@
+// Package notify contains helpers shared by everything that pushes notifications
+// to people, such as operational alerts and rider ETA notifications.
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+// Key identifies a stream of similar notifications. Repeated notifications with
+// the same Key inside of a Throttle's window are collapsed into one.
+type Key struct {
+	// Subscriber is whoever receives the notification, e.g. a webhook URL or device token.
+	Subscriber string
+
+	// EventType is the kind of notification, e.g. "eta" or "vehicle_silent".
+	EventType string
+
+	// Entity is what the notification is about, e.g. a stop or vehicle ID.
+	Entity string
+}
+
+type dailyCount struct {
+	day   time.Time
+	count int
+}
+
+// Throttle decides whether a notification should be delivered. It suppresses
+// repeats of the same Key within a window and caps how many notifications each
+// subscriber receives per day. It is safe for concurrent use.
+type Throttle struct {
+	window   time.Duration
+	dailyCap int
+
+	mutex     sync.Mutex
+	lastSent  map[Key]time.Time
+	daily     map[string]*dailyCount
+	lastPrune time.Time
+}
+
+// NewThrottle creates a Throttle. A window of zero disables deduplication and
+// a dailyCap of zero disables the per-subscriber cap.
+func NewThrottle(window time.Duration, dailyCap int) *Throttle {
+	return &Throttle{
+		window:   window,
+		dailyCap: dailyCap,
+		lastSent: map[Key]time.Time{},
+		daily:    map[string]*dailyCount{},
+	}
+}
+
+// SetLimits changes the window and daily cap. Notifications that were
+// already sent still count against the new limits.
+func (t *Throttle) SetLimits(window time.Duration, dailyCap int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.window = window
+	t.dailyCap = dailyCap
+}
+
+// Allow reports whether a notification with the provided Key should be sent now.
+// If it returns true, the notification is counted against the subscriber's cap.
+func (t *Throttle) Allow(key Key) bool {
+	return t.allowAt(key, time.Now())
+}
+
+func (t *Throttle) allowAt(key Key, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.prune(now)
+
+	if last, ok := t.lastSent[key]; ok && t.window > 0 && now.Sub(last) < t.window {
+		return false
+	}
+
+	day := startOfDay(now)
+	dc, ok := t.daily[key.Subscriber]
+	if !ok || !dc.day.Equal(day) {
+		dc = &dailyCount{day: day}
+		t.daily[key.Subscriber] = dc
+	}
+	if t.dailyCap > 0 && dc.count >= t.dailyCap {
+		return false
+	}
+
+	dc.count++
+	t.lastSent[key] = now
+	return true
+}
+
+// prune removes state that can no longer affect a decision so that the maps
+// don't grow forever. It runs at most once per window.
+func (t *Throttle) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.window {
+		return
+	}
+	t.lastPrune = now
+
+	for key, last := range t.lastSent {
+		if now.Sub(last) >= t.window {
+			delete(t.lastSent, key)
+		}
+	}
+	day := startOfDay(now)
+	for subscriber, dc := range t.daily {
+		if !dc.day.Equal(day) {
+			delete(t.daily, subscriber)
+		}
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottleCollapsesRepeats(t *testing.T) {
+	th := NewThrottle(time.Minute*10, 0)
+	now := time.Date(2018, time.April, 16, 12, 0, 0, 0, time.UTC)
+	key := Key{Subscriber: "rider", EventType: "eta", Entity: "stop 1"}
+
+	if !th.allowAt(key, now) {
+		t.Error("expected first notification to be allowed")
+	}
+	if th.allowAt(key, now.Add(time.Minute*5)) {
+		t.Error("expected repeat within window to be suppressed")
+	}
+
+	other := Key{Subscriber: "rider", EventType: "eta", Entity: "stop 2"}
+	if !th.allowAt(other, now.Add(time.Minute*5)) {
+		t.Error("expected notification about a different entity to be allowed")
+	}
+
+	if !th.allowAt(key, now.Add(time.Minute*10)) {
+		t.Error("expected notification after window to be allowed")
+	}
+}
+
+func TestThrottleDailyCap(t *testing.T) {
+	th := NewThrottle(0, 2)
+	now := time.Date(2018, time.April, 16, 12, 0, 0, 0, time.UTC)
+
+	type testCase struct {
+		key      Key
+		time     time.Time
+		expected bool
+	}
+	cases := []testCase{
+		{Key{"a", "eta", "1"}, now, true},
+		{Key{"a", "eta", "2"}, now.Add(time.Minute), true},
+		{Key{"a", "eta", "3"}, now.Add(time.Minute * 2), false},
+		{Key{"b", "eta", "3"}, now.Add(time.Minute * 2), true},
+		// cap resets the next day
+		{Key{"a", "eta", "3"}, now.Add(time.Hour * 24), true},
+	}
+
+	for i, c := range cases {
+		if allowed := th.allowAt(c.key, c.time); allowed != c.expected {
+			t.Errorf("case %d: got %t, expected %t", i, allowed, c.expected)
+		}
+	}
+}
+
+func TestThrottleSetLimits(t *testing.T) {
+	th := NewThrottle(time.Minute*10, 1)
+	now := time.Date(2018, time.April, 16, 12, 0, 0, 0, time.UTC)
+	key := Key{Subscriber: "rider", EventType: "eta", Entity: "stop 1"}
+
+	if !th.allowAt(key, now) {
+		t.Error("expected first notification to be allowed")
+	}
+	th.SetLimits(time.Minute, 2)
+	if !th.allowAt(key, now.Add(time.Minute*2)) {
+		t.Error("expected notification after shorter window to be allowed")
+	}
+	if th.allowAt(Key{Subscriber: "rider", EventType: "eta", Entity: "stop 2"}, now.Add(time.Minute*3)) {
+		t.Error("expected notifications sent before SetLimits to count against the new cap")
+	}
+}
@@ -0,0 +1,230 @@
+// Package pb encodes Shuttle Tracker models as Protocol Buffers, following the
+// schema in shuttletracker.proto. Mobile clients can generate decoders from that
+// schema; we encode by hand so that the server doesn't depend on protoc.
+package pb
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ErrUnsupportedType indicates that a value has no Protocol Buffers encoding.
+var ErrUnsupportedType = errors.New("type cannot be encoded as protobuf")
+
+// Marshal encodes a slice of Vehicles, Routes, Stops, or Locations as the
+// corresponding list message from shuttletracker.proto.
+func Marshal(data interface{}) ([]byte, error) {
+	var b []byte
+	switch v := data.(type) {
+	case []*shuttletracker.Vehicle:
+		for _, vehicle := range v {
+			b = appendMessage(b, 1, marshalVehicle(vehicle))
+		}
+	case []*shuttletracker.Route:
+		for _, route := range v {
+			b = appendMessage(b, 1, marshalRoute(route))
+		}
+	case []*shuttletracker.Stop:
+		for _, stop := range v {
+			b = appendMessage(b, 1, marshalStop(stop))
+		}
+	case []*shuttletracker.Location:
+		for _, loc := range v {
+			b = appendMessage(b, 1, marshalLocation(loc))
+		}
+	default:
+		return nil, ErrUnsupportedType
+	}
+	return b, nil
+}
+
+func marshalVehicle(v *shuttletracker.Vehicle) []byte {
+	var b []byte
+	b = appendInt(b, 1, v.ID)
+	b = appendString(b, 2, v.Name)
+	b = appendTime(b, 3, v.Created)
+	b = appendTime(b, 4, v.Updated)
+	b = appendBool(b, 5, v.Enabled)
+	b = appendString(b, 6, v.TrackerID)
+	b = appendInt(b, 7, int64(v.Capacity))
+	b = appendBool(b, 8, v.WheelchairAccessible)
+	b = appendString(b, 9, v.Make)
+	b = appendString(b, 10, v.Model)
+	b = appendString(b, 11, v.LicensePlate)
+	b = appendBool(b, 12, v.OutOfService)
+	if v.OutOfServiceUntil != nil {
+		b = appendTime(b, 13, *v.OutOfServiceUntil)
+	}
+	b = appendString(b, 14, v.Color)
+	b = appendString(b, 15, v.Label)
+	b = appendString(b, 16, v.Icon)
+	if v.GroupID != nil {
+		b = protowire.AppendTag(b, 17, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*v.GroupID))
+	}
+	return b
+}
+
+func marshalRoute(r *shuttletracker.Route) []byte {
+	var b []byte
+	b = appendInt(b, 1, r.ID)
+	b = appendString(b, 2, r.Name)
+	b = appendString(b, 3, r.Description)
+	b = appendBool(b, 4, r.Enabled)
+	b = appendString(b, 5, r.Color)
+	b = appendInt(b, 6, r.Width)
+	if len(r.StopIDs) > 0 {
+		var packed []byte
+		for _, id := range r.StopIDs {
+			packed = protowire.AppendVarint(packed, uint64(id))
+		}
+		b = appendMessage(b, 7, packed)
+	}
+	b = appendTime(b, 8, r.Created)
+	b = appendTime(b, 9, r.Updated)
+	for _, p := range r.Points {
+		var point []byte
+		point = appendDouble(point, 1, p.Latitude)
+		point = appendDouble(point, 2, p.Longitude)
+		b = appendMessage(b, 10, point)
+	}
+	b = appendBool(b, 11, r.Active)
+	for _, interval := range r.Schedule {
+		b = appendMessage(b, 12, marshalRouteActiveInterval(interval))
+	}
+	b = appendString(b, 13, r.Label)
+	b = appendString(b, 14, r.Icon)
+	if r.DetourID != nil {
+		b = protowire.AppendTag(b, 15, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*r.DetourID))
+	}
+	b = appendInt(b, 16, r.ZIndex)
+	b = appendString(b, 17, r.DashPattern)
+	for _, segment := range r.Segments {
+		var sb []byte
+		sb = appendInt(sb, 1, segment.DirectionID)
+		sb = appendString(sb, 2, segment.Name)
+		if len(segment.StopIDs) > 0 {
+			var packed []byte
+			for _, id := range segment.StopIDs {
+				packed = protowire.AppendVarint(packed, uint64(id))
+			}
+			sb = appendMessage(sb, 3, packed)
+		}
+		b = appendMessage(b, 18, sb)
+	}
+	for _, interval := range r.Visibility {
+		b = appendMessage(b, 19, marshalRouteActiveInterval(interval))
+	}
+	return b
+}
+
+func marshalRouteActiveInterval(interval shuttletracker.RouteActiveInterval) []byte {
+	var b []byte
+	b = appendInt(b, 1, interval.ID)
+	b = appendInt(b, 2, interval.RouteID)
+	b = appendInt(b, 3, int64(interval.StartDay))
+	b = appendTime(b, 4, interval.StartTime)
+	b = appendInt(b, 5, int64(interval.EndDay))
+	b = appendTime(b, 6, interval.EndTime)
+	return b
+}
+
+func marshalStop(s *shuttletracker.Stop) []byte {
+	var b []byte
+	b = appendInt(b, 1, s.ID)
+	b = appendDouble(b, 2, s.Latitude)
+	b = appendDouble(b, 3, s.Longitude)
+	b = appendTime(b, 4, s.Created)
+	b = appendTime(b, 5, s.Updated)
+	if s.Name != nil {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendString(b, *s.Name)
+	}
+	if s.Description != nil {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendString(b, *s.Description)
+	}
+	b = appendBool(b, 8, s.Shelter)
+	b = appendBool(b, 9, s.Lighting)
+	b = appendBool(b, 10, s.Bench)
+	b = appendBool(b, 11, s.WheelchairAccessible)
+	b = appendString(b, 12, s.PhotoURL)
+	return b
+}
+
+func marshalLocation(l *shuttletracker.Location) []byte {
+	var b []byte
+	b = appendInt(b, 1, l.ID)
+	b = appendString(b, 2, l.TrackerID)
+	b = appendDouble(b, 3, l.Latitude)
+	b = appendDouble(b, 4, l.Longitude)
+	b = appendDouble(b, 5, l.Heading)
+	b = appendDouble(b, 6, l.Speed)
+	b = appendTime(b, 7, l.Time)
+	b = appendTime(b, 8, l.Created)
+	if l.VehicleID != nil {
+		b = protowire.AppendTag(b, 9, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*l.VehicleID))
+	}
+	if l.RouteID != nil {
+		b = protowire.AppendTag(b, 10, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*l.RouteID))
+	}
+	b = appendString(b, 11, l.Occupancy)
+	return b
+}
+
+// The append functions below follow proto3 semantics: fields with zero values
+// are not written.
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendInt(b []byte, num protowire.Number, i int64) []byte {
+	if i == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(i))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+func appendDouble(b []byte, num protowire.Number, f float64) []byte {
+	if f == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(f))
+}
+
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	// UnixNano overflows for times before 1678, like a schedule's times of
+	// day in year 0.
+	return appendInt(b, num, t.Unix()*1000+int64(t.Nanosecond())/int64(time.Millisecond))
+}
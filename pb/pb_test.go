@@ -0,0 +1,86 @@
+package pb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestMarshalVehicles(t *testing.T) {
+	vehicles := []*shuttletracker.Vehicle{
+		{
+			ID:        1,
+			Name:      "A",
+			Enabled:   true,
+			TrackerID: "2",
+		},
+	}
+
+	expected := []byte{
+		// vehicles (1)
+		0x0a, 0x0a,
+		// id (1), name (2), enabled (5), tracker_id (6)
+		0x08, 0x01,
+		0x12, 0x01, 'A',
+		0x28, 0x01,
+		0x32, 0x01, '2',
+	}
+	actual, err := Marshal(vehicles)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("got %x, expected %x", actual, expected)
+	}
+}
+
+func TestMarshalLocationNullableFields(t *testing.T) {
+	zero := int64(0)
+	locations := []*shuttletracker.Location{
+		{
+			VehicleID: &zero,
+		},
+	}
+
+	// vehicle_id (9) is optional, so it is written even though it is zero.
+	expected := []byte{0x0a, 0x02, 0x48, 0x00}
+	actual, err := Marshal(locations)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("got %x, expected %x", actual, expected)
+	}
+}
+
+func TestMarshalTimeBeforeUnixNano(t *testing.T) {
+	locations := []*shuttletracker.Location{
+		{
+			Time: time.Date(0, time.January, 1, 0, 0, 1, int(500*time.Millisecond), time.UTC),
+		},
+	}
+
+	// time (7) is milliseconds since the Unix epoch.
+	ms := int64(-62167219198500)
+	location := protowire.AppendTag(nil, 7, protowire.VarintType)
+	location = protowire.AppendVarint(location, uint64(ms))
+	expected := protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), location)
+	actual, err := Marshal(locations)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("got %x, expected %x", actual, expected)
+	}
+}
+
+func TestMarshalUnsupportedType(t *testing.T) {
+	_, err := Marshal("hello")
+	if err != ErrUnsupportedType {
+		t.Errorf("got error %v, expected %v", err, ErrUnsupportedType)
+	}
+}
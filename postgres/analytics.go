@@ -0,0 +1,294 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// AnalyticsService implements shuttletracker.AnalyticsService.
+type AnalyticsService struct {
+	db *sql.DB
+}
+
+func (as *AnalyticsService) initializeSchema(db *sql.DB) error {
+	as.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS density_hours (
+	hour timestamp with time zone PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS density_cells (
+	hour timestamp with time zone NOT NULL REFERENCES density_hours ON DELETE CASCADE,
+	size double precision NOT NULL,
+	row_index bigint NOT NULL,
+	column_index bigint NOT NULL,
+	count bigint NOT NULL,
+	speed_sum double precision NOT NULL,
+	PRIMARY KEY (hour, size, row_index, column_index)
+);
+CREATE TABLE IF NOT EXISTS demand (
+	hour timestamp with time zone NOT NULL,
+	stop_id integer NOT NULL,
+	bus_button_presses bigint NOT NULL,
+	eta_subscriptions bigint NOT NULL,
+	PRIMARY KEY (hour, stop_id)
+);
+ALTER TABLE demand ADD COLUMN IF NOT EXISTS alarms bigint NOT NULL DEFAULT 0;
+ALTER TABLE demand ADD COLUMN IF NOT EXISTS timetable_queries bigint NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS mileage_days (
+	day timestamp with time zone PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS vehicle_mileage (
+	day timestamp with time zone NOT NULL REFERENCES mileage_days ON DELETE CASCADE,
+	vehicle_id integer NOT NULL,
+	distance double precision NOT NULL,
+	PRIMARY KEY (day, vehicle_id)
+);
+CREATE TABLE IF NOT EXISTS route_loop_times (
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	hour smallint NOT NULL CHECK (hour >= 0 AND hour < 24),
+	loops bigint NOT NULL,
+	mean_duration double precision NOT NULL,
+	median_duration double precision NOT NULL,
+	min_duration double precision NOT NULL,
+	max_duration double precision NOT NULL,
+	PRIMARY KEY (route_id, hour)
+);`
+	_, err := as.db.Exec(schema)
+	return err
+}
+
+// SetDensity replaces the density grid for an hour in a single transaction,
+// so an hour is either missing or complete.
+func (as *AnalyticsService) SetDensity(hour time.Time, cells []*shuttletracker.DensityCell) error {
+	tx, err := as.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM density_hours WHERE hour = $1;", hour); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("INSERT INTO density_hours (hour) VALUES ($1);", hour); err != nil {
+		return err
+	}
+	statement := "INSERT INTO density_cells (hour, size, row_index, column_index, count, speed_sum) VALUES ($1, $2, $3, $4, $5, $6);"
+	for _, c := range cells {
+		if _, err = tx.Exec(statement, hour, c.Size, c.Row, c.Column, c.Count, c.AverageSpeed*float64(c.Count)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LastDensityHour returns the most recent hour that has a density grid.
+func (as *AnalyticsService) LastDensityHour() (time.Time, error) {
+	var hour *time.Time
+	if err := as.db.QueryRow("SELECT max(hour) FROM density_hours;").Scan(&hour); err != nil {
+		return time.Time{}, err
+	}
+	if hour == nil {
+		return time.Time{}, nil
+	}
+	return *hour, nil
+}
+
+// Density adds up the density grids for a range of hours, cell by cell.
+func (as *AnalyticsService) Density(since, until time.Time) ([]*shuttletracker.DensityCell, error) {
+	query := "SELECT size, row_index, column_index, sum(count), sum(speed_sum) FROM density_cells" +
+		" WHERE hour >= $1 AND hour < $2 GROUP BY size, row_index, column_index ORDER BY size, row_index, column_index;"
+	rows, err := as.db.Query(query, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cells := []*shuttletracker.DensityCell{}
+	for rows.Next() {
+		c := &shuttletracker.DensityCell{}
+		var speedSum float64
+		if err := rows.Scan(&c.Size, &c.Row, &c.Column, &c.Count, &speedSum); err != nil {
+			return nil, err
+		}
+		c.Latitude = float64(c.Row) * c.Size
+		c.Longitude = float64(c.Column) * c.Size
+		if c.Count > 0 {
+			c.AverageSpeed = speedSum / float64(c.Count)
+		}
+		cells = append(cells, c)
+	}
+	return cells, rows.Err()
+}
+
+// RecordDemand adds to the demand totals in a single transaction. Stops
+// aren't referenced so that totals survive a Stop being deleted.
+func (as *AnalyticsService) RecordDemand(demand []*shuttletracker.Demand) error {
+	tx, err := as.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "INSERT INTO demand (hour, stop_id, bus_button_presses, eta_subscriptions, alarms, timetable_queries)" +
+		" VALUES ($1, $2, $3, $4, $5, $6)" +
+		" ON CONFLICT (hour, stop_id) DO UPDATE SET bus_button_presses = demand.bus_button_presses + excluded.bus_button_presses," +
+		" eta_subscriptions = demand.eta_subscriptions + excluded.eta_subscriptions," +
+		" alarms = demand.alarms + excluded.alarms," +
+		" timetable_queries = demand.timetable_queries + excluded.timetable_queries;"
+	for _, d := range demand {
+		_, err = tx.Exec(statement, d.Hour, d.StopID, d.BusButtonPresses, d.ETASubscriptions, d.Alarms, d.TimetableQueries)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Demand returns the demand totals for a range of hours.
+func (as *AnalyticsService) Demand(since, until time.Time) ([]*shuttletracker.Demand, error) {
+	query := "SELECT hour, stop_id, bus_button_presses, eta_subscriptions, alarms, timetable_queries FROM demand" +
+		" WHERE hour >= $1 AND hour < $2 ORDER BY hour, stop_id;"
+	rows, err := as.db.Query(query, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	demand := []*shuttletracker.Demand{}
+	for rows.Next() {
+		d := &shuttletracker.Demand{}
+		if err := rows.Scan(&d.Hour, &d.StopID, &d.BusButtonPresses, &d.ETASubscriptions, &d.Alarms, &d.TimetableQueries); err != nil {
+			return nil, err
+		}
+		demand = append(demand, d)
+	}
+	return demand, rows.Err()
+}
+
+// SetMileage replaces the mileage for a day in a single transaction, so a day
+// is either missing or complete. Vehicles aren't referenced so that history
+// survives a Vehicle being deleted.
+func (as *AnalyticsService) SetMileage(day time.Time, mileage []*shuttletracker.Mileage) error {
+	tx, err := as.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM mileage_days WHERE day = $1;", day); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("INSERT INTO mileage_days (day) VALUES ($1);", day); err != nil {
+		return err
+	}
+	statement := "INSERT INTO vehicle_mileage (day, vehicle_id, distance) VALUES ($1, $2, $3);"
+	for _, m := range mileage {
+		if _, err = tx.Exec(statement, day, m.VehicleID, m.Distance); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LastMileageDay returns the most recent day that has mileage.
+func (as *AnalyticsService) LastMileageDay() (time.Time, error) {
+	var day *time.Time
+	if err := as.db.QueryRow("SELECT max(day) FROM mileage_days;").Scan(&day); err != nil {
+		return time.Time{}, err
+	}
+	if day == nil {
+		return time.Time{}, nil
+	}
+	return *day, nil
+}
+
+// Mileage returns the mileage for a range of days.
+func (as *AnalyticsService) Mileage(since, until time.Time) ([]*shuttletracker.Mileage, error) {
+	query := "SELECT vehicle_id, day, distance FROM vehicle_mileage" +
+		" WHERE day >= $1 AND day < $2 ORDER BY day, vehicle_id;"
+	rows, err := as.db.Query(query, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mileage := []*shuttletracker.Mileage{}
+	for rows.Next() {
+		m := &shuttletracker.Mileage{}
+		if err := rows.Scan(&m.VehicleID, &m.Day, &m.Distance); err != nil {
+			return nil, err
+		}
+		mileage = append(mileage, m)
+	}
+	return mileage, rows.Err()
+}
+
+// TotalMileage returns each vehicle's total mileage over every day.
+func (as *AnalyticsService) TotalMileage() (map[int64]float64, error) {
+	rows, err := as.db.Query("SELECT vehicle_id, sum(distance) FROM vehicle_mileage GROUP BY vehicle_id;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	totals := map[int64]float64{}
+	for rows.Next() {
+		var vehicleID int64
+		var distance float64
+		if err := rows.Scan(&vehicleID, &distance); err != nil {
+			return nil, err
+		}
+		totals[vehicleID] = distance
+	}
+	return totals, rows.Err()
+}
+
+// SetLoopTimes replaces the loop times for every route in a single
+// transaction, so they're never from more than one calculation. Loop times for
+// routes deleted since they were calculated are left out.
+func (as *AnalyticsService) SetLoopTimes(loopTimes []*shuttletracker.LoopTime) error {
+	tx, err := as.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM route_loop_times;"); err != nil {
+		return err
+	}
+	statement := "INSERT INTO route_loop_times (route_id, hour, loops, mean_duration, median_duration, min_duration, max_duration)" +
+		" SELECT $1::integer, $2::smallint, $3::bigint, $4::double precision, $5::double precision," +
+		" $6::double precision, $7::double precision WHERE EXISTS (SELECT 1 FROM routes WHERE id = $1);"
+	for _, lt := range loopTimes {
+		if _, err = tx.Exec(statement, lt.RouteID, lt.Hour, lt.Loops, lt.Mean, lt.Median, lt.Min, lt.Max); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoopTimes returns the loop times for every route.
+func (as *AnalyticsService) LoopTimes() ([]*shuttletracker.LoopTime, error) {
+	query := "SELECT route_id, hour, loops, mean_duration, median_duration, min_duration, max_duration" +
+		" FROM route_loop_times ORDER BY route_id, hour;"
+	rows, err := as.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	loopTimes := []*shuttletracker.LoopTime{}
+	for rows.Next() {
+		lt := &shuttletracker.LoopTime{}
+		if err := rows.Scan(&lt.RouteID, &lt.Hour, &lt.Loops, &lt.Mean, &lt.Median, &lt.Min, &lt.Max); err != nil {
+			return nil, err
+		}
+		loopTimes = append(loopTimes, lt)
+	}
+	return loopTimes, rows.Err()
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ArrivalService implements shuttletracker.ArrivalService.
+type ArrivalService struct {
+	db *sql.DB
+}
+
+func (as *ArrivalService) initializeSchema(db *sql.DB) error {
+	as.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS arrivals (
+	id serial PRIMARY KEY,
+	vehicle_id integer REFERENCES vehicles ON DELETE CASCADE NOT NULL,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	stop_id integer REFERENCES stops ON DELETE CASCADE NOT NULL,
+	time timestamp with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS arrivals_time_idx ON arrivals (time);
+`
+	_, err := as.db.Exec(schema)
+	return err
+}
+
+// CreateArrival creates an Arrival.
+func (as *ArrivalService) CreateArrival(a *shuttletracker.Arrival) error {
+	statement := "INSERT INTO arrivals (vehicle_id, route_id, stop_id, time) VALUES ($1, $2, $3, $4) RETURNING id;"
+	row := as.db.QueryRow(statement, a.VehicleID, a.RouteID, a.StopID, a.Time)
+	return row.Scan(&a.ID)
+}
+
+// ExportArrivals calls fn with each Arrival matching the filter, ordered oldest to newest.
+func (as *ArrivalService) ExportArrivals(filter shuttletracker.HistoryFilter, fn func(*shuttletracker.Arrival) error) error {
+	query := "SELECT a.id, a.vehicle_id, a.route_id, a.stop_id, a.time FROM arrivals a" +
+		" WHERE a.time >= $1 AND a.time < $2" +
+		" AND ($3::integer IS NULL OR a.vehicle_id = $3)" +
+		" AND ($4::integer IS NULL OR a.route_id = $4)" +
+		" AND ($5::integer IS NULL OR a.stop_id = $5)" +
+		" AND ($6::integer IS NULL OR a.vehicle_id IN (SELECT id FROM vehicles WHERE group_id = $6))" +
+		" ORDER BY a.time;"
+	rows, err := as.db.Query(query, filter.Since, filter.Until, filter.VehicleID, filter.RouteID, filter.StopID, filter.GroupID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := &shuttletracker.Arrival{}
+		err := rows.Scan(&a.ID, &a.VehicleID, &a.RouteID, &a.StopID, &a.Time)
+		if err != nil {
+			return err
+		}
+		if err = fn(a); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/lib/pq"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// broadcastChannelPrefix is prepended to broadcast channel names so that they
+// don't collide with other notifications.
+const broadcastChannelPrefix = "broadcast."
+
+// BroadcastService implements shuttletracker.BroadcastService with Postgres
+// LISTEN/NOTIFY.
+type BroadcastService struct {
+	db       *sql.DB
+	listener *pq.Listener
+
+	mutex       sync.Mutex
+	subscribers map[string][]chan string
+}
+
+func (bs *BroadcastService) initialize(db *sql.DB, listener *pq.Listener) {
+	bs.db = db
+	bs.listener = listener
+	bs.subscribers = map[string][]chan string{}
+}
+
+// Broadcast sends payload to every subscriber of channel in every instance.
+// Payloads must be smaller than 8000 bytes.
+func (bs *BroadcastService) Broadcast(channel, payload string) error {
+	_, err := bs.db.Exec("SELECT pg_notify($1, $2);", broadcastChannelPrefix+channel, payload)
+	return err
+}
+
+// SubscribeBroadcasts returns a chan that receives each payload broadcast on
+// channel. Payloads are dropped if the subscriber falls behind.
+func (bs *BroadcastService) SubscribeBroadcasts(channel string) chan string {
+	c := make(chan string, 50)
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	if len(bs.subscribers[channel]) == 0 {
+		err := bs.listener.Listen(broadcastChannelPrefix + channel)
+		if err != nil && err != pq.ErrChannelAlreadyOpen {
+			log.WithError(err).Errorf("unable to listen for %s broadcasts", channel)
+		}
+	}
+	bs.subscribers[channel] = append(bs.subscribers[channel], c)
+	return c
+}
+
+func (bs *BroadcastService) handle(n *pq.Notification) {
+	channel := n.Channel[len(broadcastChannelPrefix):]
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	for _, c := range bs.subscribers[channel] {
+		select {
+		case c <- n.Extra:
+		default:
+			log.Warnf("%s broadcast subscriber is full; dropping message", channel)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// CalendarService implements shuttletracker.CalendarService.
+type CalendarService struct {
+	db *sql.DB
+}
+
+func (cs *CalendarService) initializeSchema(db *sql.DB) error {
+	cs.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS service_periods (
+	id serial PRIMARY KEY,
+	name text NOT NULL DEFAULT '',
+	type text NOT NULL,
+	start_date date NOT NULL,
+	end_date date NOT NULL,
+	schedule_ids integer[] NOT NULL DEFAULT '{}',
+	CHECK (start_date <= end_date)
+);`
+	_, err := cs.db.Exec(schema)
+	return err
+}
+
+// queryer is a *sql.DB or *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// contextQueryer runs the queries of a *sql.DB or *sql.Tx as part of ctx's
+// trace, for functions that take a queryer.
+type contextQueryer struct {
+	ctx context.Context
+	q   interface {
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	}
+}
+
+func (cq contextQueryer) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return cq.q.QueryContext(cq.ctx, query, args...)
+}
+
+// execer is a *sql.DB or *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// ServicePeriods returns all ServicePeriods, earliest first.
+func (cs *CalendarService) ServicePeriods() ([]*shuttletracker.ServicePeriod, error) {
+	return servicePeriods(cs.db)
+}
+
+func servicePeriods(q queryer) ([]*shuttletracker.ServicePeriod, error) {
+	periods := []*shuttletracker.ServicePeriod{}
+	query := "SELECT id, name, type, start_date::text, end_date::text, schedule_ids" +
+		" FROM service_periods ORDER BY start_date, id;"
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := &shuttletracker.ServicePeriod{}
+		err := rows.Scan(&p.ID, &p.Name, &p.Type, &p.Start, &p.End, pq.Array(&p.ScheduleIDs))
+		if err != nil {
+			return nil, err
+		}
+		if p.ScheduleIDs == nil {
+			p.ScheduleIDs = []int64{}
+		}
+		periods = append(periods, p)
+	}
+	return periods, rows.Err()
+}
+
+// CreateServicePeriod creates a ServicePeriod.
+func (cs *CalendarService) CreateServicePeriod(period *shuttletracker.ServicePeriod) error {
+	statement := "INSERT INTO service_periods (name, type, start_date, end_date, schedule_ids)" +
+		" VALUES ($1, $2, $3, $4, $5) RETURNING id;"
+	row := cs.db.QueryRow(statement, period.Name, period.Type, period.Start, period.End, pq.Array(period.ScheduleIDs))
+	return row.Scan(&period.ID)
+}
+
+// ModifyServicePeriod updates a ServicePeriod.
+func (cs *CalendarService) ModifyServicePeriod(period *shuttletracker.ServicePeriod) error {
+	statement := "UPDATE service_periods SET name = $1, type = $2, start_date = $3, end_date = $4, schedule_ids = $5" +
+		" WHERE id = $6;"
+	result, err := cs.db.Exec(statement, period.Name, period.Type, period.Start, period.End, pq.Array(period.ScheduleIDs), period.ID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrServicePeriodNotFound
+	}
+	return nil
+}
+
+// DeleteServicePeriod deletes a ServicePeriod.
+func (cs *CalendarService) DeleteServicePeriod(id int64) error {
+	result, err := cs.db.Exec("DELETE FROM service_periods WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrServicePeriodNotFound
+	}
+	return nil
+}
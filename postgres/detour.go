@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// DetourService implements shuttletracker.DetourService.
+type DetourService struct {
+	db *sql.DB
+}
+
+func (ds *DetourService) initializeSchema(db *sql.DB) error {
+	ds.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS detours (
+	id serial PRIMARY KEY,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	description text NOT NULL DEFAULT '',
+	points path NOT NULL,
+	start_time timestamp with time zone NOT NULL,
+	end_time timestamp with time zone NOT NULL,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now(),
+	CHECK (start_time < end_time)
+);
+CREATE INDEX IF NOT EXISTS detours_route_id_start_time_idx ON detours (route_id, start_time);
+`
+	_, err := ds.db.Exec(schema)
+	return err
+}
+
+const detourColumns = "id, route_id, description, points, start_time, end_time, created, updated"
+
+func scanDetour(row interface{ Scan(...interface{}) error }) (*shuttletracker.Detour, error) {
+	d := &shuttletracker.Detour{}
+	p := scanPoints{}
+	err := row.Scan(&d.ID, &d.RouteID, &d.Description, &p, &d.Start, &d.End, &d.Created, &d.Updated)
+	d.Points = p.points
+	return d, err
+}
+
+func queryDetours(q queryer, query string, args ...interface{}) ([]*shuttletracker.Detour, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	detours := []*shuttletracker.Detour{}
+	for rows.Next() {
+		d, err := scanDetour(rows)
+		if err != nil {
+			return nil, err
+		}
+		detours = append(detours, d)
+	}
+	return detours, rows.Err()
+}
+
+// Detour returns the Detour with the provided ID.
+func (ds *DetourService) Detour(id int64) (*shuttletracker.Detour, error) {
+	row := ds.db.QueryRow("SELECT "+detourColumns+" FROM detours WHERE id = $1;", id)
+	d, err := scanDetour(row)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrDetourNotFound
+	}
+	return d, err
+}
+
+// Detours returns the Detours overlapping the filter, ordered by when they start.
+func (ds *DetourService) Detours(filter shuttletracker.HistoryFilter) ([]*shuttletracker.Detour, error) {
+	query := "SELECT " + detourColumns + " FROM detours" +
+		" WHERE start_time < $2 AND end_time > $1" +
+		" AND ($3::integer IS NULL OR route_id = $3)" +
+		" ORDER BY start_time, id;"
+	return queryDetours(ds.db, query, filter.Since, filter.Until, filter.RouteID)
+}
+
+// CreateDetour creates a Detour.
+func (ds *DetourService) CreateDetour(d *shuttletracker.Detour) error {
+	statement := "INSERT INTO detours (route_id, description, points, start_time, end_time)" +
+		" VALUES ($1, $2, $3, $4, $5) RETURNING id, created, updated;"
+	row := ds.db.QueryRow(statement, d.RouteID, d.Description, valuePoints(d.Points), d.Start, d.End)
+	return row.Scan(&d.ID, &d.Created, &d.Updated)
+}
+
+// ModifyDetour updates a Detour.
+func (ds *DetourService) ModifyDetour(d *shuttletracker.Detour) error {
+	statement := "UPDATE detours SET route_id = $1, description = $2, points = $3, start_time = $4, end_time = $5," +
+		" updated = now() WHERE id = $6 RETURNING created, updated;"
+	row := ds.db.QueryRow(statement, d.RouteID, d.Description, valuePoints(d.Points), d.Start, d.End, d.ID)
+	err := row.Scan(&d.Created, &d.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrDetourNotFound
+	}
+	return err
+}
+
+// DeleteDetour deletes a Detour.
+func (ds *DetourService) DeleteDetour(id int64) error {
+	result, err := ds.db.Exec("DELETE FROM detours WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrDetourNotFound
+	}
+	return nil
+}
+
+// applyDetours replaces part of each Route's Points with its Detour that is in
+// effect at now, if it has one.
+func applyDetours(q queryer, routes []*shuttletracker.Route, now time.Time) error {
+	query := "SELECT " + detourColumns + " FROM detours" +
+		" WHERE start_time <= $1 AND end_time > $1 ORDER BY start_time, id;"
+	detours, err := queryDetours(q, query, now)
+	if err != nil {
+		return err
+	}
+	byRoute := map[int64]*shuttletracker.Detour{}
+	for _, d := range detours {
+		byRoute[d.RouteID] = d
+	}
+	for _, route := range routes {
+		d, ok := byRoute[route.ID]
+		if !ok {
+			continue
+		}
+		if !d.Apply(route) {
+			log.WithField("detour", d.ID).Warn("Detour doesn't fit its route.")
+		}
+	}
+	return nil
+}
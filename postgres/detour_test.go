@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestDetours(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	route := &shuttletracker.Route{
+		Name: "Test Route",
+		Points: []shuttletracker.Point{
+			{Latitude: 42.0, Longitude: -73.0},
+			{Latitude: 42.1, Longitude: -73.0},
+			{Latitude: 42.2, Longitude: -73.0},
+			{Latitude: 42.3, Longitude: -73.0},
+		},
+	}
+	if err := pg.CreateRoute(route); err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	detour := &shuttletracker.Detour{
+		RouteID: route.ID,
+		Points: []shuttletracker.Point{
+			{Latitude: 42.1, Longitude: -73.0},
+			{Latitude: 42.15, Longitude: -73.1},
+			{Latitude: 42.2, Longitude: -73.0},
+		},
+		Start: now.Add(-time.Hour),
+		End:   now.Add(time.Hour),
+	}
+	if err := pg.CreateDetour(detour); err != nil {
+		t.Fatalf("unable to create Detour: %s", err)
+	}
+
+	detoured, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if detoured.DetourID == nil || *detoured.DetourID != detour.ID || len(detoured.Points) != 5 {
+		t.Fatalf("got %+v, expected detour %d to be applied", detoured, detour.ID)
+	}
+
+	// Modifying a detoured Route keeps its own points.
+	detoured.Color = "#000000"
+	if err := pg.ModifyRoute(detoured); err != nil {
+		t.Fatalf("unable to modify Route: %s", err)
+	}
+
+	// Detours that start when the filter ends, or end when it starts, don't overlap it.
+	for _, filter := range []shuttletracker.HistoryFilter{
+		{Since: detour.Start.Add(-time.Hour), Until: detour.Start, RouteID: &route.ID},
+		{Since: detour.End, Until: detour.End.Add(time.Hour), RouteID: &route.ID},
+	} {
+		detours, err := pg.Detours(filter)
+		if err != nil {
+			t.Fatalf("unable to get Detours: %s", err)
+		}
+		if len(detours) != 0 {
+			t.Errorf("got %d Detours from %s to %s, expected none", len(detours), filter.Since, filter.Until)
+		}
+	}
+
+	detour.End = now.Add(-time.Minute)
+	if err := pg.ModifyDetour(detour); err != nil {
+		t.Fatalf("unable to modify Detour: %s", err)
+	}
+	reverted, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if reverted.DetourID != nil || len(reverted.Points) != 4 || reverted.Color != "#000000" {
+		t.Errorf("got %+v, expected the route's own points", reverted)
+	}
+
+	if err := pg.DeleteDetour(detour.ID); err != nil {
+		t.Fatalf("unable to delete Detour: %s", err)
+	}
+	if _, err := pg.Detour(detour.ID); err != shuttletracker.ErrDetourNotFound {
+		t.Errorf("got error %v, expected ErrDetourNotFound", err)
+	}
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// DeviationService implements shuttletracker.DeviationService.
+type DeviationService struct {
+	db *sql.DB
+}
+
+func (ds *DeviationService) initializeSchema(db *sql.DB) error {
+	ds.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS deviations (
+	id serial PRIMARY KEY,
+	arrival_id integer REFERENCES arrivals ON DELETE CASCADE NOT NULL,
+	trip_id integer REFERENCES trips ON DELETE SET NULL,
+	vehicle_id integer REFERENCES vehicles ON DELETE CASCADE NOT NULL,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	stop_id integer REFERENCES stops ON DELETE CASCADE NOT NULL,
+	scheduled timestamp with time zone NOT NULL,
+	actual timestamp with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS deviations_actual_idx ON deviations (actual);
+`
+	_, err := ds.db.Exec(schema)
+	return err
+}
+
+// CreateDeviation creates a Deviation.
+func (ds *DeviationService) CreateDeviation(d *shuttletracker.Deviation) error {
+	statement := "INSERT INTO deviations (arrival_id, trip_id, vehicle_id, route_id, stop_id, scheduled, actual)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;"
+	row := ds.db.QueryRow(statement, d.ArrivalID, d.TripID, d.VehicleID, d.RouteID, d.StopID, d.Scheduled, d.Actual)
+	return row.Scan(&d.ID)
+}
+
+// ExportDeviations calls fn with each Deviation matching the filter, ordered oldest to newest.
+func (ds *DeviationService) ExportDeviations(filter shuttletracker.HistoryFilter, fn func(*shuttletracker.Deviation) error) error {
+	query := "SELECT d.id, d.arrival_id, d.trip_id, d.vehicle_id, d.route_id, d.stop_id, d.scheduled, d.actual FROM deviations d" +
+		" WHERE d.actual >= $1 AND d.actual < $2" +
+		" AND ($3::integer IS NULL OR d.vehicle_id = $3)" +
+		" AND ($4::integer IS NULL OR d.route_id = $4)" +
+		" AND ($5::integer IS NULL OR d.stop_id = $5)" +
+		" AND ($6::integer IS NULL OR d.vehicle_id IN (SELECT id FROM vehicles WHERE group_id = $6))" +
+		" ORDER BY d.actual;"
+	rows, err := ds.db.Query(query, filter.Since, filter.Until, filter.VehicleID, filter.RouteID, filter.StopID, filter.GroupID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := &shuttletracker.Deviation{}
+		err := rows.Scan(&d.ID, &d.ArrivalID, &d.TripID, &d.VehicleID, &d.RouteID, &d.StopID, &d.Scheduled, &d.Actual)
+		if err != nil {
+			return err
+		}
+		if err = fn(d); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// DraftService implements shuttletracker.DraftService.
+type DraftService struct {
+	db *sql.DB
+}
+
+func (ds *DraftService) initializeSchema(db *sql.DB) error {
+	ds.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS drafts (
+	id serial PRIMARY KEY,
+	name text NOT NULL DEFAULT '',
+	changes jsonb NOT NULL DEFAULT '[]',
+	publish_at timestamp with time zone,
+	published timestamp with time zone,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now()
+);`
+	_, err := ds.db.Exec(schema)
+	return err
+}
+
+// Draft returns the Draft with the provided ID.
+func (ds *DraftService) Draft(id int64) (*shuttletracker.Draft, error) {
+	drafts, err := ds.drafts("WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(drafts) == 0 {
+		return nil, shuttletracker.ErrDraftNotFound
+	}
+	return drafts[0], nil
+}
+
+// Drafts returns all Drafts, oldest first.
+func (ds *DraftService) Drafts() ([]*shuttletracker.Draft, error) {
+	return ds.drafts("")
+}
+
+func (ds *DraftService) drafts(where string, args ...interface{}) ([]*shuttletracker.Draft, error) {
+	query := "SELECT id, name, changes, publish_at, published, created, updated FROM drafts " + where + " ORDER BY id;"
+	rows, err := ds.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	drafts := []*shuttletracker.Draft{}
+	for rows.Next() {
+		d := &shuttletracker.Draft{}
+		var changes []byte
+		err := rows.Scan(&d.ID, &d.Name, &changes, &d.PublishAt, &d.Published, &d.Created, &d.Updated)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(changes, &d.Changes); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+// CreateDraft creates a Draft.
+func (ds *DraftService) CreateDraft(d *shuttletracker.Draft) error {
+	changes, err := json.Marshal(d.Changes)
+	if err != nil {
+		return err
+	}
+	statement := "INSERT INTO drafts (name, changes, publish_at) VALUES ($1, $2, $3) RETURNING id, created, updated;"
+	row := ds.db.QueryRow(statement, d.Name, changes, d.PublishAt)
+	return row.Scan(&d.ID, &d.Created, &d.Updated)
+}
+
+// ModifyDraft updates a Draft that hasn't been published.
+func (ds *DraftService) ModifyDraft(d *shuttletracker.Draft) error {
+	changes, err := json.Marshal(d.Changes)
+	if err != nil {
+		return err
+	}
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	if _, err = lockDraft(tx, d.ID); err != nil {
+		return err
+	}
+	statement := "UPDATE drafts SET name = $1, changes = $2, publish_at = $3, updated = now()" +
+		" WHERE id = $4 RETURNING created, updated;"
+	row := tx.QueryRow(statement, d.Name, changes, d.PublishAt, d.ID)
+	if err = row.Scan(&d.Created, &d.Updated); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteDraft deletes a Draft. Published Drafts can be deleted, but their
+// changes remain.
+func (ds *DraftService) DeleteDraft(id int64) error {
+	result, err := ds.db.Exec("DELETE FROM drafts WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrDraftNotFound
+	}
+	return nil
+}
+
+// PublishDraft makes a Draft's changes in a single transaction. Route changes
+// are made first so that new Schedules can refer to new Routes.
+func (ds *DraftService) PublishDraft(id int64) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	changes, err := lockDraft(tx, id)
+	if err != nil {
+		return err
+	}
+
+	// newRoutes maps the placeholder IDs of created Routes to their real IDs.
+	newRoutes := map[int64]int64{}
+	for i, c := range changes {
+		if c.Route == nil {
+			continue
+		}
+		placeholder := c.Route.ID
+		switch c.Action {
+		case shuttletracker.DraftCreate:
+			err = createRoute(tx, c.Route)
+			newRoutes[placeholder] = c.Route.ID
+		case shuttletracker.DraftModify:
+			err = modifyRoute(tx, c.Route)
+		case shuttletracker.DraftDelete:
+			err = deleteRoute(tx, c.Route.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("change %d: %w", i+1, err)
+		}
+	}
+	for i, c := range changes {
+		if c.Schedule == nil {
+			continue
+		}
+		if c.Schedule.RouteID < 0 {
+			routeID, ok := newRoutes[c.Schedule.RouteID]
+			if !ok {
+				return fmt.Errorf("change %d: route %d isn't created by the draft", i+1, c.Schedule.RouteID)
+			}
+			c.Schedule.RouteID = routeID
+		}
+		switch c.Action {
+		case shuttletracker.DraftCreate:
+			err = createSchedule(tx, c.Schedule)
+		case shuttletracker.DraftModify:
+			err = modifySchedule(tx, c.Schedule)
+		case shuttletracker.DraftDelete:
+			err = deleteSchedule(tx, c.Schedule.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("change %d: %w", i+1, err)
+		}
+	}
+
+	if _, err = tx.Exec("UPDATE drafts SET published = $1 WHERE id = $2;", time.Now(), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockDraft locks an unpublished Draft until the end of the transaction so
+// that it isn't changed or published by anyone else, and returns its changes.
+func lockDraft(tx *sql.Tx, id int64) ([]*shuttletracker.DraftChange, error) {
+	var changes []byte
+	var published *time.Time
+	row := tx.QueryRow("SELECT changes, published FROM drafts WHERE id = $1 FOR UPDATE;", id)
+	err := row.Scan(&changes, &published)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrDraftNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if published != nil {
+		return nil, shuttletracker.ErrDraftPublished
+	}
+	var dc []*shuttletracker.DraftChange
+	err = json.Unmarshal(changes, &dc)
+	return dc, err
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ETARecordService implements shuttletracker.ETARecordService.
+type ETARecordService struct {
+	db *sql.DB
+}
+
+func (es *ETARecordService) initializeSchema(db *sql.DB) error {
+	es.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS eta_records (
+	id serial PRIMARY KEY,
+	vehicle_id integer REFERENCES vehicles ON DELETE CASCADE NOT NULL,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	stop_id integer REFERENCES stops ON DELETE CASCADE NOT NULL,
+	eta timestamp with time zone NOT NULL,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	algorithm text NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS eta_records_created_idx ON eta_records (created);
+ALTER TABLE eta_records ADD COLUMN IF NOT EXISTS algorithm text NOT NULL DEFAULT '';
+`
+	_, err := es.db.Exec(schema)
+	return err
+}
+
+// CreateETARecords creates ETARecords in a single transaction.
+func (es *ETARecordService) CreateETARecords(records []*shuttletracker.ETARecord) error {
+	tx, err := es.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "INSERT INTO eta_records (vehicle_id, route_id, stop_id, eta, algorithm) VALUES ($1, $2, $3, $4, $5) RETURNING id, created;"
+	for _, r := range records {
+		row := tx.QueryRow(statement, r.VehicleID, r.RouteID, r.StopID, r.ETA, r.Algorithm)
+		err = row.Scan(&r.ID, &r.Created)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ExportETARecords calls fn with each ETARecord matching the filter, ordered oldest to newest.
+func (es *ETARecordService) ExportETARecords(filter shuttletracker.HistoryFilter, fn func(*shuttletracker.ETARecord) error) error {
+	query := "SELECT e.id, e.vehicle_id, e.route_id, e.stop_id, e.eta, e.algorithm, e.created FROM eta_records e" +
+		" WHERE e.created >= $1 AND e.created < $2" +
+		" AND ($3::integer IS NULL OR e.vehicle_id = $3)" +
+		" AND ($4::integer IS NULL OR e.route_id = $4)" +
+		" AND ($5::integer IS NULL OR e.stop_id = $5)" +
+		" AND ($6::integer IS NULL OR e.vehicle_id IN (SELECT id FROM vehicles WHERE group_id = $6))" +
+		" ORDER BY e.created;"
+	rows, err := es.db.Query(query, filter.Since, filter.Until, filter.VehicleID, filter.RouteID, filter.StopID, filter.GroupID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := &shuttletracker.ETARecord{}
+		err := rows.Scan(&r.ID, &r.VehicleID, &r.RouteID, &r.StopID, &r.ETA, &r.Algorithm, &r.Created)
+		if err != nil {
+			return err
+		}
+		if err = fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// FavoriteService implements shuttletracker.FavoriteService.
+type FavoriteService struct {
+	db *sql.DB
+}
+
+func (fs *FavoriteService) initializeSchema(db *sql.DB) error {
+	fs.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS favorites (
+	device_token text NOT NULL,
+	stop_id integer REFERENCES stops ON DELETE CASCADE,
+	route_id integer REFERENCES routes ON DELETE CASCADE,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	CHECK ((stop_id IS NULL) != (route_id IS NULL))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS favorites_device_token_stop_id_idx ON favorites (device_token, stop_id);
+CREATE UNIQUE INDEX IF NOT EXISTS favorites_device_token_route_id_idx ON favorites (device_token, route_id);`
+	_, err := fs.db.Exec(schema)
+	return err
+}
+
+// Favorites returns a device's Favorites, the oldest first.
+func (fs *FavoriteService) Favorites(deviceToken string) ([]*shuttletracker.Favorite, error) {
+	favorites := []*shuttletracker.Favorite{}
+	query := "SELECT f.stop_id, f.route_id, f.created FROM favorites f" +
+		" WHERE f.device_token = $1 ORDER BY f.created, f.stop_id, f.route_id;"
+	rows, err := fs.db.Query(query, deviceToken)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f := &shuttletracker.Favorite{DeviceToken: deviceToken}
+		if err := rows.Scan(&f.StopID, &f.RouteID, &f.Created); err != nil {
+			return nil, err
+		}
+		favorites = append(favorites, f)
+	}
+	return favorites, rows.Err()
+}
+
+// AddFavorite saves a Favorite. Saving one that's already saved does nothing,
+// so devices can save their favorites again whenever they sync.
+func (fs *FavoriteService) AddFavorite(favorite *shuttletracker.Favorite) error {
+	statement := "WITH inserted AS (INSERT INTO favorites (device_token, stop_id, route_id) VALUES ($1, $2, $3)" +
+		" ON CONFLICT DO NOTHING RETURNING created)" +
+		" SELECT created FROM inserted UNION ALL" +
+		" SELECT created FROM favorites WHERE device_token = $1" +
+		" AND stop_id IS NOT DISTINCT FROM $2 AND route_id IS NOT DISTINCT FROM $3 LIMIT 1;"
+	row := fs.db.QueryRow(statement, favorite.DeviceToken, favorite.StopID, favorite.RouteID)
+	return row.Scan(&favorite.Created)
+}
+
+// RemoveFavorite removes a Favorite.
+func (fs *FavoriteService) RemoveFavorite(favorite *shuttletracker.Favorite) error {
+	statement := "DELETE FROM favorites WHERE device_token = $1" +
+		" AND stop_id IS NOT DISTINCT FROM $2 AND route_id IS NOT DISTINCT FROM $3;"
+	result, err := fs.db.Exec(statement, favorite.DeviceToken, favorite.StopID, favorite.RouteID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrFavoriteNotFound
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestFavorites(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stop := &shuttletracker.Stop{}
+	if err := pg.CreateStop(stop); err != nil {
+		t.Fatalf("unable to create Stop: %s", err)
+	}
+	route := &shuttletracker.Route{Name: "Test Route"}
+	if err := pg.CreateRoute(route); err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	token := "0123456789abcdef"
+	for _, f := range []*shuttletracker.Favorite{
+		{DeviceToken: token, StopID: &stop.ID},
+		{DeviceToken: token, RouteID: &route.ID},
+		// saving again does nothing
+		{DeviceToken: token, StopID: &stop.ID},
+	} {
+		if err := pg.AddFavorite(f); err != nil {
+			t.Fatalf("unable to add Favorite: %s", err)
+		}
+		if f.Created.IsZero() {
+			t.Errorf("created was not set")
+		}
+	}
+
+	favorites, err := pg.Favorites(token)
+	if err != nil {
+		t.Fatalf("unable to get Favorites: %s", err)
+	}
+	if len(favorites) != 2 {
+		t.Fatalf("got %d Favorites, expected 2", len(favorites))
+	}
+	if other, err := pg.Favorites("another device"); err != nil || len(other) != 0 {
+		t.Errorf("got %v, %v for another device", other, err)
+	}
+
+	if err := pg.RemoveFavorite(&shuttletracker.Favorite{DeviceToken: token, RouteID: &route.ID}); err != nil {
+		t.Fatalf("unable to remove Favorite: %s", err)
+	}
+	if err := pg.RemoveFavorite(&shuttletracker.Favorite{DeviceToken: token, RouteID: &route.ID}); err != shuttletracker.ErrFavoriteNotFound {
+		t.Errorf("got %v, expected %v", err, shuttletracker.ErrFavoriteNotFound)
+	}
+
+	// deleting the Stop removes it from Favorites
+	if err := pg.DeleteStop(stop.ID); err != nil {
+		t.Fatalf("unable to delete Stop: %s", err)
+	}
+	favorites, err = pg.Favorites(token)
+	if err != nil {
+		t.Fatalf("unable to get Favorites: %s", err)
+	}
+	if len(favorites) != 0 {
+		t.Errorf("got %d Favorites, expected 0", len(favorites))
+	}
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// VehicleGroupService implements shuttletracker.VehicleGroupService.
+type VehicleGroupService struct {
+	db *sql.DB
+}
+
+func (gs *VehicleGroupService) initializeSchema(db *sql.DB) error {
+	gs.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS vehicle_groups (
+	id serial PRIMARY KEY,
+	name text UNIQUE NOT NULL,
+	description text NOT NULL DEFAULT '',
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now()
+);
+`
+	_, err := gs.db.Exec(schema)
+	return err
+}
+
+const vehicleGroupColumns = "id, name, description, created, updated"
+
+func scanVehicleGroup(row interface{ Scan(...interface{}) error }) (*shuttletracker.VehicleGroup, error) {
+	g := &shuttletracker.VehicleGroup{}
+	err := row.Scan(&g.ID, &g.Name, &g.Description, &g.Created, &g.Updated)
+	return g, err
+}
+
+// VehicleGroup returns the VehicleGroup with the provided ID.
+func (gs *VehicleGroupService) VehicleGroup(id int64) (*shuttletracker.VehicleGroup, error) {
+	row := gs.db.QueryRow("SELECT "+vehicleGroupColumns+" FROM vehicle_groups WHERE id = $1;", id)
+	g, err := scanVehicleGroup(row)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrVehicleGroupNotFound
+	}
+	return g, err
+}
+
+// VehicleGroups returns all VehicleGroups ordered by name.
+func (gs *VehicleGroupService) VehicleGroups() ([]*shuttletracker.VehicleGroup, error) {
+	rows, err := gs.db.Query("SELECT " + vehicleGroupColumns + " FROM vehicle_groups ORDER BY name, id;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	groups := []*shuttletracker.VehicleGroup{}
+	for rows.Next() {
+		g, err := scanVehicleGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// CreateVehicleGroup creates a VehicleGroup.
+func (gs *VehicleGroupService) CreateVehicleGroup(g *shuttletracker.VehicleGroup) error {
+	statement := "INSERT INTO vehicle_groups (name, description) VALUES ($1, $2) RETURNING id, created, updated;"
+	row := gs.db.QueryRow(statement, g.Name, g.Description)
+	return row.Scan(&g.ID, &g.Created, &g.Updated)
+}
+
+// ModifyVehicleGroup updates a VehicleGroup.
+func (gs *VehicleGroupService) ModifyVehicleGroup(g *shuttletracker.VehicleGroup) error {
+	statement := "UPDATE vehicle_groups SET name = $1, description = $2, updated = now()" +
+		" WHERE id = $3 RETURNING created, updated;"
+	row := gs.db.QueryRow(statement, g.Name, g.Description, g.ID)
+	err := row.Scan(&g.Created, &g.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrVehicleGroupNotFound
+	}
+	return err
+}
+
+// DeleteVehicleGroup deletes a VehicleGroup. Its Vehicles no longer belong to a group.
+func (gs *VehicleGroupService) DeleteVehicleGroup(id int64) error {
+	result, err := gs.db.Exec("DELETE FROM vehicle_groups WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrVehicleGroupNotFound
+	}
+	return nil
+}
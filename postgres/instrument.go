@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/metrics"
+	"github.com/wtg/shuttletracker/tracing"
+)
+
+var tracer = tracing.Tracer("postgres")
+
+// instrumentedConnector creates connections that time every query and log
+// those that take longer than slow. Zero disables logging slow queries.
+type instrumentedConnector struct {
+	driver.Connector
+	slow time.Duration
+}
+
+func (ic instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := ic.Connector.Connect(ctx)
+	if err != nil {
+		// don't wait for the next health check to degrade
+		health.Report(health.Database, err)
+		return nil, err
+	}
+	return instrumentedConn{conn, ic.slow}, nil
+}
+
+// instrumentedConn times queries made directly on a connection, which is how
+// database/sql runs every query with arguments when the driver supports it.
+type instrumentedConn struct {
+	driver.Conn
+	slow time.Duration
+}
+
+func (ic instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := ic.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return ic.Conn.Begin() // nolint: staticcheck
+}
+
+func (ic instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := ic.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, done := ic.startQuery(ctx, query, args)
+	rows, err := q.QueryContext(ctx, query, args)
+	done(err)
+	return rows, err
+}
+
+func (ic instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := ic.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, done := ic.startQuery(ctx, query, args)
+	res, err := e.ExecContext(ctx, query, args)
+	done(err)
+	return res, err
+}
+
+// startQuery starts a span for a query if it's part of a trace, like those
+// made by the model services' Context methods. Tracing the rest would only
+// make a root trace for every query. The returned function ends the
+// span, records how long the query took, and logs the query if it was slow.
+func (ic instrumentedConn) startQuery(ctx context.Context, query string, args []driver.NamedValue) (context.Context, func(error)) {
+	name := queryName(query)
+	start := time.Now()
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		ctx, span = tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBStatementKey.String(query)))
+	}
+	return ctx, func(err error) {
+		elapsed := time.Since(start)
+		statement := statementID(query)
+		metrics.DBQueryDuration.WithLabelValues(name, statement).Observe(elapsed.Seconds())
+		if ic.slow > 0 && elapsed >= ic.slow {
+			log.WithField("query", name).
+				WithField("statement", statement).
+				WithField("sql", normalizeQuery(query)).
+				WithField("args", redactArgs(args)).
+				WithField("duration", elapsed.Seconds()).
+				Warn("slow query")
+		}
+		if !span.SpanContext().IsValid() {
+			return
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// normalizeQuery collapses whitespace so that a query fits on one line.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// statementID identifies a query's text, so that queries on the same table
+// can be told apart in metrics without using the whole query as a label.
+func statementID(query string) string {
+	sum := sha1.Sum([]byte(normalizeQuery(query)))
+	return hex.EncodeToString(sum[:4])
+}
+
+// redactArgs describes query arguments without revealing strings, which may
+// contain names or messages. Numbers, booleans, and times are kept since
+// they're usually IDs and time ranges that help explain a slow query.
+func redactArgs(args []driver.NamedValue) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.Value.(type) {
+		case nil:
+			redacted[i] = "NULL"
+		case string:
+			redacted[i] = fmt.Sprintf("<%d-byte string>", len(v))
+		case []byte:
+			redacted[i] = fmt.Sprintf("<%d bytes>", len(v))
+		case time.Time:
+			redacted[i] = v.Format(time.RFC3339Nano)
+		default:
+			redacted[i] = fmt.Sprint(v)
+		}
+	}
+	return redacted
+}
+
+// queryName summarizes a query as its statement type and the table it
+// operates on, e.g. "select locations", so that it can be used as a metric label.
+func queryName(query string) string {
+	verb, table := "", false
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		word = strings.Trim(word, "(),;")
+		switch {
+		case verb == "":
+			switch word {
+			case "select", "insert", "update", "delete", "create", "drop", "alter":
+				verb = word
+				table = word == "update"
+			}
+		case word == "from" || word == "into" || word == "table":
+			table = true
+		case table && word != "" && word != "if" && word != "not" && word != "exists":
+			return verb + " " + word
+		}
+	}
+	if verb == "" {
+		return "other"
+	}
+	return verb
+}
@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT l.id, l.tracker_id FROM locations l, vehicles v WHERE l.tracker_id = v.tracker_id;", "select locations"},
+		{"WITH location AS (\n\tINSERT INTO locations (\n\t\ttracker_id) VALUES ($1)\n\tRETURNING id)\nSELECT 1;", "insert locations"},
+		{"UPDATE vehicles SET name = $1 WHERE id = $2;", "update vehicles"},
+		{"DELETE FROM locations WHERE time < $1;", "delete locations"},
+		{"CREATE TABLE IF NOT EXISTS stops (id serial PRIMARY KEY);", "create stops"},
+		{"SELECT pg_notify($1, $2);", "select"},
+		{"BEGIN;", "other"},
+	}
+	for _, test := range tests {
+		if name := queryName(test.query); name != test.expected {
+			t.Errorf("queryName(%q) = %q, expected %q", test.query, name, test.expected)
+		}
+	}
+}
+
+func TestStatementID(t *testing.T) {
+	a := statementID("SELECT id FROM stops\n\tWHERE id = $1;")
+	b := statementID("SELECT id FROM stops WHERE id = $1;")
+	c := statementID("SELECT id FROM stops WHERE name = $1;")
+	if a != b {
+		t.Errorf("expected whitespace not to change statement ID, got %s and %s", a, b)
+	}
+	if a == c {
+		t.Errorf("expected different statements to have different IDs")
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: int64(4)},
+		{Ordinal: 2, Value: "jane doe"},
+		{Ordinal: 3, Value: []byte{1, 2, 3}},
+		{Ordinal: 4, Value: time.Date(2018, time.April, 16, 5, 29, 57, 0, time.UTC)},
+		{Ordinal: 5, Value: nil},
+		{Ordinal: 6, Value: true},
+	}
+	expected := []string{"4", "<8-byte string>", "<3 bytes>", "2018-04-16T05:29:57Z", "NULL", "true"}
+	if redacted := redactArgs(args); !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("got %v, expected %v", redacted, expected)
+	}
+}
+
+var (
+	recordSpansOnce sync.Once
+	spanRecorder    *tracetest.SpanRecorder
+	spanProvider    *sdktrace.TracerProvider
+)
+
+// recordSpans records the spans of every test. tracer only follows the first
+// global tracer provider that's set, so it's set once and never reset, and
+// tests look at the spans that ended after they started.
+func recordSpans() (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	recordSpansOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		spanProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+		otel.SetTracerProvider(spanProvider)
+	})
+	return spanRecorder, spanProvider
+}
+
+func TestStartQueryOnlyInTraces(t *testing.T) {
+	sr, provider := recordSpans()
+	before := len(sr.Ended())
+
+	ic := instrumentedConn{}
+	_, done := ic.startQuery(context.Background(), "SELECT 1;", nil)
+	done(nil)
+	if spans := sr.Ended()[before:]; len(spans) != 0 {
+		t.Errorf("got %d spans, expected none for a query outside a trace", len(spans))
+	}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	_, done = ic.startQuery(ctx, "SELECT id FROM vehicles;", nil)
+	done(nil)
+	parent.End()
+	spans := sr.Ended()[before:]
+	if len(spans) != 2 || spans[0].Name() != "select vehicles" || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("got %v, expected a query span under the request", spans)
+	}
+}
+
+// emptyConnector connects to a database whose queries all return no rows.
+type emptyConnector struct{}
+
+func (emptyConnector) Connect(context.Context) (driver.Conn, error) { return emptyConn{}, nil }
+func (emptyConnector) Driver() driver.Driver                        { return nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (emptyConn) Close() error                        { return nil }
+func (emptyConn) Begin() (driver.Tx, error)           { return emptyConn{}, nil }
+func (emptyConn) Commit() error                       { return nil }
+func (emptyConn) Rollback() error                     { return nil }
+
+func (emptyConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func TestContextQueriesAreTraced(t *testing.T) {
+	sr, provider := recordSpans()
+	before := len(sr.Ended())
+
+	db := sql.OpenDB(instrumentedConnector{Connector: emptyConnector{}})
+	defer db.Close()
+	vs := &VehicleService{db: db}
+	ls := &LocationService{db: db, cache: newLatestLocationCache()}
+	rs := &RouteService{db: db}
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "GET /updates/")
+	if _, err := vs.EnabledVehiclesContext(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := ls.LatestLocationsContext(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := ls.LocationsSinceContext(ctx, 1, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := rs.RoutesContext(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	request.End()
+
+	names := map[string]bool{}
+	for _, span := range sr.Ended()[before:] {
+		if span.Name() == "GET /updates/" {
+			continue
+		}
+		if span.Parent().SpanID() != request.SpanContext().SpanID() {
+			t.Errorf("%s span isn't under the request", span.Name())
+		}
+		names[span.Name()] = true
+	}
+	for _, name := range []string{"select vehicles", "select locations", "select routes", "select route_schedules"} {
+		if !names[name] {
+			t.Errorf("no %s span, got %v", name, names)
+		}
+	}
+}
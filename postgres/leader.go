@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// leaderLockID identifies the advisory lock held by the leader.
+const leaderLockID = 7368757474
+
+// leaderLockHeld tells whether this session still holds the leader lock. A
+// bigint advisory lock's key is split between classid and objid.
+const leaderLockHeld = "SELECT EXISTS (SELECT 1 FROM pg_locks WHERE locktype = 'advisory'" +
+	" AND pid = pg_backend_pid() AND granted AND objsubid = 1" +
+	" AND (classid::bigint << 32 | objid::bigint) = $1);"
+
+// leaderCheckInterval is how often leadership is re-checked.
+const leaderCheckInterval = time.Second * 5
+
+// LeaderService implements shuttletracker.LeaderService with a Postgres advisory
+// lock. The instance holding the lock is the leader. Advisory locks belong to a
+// database session, so if the leader dies its connection closes and another
+// instance takes over.
+type LeaderService struct {
+	db *sql.DB
+
+	mutex   sync.Mutex
+	conn    *sql.Conn
+	leader  bool
+	checked time.Time
+
+	// resigned is set while shutting down so that this instance doesn't
+	// become the leader again.
+	resigned bool
+}
+
+// Leader reports whether this instance holds the leader lock.
+func (ls *LeaderService) Leader() bool {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	if ls.resigned {
+		return false
+	}
+	if time.Since(ls.checked) < leaderCheckInterval {
+		return ls.leader
+	}
+	ls.checked = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var err error
+	if ls.conn == nil {
+		ls.conn, err = ls.db.Conn(ctx)
+		if err != nil {
+			log.WithError(err).Error("unable to get leader connection")
+			ls.leader = false
+			return false
+		}
+	}
+
+	if ls.leader {
+		// The lock lasts as long as the session does, which may have ended
+		// without the connection noticing yet.
+		err = ls.conn.QueryRowContext(ctx, leaderLockHeld, leaderLockID).Scan(&ls.leader)
+		if err == nil && !ls.leader {
+			log.Warn("This instance is no longer the leader.")
+		}
+	} else {
+		err = ls.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1);", leaderLockID).Scan(&ls.leader)
+		if err == nil && ls.leader {
+			log.Info("This instance is now the leader.")
+		}
+	}
+	if err != nil {
+		log.WithError(err).Error("unable to check leader lock")
+		ls.conn.Close()
+		ls.conn = nil
+		ls.leader = false
+	}
+	return ls.leader
+}
+
+// resign releases the leader lock, if it's held, so that another instance can
+// take over without waiting for this one's connection to time out.
+func (ls *LeaderService) resign() {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	ls.resigned = true
+	if ls.conn == nil {
+		return
+	}
+	if ls.leader {
+		log.Info("This instance is no longer the leader.")
+	}
+	ls.conn.Close()
+	ls.conn = nil
+	ls.leader = false
+}
@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaderLostWithSession(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	if !pg.Leader() {
+		t.Fatal("only instance isn't the leader")
+	}
+
+	// end the leader's session from another one
+	statement := "SELECT pg_terminate_backend(pid) FROM pg_locks WHERE locktype = 'advisory'" +
+		" AND objsubid = 1 AND (classid::bigint << 32 | objid::bigint) = $1;"
+	if _, err := pg.LeaderService.db.Exec(statement, leaderLockID); err != nil {
+		t.Fatalf("unable to terminate leader session: %s", err)
+	}
+
+	pg.LeaderService.checked = time.Time{}
+	if pg.Leader() {
+		t.Error("still the leader after its session ended")
+	}
+}
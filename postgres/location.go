@@ -1,7 +1,9 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"strconv"
 	"time"
 
@@ -11,7 +13,10 @@ import (
 	"github.com/wtg/shuttletracker/log"
 )
 
-const locationsInsertChannel = "locations.insert"
+const (
+	locationsInsertChannel  = "locations.insert"
+	locationsPublishChannel = "locations.publish"
+)
 
 // LocationService implements shuttletracker.LocationService.
 type LocationService struct {
@@ -19,6 +24,7 @@ type LocationService struct {
 	listener    *pq.Listener
 	addSub      chan chan *shuttletracker.Location
 	subscribers []chan *shuttletracker.Location
+	cache       *latestLocationCache
 }
 
 func (ls *LocationService) initializeSchema(db *sql.DB, listener *pq.Listener) error {
@@ -39,6 +45,20 @@ CREATE TABLE IF NOT EXISTS locations (
 	UNIQUE (tracker_id, time)
 );
 
+-- locations belong to the vehicle that their tracker was installed in when
+-- they were reported. Before they were stored this way, they belonged to
+-- whichever vehicle currently had their tracker.
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'locations' AND column_name = 'vehicle_id') THEN
+		ALTER TABLE locations ADD COLUMN vehicle_id integer REFERENCES vehicles ON DELETE SET NULL;
+		UPDATE locations l SET vehicle_id = v.id FROM vehicles v WHERE v.tracker_id = l.tracker_id;
+	END IF;
+END
+$$;
+CREATE INDEX IF NOT EXISTS locations_vehicle_id_created_idx ON locations (vehicle_id, created);
+
 -- notify clients when locations inserted
 CREATE OR REPLACE FUNCTION locations_insert_notify() RETURNS trigger AS $$
 BEGIN
@@ -53,36 +73,31 @@ CREATE TRIGGER locations_insert AFTER INSERT ON locations FOR EACH ROW EXECUTE P
 	return err
 }
 
-func (ls *LocationService) run() {
+// run receives notifications about inserted Locations from Postgres.run.
+func (ls *LocationService) run(notifications <-chan *pq.Notification) {
 	err := ls.listener.Listen(locationsInsertChannel)
 	if err != nil {
 		log.WithError(err).Error("unable to listen for inserted locations")
 		return
 	}
+	err = ls.listener.Listen(locationsPublishChannel)
+	if err != nil {
+		log.WithError(err).Error("unable to listen for published locations")
+		return
+	}
 
 	for {
 		select {
 		case c := <-ls.addSub:
 			ls.subscribers = append(ls.subscribers, c)
-		case n := <-ls.listener.Notify:
-			if n == nil {
-				break
-			}
-			if n.Channel != locationsInsertChannel {
-				continue
-			}
-
-			id, err := strconv.ParseInt(n.Extra, 10, 64)
-			if err != nil {
-				log.WithError(err).Error("unable to parse location ID")
-				continue
-			}
-
-			loc, err := ls.Location(id)
+		case n := <-notifications:
+			loc, err := ls.notificationLocation(n)
 			if err != nil {
 				log.WithError(err).Error("unable to get location")
 				continue
 			}
+			// Locations may have been inserted by another process.
+			ls.cache.put(loc)
 			for _, sub := range ls.subscribers {
 				sub <- loc
 			}
@@ -90,8 +105,23 @@ func (ls *LocationService) run() {
 	}
 }
 
+// notificationLocation returns the Location that was inserted or published.
+func (ls *LocationService) notificationLocation(n *pq.Notification) (*shuttletracker.Location, error) {
+	if n.Channel == locationsPublishChannel {
+		loc := &shuttletracker.Location{}
+		err := json.Unmarshal([]byte(n.Extra), loc)
+		return loc, err
+	}
+
+	id, err := strconv.ParseInt(n.Extra, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return ls.Location(id)
+}
+
 // SubscribeLocations returns a chan that receives each new Location after it is
-// written to the database.
+// written to the database or published.
 func (ls *LocationService) SubscribeLocations() chan *shuttletracker.Location {
 	c := make(chan *shuttletracker.Location)
 	ls.addSub <- c
@@ -101,25 +131,37 @@ func (ls *LocationService) SubscribeLocations() chan *shuttletracker.Location {
 // CreateLocation creates a Location in the database.
 func (ls *LocationService) CreateLocation(l *shuttletracker.Location) error {
 	query := `
-WITH location AS (
-	INSERT INTO locations (
-		tracker_id,
-		latitude,
-		longitude,
-		heading,
-		speed,
-		time,
-		route_id
-	) VALUES ($1, $2, $3, $4, $5, $6, $7)
-	RETURNING id, tracker_id, created)
-SELECT
-	location.id AS location_id,
-	vehicles.id AS vehicle_id,
-	location.created
-FROM location
-LEFT JOIN vehicles ON vehicles.tracker_id = location.tracker_id;`
+INSERT INTO locations (
+	tracker_id,
+	latitude,
+	longitude,
+	heading,
+	speed,
+	time,
+	route_id,
+	vehicle_id
+) VALUES ($1, $2, $3, $4, $5, $6, $7, tracker_vehicle($1, $6))
+RETURNING id, vehicle_id, created;`
 	row := ls.db.QueryRow(query, l.TrackerID, l.Latitude, l.Longitude, l.Heading, l.Speed, l.Time, l.RouteID)
 	err := row.Scan(&l.ID, &l.VehicleID, &l.Created)
+	if err != nil {
+		return err
+	}
+	ls.cache.put(l)
+	return nil
+}
+
+// PublishLocation sends a Location to subscribers in every instance without
+// writing it to the database. It is still served as the Vehicle's latest Location.
+func (ls *LocationService) PublishLocation(l *shuttletracker.Location) error {
+	if l.Created.IsZero() {
+		l.Created = time.Now()
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = ls.db.Exec("SELECT pg_notify($1, $2);", locationsPublishChannel, string(b))
 	return err
 }
 
@@ -130,6 +172,7 @@ func (ls *LocationService) DeleteLocationsBefore(before time.Time) (int, error)
 	if err != nil {
 		return 0, err
 	}
+	ls.cache.invalidate()
 	n, err := res.RowsAffected()
 	if err != nil {
 		return 0, err
@@ -139,10 +182,15 @@ func (ls *LocationService) DeleteLocationsBefore(before time.Time) (int, error)
 
 // LocationsSince returns all Locations since a tracker Time for a certain Vehicle, ordered newest to oldest.
 func (ls *LocationService) LocationsSince(vehicleID int64, since time.Time) ([]*shuttletracker.Location, error) {
+	return ls.LocationsSinceContext(context.Background(), vehicleID, since)
+}
+
+// LocationsSinceContext is LocationsSince as part of ctx's trace.
+func (ls *LocationService) LocationsSinceContext(ctx context.Context, vehicleID int64, since time.Time) ([]*shuttletracker.Location, error) {
 	locations := []*shuttletracker.Location{}
 	query := "SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created " +
-		"FROM locations l, vehicles v WHERE l.tracker_id = v.tracker_id AND v.id = $1 AND l.time > $2 ORDER BY l.created DESC;"
-	rows, err := ls.db.Query(query, vehicleID, since)
+		"FROM locations l WHERE l.vehicle_id = $1 AND l.time > $2 ORDER BY l.created DESC;"
+	rows, err := ls.db.QueryContext(ctx, query, vehicleID, since)
 	if err != nil {
 		return nil, err
 	}
@@ -160,13 +208,19 @@ func (ls *LocationService) LocationsSince(vehicleID int64, since time.Time) ([]*
 }
 
 // LatestLocation returns the most recent Location created for a Vehicle.
+// It is served from memory when possible.
 func (ls *LocationService) LatestLocation(vehicleID int64) (*shuttletracker.Location, error) {
+	if l, loaded := ls.cache.get(vehicleID); l != nil {
+		return l, nil
+	} else if loaded {
+		return nil, shuttletracker.ErrLocationNotFound
+	}
+
 	l := &shuttletracker.Location{
 		VehicleID: &vehicleID,
 	}
 	query := "SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created " +
-		"FROM locations l, vehicles v WHERE l.tracker_id = v.tracker_id AND v.id = $1 " +
-		"ORDER BY l.created DESC LIMIT 1;"
+		"FROM locations l WHERE l.vehicle_id = $1 ORDER BY l.created DESC LIMIT 1;"
 	row := ls.db.QueryRow(query, vehicleID)
 	err := row.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created)
 	if err == sql.ErrNoRows {
@@ -174,23 +228,31 @@ func (ls *LocationService) LatestLocation(vehicleID int64) (*shuttletracker.Loca
 	} else if err != nil {
 		return nil, err
 	}
+	ls.cache.put(l)
 	return l, nil
 }
 
 // LatestLocations returns the most recent Location created for all enabled Vehicles.
+// It is served from memory when possible.
 func (ls *LocationService) LatestLocations() ([]*shuttletracker.Location, error) {
+	return ls.LatestLocationsContext(context.Background())
+}
+
+// LatestLocationsContext is LatestLocations as part of ctx's trace.
+func (ls *LocationService) LatestLocationsContext(ctx context.Context) ([]*shuttletracker.Location, error) {
+	if locations, ok := ls.cache.all(); ok {
+		return locations, nil
+	}
+
 	locations := []*shuttletracker.Location{}
 	query := `
-SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, v.id
-FROM vehicles v,
-        locations l JOIN (
-                SELECT tracker_id, max(created) AS created
-                from locations
-                group by tracker_id) AS l2
-        ON l.tracker_id = l2.tracker_id AND l.created = l2.created
-WHERE v.tracker_id = l.tracker_id;
+SELECT DISTINCT ON (l.vehicle_id)
+        l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, l.vehicle_id
+FROM locations l JOIN vehicles v ON v.id = l.vehicle_id
+WHERE v.enabled
+ORDER BY l.vehicle_id, l.created DESC;
 	`
-	rows, err := ls.db.Query(query)
+	rows, err := ls.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -202,6 +264,10 @@ WHERE v.tracker_id = l.tracker_id;
 		}
 		locations = append(locations, l)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	ls.cache.load(locations)
 	return locations, nil
 }
 
@@ -210,8 +276,8 @@ func (ls *LocationService) Location(id int64) (*shuttletracker.Location, error)
 	l := &shuttletracker.Location{
 		ID: id,
 	}
-	query := "SELECT l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, v.id " +
-		"FROM locations l, vehicles v WHERE l.tracker_id = v.tracker_id AND l.id = $1;"
+	query := "SELECT l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, l.vehicle_id " +
+		"FROM locations l WHERE l.vehicle_id IS NOT NULL AND l.id = $1;"
 	row := ls.db.QueryRow(query, id)
 	err := row.Scan(&l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.VehicleID)
 	if err == sql.ErrNoRows {
@@ -221,3 +287,31 @@ func (ls *LocationService) Location(id int64) (*shuttletracker.Location, error)
 	}
 	return l, nil
 }
+
+// ExportLocations calls fn with each Location matching the filter, ordered oldest to newest.
+// Locations aren't associated with Stops, so the filter's StopID is ignored.
+func (ls *LocationService) ExportLocations(filter shuttletracker.HistoryFilter, fn func(*shuttletracker.Location) error) error {
+	query := "SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, l.vehicle_id " +
+		"FROM locations l " +
+		"WHERE l.time >= $1 AND l.time < $2 " +
+		"AND ($3::integer IS NULL OR l.vehicle_id = $3) " +
+		"AND ($4::integer IS NULL OR l.route_id = $4) " +
+		"AND ($5::integer IS NULL OR l.vehicle_id IN (SELECT id FROM vehicles WHERE group_id = $5)) " +
+		"ORDER BY l.time;"
+	rows, err := ls.db.Query(query, filter.Since, filter.Until, filter.VehicleID, filter.RouteID, filter.GroupID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		l := &shuttletracker.Location{}
+		err := rows.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.VehicleID)
+		if err != nil {
+			return err
+		}
+		if err = fn(l); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
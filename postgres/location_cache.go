@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"sync"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// latestLocationCache holds the most recent Location for each Vehicle so that
+// clients polling for positions don't cause database queries. It is updated
+// whenever a Location is inserted and cleared when Vehicles or Locations are
+// modified in ways that could make it wrong.
+type latestLocationCache struct {
+	mutex     sync.RWMutex
+	locations map[int64]*shuttletracker.Location
+
+	// loaded is true once locations contains every Vehicle that has a Location.
+	loaded bool
+}
+
+func newLatestLocationCache() *latestLocationCache {
+	return &latestLocationCache{
+		locations: map[int64]*shuttletracker.Location{},
+	}
+}
+
+// get returns a copy of a Vehicle's latest Location. If the Vehicle isn't in
+// the cache, found reports whether that's because it has no Locations.
+func (c *latestLocationCache) get(vehicleID int64) (loc *shuttletracker.Location, found bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if l, ok := c.locations[vehicleID]; ok {
+		return copyLocation(l), true
+	}
+	return nil, c.loaded
+}
+
+// all returns copies of every Vehicle's latest Location, or false if the cache
+// hasn't been loaded.
+func (c *latestLocationCache) all() ([]*shuttletracker.Location, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if !c.loaded {
+		return nil, false
+	}
+	locations := make([]*shuttletracker.Location, 0, len(c.locations))
+	for _, l := range c.locations {
+		locations = append(locations, copyLocation(l))
+	}
+	return locations, true
+}
+
+// load replaces the cache's contents with every Vehicle's latest Location.
+func (c *latestLocationCache) load(locations []*shuttletracker.Location) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.locations = map[int64]*shuttletracker.Location{}
+	for _, l := range locations {
+		if l.VehicleID != nil {
+			c.locations[*l.VehicleID] = copyLocation(l)
+		}
+	}
+	c.loaded = true
+}
+
+// put stores a Location if it is newer than the one already cached for its Vehicle.
+func (c *latestLocationCache) put(l *shuttletracker.Location) {
+	if l.VehicleID == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if existing, ok := c.locations[*l.VehicleID]; ok && existing.Created.After(l.Created) {
+		return
+	}
+	c.locations[*l.VehicleID] = copyLocation(l)
+}
+
+// invalidate empties the cache.
+func (c *latestLocationCache) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.locations = map[int64]*shuttletracker.Location{}
+	c.loaded = false
+}
+
+// copyLocation prevents callers from modifying cached Locations.
+func copyLocation(l *shuttletracker.Location) *shuttletracker.Location {
+	c := *l
+	if l.VehicleID != nil {
+		vehicleID := *l.VehicleID
+		c.VehicleID = &vehicleID
+	}
+	if l.RouteID != nil {
+		routeID := *l.RouteID
+		c.RouteID = &routeID
+	}
+	return &c
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestLatestLocationCache(t *testing.T) {
+	c := newLatestLocationCache()
+	vehicleID := int64(1)
+	now := time.Now()
+
+	if _, ok := c.all(); ok {
+		t.Error("expected empty cache to not be loaded")
+	}
+	if l, loaded := c.get(vehicleID); l != nil || loaded {
+		t.Errorf("got %+v, %t from empty cache", l, loaded)
+	}
+
+	c.load([]*shuttletracker.Location{{ID: 1, VehicleID: &vehicleID, Created: now}})
+	locations, ok := c.all()
+	if !ok || len(locations) != 1 || locations[0].ID != 1 {
+		t.Fatalf("unexpected locations after load: %+v", locations)
+	}
+	if l, loaded := c.get(2); l != nil || !loaded {
+		t.Errorf("expected loaded cache to report missing vehicle, got %+v, %t", l, loaded)
+	}
+
+	// older Locations shouldn't replace newer ones
+	c.put(&shuttletracker.Location{ID: 2, VehicleID: &vehicleID, Created: now.Add(-time.Minute)})
+	if l, _ := c.get(vehicleID); l.ID != 1 {
+		t.Errorf("expected location 1, got %d", l.ID)
+	}
+	c.put(&shuttletracker.Location{ID: 3, VehicleID: &vehicleID, Created: now.Add(time.Minute)})
+	if l, _ := c.get(vehicleID); l.ID != 3 {
+		t.Errorf("expected location 3, got %d", l.ID)
+	}
+
+	// callers shouldn't be able to modify cached Locations
+	l, _ := c.get(vehicleID)
+	*l.VehicleID = 5
+	if l, _ := c.get(vehicleID); *l.VehicleID != vehicleID {
+		t.Errorf("cached location was modified")
+	}
+
+	c.invalidate()
+	if _, ok := c.all(); ok {
+		t.Error("expected invalidated cache to not be loaded")
+	}
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// MaintenanceService implements shuttletracker.MaintenanceService.
+type MaintenanceService struct {
+	db *sql.DB
+}
+
+func (ms *MaintenanceService) initializeSchema(db *sql.DB) error {
+	ms.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS maintenance_records (
+	id serial PRIMARY KEY,
+	vehicle_id integer REFERENCES vehicles ON DELETE CASCADE NOT NULL,
+	date date NOT NULL,
+	type text NOT NULL,
+	notes text NOT NULL DEFAULT '',
+	out_of_service_start timestamp with time zone,
+	out_of_service_end timestamp with time zone,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now(),
+	CHECK (out_of_service_end IS NULL OR out_of_service_start < out_of_service_end)
+);
+CREATE INDEX IF NOT EXISTS maintenance_records_vehicle_id_date_idx ON maintenance_records (vehicle_id, date);
+`
+	_, err := ms.db.Exec(schema)
+	return err
+}
+
+const maintenanceColumns = "id, vehicle_id, date::text, type, notes, out_of_service_start, out_of_service_end, created, updated"
+
+func scanMaintenanceRecord(row interface{ Scan(...interface{}) error }) (*shuttletracker.MaintenanceRecord, error) {
+	m := &shuttletracker.MaintenanceRecord{}
+	err := row.Scan(&m.ID, &m.VehicleID, &m.Date, &m.Type, &m.Notes, &m.OutOfServiceStart, &m.OutOfServiceEnd,
+		&m.Created, &m.Updated)
+	return m, err
+}
+
+func (ms *MaintenanceService) queryMaintenanceRecords(query string, args ...interface{}) ([]*shuttletracker.MaintenanceRecord, error) {
+	rows, err := ms.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []*shuttletracker.MaintenanceRecord{}
+	for rows.Next() {
+		m, err := scanMaintenanceRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, m)
+	}
+	return records, rows.Err()
+}
+
+// MaintenanceRecord returns the MaintenanceRecord with the provided ID.
+func (ms *MaintenanceService) MaintenanceRecord(id int64) (*shuttletracker.MaintenanceRecord, error) {
+	row := ms.db.QueryRow("SELECT "+maintenanceColumns+" FROM maintenance_records WHERE id = $1;", id)
+	m, err := scanMaintenanceRecord(row)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrMaintenanceRecordNotFound
+	}
+	return m, err
+}
+
+// MaintenanceRecords returns a Vehicle's MaintenanceRecords, or all of them
+// if vehicleID is nil, most recent first.
+func (ms *MaintenanceService) MaintenanceRecords(vehicleID *int64) ([]*shuttletracker.MaintenanceRecord, error) {
+	query := "SELECT " + maintenanceColumns + " FROM maintenance_records" +
+		" WHERE $1::integer IS NULL OR vehicle_id = $1" +
+		" ORDER BY date DESC, id DESC;"
+	return ms.queryMaintenanceRecords(query, vehicleID)
+}
+
+// OutOfService returns the MaintenanceRecords whose out-of-service windows include t.
+func (ms *MaintenanceService) OutOfService(t time.Time) ([]*shuttletracker.MaintenanceRecord, error) {
+	query := "SELECT " + maintenanceColumns + " FROM maintenance_records" +
+		" WHERE out_of_service_start <= $1 AND (out_of_service_end IS NULL OR out_of_service_end > $1)" +
+		" ORDER BY vehicle_id, out_of_service_start;"
+	return ms.queryMaintenanceRecords(query, t)
+}
+
+// CreateMaintenanceRecord creates a MaintenanceRecord.
+func (ms *MaintenanceService) CreateMaintenanceRecord(m *shuttletracker.MaintenanceRecord) error {
+	statement := "INSERT INTO maintenance_records (vehicle_id, date, type, notes, out_of_service_start, out_of_service_end)" +
+		" VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created, updated;"
+	row := ms.db.QueryRow(statement, m.VehicleID, m.Date, m.Type, m.Notes, m.OutOfServiceStart, m.OutOfServiceEnd)
+	return row.Scan(&m.ID, &m.Created, &m.Updated)
+}
+
+// ModifyMaintenanceRecord updates a MaintenanceRecord.
+func (ms *MaintenanceService) ModifyMaintenanceRecord(m *shuttletracker.MaintenanceRecord) error {
+	statement := "UPDATE maintenance_records SET vehicle_id = $1, date = $2, type = $3, notes = $4," +
+		" out_of_service_start = $5, out_of_service_end = $6, updated = now()" +
+		" WHERE id = $7 RETURNING created, updated;"
+	row := ms.db.QueryRow(statement, m.VehicleID, m.Date, m.Type, m.Notes, m.OutOfServiceStart, m.OutOfServiceEnd, m.ID)
+	err := row.Scan(&m.Created, &m.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrMaintenanceRecordNotFound
+	}
+	return err
+}
+
+// DeleteMaintenanceRecord deletes a MaintenanceRecord.
+func (ms *MaintenanceService) DeleteMaintenanceRecord(id int64) error {
+	result, err := ms.db.Exec("DELETE FROM maintenance_records WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrMaintenanceRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestMaintenanceRecords(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	vehicle := &shuttletracker.Vehicle{Name: "Test Vehicle", TrackerID: "1"}
+	if err := pg.CreateVehicle(vehicle); err != nil {
+		t.Fatalf("unable to create Vehicle: %s", err)
+	}
+	start := time.Date(2019, time.March, 4, 8, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	inspection := &shuttletracker.MaintenanceRecord{VehicleID: vehicle.ID, Date: "2019-02-01", Type: "inspection"}
+	brakes := &shuttletracker.MaintenanceRecord{VehicleID: vehicle.ID, Date: "2019-03-04", Type: "brakes",
+		OutOfServiceStart: &start, OutOfServiceEnd: &end}
+	for _, m := range []*shuttletracker.MaintenanceRecord{inspection, brakes} {
+		if err := pg.CreateMaintenanceRecord(m); err != nil {
+			t.Fatalf("unable to create MaintenanceRecord: %s", err)
+		}
+	}
+
+	records, err := pg.MaintenanceRecords(&vehicle.ID)
+	if err != nil {
+		t.Fatalf("unable to get MaintenanceRecords: %s", err)
+	}
+	if len(records) != 2 || records[0].ID != brakes.ID || records[1].Date != "2019-02-01" {
+		t.Errorf("got %+v, expected the brakes and then the inspection", records)
+	}
+
+	for at, expected := range map[time.Time]int{start.Add(-time.Second): 0, start: 1, end: 0} {
+		records, err := pg.OutOfService(at)
+		if err != nil {
+			t.Fatalf("unable to get MaintenanceRecords: %s", err)
+		}
+		if len(records) != expected {
+			t.Errorf("at %s: got %d records, expected %d", at, len(records), expected)
+		}
+	}
+
+	if err := pg.DeleteMaintenanceRecord(brakes.ID); err != nil {
+		t.Errorf("unable to delete MaintenanceRecord: %s", err)
+	}
+	if _, err := pg.MaintenanceRecord(brakes.ID); err != shuttletracker.ErrMaintenanceRecordNotFound {
+		t.Errorf("got error %v, expected ErrMaintenanceRecordNotFound", err)
+	}
+}
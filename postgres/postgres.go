@@ -2,38 +2,80 @@ package postgres
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 	"github.com/spf13/viper"
+
+	"github.com/wtg/shuttletracker/health"
+	"github.com/wtg/shuttletracker/log"
 )
 
+const vehiclesChangeChannel = "vehicles.change"
+
+// healthCheckInterval is how often the database is pinged to report its health.
+const healthCheckInterval = 10 * time.Second
+
 /*
-Postgres implements shuttletracker.VehicleService, shuttletracker.RouteService,
-shuttletracker.StopService, shuttletracker.LoctionService, shuttletracker.MessageService,
-and shuttletracker.UserService.
+Postgres implements shuttletracker.VehicleService, shuttletracker.VehicleGroupService,
+shuttletracker.TrackerDeviceService, shuttletracker.RouteService, shuttletracker.DetourService,
+shuttletracker.StopService, shuttletracker.ScheduleService, shuttletracker.CalendarService,
+shuttletracker.DraftService, shuttletracker.LoctionService, shuttletracker.ArrivalService,
+shuttletracker.DeviationService, shuttletracker.ETARecordService, shuttletracker.ShiftService,
+shuttletracker.MaintenanceService, shuttletracker.MessageService, shuttletracker.UserService,
+shuttletracker.UsageService, shuttletracker.AnalyticsService, shuttletracker.FavoriteService,
+shuttletracker.WidgetKeyService, shuttletracker.LeaderService, and shuttletracker.BroadcastService.
 */
 type Postgres struct {
 	VehicleService
+	VehicleGroupService
+	TrackerDeviceService
 	RouteService
+	DetourService
 	StopService
+	ScheduleService
+	CalendarService
+	DraftService
 	LocationService
+	ArrivalService
+	DeviationService
+	ETARecordService
+	ShiftService
+	MaintenanceService
 	MessageService
 	UserService
 	FeedbackService
+	UsageService
+	AnalyticsService
+	FavoriteService
+	WidgetKeyService
+	LeaderService
+	BroadcastService
+
+	db       *sql.DB
+	listener *pq.Listener
 }
 
 // Config contains database connection information.
 type Config struct {
 	URL string
+
+	// SlowQueryThreshold is how long a query can take before it's logged.
+	SlowQueryThreshold string
 }
 
 // New returns a configured Postgres.
 func New(cfg Config) (*Postgres, error) {
-	db, err := sql.Open("postgres", cfg.URL)
+	connector, err := pq.NewConnector(cfg.URL)
 	if err != nil {
 		return nil, err
 	}
+	slow, err := time.ParseDuration(cfg.SlowQueryThreshold)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(instrumentedConnector{connector, slow})
 
 	err = db.Ping()
 	if err != nil {
@@ -42,12 +84,28 @@ func New(cfg Config) (*Postgres, error) {
 
 	listener := pq.NewListener(cfg.URL, time.Second, time.Minute, nil)
 
-	pg := &Postgres{}
+	pg := &Postgres{db: db, listener: listener}
+	pg.LeaderService.db = db
+	pg.BroadcastService.initialize(db, listener)
+
+	// Clients poll for the latest Locations constantly, so keep them in memory.
+	cache := newLatestLocationCache()
+	pg.VehicleService.locationCache = cache
+	pg.TrackerDeviceService.locationCache = cache
+	pg.LocationService.cache = cache
 
+	err = pg.VehicleGroupService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
 	err = pg.VehicleService.initializeSchema(db)
 	if err != nil {
 		return nil, err
 	}
+	err = pg.TrackerDeviceService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
 	err = pg.StopService.initializeSchema(db)
 	if err != nil {
 		return nil, err
@@ -56,10 +114,46 @@ func New(cfg Config) (*Postgres, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = pg.DetourService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.ScheduleService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.CalendarService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.DraftService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
 	err = pg.LocationService.initializeSchema(db, listener)
 	if err != nil {
 		return nil, err
 	}
+	err = pg.ArrivalService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.DeviationService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.ETARecordService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.ShiftService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.MaintenanceService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
 	err = pg.MessageService.initializeSchema(db)
 	if err != nil {
 		return nil, err
@@ -72,18 +166,81 @@ func New(cfg Config) (*Postgres, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = pg.UsageService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.AnalyticsService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.FavoriteService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.WidgetKeyService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = listener.Listen(vehiclesChangeChannel)
+	if err != nil {
+		return nil, err
+	}
 
-	go pg.LocationService.run()
+	locationNotifications := make(chan *pq.Notification)
+	go pg.LocationService.run(locationNotifications)
+	go pg.run(locationNotifications)
+	go checkHealth(db)
 
 	return pg, nil
 }
 
+// Close releases leadership and closes the database connections, waiting for
+// queries in progress to finish. It should be called after everything that
+// uses the database has stopped.
+func (pg *Postgres) Close() error {
+	pg.LeaderService.resign()
+	if err := pg.listener.Close(); err != nil {
+		return err
+	}
+	return pg.db.Close()
+}
+
+// checkHealth reports whether the database can be reached forever.
+func checkHealth(db *sql.DB) {
+	for {
+		health.Report(health.Database, db.Ping())
+		time.Sleep(healthCheckInterval)
+	}
+}
+
+// run hands each notification from Postgres to the service interested in it.
+func (pg *Postgres) run(locationNotifications chan<- *pq.Notification) {
+	for n := range pg.listener.Notify {
+		switch {
+		case n == nil:
+			// The listener reconnected, so we may have missed changes.
+			log.Warn("reconnected to Postgres; invalidating caches")
+			pg.LocationService.cache.invalidate()
+		case n.Channel == locationsInsertChannel, n.Channel == locationsPublishChannel:
+			locationNotifications <- n
+		case n.Channel == vehiclesChangeChannel:
+			pg.LocationService.cache.invalidate()
+		case strings.HasPrefix(n.Channel, broadcastChannelPrefix):
+			pg.BroadcastService.handle(n)
+		}
+	}
+}
+
 // NewConfig creates a new Config.
 func NewConfig(v *viper.Viper) (*Config, error) {
 	cfg := &Config{
-		URL: "postgres://localhost/shuttletracker?sslmode=disable",
+		URL:                "postgres://localhost/shuttletracker?sslmode=disable",
+		SlowQueryThreshold: "500ms",
 	}
 	v.SetDefault("postgres.url", cfg.URL)
+	v.SetDefault("postgres.slowquerythreshold", cfg.SlowQueryThreshold)
 
 	// Allow DATABASE_URL to set the Postgres connection string for ease of deployment.
 	err := v.BindEnv("postgres.url", "DATABASE_URL")
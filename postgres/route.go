@@ -2,12 +2,14 @@ package postgres
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/wtg/shuttletracker"
@@ -34,6 +36,10 @@ CREATE TABLE IF NOT EXISTS routes (
 	color varchar(9) NOT NULL DEFAULT '#ffffff',
 	points path
 );
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS label text NOT NULL DEFAULT '';
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS icon text NOT NULL DEFAULT '';
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS z_index integer NOT NULL DEFAULT 0;
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS dash_pattern text NOT NULL DEFAULT '';
 CREATE TABLE IF NOT EXISTS routes_stops (
 	id serial PRIMARY KEY,
 	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
@@ -41,6 +47,26 @@ CREATE TABLE IF NOT EXISTS routes_stops (
 	"order" integer NOT NULL,
 	UNIQUE (route_id, "order")
 );
+CREATE TABLE IF NOT EXISTS route_segments (
+	id serial PRIMARY KEY,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	"order" integer NOT NULL,
+	direction_id integer NOT NULL,
+	name text NOT NULL DEFAULT '',
+	stop_ids integer[] NOT NULL,
+	UNIQUE (route_id, "order")
+);
+CREATE TABLE IF NOT EXISTS route_visibility (
+	id serial PRIMARY KEY,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	start_day smallint NOT NULL CHECK (start_day >= 0 AND start_day < 7),
+	start_time time with time zone NOT NULL,
+	end_day smallint NOT NULL CHECK (end_day >= 0 AND end_day < 7),
+	end_time time with time zone NOT NULL,
+	CHECK (
+		(start_day = end_day AND start_time < end_time) OR (start_day < end_day)
+	)
+);
 CREATE TABLE IF NOT EXISTS route_schedules (
 	id serial PRIMARY KEY,
 	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
@@ -136,13 +162,19 @@ func (p *scanPoints) Scan(src interface{}) error {
 
 // Routes returns all Routes in the database.
 func (rs *RouteService) Routes() ([]*shuttletracker.Route, error) {
-	tx, err := rs.db.Begin()
+	return rs.RoutesContext(context.Background())
+}
+
+// RoutesContext is Routes as part of ctx's trace.
+func (rs *RouteService) RoutesContext(ctx context.Context) ([]*shuttletracker.Route, error) {
+	tx, err := rs.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	// We can't really do anything if rolling back a transaction fails.
 	// nolint: errcheck
 	defer tx.Rollback()
+	q := contextQueryer{ctx, tx}
 
 	routes := []*shuttletracker.Route{}
 
@@ -150,7 +182,8 @@ func (rs *RouteService) Routes() ([]*shuttletracker.Route, error) {
 	idsToRoute := map[int64]*shuttletracker.Route{}
 
 	query := `
-SELECT r.id, r.name, r.created, r.updated, r.enabled, r.width, r.color, r.points,
+SELECT r.id, r.name, r.created, r.updated, r.enabled, r.width, r.color, r.label, r.icon, r.z_index, r.dash_pattern,
+	r.points,
 	array_remove(array_agg(rs.stop_id ORDER BY rs.order ASC), NULL) as stop_ids,
 	route_is_active(r.id) as active
 FROM
@@ -158,25 +191,28 @@ FROM
 LEFT JOIN routes_stops rs ON r.id = rs.route_id
 GROUP BY r.id;
 `
-	rows, err := tx.Query(query)
+	rows, err := q.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	for rows.Next() {
 		r := &shuttletracker.Route{}
 		p := scanPoints{}
-		err = rows.Scan(&r.ID, &r.Name, &r.Created, &r.Updated, &r.Enabled, &r.Width, &r.Color, &p, pq.Array(&r.StopIDs), &r.Active)
+		err = rows.Scan(&r.ID, &r.Name, &r.Created, &r.Updated, &r.Enabled, &r.Width, &r.Color, &r.Label, &r.Icon,
+			&r.ZIndex, &r.DashPattern, &p, pq.Array(&r.StopIDs), &r.Active)
 		if err != nil {
 			return nil, err
 		}
 		r.Points = p.points
 		r.Schedule = shuttletracker.RouteSchedule{}
+		r.Segments = []shuttletracker.RouteSegment{}
+		r.Visibility = shuttletracker.RouteSchedule{}
 		routes = append(routes, r)
 		idsToRoute[r.ID] = r
 	}
 
 	query = "SELECT s.id, s.route_id, s.start_day, s.start_time, s.end_day, s.end_time FROM route_schedules s;"
-	rows, err = tx.Query(query)
+	rows, err = q.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -193,6 +229,21 @@ GROUP BY r.id;
 		route.Schedule = append(route.Schedule, interval)
 	}
 
+	if err = readSegments(q, routes); err != nil {
+		return nil, err
+	}
+	if err = readVisibility(q, routes); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err = applyCalendar(q, routes, now); err != nil {
+		return nil, err
+	}
+	if err = applyDetours(q, routes, now); err != nil {
+		return nil, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
@@ -210,19 +261,25 @@ func (rs *RouteService) Route(id int64) (*shuttletracker.Route, error) {
 	// nolint: errcheck
 	defer tx.Rollback()
 
-	query := "SELECT r.name, r.created, r.updated, r.enabled, r.width, r.color, r.points," +
+	query := "SELECT r.name, r.created, r.updated, r.enabled, r.width, r.color, r.label, r.icon, r.z_index," +
+		" r.dash_pattern, r.points," +
 		" array_remove(array_agg(rs.stop_id ORDER BY rs.order ASC), NULL) as stop_ids," +
 		" route_is_active(r.id) as active" +
 		" FROM routes r LEFT JOIN routes_stops rs" +
 		" ON r.id = rs.route_id WHERE r.id = $1 GROUP BY r.id;"
 	row := tx.QueryRow(query, id)
 	r := &shuttletracker.Route{
-		ID:       id,
-		Schedule: shuttletracker.RouteSchedule{},
+		ID:         id,
+		Schedule:   shuttletracker.RouteSchedule{},
+		Segments:   []shuttletracker.RouteSegment{},
+		Visibility: shuttletracker.RouteSchedule{},
 	}
 	p := scanPoints{}
-	err = row.Scan(&r.Name, &r.Created, &r.Updated, &r.Enabled, &r.Width, &r.Color, &p, pq.Array(&r.StopIDs), &r.Active)
-	if err != nil {
+	err = row.Scan(&r.Name, &r.Created, &r.Updated, &r.Enabled, &r.Width, &r.Color, &r.Label, &r.Icon, &r.ZIndex,
+		&r.DashPattern, &p, pq.Array(&r.StopIDs), &r.Active)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrRouteNotFound
+	} else if err != nil {
 		return nil, err
 	}
 	r.Points = p.points
@@ -244,6 +301,21 @@ func (rs *RouteService) Route(id int64) (*shuttletracker.Route, error) {
 		r.Schedule = append(r.Schedule, interval)
 	}
 
+	if err = readSegments(tx, []*shuttletracker.Route{r}); err != nil {
+		return nil, err
+	}
+	if err = readVisibility(tx, []*shuttletracker.Route{r}); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err = applyCalendar(tx, []*shuttletracker.Route{r}, now); err != nil {
+		return nil, err
+	}
+	if err = applyDetours(tx, []*shuttletracker.Route{r}, now); err != nil {
+		return nil, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
@@ -295,11 +367,19 @@ func (rs *RouteService) CreateRoute(route *shuttletracker.Route) error {
 	// nolint: errcheck
 	defer tx.Rollback()
 
+	if err = createRoute(tx, route); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func createRoute(tx *sql.Tx, route *shuttletracker.Route) error {
 	// insert route
-	statement := "INSERT INTO routes (name, enabled, width, color, points)" +
-		" VALUES ($1, $2, $3, $4, $5) RETURNING id, created, updated;"
-	row := tx.QueryRow(statement, route.Name, route.Enabled, route.Width, route.Color, valuePoints(route.Points))
-	err = row.Scan(&route.ID, &route.Created, &route.Updated)
+	statement := "INSERT INTO routes (name, enabled, width, color, label, icon, points, z_index, dash_pattern)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created, updated;"
+	row := tx.QueryRow(statement, route.Name, route.Enabled, route.Width, route.Color, route.Label, route.Icon,
+		valuePoints(route.Points), route.ZIndex, route.DashPattern)
+	err := row.Scan(&route.ID, &route.Created, &route.Updated)
 	if err != nil {
 		return err
 	}
@@ -313,6 +393,13 @@ func (rs *RouteService) CreateRoute(route *shuttletracker.Route) error {
 		return err
 	}
 
+	if err = writeSegments(tx, route); err != nil {
+		return err
+	}
+	if err = writeVisibility(tx, route); err != nil {
+		return err
+	}
+
 	// insert route schedule
 	for _, interval := range route.Schedule {
 		statement = "INSERT INTO route_schedules (route_id, start_day, start_time, end_day, end_time)" +
@@ -331,14 +418,17 @@ func (rs *RouteService) CreateRoute(route *shuttletracker.Route) error {
 	if err != nil {
 		return err
 	}
-
-	return tx.Commit()
+	return applyCalendar(tx, []*shuttletracker.Route{route}, time.Now())
 }
 
 // DeleteRoute deletes a Route.
 func (rs *RouteService) DeleteRoute(id int64) error {
+	return deleteRoute(rs.db, id)
+}
+
+func deleteRoute(e execer, id int64) error {
 	statement := "DELETE FROM routes WHERE id = $1;"
-	result, err := rs.db.Exec(statement, id)
+	result, err := e.Exec(statement, id)
 	if err != nil {
 		return err
 	}
@@ -364,27 +454,115 @@ func (rs *RouteService) ModifyRoute(route *shuttletracker.Route) error {
 	// nolint: errcheck
 	defer tx.Rollback()
 
-	// update route
-	statement := "UPDATE routes SET name = $1, enabled = $2, width = $3, color = $4, points = $5, updated = now()" +
-		" WHERE id = $6 RETURNING updated;"
-	row := tx.QueryRow(statement, route.Name, route.Enabled, route.Width, route.Color, valuePoints(route.Points), route.ID)
-	err = row.Scan(&route.Updated)
+	if err = modifyRoute(tx, route); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ModifyRouteStops replaces a Route's stop ordering and Segments in a single transaction.
+func (rs *RouteService) ModifyRouteStops(route *shuttletracker.Route) error {
+	tx, err := rs.db.Begin()
 	if err != nil {
 		return err
 	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	// lock the route so that concurrent reorderings don't interleave
+	row := tx.QueryRow("UPDATE routes SET updated = now() WHERE id = $1 RETURNING updated;", route.ID)
+	err = row.Scan(&route.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrRouteNotFound
+	} else if err != nil {
+		return err
+	}
 
-	// remove existing stop ordering
-	_, err = tx.Exec("DELETE FROM routes_stops WHERE route_id = $1;", route.ID)
+	if err = writeStops(tx, route); err != nil {
+		return err
+	}
+	if err = writeSegments(tx, route); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ImportRoutes creates Stops and then Routes in a single transaction. Routes'
+// StopIDs that are the negative placeholder IDs of Stops are replaced with
+// the Stops' real IDs.
+func (rs *RouteService) ImportRoutes(stops []*shuttletracker.Stop, routes []*shuttletracker.Route) error {
+	tx, err := rs.db.Begin()
 	if err != nil {
 		return err
 	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
 
-	// insert stop ordering
-	statement = "INSERT INTO routes_stops (route_id, stop_id, \"order\")" +
+	// newStops maps the placeholder IDs of created Stops to their real IDs.
+	newStops := map[int64]int64{}
+	for _, stop := range stops {
+		placeholder := stop.ID
+		if err = createStop(tx, stop); err != nil {
+			return err
+		}
+		newStops[placeholder] = stop.ID
+	}
+	for _, route := range routes {
+		for i, stopID := range route.StopIDs {
+			if stopID >= 0 {
+				continue
+			}
+			id, ok := newStops[stopID]
+			if !ok {
+				return fmt.Errorf("route %q: stop %d isn't created by the import", route.Name, stopID)
+			}
+			route.StopIDs[i] = id
+		}
+		if err = createRoute(tx, route); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// writeStops replaces a Route's stop ordering.
+func writeStops(tx *sql.Tx, route *shuttletracker.Route) error {
+	_, err := tx.Exec("DELETE FROM routes_stops WHERE route_id = $1;", route.ID)
+	if err != nil {
+		return err
+	}
+	statement := "INSERT INTO routes_stops (route_id, stop_id, \"order\")" +
 		" SELECT $1, stop_id, \"order\" - 1 AS \"order\" FROM" +
 		" unnest($2::integer[]) WITH ORDINALITY AS s(stop_id, \"order\");"
 	_, err = tx.Exec(statement, route.ID, pq.Array(route.StopIDs))
-	if err != nil {
+	return err
+}
+
+func modifyRoute(tx *sql.Tx, route *shuttletracker.Route) error {
+	// update route, keeping its own points if they include a detour
+	statement := "UPDATE routes SET name = $1, enabled = $2, width = $3, color = $4, label = $5, icon = $6," +
+		" points = CASE WHEN $9 THEN points ELSE $7 END, z_index = $10, dash_pattern = $11, updated = now()" +
+		" WHERE id = $8 RETURNING updated;"
+	row := tx.QueryRow(statement, route.Name, route.Enabled, route.Width, route.Color, route.Label, route.Icon,
+		valuePoints(route.Points), route.ID, route.DetourID != nil, route.ZIndex, route.DashPattern)
+	err := row.Scan(&route.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrRouteNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// replace stop ordering
+	if err = writeStops(tx, route); err != nil {
+		return err
+	}
+
+	if err = writeSegments(tx, route); err != nil {
+		return err
+	}
+	if err = writeVisibility(tx, route); err != nil {
 		return err
 	}
 
@@ -405,6 +583,134 @@ func (rs *RouteService) ModifyRoute(route *shuttletracker.Route) error {
 		}
 		interval.RouteID = route.ID
 	}
+	return nil
+}
 
-	return tx.Commit()
+// readSegments reads the Segments of each of the Routes in order.
+func readSegments(q queryer, routes []*shuttletracker.Route) error {
+	ids := make([]int64, 0, len(routes))
+	idsToRoute := map[int64]*shuttletracker.Route{}
+	for _, r := range routes {
+		ids = append(ids, r.ID)
+		idsToRoute[r.ID] = r
+	}
+	query := "SELECT route_id, direction_id, name, stop_ids FROM route_segments" +
+		" WHERE route_id = ANY($1) ORDER BY route_id, \"order\";"
+	rows, err := q.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var routeID int64
+		segment := shuttletracker.RouteSegment{}
+		err = rows.Scan(&routeID, &segment.DirectionID, &segment.Name, pq.Array(&segment.StopIDs))
+		if err != nil {
+			return err
+		}
+		route := idsToRoute[routeID]
+		route.Segments = append(route.Segments, segment)
+	}
+	return rows.Err()
+}
+
+// writeSegments replaces a Route's Segments.
+func writeSegments(tx *sql.Tx, route *shuttletracker.Route) error {
+	_, err := tx.Exec("DELETE FROM route_segments WHERE route_id = $1;", route.ID)
+	if err != nil {
+		return err
+	}
+	statement := "INSERT INTO route_segments (route_id, \"order\", direction_id, name, stop_ids)" +
+		" VALUES ($1, $2, $3, $4, $5);"
+	for i, segment := range route.Segments {
+		_, err = tx.Exec(statement, route.ID, i, segment.DirectionID, segment.Name, pq.Array(segment.StopIDs))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readVisibility reads the visibility intervals of each of the Routes.
+func readVisibility(q queryer, routes []*shuttletracker.Route) error {
+	ids := make([]int64, 0, len(routes))
+	idsToRoute := map[int64]*shuttletracker.Route{}
+	for _, r := range routes {
+		ids = append(ids, r.ID)
+		idsToRoute[r.ID] = r
+	}
+	query := "SELECT id, route_id, start_day, start_time, end_day, end_time FROM route_visibility" +
+		" WHERE route_id = ANY($1) ORDER BY route_id, start_day, start_time;"
+	rows, err := q.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		interval := shuttletracker.RouteActiveInterval{}
+		err = rows.Scan(&interval.ID, &interval.RouteID, &interval.StartDay, &interval.StartTime, &interval.EndDay, &interval.EndTime)
+		if err != nil {
+			return err
+		}
+		route := idsToRoute[interval.RouteID]
+		route.Visibility = append(route.Visibility, interval)
+	}
+	return rows.Err()
+}
+
+// writeVisibility replaces a Route's visibility intervals.
+func writeVisibility(tx *sql.Tx, route *shuttletracker.Route) error {
+	_, err := tx.Exec("DELETE FROM route_visibility WHERE route_id = $1;", route.ID)
+	if err != nil {
+		return err
+	}
+	statement := "INSERT INTO route_visibility (route_id, start_day, start_time, end_day, end_time)" +
+		" VALUES ($1, $2, $3, $4, $5) RETURNING id;"
+	for i := range route.Visibility {
+		interval := &route.Visibility[i]
+		row := tx.QueryRow(statement, route.ID, interval.StartDay, interval.StartTime, interval.EndDay, interval.EndTime)
+		if err = row.Scan(&interval.ID); err != nil {
+			return err
+		}
+		interval.RouteID = route.ID
+	}
+	return nil
+}
+
+// applyCalendar deactivates Routes that don't run on now's day according to
+// the service calendar, even during one of their active intervals.
+func applyCalendar(q queryer, routes []*shuttletracker.Route, now time.Time) error {
+	periods, err := servicePeriods(q)
+	if err != nil {
+		return err
+	}
+	// Only which days Schedules run on matters, so their Trips aren't needed.
+	schedules := []*shuttletracker.Schedule{}
+	rows, err := q.Query("SELECT id, route_id, days FROM schedules;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s := &shuttletracker.Schedule{}
+		var days []int64
+		if err = rows.Scan(&s.ID, &s.RouteID, pq.Array(&days)); err != nil {
+			return err
+		}
+		for _, d := range days {
+			s.Days = append(s.Days, time.Weekday(d))
+		}
+		schedules = append(schedules, s)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	calendar := shuttletracker.Calendar(periods)
+	for _, route := range routes {
+		if route.Active && !calendar.RouteRuns(route.ID, schedules, now) {
+			route.Active = false
+		}
+	}
+	return nil
 }
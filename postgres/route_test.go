@@ -288,3 +288,211 @@ func TestActiveTransition(t *testing.T) {
 		t.Error("route is active")
 	}
 }
+
+func TestRouteInactiveOnHoliday(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	route := &shuttletracker.Route{Name: "Test Route"}
+	if err := pg.CreateRoute(route); err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+	if !route.Active {
+		t.Error("route is not active")
+	}
+
+	today := time.Now().Format(shuttletracker.DateFormat)
+	holiday := &shuttletracker.ServicePeriod{Type: shuttletracker.ServicePeriodHoliday, Start: today, End: today}
+	if err := pg.CreateServicePeriod(holiday); err != nil {
+		t.Fatalf("unable to create ServicePeriod: %s", err)
+	}
+	route, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if route.Active {
+		t.Error("route is active on a holiday")
+	}
+}
+
+func TestRouteSegments(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stopIDs := []int64{}
+	for i := 0; i < 3; i++ {
+		stop := &shuttletracker.Stop{Latitude: 42.7 + float64(i)/100, Longitude: -73.7}
+		if err := pg.CreateStop(stop); err != nil {
+			t.Fatalf("unable to create Stop: %s", err)
+		}
+		stopIDs = append(stopIDs, stop.ID)
+	}
+	route := &shuttletracker.Route{
+		Name:    "Test Route",
+		StopIDs: []int64{stopIDs[0], stopIDs[1], stopIDs[2], stopIDs[1]},
+		Segments: []shuttletracker.RouteSegment{
+			{DirectionID: 0, Name: "Outbound", StopIDs: []int64{stopIDs[0], stopIDs[1], stopIDs[2]}},
+			{DirectionID: 1, Name: "Inbound", StopIDs: []int64{stopIDs[1]}},
+		},
+	}
+	if err := pg.CreateRoute(route); err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	got, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if len(got.Segments) != 2 || got.Segments[1].Name != "Inbound" || got.Segments[1].DirectionID != 1 ||
+		len(got.Segments[0].StopIDs) != 3 || got.Segments[0].StopIDs[2] != stopIDs[2] {
+		t.Errorf("got segments %+v, expected %+v", got.Segments, route.Segments)
+	}
+
+	got.Segments = nil
+	if err := pg.ModifyRoute(got); err != nil {
+		t.Fatalf("unable to modify Route: %s", err)
+	}
+	routes, err := pg.Routes()
+	if err != nil {
+		t.Fatalf("unable to get Routes: %s", err)
+	}
+	if len(routes) != 1 || len(routes[0].Segments) != 0 {
+		t.Errorf("got %+v, expected one Route without segments", routes)
+	}
+}
+
+func TestRouteVisibility(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	route := &shuttletracker.Route{
+		Name: "Late Night",
+		Visibility: shuttletracker.RouteSchedule{{
+			StartDay:  time.Friday,
+			StartTime: time.Date(0, 1, 1, 22, 0, 0, 0, time.UTC),
+			EndDay:    time.Saturday,
+			EndTime:   time.Date(0, 1, 1, 3, 0, 0, 0, time.UTC),
+		}},
+	}
+	if err := pg.CreateRoute(route); err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+	if route.Visibility[0].ID == 0 || route.Visibility[0].RouteID != route.ID {
+		t.Errorf("got interval %+v, expected its IDs to be set", route.Visibility[0])
+	}
+
+	got, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if len(got.Visibility) != 1 || got.Visibility[0].StartDay != time.Friday || got.Visibility[0].EndDay != time.Saturday {
+		t.Errorf("got visibility %+v, expected %+v", got.Visibility, route.Visibility)
+	}
+
+	got.Visibility = nil
+	if err := pg.ModifyRoute(got); err != nil {
+		t.Fatalf("unable to modify Route: %s", err)
+	}
+	got, err = pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if len(got.Visibility) != 0 {
+		t.Errorf("got visibility %+v, expected none", got.Visibility)
+	}
+}
+
+func TestModifyRouteStops(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stopIDs := []int64{}
+	for i := 0; i < 3; i++ {
+		stop := &shuttletracker.Stop{Latitude: 42.7 + float64(i)/100, Longitude: -73.7}
+		if err := pg.CreateStop(stop); err != nil {
+			t.Fatalf("unable to create Stop: %s", err)
+		}
+		stopIDs = append(stopIDs, stop.ID)
+	}
+	route := &shuttletracker.Route{
+		Name:    "Test Route",
+		Color:   "#ff0000",
+		StopIDs: stopIDs,
+	}
+	if err := pg.CreateRoute(route); err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	reordered := &shuttletracker.Route{
+		ID:      route.ID,
+		StopIDs: []int64{stopIDs[2], stopIDs[0], stopIDs[1]},
+		Segments: []shuttletracker.RouteSegment{
+			{DirectionID: 1, Name: "Inbound", StopIDs: []int64{stopIDs[2], stopIDs[0], stopIDs[1]}},
+		},
+	}
+	if err := pg.ModifyRouteStops(reordered); err != nil {
+		t.Fatalf("unable to modify Route stops: %s", err)
+	}
+	got, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if got.Name != route.Name || got.Color != route.Color {
+		t.Errorf("got %+v, expected the rest of the Route to be unchanged", got)
+	}
+	if len(got.StopIDs) != 3 || got.StopIDs[0] != stopIDs[2] || got.StopIDs[2] != stopIDs[1] {
+		t.Errorf("got stop IDs %v, expected %v", got.StopIDs, reordered.StopIDs)
+	}
+	if len(got.Segments) != 1 || got.Segments[0].Name != "Inbound" {
+		t.Errorf("got segments %+v, expected %+v", got.Segments, reordered.Segments)
+	}
+
+	if err := pg.ModifyRouteStops(&shuttletracker.Route{ID: route.ID + 1}); err != shuttletracker.ErrRouteNotFound {
+		t.Errorf("got error %v, expected ErrRouteNotFound", err)
+	}
+}
+
+func TestImportRoutes(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stops := []*shuttletracker.Stop{
+		{ID: -1, Latitude: 42.73, Longitude: -73.68},
+		{ID: -2, Latitude: 42.74, Longitude: -73.68},
+	}
+	route := &shuttletracker.Route{Name: "Imported", StopIDs: []int64{-2, -1}}
+	if err := pg.ImportRoutes(stops, []*shuttletracker.Route{route}); err != nil {
+		t.Fatalf("unable to import Routes: %s", err)
+	}
+	got, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if len(got.StopIDs) != 2 || got.StopIDs[0] != stops[1].ID || got.StopIDs[1] != stops[0].ID {
+		t.Errorf("got stop IDs %v, expected [%d %d]", got.StopIDs, stops[1].ID, stops[0].ID)
+	}
+
+	// nothing is created if anything fails
+	bad := &shuttletracker.Route{Name: "Bad", StopIDs: []int64{-3}}
+	if err := pg.ImportRoutes([]*shuttletracker.Stop{{ID: -1}}, []*shuttletracker.Route{bad}); err == nil {
+		t.Errorf("expected an error for a stop that isn't imported")
+	}
+	if all, err := pg.Stops(); err != nil || len(all) != 2 {
+		t.Errorf("got %d stops, %v, expected the failed import's stop to not be created", len(all), err)
+	}
+}
@@ -0,0 +1,263 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ScheduleService implements shuttletracker.ScheduleService.
+type ScheduleService struct {
+	db *sql.DB
+}
+
+func (ss *ScheduleService) initializeSchema(db *sql.DB) error {
+	ss.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS schedules (
+	id serial PRIMARY KEY,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	name text NOT NULL DEFAULT '',
+	days smallint[] NOT NULL DEFAULT '{}',
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS trips (
+	id serial PRIMARY KEY,
+	schedule_id integer REFERENCES schedules ON DELETE CASCADE NOT NULL,
+	direction text NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS trip_stop_times (
+	trip_id integer REFERENCES trips ON DELETE CASCADE NOT NULL,
+	"order" integer NOT NULL,
+	stop_id integer REFERENCES stops ON DELETE CASCADE NOT NULL,
+	arrival integer NOT NULL,
+	departure integer NOT NULL,
+	PRIMARY KEY (trip_id, "order")
+);`
+	_, err := ss.db.Exec(schema)
+	return err
+}
+
+// Schedule returns the Schedule with the provided ID.
+func (ss *ScheduleService) Schedule(id int64) (*shuttletracker.Schedule, error) {
+	schedules, err := ss.schedules("WHERE s.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, shuttletracker.ErrScheduleNotFound
+	}
+	return schedules[0], nil
+}
+
+// Schedules returns all Schedules, with their Trips in the order they start.
+func (ss *ScheduleService) Schedules() ([]*shuttletracker.Schedule, error) {
+	return ss.schedules("")
+}
+
+// schedules returns the Schedules matching a WHERE clause on schedules s,
+// along with all of their Trips.
+func (ss *ScheduleService) schedules(where string, args ...interface{}) ([]*shuttletracker.Schedule, error) {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	schedules := []*shuttletracker.Schedule{}
+	idsToSchedule := map[int64]*shuttletracker.Schedule{}
+	query := "SELECT s.id, s.route_id, s.name, s.days, s.created, s.updated FROM schedules s " + where + " ORDER BY s.id;"
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		s := &shuttletracker.Schedule{Days: []time.Weekday{}, Trips: []*shuttletracker.Trip{}}
+		var days []int64
+		err = rows.Scan(&s.ID, &s.RouteID, &s.Name, pq.Array(&days), &s.Created, &s.Updated)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range days {
+			s.Days = append(s.Days, time.Weekday(d))
+		}
+		schedules = append(schedules, s)
+		idsToSchedule[s.ID] = s
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Trips are ordered by their first departure, and stop times by when
+	// they're visited.
+	query = `
+SELECT t.id, t.schedule_id, t.direction, st.stop_id, st.arrival, st.departure
+FROM trips t
+JOIN schedules s ON s.id = t.schedule_id
+JOIN trip_stop_times st ON st.trip_id = t.id
+` + where + `
+ORDER BY (SELECT min(departure) FROM trip_stop_times WHERE trip_id = t.id), t.id, st."order";`
+	rows, err = tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var trip *shuttletracker.Trip
+	for rows.Next() {
+		var tripID, scheduleID int64
+		var direction string
+		var st shuttletracker.StopTime
+		var arrival, departure int64
+		err = rows.Scan(&tripID, &scheduleID, &direction, &st.StopID, &arrival, &departure)
+		if err != nil {
+			return nil, err
+		}
+		st.Arrival = shuttletracker.TimeOfDay(time.Duration(arrival) * time.Second)
+		st.Departure = shuttletracker.TimeOfDay(time.Duration(departure) * time.Second)
+		if trip == nil || trip.ID != tripID {
+			trip = &shuttletracker.Trip{ID: tripID, ScheduleID: scheduleID, Direction: direction}
+			if s, ok := idsToSchedule[scheduleID]; ok {
+				s.Trips = append(s.Trips, trip)
+			}
+		}
+		trip.StopTimes = append(trip.StopTimes, st)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return schedules, tx.Commit()
+}
+
+// CreateSchedule creates a Schedule and its Trips.
+func (ss *ScheduleService) CreateSchedule(schedule *shuttletracker.Schedule) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	if err = createSchedule(tx, schedule); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func createSchedule(tx *sql.Tx, schedule *shuttletracker.Schedule) error {
+	statement := "INSERT INTO schedules (route_id, name, days) VALUES ($1, $2, $3) RETURNING id, created, updated;"
+	row := tx.QueryRow(statement, schedule.RouteID, schedule.Name, pq.Array(weekdays(schedule.Days)))
+	if err := row.Scan(&schedule.ID, &schedule.Created, &schedule.Updated); err != nil {
+		return err
+	}
+	return insertTrips(tx, schedule)
+}
+
+// ModifySchedule updates a Schedule and replaces all of its Trips.
+func (ss *ScheduleService) ModifySchedule(schedule *shuttletracker.Schedule) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	if err = modifySchedule(tx, schedule); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func modifySchedule(tx *sql.Tx, schedule *shuttletracker.Schedule) error {
+	statement := "UPDATE schedules SET route_id = $1, name = $2, days = $3, updated = now()" +
+		" WHERE id = $4 RETURNING created, updated;"
+	row := tx.QueryRow(statement, schedule.RouteID, schedule.Name, pq.Array(weekdays(schedule.Days)), schedule.ID)
+	err := row.Scan(&schedule.Created, &schedule.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrScheduleNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM trips WHERE schedule_id = $1;", schedule.ID); err != nil {
+		return err
+	}
+	return insertTrips(tx, schedule)
+}
+
+// ReplaceSchedules creates and modifies Schedules in a single transaction.
+func (ss *ScheduleService) ReplaceSchedules(schedules []*shuttletracker.Schedule) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	for _, schedule := range schedules {
+		if schedule.ID == 0 {
+			err = createSchedule(tx, schedule)
+		} else {
+			err = modifySchedule(tx, schedule)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteSchedule deletes a Schedule and its Trips.
+func (ss *ScheduleService) DeleteSchedule(id int64) error {
+	return deleteSchedule(ss.db, id)
+}
+
+func deleteSchedule(e execer, id int64) error {
+	result, err := e.Exec("DELETE FROM schedules WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrScheduleNotFound
+	}
+	return nil
+}
+
+func insertTrips(tx *sql.Tx, schedule *shuttletracker.Schedule) error {
+	for _, trip := range schedule.Trips {
+		trip.ScheduleID = schedule.ID
+		row := tx.QueryRow("INSERT INTO trips (schedule_id, direction) VALUES ($1, $2) RETURNING id;", schedule.ID, trip.Direction)
+		if err := row.Scan(&trip.ID); err != nil {
+			return err
+		}
+		statement := "INSERT INTO trip_stop_times (trip_id, \"order\", stop_id, arrival, departure) VALUES ($1, $2, $3, $4, $5);"
+		for i, st := range trip.StopTimes {
+			arrival := int64(time.Duration(st.Arrival) / time.Second)
+			departure := int64(time.Duration(st.Departure) / time.Second)
+			if _, err := tx.Exec(statement, trip.ID, i, st.StopID, arrival, departure); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func weekdays(days []time.Weekday) []int64 {
+	ints := make([]int64, len(days))
+	for i, d := range days {
+		ints[i] = int64(d)
+	}
+	return ints
+}
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestScheduleTrips(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stop := &shuttletracker.Stop{}
+	if err := pg.CreateStop(stop); err != nil {
+		t.Fatalf("unable to create Stop: %s", err)
+	}
+	route := &shuttletracker.Route{Name: "Test Route", StopIDs: []int64{stop.ID}}
+	if err := pg.CreateRoute(route); err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	at := func(minutes int) shuttletracker.TimeOfDay {
+		return shuttletracker.TimeOfDay(time.Duration(minutes) * time.Minute)
+	}
+	trip := func(start int) *shuttletracker.Trip {
+		return &shuttletracker.Trip{StopTimes: []shuttletracker.StopTime{
+			{StopID: stop.ID, Arrival: at(start), Departure: at(start + 1)},
+			{StopID: stop.ID, Arrival: at(start + 20), Departure: at(start + 20)},
+		}}
+	}
+	schedule := &shuttletracker.Schedule{
+		RouteID: route.ID,
+		Days:    []time.Weekday{time.Saturday},
+		Trips:   []*shuttletracker.Trip{trip(600), trip(480)},
+	}
+	if err := pg.CreateSchedule(schedule); err != nil {
+		t.Fatalf("unable to create Schedule: %s", err)
+	}
+
+	schedule, err := pg.Schedule(schedule.ID)
+	if err != nil {
+		t.Fatalf("unable to get Schedule: %s", err)
+	}
+	if len(schedule.Days) != 1 || schedule.Days[0] != time.Saturday {
+		t.Errorf("got days %v", schedule.Days)
+	}
+	if len(schedule.Trips) != 2 || schedule.Trips[0].StopTimes[0].Arrival != at(480) || len(schedule.Trips[1].StopTimes) != 2 {
+		t.Errorf("got trips %+v, expected them in order of departure", schedule.Trips)
+	}
+
+	schedule.Trips = schedule.Trips[:1]
+	if err = pg.ModifySchedule(schedule); err != nil {
+		t.Fatalf("unable to modify Schedule: %s", err)
+	}
+	schedules, err := pg.Schedules()
+	if err != nil {
+		t.Fatalf("unable to get Schedules: %s", err)
+	}
+	if len(schedules) != 1 || len(schedules[0].Trips) != 1 {
+		t.Errorf("got %+v, expected one Schedule with one Trip", schedules)
+	}
+
+	if err = pg.DeleteSchedule(schedule.ID); err != nil {
+		t.Fatalf("unable to delete Schedule: %s", err)
+	}
+	if _, err = pg.Schedule(schedule.ID); err != shuttletracker.ErrScheduleNotFound {
+		t.Errorf("got %v, expected ErrScheduleNotFound", err)
+	}
+}
+
+func TestReplaceSchedules(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	route := &shuttletracker.Route{Name: "Test Route"}
+	if err := pg.CreateRoute(route); err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+	existing := &shuttletracker.Schedule{RouteID: route.ID, Name: "weekday"}
+	if err := pg.CreateSchedule(existing); err != nil {
+		t.Fatalf("unable to create Schedule: %s", err)
+	}
+
+	replaced := &shuttletracker.Schedule{ID: existing.ID, RouteID: route.ID, Name: "weekday", Days: []time.Weekday{time.Monday}}
+	created := &shuttletracker.Schedule{RouteID: route.ID, Name: "weekend"}
+	if err := pg.ReplaceSchedules([]*shuttletracker.Schedule{replaced, created}); err != nil {
+		t.Fatalf("unable to replace Schedules: %s", err)
+	}
+	schedules, err := pg.Schedules()
+	if err != nil {
+		t.Fatalf("unable to get Schedules: %s", err)
+	}
+	if len(schedules) != 2 || len(schedules[0].Days) != 1 || schedules[1].ID != created.ID {
+		t.Errorf("got %+v, expected the weekday Schedule replaced and a weekend Schedule", schedules)
+	}
+
+	// nothing is changed if anything fails
+	missing := &shuttletracker.Schedule{ID: created.ID + 1, RouteID: route.ID}
+	another := &shuttletracker.Schedule{RouteID: route.ID, Name: "holiday"}
+	if err = pg.ReplaceSchedules([]*shuttletracker.Schedule{another, missing}); err != shuttletracker.ErrScheduleNotFound {
+		t.Errorf("got %v, expected ErrScheduleNotFound", err)
+	}
+	if schedules, err = pg.Schedules(); err != nil || len(schedules) != 2 {
+		t.Errorf("got %d Schedules, %v, expected the holiday Schedule to not be created", len(schedules), err)
+	}
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ShiftService implements shuttletracker.ShiftService.
+type ShiftService struct {
+	db *sql.DB
+}
+
+func (ss *ShiftService) initializeSchema(db *sql.DB) error {
+	ss.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS shifts (
+	id serial PRIMARY KEY,
+	operator text NOT NULL,
+	vehicle_id integer REFERENCES vehicles ON DELETE CASCADE NOT NULL,
+	notes text NOT NULL DEFAULT '',
+	start_time timestamp with time zone NOT NULL,
+	end_time timestamp with time zone,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now(),
+	CHECK (end_time IS NULL OR start_time < end_time)
+);
+CREATE INDEX IF NOT EXISTS shifts_vehicle_id_start_time_idx ON shifts (vehicle_id, start_time);
+`
+	_, err := ss.db.Exec(schema)
+	return err
+}
+
+const shiftColumns = "id, operator, vehicle_id, notes, start_time, end_time, created, updated"
+
+func scanShift(row interface{ Scan(...interface{}) error }) (*shuttletracker.Shift, error) {
+	s := &shuttletracker.Shift{}
+	err := row.Scan(&s.ID, &s.Operator, &s.VehicleID, &s.Notes, &s.Start, &s.End, &s.Created, &s.Updated)
+	return s, err
+}
+
+// Shift returns the Shift with the provided ID.
+func (ss *ShiftService) Shift(id int64) (*shuttletracker.Shift, error) {
+	row := ss.db.QueryRow("SELECT "+shiftColumns+" FROM shifts WHERE id = $1;", id)
+	s, err := scanShift(row)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrShiftNotFound
+	}
+	return s, err
+}
+
+// Shifts returns the Shifts overlapping the filter, ordered by when they started.
+func (ss *ShiftService) Shifts(filter shuttletracker.HistoryFilter) ([]*shuttletracker.Shift, error) {
+	query := "SELECT " + shiftColumns + " FROM shifts" +
+		" WHERE start_time <= $2 AND (end_time IS NULL OR end_time > $1)" +
+		" AND ($3::integer IS NULL OR vehicle_id = $3)" +
+		" AND ($4::integer IS NULL OR vehicle_id IN (SELECT id FROM vehicles WHERE group_id = $4))" +
+		" ORDER BY start_time, id;"
+	rows, err := ss.db.Query(query, filter.Since, filter.Until, filter.VehicleID, filter.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shifts := []*shuttletracker.Shift{}
+	for rows.Next() {
+		s, err := scanShift(rows)
+		if err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, s)
+	}
+	return shifts, rows.Err()
+}
+
+// CreateShift creates a Shift.
+func (ss *ShiftService) CreateShift(s *shuttletracker.Shift) error {
+	statement := "INSERT INTO shifts (operator, vehicle_id, notes, start_time, end_time)" +
+		" VALUES ($1, $2, $3, $4, $5) RETURNING id, created, updated;"
+	row := ss.db.QueryRow(statement, s.Operator, s.VehicleID, s.Notes, s.Start, s.End)
+	return row.Scan(&s.ID, &s.Created, &s.Updated)
+}
+
+// ModifyShift updates a Shift.
+func (ss *ShiftService) ModifyShift(s *shuttletracker.Shift) error {
+	statement := "UPDATE shifts SET operator = $1, vehicle_id = $2, notes = $3, start_time = $4, end_time = $5, updated = now()" +
+		" WHERE id = $6 RETURNING created, updated;"
+	row := ss.db.QueryRow(statement, s.Operator, s.VehicleID, s.Notes, s.Start, s.End, s.ID)
+	err := row.Scan(&s.Created, &s.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrShiftNotFound
+	}
+	return err
+}
+
+// DeleteShift deletes a Shift.
+func (ss *ShiftService) DeleteShift(id int64) error {
+	result, err := ss.db.Exec("DELETE FROM shifts WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrShiftNotFound
+	}
+	return nil
+}
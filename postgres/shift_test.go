@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestShifts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	vehicle := &shuttletracker.Vehicle{Name: "Test Vehicle", TrackerID: "1"}
+	if err := pg.CreateVehicle(vehicle); err != nil {
+		t.Fatalf("unable to create Vehicle: %s", err)
+	}
+	start := time.Date(2019, time.March, 4, 8, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	morning := &shuttletracker.Shift{Operator: "Alex", VehicleID: vehicle.ID, Start: start, End: &end}
+	afternoon := &shuttletracker.Shift{Operator: "Sam", VehicleID: vehicle.ID, Start: end}
+	for _, s := range []*shuttletracker.Shift{afternoon, morning} {
+		if err := pg.CreateShift(s); err != nil {
+			t.Fatalf("unable to create Shift: %s", err)
+		}
+	}
+
+	tests := []struct {
+		at       time.Time
+		operator string
+	}{
+		{start.Add(-time.Minute), ""},
+		{start, "Alex"},
+		{end.Add(-time.Second), "Alex"},
+		{end, "Sam"},
+		{end.AddDate(1, 0, 0), "Sam"},
+	}
+	for _, test := range tests {
+		shifts, err := pg.Shifts(shuttletracker.HistoryFilter{Since: test.at, Until: test.at, VehicleID: &vehicle.ID})
+		if err != nil {
+			t.Fatalf("unable to get Shifts: %s", err)
+		}
+		if test.operator == "" && len(shifts) != 0 || test.operator != "" && (len(shifts) != 1 || shifts[0].Operator != test.operator) {
+			t.Errorf("at %s: got %+v, expected %q", test.at, shifts, test.operator)
+		}
+	}
+
+	shifts, err := pg.Shifts(shuttletracker.HistoryFilter{Since: start, Until: end.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("unable to get Shifts: %s", err)
+	}
+	if len(shifts) != 2 || shifts[0].ID != morning.ID || shifts[1].End != nil {
+		t.Errorf("got %+v, expected the morning and afternoon shifts", shifts)
+	}
+
+	afternoon.End = &end
+	if err := pg.ModifyShift(afternoon); err == nil {
+		t.Error("expected error ending a shift when it starts")
+	}
+	if err := pg.DeleteShift(morning.ID); err != nil {
+		t.Errorf("unable to delete Shift: %s", err)
+	}
+	if _, err := pg.Shift(morning.ID); err != shuttletracker.ErrShiftNotFound {
+		t.Errorf("got %v, expected ErrShiftNotFound", err)
+	}
+}
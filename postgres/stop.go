@@ -22,36 +22,73 @@ CREATE TABLE IF NOT EXISTS stops (
 	longitude double precision NOT NULL,
 	created timestamp with time zone NOT NULL DEFAULT now(),
 	updated timestamp with time zone NOT NULL DEFAULT now()
-);`
+);
+ALTER TABLE stops ADD COLUMN IF NOT EXISTS shelter boolean NOT NULL DEFAULT false;
+ALTER TABLE stops ADD COLUMN IF NOT EXISTS lighting boolean NOT NULL DEFAULT false;
+ALTER TABLE stops ADD COLUMN IF NOT EXISTS bench boolean NOT NULL DEFAULT false;
+ALTER TABLE stops ADD COLUMN IF NOT EXISTS wheelchair_accessible boolean NOT NULL DEFAULT false;
+ALTER TABLE stops ADD COLUMN IF NOT EXISTS photo_url text NOT NULL DEFAULT '';`
 	_, err := ss.db.Exec(schema)
 	return err
 }
 
+const stopColumns = "s.id, s.name, s.created, s.updated, s.description, s.latitude, s.longitude, " +
+	"s.shelter, s.lighting, s.bench, s.wheelchair_accessible, s.photo_url"
+
+// scanStop scans a row of stopColumns.
+func scanStop(row interface{ Scan(...interface{}) error }) (*shuttletracker.Stop, error) {
+	s := &shuttletracker.Stop{}
+	err := row.Scan(&s.ID, &s.Name, &s.Created, &s.Updated, &s.Description, &s.Latitude, &s.Longitude,
+		&s.Shelter, &s.Lighting, &s.Bench, &s.WheelchairAccessible, &s.PhotoURL)
+	return s, err
+}
+
 // CreateStop creates a Stop.
 func (ss *StopService) CreateStop(stop *shuttletracker.Stop) error {
-	statement := "INSERT INTO stops (name, description, latitude, longitude) VALUES" +
-		" ($1, $2, $3, $4) RETURNING id, created, updated;"
-	row := ss.db.QueryRow(statement, stop.Name, stop.Description, stop.Latitude, stop.Longitude)
+	return createStop(ss.db, stop)
+}
+
+// rowQueryer is a *sql.DB or *sql.Tx.
+type rowQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func createStop(q rowQueryer, stop *shuttletracker.Stop) error {
+	statement := "INSERT INTO stops (name, description, latitude, longitude, shelter, lighting, bench," +
+		" wheelchair_accessible, photo_url) VALUES" +
+		" ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created, updated;"
+	row := q.QueryRow(statement, stop.Name, stop.Description, stop.Latitude, stop.Longitude,
+		stop.Shelter, stop.Lighting, stop.Bench, stop.WheelchairAccessible, stop.PhotoURL)
 	return row.Scan(&stop.ID, &stop.Created, &stop.Updated)
 }
 
 func (ss *StopService) CreateStopWithID(stop *shuttletracker.Stop) error {
-	statement := "INSERT INTO stops (id, name, description, latitude, longitude) VALUES" +
-		" ($1, $2, $3, $4, $5) RETURNING id, created, updated;"
-	row := ss.db.QueryRow(statement, stop.ID, stop.Name, stop.Description, stop.Latitude, stop.Longitude)
+	statement := "INSERT INTO stops (id, name, description, latitude, longitude, shelter, lighting, bench," +
+		" wheelchair_accessible, photo_url) VALUES" +
+		" ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created, updated;"
+	row := ss.db.QueryRow(statement, stop.ID, stop.Name, stop.Description, stop.Latitude, stop.Longitude,
+		stop.Shelter, stop.Lighting, stop.Bench, stop.WheelchairAccessible, stop.PhotoURL)
 	return row.Scan(&stop.ID, &stop.Created, &stop.Updated)
 }
 
-// Stop returns a Stop by its ID.
-func (ss *StopService) Stop(id int64) (*shuttletracker.Stop, error) {
-	s := &shuttletracker.Stop{
-		ID: id,
+// ModifyStop updates a Stop by its ID.
+func (ss *StopService) ModifyStop(stop *shuttletracker.Stop) error {
+	statement := "UPDATE stops SET name = $1, description = $2, latitude = $3, longitude = $4, shelter = $5," +
+		" lighting = $6, bench = $7, wheelchair_accessible = $8, photo_url = $9, updated = now()" +
+		" WHERE id = $10 RETURNING created, updated;"
+	row := ss.db.QueryRow(statement, stop.Name, stop.Description, stop.Latitude, stop.Longitude,
+		stop.Shelter, stop.Lighting, stop.Bench, stop.WheelchairAccessible, stop.PhotoURL, stop.ID)
+	err := row.Scan(&stop.Created, &stop.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrStopNotFound
 	}
+	return err
+}
 
-	statement := "SELECT s.name, s.created, s.updated, s.description, s.latitude, s.longitude" +
-		" FROM stops s WHERE id = $1;"
-	row := ss.db.QueryRow(statement, id)
-	err := row.Scan(&s.Name, &s.Created, &s.Updated, &s.Description, &s.Latitude, &s.Longitude)
+// Stop returns a Stop by its ID.
+func (ss *StopService) Stop(id int64) (*shuttletracker.Stop, error) {
+	statement := "SELECT " + stopColumns + " FROM stops s WHERE id = $1;"
+	s, err := scanStop(ss.db.QueryRow(statement, id))
 	if err == sql.ErrNoRows {
 		return nil, shuttletracker.ErrStopNotFound
 	}
@@ -62,15 +99,13 @@ func (ss *StopService) Stop(id int64) (*shuttletracker.Stop, error) {
 // Stops returns all Stops.
 func (ss *StopService) Stops() ([]*shuttletracker.Stop, error) {
 	stops := []*shuttletracker.Stop{}
-	query := "SELECT s.id, s.name, s.created, s.updated, s.description, s.latitude, s.longitude" +
-		" FROM stops s;"
+	query := "SELECT " + stopColumns + " FROM stops s;"
 	rows, err := ss.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	for rows.Next() {
-		s := &shuttletracker.Stop{}
-		err := rows.Scan(&s.ID, &s.Name, &s.Created, &s.Updated, &s.Description, &s.Latitude, &s.Longitude)
+		s, err := scanStop(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -97,3 +132,55 @@ func (ss *StopService) DeleteStop(id int64) error {
 
 	return nil
 }
+
+// MergeStops moves every reference to the Stop with mergeID to the Stop with
+// keepID and deletes it in a single transaction. Demand totals for the same
+// hour are added together, and riders who saved both keep one Favorite.
+func (ss *StopService) MergeStops(keepID, mergeID int64) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	// lock both stops so that neither is deleted while references are moved
+	var n int
+	row := tx.QueryRow("SELECT count(*) FROM (SELECT id FROM stops WHERE id IN ($1, $2) FOR UPDATE) s;", keepID, mergeID)
+	if err = row.Scan(&n); err != nil {
+		return err
+	}
+	if n != 2 {
+		return shuttletracker.ErrStopNotFound
+	}
+
+	statements := []string{
+		"UPDATE routes_stops SET stop_id = $1 WHERE stop_id = $2;",
+		"UPDATE route_segments SET stop_ids = array_replace(stop_ids, $2::integer, $1::integer) WHERE $2 = ANY(stop_ids);",
+		"UPDATE trip_stop_times SET stop_id = $1 WHERE stop_id = $2;",
+		"UPDATE arrivals SET stop_id = $1 WHERE stop_id = $2;",
+		"UPDATE deviations SET stop_id = $1 WHERE stop_id = $2;",
+		"UPDATE eta_records SET stop_id = $1 WHERE stop_id = $2;",
+		"INSERT INTO favorites (device_token, stop_id, created) SELECT device_token, $1, created FROM favorites WHERE stop_id = $2" +
+			" ON CONFLICT DO NOTHING;",
+		"INSERT INTO demand (hour, stop_id, bus_button_presses, eta_subscriptions, alarms, timetable_queries)" +
+			" SELECT hour, $1, bus_button_presses, eta_subscriptions, alarms, timetable_queries FROM demand WHERE stop_id = $2" +
+			" ON CONFLICT (hour, stop_id) DO UPDATE SET bus_button_presses = demand.bus_button_presses + excluded.bus_button_presses," +
+			" eta_subscriptions = demand.eta_subscriptions + excluded.eta_subscriptions," +
+			" alarms = demand.alarms + excluded.alarms," +
+			" timetable_queries = demand.timetable_queries + excluded.timetable_queries;",
+	}
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement, keepID, mergeID); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec("DELETE FROM demand WHERE stop_id = $1;", mergeID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM stops WHERE id = $1;", mergeID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,194 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// TrackerDeviceService implements shuttletracker.TrackerDeviceService.
+type TrackerDeviceService struct {
+	db *sql.DB
+
+	// locationCache is invalidated when TrackerDevices change, since that can
+	// change which Vehicle a tracker's Locations belong to.
+	locationCache *latestLocationCache
+}
+
+func (ts *TrackerDeviceService) initializeSchema(db *sql.DB) error {
+	ts.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS tracker_devices (
+	id serial PRIMARY KEY,
+	tracker_id varchar(10) NOT NULL,
+	vehicle_id integer REFERENCES vehicles ON DELETE CASCADE NOT NULL,
+	notes text NOT NULL DEFAULT '',
+	start_time timestamp with time zone NOT NULL,
+	end_time timestamp with time zone,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now(),
+	CHECK (end_time IS NULL OR start_time < end_time)
+);
+CREATE INDEX IF NOT EXISTS tracker_devices_tracker_id_start_time_idx ON tracker_devices (tracker_id, start_time);
+ALTER TABLE tracker_devices ADD COLUMN IF NOT EXISTS priority integer NOT NULL DEFAULT 0;
+
+-- tracker_vehicle returns the ID of the vehicle that a tracker was installed
+-- in at a time. Trackers that have never been registered belong to the vehicle
+-- with their tracker ID.
+CREATE OR REPLACE FUNCTION tracker_vehicle(tracker varchar, at timestamp with time zone) RETURNS integer AS $$
+	SELECT CASE
+		WHEN EXISTS (SELECT 1 FROM tracker_devices WHERE tracker_id = tracker) THEN (
+			SELECT vehicle_id FROM tracker_devices
+			WHERE tracker_id = tracker AND start_time <= at AND (end_time IS NULL OR end_time > at)
+			ORDER BY start_time DESC LIMIT 1)
+		ELSE (SELECT id FROM vehicles WHERE tracker_id = tracker)
+	END;
+$$ LANGUAGE sql STABLE;
+
+DROP TRIGGER IF EXISTS tracker_devices_change on tracker_devices;
+CREATE TRIGGER tracker_devices_change AFTER INSERT OR UPDATE OR DELETE ON tracker_devices FOR EACH STATEMENT EXECUTE PROCEDURE vehicles_change_notify();
+`
+	_, err := ts.db.Exec(schema)
+	return err
+}
+
+const trackerDeviceColumns = "id, tracker_id, vehicle_id, notes, priority, start_time, end_time, created, updated"
+
+func scanTrackerDevice(row interface{ Scan(...interface{}) error }) (*shuttletracker.TrackerDevice, error) {
+	td := &shuttletracker.TrackerDevice{}
+	err := row.Scan(&td.ID, &td.TrackerID, &td.VehicleID, &td.Notes, &td.Priority, &td.Start, &td.End, &td.Created, &td.Updated)
+	return td, err
+}
+
+// TrackerDevice returns the TrackerDevice with the provided ID.
+func (ts *TrackerDeviceService) TrackerDevice(id int64) (*shuttletracker.TrackerDevice, error) {
+	row := ts.db.QueryRow("SELECT "+trackerDeviceColumns+" FROM tracker_devices WHERE id = $1;", id)
+	td, err := scanTrackerDevice(row)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrTrackerDeviceNotFound
+	}
+	return td, err
+}
+
+// TrackerDevices returns the TrackerDevices overlapping the filter, ordered by when they were installed.
+func (ts *TrackerDeviceService) TrackerDevices(filter shuttletracker.HistoryFilter) ([]*shuttletracker.TrackerDevice, error) {
+	query := "SELECT " + trackerDeviceColumns + " FROM tracker_devices" +
+		" WHERE start_time <= $2 AND (end_time IS NULL OR end_time > $1)" +
+		" AND ($3::integer IS NULL OR vehicle_id = $3)" +
+		" AND ($4::integer IS NULL OR vehicle_id IN (SELECT id FROM vehicles WHERE group_id = $4))" +
+		" ORDER BY start_time, id;"
+	rows, err := ts.db.Query(query, filter.Since, filter.Until, filter.VehicleID, filter.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	devices := []*shuttletracker.TrackerDevice{}
+	for rows.Next() {
+		td, err := scanTrackerDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, td)
+	}
+	return devices, rows.Err()
+}
+
+// CreateTrackerDevice creates a TrackerDevice and attributes the tracker's
+// stored Locations accordingly.
+func (ts *TrackerDeviceService) CreateTrackerDevice(td *shuttletracker.TrackerDevice) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement := "INSERT INTO tracker_devices (tracker_id, vehicle_id, notes, priority, start_time, end_time)" +
+		" VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created, updated;"
+	row := tx.QueryRow(statement, td.TrackerID, td.VehicleID, td.Notes, td.Priority, td.Start, td.End)
+	if err = row.Scan(&td.ID, &td.Created, &td.Updated); err != nil {
+		return err
+	}
+	if err = reattributeLocations(tx, td.TrackerID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	ts.locationCache.invalidate()
+	return nil
+}
+
+// ModifyTrackerDevice updates a TrackerDevice and attributes the stored
+// Locations of its tracker, and of its previous tracker if that changed,
+// accordingly.
+func (ts *TrackerDeviceService) ModifyTrackerDevice(td *shuttletracker.TrackerDevice) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previousTrackerID string
+	err = tx.QueryRow("SELECT tracker_id FROM tracker_devices WHERE id = $1 FOR UPDATE;", td.ID).Scan(&previousTrackerID)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrTrackerDeviceNotFound
+	} else if err != nil {
+		return err
+	}
+
+	statement := "UPDATE tracker_devices SET tracker_id = $1, vehicle_id = $2, notes = $3, priority = $4," +
+		" start_time = $5, end_time = $6, updated = now() WHERE id = $7 RETURNING created, updated;"
+	row := tx.QueryRow(statement, td.TrackerID, td.VehicleID, td.Notes, td.Priority, td.Start, td.End, td.ID)
+	if err = row.Scan(&td.Created, &td.Updated); err != nil {
+		return err
+	}
+	if err = reattributeLocations(tx, td.TrackerID); err != nil {
+		return err
+	}
+	if previousTrackerID != td.TrackerID {
+		if err = reattributeLocations(tx, previousTrackerID); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	ts.locationCache.invalidate()
+	return nil
+}
+
+// DeleteTrackerDevice deletes a TrackerDevice and attributes the tracker's
+// stored Locations accordingly.
+func (ts *TrackerDeviceService) DeleteTrackerDevice(id int64) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var trackerID string
+	err = tx.QueryRow("DELETE FROM tracker_devices WHERE id = $1 RETURNING tracker_id;", id).Scan(&trackerID)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrTrackerDeviceNotFound
+	} else if err != nil {
+		return err
+	}
+	if err = reattributeLocations(tx, trackerID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	ts.locationCache.invalidate()
+	return nil
+}
+
+// reattributeLocations sets the Vehicle of each of a tracker's stored
+// Locations to the one it was installed in at the time, since TrackerDevices
+// are often recorded after hardware has already been swapped.
+func reattributeLocations(tx *sql.Tx, trackerID string) error {
+	statement := "UPDATE locations SET vehicle_id = tracker_vehicle(tracker_id, time)" +
+		" WHERE tracker_id = $1 AND vehicle_id IS DISTINCT FROM tracker_vehicle(tracker_id, time);"
+	_, err := tx.Exec(statement, trackerID)
+	return err
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestTrackerDeviceSwap(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	first := &shuttletracker.Vehicle{Name: "Shuttle 1", TrackerID: "100"}
+	second := &shuttletracker.Vehicle{Name: "Shuttle 2", TrackerID: "200"}
+	for _, v := range []*shuttletracker.Vehicle{first, second} {
+		if err := pg.CreateVehicle(v); err != nil {
+			t.Fatalf("unable to create Vehicle: %s", err)
+		}
+	}
+
+	// Tracker 100 is in the first shuttle until it's moved to the second one.
+	swap := time.Now().Add(-time.Hour)
+	before := &shuttletracker.Location{TrackerID: "100", Time: swap.Add(-time.Minute)}
+	after := &shuttletracker.Location{TrackerID: "100", Time: swap.Add(time.Minute)}
+	for _, l := range []*shuttletracker.Location{before, after} {
+		if err := pg.CreateLocation(l); err != nil {
+			t.Fatalf("unable to create Location: %s", err)
+		}
+		if l.VehicleID == nil || *l.VehicleID != first.ID {
+			t.Errorf("got vehicle %v before the swap was recorded, expected %d", l.VehicleID, first.ID)
+		}
+	}
+
+	installed := &shuttletracker.TrackerDevice{TrackerID: "100", VehicleID: first.ID, Start: swap.AddDate(0, 0, -1), End: &swap}
+	moved := &shuttletracker.TrackerDevice{TrackerID: "100", VehicleID: second.ID, Start: swap}
+	for _, td := range []*shuttletracker.TrackerDevice{installed, moved} {
+		if err := pg.CreateTrackerDevice(td); err != nil {
+			t.Fatalf("unable to create TrackerDevice: %s", err)
+		}
+	}
+
+	for l, expected := range map[*shuttletracker.Location]int64{before: first.ID, after: second.ID} {
+		actual, err := pg.Location(l.ID)
+		if err != nil {
+			t.Fatalf("unable to get Location: %s", err)
+		}
+		if actual.VehicleID == nil || *actual.VehicleID != expected {
+			t.Errorf("got vehicle %v for location at %s, expected %d", actual.VehicleID, l.Time, expected)
+		}
+	}
+
+	vehicle, err := pg.VehicleWithTrackerID("100")
+	if err != nil {
+		t.Fatalf("unable to get Vehicle: %s", err)
+	}
+	if vehicle.ID != second.ID {
+		t.Errorf("got vehicle %d with tracker 100, expected %d", vehicle.ID, second.ID)
+	}
+
+	devices, err := pg.TrackerDevices(shuttletracker.HistoryFilter{Since: swap, Until: swap, VehicleID: &second.ID})
+	if err != nil {
+		t.Fatalf("unable to get TrackerDevices: %s", err)
+	}
+	if len(devices) != 1 || devices[0].ID != moved.ID {
+		t.Errorf("got %+v, expected only tracker device %d", devices, moved.ID)
+	}
+
+	if err = pg.DeleteTrackerDevice(moved.ID); err != nil {
+		t.Fatalf("unable to delete TrackerDevice: %s", err)
+	}
+	actual, err := pg.Location(after.ID)
+	if err != shuttletracker.ErrLocationNotFound {
+		t.Errorf("got %+v and error %v, expected the location to belong to no vehicle", actual, err)
+	}
+	if err = pg.DeleteTrackerDevice(moved.ID); err != shuttletracker.ErrTrackerDeviceNotFound {
+		t.Errorf("got error %v, expected ErrTrackerDeviceNotFound", err)
+	}
+}
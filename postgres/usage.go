@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Kinds of counts in the usage_counts table.
+const (
+	usageEndpoint = "endpoint"
+	usageTopic    = "topic"
+)
+
+// UsageService implements shuttletracker.UsageService.
+type UsageService struct {
+	db *sql.DB
+}
+
+func (us *UsageService) initializeSchema(db *sql.DB) error {
+	us.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS usage_counts (
+	day date NOT NULL,
+	kind text NOT NULL,
+	name text NOT NULL,
+	count bigint NOT NULL,
+	PRIMARY KEY (day, kind, name)
+);
+CREATE TABLE IF NOT EXISTS usage_clients (
+	day date NOT NULL,
+	client text NOT NULL,
+	PRIMARY KEY (day, client)
+);`
+	_, err := us.db.Exec(schema)
+	return err
+}
+
+// RecordUsage adds usage to the totals for its day in a single transaction.
+// Clients that were already counted on that day, possibly by another
+// instance, aren't counted again.
+func (us *UsageService) RecordUsage(usage *shuttletracker.Usage) error {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "INSERT INTO usage_counts (day, kind, name, count) VALUES ($1, $2, $3, $4)" +
+		" ON CONFLICT (day, kind, name) DO UPDATE SET count = usage_counts.count + excluded.count;"
+	for kind, counts := range map[string]map[string]int64{usageEndpoint: usage.Endpoints, usageTopic: usage.Topics} {
+		for name, count := range counts {
+			if _, err = tx.Exec(statement, usage.Day, kind, name, count); err != nil {
+				return err
+			}
+		}
+	}
+
+	statement = "INSERT INTO usage_clients (day, client) VALUES ($1, $2) ON CONFLICT DO NOTHING;"
+	for _, client := range usage.Clients {
+		if _, err = tx.Exec(statement, usage.Day, client); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Usage returns usage for each day since a time, oldest first.
+func (us *UsageService) Usage(since time.Time) ([]*shuttletracker.DailyUsage, error) {
+	days := map[time.Time]*shuttletracker.DailyUsage{}
+	usage := []*shuttletracker.DailyUsage{}
+	day := func(d time.Time) *shuttletracker.DailyUsage {
+		if du, ok := days[d]; ok {
+			return du
+		}
+		du := &shuttletracker.DailyUsage{
+			Day:       d,
+			Endpoints: map[string]int64{},
+			Topics:    map[string]int64{},
+		}
+		days[d] = du
+		usage = append(usage, du)
+		return du
+	}
+
+	query := "SELECT day, kind, name, count FROM usage_counts WHERE day >= $1::date ORDER BY day;"
+	rows, err := us.db.Query(query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d time.Time
+		var kind, name string
+		var count int64
+		if err := rows.Scan(&d, &kind, &name, &count); err != nil {
+			return nil, err
+		}
+		switch kind {
+		case usageEndpoint:
+			day(d).Endpoints[name] = count
+		case usageTopic:
+			day(d).Topics[name] = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = "SELECT day, count(*) FROM usage_clients WHERE day >= $1::date GROUP BY day ORDER BY day;"
+	rows, err = us.db.Query(query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d time.Time
+		var count int64
+		if err := rows.Scan(&d, &count); err != nil {
+			return nil, err
+		}
+		day(d).Clients = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Day.Before(usage[j].Day)
+	})
+	return usage, nil
+}
@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestRecordUsage(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	day := time.Date(2018, time.April, 16, 0, 0, 0, 0, time.UTC)
+	for _, usage := range []*shuttletracker.Usage{
+		{Day: day, Endpoints: map[string]int64{"GET /vehicles/": 3}, Topics: map[string]int64{"eta": 1}, Clients: []string{"a", "b"}},
+		{Day: day, Endpoints: map[string]int64{"GET /vehicles/": 2}, Clients: []string{"b", "c"}},
+	} {
+		if err := pg.RecordUsage(usage); err != nil {
+			t.Fatalf("unable to record usage: %s", err)
+		}
+	}
+
+	usage, err := pg.Usage(day)
+	if err != nil {
+		t.Fatalf("unable to get usage: %s", err)
+	}
+	if len(usage) != 1 {
+		t.Fatalf("got %d days, expected 1", len(usage))
+	}
+	if usage[0].Endpoints["GET /vehicles/"] != 5 || usage[0].Topics["eta"] != 1 || usage[0].Clients != 3 {
+		t.Errorf("got %+v", usage[0])
+	}
+}
@@ -24,7 +24,7 @@ func setUpPostgres(t *testing.T) *Postgres {
 		t.Fatalf("database is not empty")
 	}
 
-	pg, err := New(Config{URL: url})
+	pg, err := New(Config{URL: url, SlowQueryThreshold: "500ms"})
 	if err != nil {
 		t.Fatalf("unable to create Postgres: %s", err)
 	}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 
 	// Postgres driver for database/sql
@@ -12,6 +13,11 @@ import (
 // VehicleService implements shuttletracker.VehicleService.
 type VehicleService struct {
 	db *sql.DB
+
+	// locationCache is invalidated when Vehicles change, since that can change
+	// which Vehicle a tracker's Locations belong to. Changes made by other
+	// instances are handled by Postgres.run.
+	locationCache *latestLocationCache
 }
 
 func (v *VehicleService) initializeSchema(db *sql.DB) error {
@@ -26,6 +32,25 @@ CREATE TABLE IF NOT EXISTS vehicles (
 	enabled boolean NOT NULL,
 	tracker_id varchar(10) UNIQUE
 );
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS capacity integer NOT NULL DEFAULT 0;
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS wheelchair_accessible boolean NOT NULL DEFAULT false;
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS make text NOT NULL DEFAULT '';
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS model text NOT NULL DEFAULT '';
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS license_plate text NOT NULL DEFAULT '';
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS color varchar(9) NOT NULL DEFAULT '';
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS label text NOT NULL DEFAULT '';
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS icon text NOT NULL DEFAULT '';
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS group_id integer REFERENCES vehicle_groups ON DELETE SET NULL;
+
+-- notify clients when vehicles change so that caches can be invalidated
+CREATE OR REPLACE FUNCTION vehicles_change_notify() RETURNS trigger AS $$
+BEGIN
+        PERFORM pg_notify('vehicles.change', '');
+        RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS vehicles_change on vehicles;
+CREATE TRIGGER vehicles_change AFTER INSERT OR UPDATE OR DELETE ON vehicles FOR EACH STATEMENT EXECUTE PROCEDURE vehicles_change_notify();
     `
 	_, err := v.db.Exec(schema)
 	return err
@@ -33,11 +58,18 @@ CREATE TABLE IF NOT EXISTS vehicles (
 
 // CreateVehicle creates a Vehicle.
 func (v *VehicleService) CreateVehicle(vehicle *shuttletracker.Vehicle) error {
-	statement := "INSERT INTO vehicles (name, enabled, tracker_id) " +
-		"VALUES ($1, $2, $3) RETURNING id, created, updated;"
-	row := v.db.QueryRow(statement, vehicle.Name, vehicle.Enabled, vehicle.TrackerID)
+	statement := "INSERT INTO vehicles (name, enabled, tracker_id, capacity, wheelchair_accessible, make, model, " +
+		"license_plate, color, label, icon, group_id) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id, created, updated;"
+	row := v.db.QueryRow(statement, vehicle.Name, vehicle.Enabled, vehicle.TrackerID, vehicle.Capacity,
+		vehicle.WheelchairAccessible, vehicle.Make, vehicle.Model, vehicle.LicensePlate, vehicle.Color,
+		vehicle.Label, vehicle.Icon, vehicle.GroupID)
 	err := row.Scan(&vehicle.ID, &vehicle.Created, &vehicle.Updated)
-	return err
+	if err != nil {
+		return err
+	}
+	v.locationCache.invalidate()
+	return nil
 }
 
 // DeleteVehicle deletes a Vehicle by its ID.
@@ -55,22 +87,17 @@ func (v *VehicleService) DeleteVehicle(id int64) error {
 	if n == 0 {
 		return shuttletracker.ErrVehicleNotFound
 	}
+	v.locationCache.invalidate()
 
 	return nil
 }
 
 // Vehicle returns a Vehicle by its ID.
 func (v *VehicleService) Vehicle(id int64) (*shuttletracker.Vehicle, error) {
-	vehicle := &shuttletracker.Vehicle{
-		ID: id,
-	}
-
-	statement := "SELECT name, created, updated, enabled, tracker_id " +
-		"FROM vehicles WHERE id = $1;"
-	row := v.db.QueryRow(statement, id)
-	err := row.Scan(&vehicle.Name, &vehicle.Created, &vehicle.Updated, &vehicle.Enabled, &vehicle.TrackerID)
+	statement := "SELECT " + vehicleColumns + " FROM vehicles WHERE id = $1;"
+	vehicle, err := scanVehicle(v.db.QueryRow(statement, id))
 	if err == sql.ErrNoRows {
-		return vehicle, shuttletracker.ErrVehicleNotFound
+		return &shuttletracker.Vehicle{ID: id}, shuttletracker.ErrVehicleNotFound
 	}
 
 	return vehicle, err
@@ -78,17 +105,21 @@ func (v *VehicleService) Vehicle(id int64) (*shuttletracker.Vehicle, error) {
 
 // Vehicles returns all Vehicles.
 func (v *VehicleService) Vehicles() ([]*shuttletracker.Vehicle, error) {
+	return v.VehiclesContext(context.Background())
+}
+
+// VehiclesContext is Vehicles as part of ctx's trace.
+func (v *VehicleService) VehiclesContext(ctx context.Context) ([]*shuttletracker.Vehicle, error) {
 	var vehicles []*shuttletracker.Vehicle
 
-	statement := "SELECT id, name, created, updated, enabled, tracker_id FROM vehicles;"
-	rows, err := v.db.Query(statement)
+	statement := "SELECT " + vehicleColumns + " FROM vehicles;"
+	rows, err := v.db.QueryContext(ctx, statement)
 	if err != nil {
 		return vehicles, err
 	}
 
 	for rows.Next() {
-		vehicle := &shuttletracker.Vehicle{}
-		err := rows.Scan(&vehicle.ID, &vehicle.Name, &vehicle.Created, &vehicle.Updated, &vehicle.Enabled, &vehicle.TrackerID)
+		vehicle, err := scanVehicle(rows)
 		if err != nil {
 			return vehicles, err
 		}
@@ -100,20 +131,21 @@ func (v *VehicleService) Vehicles() ([]*shuttletracker.Vehicle, error) {
 
 // EnabledVehicles returns all Vehicles that are enabled.
 func (v *VehicleService) EnabledVehicles() ([]*shuttletracker.Vehicle, error) {
+	return v.EnabledVehiclesContext(context.Background())
+}
+
+// EnabledVehiclesContext is EnabledVehicles as part of ctx's trace.
+func (v *VehicleService) EnabledVehiclesContext(ctx context.Context) ([]*shuttletracker.Vehicle, error) {
 	var vehicles []*shuttletracker.Vehicle
 
-	statement := "SELECT id, name, created, updated, tracker_id " +
-		"FROM vehicles WHERE enabled = true;"
-	rows, err := v.db.Query(statement)
+	statement := "SELECT " + vehicleColumns + " FROM vehicles WHERE enabled = true;"
+	rows, err := v.db.QueryContext(ctx, statement)
 	if err != nil {
 		return vehicles, err
 	}
 
 	for rows.Next() {
-		vehicle := &shuttletracker.Vehicle{
-			Enabled: true,
-		}
-		err := rows.Scan(&vehicle.ID, &vehicle.Name, &vehicle.Created, &vehicle.Updated, &vehicle.TrackerID)
+		vehicle, err := scanVehicle(rows)
 		if err != nil {
 			return vehicles, err
 		}
@@ -125,25 +157,58 @@ func (v *VehicleService) EnabledVehicles() ([]*shuttletracker.Vehicle, error) {
 
 // ModifyVehicle updates a Vehicle by its ID.
 func (v *VehicleService) ModifyVehicle(vehicle *shuttletracker.Vehicle) error {
-	statement := "UPDATE vehicles SET name = $1, enabled = $2, tracker_id = $3, updated = now() " +
-		"WHERE id = $4 RETURNING updated;"
-	row := v.db.QueryRow(statement, vehicle.Name, vehicle.Enabled, vehicle.TrackerID, vehicle.ID)
+	statement := "UPDATE vehicles SET name = $1, enabled = $2, tracker_id = $3, capacity = $4, " +
+		"wheelchair_accessible = $5, make = $6, model = $7, license_plate = $8, color = $9, label = $10, " +
+		"icon = $11, group_id = $12, updated = now() WHERE id = $13 RETURNING updated;"
+	row := v.db.QueryRow(statement, vehicle.Name, vehicle.Enabled, vehicle.TrackerID, vehicle.Capacity,
+		vehicle.WheelchairAccessible, vehicle.Make, vehicle.Model, vehicle.LicensePlate, vehicle.Color,
+		vehicle.Label, vehicle.Icon, vehicle.GroupID, vehicle.ID)
 	err := row.Scan(&vehicle.Updated)
-	return err
+	if err != nil {
+		return err
+	}
+	v.locationCache.invalidate()
+	return nil
 }
 
-// VehicleWithTrackerID returns the Vehicle with the specified tracker ID.
+// VehicleWithTrackerID returns the Vehicle that the tracker with the specified
+// ID is installed in.
 func (v *VehicleService) VehicleWithTrackerID(id string) (*shuttletracker.Vehicle, error) {
-	vehicle := &shuttletracker.Vehicle{
-		TrackerID: id,
+	statement := "SELECT " + vehicleColumns + " FROM vehicles WHERE id = tracker_vehicle($1, now());"
+	vehicle, err := scanVehicle(v.db.QueryRow(statement, id))
+	if err == sql.ErrNoRows {
+		return &shuttletracker.Vehicle{TrackerID: id}, shuttletracker.ErrVehicleNotFound
+	}
+
+	return vehicle, err
+}
+
+// VehicleWithLicensePlate returns the Vehicle with the specified license
+// plate, ignoring case, spaces, and dashes.
+func (v *VehicleService) VehicleWithLicensePlate(plate string) (*shuttletracker.Vehicle, error) {
+	plate = shuttletracker.NormalizeLicensePlate(plate)
+	if plate == "" {
+		return nil, shuttletracker.ErrVehicleNotFound
 	}
-	statement := "SELECT id, name, created, updated, enabled " +
-		"FROM vehicles WHERE tracker_id = $1;"
-	row := v.db.QueryRow(statement, id)
-	err := row.Scan(&vehicle.ID, &vehicle.Name, &vehicle.Created, &vehicle.Updated, &vehicle.Enabled)
+	statement := "SELECT " + vehicleColumns + " FROM vehicles " +
+		"WHERE upper(translate(license_plate, ' -', '')) = $1 LIMIT 1;"
+	vehicle, err := scanVehicle(v.db.QueryRow(statement, plate))
 	if err == sql.ErrNoRows {
-		return vehicle, shuttletracker.ErrVehicleNotFound
+		return nil, shuttletracker.ErrVehicleNotFound
 	}
 
 	return vehicle, err
 }
+
+const vehicleColumns = "id, name, created, updated, enabled, tracker_id, capacity, " +
+	"wheelchair_accessible, make, model, license_plate, color, label, icon, group_id"
+
+// scanVehicle scans a row of vehicleColumns.
+func scanVehicle(row interface{ Scan(...interface{}) error }) (*shuttletracker.Vehicle, error) {
+	vehicle := &shuttletracker.Vehicle{}
+	err := row.Scan(&vehicle.ID, &vehicle.Name, &vehicle.Created, &vehicle.Updated, &vehicle.Enabled,
+		&vehicle.TrackerID, &vehicle.Capacity, &vehicle.WheelchairAccessible, &vehicle.Make,
+		&vehicle.Model, &vehicle.LicensePlate, &vehicle.Color, &vehicle.Label, &vehicle.Icon,
+		&vehicle.GroupID)
+	return vehicle, err
+}
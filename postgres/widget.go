@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// WidgetKeyService implements shuttletracker.WidgetKeyService.
+type WidgetKeyService struct {
+	db *sql.DB
+}
+
+func (wks *WidgetKeyService) initializeSchema(db *sql.DB) error {
+	wks.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS widget_keys (
+	id serial PRIMARY KEY,
+	key text UNIQUE NOT NULL,
+	name text NOT NULL,
+	domains text[] NOT NULL,
+	created timestamp with time zone NOT NULL DEFAULT now()
+);`
+	_, err := wks.db.Exec(schema)
+	return err
+}
+
+// WidgetKeys returns all WidgetKeys in order of ID.
+func (wks *WidgetKeyService) WidgetKeys() ([]*shuttletracker.WidgetKey, error) {
+	keys := []*shuttletracker.WidgetKey{}
+	query := "SELECT wk.id, wk.key, wk.name, wk.domains, wk.created FROM widget_keys wk ORDER BY wk.id;"
+	rows, err := wks.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		k := &shuttletracker.WidgetKey{}
+		if err := rows.Scan(&k.ID, &k.Key, &k.Name, pq.Array(&k.Domains), &k.Created); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// CreateWidgetKey creates a WidgetKey.
+func (wks *WidgetKeyService) CreateWidgetKey(key *shuttletracker.WidgetKey) error {
+	statement := "INSERT INTO widget_keys (key, name, domains) VALUES ($1, $2, $3) RETURNING id, created;"
+	row := wks.db.QueryRow(statement, key.Key, key.Name, pq.Array(key.Domains))
+	return row.Scan(&key.ID, &key.Created)
+}
+
+// DeleteWidgetKey deletes a WidgetKey.
+func (wks *WidgetKeyService) DeleteWidgetKey(id int64) error {
+	statement := "DELETE FROM widget_keys WHERE id = $1;"
+	result, err := wks.db.Exec(statement, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrWidgetKeyNotFound
+	}
+	return nil
+}
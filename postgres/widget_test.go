@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestWidgetKeys(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	key := &shuttletracker.WidgetKey{Key: "0123456789abcdef", Name: "Registrar", Domains: []string{"rpi.edu", "example.com"}}
+	if err := pg.CreateWidgetKey(key); err != nil {
+		t.Fatalf("unable to create widget key: %s", err)
+	}
+	if key.ID == 0 || key.Created.IsZero() {
+		t.Errorf("ID and created were not set: %+v", key)
+	}
+	if err := pg.CreateWidgetKey(&shuttletracker.WidgetKey{Key: key.Key, Name: "Duplicate", Domains: []string{}}); err == nil {
+		t.Errorf("created a widget key with a duplicate key")
+	}
+
+	keys, err := pg.WidgetKeys()
+	if err != nil {
+		t.Fatalf("unable to get widget keys: %s", err)
+	}
+	if len(keys) != 1 || keys[0].Key != key.Key || len(keys[0].Domains) != 2 || keys[0].Domains[1] != "example.com" {
+		t.Errorf("got %+v", keys)
+	}
+
+	if err := pg.DeleteWidgetKey(key.ID); err != nil {
+		t.Fatalf("unable to delete widget key: %s", err)
+	}
+	if err := pg.DeleteWidgetKey(key.ID); err != shuttletracker.ErrWidgetKeyNotFound {
+		t.Errorf("got %v deleting a deleted widget key", err)
+	}
+}
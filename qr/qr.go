@@ -0,0 +1,237 @@
+// Package qr encodes text as QR codes, like the ones printed on stop signs. It
+// only supports what short links need: byte mode, error correction level M,
+// and versions 1 through 10. We encode by hand so that the server doesn't
+// depend on an imaging library.
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ErrTooLong indicates that text doesn't fit in the largest supported QR code.
+var ErrTooLong = errors.New("text is too long for a QR code")
+
+// QuietZone is how many light modules wide the border around a QR code must be
+// for scanners to find it.
+const QuietZone = 4
+
+// version is the layout of the codewords in a QR code version at error
+// correction level M.
+type version struct {
+	// ecPerBlock is how many error correction codewords each block has.
+	ecPerBlock int
+	// blocks is how many data codewords each block has.
+	blocks []int
+	// alignment is the row and column centers of the alignment patterns.
+	alignment []int
+}
+
+var versions = []version{
+	1:  {10, []int{16}, nil},
+	2:  {16, []int{28}, []int{6, 18}},
+	3:  {26, []int{44}, []int{6, 22}},
+	4:  {18, []int{32, 32}, []int{6, 26}},
+	5:  {24, []int{43, 43}, []int{6, 30}},
+	6:  {16, []int{27, 27, 27, 27}, []int{6, 34}},
+	7:  {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	8:  {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	9:  {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	10: {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+// dataCodewords returns how many data codewords fit in the version.
+func (v version) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// Code is a QR code: a square of dark and light modules.
+type Code struct {
+	// Size is how many modules wide and tall the code is, not counting
+	// the quiet zone.
+	Size int
+
+	modules  [][]bool
+	function [][]bool
+}
+
+// Encode returns the smallest QR code that holds text.
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	for v := 1; v < len(versions); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		capacity := versions[v].dataCodewords()
+		if 4+countBits+8*len(data) > 8*capacity {
+			continue
+		}
+
+		bb := &bitBuffer{}
+		// byte mode
+		bb.append(0x4, 4)
+		bb.append(len(data), countBits)
+		for _, b := range data {
+			bb.append(int(b), 8)
+		}
+		codewords := bb.bytes(capacity)
+
+		c := newCode(v)
+		c.drawCodewords(interleave(versions[v], codewords))
+		c.applyBestMask()
+		return c, nil
+	}
+	return nil, ErrTooLong
+}
+
+// Black returns whether the module in column x and row y is dark. Modules
+// outside of the code, like those in the quiet zone, are light.
+func (c *Code) Black(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// Image returns the code with each module scale pixels wide, surrounded by the
+// quiet zone.
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	width := (c.Size + 2*QuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, width, width))
+	for y := 0; y < width; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(0xff)
+			if c.Black(x/scale-QuietZone, y/scale-QuietZone) {
+				v = 0
+			}
+			img.SetGray(x, y, color.Gray{v})
+		}
+	}
+	return img
+}
+
+// PNG returns Image encoded as a PNG.
+func (c *Code) PNG(scale int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, c.Image(scale)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// bitBuffer accumulates bits, most significant first.
+type bitBuffer struct {
+	bits []bool
+}
+
+func (bb *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		bb.bits = append(bb.bits, value>>uint(i)&1 == 1)
+	}
+}
+
+// bytes terminates and pads the bits to fill capacity codewords.
+func (bb *bitBuffer) bytes(capacity int) []byte {
+	for i := 0; i < 4 && len(bb.bits) < 8*capacity; i++ {
+		bb.bits = append(bb.bits, false)
+	}
+	for len(bb.bits)%8 != 0 {
+		bb.bits = append(bb.bits, false)
+	}
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bb.bits); i += 8 {
+		b := byte(0)
+		for _, bit := range bb.bits[i : i+8] {
+			b <<= 1
+			if bit {
+				b |= 1
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xec); len(codewords) < capacity; pad ^= 0xec ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// interleave splits data codewords into the version's blocks, adds each
+// block's error correction codewords, and interleaves them all.
+func interleave(v version, data []byte) []byte {
+	divisor := rsDivisor(v.ecPerBlock)
+	blocks := make([][]byte, len(v.blocks))
+	ecs := make([][]byte, len(v.blocks))
+	longest := 0
+	for i, n := range v.blocks {
+		blocks[i], data = data[:n], data[n:]
+		ecs[i] = rsRemainder(blocks[i], divisor)
+		if n > longest {
+			longest = n
+		}
+	}
+
+	result := []byte{}
+	for i := 0; i < longest; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, ec := range ecs {
+			result = append(result, ec[i])
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>uint(i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of a degree, highest
+// coefficient first and without the leading 1.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the Reed-Solomon error correction codewords for data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
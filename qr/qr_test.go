@@ -0,0 +1,234 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" as version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if ec := rsRemainder(data, rsDivisor(10)); !bytes.Equal(ec, expected) {
+		t.Errorf("got %v, expected %v", ec, expected)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	expected := map[int]string{
+		0: "101010000010010",
+		1: "101000100100101",
+		5: "100000011001110",
+		7: "100101010100000",
+	}
+	for mask, bits := range expected {
+		c := newCode(1)
+		c.drawFormat(mask)
+		if got := c.readFormat(); got != bits {
+			t.Errorf("mask %d: got %s, expected %s", mask, got, bits)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	expected := map[int]int{
+		7:  0x07c94,
+		8:  0x085bc,
+		9:  0x09a99,
+		10: 0x0a4d3,
+	}
+	for v, bits := range expected {
+		if got := versionBits(v); got != bits {
+			t.Errorf("version %d: got %#x, expected %#x", v, got, bits)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		size int
+	}{
+		{"https://shuttles.rpi.edu/s/1", 29},
+		{"https://shuttles.rpi.edu/s/12345", 29},
+		{"https://shuttles.rpi.edu/etas?stop=" + strings.Repeat("1", 80), 45},
+		{strings.Repeat("a", 213), 57},
+	} {
+		c, err := Encode(tc.text)
+		if err != nil {
+			t.Errorf("unable to encode %q: %s", tc.text, err)
+			continue
+		}
+		if c.Size != tc.size {
+			t.Errorf("got size %d for %d bytes, expected %d", c.Size, len(tc.text), tc.size)
+		}
+		text, err := c.decode()
+		if err != nil {
+			t.Errorf("unable to decode %q: %s", tc.text, err)
+		} else if text != tc.text {
+			t.Errorf("got %q, expected %q", text, tc.text)
+		}
+	}
+
+	if _, err := Encode(strings.Repeat("a", 214)); err != ErrTooLong {
+		t.Errorf("got %v, expected ErrTooLong", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	c, err := Encode("https://shuttles.rpi.edu/s/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width := img.Bounds().Dx(); width != (29+2*QuietZone)*4 {
+		t.Errorf("got width %d", width)
+	}
+	// the top left corner of the top left finder pattern
+	if r, _, _, _ := img.At(QuietZone*4, QuietZone*4).RGBA(); r != 0 {
+		t.Errorf("finder pattern isn't dark")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Errorf("quiet zone isn't light")
+	}
+}
+
+// readFormat returns the first copy of the format information, most
+// significant bit first.
+func (c *Code) readFormat() string {
+	positions := [][2]int{}
+	for i := 0; i <= 5; i++ {
+		positions = append(positions, [2]int{8, i})
+	}
+	positions = append(positions, [2]int{8, 7}, [2]int{8, 8}, [2]int{7, 8})
+	for i := 9; i < 15; i++ {
+		positions = append(positions, [2]int{14 - i, 8})
+	}
+	s := ""
+	for i := 14; i >= 0; i-- {
+		if c.modules[positions[i][1]][positions[i][0]] {
+			s += "1"
+		} else {
+			s += "0"
+		}
+	}
+	return s
+}
+
+// decode reads the text back out of the code, checking that every block's
+// error correction codewords are consistent with its data.
+func (c *Code) decode() (string, error) {
+	format := c.readFormat()
+	mask := 0
+	for mask = 0; mask < 8; mask++ {
+		other := newCode(1)
+		other.drawFormat(mask)
+		if other.readFormat() == format {
+			break
+		}
+	}
+	v := (c.Size - 17) / 4
+	d := &Code{Size: c.Size, modules: make([][]bool, c.Size), function: newCode(v).function}
+	for y := range c.modules {
+		d.modules[y] = append([]bool{}, c.modules[y]...)
+	}
+	d.applyMask(mask)
+
+	// read codewords in the order that drawCodewords writes them
+	raw := []byte{}
+	b, n := byte(0), 0
+	for right := d.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < d.Size; vert++ {
+			y := vert
+			if upward {
+				y = d.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if d.function[y][x] {
+					continue
+				}
+				b <<= 1
+				if d.modules[y][x] {
+					b |= 1
+				}
+				if n++; n == 8 {
+					raw = append(raw, b)
+					b, n = 0, 0
+				}
+			}
+		}
+	}
+
+	// deinterleave
+	layout := versions[v]
+	blocks := make([][]byte, len(layout.blocks))
+	i := 0
+	for k := 0; k < layout.blocks[len(layout.blocks)-1]; k++ {
+		for bi, size := range layout.blocks {
+			if k < size {
+				blocks[bi] = append(blocks[bi], raw[i])
+				i++
+			}
+		}
+	}
+	data := []byte{}
+	for k := 0; k < layout.ecPerBlock; k++ {
+		for bi := range blocks {
+			blocks[bi] = append(blocks[bi], raw[i])
+			i++
+		}
+	}
+	for bi, size := range layout.blocks {
+		if !bytes.Equal(rsRemainder(blocks[bi][:size], rsDivisor(layout.ecPerBlock)), blocks[bi][size:]) {
+			return "", errBadBlock
+		}
+		data = append(data, blocks[bi][:size]...)
+	}
+
+	// byte mode header, then the bytes
+	bits := &bitReader{data: data}
+	if bits.read(4) != 4 {
+		return "", errBadBlock
+	}
+	countBits := 8
+	if v >= 10 {
+		countBits = 16
+	}
+	length := bits.read(countBits)
+	text := make([]byte, length)
+	for k := range text {
+		text[k] = byte(bits.read(8))
+	}
+	return string(text), nil
+}
+
+var errBadBlock = errors.New("bad block")
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (br *bitReader) read(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(br.data[br.pos/8]>>uint(7-br.pos%8)&1)
+		br.pos++
+	}
+	return v
+}
@@ -1,6 +1,7 @@
 package shuttletracker
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -19,6 +20,75 @@ type Route struct {
 	Points      []Point       `json:"points"`
 	Active      bool          `json:"active"`
 	Schedule    RouteSchedule `json:"schedule"`
+
+	// Label is a short name for the route, like "E", and Icon names an
+	// icon to show next to it.
+	Label string `json:"label"`
+	Icon  string `json:"icon"`
+
+	// ZIndex orders Routes that overlap on the map; higher ones are drawn
+	// on top. DashPattern is an SVG dash array, like "10 5", for drawing
+	// the Route as a dashed line, or empty for a solid one.
+	ZIndex      int64  `json:"z_index"`
+	DashPattern string `json:"dash_pattern"`
+
+	// Segments split a Route that has distinct inbound and outbound legs
+	// into directions. A Route without Segments has no direction.
+	Segments []RouteSegment `json:"segments"`
+
+	// DetourID is set while a Detour is in effect, when Points include it.
+	// Points aren't saved when a Route with a DetourID is modified, so that
+	// the Detour doesn't outlast its End.
+	DetourID *int64 `json:"detour_id"`
+
+	// Visibility lists when the Route is shown to the public, independent
+	// of when it's active. A Route without any intervals is always shown.
+	Visibility RouteSchedule `json:"visibility"`
+}
+
+// VisibleAt returns whether the Route is shown to the public at t. Like
+// route_is_active in Postgres, each interval's days and times are in the week
+// containing t, and intervals don't wrap around the end of the week.
+func (r *Route) VisibleAt(t time.Time) bool {
+	if len(r.Visibility) == 0 {
+		return true
+	}
+	t = t.In(time.Local)
+	y, m, d := t.Date()
+	week := time.Date(y, m, d-int(t.Weekday()), 0, 0, 0, 0, time.Local)
+	at := func(weekday time.Weekday, clock time.Time) time.Time {
+		h, min, s := clock.Clock()
+		return time.Date(week.Year(), week.Month(), week.Day()+int(weekday), h, min, s, 0, time.Local)
+	}
+	for _, interval := range r.Visibility {
+		if !t.Before(at(interval.StartDay, interval.StartTime)) && !t.After(at(interval.EndDay, interval.EndTime)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteSegment is a leg of a Route that its vehicles travel in one direction,
+// like inbound, serving the stops on that side of the road. A Route's Segments
+// list its StopIDs in order, each Segment continuing where the previous one
+// left off, so that a stop visited in both directions belongs to whichever leg
+// it's visited on.
+type RouteSegment struct {
+	DirectionID int64   `json:"direction_id"`
+	Name        string  `json:"name"`
+	StopIDs     []int64 `json:"stop_ids"`
+}
+
+// SegmentAt returns the Segment that the Route's stop at index i in StopIDs
+// belongs to, or nil if the Route has no Segments.
+func (r *Route) SegmentAt(i int) *RouteSegment {
+	for j := range r.Segments {
+		if i < len(r.Segments[j].StopIDs) {
+			return &r.Segments[j]
+		}
+		i -= len(r.Segments[j].StopIDs)
+	}
+	return nil
 }
 
 // RouteActiveInterval represents a time interval during which a Route is active.
@@ -44,9 +114,20 @@ type Point struct {
 type RouteService interface {
 	Route(id int64) (*Route, error)
 	Routes() ([]*Route, error)
+	// RoutesContext makes its queries part of ctx's trace.
+	RoutesContext(ctx context.Context) ([]*Route, error)
 	CreateRoute(route *Route) error
 	DeleteRoute(id int64) error
 	ModifyRoute(route *Route) error
+
+	// ModifyRouteStops replaces a Route's StopIDs and Segments at once,
+	// leaving the rest of the Route alone.
+	ModifyRouteStops(route *Route) error
+
+	// ImportRoutes creates Stops and Routes all at once. If any of them
+	// can't be created, none are. Stops can be given negative IDs so that
+	// the Routes can refer to them; they get real IDs when they're created.
+	ImportRoutes(stops []*Stop, routes []*Route) error
 }
 
 // ErrRouteNotFound indicates that a Route is not in the service.
@@ -0,0 +1,126 @@
+package shuttletracker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is the planned service of a Route: Trips that run on certain days
+// of the week. Unlike a RouteSchedule, which only says when a Route is
+// active, a Schedule says when vehicles should be at each Stop.
+type Schedule struct {
+	ID      int64          `json:"id"`
+	RouteID int64          `json:"route_id"`
+	Name    string         `json:"name"`
+	Days    []time.Weekday `json:"days"`
+	Trips   []*Trip        `json:"trips"`
+	Created time.Time      `json:"created"`
+	Updated time.Time      `json:"updated"`
+}
+
+// RunsOn returns whether the Schedule runs on day's day of the week.
+func (s *Schedule) RunsOn(day time.Time) bool {
+	for _, d := range s.Days {
+		if d == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// Trip is one run of a vehicle through some of a Route's Stops.
+type Trip struct {
+	ID         int64  `json:"id"`
+	ScheduleID int64  `json:"schedule_id"`
+	Direction  string `json:"direction"`
+
+	// StopTimes are in the order that the Stops are visited.
+	StopTimes []StopTime `json:"stop_times"`
+}
+
+// StopTime is when a Trip is planned to arrive at and depart from a Stop.
+type StopTime struct {
+	StopID    int64     `json:"stop_id"`
+	Arrival   TimeOfDay `json:"arrival"`
+	Departure TimeOfDay `json:"departure"`
+}
+
+// TimeOfDay is a time after midnight on the day that a Trip starts. Like
+// times in GTFS, it can be 24 hours or more for Trips that run past
+// midnight. It's encoded in JSON as a string like "08:15:00".
+type TimeOfDay time.Duration
+
+// ParseTimeOfDay parses a time like "08:15" or "25:10:30".
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) == 2 {
+		parts = append(parts, "0")
+	}
+	var fields [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if len(parts) != 3 || err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a time like \"08:15\"", s)
+		}
+		fields[i] = n
+	}
+	h, m, sec := fields[0], fields[1], fields[2]
+	if m > 59 || sec > 59 {
+		return 0, fmt.Errorf("%q is not a time like \"08:15\"", s)
+	}
+	return TimeOfDay(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second), nil
+}
+
+func (t TimeOfDay) String() string {
+	d := time.Duration(t)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// On returns the TimeOfDay on day's date, in day's time zone.
+func (t TimeOfDay) On(day time.Time) time.Time {
+	// Use the clock time rather than adding a duration to midnight, which
+	// would be off by an hour on days when daylight saving time changes.
+	d := time.Duration(t)
+	days := int(d / (24 * time.Hour))
+	h, m, s := int(d.Hours())%24, int(d.Minutes())%60, int(d.Seconds())%60
+	return time.Date(day.Year(), day.Month(), day.Day()+days, h, m, s, 0, day.Location())
+}
+
+// MarshalJSON encodes the TimeOfDay as a string.
+func (t TimeOfDay) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON decodes a TimeOfDay from a string.
+func (t *TimeOfDay) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseTimeOfDay(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// ScheduleService is an interface for interacting with Schedules.
+type ScheduleService interface {
+	Schedule(id int64) (*Schedule, error)
+	Schedules() ([]*Schedule, error)
+	CreateSchedule(schedule *Schedule) error
+	ModifySchedule(schedule *Schedule) error
+	DeleteSchedule(id int64) error
+
+	// ReplaceSchedules creates the Schedules without an ID and replaces
+	// those with one, all at once. If any of them fail, none are changed.
+	ReplaceSchedules(schedules []*Schedule) error
+}
+
+// ErrScheduleNotFound indicates that a Schedule is not in the service.
+var ErrScheduleNotFound = errors.New("Schedule not found")
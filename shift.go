@@ -0,0 +1,46 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// Shift is a period when an operator was assigned to drive a Vehicle. Along
+// with the Vehicle's Locations, it says who was driving where and when.
+type Shift struct {
+	ID        int64  `json:"id"`
+	Operator  string `json:"operator"`
+	VehicleID int64  `json:"vehicle_id"`
+	Notes     string `json:"notes"`
+
+	Start time.Time `json:"start"`
+	// End is nil while the Shift is ongoing.
+	End *time.Time `json:"end"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Overlaps returns whether any of the Shift is from since (inclusive) until
+// until (exclusive).
+func (s *Shift) Overlaps(since, until time.Time) bool {
+	return s.Start.Before(until) && (s.End == nil || s.End.After(since))
+}
+
+// ShiftService is an interface for interacting with Shifts.
+type ShiftService interface {
+	Shift(id int64) (*Shift, error)
+
+	// Shifts returns the Shifts that were ongoing at any time from the
+	// filter's Since until its Until, inclusive, for its Vehicle if it has
+	// one, earliest first. Since and Until can be the same time to find who
+	// was driving at that moment.
+	Shifts(filter HistoryFilter) ([]*Shift, error)
+
+	CreateShift(shift *Shift) error
+	ModifyShift(shift *Shift) error
+	DeleteShift(id int64) error
+}
+
+// ErrShiftNotFound indicates that a Shift is not in the service.
+var ErrShiftNotFound = errors.New("Shift not found")
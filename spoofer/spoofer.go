@@ -25,6 +25,7 @@ type Spoofer struct {
 	mutex         *sync.Mutex
 	sm            *sync.Mutex
 	subscribers   []func(*shuttletracker.Location)
+	stop          chan struct{}
 }
 
 // Configuration for Spoofer; determines whether or not spoofed updates will be created and the interval
@@ -42,6 +43,7 @@ func New(cfg Config, ms shuttletracker.ModelService) (*Spoofer, error) {
 		mutex:       &sync.Mutex{},
 		sm:          &sync.Mutex{},
 		subscribers: []func(*shuttletracker.Location){},
+		stop:        make(chan struct{}),
 	}
 
 	interval, err := time.ParseDuration(cfg.SpoofInterval)
@@ -85,7 +87,8 @@ func BackupConfig(v *viper.Viper) *Config {
 func (s *Spoofer) Run() {
 	if s.SpoofUpdates {
 		log.Debug("Spoofer started.")
-		ticker := time.Tick(s.spoofInterval)
+		ticker := time.NewTicker(s.spoofInterval)
+		defer ticker.Stop()
 
 		// Parse all update data
 		s.parseUpdates()
@@ -93,13 +96,23 @@ func (s *Spoofer) Run() {
 		// Do one initial spoof
 		s.spoof()
 
-		// Spoof updates for each vehicle every spoofInterval
-		for range ticker {
-			s.spoof()
+		// Spoof updates for each vehicle every spoofInterval until stopped
+		for {
+			select {
+			case <-ticker.C:
+				s.spoof()
+			case <-s.stop:
+				return
+			}
 		}
 	}
 }
 
+// Stop makes Run return after the current spoofed update.
+func (s *Spoofer) Stop() {
+	close(s.stop)
+}
+
 // Sequentially reads and caches all JSON data to create updates from
 func (s *Spoofer) parseUpdates() {
 	wd, err := os.Getwd()
@@ -0,0 +1,10 @@
+package shuttletracker
+
+import (
+	"net/http"
+)
+
+// StaticFiles is the built frontend, if it was embedded in the binary by
+// building with the embedstatic tag after building the frontend. Otherwise
+// it's nil and the frontend is served from the static directory.
+var StaticFiles http.FileSystem
@@ -0,0 +1,21 @@
+//go:build embedstatic
+// +build embedstatic
+
+package shuttletracker
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+func init() {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	StaticFiles = http.FS(sub)
+}
@@ -16,6 +16,15 @@ type Stop struct {
 	// Name and Description are pointers because they may be nil.
 	Name        *string `json:"name"`
 	Description *string `json:"description"`
+
+	// Shelter, Lighting, Bench, and WheelchairAccessible describe what riders
+	// can expect while waiting at the Stop, and PhotoURL links to a picture
+	// of it if there is one.
+	Shelter              bool   `json:"shelter"`
+	Lighting             bool   `json:"lighting"`
+	Bench                bool   `json:"bench"`
+	WheelchairAccessible bool   `json:"wheelchair_accessible"`
+	PhotoURL             string `json:"photo_url"`
 }
 
 // StopService is an interface for interacting with Stops.
@@ -24,7 +33,13 @@ type StopService interface {
 	Stops() ([]*Stop, error)
 	CreateStop(stop *Stop) error
 	CreateStopWithID(stop *Stop) error
+	ModifyStop(stop *Stop) error
 	DeleteStop(id int64) error
+
+	// MergeStops moves everything that refers to the Stop with mergeID,
+	// like Routes, Schedules, and history, to the Stop with keepID and then
+	// deletes the merged Stop.
+	MergeStops(keepID, mergeID int64) error
 }
 
 // ErrStopNotFound indicates that a Stop is not in the service.
@@ -0,0 +1,75 @@
+// Package tracing sends OpenTelemetry traces to an OTLP collector. Until Start
+// is called, spans are no-ops, so packages can create them unconditionally.
+package tracing
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config configures tracing.
+type Config struct {
+	// Endpoint is the host and port of an OTLP/HTTP collector, e.g.
+	// localhost:4318. Tracing is disabled if it's empty.
+	Endpoint string
+
+	// Insecure sends traces over HTTP instead of HTTPS.
+	Insecure bool
+
+	// SampleRatio is the fraction of traces that are recorded.
+	SampleRatio float64
+
+	ServiceName string
+}
+
+// NewConfig creates a new Config.
+func NewConfig(v *viper.Viper) *Config {
+	cfg := &Config{
+		SampleRatio: 1,
+		ServiceName: "shuttletracker",
+	}
+	v.SetDefault("tracing.endpoint", cfg.Endpoint)
+	v.SetDefault("tracing.insecure", cfg.Insecure)
+	v.SetDefault("tracing.sampleratio", cfg.SampleRatio)
+	v.SetDefault("tracing.servicename", cfg.ServiceName)
+	return cfg
+}
+
+// Start begins exporting traces if an endpoint is configured. The returned
+// function flushes remaining spans and should be called before exiting.
+func Start(cfg Config) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer for one of Shuttle Tracker's packages, e.g. "api".
+func Tracer(pkg string) trace.Tracer {
+	return otel.Tracer("github.com/wtg/shuttletracker/" + pkg)
+}
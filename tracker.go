@@ -0,0 +1,56 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// TrackerDevice is a period when a tracker was installed in a Vehicle.
+// Locations reported by the tracker during that period belong to the Vehicle,
+// so history stays attributed correctly after hardware is swapped between
+// Vehicles.
+type TrackerDevice struct {
+	ID        int64  `json:"id"`
+	TrackerID string `json:"tracker_id"`
+	VehicleID int64  `json:"vehicle_id"`
+
+	// Notes describe the hardware, e.g. its model and serial number.
+	Notes string `json:"notes"`
+
+	// Priority orders the trackers installed in a Vehicle at the same time.
+	// Locations from the tracker with the lowest Priority are used while it's
+	// reporting.
+	Priority int `json:"priority"`
+
+	Start time.Time `json:"start"`
+	// End is nil while the tracker is still installed.
+	End *time.Time `json:"end"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Overlaps returns whether any of the TrackerDevice is from since (inclusive)
+// until until (exclusive).
+func (td *TrackerDevice) Overlaps(since, until time.Time) bool {
+	return td.Start.Before(until) && (td.End == nil || td.End.After(since))
+}
+
+// TrackerDeviceService is an interface for interacting with TrackerDevices.
+// Trackers that have never been registered belong to the Vehicle with their
+// TrackerID.
+type TrackerDeviceService interface {
+	TrackerDevice(id int64) (*TrackerDevice, error)
+
+	// TrackerDevices returns the TrackerDevices that were installed at any
+	// time from the filter's Since until its Until, inclusive, in its Vehicle
+	// if it has one, earliest first.
+	TrackerDevices(filter HistoryFilter) ([]*TrackerDevice, error)
+
+	CreateTrackerDevice(device *TrackerDevice) error
+	ModifyTrackerDevice(device *TrackerDevice) error
+	DeleteTrackerDevice(id int64) error
+}
+
+// ErrTrackerDeviceNotFound indicates that a TrackerDevice is not in the service.
+var ErrTrackerDeviceNotFound = errors.New("TrackerDevice not found")
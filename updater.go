@@ -2,6 +2,7 @@ package shuttletracker
 
 import (
 	"net/http"
+	"time"
 )
 
 // DataFeedResponse contains information from the iTRAK data feed.
@@ -9,9 +10,24 @@ type DataFeedResponse struct {
 	Body       []byte
 	StatusCode int
 	Headers    http.Header
+	Received   time.Time
+}
+
+// VehicleDataAge describes how fresh a vehicle's position in the data feed is.
+// A tracker that stops reporting keeps the same TrackerTime while Received
+// advances; a data feed that stops responding stops advancing Received.
+type VehicleDataAge struct {
+	VehicleID int64 `json:"vehicle_id"`
+
+	// TrackerTime is when the vehicle's tracker recorded its latest position.
+	TrackerTime time.Time `json:"tracker_time"`
+
+	// Received is when the data feed last included the vehicle.
+	Received time.Time `json:"received"`
 }
 
 // UpdaterService is an interface for interacting with vehicle location updates.
 type UpdaterService interface {
 	GetLastResponse() *DataFeedResponse
+	VehicleDataAges() []VehicleDataAge
 }
@@ -0,0 +1,80 @@
+package updater
+
+import (
+	"math"
+	"sync"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// coalescer decides which Locations are worth storing when trackers report
+// more often than we need to keep. Locations that aren't stored are still
+// published to subscribers.
+type coalescer struct {
+	// every stores at least every Nth Location from a vehicle.
+	every int
+	// distance stores a Location once a vehicle has moved this many meters.
+	distance float64
+	// heading stores a Location once a vehicle has turned this many degrees.
+	heading float64
+
+	lock   sync.Mutex
+	states map[int64]*coalesceState
+}
+
+type coalesceState struct {
+	stored  *shuttletracker.Location
+	skipped int
+}
+
+func newCoalescer(every int, distance, heading float64) *coalescer {
+	return &coalescer{
+		every:    every,
+		distance: distance,
+		heading:  heading,
+		states:   map[int64]*coalesceState{},
+	}
+}
+
+// setCriteria changes when Locations are stored. Vehicles keep comparing
+// against the last Location that was stored.
+func (c *coalescer) setCriteria(every int, distance, heading float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.every = every
+	c.distance = distance
+	c.heading = heading
+}
+
+// store reports whether a vehicle's Location should be stored. If so, it
+// becomes the Location that later ones are compared against.
+func (c *coalescer) store(vehicleID int64, loc *shuttletracker.Location) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	state, ok := c.states[vehicleID]
+	if !ok || c.disabled() ||
+		(c.every > 0 && state.skipped+1 >= c.every) ||
+		(c.distance > 0 && shuttletracker.DistanceBetween(state.stored.Latitude, state.stored.Longitude, loc.Latitude, loc.Longitude) >= c.distance) ||
+		(c.heading > 0 && headingChange(state.stored.Heading, loc.Heading) >= c.heading) {
+		c.states[vehicleID] = &coalesceState{stored: loc}
+		return true
+	}
+	state.skipped++
+	return false
+}
+
+// disabled is true if no criteria are configured, in which case every
+// Location is stored.
+func (c *coalescer) disabled() bool {
+	return c.every <= 0 && c.distance <= 0 && c.heading <= 0
+}
+
+// headingChange returns the smallest angle between two headings in degrees.
+func headingChange(h1, h2 float64) float64 {
+	d := math.Mod(math.Abs(h1-h2), 360)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
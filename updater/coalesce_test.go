@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"math"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestCoalescerEvery(t *testing.T) {
+	c := newCoalescer(3, 0, 0)
+	expected := []bool{true, false, false, true, false, false, true}
+	for i, e := range expected {
+		if stored := c.store(1, &shuttletracker.Location{}); stored != e {
+			t.Errorf("location %d: got %t, expected %t", i, stored, e)
+		}
+	}
+
+	// vehicles are coalesced independently
+	if !c.store(2, &shuttletracker.Location{}) {
+		t.Error("expected first location for another vehicle to be stored")
+	}
+}
+
+func TestCoalescerDistanceAndHeading(t *testing.T) {
+	c := newCoalescer(0, 100, 45)
+	start := &shuttletracker.Location{Latitude: 42.73, Longitude: -73.68, Heading: 350}
+	if !c.store(1, start) {
+		t.Fatal("expected first location to be stored")
+	}
+
+	// about 11 meters north
+	if c.store(1, &shuttletracker.Location{Latitude: 42.7301, Longitude: -73.68, Heading: 10}) {
+		t.Error("expected nearby location with small heading change to be coalesced")
+	}
+	// about 111 meters north
+	if !c.store(1, &shuttletracker.Location{Latitude: 42.731, Longitude: -73.68, Heading: 350}) {
+		t.Error("expected distant location to be stored")
+	}
+	if !c.store(1, &shuttletracker.Location{Latitude: 42.731, Longitude: -73.68, Heading: 80}) {
+		t.Error("expected turn to be stored")
+	}
+}
+
+func TestCoalescerDisabled(t *testing.T) {
+	c := newCoalescer(0, 0, 0)
+	for i := 0; i < 3; i++ {
+		if !c.store(1, &shuttletracker.Location{}) {
+			t.Errorf("location %d: expected every location to be stored", i)
+		}
+	}
+}
+
+func TestHeadingChange(t *testing.T) {
+	tests := []struct{ h1, h2, expected float64 }{
+		{0, 90, 90},
+		{350, 10, 20},
+		{10, 350, 20},
+		{0, 180, 180},
+		{90, 90, 0},
+	}
+	for _, test := range tests {
+		if d := headingChange(test.h1, test.h2); math.Abs(d-test.expected) > 1e-9 {
+			t.Errorf("headingChange(%f, %f) = %f, expected %f", test.h1, test.h2, d, test.expected)
+		}
+	}
+}
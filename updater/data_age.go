@@ -0,0 +1,84 @@
+package updater
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/metrics"
+)
+
+// dataAges remembers how fresh each vehicle's position in the data feed is.
+// Every instance keeps track of this, not just the leader.
+type dataAges struct {
+	lock sync.Mutex
+	ages map[int64]shuttletracker.VehicleDataAge
+}
+
+func newDataAges() *dataAges {
+	return &dataAges{ages: map[int64]shuttletracker.VehicleDataAge{}}
+}
+
+func (da *dataAges) record(vehicleID int64, trackerTime, received time.Time) {
+	da.lock.Lock()
+	da.ages[vehicleID] = shuttletracker.VehicleDataAge{
+		VehicleID:   vehicleID,
+		TrackerTime: trackerTime,
+		Received:    received,
+	}
+	da.lock.Unlock()
+
+	label := strconv.FormatInt(vehicleID, 10)
+	metrics.VehicleTrackerTime.WithLabelValues(label).Set(unixSeconds(trackerTime))
+	metrics.VehicleReceivedTime.WithLabelValues(label).Set(unixSeconds(received))
+	metrics.VehicleDataDelay.WithLabelValues(label).Set(received.Sub(trackerTime).Seconds())
+}
+
+// all returns the data age of every vehicle that has been in the data feed,
+// ordered by vehicle ID.
+func (da *dataAges) all() []shuttletracker.VehicleDataAge {
+	da.lock.Lock()
+	defer da.lock.Unlock()
+	ages := make([]shuttletracker.VehicleDataAge, 0, len(da.ages))
+	for _, age := range da.ages {
+		ages = append(ages, age)
+	}
+	sort.Slice(ages, func(i, j int) bool {
+		return ages[i].VehicleID < ages[j].VehicleID
+	})
+	return ages
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// recordDataAges notes when each vehicle's tracker last reported, according to
+// a data feed response received at the given time.
+func (u *Updater) recordDataAges(vehiclesData []string, received time.Time) {
+	for _, data := range vehiclesData {
+		vd := vehicleData{}
+		// The leader logs data that can't be parsed when it stores locations.
+		if err := parseVehicleData(data, &vd); err != nil {
+			continue
+		}
+		// Trackers are looked up one at a time, like when locations are
+		// stored, since they can be moved between vehicles.
+		vehicle, err := u.ms.VehicleWithTrackerID(vd.TrackerID)
+		if err == shuttletracker.ErrVehicleNotFound {
+			continue
+		} else if err != nil {
+			log.WithError(err).Error("unable to get vehicle")
+			return
+		}
+		u.dataAges.record(vehicle.ID, vd.Time, received)
+	}
+}
+
+// VehicleDataAges returns how fresh each vehicle's position in the data feed is.
+func (u *Updater) VehicleDataAges() []shuttletracker.VehicleDataAge {
+	return u.dataAges.all()
+}
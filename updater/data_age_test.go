@@ -0,0 +1,39 @@
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestRecordDataAges(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("VehicleWithTrackerID", "1832").Return(&shuttletracker.Vehicle{ID: 7, TrackerID: "1832"}, nil)
+	ms.VehicleService.On("VehicleWithTrackerID", "1833").Return(&shuttletracker.Vehicle{ID: 3, TrackerID: "1833"}, nil)
+	ms.VehicleService.On("VehicleWithTrackerID", "9999").Return(&shuttletracker.Vehicle{TrackerID: "9999"}, shuttletracker.ErrVehicleNotFound)
+	u := &Updater{ms: ms, dataAges: newDataAges()}
+
+	received := time.Date(2018, time.April, 16, 5, 30, 0, 0, time.UTC)
+	u.recordDataAges([]string{
+		testVehicleData,
+		"\r\nVehicle ID:1833 lat:42.73029 lon:-73.67664 dir:283 spd:20 lck:1 time:52000 date:04162018 trig:0 ",
+		"\r\nVehicle ID:9999 lat:42.73029 lon:-73.67664 dir:283 spd:20 lck:1 time:52957 date:04162018 trig:0 ",
+		"garbage",
+	}, received)
+
+	expected := []shuttletracker.VehicleDataAge{
+		{VehicleID: 3, TrackerTime: time.Date(2018, time.April, 16, 5, 20, 0, 0, time.UTC), Received: received},
+		{VehicleID: 7, TrackerTime: time.Date(2018, time.April, 16, 5, 29, 57, 0, time.UTC), Received: received},
+	}
+	ages := u.VehicleDataAges()
+	if len(ages) != len(expected) {
+		t.Fatalf("got %d ages, expected %d", len(ages), len(expected))
+	}
+	for i := range expected {
+		if ages[i] != expected[i] {
+			t.Errorf("got %+v, expected %+v", ages[i], expected[i])
+		}
+	}
+}
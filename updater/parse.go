@@ -0,0 +1,112 @@
+package updater
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vehicleFields are the fields in each vehicle's data from iTRAK, in order.
+var vehicleFields = [...]string{"Vehicle ID:", "lat:", "lon:", "dir:", "spd:", "lck:", "time:", "date:", "trig:"}
+
+// Indexes into vehicleFields.
+const (
+	fieldID = iota
+	fieldLatitude
+	fieldLongitude
+	fieldHeading
+	fieldSpeed
+	fieldLock
+	fieldTime
+	fieldDate
+	fieldTrigger
+)
+
+var errMalformedVehicleData = errors.New("malformed vehicle data")
+
+// vehicleData is one vehicle's data from iTRAK. TrackerID refers to the feed
+// response, so it must be copied if it needs to outlive it.
+type vehicleData struct {
+	TrackerID string
+	Latitude  float64
+	Longitude float64
+	Heading   float64
+	SpeedKMH  float64
+	Time      time.Time
+}
+
+// parseVehicleData parses data of the form
+// "Vehicle ID:1 lat:42.7 lon:-73.6 dir:90 spd:12 lck:1 time:52957 date:04162018 trig:0"
+// into vd. It doesn't allocate, since it runs for every vehicle on every update.
+func parseVehicleData(data string, vd *vehicleData) error {
+	var values [len(vehicleFields)]string
+	rest := data
+	for i, field := range vehicleFields {
+		j := strings.Index(rest, field)
+		if j < 0 {
+			return errMalformedVehicleData
+		}
+		rest = rest[j+len(field):]
+		end := valueEnd(rest)
+		if end == 0 {
+			return errMalformedVehicleData
+		}
+		values[i] = rest[:end]
+		rest = rest[end:]
+	}
+
+	var err error
+	vd.TrackerID = values[fieldID]
+	if vd.Latitude, err = strconv.ParseFloat(values[fieldLatitude], 64); err != nil {
+		return err
+	}
+	if vd.Longitude, err = strconv.ParseFloat(values[fieldLongitude], 64); err != nil {
+		return err
+	}
+	if vd.Heading, err = strconv.ParseFloat(values[fieldHeading], 64); err != nil {
+		return err
+	}
+	if vd.SpeedKMH, err = strconv.ParseFloat(values[fieldSpeed], 64); err != nil {
+		return err
+	}
+	vd.Time, err = parseITrakTimeDate(values[fieldTime], values[fieldDate])
+	return err
+}
+
+// valueEnd returns the length of the numeric value at the start of s.
+func valueEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && c != '.' && c != '-' {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// parseITrakTimeDate parses an iTRAK time (HHMMSS in UTC, with leading zeros
+// dropped) and date (MMDDYYYY).
+func parseITrakTimeDate(t, d string) (time.Time, error) {
+	if len(t) == 0 || len(t) > 6 || len(d) != 8 {
+		return time.Time{}, errMalformedVehicleData
+	}
+	clock, err := strconv.Atoi(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	date, err := strconv.Atoi(d)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	hour, min, sec := clock/10000, clock/100%100, clock%100
+	month, day, year := date/1000000, date/10000%100, date%10000
+	parsed := time.Date(year, time.Month(month), day, hour, min, sec, 0, time.UTC)
+
+	// time.Date normalizes out-of-range values, so make sure it didn't have to.
+	if hour > 23 || min > 59 || sec > 59 || parsed.Month() != time.Month(month) || parsed.Day() != day {
+		return time.Time{}, errMalformedVehicleData
+	}
+	return parsed, nil
+}
@@ -0,0 +1,100 @@
+package updater
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testVehicleData = "\r\nVehicle ID:1832 lat:42.73029 lon:-73.67664 dir:283 spd:20 lck:1 time:52957 date:04162018 trig:0 "
+
+func TestParseVehicleData(t *testing.T) {
+	vd := vehicleData{}
+	err := parseVehicleData(testVehicleData, &vd)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := vehicleData{
+		TrackerID: "1832",
+		Latitude:  42.73029,
+		Longitude: -73.67664,
+		Heading:   283,
+		SpeedKMH:  20,
+		Time:      time.Date(2018, time.April, 16, 5, 29, 57, 0, time.UTC),
+	}
+	if vd != expected {
+		t.Errorf("got %+v, expected %+v", vd, expected)
+	}
+}
+
+func TestParseVehicleDataMalformed(t *testing.T) {
+	cases := []string{
+		"",
+		"Vehicle ID:1832 lat:42.73029",
+		"Vehicle ID: lat:42.73029 lon:-73.67664 dir:283 spd:20 lck:1 time:52957 date:04162018 trig:0",
+		"Vehicle ID:1832 lat:4-2 lon:-73.67664 dir:283 spd:20 lck:1 time:52957 date:04162018 trig:0",
+		"Vehicle ID:1832 lat:42.73029 lon:-73.67664 dir:283 spd:20 lck:1 time:256000 date:04162018 trig:0",
+		"Vehicle ID:1832 lat:42.73029 lon:-73.67664 dir:283 spd:20 lck:1 time:52957 date:02302018 trig:0",
+	}
+	for _, c := range cases {
+		vd := vehicleData{}
+		if err := parseVehicleData(c, &vd); err == nil {
+			t.Errorf("expected error parsing %q", c)
+		}
+	}
+}
+
+func TestParseVehicleDataAllocations(t *testing.T) {
+	vd := vehicleData{}
+	allocs := testing.AllocsPerRun(100, func() {
+		parseVehicleData(testVehicleData, &vd)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func BenchmarkParseVehicleData(b *testing.B) {
+	b.ReportAllocs()
+	vd := vehicleData{}
+	for i := 0; i < b.N; i++ {
+		if err := parseVehicleData(testVehicleData, &vd); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseVehicleDataRegexp measures how vehicle data used to be parsed,
+// for comparison with BenchmarkParseVehicleData.
+func BenchmarkParseVehicleDataRegexp(b *testing.B) {
+	b.ReportAllocs()
+	dataRegexp := regexp.MustCompile(`(?P<id>Vehicle ID:([\d\.]+)) (?P<lat>lat:([\d\.-]+)) (?P<lng>lon:([\d\.-]+)) (?P<heading>dir:([\d\.-]+)) (?P<speed>spd:([\d\.-]+)) (?P<lock>lck:([\d\.-]+)) (?P<time>time:([\d]+)) (?P<date>date:([\d]+)) (?P<status>trig:([\d]+))`)
+	for i := 0; i < b.N; i++ {
+		match := dataRegexp.FindAllStringSubmatch(testVehicleData, -1)[0]
+		result := map[string]string{}
+		for i, item := range match {
+			result[dataRegexp.SubexpNames()[i]] = item
+		}
+		vd := vehicleData{}
+		vd.TrackerID = strings.Replace(result["id"], "Vehicle ID:", "", -1)
+		vd.Latitude, _ = strconv.ParseFloat(strings.Replace(result["lat"], "lat:", "", -1), 64)
+		vd.Longitude, _ = strconv.ParseFloat(strings.Replace(result["lng"], "lon:", "", -1), 64)
+		vd.Heading, _ = strconv.ParseFloat(strings.Replace(result["heading"], "dir:", "", -1), 64)
+		vd.SpeedKMH, _ = strconv.ParseFloat(strings.Replace(result["speed"], "spd:", "", -1), 64)
+		itrakTime := result["time"]
+		if len(itrakTime) < 11 {
+			builder := itrakTime[:5]
+			for i := len(itrakTime); i < 11; i++ {
+				builder += "0"
+			}
+			itrakTime = builder + itrakTime[5:]
+		}
+		t, err := time.Parse("date:01022006 time:150405", result["date"]+" "+itrakTime)
+		if err != nil {
+			b.Fatal(err)
+		}
+		vd.Time = t
+	}
+}
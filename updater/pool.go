@@ -0,0 +1,54 @@
+package updater
+
+import (
+	"expvar"
+	"hash/fnv"
+)
+
+// Metrics about the updater's worker pool. They are published with expvar.
+var (
+	queueDepth    = expvar.NewInt("updater.queue_depth")
+	jobsProcessed = expvar.NewInt("updater.jobs_processed")
+)
+
+// workerPool runs jobs on a fixed number of goroutines so that a large data feed
+// response doesn't cause an unbounded number of concurrent database writes.
+// Jobs with the same key always run on the same worker, so they complete in the
+// order they were submitted.
+type workerPool struct {
+	queues []chan func()
+	depth  *expvar.Int
+	done   *expvar.Int
+}
+
+func newWorkerPool(workers, queueSize int, depth, done *expvar.Int) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &workerPool{
+		queues: make([]chan func(), workers),
+		depth:  depth,
+		done:   done,
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), queueSize)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// submit queues a job. It blocks if the job's worker queue is full.
+func (p *workerPool) submit(key string, job func()) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	p.depth.Add(1)
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- job
+}
+
+func (p *workerPool) work(queue chan func()) {
+	for job := range queue {
+		p.depth.Add(-1)
+		job()
+		p.done.Add(1)
+	}
+}
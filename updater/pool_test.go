@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWorkerPoolOrderPerKey(t *testing.T) {
+	depth := new(expvar.Int)
+	done := new(expvar.Int)
+	p := newWorkerPool(4, 10, depth, done)
+
+	mutex := sync.Mutex{}
+	results := map[string][]int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i % 7)
+		i := i
+		wg.Add(1)
+		p.submit(key, func() {
+			mutex.Lock()
+			results[key] = append(results[key], i)
+			mutex.Unlock()
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	for key, order := range results {
+		for i := 1; i < len(order); i++ {
+			if order[i] < order[i-1] {
+				t.Errorf("jobs for key %s completed out of order: %v", key, order)
+				break
+			}
+		}
+	}
+	if depth.Value() != 0 {
+		t.Errorf("expected queue depth 0, got %d", depth.Value())
+	}
+}
@@ -0,0 +1,74 @@
+package updater
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// sourceSelector chooses between the trackers installed in a vehicle when more
+// than one is reporting, e.g. a hardware tracker and a driver's phone. A
+// tracker's locations are used unless a tracker with a lower Priority in the
+// same vehicle has reported within timeout.
+type sourceSelector struct {
+	timeout time.Duration
+
+	lock sync.Mutex
+	// reported is the tracker time of each tracker's latest location.
+	reported map[string]time.Time
+}
+
+func newSourceSelector(timeout time.Duration) *sourceSelector {
+	return &sourceSelector{
+		timeout:  timeout,
+		reported: map[string]time.Time{},
+	}
+}
+
+// prefer records that a tracker reported at a time and reports whether its
+// location should be used, given the trackers installed in its vehicle.
+func (s *sourceSelector) prefer(trackerID string, at time.Time, devices []*shuttletracker.TrackerDevice) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if at.After(s.reported[trackerID]) {
+		s.reported[trackerID] = at
+	}
+
+	var device *shuttletracker.TrackerDevice
+	for _, d := range devices {
+		if d.TrackerID == trackerID {
+			device = d
+			break
+		}
+	}
+	if device == nil {
+		// The vehicle's only tracker is the one with its tracker ID.
+		return true
+	}
+
+	for _, other := range devices {
+		if other.TrackerID == trackerID || other.Priority >= device.Priority {
+			continue
+		}
+		reported, ok := s.reported[other.TrackerID]
+		if ok && at.Sub(reported) <= s.timeout {
+			return false
+		}
+	}
+	return true
+}
+
+// preferredSource reports whether a location from a tracker should be used for
+// its vehicle, or whether a better tracker in the vehicle is reporting.
+func (u *Updater) preferredSource(vehicleID int64, trackerID string, at time.Time) bool {
+	now := time.Now()
+	devices, err := u.ms.TrackerDevices(shuttletracker.HistoryFilter{Since: now, Until: now, VehicleID: &vehicleID})
+	if err != nil {
+		log.WithVehicleID(vehicleID).WithError(err).Error("unable to get tracker devices")
+		return true
+	}
+	return u.sources.prefer(trackerID, at, devices)
+}
@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestSourceSelector(t *testing.T) {
+	s := newSourceSelector(time.Minute)
+	devices := []*shuttletracker.TrackerDevice{
+		{TrackerID: "hardware", Priority: 0},
+		{TrackerID: "phone", Priority: 1},
+	}
+	start := time.Date(2019, time.March, 4, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		trackerID string
+		at        time.Duration
+		expected  bool
+	}{
+		// the phone is used until the hardware tracker reports
+		{"phone", 0, true},
+		{"hardware", 5 * time.Second, true},
+		{"phone", 10 * time.Second, false},
+		{"hardware", 15 * time.Second, true},
+		// the hardware tracker stops reporting
+		{"phone", 75 * time.Second, false},
+		{"phone", 76 * time.Second, true},
+		// and comes back
+		{"hardware", 80 * time.Second, true},
+		{"phone", 85 * time.Second, false},
+		// trackers that aren't registered are always used
+		{"other", 90 * time.Second, true},
+	}
+	for _, test := range tests {
+		if actual := s.prefer(test.trackerID, start.Add(test.at), devices); actual != test.expected {
+			t.Errorf("%s at %s: got %t, expected %t", test.trackerID, test.at, actual, test.expected)
+		}
+	}
+}
@@ -1,49 +1,88 @@
 package updater
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"math"
 	"net/http"
-	"regexp"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/health"
 	"github.com/wtg/shuttletracker/log"
+	"github.com/wtg/shuttletracker/metrics"
 	"github.com/wtg/shuttletracker/spoofer"
+	"github.com/wtg/shuttletracker/tracing"
 )
 
+var tracer = tracing.Tracer("updater")
+
 // Updater handles periodically grabbing the latest vehicle location data from iTrak.
 type Updater struct {
 	cfg                  Config
 	updateInterval       time.Duration
-	dataRegexp           *regexp.Regexp
 	ms                   shuttletracker.ModelService
 	mutex                *sync.Mutex
 	lastDataFeedResponse *shuttletracker.DataFeedResponse
 	sm                   *sync.Mutex
 	subscribers          []func(*shuttletracker.Location)
 	spoof                *spoofer.Spoofer
+	pool                 *workerPool
+	coalescer            *coalescer
+	sources              *sourceSelector
+	dataAges             *dataAges
+	leader               shuttletracker.LeaderService
+	stop                 chan struct{}
+
+	// intervalChanged tells Run that Reload changed updateInterval, which is
+	// guarded by mutex.
+	intervalChanged chan struct{}
 }
 
 type Config struct {
 	DataFeed       string
 	UpdateInterval string
+
+	// Workers is how many vehicles are parsed and stored concurrently.
+	Workers int
+
+	// CoalesceEvery, CoalesceDistance, and CoalesceHeading reduce how many
+	// Locations are stored for trackers that report frequently. A Location is
+	// stored if it is at least the Nth since the last one stored, or if the
+	// vehicle has moved at least that many meters or turned at least that many
+	// degrees. Zero disables a criterion. Every Location is still published.
+	CoalesceEvery    int
+	CoalesceDistance float64
+	CoalesceHeading  float64
+
+	// SourceTimeout is how long a vehicle's preferred tracker can go without
+	// reporting before locations from its other trackers are used. If it's
+	// empty, defaultSourceTimeout is used.
+	SourceTimeout string
 }
 
-// New creates an Updater.
-func New(cfg Config, ms shuttletracker.ModelService, spoof *spoofer.Spoofer) (*Updater, error) {
+const defaultSourceTimeout = time.Minute
+
+// New creates an Updater. If multiple instances are running, only the leader
+// stores locations, but all of them keep track of the latest data feed response.
+func New(cfg Config, ms shuttletracker.ModelService, spoof *spoofer.Spoofer, leader shuttletracker.LeaderService) (*Updater, error) {
 	updater := &Updater{
 		cfg:         cfg,
 		ms:          ms,
+		leader:      leader,
 		mutex:       &sync.Mutex{},
 		sm:          &sync.Mutex{},
 		subscribers: []func(*shuttletracker.Location){},
 		spoof:       spoof,
+		stop:        make(chan struct{}),
+
+		intervalChanged: make(chan struct{}, 1),
 	}
 
 	interval, err := time.ParseDuration(cfg.UpdateInterval)
@@ -51,11 +90,17 @@ func New(cfg Config, ms shuttletracker.ModelService, spoof *spoofer.Spoofer) (*U
 		return nil, err
 	}
 	updater.updateInterval = interval
-
-	// Match each API field with any number (+)
-	//   of the previous expressions (\d digit, \. escaped period, - negative number)
-	//   Specify named capturing groups to store each field from data feed
-	updater.dataRegexp = regexp.MustCompile(`(?P<id>Vehicle ID:([\d\.]+)) (?P<lat>lat:([\d\.-]+)) (?P<lng>lon:([\d\.-]+)) (?P<heading>dir:([\d\.-]+)) (?P<speed>spd:([\d\.-]+)) (?P<lock>lck:([\d\.-]+)) (?P<time>time:([\d]+)) (?P<date>date:([\d]+)) (?P<status>trig:([\d]+))`)
+	sourceTimeout := defaultSourceTimeout
+	if cfg.SourceTimeout != "" {
+		sourceTimeout, err = time.ParseDuration(cfg.SourceTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	updater.sources = newSourceSelector(sourceTimeout)
+	updater.pool = newWorkerPool(cfg.Workers, 100, queueDepth, jobsProcessed)
+	updater.coalescer = newCoalescer(cfg.CoalesceEvery, cfg.CoalesceDistance, cfg.CoalesceHeading)
+	updater.dataAges = newDataAges()
 
 	return updater, nil
 }
@@ -64,9 +109,17 @@ func NewConfig(v *viper.Viper) *Config {
 	cfg := &Config{
 		UpdateInterval: "10s",
 		DataFeed:       "https://shuttles.rpi.edu/datafeed",
+		Workers:        4,
+		CoalesceEvery:  1,
+		SourceTimeout:  defaultSourceTimeout.String(),
 	}
 	v.SetDefault("updater.updateinterval", cfg.UpdateInterval)
 	v.SetDefault("updater.datafeed", cfg.DataFeed)
+	v.SetDefault("updater.workers", cfg.Workers)
+	v.SetDefault("updater.coalesceevery", cfg.CoalesceEvery)
+	v.SetDefault("updater.coalescedistance", cfg.CoalesceDistance)
+	v.SetDefault("updater.coalesceheading", cfg.CoalesceHeading)
+	v.SetDefault("updater.sourcetimeout", cfg.SourceTimeout)
 	return cfg
 }
 
@@ -75,16 +128,62 @@ func (u *Updater) Run() {
 	// Only run updater if we are not in spoof updates mode
 	if !u.spoof.SpoofUpdates {
 		log.Debug("Updater started.")
-		ticker := time.Tick(u.updateInterval)
+		ticker := time.NewTicker(u.interval())
+		defer func() {
+			ticker.Stop()
+		}()
 
 		// Do one initial update.
 		u.update()
 
-		// Call update() every updateInterval.
-		for range ticker {
-			u.update()
+		// Call update() every updateInterval until stopped. An update that has
+		// started always finishes so that no Locations are lost.
+		for {
+			select {
+			case <-ticker.C:
+				u.update()
+			case <-u.intervalChanged:
+				ticker.Stop()
+				ticker = time.NewTicker(u.interval())
+			case <-u.stop:
+				log.Debug("Updater stopped.")
+				return
+			}
+		}
+	}
+}
+
+// Stop makes Run return once the current update, if any, has been stored.
+func (u *Updater) Stop() {
+	close(u.stop)
+}
+
+// Reload applies the settings that can change while the updater is running:
+// the update interval and how Locations are coalesced.
+func (u *Updater) Reload(cfg Config) error {
+	interval, err := time.ParseDuration(cfg.UpdateInterval)
+	if err != nil {
+		return err
+	}
+	u.coalescer.setCriteria(cfg.CoalesceEvery, cfg.CoalesceDistance, cfg.CoalesceHeading)
+
+	u.mutex.Lock()
+	changed := interval != u.updateInterval
+	u.updateInterval = interval
+	u.mutex.Unlock()
+	if changed {
+		select {
+		case u.intervalChanged <- struct{}{}:
+		default:
 		}
 	}
+	return nil
+}
+
+func (u *Updater) interval() time.Duration {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.updateInterval
 }
 
 // Subscribe allows callers to provide a function that is called after Updater parses a new Location.
@@ -110,15 +209,26 @@ func (u *Updater) notifySubscribers(loc *shuttletracker.Location) {
 // Send a request to iTrak API, get updated shuttle info,
 // store updated records in the database, and remove old records.
 func (u *Updater) update() {
+	timer := prometheus.NewTimer(metrics.UpdaterCycleDuration)
+	defer timer.ObserveDuration()
+	ctx, span := tracer.Start(context.Background(), "update")
+	defer span.End()
+
 	// Make request to iTrak data feed
+	_, fetchSpan := tracer.Start(ctx, "fetch data feed")
 	client := http.Client{Timeout: time.Second * 5}
 	resp, err := client.Get(u.cfg.DataFeed)
+	fetchSpan.End()
 	if err != nil {
+		metrics.FeedErrors.WithLabelValues("request").Inc()
+		health.Report(health.Updater, err)
 		log.WithError(err).Error("Could not get data feed.")
 		return
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.FeedErrors.WithLabelValues("status").Inc()
+		health.Report(health.Updater, fmt.Errorf("data feed status code %d", resp.StatusCode))
 		log.Errorf("data feed status code %d", resp.StatusCode)
 		return
 	}
@@ -126,6 +236,8 @@ func (u *Updater) update() {
 	// Read response body content
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
+		metrics.FeedErrors.WithLabelValues("read").Inc()
+		health.Report(health.Updater, err)
 		log.WithError(err).Error("Could not read data feed.")
 		return
 	}
@@ -135,13 +247,21 @@ func (u *Updater) update() {
 		Body:       body,
 		StatusCode: resp.StatusCode,
 		Headers:    resp.Header,
+		Received:   time.Now(),
 	}
 	u.setLastResponse(dfresp)
+	health.Report(health.Updater, nil)
 
 	delim := "eof"
 	// split the body of response by delimiter
 	vehiclesData := strings.Split(string(body), delim)
 	vehiclesData = vehiclesData[:len(vehiclesData)-1] // last element is EOF
+	u.recordDataAges(vehiclesData, dfresp.Received)
+
+	if !u.leader.Leader() {
+		log.Debug("Not the leader; not storing locations.")
+		return
+	}
 
 	// TODO: Figure out if this handles == 1 vehicle correctly or always assumes > 1.
 	if len(vehiclesData) <= 1 {
@@ -149,13 +269,15 @@ func (u *Updater) update() {
 	}
 
 	wg := sync.WaitGroup{}
-	// for parsed data, update each vehicle
+	// for parsed data, update each vehicle. Data for the same tracker is always
+	// handled by the same worker so that it's stored in order.
 	for _, vehicleData := range vehiclesData {
+		vehicleData := vehicleData
 		wg.Add(1)
-		go func(vehicleData string) {
-			u.handleVehicleData(vehicleData)
+		u.pool.submit(trackerIDFromData(vehicleData), func() {
+			u.handleVehicleData(ctx, vehicleData)
 			wg.Done()
-		}(vehicleData)
+		})
 	}
 	wg.Wait()
 	log.Debugf("Updated vehicles.")
@@ -171,96 +293,99 @@ func (u *Updater) update() {
 	}
 }
 
-// nolint: gocyclo
-func (u *Updater) handleVehicleData(vehicleData string) {
-	match := u.dataRegexp.FindAllStringSubmatch(vehicleData, -1)[0]
-	// Store named capturing group and matching expression as a key value pair
-	result := map[string]string{}
-	for i, item := range match {
-		result[u.dataRegexp.SubexpNames()[i]] = item
+func (u *Updater) handleVehicleData(ctx context.Context, data string) {
+	_, span := tracer.Start(ctx, "handle vehicle data")
+	defer span.End()
+
+	vd := vehicleData{}
+	err := parseVehicleData(data, &vd)
+	if err != nil {
+		span.RecordError(err)
+		metrics.FeedErrors.WithLabelValues("parse").Inc()
+		log.WithError(err).Error("unable to parse vehicle data")
+		return
 	}
 
 	// Create new vehicle update & insert update into database
 
-	itrakID := strings.Replace(result["id"], "Vehicle ID:", "", -1)
-	vehicle, err := u.ms.VehicleWithTrackerID(itrakID)
+	vehicle, err := u.ms.VehicleWithTrackerID(vd.TrackerID)
 	if err == shuttletracker.ErrVehicleNotFound {
-		log.Warnf("Unknown vehicle ID \"%s\" returned by iTrak. Make sure all vehicles have been added.", itrakID)
+		log.WithField("tracker_id", vd.TrackerID).Warn("Unknown vehicle ID returned by iTrak. Make sure all vehicles have been added.")
 		return
 	} else if err != nil {
 		log.WithError(err).Error("Unable to fetch vehicle.")
 		return
 	}
-
-	// determine if this is a new update from itrak by comparing timestamps
-	newTime, err := itrakTimeDate(result["time"], result["date"])
-	if err != nil {
-		log.WithError(err).Error("unable to parse iTRAK time and date")
+	if !vehicle.Enabled {
+		// Disabled vehicles, e.g. ones in for maintenance, aren't tracked.
+		return
+	}
+	if !u.preferredSource(vehicle.ID, vd.TrackerID, vd.Time) {
+		log.WithVehicleID(vehicle.ID).Debugf("Ignoring tracker %s in favor of a preferred tracker.", vd.TrackerID)
 		return
 	}
+
+	// determine if this is a new update from itrak by comparing timestamps
 	lastUpdate, err := u.ms.LatestLocation(vehicle.ID)
 	if err != nil && err != shuttletracker.ErrLocationNotFound {
-		log.WithError(err).Error("unable to retrieve last update")
+		log.WithVehicleID(vehicle.ID).WithError(err).Error("unable to retrieve last update")
 		return
 	}
-	if err != shuttletracker.ErrLocationNotFound && newTime.Equal(lastUpdate.Time) {
+	if err != shuttletracker.ErrLocationNotFound && vd.Time.Equal(lastUpdate.Time) {
 		// Timestamp is not new; don't store update.
 		return
 	}
-	log.Debugf("Updating %s.", vehicle.Name)
+	log.WithVehicleID(vehicle.ID).Debugf("Updating %s.", vehicle.Name)
 
 	// vehicle found and no error
 	route, err := u.GuessRouteForVehicle(vehicle)
 	if err != nil {
-		log.WithError(err).Error("Unable to guess route for vehicle.")
+		log.WithVehicleID(vehicle.ID).WithError(err).Error("Unable to guess route for vehicle.")
 		return
 	}
 
-	latitude, err := strconv.ParseFloat(strings.Replace(result["lat"], "lat:", "", -1), 64)
-	if err != nil {
-		log.WithError(err).Error("unable to parse latitude as float")
-		return
-	}
-	longitude, err := strconv.ParseFloat(strings.Replace(result["lng"], "lon:", "", -1), 64)
-	if err != nil {
-		log.WithError(err).Error("unable to parse longitude as float")
-		return
-	}
-	heading, err := strconv.ParseFloat(strings.Replace(result["heading"], "dir:", "", -1), 64)
-	if err != nil {
-		log.WithError(err).Error("unable to parse heading as float")
-		return
-	}
-	// convert KPH to MPH
-	speedKMH, err := strconv.ParseFloat(strings.Replace(result["speed"], "spd:", "", -1), 64)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-	speedMPH := kphToMPH(speedKMH)
-
-	trackerID := strings.Replace(result["id"], "Vehicle ID:", "", -1)
-
 	update := &shuttletracker.Location{
-		TrackerID: trackerID,
-		Latitude:  latitude,
-		Longitude: longitude,
-		Heading:   heading,
-		Speed:     speedMPH,
-		Time:      newTime,
+		// copy the tracker ID so that the Location doesn't keep the whole feed response alive
+		TrackerID: string([]byte(vd.TrackerID)),
+		Latitude:  vd.Latitude,
+		Longitude: vd.Longitude,
+		Heading:   vd.Heading,
+		Speed:     kphToMPH(vd.SpeedKMH),
+		Time:      vd.Time,
+		VehicleID: &vehicle.ID,
 	}
 	if route != nil {
 		update.RouteID = &route.ID
 	}
 
+	if !u.coalescer.store(vehicle.ID, update) {
+		if err := u.ms.PublishLocation(update); err != nil {
+			log.WithVehicleID(vehicle.ID).WithError(err).Errorf("could not publish location")
+			return
+		}
+		u.notifySubscribers(update)
+		return
+	}
+
 	if err := u.ms.CreateLocation(update); err != nil {
-		log.WithError(err).Errorf("could not create location")
+		log.WithVehicleID(vehicle.ID).WithError(err).Errorf("could not create location")
 		return
 	}
 
 	u.notifySubscribers(update)
 }
 
+// trackerIDFromData finds the tracker ID in a vehicle's data without parsing all of it.
+func trackerIDFromData(vehicleData string) string {
+	prefix := vehicleFields[fieldID]
+	i := strings.Index(vehicleData, prefix)
+	if i < 0 {
+		return ""
+	}
+	id := vehicleData[i+len(prefix):]
+	return id[:valueEnd(id)]
+}
+
 // Convert kmh to mph
 func kphToMPH(kmh float64) float64 {
 	return kmh * 0.621371192
@@ -283,7 +408,7 @@ func (u *Updater) GuessRouteForVehicle(vehicle *shuttletracker.Vehicle) (route *
 	updates, err := u.ms.LocationsSince(vehicle.ID, time.Now().Add(time.Minute*-15))
 	if len(updates) < 5 {
 		// Can't make a guess with fewer than 5 updates.
-		log.Debugf("%v has too few recent updates (%d) to guess route.", vehicle.Name, len(updates))
+		log.WithVehicleID(vehicle.ID).Debugf("%v has too few recent updates (%d) to guess route.", vehicle.Name, len(updates))
 		return
 	}
 
@@ -324,7 +449,7 @@ func (u *Updater) GuessRouteForVehicle(vehicle *shuttletracker.Vehicle) (route *
 
 	// not on a route
 	if minRouteID == 0 {
-		log.Debugf("%v not on route; distance from nearest: %v", vehicle.Name, minDistance)
+		log.WithVehicleID(vehicle.ID).Debugf("%v not on route; distance from nearest: %v", vehicle.Name, minDistance)
 		return nil, nil
 	}
 
@@ -332,23 +457,12 @@ func (u *Updater) GuessRouteForVehicle(vehicle *shuttletracker.Vehicle) (route *
 	if err != nil {
 		return route, err
 	}
-	log.Debugf("%v on %s route.", vehicle.Name, route.Name)
+	log.WithVehicleID(vehicle.ID).WithField(log.RouteIDField, route.ID).Debugf("%v on %s route.", vehicle.Name, route.Name)
 	return route, err
 }
 
 func itrakTimeDate(itrakTime, itrakDate string) (time.Time, error) {
-	// Add leading zeros to the time value if they're missing. time.Parse expects this.
-	if len(itrakTime) < 11 {
-		builder := itrakTime[:5]
-		for i := len(itrakTime); i < 11; i++ {
-			builder += "0"
-		}
-		builder += itrakTime[5:]
-		itrakTime = builder
-	}
-
-	combined := itrakDate + " " + itrakTime
-	return time.Parse("date:01022006 time:150405", combined)
+	return parseITrakTimeDate(strings.TrimPrefix(itrakTime, "time:"), strings.TrimPrefix(itrakDate, "date:"))
 }
 
 func (u *Updater) setLastResponse(dfresp *shuttletracker.DataFeedResponse) {
@@ -1,8 +1,17 @@
 package updater
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+	"github.com/wtg/shuttletracker/spoofer"
 )
 
 func TestITrakTimeDate(t *testing.T) {
@@ -60,3 +69,93 @@ func TestITrakTimeDate(t *testing.T) {
 		t.Errorf("got %+v, expected %+v", parsed, expected)
 	}
 }
+
+func TestTrackerIDFromData(t *testing.T) {
+	data := "\nVehicle ID:1832 lat:42.7303 lon:-73.6766 dir:90 spd:12 lck:1 time:52957 date:04162018 trig:0 "
+	if id := trackerIDFromData(data); id != "1832" {
+		t.Errorf("got %q, expected %q", id, "1832")
+	}
+	if id := trackerIDFromData("garbage"); id != "" {
+		t.Errorf("got %q, expected empty string", id)
+	}
+}
+
+func TestStop(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer feed.Close()
+
+	spoof, err := spoofer.New(spoofer.Config{SpoofInterval: "10s"}, nil)
+	if err != nil {
+		t.Fatalf("unable to create spoofer: %s", err)
+	}
+	u, err := New(Config{DataFeed: feed.URL, UpdateInterval: "10ms", Workers: 1}, nil, spoof, nil)
+	if err != nil {
+		t.Fatalf("unable to create updater: %s", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		u.Run()
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	u.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("Run didn't return after Stop")
+	}
+}
+
+func TestReload(t *testing.T) {
+	spoof, err := spoofer.New(spoofer.Config{SpoofInterval: "10s"}, nil)
+	if err != nil {
+		t.Fatalf("unable to create spoofer: %s", err)
+	}
+	u, err := New(Config{UpdateInterval: "10s", Workers: 1, CoalesceEvery: 1}, nil, spoof, nil)
+	if err != nil {
+		t.Fatalf("unable to create updater: %s", err)
+	}
+
+	if err := u.Reload(Config{UpdateInterval: "5s", CoalesceEvery: 3}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if u.interval() != 5*time.Second || u.coalescer.every != 3 {
+		t.Errorf("got interval %s and every %d, expected 5s and 3", u.interval(), u.coalescer.every)
+	}
+	select {
+	case <-u.intervalChanged:
+	default:
+		t.Error("expected Run to be told that the interval changed")
+	}
+
+	if err := u.Reload(Config{UpdateInterval: "later"}); err == nil {
+		t.Error("expected error for invalid interval")
+	}
+	if u.interval() != 5*time.Second {
+		t.Errorf("got interval %s, expected it not to change", u.interval())
+	}
+}
+
+func TestHandleVehicleDataDisabled(t *testing.T) {
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("VehicleWithTrackerID", "1832").Return(&shuttletracker.Vehicle{ID: 1, Enabled: false}, nil)
+	spoof, err := spoofer.New(spoofer.Config{SpoofInterval: "10s"}, nil)
+	if err != nil {
+		t.Fatalf("unable to create spoofer: %s", err)
+	}
+	u, err := New(Config{UpdateInterval: "10s", Workers: 1}, ms, spoof, nil)
+	if err != nil {
+		t.Fatalf("unable to create updater: %s", err)
+	}
+	notified := false
+	u.Subscribe(func(*shuttletracker.Location) { notified = true })
+
+	u.handleVehicleData(context.Background(), testVehicleData)
+	ms.LocationService.AssertNotCalled(t, "CreateLocation", tmock.Anything)
+	if notified {
+		t.Error("expected disabled vehicle's location not to be published")
+	}
+}
@@ -0,0 +1,35 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// Usage is anonymous, aggregate usage counted by one instance since it last
+// recorded usage.
+type Usage struct {
+	Day time.Time
+
+	// Endpoints counts requests by route pattern, e.g. "/vehicles/".
+	Endpoints map[string]int64
+
+	// Topics counts Fusion subscriptions by topic.
+	Topics map[string]int64
+
+	// Clients identifies the websocket clients that connected. They are
+	// hashes that can't be traced back to a client and change every day.
+	Clients []string
+}
+
+// DailyUsage is the usage of every instance on a day.
+type DailyUsage struct {
+	Day       time.Time        `json:"day"`
+	Endpoints map[string]int64 `json:"endpoints"`
+	Topics    map[string]int64 `json:"topics"`
+	Clients   int64            `json:"clients"`
+}
+
+// UsageService is an interface for recording and summarizing usage.
+type UsageService interface {
+	RecordUsage(usage *Usage) error
+	Usage(since time.Time) ([]*DailyUsage, error)
+}
@@ -1,7 +1,9 @@
 package shuttletracker
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"time"
 )
 
@@ -16,14 +18,52 @@ type Vehicle struct {
 	Updated   time.Time `json:"updated"`
 	Enabled   bool      `json:"enabled"`
 	TrackerID string    `json:"tracker_id"`
+
+	// Capacity is how many riders the vehicle holds, or zero if unknown.
+	Capacity             int    `json:"capacity"`
+	WheelchairAccessible bool   `json:"wheelchair_accessible"`
+	Make                 string `json:"make"`
+	Model                string `json:"model"`
+	LicensePlate         string `json:"license_plate"`
+
+	// OutOfService is whether maintenance is keeping the vehicle out of
+	// service, until OutOfServiceUntil if that's known. They aren't stored
+	// with the vehicle; the API sets them from MaintenanceRecords.
+	OutOfService      bool       `json:"out_of_service"`
+	OutOfServiceUntil *time.Time `json:"out_of_service_until"`
+
+	// Color, Label, and Icon style the vehicle's marker on the map. An
+	// empty Color means the color of the vehicle's route.
+	Color string `json:"color"`
+	Label string `json:"label"`
+	Icon  string `json:"icon"`
+
+	// GroupID is the VehicleGroup that the vehicle belongs to, if any.
+	GroupID *int64 `json:"group_id"`
+}
+
+// NormalizeLicensePlate returns a license plate in upper case without spaces
+// or dashes, so that plates can be looked up however they're written.
+func NormalizeLicensePlate(plate string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(plate)))
 }
 
 // VehicleService is an interface for interacting with Vehicles.
 type VehicleService interface {
 	Vehicle(id int64) (*Vehicle, error)
 	VehicleWithTrackerID(id string) (*Vehicle, error)
+	VehicleWithLicensePlate(plate string) (*Vehicle, error)
 	Vehicles() ([]*Vehicle, error)
 	EnabledVehicles() ([]*Vehicle, error)
+	// VehiclesContext and EnabledVehiclesContext make their queries part of
+	// ctx's trace.
+	VehiclesContext(ctx context.Context) ([]*Vehicle, error)
+	EnabledVehiclesContext(ctx context.Context) ([]*Vehicle, error)
 	CreateVehicle(vehicle *Vehicle) error
 	DeleteVehicle(id int64) error
 	ModifyVehicle(vehicle *Vehicle) error
@@ -0,0 +1,27 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// WidgetKey lets a third-party site, like a department's, embed shuttle
+// information. Browsers may only use the key from pages on one of Domains or
+// their subdomains.
+type WidgetKey struct {
+	ID      int64     `json:"id"`
+	Key     string    `json:"key"`
+	Name    string    `json:"name"`
+	Domains []string  `json:"domains"`
+	Created time.Time `json:"created"`
+}
+
+// WidgetKeyService is an interface for interacting with WidgetKeys.
+type WidgetKeyService interface {
+	WidgetKeys() ([]*WidgetKey, error)
+	CreateWidgetKey(key *WidgetKey) error
+	DeleteWidgetKey(id int64) error
+}
+
+// ErrWidgetKeyNotFound indicates that a WidgetKey is not in the service.
+var ErrWidgetKeyNotFound = errors.New("Widget key not found")